@@ -0,0 +1,194 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package actor
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/looplab/eventhorizon"
+)
+
+// DefaultMaxAggregates is the default number of aggregates resident on a Host.
+const DefaultMaxAggregates = 1000
+
+// Host keeps aggregates resident in memory and handles their commands one at a
+// time, so that hot aggregates are not loaded from the event store for every
+// command and commands for the same aggregate don't conflict. After saving the
+// events of a command they are applied to the resident aggregate.
+//
+// An aggregate is dropped and loaded again if a command fails after storing
+// events, or if saving fails, for example when another writer has saved events
+// for it. The least recently used aggregates are evicted when there are more
+// than the max resident ones.
+type Host struct {
+	repository eventhorizon.Repository
+	max        int
+	residents  map[eventhorizon.UUID]*list.Element
+	lru        *list.List
+	mu         sync.Mutex
+}
+
+type resident struct {
+	id        eventhorizon.UUID
+	aggregate eventhorizon.Aggregate
+	users     int
+	evicted   bool
+	mu        sync.Mutex
+}
+
+// NewHost creates a Host loading and saving aggregates with a repository.
+func NewHost(repository eventhorizon.Repository) (*Host, error) {
+	if repository == nil {
+		return nil, eventhorizon.ErrNilRepository
+	}
+
+	h := &Host{
+		repository: repository,
+		max:        DefaultMaxAggregates,
+		residents:  make(map[eventhorizon.UUID]*list.Element),
+		lru:        list.New(),
+	}
+	return h, nil
+}
+
+// SetMaxAggregates sets the max number of resident aggregates,
+// DefaultMaxAggregates by default.
+func (h *Host) SetMaxAggregates(max int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.max = max
+	h.evict()
+}
+
+// HandleCommand handles a command with its resident aggregate, which is loaded
+// if it is not resident.
+func (h *Host) HandleCommand(command eventhorizon.Command) error {
+	_, err := h.HandleCommandWithVersion(command)
+	return err
+}
+
+// HandleCommandWithVersion handles a command as HandleCommand and returns the
+// version of the aggregate after saving its new events.
+func (h *Host) HandleCommandWithVersion(command eventhorizon.Command) (int, error) {
+	if err := eventhorizon.CheckCommand(command); err != nil {
+		return 0, err
+	}
+
+	r := h.acquire(command.AggregateID())
+	defer h.release(r)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.aggregate == nil {
+		aggregate, err := h.repository.Load(command.AggregateType(), r.id)
+		if err != nil {
+			return 0, err
+		}
+		if aggregate == nil {
+			return 0, eventhorizon.ErrAggregateNotFound
+		}
+		r.aggregate = aggregate
+	}
+	aggregate := r.aggregate
+
+	if err := aggregate.HandleCommand(command); err != nil {
+		if len(aggregate.GetUncommittedEvents()) > 0 {
+			r.aggregate = nil
+		}
+		return 0, err
+	}
+
+	events := append([]eventhorizon.Event(nil), aggregate.GetUncommittedEvents()...)
+	if err := h.repository.Save(aggregate); err != nil {
+		r.aggregate = nil
+		return 0, err
+	}
+	aggregate.ClearUncommittedEvents()
+	for _, event := range events {
+		aggregate.ApplyEvent(event)
+		aggregate.IncrementVersion()
+	}
+
+	return aggregate.Version(), nil
+}
+
+// Len returns the number of resident aggregates.
+func (h *Host) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.lru.Len()
+}
+
+// Evict evicts the resident aggregates for which a function returns true, for
+// example the ones no longer owned by the node. Aggregates handling a command
+// are dropped when it is done.
+func (h *Host) Evict(f func(eventhorizon.UUID) bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for id, e := range h.residents {
+		if !f(id) {
+			continue
+		}
+		if r := e.Value.(*resident); r.users > 0 {
+			r.evicted = true
+			continue
+		}
+		h.lru.Remove(e)
+		delete(h.residents, id)
+	}
+}
+
+// acquire gets or creates the resident of an aggregate, marking it as used.
+func (h *Host) acquire(id eventhorizon.UUID) *resident {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var r *resident
+	if e, ok := h.residents[id]; ok {
+		h.lru.MoveToFront(e)
+		r = e.Value.(*resident)
+	} else {
+		r = &resident{id: id}
+		h.residents[id] = h.lru.PushFront(r)
+	}
+	r.users++
+	return r
+}
+
+// release marks a resident as no longer used and evicts it if it was evicted
+// while used, and any unused residents above the max.
+func (h *Host) release(r *resident) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	r.users--
+	if r.evicted && r.users == 0 {
+		h.lru.Remove(h.residents[r.id])
+		delete(h.residents, r.id)
+	}
+	h.evict()
+}
+
+// evict evicts the least recently used residents above the max that are not
+// used, the caller must hold the lock.
+func (h *Host) evict() {
+	for e := h.lru.Back(); e != nil && h.lru.Len() > h.max; {
+		prev := e.Prev()
+		if r := e.Value.(*resident); r.users == 0 {
+			h.lru.Remove(e)
+			delete(h.residents, r.id)
+		}
+		e = prev
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package actor
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/storage/memory"
+)
+
+func TestHost(t *testing.T) {
+	store := memory.NewEventStore(nil)
+	repo, loads := newCounterRepository(t, store)
+	failing := &failingRepository{Repository: repo}
+	host, err := NewHost(failing)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	id := eventhorizon.NewUUID()
+
+	t.Log("handle commands with a resident aggregate")
+	for i := 1; i <= 3; i++ {
+		version, err := host.HandleCommandWithVersion(&increment{ID: id})
+		if err != nil {
+			t.Error("there should be no error:", err)
+		}
+		if version != i {
+			t.Error("the version should be correct:", version)
+		}
+	}
+	if *loads != 1 {
+		t.Error("the aggregate should be loaded once:", *loads)
+	}
+	events, _ := store.Load(id)
+	if len(events) != 3 {
+		t.Error("there should be 3 events:", len(events))
+	}
+
+	t.Log("keep the aggregate for rejected commands")
+	if err := host.HandleCommand(&increment{ID: id, Reject: true}); err != errRejected {
+		t.Error("there should be a rejected error:", err)
+	}
+	if *loads != 1 {
+		t.Error("the aggregate should be loaded once:", *loads)
+	}
+
+	t.Log("handle concurrent commands one at a time")
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := host.HandleCommand(&increment{ID: id}); err != nil {
+				t.Error("there should be no error:", err)
+			}
+		}()
+	}
+	wg.Wait()
+	version, err := host.HandleCommandWithVersion(&increment{ID: id})
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if version != 14 {
+		t.Error("the version should be correct:", version)
+	}
+
+	t.Log("reload the aggregate when saving fails")
+	failing.err = errors.New("conflict")
+	if err := host.HandleCommand(&increment{ID: id}); err != failing.err {
+		t.Error("there should be a save error:", err)
+	}
+	failing.err = nil
+	if version, err := host.HandleCommandWithVersion(&increment{ID: id}); err != nil || version != 15 {
+		t.Error("the version should be correct:", version, err)
+	}
+	if *loads != 2 {
+		t.Error("the aggregate should be loaded again:", *loads)
+	}
+
+	t.Log("check the fields of commands")
+	if err := host.HandleCommand(&increment{}); err == nil {
+		t.Error("there should be a field error")
+	}
+
+	t.Log("evict the least recently used aggregates")
+	host.SetMaxAggregates(1)
+	if err := host.HandleCommand(&increment{ID: eventhorizon.NewUUID()}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if host.Len() != 1 {
+		t.Error("there should be one resident aggregate:", host.Len())
+	}
+	host.Evict(func(eventhorizon.UUID) bool { return true })
+	if host.Len() != 0 {
+		t.Error("there should be no resident aggregates:", host.Len())
+	}
+}
+
+var errRejected = errors.New("rejected")
+
+type counter struct {
+	*eventhorizon.AggregateBase
+	count int
+}
+
+func (a *counter) AggregateType() string {
+	return "Counter"
+}
+
+func (a *counter) HandleCommand(command eventhorizon.Command) error {
+	switch c := command.(type) {
+	case *increment:
+		if c.Reject {
+			return errRejected
+		}
+		a.StoreEvent(&incremented{ID: a.AggregateID()})
+	}
+	return nil
+}
+
+func (a *counter) ApplyEvent(event eventhorizon.Event) {
+	a.count++
+}
+
+type increment struct {
+	ID     eventhorizon.UUID
+	Reject bool `eh:"optional"`
+}
+
+func (c *increment) AggregateID() eventhorizon.UUID { return c.ID }
+func (c *increment) AggregateType() string          { return "Counter" }
+func (c *increment) CommandType() string            { return "Increment" }
+
+type incremented struct {
+	ID eventhorizon.UUID
+}
+
+func (e *incremented) AggregateID() eventhorizon.UUID { return e.ID }
+func (e *incremented) AggregateType() string          { return "Counter" }
+func (e *incremented) EventType() string              { return "Incremented" }
+
+// newCounterRepository creates a repository for counters, counting the loads.
+func newCounterRepository(t *testing.T, store eventhorizon.EventStore) (eventhorizon.Repository, *int) {
+	repo, err := eventhorizon.NewCallbackRepository(store)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	loads := 0
+	repo.RegisterAggregate(&counter{}, func(id eventhorizon.UUID) eventhorizon.Aggregate {
+		loads++
+		return &counter{AggregateBase: eventhorizon.NewAggregateBase(id)}
+	})
+	return repo, &loads
+}
+
+type failingRepository struct {
+	eventhorizon.Repository
+	err error
+}
+
+func (r *failingRepository) Save(aggregate eventhorizon.Aggregate) error {
+	if r.err != nil {
+		return r.err
+	}
+	return r.Repository.Save(aggregate)
+}
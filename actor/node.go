@@ -0,0 +1,301 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package actor hosts hot aggregates in memory on the node owning them, and
+// routes commands to that node over gRPC. It is experimental.
+package actor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/status"
+
+	"github.com/looplab/eventhorizon"
+	jsoncodec "github.com/looplab/eventhorizon/codec/json"
+)
+
+// ErrNoNodes is when a command is handled with a ring without nodes.
+var ErrNoNodes = errors.New("no nodes in ring")
+
+// ErrNotOwner is when a node receives a command for an aggregate that it does
+// not own in its ring, usually because the rings of the nodes differ.
+var ErrNotOwner = errors.New("node does not own aggregate")
+
+// ErrCouldNotMarshalCommand is when a command could not be marshaled.
+var ErrCouldNotMarshalCommand = errors.New("could not marshal command")
+
+// ErrCouldNotUnmarshalCommand is when a command could not be unmarshaled into
+// a concrete type.
+var ErrCouldNotUnmarshalCommand = errors.New("could not unmarshal command")
+
+// CommandError is an error from handling a command on a remote node.
+type CommandError struct {
+	Node    string
+	Message string
+}
+
+// Error implements the Error method of the error interface.
+func (e *CommandError) Error() string {
+	return e.Node + ": " + e.Message
+}
+
+const (
+	codecName           = "ehjson"
+	handleCommandMethod = "/eventhorizon.actor.Host/HandleCommand"
+)
+
+// commandRequest is the wire format of a routed command.
+type commandRequest struct {
+	Type    string `json:"type"`
+	Version int    `json:"version"`
+	Data    []byte `json:"data"`
+}
+
+// commandReply is the wire format of the result of a routed command.
+type commandReply struct {
+	Version int    `json:"version"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Node routes commands to the node owning their aggregate in a ring over gRPC,
+// and handles the commands it owns with a Host. Each aggregate is handled by
+// one node at a time as long as the nodes agree on the ring.
+//
+// Nodes are identified in the ring by their gRPC addresses, and the service
+// is added to the gRPC server of each node with Register. The command types
+// must be registered with eventhorizon.RegisterCommandType on all nodes.
+//
+// An example would be:
+//     ring := actor.NewRing("10.0.0.1:9000", "10.0.0.2:9000")
+//     node := actor.NewNode("10.0.0.1:9000", ring, host)
+//     node.Register(server)
+//     go server.Serve(listener)
+//     err := node.HandleCommand(command)
+//
+// Experimental: the nodes don't agree on the ring by themselves, membership
+// changes must be applied to the rings of all nodes followed by Rebalance.
+// Commands for moved aggregates may fail with ErrNotOwner meanwhile, and the
+// concurrency checks of the event store guard against two writers.
+type Node struct {
+	addr        string
+	ring        *Ring
+	host        *Host
+	codec       eventhorizon.CommandCodec
+	dialOptions []grpc.DialOption
+	conns       map[string]*grpc.ClientConn
+	mu          sync.Mutex
+}
+
+// NewNode creates a Node with an address, a ring and a host for its aggregates.
+func NewNode(addr string, ring *Ring, host *Host) *Node {
+	return &Node{
+		addr:        addr,
+		ring:        ring,
+		host:        host,
+		codec:       jsoncodec.CommandCodec{},
+		dialOptions: []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())},
+		conns:       make(map[string]*grpc.ClientConn),
+	}
+}
+
+// SetCodec sets the codec used for the commands, JSON by default.
+func (n *Node) SetCodec(codec eventhorizon.CommandCodec) {
+	n.codec = codec
+}
+
+// SetDialOptions sets the options for connecting to other nodes, without
+// transport security by default.
+func (n *Node) SetDialOptions(opts ...grpc.DialOption) {
+	n.dialOptions = opts
+}
+
+// Register registers the service of the node on a gRPC server.
+func (n *Node) Register(s *grpc.Server) {
+	s.RegisterService(&serviceDesc, n)
+}
+
+// HandleCommand handles a command on the node owning its aggregate.
+func (n *Node) HandleCommand(command eventhorizon.Command) error {
+	_, err := n.HandleCommandWithVersion(context.Background(), command)
+	return err
+}
+
+// HandleCommandWithContext handles a command as HandleCommand, and cancels the
+// call to the owning node when the context is done.
+func (n *Node) HandleCommandWithContext(ctx context.Context, command eventhorizon.Command) error {
+	_, err := n.HandleCommandWithVersion(ctx, command)
+	return err
+}
+
+// HandleCommandWithVersion handles a command as HandleCommandWithContext and
+// returns the version of the aggregate after saving its new events. Errors
+// from handling the command on other nodes are returned as a *CommandError.
+func (n *Node) HandleCommandWithVersion(ctx context.Context, command eventhorizon.Command) (int, error) {
+	owner := n.ring.Owner(command.AggregateID())
+	if owner == "" {
+		return 0, ErrNoNodes
+	} else if owner == n.addr {
+		return n.host.HandleCommandWithVersion(command)
+	}
+
+	data, err := n.codec.MarshalCommand(command)
+	if err != nil {
+		return 0, ErrCouldNotMarshalCommand
+	}
+	req := &commandRequest{command.CommandType(),
+		eventhorizon.CommandVersion(command.CommandType()), data}
+
+	conn, err := n.conn(owner)
+	if err != nil {
+		return 0, err
+	}
+	reply := &commandReply{}
+	if err := conn.Invoke(ctx, handleCommandMethod, req, reply,
+		grpc.CallContentSubtype(codecName)); err != nil {
+		if status.Code(err) == codes.FailedPrecondition {
+			return 0, ErrNotOwner
+		}
+		return 0, err
+	}
+	if reply.Error != "" {
+		return 0, &CommandError{owner, reply.Error}
+	}
+	return reply.Version, nil
+}
+
+// Rebalance evicts the resident aggregates no longer owned by the node and
+// closes the connections to nodes no longer in the ring, after the ring has
+// changed.
+func (n *Node) Rebalance() {
+	n.host.Evict(func(id eventhorizon.UUID) bool {
+		return n.ring.Owner(id) != n.addr
+	})
+
+	nodes := make(map[string]bool)
+	for _, node := range n.ring.Nodes() {
+		nodes[node] = true
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for addr, conn := range n.conns {
+		if !nodes[addr] {
+			conn.Close()
+			delete(n.conns, addr)
+		}
+	}
+}
+
+// Close closes the connections to the other nodes.
+func (n *Node) Close() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var err error
+	for addr, conn := range n.conns {
+		if e := conn.Close(); e != nil && err == nil {
+			err = e
+		}
+		delete(n.conns, addr)
+	}
+	return err
+}
+
+// conn returns the connection to a node, which is created on first use.
+func (n *Node) conn(addr string) (*grpc.ClientConn, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if conn, ok := n.conns[addr]; ok {
+		return conn, nil
+	}
+	conn, err := grpc.NewClient(addr, n.dialOptions...)
+	if err != nil {
+		return nil, err
+	}
+	n.conns[addr] = conn
+	return conn, nil
+}
+
+// handle handles a command routed from another node.
+func (n *Node) handle(ctx context.Context, req *commandRequest) (*commandReply, error) {
+	command, err := eventhorizon.UnmarshalCommandVersion(n.codec, req.Type, req.Version, req.Data)
+	if err == eventhorizon.ErrCommandNotRegistered || err == eventhorizon.ErrCommandVersionNotRegistered {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	} else if err != nil {
+		return nil, status.Error(codes.InvalidArgument, ErrCouldNotUnmarshalCommand.Error())
+	}
+	if n.ring.Owner(command.AggregateID()) != n.addr {
+		return nil, status.Error(codes.FailedPrecondition, ErrNotOwner.Error())
+	}
+
+	version, err := n.host.HandleCommandWithVersion(command)
+	if err != nil {
+		return &commandReply{Error: err.Error()}, nil
+	}
+	return &commandReply{Version: version}, nil
+}
+
+// commandServer is the handler type of the gRPC service.
+type commandServer interface {
+	handle(context.Context, *commandRequest) (*commandReply, error)
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: "eventhorizon.actor.Host",
+	HandlerType: (*commandServer)(nil),
+	Methods: []grpc.MethodDesc{{
+		MethodName: "HandleCommand",
+		Handler:    handleCommand,
+	}},
+	Metadata: "actor/node.go",
+}
+
+func handleCommand(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	req := &commandRequest{}
+	if err := dec(req); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(commandServer).handle(ctx, req)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: handleCommandMethod}
+	return interceptor(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(commandServer).handle(ctx, req.(*commandRequest))
+	})
+}
+
+// wireCodec is the gRPC codec of the service, which uses JSON instead of
+// protobuf for the requests and replies.
+type wireCodec struct{}
+
+func (wireCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (wireCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (wireCodec) Name() string {
+	return codecName
+}
+
+func init() {
+	encoding.RegisterCodec(wireCodec{})
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package actor
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+
+	"github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/storage/memory"
+)
+
+func TestNode(t *testing.T) {
+	eventhorizon.RegisterCommandType(func() eventhorizon.Command { return &increment{} })
+	defer eventhorizon.UnregisterCommandType("Increment")
+
+	ring := NewRing()
+	var nodes []*Node
+	var stores []*memory.EventStore
+	for i := 0; i < 2; i++ {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+		store := memory.NewEventStore(nil)
+		repo, _ := newCounterRepository(t, store)
+		host, err := NewHost(repo)
+		if err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+		node := NewNode(lis.Addr().String(), ring, host)
+		defer node.Close()
+		server := grpc.NewServer()
+		node.Register(server)
+		go server.Serve(lis)
+		defer server.Stop()
+		ring.Add(lis.Addr().String())
+		nodes = append(nodes, node)
+		stores = append(stores, store)
+	}
+
+	// Find an aggregate owned by the second node.
+	id := eventhorizon.NewUUID()
+	for ring.Owner(id) != nodes[1].addr {
+		id = eventhorizon.NewUUID()
+	}
+
+	t.Log("route a command to the owning node")
+	version, err := nodes[0].HandleCommandWithVersion(context.Background(), &increment{ID: id})
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if version != 1 {
+		t.Error("the version should be correct:", version)
+	}
+	if events, _ := stores[1].Load(id); len(events) != 1 {
+		t.Error("the event should be saved by the owning node:", len(events))
+	}
+	if events, _ := stores[0].Load(id); len(events) != 0 {
+		t.Error("the event should not be saved by the routing node:", len(events))
+	}
+
+	t.Log("handle a command on the owning node")
+	if err := nodes[1].HandleCommand(&increment{ID: id}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if nodes[1].host.Len() != 1 || nodes[0].host.Len() != 0 {
+		t.Error("the aggregate should be resident on the owning node")
+	}
+
+	t.Log("return errors from the owning node")
+	err = nodes[0].HandleCommand(&increment{ID: id, Reject: true})
+	if err, ok := err.(*CommandError); !ok || err.Node != nodes[1].addr || err.Message != errRejected.Error() {
+		t.Error("there should be a command error:", err)
+	}
+
+	t.Log("reject commands for aggregates of other nodes")
+	stale := NewNode("stale", NewRing(nodes[1].addr), nodes[0].host)
+	defer stale.Close()
+	id2 := eventhorizon.NewUUID()
+	for ring.Owner(id2) != nodes[0].addr {
+		id2 = eventhorizon.NewUUID()
+	}
+	if err := stale.HandleCommand(&increment{ID: id2}); err != ErrNotOwner {
+		t.Error("there should be a not owner error:", err)
+	}
+
+	t.Log("rebalance after the ring has changed")
+	ring.Remove(nodes[1].addr)
+	nodes[1].Rebalance()
+	if nodes[1].host.Len() != 0 {
+		t.Error("the aggregate should be evicted:", nodes[1].host.Len())
+	}
+	nodes[0].Rebalance()
+	if len(nodes[0].conns) != 0 {
+		t.Error("the connection should be closed:", len(nodes[0].conns))
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package actor
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/looplab/eventhorizon"
+)
+
+// DefaultReplicas is the default number of points of each node on a Ring.
+const DefaultReplicas = 160
+
+// Ring places aggregates on nodes by consistent hashing of their IDs, so that
+// only the aggregates of a node move when it is added or removed. All nodes
+// must have the same members in their rings to agree on the owners.
+type Ring struct {
+	replicas int
+	points   []uint32
+	owners   map[uint32]string
+	nodes    map[string]bool
+	mu       sync.RWMutex
+}
+
+// NewRing creates a Ring with some nodes, identified by their addresses.
+func NewRing(nodes ...string) *Ring {
+	r := &Ring{
+		replicas: DefaultReplicas,
+		owners:   make(map[uint32]string),
+		nodes:    make(map[string]bool),
+	}
+	r.Add(nodes...)
+	return r
+}
+
+// Add adds nodes to the ring.
+func (r *Ring) Add(nodes ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, node := range nodes {
+		if r.nodes[node] {
+			continue
+		}
+		r.nodes[node] = true
+		for i := 0; i < r.replicas; i++ {
+			point := hash(node + "#" + strconv.Itoa(i))
+			if _, ok := r.owners[point]; ok {
+				continue // Keep the first owner on the rare collisions.
+			}
+			r.owners[point] = node
+			r.points = append(r.points, point)
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i] < r.points[j] })
+}
+
+// Remove removes nodes from the ring.
+func (r *Ring) Remove(nodes ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, node := range nodes {
+		delete(r.nodes, node)
+	}
+	points := r.points[:0]
+	for _, point := range r.points {
+		if r.nodes[r.owners[point]] {
+			points = append(points, point)
+		} else {
+			delete(r.owners, point)
+		}
+	}
+	r.points = points
+}
+
+// Nodes returns the nodes of the ring, sorted.
+func (r *Ring) Nodes() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	nodes := make([]string, 0, len(r.nodes))
+	for node := range r.nodes {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	return nodes
+}
+
+// Owner returns the node owning an aggregate, or an empty string if the ring
+// has no nodes.
+func (r *Ring) Owner(id eventhorizon.UUID) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if len(r.points) == 0 {
+		return ""
+	}
+	point := hash(string(id))
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= point })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.owners[r.points[i]]
+}
+
+// hash hashes a node point or an ID, with SHA-256 to spread the similar keys
+// evenly on the ring.
+func hash(s string) uint32 {
+	sum := sha256.Sum256([]byte(s))
+	return binary.BigEndian.Uint32(sum[:4])
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package actor
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/looplab/eventhorizon"
+)
+
+func TestRing(t *testing.T) {
+	ring := NewRing()
+	id := eventhorizon.NewUUID()
+	if owner := ring.Owner(id); owner != "" {
+		t.Error("there should be no owner:", owner)
+	}
+
+	t.Log("spread aggregates on the nodes")
+	ring.Add("a", "b", "c")
+	if nodes := ring.Nodes(); !reflect.DeepEqual(nodes, []string{"a", "b", "c"}) {
+		t.Error("the nodes should be correct:", nodes)
+	}
+	ids := make([]eventhorizon.UUID, 3000)
+	owners := make(map[eventhorizon.UUID]string)
+	counts := make(map[string]int)
+	for i := range ids {
+		ids[i] = eventhorizon.UUID(fmt.Sprintf("%08d-0000-4000-8000-000000000000", i))
+		owners[ids[i]] = ring.Owner(ids[i])
+		counts[owners[ids[i]]]++
+	}
+	for _, node := range []string{"a", "b", "c"} {
+		if counts[node] < 800 {
+			t.Error("the node should own a share of the aggregates:", node, counts[node])
+		}
+	}
+
+	t.Log("only move the aggregates of a removed node")
+	ring.Remove("b")
+	for _, id := range ids {
+		owner := ring.Owner(id)
+		if owner == "b" {
+			t.Error("the removed node should own no aggregates")
+		}
+		if owners[id] != "b" && owner != owners[id] {
+			t.Error("the aggregate should not move:", id)
+		}
+	}
+}
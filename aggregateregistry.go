@@ -0,0 +1,67 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"sync"
+)
+
+var aggregateFactories = make(map[string]func(UUID) Aggregate)
+var aggregateFactoriesMu sync.RWMutex
+
+// RegisterAggregateType registers an aggregate factory for the type of the
+// aggregates it creates. The factory is used by repositories to create empty
+// aggregates of a type to apply events to, for repositories that don't have
+// their own factory for the type.
+//
+// An example would be:
+//     RegisterAggregateType(func(id UUID) Aggregate { return NewMyAggregate(id) })
+func RegisterAggregateType(factory func(UUID) Aggregate) error {
+	aggregateType := factory("").AggregateType()
+
+	aggregateFactoriesMu.Lock()
+	defer aggregateFactoriesMu.Unlock()
+	if _, ok := aggregateFactories[aggregateType]; ok {
+		return ErrAggregateAlreadyRegistered
+	}
+	aggregateFactories[aggregateType] = factory
+	return nil
+}
+
+// UnregisterAggregateType removes the factory of an aggregate type.
+func UnregisterAggregateType(aggregateType string) {
+	aggregateFactoriesMu.Lock()
+	defer aggregateFactoriesMu.Unlock()
+	delete(aggregateFactories, aggregateType)
+}
+
+// CreateAggregate creates an empty aggregate of a type with its registered
+// factory. Returns ErrAggregateNotRegistered if the type is not registered.
+func CreateAggregate(aggregateType string, id UUID) (Aggregate, error) {
+	aggregateFactoriesMu.RLock()
+	defer aggregateFactoriesMu.RUnlock()
+	factory, ok := aggregateFactories[aggregateType]
+	if !ok {
+		return nil, ErrAggregateNotRegistered
+	}
+	return factory(id), nil
+}
+
+// NewAggregate creates a new aggregate of a type with its registered factory
+// and an ID from NewAggregateID. Returns ErrAggregateNotRegistered if the type
+// is not registered.
+func NewAggregate(aggregateType string) (Aggregate, error) {
+	return CreateAggregate(aggregateType, NewAggregateID(aggregateType))
+}
@@ -0,0 +1,59 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"testing"
+)
+
+func TestRegisterAggregateType(t *testing.T) {
+	factory := func(id UUID) Aggregate {
+		return &TestAggregate{
+			AggregateBase: NewAggregateBase(id),
+		}
+	}
+	if err := RegisterAggregateType(factory); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	defer UnregisterAggregateType("TestAggregate")
+	if err := RegisterAggregateType(factory); err != ErrAggregateAlreadyRegistered {
+		t.Error("there should be a ErrAggregateAlreadyRegistered error:", err)
+	}
+
+	t.Log("create aggregate")
+	id := NewUUID()
+	aggregate, err := CreateAggregate("TestAggregate", id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if aggregate.AggregateID() != id || aggregate.AggregateType() != "TestAggregate" {
+		t.Error("the aggregate should be correct:", aggregate)
+	}
+	if _, err := CreateAggregate("TestAggregate2", id); err != ErrAggregateNotRegistered {
+		t.Error("there should be a ErrAggregateNotRegistered error:", err)
+	}
+
+	t.Log("load with the registered factory")
+	repo, store := createRepoAndStore(t)
+	event := &TestEvent{id, "event"}
+	store.Events = []Event{event}
+	aggregate, err = repo.Load("TestAggregate", id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if aggregate.(*TestAggregate).appliedEvent != event {
+		t.Error("the event should be applied:", aggregate)
+	}
+}
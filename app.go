@@ -0,0 +1,215 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+)
+
+// ErrInvalidComponent is when a component added to an app can neither be run
+// nor closed.
+var ErrInvalidComponent = errors.New("invalid component")
+
+// ErrShutdownTimeout is when a component did not stop within the shutdown
+// timeout of an app.
+var ErrShutdownTimeout = errors.New("shutdown timeout")
+
+// Runner is a component that runs until its context is done, such as a
+// TimeoutManager, a RetentionJob or a remote command bus.
+type Runner interface {
+	// Run runs the component until the context is done, or until it fails.
+	Run(context.Context) error
+}
+
+// RunnerFunc is a function that can be used as a runner.
+type RunnerFunc func(context.Context) error
+
+// Run implements the Run method of the Runner interface.
+func (f RunnerFunc) Run(ctx context.Context) error {
+	return f(ctx)
+}
+
+// App owns the components of an app, such as stores, buses, relays,
+// schedulers and projectors. It starts the components that are starters and
+// runs the ones that are runners in the order that they were added, and stops
+// and closes them in the reverse order, so that components should be added
+// after the ones they depend on. A component is stopped by canceling its
+// context and waiting for its Run to return, and by calling Stop if it is a
+// started Stopper, and then closed if it has a Close method.
+type App struct {
+	components []*component
+	timeout    time.Duration
+	clock      Clock
+	closeOnce  sync.Once
+	closeErr   error
+}
+
+type component struct {
+	name    string
+	starter Starter
+	runner  Runner
+	stopper Stopper
+	close   func() error
+	started bool
+	cancel  context.CancelFunc
+	done    chan error
+}
+
+// NewApp creates a new App. The clock is used for the shutdown timeout.
+func NewApp(clock Clock) *App {
+	return &App{
+		timeout: 30 * time.Second,
+		clock:   clock,
+	}
+}
+
+// SetShutdownTimeout sets how long to wait for each component to stop, the
+// default is 30 seconds.
+func (a *App) SetShutdownTimeout(timeout time.Duration) {
+	a.timeout = timeout
+}
+
+// Add adds a named component, which must be a Starter, Stopper or Runner or
+// have a Close method. Returns ErrInvalidComponent otherwise. Components must
+// be added before the app is run.
+func (a *App) Add(name string, c interface{}) error {
+	comp := &component{name: name}
+	comp.starter, _ = c.(Starter)
+	comp.runner, _ = c.(Runner)
+	comp.stopper, _ = c.(Stopper)
+	switch closer := c.(type) {
+	case interface{ Close() error }:
+		comp.close = closer.Close
+	case interface{ Close() }:
+		comp.close = func() error {
+			closer.Close()
+			return nil
+		}
+	}
+	if comp.starter == nil && comp.runner == nil && comp.stopper == nil && comp.close == nil {
+		return ErrInvalidComponent
+	}
+	a.components = append(a.components, comp)
+	return nil
+}
+
+// Run starts the components in the order they were added and runs the runners
+// until the context is done or one of them fails, and then stops and closes
+// all the components. If a component could not be started the components are
+// closed without running. Returns the first error of the components, if any.
+func (a *App) Run(ctx context.Context) error {
+	for _, c := range a.components {
+		if c.starter != nil {
+			if err := c.starter.Start(ctx); err != nil {
+				a.Close()
+				return fmt.Errorf("%s: %w", c.name, err)
+			}
+		}
+		c.started = true
+	}
+
+	failed := make(chan struct{})
+	var failOnce sync.Once
+	for _, c := range a.components {
+		if c.runner == nil {
+			continue
+		}
+		// Runners are only canceled by Close, which stops them in reverse
+		// order, not all at once when the context is done.
+		var runCtx context.Context
+		runCtx, c.cancel = context.WithCancel(context.WithoutCancel(ctx))
+		c.done = make(chan error, 1)
+		go func(c *component) {
+			err := c.runner.Run(runCtx)
+			if runCtx.Err() != nil && errors.Is(err, runCtx.Err()) {
+				err = nil // Stopped.
+			} else if err != nil {
+				failOnce.Do(func() { close(failed) })
+			}
+			c.done <- err
+		}(c)
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-failed:
+	}
+	return a.Close()
+}
+
+// RunUntilSignal runs the app until it receives one of the signals, by
+// default os.Interrupt.
+func (a *App) RunUntilSignal(signals ...os.Signal) error {
+	if len(signals) == 0 {
+		signals = []os.Signal{os.Interrupt}
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), signals...)
+	defer stop()
+	return a.Run(ctx)
+}
+
+// Close stops and closes all components in the reverse order that they were
+// added, for apps that are not run or to stop a running app. Returns the first
+// error of the components, if any. Closing more than once has no effect.
+func (a *App) Close() error {
+	a.closeOnce.Do(func() {
+		for i := len(a.components) - 1; i >= 0; i-- {
+			if err := a.stop(a.components[i]); err != nil {
+				log.Printf("error: app: %v\n", err)
+				if a.closeErr == nil {
+					a.closeErr = err
+				}
+			}
+		}
+	})
+	return a.closeErr
+}
+
+// stop stops a component and closes it. The component is closed even if it
+// did not stop within the timeout.
+func (a *App) stop(c *component) error {
+	var err error
+	if c.cancel != nil {
+		c.cancel()
+		select {
+		case err = <-c.done:
+		case <-a.clock.After(a.timeout):
+			err = ErrShutdownTimeout
+		}
+	}
+	if c.stopper != nil && c.started {
+		ctx, cancel := context.WithTimeout(context.Background(), a.timeout)
+		if stopErr := c.stopper.Stop(ctx); err == nil {
+			err = stopErr
+		}
+		cancel()
+	}
+	if c.close != nil {
+		if closeErr := c.close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", c.name, err)
+	}
+	return nil
+}
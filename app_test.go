@@ -0,0 +1,175 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestApp(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		order []string
+	)
+	record := func(s string) {
+		mu.Lock()
+		order = append(order, s)
+		mu.Unlock()
+	}
+
+	app := NewApp(SystemClock{})
+	if err := app.Add("store", &appCloser{name: "store", record: record}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := app.Add("bus", &appRunner{appCloser{name: "bus", record: record}}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := app.Add("projector", RunnerFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		record("stop projector")
+		return ctx.Err()
+	})); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := app.Add("invalid", struct{}{}); err != ErrInvalidComponent {
+		t.Error("there should be a ErrInvalidComponent error:", err)
+	}
+
+	t.Log("stop in reverse order when the context is done")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- app.Run(ctx) }()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	if err := <-done; err != nil {
+		t.Error("there should be no error:", err)
+	}
+	expected := []string{"stop projector", "stop bus", "close bus", "close store"}
+	if !reflect.DeepEqual(order, expected) {
+		t.Error("the components should be stopped in order:", order)
+	}
+
+	t.Log("close only once")
+	if err := app.Close(); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(order) != len(expected) {
+		t.Error("the components should not be closed again:", order)
+	}
+}
+
+func TestAppLifecycle(t *testing.T) {
+	var order []string
+	record := func(s string) func(context.Context) error {
+		return func(context.Context) error {
+			order = append(order, s)
+			return nil
+		}
+	}
+	store := &appCloser{name: "store", record: func(s string) { order = append(order, s) }}
+	var job Lifecycle
+	job.OnStart(record("warm up"))
+	job.OnStop(record("stop job"))
+	app := NewApp(SystemClock{})
+	app.Add("store", store)
+	app.Add("job", &job)
+
+	t.Log("start in order and stop in reverse order")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := app.Run(ctx); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	expected := []string{"warm up", "stop job", "close store"}
+	if !reflect.DeepEqual(order, expected) {
+		t.Error("the components should be started and stopped in order:", order)
+	}
+
+	t.Log("close without starting when a component fails to start")
+	order = nil
+	errFailed := errors.New("failed")
+	var failing Lifecycle
+	failing.OnStart(func(context.Context) error { return errFailed })
+	failing.OnStop(record("stop failing"))
+	app = NewApp(SystemClock{})
+	app.Add("store", store)
+	app.Add("failing", &failing)
+	if err := app.Run(context.Background()); !errors.Is(err, errFailed) {
+		t.Error("the error should be correct:", err)
+	}
+	if !reflect.DeepEqual(order, []string{"close store"}) {
+		t.Error("the components should only be closed:", order)
+	}
+}
+
+func TestAppFailure(t *testing.T) {
+	errFailed := errors.New("failed")
+	stopped := false
+	app := NewApp(SystemClock{})
+	app.Add("worker", RunnerFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		stopped = true
+		return nil
+	}))
+	app.Add("failing", RunnerFunc(func(ctx context.Context) error {
+		return errFailed
+	}))
+
+	t.Log("stop all components when one fails")
+	err := app.Run(context.Background())
+	if !errors.Is(err, errFailed) || err.Error() != "failing: failed" {
+		t.Error("the error should be correct:", err)
+	}
+	if !stopped {
+		t.Error("the other components should be stopped")
+	}
+
+	t.Log("time out components that don't stop")
+	app = NewApp(SystemClock{})
+	app.SetShutdownTimeout(10 * time.Millisecond)
+	block := make(chan struct{})
+	defer close(block)
+	app.Add("stuck", RunnerFunc(func(ctx context.Context) error {
+		<-block
+		return nil
+	}))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := app.Run(ctx); !errors.Is(err, ErrShutdownTimeout) {
+		t.Error("there should be a ErrShutdownTimeout error:", err)
+	}
+}
+
+type appCloser struct {
+	name   string
+	record func(string)
+}
+
+func (c *appCloser) Close() { c.record("close " + c.name) }
+
+type appRunner struct {
+	appCloser
+}
+
+func (r *appRunner) Run(ctx context.Context) error {
+	<-ctx.Done()
+	r.record("stop " + r.name)
+	return nil
+}
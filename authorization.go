@@ -0,0 +1,183 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"fmt"
+)
+
+// ErrUnauthorized is when a principal is not authorized to send a command.
+type ErrUnauthorized struct {
+	CommandType string
+	Principal   string
+	Reason      string
+}
+
+func (e ErrUnauthorized) Error() string {
+	principal := e.Principal
+	if principal == "" {
+		principal = "anonymous"
+	}
+	msg := fmt.Sprintf("%s is not authorized to send %s", principal, e.CommandType)
+	if e.Reason != "" {
+		msg += ": " + e.Reason
+	}
+	return msg
+}
+
+// Principal is the authenticated sender of commands, with its roles. The zero
+// Principal is anonymous.
+type Principal struct {
+	ID    string
+	Roles []string
+}
+
+// HasRole returns true if the principal has a role.
+func (p Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+// NewContextWithPrincipal returns a context with a principal, for example from
+// the authentication of a request, for handling commands with it.
+func NewContextWithPrincipal(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext returns the principal of a context, or the anonymous
+// principal if there is none.
+func PrincipalFromContext(ctx context.Context) Principal {
+	principal, _ := ctx.Value(principalKey{}).(Principal)
+	return principal
+}
+
+// Authorizer authorizes principals to send commands.
+type Authorizer interface {
+	// Authorize returns nil if the principal may send the command, or else an
+	// ErrUnauthorized.
+	Authorize(ctx context.Context, principal Principal, command Command) error
+}
+
+// AuthorizerFunc is a function that can be used as an authorizer.
+type AuthorizerFunc func(context.Context, Principal, Command) error
+
+// Authorize implements the Authorize method of the Authorizer interface.
+func (f AuthorizerFunc) Authorize(ctx context.Context, principal Principal, command Command) error {
+	return f(ctx, principal, command)
+}
+
+// Policy returns true if a principal may send a command.
+type Policy func(Principal, Command) bool
+
+// RequireRoles is a policy that allows principals with any of the roles.
+func RequireRoles(roles ...string) Policy {
+	return func(principal Principal, command Command) bool {
+		for _, role := range roles {
+			if principal.HasRole(role) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// RequireAuthenticated is a policy that allows all principals but the
+// anonymous one.
+func RequireAuthenticated(principal Principal, command Command) bool {
+	return principal.ID != ""
+}
+
+// AllowAll is a policy that allows all principals, also anonymous.
+func AllowAll(principal Principal, command Command) bool {
+	return true
+}
+
+// PolicyAuthorizer is an Authorizer with a policy per command type. Commands
+// without a policy are checked with the default policy, which denies all.
+type PolicyAuthorizer struct {
+	policies      map[string]Policy
+	defaultPolicy Policy
+}
+
+// NewPolicyAuthorizer creates a new PolicyAuthorizer.
+func NewPolicyAuthorizer() *PolicyAuthorizer {
+	return &PolicyAuthorizer{
+		policies: make(map[string]Policy),
+		defaultPolicy: func(Principal, Command) bool {
+			return false
+		},
+	}
+}
+
+// SetPolicy sets the policy of the types of commands.
+func (a *PolicyAuthorizer) SetPolicy(policy Policy, commands ...Command) {
+	for _, command := range commands {
+		a.policies[command.CommandType()] = policy
+	}
+}
+
+// SetDefaultPolicy sets the policy of commands without a policy.
+func (a *PolicyAuthorizer) SetDefaultPolicy(policy Policy) {
+	a.defaultPolicy = policy
+}
+
+// Authorize implements the Authorize method of the Authorizer interface.
+func (a *PolicyAuthorizer) Authorize(ctx context.Context, principal Principal, command Command) error {
+	policy, ok := a.policies[command.CommandType()]
+	if !ok {
+		policy = a.defaultPolicy
+	}
+	if !policy(principal, command) {
+		return ErrUnauthorized{CommandType: command.CommandType(), Principal: principal.ID}
+	}
+	return nil
+}
+
+// AuthorizationMiddleware returns a command handler middleware that authorizes
+// the principal of the context of each command before it is handled. Commands
+// must be handled with HandleCommandWithContext to carry a principal, commands
+// without one are authorized as anonymous.
+func AuthorizationMiddleware(authorizer Authorizer) CommandHandlerMiddleware {
+	return func(handler CommandHandler) CommandHandler {
+		return &authorizationHandler{handler, authorizer}
+	}
+}
+
+type authorizationHandler struct {
+	handler    CommandHandler
+	authorizer Authorizer
+}
+
+// HandleCommand implements the HandleCommand method of the CommandHandler
+// interface.
+func (h *authorizationHandler) HandleCommand(command Command) error {
+	return h.HandleCommandWithContext(context.Background(), command)
+}
+
+// HandleCommandWithContext implements the HandleCommandWithContext method of
+// the ContextCommandHandler interface.
+func (h *authorizationHandler) HandleCommandWithContext(ctx context.Context, command Command) error {
+	if err := h.authorizer.Authorize(ctx, PrincipalFromContext(ctx), command); err != nil {
+		return err
+	}
+	return HandleCommandWithContext(ctx, h.handler, command)
+}
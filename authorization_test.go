@@ -0,0 +1,73 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestAuthorizationMiddleware(t *testing.T) {
+	authorizer := NewPolicyAuthorizer()
+	authorizer.SetPolicy(RequireRoles("admin", "editor"), &TestCommand{})
+	authorizer.SetPolicy(AllowAll, &TestCommand2{})
+	var handled []Command
+	handler := UseCommandHandlerMiddleware(CommandHandlerFunc(func(command Command) error {
+		handled = append(handled, command)
+		return nil
+	}), AuthorizationMiddleware(authorizer))
+
+	t.Log("handle a command with a role of the policy")
+	command := &TestCommand{NewUUID(), "command1"}
+	ctx := NewContextWithPrincipal(context.Background(), Principal{ID: "user1", Roles: []string{"editor"}})
+	if err := HandleCommandWithContext(ctx, handler, command); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(handled) != 1 {
+		t.Error("the command should be handled:", handled)
+	}
+
+	t.Log("deny a command without a role of the policy")
+	ctx = NewContextWithPrincipal(context.Background(), Principal{ID: "user2", Roles: []string{"viewer"}})
+	err := HandleCommandWithContext(ctx, handler, command)
+	var unauthorized ErrUnauthorized
+	if !errors.As(err, &unauthorized) {
+		t.Fatal("there should be a ErrUnauthorized error:", err)
+	}
+	if unauthorized.CommandType != "TestCommand" || unauthorized.Principal != "user2" {
+		t.Error("the error should be correct:", unauthorized)
+	}
+	if len(handled) != 1 {
+		t.Error("the command should not be handled:", handled)
+	}
+
+	t.Log("handle anonymous commands by policy")
+	if err := handler.HandleCommand(command); err == nil {
+		t.Error("the anonymous command should be denied")
+	}
+	if err := handler.HandleCommand(&TestCommand2{NewUUID(), "command2"}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("deny commands without a policy")
+	if err := authorizer.Authorize(ctx, Principal{ID: "user1"}, &TestCommandValue{}); err == nil {
+		t.Error("the command should be denied by default")
+	}
+	authorizer.SetDefaultPolicy(RequireAuthenticated)
+	if err := authorizer.Authorize(ctx, Principal{ID: "user1"}, &TestCommandValue{}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+}
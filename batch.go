@@ -0,0 +1,153 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// BatchEventHandler is a handler of events in batches, for example for bulk
+// indexing in a search engine or for sending digests of notifications, where a
+// round trip per event is too slow.
+type BatchEventHandler interface {
+	// HandleEvents handles a batch of events, in the order they were handled.
+	HandleEvents([]Event)
+}
+
+// BatchEventHandlerFunc is a function that can be used as a batch handler.
+type BatchEventHandlerFunc func([]Event)
+
+// HandleEvents implements the HandleEvents method of the BatchEventHandler
+// interface.
+func (f BatchEventHandlerFunc) HandleEvents(events []Event) {
+	f(events)
+}
+
+// BatchingEventHandler is an event handler that buffers events and delivers
+// them to a BatchEventHandler in batches. A batch is delivered when it has
+// reached the size, by the HandleEvent call that filled it, or when its first
+// event has waited for the window, by Run. Batches are delivered one at a time
+// and in order, events handled meanwhile wait for the delivery.
+//
+// An example would be:
+//     batcher := eventhorizon.NewBatchingEventHandler(indexer, 500, time.Second, eventhorizon.SystemClock{})
+//     go batcher.Run(ctx)
+//     bus.AddHandler(batcher, InviteCreatedEvent)
+type BatchingEventHandler struct {
+	handler BatchEventHandler
+	size    int
+	window  time.Duration
+	clock   Clock
+	events  []Event
+	first   time.Time
+	mu      sync.Mutex
+}
+
+// NewBatchingEventHandler creates a BatchingEventHandler delivering batches of
+// at most size events, or the events of a window. A size of 0 only delivers
+// batches by window, and a window of 0 only by size. The clock is used for the
+// windows.
+func NewBatchingEventHandler(handler BatchEventHandler, size int, window time.Duration, clock Clock) *BatchingEventHandler {
+	return &BatchingEventHandler{
+		handler: handler,
+		size:    size,
+		window:  window,
+		clock:   clock,
+	}
+}
+
+// HandleEvent implements the HandleEvent method of the EventHandler interface.
+func (h *BatchingEventHandler) HandleEvent(event Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.events) == 0 {
+		h.first = h.clock.Now()
+	}
+	h.events = append(h.events, event)
+	if h.size > 0 && len(h.events) >= h.size {
+		h.flush()
+	}
+}
+
+// Len returns the number of buffered events.
+func (h *BatchingEventHandler) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.events)
+}
+
+// Flush delivers the buffered events now, for example before shutting down.
+func (h *BatchingEventHandler) Flush() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.flush()
+}
+
+// FlushDue delivers the buffered events if the first of them has waited for
+// the window.
+func (h *BatchingEventHandler) FlushDue() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.flushDue()
+}
+
+// Run delivers the batches whose window has passed, until the context is done,
+// and then delivers the buffered events. Without a window it only delivers the
+// buffered events when the context is done.
+func (h *BatchingEventHandler) Run(ctx context.Context) error {
+	if h.window <= 0 {
+		<-ctx.Done()
+		h.Flush()
+		return nil
+	}
+
+	for {
+		h.mu.Lock()
+		wait := h.flushDue()
+		h.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			h.Flush()
+			return nil
+		case <-h.clock.After(wait):
+		}
+	}
+}
+
+// flushDue delivers the buffered events if they are due, and returns the time
+// until the next batch can be due. The caller must hold the lock.
+func (h *BatchingEventHandler) flushDue() time.Duration {
+	if len(h.events) == 0 || h.window <= 0 {
+		return h.window
+	}
+	if age := h.clock.Now().Sub(h.first); age < h.window {
+		return h.window - age
+	}
+	h.flush()
+	return h.window
+}
+
+// flush delivers the buffered events, the caller must hold the lock.
+func (h *BatchingEventHandler) flush() {
+	if len(h.events) == 0 {
+		return
+	}
+	events := h.events
+	h.events = nil
+	h.handler.HandleEvents(events)
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBatchingEventHandler(t *testing.T) {
+	var batches [][]Event
+	handler := BatchEventHandlerFunc(func(events []Event) {
+		batches = append(batches, events)
+	})
+	clock := &tickClock{now: time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC), ticks: make(chan time.Time)}
+	batcher := NewBatchingEventHandler(handler, 2, time.Second, clock)
+	id := NewUUID()
+	event1 := &TestEvent{id, "event1"}
+	event2 := &TestEvent{id, "event2"}
+	event3 := &TestEvent{id, "event3"}
+
+	t.Log("deliver a full batch")
+	batcher.HandleEvent(event1)
+	if len(batches) != 0 || batcher.Len() != 1 {
+		t.Error("the event should be buffered:", batches)
+	}
+	batcher.HandleEvent(event2)
+	if !reflect.DeepEqual(batches, [][]Event{{event1, event2}}) {
+		t.Error("the batch should be delivered:", batches)
+	}
+
+	t.Log("deliver a batch after the window")
+	batcher.HandleEvent(event3)
+	clock.now = clock.now.Add(500 * time.Millisecond)
+	batcher.FlushDue()
+	if len(batches) != 1 {
+		t.Error("the batch should not be due yet:", batches)
+	}
+	clock.now = clock.now.Add(500 * time.Millisecond)
+	batcher.FlushDue()
+	if !reflect.DeepEqual(batches, [][]Event{{event1, event2}, {event3}}) {
+		t.Error("the batch should be delivered:", batches)
+	}
+
+	t.Log("flush when done")
+	batcher.HandleEvent(event1)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		if err := batcher.Run(ctx); err != nil {
+			t.Error("there should be no error:", err)
+		}
+		close(done)
+	}()
+	clock.ticks <- clock.now
+	cancel()
+	<-done
+	if !reflect.DeepEqual(batches, [][]Event{{event1, event2}, {event3}, {event1}}) {
+		t.Error("the batch should be delivered:", batches)
+	}
+	if batcher.Len() != 0 {
+		t.Error("there should be no buffered events:", batcher.Len())
+	}
+}
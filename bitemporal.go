@@ -0,0 +1,119 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"time"
+)
+
+// BitemporalRecord is a version of a read model that is valid from a time, as
+// recorded at a time.
+type BitemporalRecord struct {
+	Model      interface{}
+	ValidFrom  time.Time
+	RecordedAt time.Time
+}
+
+// BitemporalModel is a read model with all its versions, in both valid time
+// (when the model is effective) and transaction time (when it was recorded).
+// Corrections of the past are recorded as new versions, so that the model can
+// be found both as it is now known and as it was known at a time.
+type BitemporalModel struct {
+	ID      UUID
+	Records []BitemporalRecord
+}
+
+// AsOf returns the model that is valid at a time, as it was known at a time.
+// Returns nil if there is none.
+func (m *BitemporalModel) AsOf(validAt, knownAt time.Time) interface{} {
+	var found *BitemporalRecord
+	for i, r := range m.Records {
+		if r.ValidFrom.After(validAt) || r.RecordedAt.After(knownAt) {
+			continue
+		}
+		if found == nil || r.ValidFrom.After(found.ValidFrom) ||
+			(r.ValidFrom.Equal(found.ValidFrom) && !r.RecordedAt.Before(found.RecordedAt)) {
+			found = &m.Records[i]
+		}
+	}
+	if found == nil {
+		return nil
+	}
+	return found.Model
+}
+
+// BitemporalProjector is a helper for projectors that maintain bitemporal read
+// models, stored as BitemporalModel in a read repository.
+//
+// An example would be:
+//     p.Record(event.InvoiceID, event.EffectiveFrom, &Price{event.Amount})
+type BitemporalProjector struct {
+	repository ReadRepository
+	clock      Clock
+}
+
+// NewBitemporalProjector creates a BitemporalProjector. The clock is used for
+// the transaction time of records.
+func NewBitemporalProjector(repository ReadRepository, clock Clock) *BitemporalProjector {
+	return &BitemporalProjector{
+		repository: repository,
+		clock:      clock,
+	}
+}
+
+// Record records a version of a model that is valid from a time, at the
+// current time.
+func (p *BitemporalProjector) Record(id UUID, validFrom time.Time, model interface{}) error {
+	m, err := p.Load(id)
+	if err == ErrModelNotFound {
+		m = &BitemporalModel{ID: id}
+	} else if err != nil {
+		return err
+	}
+
+	m.Records = append(m.Records, BitemporalRecord{
+		Model:      model,
+		ValidFrom:  validFrom,
+		RecordedAt: p.clock.Now(),
+	})
+	return p.repository.Save(id, m)
+}
+
+// Find returns the model that is valid at a time, as it was known at a time.
+// Returns ErrModelNotFound if there is none.
+func (p *BitemporalProjector) Find(id UUID, validAt, knownAt time.Time) (interface{}, error) {
+	m, err := p.Load(id)
+	if err != nil {
+		return nil, err
+	}
+	model := m.AsOf(validAt, knownAt)
+	if model == nil {
+		return nil, ErrModelNotFound
+	}
+	return model, nil
+}
+
+// Load loads the bitemporal model with all versions.
+func (p *BitemporalProjector) Load(id UUID) (*BitemporalModel, error) {
+	model, err := p.repository.Find(id)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := model.(*BitemporalModel)
+	if !ok {
+		return nil, ErrModelNotFound
+	}
+	return m, nil
+}
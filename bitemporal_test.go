@@ -0,0 +1,101 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBitemporalProjector(t *testing.T) {
+	repo := &mapReadRepository{models: map[UUID]interface{}{}}
+	clock := &tickClock{}
+	p := NewBitemporalProjector(repo, clock)
+	id := NewUUID()
+	jan := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	feb := time.Date(2016, 2, 1, 0, 0, 0, 0, time.UTC)
+	mar := time.Date(2016, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Log("no model")
+	if _, err := p.Find(id, jan, jan); err != ErrModelNotFound {
+		t.Error("there should be a ErrModelNotFound error:", err)
+	}
+
+	t.Log("record, correct and change")
+	clock.now = jan
+	if err := p.Record(id, jan, "price 10"); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	clock.now = feb
+	if err := p.Record(id, jan, "price 12"); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := p.Record(id, mar, "price 15"); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	for _, c := range []struct {
+		validAt, knownAt time.Time
+		expected         string
+	}{
+		{jan, jan, "price 10"},
+		{jan, feb, "price 12"},
+		{feb, jan.Add(time.Hour), "price 10"},
+		{mar, jan, "price 10"},
+		{mar, mar, "price 15"},
+	} {
+		model, err := p.Find(id, c.validAt, c.knownAt)
+		if err != nil {
+			t.Error("there should be no error:", err)
+		}
+		if model != c.expected {
+			t.Error("the model should be correct:", c.validAt, c.knownAt, model)
+		}
+	}
+
+	t.Log("not valid yet")
+	if _, err := p.Find(id, jan.Add(-time.Hour), mar); err != ErrModelNotFound {
+		t.Error("there should be a ErrModelNotFound error:", err)
+	}
+}
+
+type mapReadRepository struct {
+	models map[UUID]interface{}
+}
+
+func (r *mapReadRepository) Save(id UUID, model interface{}) error {
+	r.models[id] = model
+	return nil
+}
+
+func (r *mapReadRepository) Find(id UUID) (interface{}, error) {
+	if model, ok := r.models[id]; ok {
+		return model, nil
+	}
+	return nil, ErrModelNotFound
+}
+
+func (r *mapReadRepository) FindAll() ([]interface{}, error) {
+	models := []interface{}{}
+	for _, model := range r.models {
+		models = append(models, model)
+	}
+	return models, nil
+}
+
+func (r *mapReadRepository) Remove(id UUID) error {
+	delete(r.models, id)
+	return nil
+}
@@ -0,0 +1,162 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// CausationGraph is the causal graph of the commands and events of a
+// correlation ID, for debugging flows of sagas. It is built from the headers
+// saved with the events:
+//
+//   - HeaderEventID is the ID of an event, or else its aggregate ID and version
+//   - HeaderCommandID is the ID of the command that caused an event
+//   - HeaderCausationID is the ID of the event or command that caused the
+//     command, or the event if there is no command ID
+type CausationGraph struct {
+	CorrelationID string
+	Nodes         []CausationNode
+	Edges         []CausationEdge
+}
+
+// CausationNode is an event, a command or another cause in a CausationGraph.
+type CausationNode struct {
+	ID    string
+	Kind  string // "event", "command" or "cause".
+	Label string
+}
+
+// CausationEdge is an edge from a cause to its effect in a CausationGraph.
+type CausationEdge struct {
+	From, To string
+}
+
+// NewCausationGraph walks all events in an event store and builds the graph of
+// the events with a correlation ID.
+func NewCausationGraph(ctx context.Context, store GlobalEventStore, correlationID string) (*CausationGraph, error) {
+	g := &CausationGraph{CorrelationID: correlationID}
+	nodes := map[string]int{}
+	addNode := func(id, kind, label string) {
+		if i, ok := nodes[id]; ok {
+			// An event is more specific than a command or cause.
+			if kind == "event" {
+				g.Nodes[i] = CausationNode{id, kind, label}
+			}
+			return
+		}
+		nodes[id] = len(g.Nodes)
+		g.Nodes = append(g.Nodes, CausationNode{id, kind, label})
+	}
+
+	var from Position
+	for {
+		envelopes, next, err := store.LoadAll(ctx, from, 1000)
+		if err != nil {
+			return nil, err
+		}
+		if len(envelopes) == 0 {
+			break
+		}
+		from = next
+
+		for _, envelope := range envelopes {
+			headers := envelope.Headers
+			if headers[HeaderCorrelationID] != correlationID {
+				continue
+			}
+
+			id := headers[HeaderEventID]
+			if id == "" {
+				id = envelope.Event.AggregateID().String() + "@" + strconv.Itoa(envelope.Version)
+			}
+			addNode(id, "event", envelope.Event.EventType())
+
+			effect := id
+			if commandID := headers[HeaderCommandID]; commandID != "" {
+				addNode(commandID, "command", commandID)
+				g.Edges = append(g.Edges, CausationEdge{commandID, id})
+				effect = commandID
+			}
+			if causationID := headers[HeaderCausationID]; causationID != "" && causationID != effect {
+				addNode(causationID, "cause", causationID)
+				g.Edges = append(g.Edges, CausationEdge{causationID, effect})
+			}
+		}
+	}
+
+	// Remove duplicate edges from events of the same command.
+	edges := g.Edges[:0]
+	seen := map[CausationEdge]bool{}
+	for _, e := range g.Edges {
+		if !seen[e] {
+			seen[e] = true
+			edges = append(edges, e)
+		}
+	}
+	g.Edges = edges
+
+	return g, nil
+}
+
+// WriteDOT writes the graph in the Graphviz DOT format.
+func (g *CausationGraph) WriteDOT(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "digraph %q {\n", g.CorrelationID); err != nil {
+		return err
+	}
+	for _, n := range g.Nodes {
+		shape := "ellipse"
+		if n.Kind == "event" {
+			shape = "box"
+		}
+		if _, err := fmt.Fprintf(w, "\t%q [label=%q, shape=%s];\n", n.ID, n.Label, shape); err != nil {
+			return err
+		}
+	}
+	for _, e := range g.Edges {
+		if _, err := fmt.Fprintf(w, "\t%q -> %q;\n", e.From, e.To); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintln(w, "}")
+	return err
+}
+
+// WriteMermaid writes the graph as a Mermaid flowchart.
+func (g *CausationGraph) WriteMermaid(w io.Writer) error {
+	if _, err := fmt.Fprintln(w, "graph TD"); err != nil {
+		return err
+	}
+	ids := map[string]string{}
+	for i, n := range g.Nodes {
+		ids[n.ID] = "n" + strconv.Itoa(i)
+		format := "\t%s([%q])\n"
+		if n.Kind == "event" {
+			format = "\t%s[%q]\n"
+		}
+		if _, err := fmt.Fprintf(w, format, ids[n.ID], n.Label); err != nil {
+			return err
+		}
+	}
+	for _, e := range g.Edges {
+		if _, err := fmt.Fprintf(w, "\t%s --> %s\n", ids[e.From], ids[e.To]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestCausationGraph(t *testing.T) {
+	id1, _ := ParseUUID("a4da289d-466d-4a56-4521-1dbd455aa0cd")
+	id2, _ := ParseUUID("b4da289d-466d-4a56-4521-1dbd455aa0cd")
+	store := &globalEventStore{envelopes: []EventEnvelope{
+		{Event: &TestEvent{id1, "event1"}, Version: 1, Headers: Headers{
+			HeaderCorrelationID: "flow",
+			HeaderCommandID:     "cmd1",
+			HeaderCausationID:   "request",
+		}},
+		{Event: &TestEvent{id2, "other"}, Version: 1, Headers: Headers{
+			HeaderCorrelationID: "other",
+		}},
+		{Event: &TestEvent{id1, "event2"}, Version: 2, Headers: Headers{
+			HeaderCorrelationID: "flow",
+			HeaderCommandID:     "cmd1",
+			HeaderCausationID:   "request",
+			HeaderEventID:       "e2",
+		}},
+		{Event: &TestEvent{id2, "event3"}, Version: 2, Headers: Headers{
+			HeaderCorrelationID: "flow",
+			HeaderCommandID:     "cmd2",
+			HeaderCausationID:   "e2",
+		}},
+	}}
+
+	g, err := NewCausationGraph(context.Background(), store, "flow")
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	expectedNodes := []CausationNode{
+		{"a4da289d-466d-4a56-4521-1dbd455aa0cd@1", "event", "TestEvent"},
+		{"cmd1", "command", "cmd1"},
+		{"request", "cause", "request"},
+		{"e2", "event", "TestEvent"},
+		{"b4da289d-466d-4a56-4521-1dbd455aa0cd@2", "event", "TestEvent"},
+		{"cmd2", "command", "cmd2"},
+	}
+	if !reflect.DeepEqual(g.Nodes, expectedNodes) {
+		t.Error("the nodes should be correct:", g.Nodes)
+	}
+	expectedEdges := []CausationEdge{
+		{"cmd1", "a4da289d-466d-4a56-4521-1dbd455aa0cd@1"},
+		{"request", "cmd1"},
+		{"cmd1", "e2"},
+		{"cmd2", "b4da289d-466d-4a56-4521-1dbd455aa0cd@2"},
+		{"e2", "cmd2"},
+	}
+	if !reflect.DeepEqual(g.Edges, expectedEdges) {
+		t.Error("the edges should be correct:", g.Edges)
+	}
+
+	t.Log("write DOT")
+	g = &CausationGraph{
+		CorrelationID: "flow",
+		Nodes:         []CausationNode{{"cmd", "command", "cmd"}, {"e", "event", "Created"}},
+		Edges:         []CausationEdge{{"cmd", "e"}},
+	}
+	var b bytes.Buffer
+	if err := g.WriteDOT(&b); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	expected := "digraph \"flow\" {\n" +
+		"\t\"cmd\" [label=\"cmd\", shape=ellipse];\n" +
+		"\t\"e\" [label=\"Created\", shape=box];\n" +
+		"\t\"cmd\" -> \"e\";\n" +
+		"}\n"
+	if b.String() != expected {
+		t.Error("the DOT output should be correct:", b.String())
+	}
+
+	t.Log("write Mermaid")
+	b.Reset()
+	if err := g.WriteMermaid(&b); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	expected = "graph TD\n" +
+		"\tn0([\"cmd\"])\n" +
+		"\tn1[\"Created\"]\n" +
+		"\tn0 --> n1\n"
+	if b.String() != expected {
+		t.Error("the Mermaid output should be correct:", b.String())
+	}
+}
+
+// globalEventStore is a GlobalEventStore that loads one envelope at a time.
+type globalEventStore struct {
+	MockEventStore
+	envelopes []EventEnvelope
+}
+
+func (s *globalEventStore) LoadAll(ctx context.Context, from Position, limit int) ([]EventEnvelope, Position, error) {
+	i := 0
+	if from != "" {
+		i, _ = strconv.Atoi(string(from))
+	}
+	if i >= len(s.envelopes) {
+		return nil, from, nil
+	}
+	return s.envelopes[i : i+1], Position(strconv.Itoa(i + 1)), nil
+}
@@ -0,0 +1,129 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"sync"
+)
+
+// ChangeNotifier lets API handlers wait for read models to change, for
+// long-polling APIs where clients wait for the next change of a model instead
+// of repeatedly fetching it. Projectors notify it of the version of a model
+// when they save it, typically the version of the event they handled, with
+// Notify or SaveVersion. Notifications are only seen in the same process.
+//
+// An example of a long-polling handler would be:
+//     ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+//     defer cancel()
+//     model, version, err := notifier.WaitForChange(ctx, id, since)
+//     if err == context.DeadlineExceeded {
+//         w.WriteHeader(http.StatusNotModified)
+//         return
+//     }
+type ChangeNotifier struct {
+	repo     ReadRepository
+	versions map[UUID]int
+	changed  map[UUID]chan struct{}
+	mu       sync.Mutex
+}
+
+// NewChangeNotifier creates a new ChangeNotifier for the read models of a
+// repository.
+func NewChangeNotifier(repo ReadRepository) *ChangeNotifier {
+	return &ChangeNotifier{
+		repo:     repo,
+		versions: make(map[UUID]int),
+		changed:  make(map[UUID]chan struct{}),
+	}
+}
+
+// SaveVersion saves a read model in the repository, as a revision if it is a
+// VersionedReadRepository, and notifies the waiters of the version.
+func (n *ChangeNotifier) SaveVersion(id UUID, model interface{}, version int) error {
+	var err error
+	if repo, ok := n.repo.(VersionedReadRepository); ok {
+		err = repo.SaveVersion(id, model, version)
+	} else {
+		err = n.repo.Save(id, model)
+	}
+	if err != nil {
+		return err
+	}
+	n.Notify(id, version)
+	return nil
+}
+
+// Notify notifies the waiters of a read model that it has changed to a version.
+// Versions that are not newer than the last one are ignored.
+func (n *ChangeNotifier) Notify(id UUID, version int) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if version <= n.versions[id] {
+		return
+	}
+	n.versions[id] = version
+	if changed, ok := n.changed[id]; ok {
+		close(changed)
+		delete(n.changed, id)
+	}
+}
+
+// Version returns the last notified version of a read model, or 0 if it has not
+// changed since the notifier was created.
+func (n *ChangeNotifier) Version(id UUID) int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.versions[id]
+}
+
+// Forget forgets the version of a read model, for example when it is removed,
+// so that the notifier does not grow with models that no longer change.
+func (n *ChangeNotifier) Forget(id UUID) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	delete(n.versions, id)
+}
+
+// WaitForChange blocks until a read model has a newer version than a version,
+// and returns the model with its version. It returns at once if the model
+// already has a newer version. It returns the error of the context if it is
+// done first, so a timeout should be set on it.
+func (n *ChangeNotifier) WaitForChange(ctx context.Context, id UUID, sinceVersion int) (interface{}, int, error) {
+	for {
+		n.mu.Lock()
+		version := n.versions[id]
+		if version > sinceVersion {
+			n.mu.Unlock()
+			model, err := n.repo.Find(id)
+			if err != nil {
+				return nil, version, err
+			}
+			return model, version, nil
+		}
+		changed, ok := n.changed[id]
+		if !ok {
+			changed = make(chan struct{})
+			n.changed[id] = changed
+		}
+		n.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, sinceVersion, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"testing"
+)
+
+func TestChangeNotifier(t *testing.T) {
+	repo := &mockVersionedReadRepository{}
+	notifier := NewChangeNotifier(repo)
+	id := NewUUID()
+
+	t.Log("save a model")
+	if err := notifier.SaveVersion(id, "model1", 1); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if v := notifier.Version(id); v != 1 {
+		t.Error("the version should be correct:", v)
+	}
+
+	t.Log("return at once for an older version")
+	model, version, err := notifier.WaitForChange(context.Background(), id, 0)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if model != "model1" || version != 1 {
+		t.Error("the model should be correct:", model, version)
+	}
+
+	t.Log("wait for the next change")
+	done := make(chan struct{})
+	go func() {
+		model, version, err = notifier.WaitForChange(context.Background(), id, 1)
+		close(done)
+	}()
+	notifier.Notify(id, 1)
+	select {
+	case <-done:
+		t.Error("there should be no change for the same version")
+	default:
+	}
+	if err := notifier.SaveVersion(id, "model2", 2); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	<-done
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if model != "model2" || version != 2 {
+		t.Error("the model should be correct:", model, version)
+	}
+
+	t.Log("time out")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, version, err := notifier.WaitForChange(ctx, id, 2); err != context.Canceled || version != 2 {
+		t.Error("there should be a context error:", err, version)
+	}
+
+	t.Log("forget a model")
+	notifier.Forget(id)
+	if v := notifier.Version(id); v != 0 {
+		t.Error("the version should be reset:", v)
+	}
+}
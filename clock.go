@@ -0,0 +1,43 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"time"
+)
+
+// Clock is a source of time, used when stamping events and scheduling work so
+// that tests can freeze and advance time instead of sleeping.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// After returns a channel that receives the current time once the duration
+	// has passed.
+	After(time.Duration) <-chan time.Time
+}
+
+// SystemClock is a Clock using the system time.
+type SystemClock struct{}
+
+// Now implements the Now method of the Clock interface.
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// After implements the After method of the Clock interface.
+func (SystemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
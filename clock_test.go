@@ -0,0 +1,36 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSystemClock(t *testing.T) {
+	var clock Clock = SystemClock{}
+
+	before := time.Now()
+	now := clock.Now()
+	if now.Before(before) || now.After(time.Now()) {
+		t.Error("the time should be the system time:", now)
+	}
+
+	select {
+	case <-clock.After(time.Millisecond):
+	case <-time.After(time.Second):
+		t.Error("the clock should fire")
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/looplab/eventhorizon"
+)
+
+// ErrMissingApp is when requeueing without the app ID of the event bus.
+var ErrMissingApp = errors.New("missing app ID of the event bus")
+
+// ErrMissingDeadLetterID is when a command needs a dead letter ID, or all.
+var ErrMissingDeadLetterID = errors.New("missing dead letter ID")
+
+// runDeadLetters runs a dead letter command with its arguments, writing to w.
+// The event bus to requeue on is only opened when needed.
+func runDeadLetters(ctx context.Context, store eventhorizon.DeadLetterStore, openBus func() (eventhorizon.EventBus, error), args []string, w io.Writer) error {
+	if len(args) == 0 {
+		return ErrUnknownCommand
+	}
+	if args[0] == "list" {
+		return listDeadLetters(ctx, store, w)
+	}
+	if len(args) < 2 {
+		return ErrMissingDeadLetterID
+	}
+
+	switch args[0] {
+	case "show":
+		return showDeadLetter(ctx, store, eventhorizon.UUID(args[1]), w)
+	case "requeue":
+		bus, err := openBus()
+		if err != nil {
+			return err
+		}
+		defer closeStore(bus)
+
+		return forDeadLetters(ctx, store, args[1], func(id eventhorizon.UUID) error {
+			if err := eventhorizon.RequeueDeadLetter(ctx, store, bus, id); err != nil {
+				return err
+			}
+			_, err := fmt.Fprintln(w, "requeued", id)
+			return err
+		})
+	case "purge":
+		return forDeadLetters(ctx, store, args[1], func(id eventhorizon.UUID) error {
+			if err := store.RemoveDeadLetter(ctx, id); err != nil {
+				return err
+			}
+			_, err := fmt.Fprintln(w, "purged", id)
+			return err
+		})
+	}
+	return ErrUnknownCommand
+}
+
+// forDeadLetters calls f for a dead letter, or for all of them if the ID is
+// "all".
+func forDeadLetters(ctx context.Context, store eventhorizon.DeadLetterStore, id string, f func(eventhorizon.UUID) error) error {
+	if id != "all" {
+		return f(eventhorizon.UUID(id))
+	}
+
+	deadLetters, err := store.DeadLetters(ctx)
+	if err != nil {
+		return err
+	}
+	for _, d := range deadLetters {
+		if err := f(d.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listDeadLetters writes a table of all dead letters.
+func listDeadLetters(ctx context.Context, store eventhorizon.DeadLetterStore, w io.Writer) error {
+	deadLetters, err := store.DeadLetters(ctx)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tTYPE\tREASON\tTIME")
+	for _, d := range deadLetters {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n",
+			d.ID, d.EventType, d.Reason, d.Timestamp.UTC().Format(time.RFC3339))
+	}
+	return tw.Flush()
+}
+
+// showDeadLetter writes a dead letter as indented JSON.
+func showDeadLetter(ctx context.Context, store eventhorizon.DeadLetterStore, id eventhorizon.UUID, w io.Writer) error {
+	d, err := store.DeadLetter(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	data := d.Data
+	if d.Event != nil {
+		data = d.Event
+	}
+	out, err := json.MarshalIndent(struct {
+		ID        eventhorizon.UUID    `json:"id"`
+		EventType string               `json:"event_type"`
+		Reason    string               `json:"reason"`
+		Errors    []string             `json:"errors,omitempty"`
+		Timestamp time.Time            `json:"timestamp"`
+		Headers   eventhorizon.Headers `json:"headers,omitempty"`
+		Data      interface{}          `json:"data"`
+	}{d.ID, d.EventType, d.Reason, d.Errors, d.Timestamp, d.Headers, data}, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", out)
+	return err
+}
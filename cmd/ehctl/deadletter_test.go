@@ -0,0 +1,108 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/storage/memory"
+	"github.com/looplab/eventhorizon/testutil"
+)
+
+func TestDeadLetters(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewDeadLetterStore()
+	timestamp := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	event := &testutil.TestEvent{eventhorizon.UUID("c1138e5f-f6fb-4dd0-8e79-255c6c8d3756"), "event1"}
+	store.SaveDeadLetter(ctx, &eventhorizon.DeadLetter{
+		ID:        "d1",
+		EventType: "TestEvent",
+		Event:     event,
+		Reason:    "shed",
+		Timestamp: timestamp,
+	})
+	store.SaveDeadLetter(ctx, &eventhorizon.DeadLetter{
+		ID:        "d2",
+		EventType: "TestEventOther",
+		Data:      map[string]interface{}{"content": "event2"},
+		Reason:    "shed",
+		Timestamp: timestamp,
+	})
+	bus := &testutil.MockEventBus{}
+	openBus := func() (eventhorizon.EventBus, error) { return bus, nil }
+
+	t.Log("list dead letters")
+	var out bytes.Buffer
+	if err := runDeadLetters(ctx, store, openBus, []string{"list"}, &out); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	expected := `ID  TYPE            REASON  TIME
+d1  TestEvent       shed    2016-01-01T00:00:00Z
+d2  TestEventOther  shed    2016-01-01T00:00:00Z
+`
+	if out.String() != expected {
+		t.Error("the output should be correct:", out.String())
+	}
+
+	t.Log("show a dead letter")
+	out.Reset()
+	if err := runDeadLetters(ctx, store, openBus, []string{"show", "d2"}, &out); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	expected = `{
+  "id": "d2",
+  "event_type": "TestEventOther",
+  "reason": "shed",
+  "timestamp": "2016-01-01T00:00:00Z",
+  "data": {
+    "content": "event2"
+  }
+}
+`
+	if out.String() != expected {
+		t.Error("the output should be correct:", out.String())
+	}
+
+	t.Log("fail to requeue an undecoded dead letter")
+	if err := runDeadLetters(ctx, store, openBus, []string{"requeue", "all"}, &out); err != eventhorizon.ErrDeadLetterNotDecoded {
+		t.Error("there should be a ErrDeadLetterNotDecoded error:", err)
+	}
+	if !reflect.DeepEqual(bus.Events, []eventhorizon.Event{event}) {
+		t.Error("the decoded event should be requeued:", bus.Events)
+	}
+
+	t.Log("purge a dead letter")
+	out.Reset()
+	if err := runDeadLetters(ctx, store, openBus, []string{"purge", "d2"}, &out); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if out.String() != "purged d2\n" {
+		t.Error("the output should be correct:", out.String())
+	}
+	deadLetters, _ := store.DeadLetters(ctx)
+	if len(deadLetters) != 0 {
+		t.Error("there should be no dead letters:", deadLetters)
+	}
+
+	t.Log("fail without an ID")
+	if err := runDeadLetters(ctx, store, openBus, []string{"purge"}, &out); err != ErrMissingDeadLetterID {
+		t.Error("there should be a ErrMissingDeadLetterID error:", err)
+	}
+}
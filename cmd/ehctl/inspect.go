@@ -0,0 +1,254 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/looplab/eventhorizon"
+)
+
+// ErrUnknownCommand is when a command is not known.
+var ErrUnknownCommand = errors.New("unknown command")
+
+// ErrMissingAggregateID is when a command needs an aggregate ID.
+var ErrMissingAggregateID = errors.New("missing aggregate ID")
+
+// ErrMissingDatabase is when a command needs a database.
+var ErrMissingDatabase = errors.New("missing database")
+
+// ErrStoresDiverge is when the compared stores diverge.
+var ErrStoresDiverge = errors.New("stores diverge")
+
+// run runs a command with its arguments on a store, writing to w.
+func run(ctx context.Context, store eventhorizon.InspectableEventStore, args []string, w io.Writer) error {
+	if len(args) == 0 {
+		return ErrUnknownCommand
+	}
+
+	switch args[0] {
+	case "aggregates":
+		return listAggregates(ctx, store, w)
+	case "stats":
+		return showStats(ctx, store, args[1:], w)
+	case "diff":
+		return showDiff(ctx, store, args[1:], w)
+	case "rebuild":
+		return rebuildProjection(ctx, store, args[1:], w)
+	case "dump", "version":
+		if len(args) < 2 {
+			return ErrMissingAggregateID
+		}
+		id := eventhorizon.UUID(args[1])
+		if args[0] == "dump" {
+			return dumpStream(ctx, store, id, w)
+		}
+		return showVersion(ctx, store, id, w)
+	}
+	return ErrUnknownCommand
+}
+
+// listAggregates writes a table of the streams of all aggregates.
+func listAggregates(ctx context.Context, store eventhorizon.InspectableEventStore, w io.Writer) error {
+	streams, err := store.Streams(ctx)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	writeStreams(tw, streams)
+	return tw.Flush()
+}
+
+// writeStreams writes a table of streams.
+func writeStreams(w io.Writer, streams []eventhorizon.StreamInfo) {
+	fmt.Fprintln(w, "ID\tTYPE\tVERSION\tEVENTS\tDELETED")
+	for _, s := range streams {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%t\n",
+			s.AggregateID, s.AggregateType, s.Version, s.Events, s.Deleted)
+	}
+}
+
+// showStats writes the statistics of the events in the store. The size of the
+// time buckets and the number of largest streams are set with flags.
+func showStats(ctx context.Context, store eventhorizon.InspectableEventStore, args []string, w io.Writer) error {
+	flags := flag.NewFlagSet("stats", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	bucket := flags.Duration("bucket", 24*time.Hour, "the size of the time buckets, or 0 for none")
+	top := flags.Int("top", 10, "the number of largest streams")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	stats, err := eventhorizon.CollectStats(ctx, store, *bucket, *top)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "EVENTS\t%d\n", stats.Events)
+	fmt.Fprintf(tw, "AGGREGATES\t%d\n", stats.Aggregates)
+	fmt.Fprintln(tw)
+	writeCounts(tw, "EVENT TYPE", stats.EventTypes)
+	fmt.Fprintln(tw)
+	writeCounts(tw, "AGGREGATE TYPE", stats.AggregateTypes)
+	if *bucket > 0 {
+		buckets := make([]time.Time, 0, len(stats.Buckets))
+		for b := range stats.Buckets {
+			buckets = append(buckets, b)
+		}
+		sort.Slice(buckets, func(i, j int) bool { return buckets[i].Before(buckets[j]) })
+		fmt.Fprintln(tw)
+		fmt.Fprintln(tw, "BUCKET\tEVENTS")
+		for _, b := range buckets {
+			fmt.Fprintf(tw, "%s\t%d\n", b.Format(time.RFC3339), stats.Buckets[b])
+		}
+	}
+	if *top > 0 {
+		fmt.Fprintln(tw)
+		writeStreams(tw, stats.LargestStreams)
+	}
+	return tw.Flush()
+}
+
+// writeCounts writes a table of counts, largest first.
+func writeCounts(w io.Writer, title string, counts map[string]int) {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	fmt.Fprintf(w, "%s\tEVENTS\n", title)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s\t%d\n", k, counts[k])
+	}
+}
+
+// dumpedEvent is a stored event as it is dumped.
+type dumpedEvent struct {
+	Version   int                  `json:"version"`
+	Type      string               `json:"type"`
+	Aggregate string               `json:"aggregate_type"`
+	Timestamp time.Time            `json:"timestamp"`
+	Headers   eventhorizon.Headers `json:"headers,omitempty"`
+	Data      interface{}          `json:"data"`
+}
+
+// dumpStream writes the events of an aggregate as indented JSON.
+func dumpStream(ctx context.Context, store eventhorizon.InspectableEventStore, id eventhorizon.UUID, w io.Writer) error {
+	events, err := store.LoadStored(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range events {
+		data, err := json.MarshalIndent(dumpedEvent{
+			Version:   e.Version,
+			Type:      e.Type,
+			Aggregate: e.AggregateType,
+			Timestamp: e.Timestamp,
+			Headers:   e.Headers,
+			Data:      e.Data,
+		}, "", "  ")
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "%s\n", data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// showVersion writes the latest version of an aggregate.
+func showVersion(ctx context.Context, store eventhorizon.InspectableEventStore, id eventhorizon.UUID, w io.Writer) error {
+	events, err := store.LoadStored(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	version := 0
+	if len(events) > 0 {
+		version = events[len(events)-1].Version
+	}
+	_, err = fmt.Fprintln(w, version)
+	return err
+}
+
+// showDiff compares the store with a target store, set with flags, and writes
+// the divergences. Returns ErrStoresDiverge if there are any.
+func showDiff(ctx context.Context, store eventhorizon.InspectableEventStore, args []string, w io.Writer) error {
+	flags := flag.NewFlagSet("diff", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	url := flags.String("url", "localhost:27017", "the URL of the target MongoDB server")
+	db := flags.String("db", "", "the database of the target event store")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *db == "" {
+		return ErrMissingDatabase
+	}
+
+	target, err := openStore(*url, *db)
+	if err != nil {
+		return err
+	}
+	defer closeStore(target)
+
+	divergences, err := eventhorizon.CompareStores(ctx, store, target)
+	if err != nil {
+		return err
+	}
+	if len(divergences) == 0 {
+		_, err := fmt.Fprintln(w, "no divergences")
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tINDEX\tSOURCE\tTARGET")
+	for _, d := range divergences {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n",
+			d.AggregateID, d.Index, shortHash(d.SourceHash), shortHash(d.TargetHash))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	return ErrStoresDiverge
+}
+
+// shortHash returns the start of a hash, or "missing" for an empty hash.
+func shortHash(hash string) string {
+	if hash == "" {
+		return "missing"
+	}
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return hash
+}
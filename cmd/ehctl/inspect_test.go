@@ -0,0 +1,184 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/storage/memory"
+	"github.com/looplab/eventhorizon/testutil"
+)
+
+func TestInspect(t *testing.T) {
+	store := memory.NewEventStore(nil, memory.WithClock(testutil.NewMockClock(time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC))))
+	id := eventhorizon.UUID("c1138e5f-f6fb-4dd0-8e79-255c6c8d3756")
+	ctx := eventhorizon.NewContextWithHeaders(context.Background(),
+		eventhorizon.Headers{eventhorizon.HeaderUserID: "user"})
+	if err := store.SaveWithContext(ctx, []eventhorizon.Event{
+		&testutil.TestEvent{id, "event1"},
+		&testutil.TestEvent{id, "event2"},
+	}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	t.Log("list aggregates")
+	var out bytes.Buffer
+	if err := run(context.Background(), store, []string{"aggregates"}, &out); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	expected := "ID                                    TYPE  VERSION  EVENTS  DELETED\n" +
+		"c1138e5f-f6fb-4dd0-8e79-255c6c8d3756  Test  1        2       false\n"
+	if out.String() != expected {
+		t.Error("the aggregates should be correct:\n", out.String())
+	}
+
+	t.Log("dump a stream")
+	out.Reset()
+	if err := run(context.Background(), store, []string{"dump", string(id)}, &out); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	expected = `{
+  "version": 0,
+  "type": "TestEvent",
+  "aggregate_type": "Test",
+  "timestamp": "2016-01-01T00:00:00Z",
+  "headers": {
+    "user_id": "user"
+  },
+  "data": {
+    "TestID": "c1138e5f-f6fb-4dd0-8e79-255c6c8d3756",
+    "Content": "event1"
+  }
+}
+`
+	if out.String()[:len(expected)] != expected {
+		t.Error("the stream should be correct:\n", out.String())
+	}
+
+	t.Log("show the version")
+	out.Reset()
+	if err := run(context.Background(), store, []string{"version", string(id)}, &out); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if out.String() != "1\n" {
+		t.Error("the version should be correct:", out.String())
+	}
+
+	t.Log("invalid commands")
+	if err := run(context.Background(), store, []string{"dump"}, &out); err != ErrMissingAggregateID {
+		t.Error("there should be a ErrMissingAggregateID error:", err)
+	}
+	if err := run(context.Background(), store, []string{"unknown"}, &out); err != ErrUnknownCommand {
+		t.Error("there should be a ErrUnknownCommand error:", err)
+	}
+	if err := run(context.Background(), store, []string{"version", "missing"}, &out); err != eventhorizon.ErrNoEventsFound {
+		t.Error("there should be a ErrNoEventsFound error:", err)
+	}
+}
+
+func TestStats(t *testing.T) {
+	clock := testutil.NewMockClock(time.Date(2016, 1, 1, 12, 0, 0, 0, time.UTC))
+	store := memory.NewEventStore(nil, memory.WithClock(clock))
+	id1 := eventhorizon.UUID("c1138e5f-f6fb-4dd0-8e79-255c6c8d3756")
+	id2 := eventhorizon.UUID("c1138e5f-f6fb-4dd0-8e79-255c6c8d3757")
+	if err := store.Save([]eventhorizon.Event{
+		&testutil.TestEvent{id1, "event1"},
+		&testutil.TestEvent{id2, "event2"},
+	}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	clock.Advance(24 * time.Hour)
+	if err := store.Save([]eventhorizon.Event{&testutil.TestEvent{id2, "event3"}}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	var out bytes.Buffer
+	if err := run(context.Background(), store, []string{"stats", "-top", "1"}, &out); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	expected := `EVENTS      3
+AGGREGATES  2
+
+EVENT TYPE  EVENTS
+TestEvent   3
+
+AGGREGATE TYPE  EVENTS
+Test            3
+
+BUCKET                EVENTS
+2016-01-01T00:00:00Z  2
+2016-01-02T00:00:00Z  1
+
+ID                                    TYPE  VERSION  EVENTS  DELETED
+c1138e5f-f6fb-4dd0-8e79-255c6c8d3757  Test  1        2       false
+`
+	if out.String() != expected {
+		t.Error("the stats should be correct:\n", out.String())
+	}
+
+	t.Log("invalid flags")
+	if err := run(context.Background(), store, []string{"stats", "-bucket", "day"}, &out); err == nil {
+		t.Error("there should be an error")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	now := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	id := eventhorizon.UUID("c1138e5f-f6fb-4dd0-8e79-255c6c8d3756")
+	source := memory.NewEventStore(nil, memory.WithClock(testutil.NewMockClock(now)))
+	target := memory.NewEventStore(nil, memory.WithClock(testutil.NewMockClock(now)))
+	openStore = func(url, db string) (eventhorizon.InspectableEventStore, error) {
+		return target, nil
+	}
+	event := &testutil.TestEvent{id, "event1"}
+	for _, store := range []*memory.EventStore{source, target} {
+		if err := store.Save([]eventhorizon.Event{event}); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}
+
+	t.Log("equal stores")
+	var out bytes.Buffer
+	if err := run(context.Background(), source, []string{"diff", "-db", "target"}, &out); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if out.String() != "no divergences\n" {
+		t.Error("there should be no divergences:", out.String())
+	}
+
+	t.Log("diverging stores")
+	if err := source.Save([]eventhorizon.Event{&testutil.TestEvent{id, "event2"}}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	out.Reset()
+	if err := run(context.Background(), source, []string{"diff", "-db", "target"}, &out); err != ErrStoresDiverge {
+		t.Error("there should be a ErrStoresDiverge error:", err)
+	}
+	if !strings.HasPrefix(out.String(), "ID") ||
+		!strings.Contains(out.String(), string(id)+"  1      ") ||
+		!strings.HasSuffix(out.String(), "missing\n") {
+		t.Error("the divergences should be correct:\n", out.String())
+	}
+
+	t.Log("missing target")
+	if err := run(context.Background(), source, []string{"diff"}, &out); err != ErrMissingDatabase {
+		t.Error("there should be a ErrMissingDatabase error:", err)
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command ehctl inspects the event streams of a MongoDB event store, for
+// debugging in production. The events are shown as stored, without the event
+// types having to be registered.
+//
+// Usage:
+//
+//     ehctl [-url URL] [-db DB] aggregates
+//     ehctl [-url URL] [-db DB] dump <aggregate ID>
+//     ehctl [-url URL] [-db DB] version <aggregate ID>
+//     ehctl [-url URL] [-db DB] stats [-bucket 24h] [-top 10]
+//     ehctl [-url URL] [-db DB] diff [-url URL] -db DB
+//     ehctl [-url URL] [-db DB] rebuild -projection NAME [-rate 1000] [-checkpoint FILE]
+//     ehctl [-redis ADDR] -app APP tail [-type InviteAccepted,...] [-header key=value]
+//     ehctl [-redis ADDR] -app APP repl
+//     ehctl [-url URL] -db DB dlq list | show <id> | purge <id>|all
+//     ehctl [-url URL] -db DB [-redis ADDR] -app APP dlq requeue <id>|all
+//
+// The aggregates command lists the streams of all aggregates, dump prints the
+// events of an aggregate with their metadata and payloads, and version prints
+// the latest version of an aggregate. The stats command prints the number of
+// events by type, aggregate type and time bucket, and the largest streams, to
+// spot aggregates with unbounded streams. The diff command compares the store
+// with a target store, for example after a migration, event by event with
+// hashes, and prints the streams that diverge.
+//
+// The rebuild command clears a projection and handles all events again, with
+// a progress bar and optionally at a limited rate of events per second. When
+// interrupted, the position is saved in a checkpoint file, and the rebuild is
+// resumed from it when run again. Projections are rebuilt by name from the
+// ones registered with eventhorizon.RegisterProjection, so rebuild is run from
+// an ehctl built with the projections of an app, by adding a file to this
+// command that imports the package that registers them.
+//
+// The tail command prints the
+// events published on the Redis event bus of an app as they arrive, optionally
+// of some event types or with a header, such as a correlation ID.
+//
+// The repl command reads commands from the input, as a registered command type
+// followed by its fields as JSON, and dispatches them on the Redis command bus
+// of the app, printing the events published as a result. Like for rebuild, it
+// is run from an ehctl built with a file that registers the command types of
+// the app, which can also replace openCommandBus to handle the commands in
+// process, for demos.
+//
+// The dlq command manages the events that handlers failed on, as saved by an
+// eventhorizon.DeadLetterHandler in the dead letter store. After fixing the
+// bug that failed them, the events can be requeued on the event bus of the
+// app, or purged. Only events of registered types can be requeued, so requeue
+// is run from an ehctl built with a file that appends the RegisterEventTypes
+// function of the app, as generated by ehgen, to eventTypes.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+
+	goredis "github.com/redis/go-redis/v9"
+
+	"github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/messaging/redis"
+	"github.com/looplab/eventhorizon/storage/mongodb"
+)
+
+// openStore opens the event store in a database.
+var openStore = func(url, db string) (eventhorizon.InspectableEventStore, error) {
+	store, err := mongodb.NewEventStore(nil, url, db)
+	if err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// openCommandBus opens the command bus of an app.
+var openCommandBus = func(app, addr string) (eventhorizon.CommandBus, error) {
+	client := goredis.NewClient(&goredis.Options{Addr: addr})
+	return redis.NewCommandBus(app, client), nil
+}
+
+// openDeadLetterStore opens the dead letter store in a database.
+var openDeadLetterStore = func(url, db string) (eventhorizon.DeadLetterStore, error) {
+	store, err := mongodb.NewDeadLetterStore(url, db)
+	if err != nil {
+		return nil, err
+	}
+	for _, register := range eventTypes {
+		if err := register(store); err != nil {
+			store.Close()
+			return nil, err
+		}
+	}
+	return store, nil
+}
+
+// eventTypes registers the event types of an app, for decoding them.
+var eventTypes []func(eventhorizon.EventTypeRegisterer) error
+
+func main() {
+	url := flag.String("url", "localhost:27017", "the URL of the MongoDB server")
+	db := flag.String("db", "", "the database of the event store")
+	redisAddr := flag.String("redis", "localhost:6379", "the address of the Redis server of the event bus")
+	app := flag.String("app", "", "the app ID of the event bus")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: ehctl [flags] aggregates | dump <id> | version <id> | stats | diff | rebuild | tail | repl | dlq")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	// Long running commands stop when interrupted.
+	ctx, cancel := context.WithCancel(context.Background())
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		cancel()
+	}()
+
+	if flag.Arg(0) == "tail" || flag.Arg(0) == "repl" {
+		if *app == "" {
+			flag.Usage()
+			os.Exit(2)
+		}
+		bus, err := redis.NewEventBus(*app, *redisAddr, "")
+		if err != nil {
+			log.Fatalf("could not connect to event bus: %s", err)
+		}
+		defer bus.Close()
+
+		if flag.Arg(0) == "tail" {
+			err = tailEvents(ctx, bus, flag.Args()[1:], os.Stdout)
+		} else {
+			var commandBus eventhorizon.CommandBus
+			if commandBus, err = openCommandBus(*app, *redisAddr); err != nil {
+				log.Fatalf("could not connect to command bus: %s", err)
+			}
+			err = repl(ctx, commandBus, bus, os.Stdin, os.Stdout)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "dlq" {
+		if *db == "" {
+			flag.Usage()
+			os.Exit(2)
+		}
+		store, err := openDeadLetterStore(*url, *db)
+		if err != nil {
+			log.Fatalf("could not connect to dead letter store: %s", err)
+		}
+		defer closeStore(store)
+
+		openBus := func() (eventhorizon.EventBus, error) {
+			if *app == "" {
+				return nil, ErrMissingApp
+			}
+			return redis.NewEventBus(*app, *redisAddr, "")
+		}
+		if err := runDeadLetters(ctx, store, openBus, flag.Args()[1:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if *db == "" || flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	store, err := openStore(*url, *db)
+	if err != nil {
+		log.Fatalf("could not connect to event store: %s", err)
+	}
+	defer closeStore(store)
+
+	if err := run(ctx, store, flag.Args(), os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// closeStore closes a store if it can be closed.
+func closeStore(store interface{}) {
+	if c, ok := store.(interface {
+		Close()
+	}); ok {
+		c.Close()
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/looplab/eventhorizon"
+)
+
+// ErrMissingProjection is when a command needs a projection.
+var ErrMissingProjection = errors.New("missing projection")
+
+// ErrNotGlobalEventStore is when a store can't load all events.
+var ErrNotGlobalEventStore = errors.New("event store can't load all events")
+
+// checkpoint is the progress of an interrupted rebuild.
+type checkpoint struct {
+	Position eventhorizon.Position `json:"position"`
+	Events   int                   `json:"events"`
+}
+
+// rebuildProjection rebuilds a registered projection, set with flags, writing
+// the progress. An interrupted rebuild is saved in a checkpoint file and is
+// resumed from it.
+func rebuildProjection(ctx context.Context, store eventhorizon.InspectableEventStore, args []string, w io.Writer) error {
+	flags := flag.NewFlagSet("rebuild", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	name := flags.String("projection", "", "the registered projection to rebuild")
+	rate := flags.Float64("rate", 0, "the maximum number of events per second, or 0 for no limit")
+	batch := flags.Int("batch", 100, "the number of events to load at a time")
+	file := flags.String("checkpoint", "", "the checkpoint file, <projection>.checkpoint by default")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *name == "" {
+		return ErrMissingProjection
+	}
+	if *file == "" {
+		*file = *name + ".checkpoint"
+	}
+
+	global, ok := store.(eventhorizon.GlobalEventStore)
+	if !ok {
+		return ErrNotGlobalEventStore
+	}
+	projection, err := eventhorizon.CreateProjection(*name)
+	if err != nil {
+		return err
+	}
+
+	var cp checkpoint
+	if data, err := ioutil.ReadFile(*file); err == nil {
+		if err := json.Unmarshal(data, &cp); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "resuming %s after %d events\n", *name, cp.Events)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	// The total is only known if the store can count the events itself.
+	total := 0
+	if s, ok := store.(eventhorizon.StatsEventStore); ok {
+		stats, err := s.EventStats(ctx, 0, 0)
+		if err != nil {
+			return err
+		}
+		total = stats.Events
+	}
+
+	rebuilder := eventhorizon.NewRebuilder(global, projection, eventhorizon.SystemClock{})
+	rebuilder.SetBatchSize(*batch)
+	rebuilder.SetRate(*rate)
+	handled := cp.Events
+	rebuilder.SetProgressFunc(func(p eventhorizon.RebuildProgress) {
+		writeProgress(w, *name, handled+p.Events, total)
+	})
+
+	progress, err := rebuilder.Rebuild(ctx, cp.Position)
+	if err != nil {
+		cp.Events += progress.Events
+		cp.Position = progress.Position
+		data, jsonErr := json.Marshal(cp)
+		if jsonErr != nil {
+			return jsonErr
+		}
+		if writeErr := ioutil.WriteFile(*file, data, 0644); writeErr != nil {
+			return writeErr
+		}
+		fmt.Fprintf(w, "\nrebuild of %s stopped, resume with the same command\n", *name)
+		return err
+	}
+
+	fmt.Fprintf(w, "\nrebuilt %s\n", *name)
+	if err := os.Remove(*file); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// writeProgress writes a progress bar, or the number of events if the total is
+// not known, over the previous one.
+func writeProgress(w io.Writer, name string, events, total int) {
+	if total <= 0 {
+		fmt.Fprintf(w, "\rrebuilding %s: %d events", name, events)
+		return
+	}
+	if events > total {
+		total = events
+	}
+	const width = 40
+	done := width * events / total
+	fmt.Fprintf(w, "\rrebuilding %s: [%s%s] %3d%% %d/%d events", name,
+		strings.Repeat("#", done), strings.Repeat(".", width-done), 100*events/total, events, total)
+}
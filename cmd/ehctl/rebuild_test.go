@@ -0,0 +1,126 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/storage/memory"
+	"github.com/looplab/eventhorizon/testutil"
+)
+
+func TestRebuild(t *testing.T) {
+	store := memory.NewEventStore(nil)
+	id := eventhorizon.NewUUID()
+	if err := store.Save([]eventhorizon.Event{
+		&testutil.TestEvent{id, "event1"},
+		&testutil.TestEvent{id, "event2"},
+		&testutil.TestEvent{id, "event3"},
+	}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	projection := &countProjection{}
+	if err := eventhorizon.RegisterProjection("count", func() eventhorizon.Projection {
+		return projection
+	}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer eventhorizon.UnregisterProjection("count")
+
+	dir, err := ioutil.TempDir("", "ehctl")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "count.checkpoint")
+	args := []string{"rebuild", "-projection", "count", "-batch", "1", "-checkpoint", file}
+
+	t.Log("interrupt a rebuild")
+	ctx, cancel := context.WithCancel(context.Background())
+	projection.cancel = cancel
+	var out bytes.Buffer
+	if err := run(ctx, store, args, &out); err != context.Canceled {
+		t.Error("there should be a context error:", err)
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if string(data) != `{"position":"2","events":2}` {
+		t.Error("the checkpoint should be saved:", string(data))
+	}
+
+	t.Log("resume the rebuild")
+	projection.cancel = nil
+	out.Reset()
+	if err := run(context.Background(), store, args, &out); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if projection.events != 3 || projection.cleared != 1 {
+		t.Error("the projection should be rebuilt once:", projection.events, projection.cleared)
+	}
+	if !strings.HasPrefix(out.String(), "resuming count after 2 events\n") ||
+		!strings.HasSuffix(out.String(), "\rrebuilding count: 3 events\nrebuilt count\n") {
+		t.Error("the progress should be correct:", out.String())
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Error("the checkpoint should be removed:", err)
+	}
+
+	t.Log("missing projection")
+	if err := run(context.Background(), store, []string{"rebuild"}, &out); err != ErrMissingProjection {
+		t.Error("there should be a ErrMissingProjection error:", err)
+	}
+	if err := run(context.Background(), store, []string{"rebuild", "-projection", "other"}, &out); err != eventhorizon.ErrProjectionNotRegistered {
+		t.Error("there should be a ErrProjectionNotRegistered error:", err)
+	}
+}
+
+func TestWriteProgress(t *testing.T) {
+	var out bytes.Buffer
+	writeProgress(&out, "count", 1, 4)
+	expected := "\rrebuilding count: [##########..............................]  25% 1/4 events"
+	if out.String() != expected {
+		t.Error("the progress bar should be correct:", out.String())
+	}
+}
+
+// countProjection counts the events, and cancels a rebuild after two events.
+type countProjection struct {
+	events  int
+	cleared int
+	cancel  func()
+}
+
+func (p *countProjection) HandleEvent(event eventhorizon.Event) {
+	p.events++
+	if p.events == 2 && p.cancel != nil {
+		p.cancel()
+	}
+}
+
+func (p *countProjection) Clear(ctx context.Context) error {
+	p.events = 0
+	p.cleared++
+	return nil
+}
@@ -0,0 +1,133 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/looplab/eventhorizon"
+)
+
+// ErrMissingCommandData is when a command is entered without its JSON data.
+var ErrMissingCommandData = errors.New("missing command data")
+
+// repl reads commands as lines of a registered command type followed by its
+// fields as JSON, and dispatches them on a command bus. The events published
+// on the event bus are written as they arrive, until the input ends or the
+// context is done. Errors of a command are written instead of stopping the
+// repl.
+func repl(ctx context.Context, bus eventhorizon.CommandBus, events tailer, in io.Reader, w io.Writer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	tailed, err := events.Tail(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Writes from the repl and the tailed events are serialized.
+	var mu sync.Mutex
+	printf := func(format string, a ...interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprintf(w, format, a...)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for e := range tailed {
+			data, err := json.Marshal(e.Data)
+			if err != nil {
+				printf("error: %s\n", err)
+				continue
+			}
+			printf("<- %s %s\n", e.Type, data)
+		}
+	}()
+
+	// Lines are read in the background, to stop when the context is done.
+	lines := make(chan string)
+	scanner := bufio.NewScanner(in)
+	go func() {
+		defer close(lines)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	printf("commands: %s\n", strings.Join(eventhorizon.CommandTypes(), ", "))
+	printf("> ")
+	var scanErr error
+loop:
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				scanErr = scanner.Err()
+				break loop
+			}
+			if line = strings.TrimSpace(line); line != "" {
+				command, err := parseCommand(line)
+				if err == nil {
+					err = bus.HandleCommand(command)
+				}
+				if err != nil {
+					printf("error: %s\n", err)
+				} else {
+					printf("-> %s\n", command.CommandType())
+				}
+			}
+			printf("> ")
+		case <-ctx.Done():
+			// The scanner is left blocked on reading the input.
+			break loop
+		}
+	}
+	printf("\n")
+
+	cancel()
+	<-done
+	return scanErr
+}
+
+// parseCommand creates a command of a registered type from a line of the type
+// and its fields as JSON, for example:
+//     CreateInvite {"ID": "...", "Name": "Alice"}
+func parseCommand(line string) (eventhorizon.Command, error) {
+	parts := strings.SplitN(line, " ", 2)
+	if len(parts) != 2 {
+		return nil, ErrMissingCommandData
+	}
+	command, err := eventhorizon.CreateCommand(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(parts[1]), command); err != nil {
+		return nil, err
+	}
+	return command, nil
+}
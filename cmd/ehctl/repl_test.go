@@ -0,0 +1,86 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/messaging/redis"
+	"github.com/looplab/eventhorizon/testutil"
+)
+
+func TestRepl(t *testing.T) {
+	if err := eventhorizon.RegisterCommandType(func() eventhorizon.Command {
+		return &testutil.TestCommand{}
+	}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer eventhorizon.UnregisterCommandType("TestCommand")
+
+	bus := &mockCommandBus{}
+	events := &mockTailer{events: []redis.TailedEvent{
+		{Type: "TestEvent", Data: bson.M{"content": "event1"}},
+	}}
+	in := strings.NewReader(`TestCommand {"TestID": "c1138e5f-f6fb-4dd0-8e79-255c6c8d3756", "Content": "command1"}
+
+TestCommand
+UnknownCommand {}
+TestCommand {"TestID":
+`)
+	var out bytes.Buffer
+	if err := repl(context.Background(), bus, events, in, &out); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("dispatch a command")
+	expected := []eventhorizon.Command{&testutil.TestCommand{
+		TestID:  eventhorizon.UUID("c1138e5f-f6fb-4dd0-8e79-255c6c8d3756"),
+		Content: "command1",
+	}}
+	if !reflect.DeepEqual(bus.commands, expected) {
+		t.Error("the command should be dispatched:", bus.commands)
+	}
+
+	t.Log("print the output")
+	for _, line := range []string{
+		"commands: TestCommand\n",
+		"-> TestCommand\n",
+		"<- TestEvent {\"content\":\"event1\"}\n",
+		"error: " + ErrMissingCommandData.Error() + "\n",
+		"error: " + eventhorizon.ErrCommandNotRegistered.Error() + "\n",
+		"error: unexpected end of JSON input\n",
+	} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("the output should contain %q: %s", line, out.String())
+		}
+	}
+}
+
+type mockCommandBus struct {
+	eventhorizon.CommandBus
+	commands []eventhorizon.Command
+}
+
+func (b *mockCommandBus) HandleCommand(command eventhorizon.Command) error {
+	b.commands = append(b.commands, command)
+	return nil
+}
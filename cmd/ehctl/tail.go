@@ -0,0 +1,85 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/messaging/redis"
+)
+
+// ErrInvalidFilter is when a filter is not of the form key=value.
+var ErrInvalidFilter = errors.New("invalid filter")
+
+// tailer is an event bus that can be tailed.
+type tailer interface {
+	Tail(ctx context.Context, eventTypes ...string) (<-chan redis.TailedEvent, error)
+}
+
+// tailEvents writes the events published on a bus as indented JSON until the
+// context is done. The event types, and a header that the events must have,
+// are set with flags.
+func tailEvents(ctx context.Context, bus tailer, args []string, w io.Writer) error {
+	flags := flag.NewFlagSet("tail", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	types := flags.String("type", "", "the event types to tail, separated by commas")
+	header := flags.String("header", "", "a header that the events must have, as key=value")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var eventTypes []string
+	if *types != "" {
+		eventTypes = strings.Split(*types, ",")
+	}
+	var key, value string
+	if *header != "" {
+		parts := strings.SplitN(*header, "=", 2)
+		if len(parts) != 2 {
+			return ErrInvalidFilter
+		}
+		key, value = parts[0], parts[1]
+	}
+
+	events, err := bus.Tail(ctx, eventTypes...)
+	if err != nil {
+		return err
+	}
+	for e := range events {
+		if key != "" && e.Headers[key] != value {
+			continue
+		}
+		data, err := json.MarshalIndent(struct {
+			Type    string               `json:"type"`
+			Headers eventhorizon.Headers `json:"headers,omitempty"`
+			Data    interface{}          `json:"data"`
+		}{e.Type, e.Headers, e.Data}, "", "  ")
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "%s\n", data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
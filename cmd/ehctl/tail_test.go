@@ -0,0 +1,84 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/messaging/redis"
+)
+
+func TestTail(t *testing.T) {
+	bus := &mockTailer{events: []redis.TailedEvent{
+		{
+			Type:    "InviteAccepted",
+			Data:    bson.M{"invitationid": "id1"},
+			Headers: eventhorizon.Headers{eventhorizon.HeaderCorrelationID: "correlation"},
+		},
+		{
+			Type: "InviteAccepted",
+			Data: bson.M{"invitationid": "id2"},
+		},
+	}}
+
+	t.Log("tail events with a header")
+	var out bytes.Buffer
+	args := []string{"-type", "InviteAccepted,InviteDeclined", "-header", "correlation_id=correlation"}
+	if err := tailEvents(context.Background(), bus, args, &out); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(bus.eventTypes, []string{"InviteAccepted", "InviteDeclined"}) {
+		t.Error("the event types should be correct:", bus.eventTypes)
+	}
+	expected := `{
+  "type": "InviteAccepted",
+  "headers": {
+    "correlation_id": "correlation"
+  },
+  "data": {
+    "invitationid": "id1"
+  }
+}
+`
+	if out.String() != expected {
+		t.Error("the events should be correct:\n", out.String())
+	}
+
+	t.Log("invalid filter")
+	if err := tailEvents(context.Background(), bus, []string{"-header", "correlation"}, &out); err != ErrInvalidFilter {
+		t.Error("there should be a ErrInvalidFilter error:", err)
+	}
+}
+
+type mockTailer struct {
+	events     []redis.TailedEvent
+	eventTypes []string
+}
+
+func (m *mockTailer) Tail(ctx context.Context, eventTypes ...string) (<-chan redis.TailedEvent, error) {
+	m.eventTypes = eventTypes
+	ch := make(chan redis.TailedEvent, len(m.events))
+	for _, e := range m.events {
+		ch <- e
+	}
+	close(ch)
+	return ch, nil
+}
@@ -0,0 +1,234 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"strings"
+	"text/template"
+)
+
+// ErrInvalidDirective is when a directive has an unknown or missing option.
+var ErrInvalidDirective = errors.New("invalid directive")
+
+// ErrNoIDField is when a type has no field for the aggregate ID.
+var ErrNoIDField = errors.New("no aggregate ID field")
+
+// ErrMixedPackages is when the sources are of different packages.
+var ErrMixedPackages = errors.New("mixed packages")
+
+// Definitions are the event and command types of a package.
+type Definitions struct {
+	Package string
+	Types   []Type
+}
+
+// Type is an event or command type, from a struct marked with a directive.
+type Type struct {
+	Name          string
+	Command       bool
+	TypeName      string
+	AggregateType string
+	IDField       string
+}
+
+// Events returns the event types.
+func (d Definitions) Events() []Type {
+	var types []Type
+	for _, t := range d.Types {
+		if !t.Command {
+			types = append(types, t)
+		}
+	}
+	return types
+}
+
+// Commands returns the command types.
+func (d Definitions) Commands() []Type {
+	var types []Type
+	for _, t := range d.Types {
+		if t.Command {
+			types = append(types, t)
+		}
+	}
+	return types
+}
+
+// Parse parses the types marked with directives in Go sources of a package,
+// in the order they are defined.
+func Parse(srcs ...[]byte) (Definitions, error) {
+	var defs Definitions
+	fset := token.NewFileSet()
+	for _, src := range srcs {
+		f, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+		if err != nil {
+			return defs, err
+		}
+		if defs.Package != "" && defs.Package != f.Name.Name {
+			return defs, ErrMixedPackages
+		}
+		defs.Package = f.Name.Name
+
+		for _, decl := range f.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				spec := spec.(*ast.TypeSpec)
+				doc := spec.Doc
+				if doc == nil && len(gen.Specs) == 1 {
+					doc = gen.Doc
+				}
+				st, ok := spec.Type.(*ast.StructType)
+				if !ok || doc == nil {
+					continue
+				}
+				t, ok, err := parseType(spec.Name.Name, st, doc)
+				if err != nil {
+					return defs, err
+				} else if ok {
+					defs.Types = append(defs.Types, t)
+				}
+			}
+		}
+	}
+	return defs, nil
+}
+
+// parseType parses the directive of a struct, if it has one.
+func parseType(name string, st *ast.StructType, doc *ast.CommentGroup) (Type, bool, error) {
+	t := Type{Name: name, TypeName: name}
+	var options []string
+	found := false
+	for _, c := range doc.List {
+		switch fields := strings.Fields(c.Text); fields[0] {
+		case "//eh:event":
+			options, found = fields[1:], true
+		case "//eh:command":
+			options, found = fields[1:], true
+			t.Command = true
+		}
+	}
+	if !found {
+		return t, false, nil
+	}
+
+	for _, option := range options {
+		parts := strings.SplitN(option, "=", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return t, false, ErrInvalidDirective
+		}
+		switch parts[0] {
+		case "aggregate":
+			t.AggregateType = parts[1]
+		case "id":
+			t.IDField = parts[1]
+		case "type":
+			t.TypeName = parts[1]
+		default:
+			return t, false, ErrInvalidDirective
+		}
+	}
+	if t.AggregateType == "" {
+		return t, false, ErrInvalidDirective
+	}
+
+	// Use the first UUID field as the aggregate ID.
+	if t.IDField == "" {
+		for _, field := range st.Fields.List {
+			if isUUID(field.Type) && len(field.Names) > 0 {
+				t.IDField = field.Names[0].Name
+				break
+			}
+		}
+	}
+	if t.IDField == "" {
+		return t, false, ErrNoIDField
+	}
+	return t, true, nil
+}
+
+// isUUID returns true for the UUID type, qualified or not.
+func isUUID(expr ast.Expr) bool {
+	switch expr := expr.(type) {
+	case *ast.Ident:
+		return expr.Name == "UUID"
+	case *ast.SelectorExpr:
+		return expr.Sel.Name == "UUID"
+	}
+	return false
+}
+
+// Generate generates the Go source of the methods, factories and registration
+// of the types.
+func Generate(defs Definitions) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := typesTemplate.Execute(&buf, defs); err != nil {
+		return nil, err
+	}
+	return format.Source(buf.Bytes())
+}
+
+var typesTemplate = template.Must(template.New("types").Parse(`// Code generated by ehgen. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"github.com/looplab/eventhorizon"
+)
+{{range .Types}}
+func (t *{{.Name}}) AggregateID() eventhorizon.UUID { return t.{{.IDField}} }
+func (t *{{.Name}}) AggregateType() string { return {{.AggregateType}} }
+{{- if .Command}}
+func (t *{{.Name}}) CommandType() string { return "{{.TypeName}}" }
+
+// New{{.Name}} creates an empty {{.Name}} command.
+func New{{.Name}}() eventhorizon.Command { return &{{.Name}}{} }
+{{- else}}
+func (t *{{.Name}}) EventType() string { return "{{.TypeName}}" }
+
+// New{{.Name}} creates an empty {{.Name}} event.
+func New{{.Name}}() eventhorizon.Event { return &{{.Name}}{} }
+{{- end}}
+{{end}}
+{{- with .Events}}
+// RegisterEventTypes registers the factories of the events with an event store
+// or bus.
+func RegisterEventTypes(r eventhorizon.EventTypeRegisterer) error {
+{{- range .}}
+	if err := r.RegisterEventType(&{{.Name}}{}, New{{.Name}}); err != nil {
+		return err
+	}
+{{- end}}
+	return nil
+}
+{{end}}
+{{- with .Commands}}
+// RegisterCommandTypes registers the factories of the commands.
+func RegisterCommandTypes() error {
+{{- range .}}
+	if err := eventhorizon.RegisterCommandType(New{{.Name}}); err != nil {
+		return err
+	}
+{{- end}}
+	return nil
+}
+{{end}}`))
@@ -0,0 +1,78 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+func TestGenerate(t *testing.T) {
+	src, err := ioutil.ReadFile(filepath.Join("testdata", "types.go"))
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defs, err := Parse(src)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(defs.Types) != 3 {
+		t.Error("there should be three types:", defs.Types)
+	}
+
+	gen, err := Generate(defs)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	golden := filepath.Join("testdata", "types.golden")
+	if *update {
+		if err := ioutil.WriteFile(golden, gen, 0644); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}
+	expected, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if string(gen) != string(expected) {
+		t.Error("the generated source should be correct:\n", string(gen))
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	t.Log("missing aggregate type")
+	if _, err := Parse([]byte("package a\n//eh:event\ntype A struct{ ID UUID }\n")); err != ErrInvalidDirective {
+		t.Error("there should be a ErrInvalidDirective error:", err)
+	}
+
+	t.Log("unknown option")
+	if _, err := Parse([]byte("package a\n//eh:event aggregate=T other=1\ntype A struct{ ID UUID }\n")); err != ErrInvalidDirective {
+		t.Error("there should be a ErrInvalidDirective error:", err)
+	}
+
+	t.Log("no ID field")
+	if _, err := Parse([]byte("package a\n//eh:event aggregate=T\ntype A struct{ Name string }\n")); err != ErrNoIDField {
+		t.Error("there should be a ErrNoIDField error:", err)
+	}
+
+	t.Log("mixed packages")
+	if _, err := Parse([]byte("package a\n"), []byte("package b\n")); err != ErrMixedPackages {
+		t.Error("there should be a ErrMixedPackages error:", err)
+	}
+}
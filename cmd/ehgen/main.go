@@ -0,0 +1,75 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command ehgen generates the methods, factories and registration of event and
+// command types from their struct definitions. It is meant to be run by go
+// generate:
+//
+//     //go:generate go run github.com/looplab/eventhorizon/cmd/ehgen -out types_gen.go events.go commands.go
+//
+// The structs to generate for are marked with a directive comment, with the Go
+// expression of their aggregate type:
+//
+//     // InviteCreated is an event for when an invite has been created.
+//     //eh:event aggregate=InvitationAggregateType
+//     type InviteCreated struct {
+//         InvitationID eventhorizon.UUID
+//         Name         string
+//     }
+//
+// Commands are marked with //eh:command instead. The aggregate ID is the first
+// field of type eventhorizon.UUID, or the field set with id=Field, and the
+// event or command type is the name of the struct, or the one set with
+// type=Name.
+//
+// For each type AggregateID, AggregateType and EventType or CommandType
+// methods are generated, and a New<Type> factory. RegisterEventTypes registers
+// the factories of the events with an event store or bus, and
+// RegisterCommandTypes registers the commands with RegisterCommandType.
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"log"
+)
+
+func main() {
+	out := flag.String("out", "", "the Go file to write the generated code to")
+	flag.Parse()
+	if *out == "" || flag.NArg() == 0 {
+		flag.Usage()
+		log.Fatal("both -out and source files are needed")
+	}
+
+	var srcs [][]byte
+	for _, in := range flag.Args() {
+		src, err := ioutil.ReadFile(in)
+		if err != nil {
+			log.Fatalf("could not read source: %s", err)
+		}
+		srcs = append(srcs, src)
+	}
+	defs, err := Parse(srcs...)
+	if err != nil {
+		log.Fatalf("could not parse types: %s", err)
+	}
+	src, err := Generate(defs)
+	if err != nil {
+		log.Fatalf("could not generate code: %s", err)
+	}
+	if err := ioutil.WriteFile(*out, src, 0644); err != nil {
+		log.Fatalf("could not write code: %s", err)
+	}
+}
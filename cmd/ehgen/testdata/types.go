@@ -0,0 +1,32 @@
+package domain
+
+import (
+	"github.com/looplab/eventhorizon"
+)
+
+// InviteCreated is an event for when an invite has been created.
+//eh:event aggregate=InvitationAggregateType
+type InviteCreated struct {
+	Name         string
+	InvitationID eventhorizon.UUID
+}
+
+type (
+	// InviteAccepted is an event for when an invite has been accepted.
+	//eh:event aggregate=InvitationAggregateType type=InvitationAccepted
+	InviteAccepted struct {
+		InvitationID eventhorizon.UUID
+	}
+
+	// notAnEvent is not marked.
+	notAnEvent struct {
+		ID eventhorizon.UUID
+	}
+)
+
+// CreateInvite is a command for creating invites.
+//eh:command aggregate=InvitationAggregateType id=Invitation
+type CreateInvite struct {
+	ID         eventhorizon.UUID
+	Invitation eventhorizon.UUID
+}
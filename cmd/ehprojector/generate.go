@@ -0,0 +1,160 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"go/format"
+	"sort"
+	"strconv"
+	"text/template"
+)
+
+// ErrInvalidMapping is when a mapping is missing needed fields.
+var ErrInvalidMapping = errors.New("invalid mapping")
+
+// Mapping is a declarative mapping of events to mutations of a read model.
+type Mapping struct {
+	Package   string         `json:"package"`
+	Imports   []string       `json:"imports"`
+	Projector string         `json:"projector"`
+	Model     string         `json:"model"`
+	Events    []EventMapping `json:"events"`
+}
+
+// EventMapping is the mutations of a read model for an event type.
+type EventMapping struct {
+	Event  string            `json:"event"`
+	ID     string            `json:"id"`
+	Create bool              `json:"create"`
+	Upsert bool              `json:"upsert"`
+	Remove bool              `json:"remove"`
+	Set    map[string]string `json:"set"`
+	Inc    map[string]int    `json:"inc"`
+}
+
+// field is a mutation of a field, sorted by name for a stable output.
+type field struct {
+	Name  string
+	Value string
+}
+
+// SetFields returns the fields to set, sorted by name.
+func (e EventMapping) SetFields() []field {
+	fields := []field{}
+	for name, value := range e.Set {
+		fields = append(fields, field{name, value})
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Name < fields[j].Name })
+	return fields
+}
+
+// IncFields returns the fields to increment, sorted by name.
+func (e EventMapping) IncFields() []field {
+	fields := []field{}
+	for name, value := range e.Inc {
+		fields = append(fields, field{name, strconv.Itoa(value)})
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Name < fields[j].Name })
+	return fields
+}
+
+// Generate generates the Go source of a projector from a mapping.
+func Generate(mapping Mapping) ([]byte, error) {
+	if mapping.Package == "" || mapping.Projector == "" || mapping.Model == "" {
+		return nil, ErrInvalidMapping
+	}
+	for i, e := range mapping.Events {
+		if e.Event == "" {
+			return nil, ErrInvalidMapping
+		}
+		if e.ID == "" {
+			mapping.Events[i].ID = "event.AggregateID()"
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := projectorTemplate.Execute(&buf, mapping); err != nil {
+		return nil, err
+	}
+	return format.Source(buf.Bytes())
+}
+
+var projectorTemplate = template.Must(template.New("projector").Parse(`// Code generated by ehprojector. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"log"
+
+	"github.com/looplab/eventhorizon"
+{{range .Imports}}
+	"{{.}}"
+{{- end}}
+)
+
+// {{.Projector}} is a projector that updates the {{.Model}} read models.
+type {{.Projector}} struct {
+	repository eventhorizon.ReadRepository
+}
+
+// New{{.Projector}} creates a new {{.Projector}}.
+func New{{.Projector}}(repository eventhorizon.ReadRepository) *{{.Projector}} {
+	return &{{.Projector}}{
+		repository: repository,
+	}
+}
+
+// HandleEvent implements the HandleEvent method of the EventHandler interface.
+func (p *{{.Projector}}) HandleEvent(event eventhorizon.Event) {
+	switch event := event.(type) {
+{{- range .Events}}
+	case *{{.Event}}:
+		id := {{.ID}}
+{{- if .Remove}}
+		if err := p.repository.Remove(id); err != nil {
+			log.Printf("error: {{$.Projector}}: could not remove model %s: %v\n", id, err)
+		}
+{{- else}}
+{{- if .Create}}
+		model := &{{$.Model}}{}
+{{- else}}
+		m, err := p.repository.Find(id)
+{{- if .Upsert}}
+		if err == eventhorizon.ErrModelNotFound {
+			m, err = &{{$.Model}}{}, nil
+		}
+{{- end}}
+		if err != nil {
+			log.Printf("error: {{$.Projector}}: could not find model %s: %v\n", id, err)
+			return
+		}
+		model := m.(*{{$.Model}})
+{{- end}}
+{{- range .SetFields}}
+		model.{{.Name}} = {{.Value}}
+{{- end}}
+{{- range .IncFields}}
+		model.{{.Name}} += {{.Value}}
+{{- end}}
+		if err := p.repository.Save(id, model); err != nil {
+			log.Printf("error: {{$.Projector}}: could not save model %s: %v\n", id, err)
+		}
+{{- end}}
+{{- end}}
+	}
+}
+`))
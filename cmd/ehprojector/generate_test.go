@@ -0,0 +1,59 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+func TestGenerate(t *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "projector.json"))
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	var mapping Mapping
+	if err := json.Unmarshal(data, &mapping); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	src, err := Generate(mapping)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	golden := filepath.Join("testdata", "projector.golden")
+	if *update {
+		if err := ioutil.WriteFile(golden, src, 0644); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}
+	expected, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if string(src) != string(expected) {
+		t.Error("the generated source should be correct:\n", string(src))
+	}
+
+	t.Log("invalid mapping")
+	if _, err := Generate(Mapping{Package: "main"}); err != ErrInvalidMapping {
+		t.Error("there should be a ErrInvalidMapping error:", err)
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command ehprojector generates projectors from declarative mappings of event
+// types to read model mutations. It is meant to be run by go generate:
+//
+//     //go:generate go run github.com/looplab/eventhorizon/cmd/ehprojector -in projector.json -out projector_gen.go
+//
+// A mapping is a JSON file like:
+//
+//     {
+//         "package": "main",
+//         "imports": ["github.com/looplab/eventhorizon/examples/domain"],
+//         "projector": "InvitationProjector",
+//         "model": "Invitation",
+//         "events": [
+//             {
+//                 "event": "domain.InviteCreated",
+//                 "id": "event.InvitationID",
+//                 "create": true,
+//                 "set": {"ID": "event.InvitationID", "Name": "event.Name"}
+//             },
+//             {
+//                 "event": "domain.InviteAccepted",
+//                 "id": "event.InvitationID",
+//                 "set": {"Status": "\"accepted\""}
+//             }
+//         ]
+//     }
+//
+// For each event the model with the ID is loaded, or created if create is set,
+// or loaded and created if missing if upsert is set. The fields in set are
+// assigned Go expressions, where event is the typed event, and the fields in
+// inc are incremented. The model is then saved, or removed if remove is set.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"log"
+)
+
+func main() {
+	in := flag.String("in", "", "the JSON mapping to generate a projector from")
+	out := flag.String("out", "", "the Go file to write the projector to")
+	flag.Parse()
+	if *in == "" || *out == "" {
+		flag.Usage()
+		log.Fatal("both -in and -out are needed")
+	}
+
+	data, err := ioutil.ReadFile(*in)
+	if err != nil {
+		log.Fatalf("could not read mapping: %s", err)
+	}
+	var mapping Mapping
+	if err := json.Unmarshal(data, &mapping); err != nil {
+		log.Fatalf("could not parse mapping: %s", err)
+	}
+	src, err := Generate(mapping)
+	if err != nil {
+		log.Fatalf("could not generate projector: %s", err)
+	}
+	if err := ioutil.WriteFile(*out, src, 0644); err != nil {
+		log.Fatalf("could not write projector: %s", err)
+	}
+}
@@ -0,0 +1,221 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// ErrStructNotFound is when a struct could not be found in the source.
+var ErrStructNotFound = errors.New("struct not found")
+
+// Field is a field that differs, or not, between two versions of a struct,
+// with its types as Go source. A missing type is empty.
+type Field struct {
+	Name     string
+	FromType string
+	ToType   string
+}
+
+// Sample returns a Go literal of the old type to use in tests, or an empty
+// string if there is none for the type.
+func (f Field) Sample() string {
+	switch t := f.FromType; {
+	case t == "string":
+		return strconv.Quote(f.Name)
+	case t == "bool":
+		return "true"
+	case strings.HasPrefix(t, "int") || strings.HasPrefix(t, "uint"):
+		return "1"
+	case strings.HasPrefix(t, "float"):
+		return "1.5"
+	case t == "UUID" || strings.HasSuffix(t, ".UUID"):
+		return `"c1138e5f-f6fb-4dd0-8e79-255c6c8d3756"`
+	}
+	return ""
+}
+
+// Upcaster is the difference between two versions of an event struct.
+type Upcaster struct {
+	Package string
+	From    string
+	To      string
+	Copied  []Field
+	Added   []Field
+	Removed []Field
+	Changed []Field
+}
+
+// Diff compares the fields of two structs in a Go source.
+func Diff(src []byte, from, to string) (Upcaster, error) {
+	u := Upcaster{From: from, To: to}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, 0)
+	if err != nil {
+		return u, err
+	}
+	u.Package = f.Name.Name
+
+	fromFields, err := structFields(fset, f, from)
+	if err != nil {
+		return u, err
+	}
+	toFields, err := structFields(fset, f, to)
+	if err != nil {
+		return u, err
+	}
+
+	types := map[string]string{}
+	for _, field := range fromFields {
+		types[field.Name] = field.FromType
+	}
+	for _, field := range toFields {
+		field := Field{Name: field.Name, FromType: types[field.Name], ToType: field.FromType}
+		switch field.FromType {
+		case "":
+			u.Added = append(u.Added, field)
+		case field.ToType:
+			u.Copied = append(u.Copied, field)
+		default:
+			u.Changed = append(u.Changed, field)
+		}
+		delete(types, field.Name)
+	}
+	for _, field := range fromFields {
+		if _, ok := types[field.Name]; ok {
+			u.Removed = append(u.Removed, field)
+		}
+	}
+	return u, nil
+}
+
+// structFields returns the named fields of a struct in a file, with their types
+// as FromType.
+func structFields(fset *token.FileSet, f *ast.File, name string) ([]Field, error) {
+	obj := f.Scope.Lookup(name)
+	if obj == nil {
+		return nil, ErrStructNotFound
+	}
+	spec, ok := obj.Decl.(*ast.TypeSpec)
+	if !ok {
+		return nil, ErrStructNotFound
+	}
+	st, ok := spec.Type.(*ast.StructType)
+	if !ok {
+		return nil, ErrStructNotFound
+	}
+
+	var fields []Field
+	for _, field := range st.Fields.List {
+		var buf bytes.Buffer
+		if err := format.Node(&buf, fset, field.Type); err != nil {
+			return nil, err
+		}
+		for _, n := range field.Names {
+			fields = append(fields, Field{Name: n.Name, FromType: buf.String()})
+		}
+	}
+	return fields, nil
+}
+
+// Generate generates the Go source of an upcaster and of its test.
+func Generate(u Upcaster) ([]byte, []byte, error) {
+	var code, test bytes.Buffer
+	if err := upcasterTemplate.Execute(&code, u); err != nil {
+		return nil, nil, err
+	}
+	if err := testTemplate.Execute(&test, u); err != nil {
+		return nil, nil, err
+	}
+	codeSrc, err := format.Source(code.Bytes())
+	if err != nil {
+		return nil, nil, err
+	}
+	testSrc, err := format.Source(test.Bytes())
+	if err != nil {
+		return nil, nil, err
+	}
+	return codeSrc, testSrc, nil
+}
+
+var upcasterTemplate = template.Must(template.New("upcaster").Parse(`package {{.Package}}
+
+// Upcast{{.From}} upcasts an event from {{.From}} to {{.To}}.
+func Upcast{{.From}}(e *{{.From}}) *{{.To}} {
+{{- range .Removed}}
+	// TODO: Handle the removed field {{.Name}} {{.FromType}}.
+{{- end}}
+	return &{{.To}}{
+{{- range .Copied}}
+		{{.Name}}: e.{{.Name}},
+{{- end}}
+{{- range .Changed}}
+		// TODO: Convert {{.Name}} from {{.FromType}} to {{.ToType}}.
+{{- end}}
+{{- range .Added}}
+		// TODO: Set the added field {{.Name}} {{.ToType}}.
+{{- end}}
+	}
+}
+`))
+
+var testTemplate = template.Must(template.New("test").Parse(`package {{.Package}}
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestUpcast{{.From}}(t *testing.T) {
+	old := &{{.From}}{
+{{- range .Copied}}{{if .Sample}}
+		{{.Name}}: {{.Sample}},
+{{- end}}{{end}}
+	}
+
+	// Load the old event as from an event store.
+	data, err := bson.Marshal(old)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	loaded := &{{.From}}{}
+	if err := bson.Unmarshal(data, loaded); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	e := Upcast{{.From}}(loaded)
+{{- range .Copied}}
+	if !reflect.DeepEqual(e.{{.Name}}, old.{{.Name}}) {
+		t.Error("{{.Name}} should be copied:", e.{{.Name}})
+	}
+{{- end}}
+{{- range .Changed}}
+	// TODO: Check the converted field {{.Name}}.
+{{- end}}
+{{- range .Added}}
+	// TODO: Check the added field {{.Name}}.
+{{- end}}
+}
+`))
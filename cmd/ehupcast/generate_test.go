@@ -0,0 +1,78 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+func TestGenerate(t *testing.T) {
+	src, err := ioutil.ReadFile(filepath.Join("testdata", "events.go"))
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	u, err := Diff(src, "InviteCreatedV1", "InviteCreated")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	expected := Upcaster{
+		Package: "domain",
+		From:    "InviteCreatedV1",
+		To:      "InviteCreated",
+		Copied: []Field{
+			{"InvitationID", "eventhorizon.UUID", "eventhorizon.UUID"},
+			{"Name", "string", "string"},
+		},
+		Added:   []Field{{"CreatedAt", "", "time.Time"}},
+		Removed: []Field{{"Email", "string", ""}},
+		Changed: []Field{{"Age", "string", "int"}},
+	}
+	if !reflect.DeepEqual(u, expected) {
+		t.Error("the diff should be correct:", u)
+	}
+
+	code, test, err := Generate(u)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	for golden, gen := range map[string][]byte{
+		filepath.Join("testdata", "upcaster.golden"):      code,
+		filepath.Join("testdata", "upcaster_test.golden"): test,
+	} {
+		if *update {
+			if err := ioutil.WriteFile(golden, gen, 0644); err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+		}
+		expected, err := ioutil.ReadFile(golden)
+		if err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+		if string(gen) != string(expected) {
+			t.Error("the generated source should be correct:\n", string(gen))
+		}
+	}
+
+	t.Log("missing struct")
+	if _, err := Diff(src, "InviteCreatedV0", "InviteCreated"); err != ErrStructNotFound {
+		t.Error("there should be a ErrStructNotFound error:", err)
+	}
+}
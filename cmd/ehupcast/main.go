@@ -0,0 +1,65 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command ehupcast scaffolds an upcaster between two versions of an event
+// struct, and a test for it. The fields of the structs are compared by name,
+// fields with the same type are copied, and the added, removed and changed
+// fields are left as TODOs. It is run once when a new version of an event is
+// added, and the output is then edited:
+//
+//     ehupcast -in events.go -from InviteCreatedV1 -to InviteCreated -out upcast_invitecreated.go
+//
+// The test is written next to the output, with a _test.go suffix. It marshals
+// an old event to BSON and back, as when loaded from an event store, upcasts it
+// and checks the copied fields.
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"log"
+	"strings"
+)
+
+func main() {
+	in := flag.String("in", "", "the Go file with both versions of the event")
+	from := flag.String("from", "", "the struct of the old version")
+	to := flag.String("to", "", "the struct of the new version")
+	out := flag.String("out", "", "the Go file to write the upcaster to")
+	flag.Parse()
+	if *in == "" || *from == "" || *to == "" || !strings.HasSuffix(*out, ".go") {
+		flag.Usage()
+		log.Fatal("-in, -from, -to and a .go file for -out are needed")
+	}
+
+	src, err := ioutil.ReadFile(*in)
+	if err != nil {
+		log.Fatalf("could not read source: %s", err)
+	}
+	upcaster, err := Diff(src, *from, *to)
+	if err != nil {
+		log.Fatalf("could not compare structs: %s", err)
+	}
+	code, test, err := Generate(upcaster)
+	if err != nil {
+		log.Fatalf("could not generate upcaster: %s", err)
+	}
+	if err := ioutil.WriteFile(*out, code, 0644); err != nil {
+		log.Fatalf("could not write upcaster: %s", err)
+	}
+	testOut := strings.TrimSuffix(*out, ".go") + "_test.go"
+	if err := ioutil.WriteFile(testOut, test, 0644); err != nil {
+		log.Fatalf("could not write test: %s", err)
+	}
+}
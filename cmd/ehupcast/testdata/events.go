@@ -0,0 +1,23 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/looplab/eventhorizon"
+)
+
+// InviteCreatedV1 is the first version of InviteCreated.
+type InviteCreatedV1 struct {
+	InvitationID eventhorizon.UUID
+	Name         string
+	Age          string
+	Email        string
+}
+
+// InviteCreated is an event for when an invite has been created.
+type InviteCreated struct {
+	InvitationID eventhorizon.UUID
+	Name         string
+	Age          int
+	CreatedAt    time.Time
+}
@@ -0,0 +1,135 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrUnknownContentType is when data has a content type without a codec.
+var ErrUnknownContentType = errors.New("unknown content type")
+
+// EventCodec is a codec for marshaling events to and from bytes, used by
+// buses and stores that send or persist events.
+type EventCodec interface {
+	// MarshalEvent marshals an event into bytes.
+	MarshalEvent(Event) ([]byte, error)
+
+	// UnmarshalEvent unmarshals bytes into an event, which is usually created
+	// by a registered factory.
+	UnmarshalEvent([]byte, Event) error
+}
+
+// CommandCodec is a codec for marshaling commands to and from bytes, used by
+// remote command buses.
+type CommandCodec interface {
+	// MarshalCommand marshals a command into bytes.
+	MarshalCommand(Command) ([]byte, error)
+
+	// UnmarshalCommand unmarshals bytes into a command, which is usually
+	// created by a factory registered with RegisterCommandType.
+	UnmarshalCommand([]byte, Command) error
+}
+
+// EventStorageHook is a hook for the marshaled data of events at the storage
+// boundary of event stores, for example for encryption or tokenization of
+// fields, independent of the codecs used by buses.
+type EventStorageHook interface {
+	// PrePersist is called with the marshaled data of an event before it is
+	// persisted, and returns the data to persist.
+	PrePersist(Event, []byte) ([]byte, error)
+
+	// PostLoad is called with the persisted data of an event of a type before
+	// it is unmarshaled, and returns the marshaled data.
+	PostLoad(eventType string, data []byte) ([]byte, error)
+}
+
+// EventCodecs selects the codecs of events by their type, for buses and stores
+// that mix formats, for example protobuf for high volume events and JSON for
+// the rest. The content type of the codec is sent along with the data so that
+// receivers use the same codec. Data without a content type uses the default
+// codec.
+type EventCodecs struct {
+	defaultCodec       EventCodec
+	defaultContentType string
+	codecs             map[string]EventCodec // By content type.
+	contentTypes       map[string]string     // By event type.
+	mu                 sync.RWMutex
+}
+
+// NewEventCodecs creates a new EventCodecs with a default codec.
+func NewEventCodecs(defaultCodec EventCodec) *EventCodecs {
+	return &EventCodecs{
+		defaultCodec: defaultCodec,
+		codecs:       make(map[string]EventCodec),
+		contentTypes: make(map[string]string),
+	}
+}
+
+// SetCodec sets the codec of a content type and uses it for the event types.
+// Codecs set without event types are only used to unmarshal data.
+func (c *EventCodecs) SetCodec(contentType string, codec EventCodec, events ...Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.codecs[contentType] = codec
+	for _, event := range events {
+		c.contentTypes[event.EventType()] = contentType
+	}
+}
+
+// SetDefaultCodec sets the codec of a content type and uses it for all event
+// types without a codec of their own. Data without a content type is still
+// unmarshaled with the codec the EventCodecs was created with.
+func (c *EventCodecs) SetDefaultCodec(contentType string, codec EventCodec) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.codecs[contentType] = codec
+	c.defaultContentType = contentType
+}
+
+// MarshalEvent marshals an event with the codec of its type, and returns the
+// content type of the codec, which is empty for the default codec.
+func (c *EventCodecs) MarshalEvent(event Event) (string, []byte, error) {
+	c.mu.RLock()
+	contentType, ok := c.contentTypes[event.EventType()]
+	if !ok {
+		contentType = c.defaultContentType
+	}
+	codec, ok := c.codecs[contentType]
+	c.mu.RUnlock()
+	if !ok {
+		codec = c.defaultCodec
+	}
+
+	data, err := codec.MarshalEvent(event)
+	return contentType, data, err
+}
+
+// UnmarshalEvent unmarshals data into an event with the codec of the content
+// type. Returns ErrUnknownContentType if there is no codec for it.
+func (c *EventCodecs) UnmarshalEvent(contentType string, data []byte, event Event) error {
+	codec := c.defaultCodec
+	if contentType != "" {
+		c.mu.RLock()
+		var ok bool
+		codec, ok = c.codecs[contentType]
+		c.mu.RUnlock()
+		if !ok {
+			return ErrUnknownContentType
+		}
+	}
+	return codec.UnmarshalEvent(data, event)
+}
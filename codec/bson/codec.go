@@ -0,0 +1,53 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package bson contains event and command codecs using BSON, the format used by the
+// Redis event bus and the MongoDB event store.
+package bson
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/looplab/eventhorizon"
+)
+
+// ContentType is the content type of data marshaled by the codecs.
+const ContentType = "application/bson"
+
+// EventCodec is a codec for marshaling events to and from BSON.
+type EventCodec struct{}
+
+// MarshalEvent marshals an event into BSON. The driver marshals into pooled
+// buffers, so the codec doesn't pool its own.
+func (EventCodec) MarshalEvent(event eventhorizon.Event) ([]byte, error) {
+	return bson.Marshal(event)
+}
+
+// UnmarshalEvent unmarshals BSON into an event.
+func (EventCodec) UnmarshalEvent(data []byte, event eventhorizon.Event) error {
+	return bson.Unmarshal(data, event)
+}
+
+// CommandCodec is a codec for marshaling commands to and from BSON.
+type CommandCodec struct{}
+
+// MarshalCommand marshals a command into BSON.
+func (CommandCodec) MarshalCommand(command eventhorizon.Command) ([]byte, error) {
+	return bson.Marshal(command)
+}
+
+// UnmarshalCommand unmarshals BSON into a command.
+func (CommandCodec) UnmarshalCommand(data []byte, command eventhorizon.Command) error {
+	return bson.Unmarshal(data, command)
+}
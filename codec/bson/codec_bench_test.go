@@ -0,0 +1,48 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bson
+
+import (
+	"testing"
+
+	"github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/testutil"
+)
+
+// BenchmarkEventCodecMarshal measures marshaling, which TestEventCodecAllocs
+// guards to only allocate the returned data.
+func BenchmarkEventCodecMarshal(b *testing.B) {
+	codec := EventCodec{}
+	event := &testutil.TestEvent{eventhorizon.NewUUID(), "event"}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := codec.MarshalEvent(event); err != nil {
+			b.Fatal("there should be no error:", err)
+		}
+	}
+}
+
+func TestEventCodecAllocs(t *testing.T) {
+	codec := EventCodec{}
+	event := &testutil.TestEvent{eventhorizon.NewUUID(), "event"}
+
+	if allocs := testing.AllocsPerRun(100, func() {
+		codec.MarshalEvent(event)
+	}); allocs != 1 {
+		t.Error("marshaling should only allocate the data:", allocs)
+	}
+}
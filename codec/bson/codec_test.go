@@ -0,0 +1,65 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bson
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/testutil"
+)
+
+func TestEventCodec(t *testing.T) {
+	var codec eventhorizon.EventCodec = EventCodec{}
+
+	event := &testutil.TestEvent{eventhorizon.NewUUID(), "event1"}
+	data, err := codec.MarshalEvent(event)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	decoded := &testutil.TestEvent{}
+	if err := codec.UnmarshalEvent(data, decoded); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(decoded, event) {
+		t.Error("the decoded event should be correct:", decoded)
+	}
+}
+
+func TestCommandCodec(t *testing.T) {
+	var codec eventhorizon.CommandCodec = CommandCodec{}
+	if err := eventhorizon.RegisterCommandType(func() eventhorizon.Command {
+		return &testutil.TestCommand{}
+	}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer eventhorizon.UnregisterCommandType("TestCommand")
+
+	command := &testutil.TestCommand{eventhorizon.NewUUID(), "command1"}
+	data, err := codec.MarshalCommand(command)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	decoded, err := eventhorizon.UnmarshalCommand(codec, command.CommandType(), data)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(decoded, command) {
+		t.Error("the decoded command should be correct:", decoded)
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package json contains event and command codecs using JSON.
+package json
+
+import (
+	"encoding/json"
+
+	"github.com/looplab/eventhorizon"
+)
+
+// ContentType is the content type of data marshaled by the codecs.
+const ContentType = "application/json"
+
+// EventCodec is a codec for marshaling events to and from JSON.
+type EventCodec struct{}
+
+// MarshalEvent marshals an event into JSON. The encoding/json package marshals
+// into pooled buffers, so the codec doesn't pool its own.
+func (EventCodec) MarshalEvent(event eventhorizon.Event) ([]byte, error) {
+	return json.Marshal(event)
+}
+
+// UnmarshalEvent unmarshals JSON into an event.
+func (EventCodec) UnmarshalEvent(data []byte, event eventhorizon.Event) error {
+	return json.Unmarshal(data, event)
+}
+
+// CommandCodec is a codec for marshaling commands to and from JSON.
+type CommandCodec struct{}
+
+// MarshalCommand marshals a command into JSON.
+func (CommandCodec) MarshalCommand(command eventhorizon.Command) ([]byte, error) {
+	return json.Marshal(command)
+}
+
+// UnmarshalCommand unmarshals JSON into a command.
+func (CommandCodec) UnmarshalCommand(data []byte, command eventhorizon.Command) error {
+	return json.Unmarshal(data, command)
+}
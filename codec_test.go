@@ -0,0 +1,115 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestEventCodecs(t *testing.T) {
+	codecs := NewEventCodecs(jsonCodec{})
+	codecs.SetCodec("application/test", prefixCodec{}, &TestEvent2{})
+
+	t.Log("marshal with the default codec")
+	event1 := &TestEvent{NewUUID(), "event1"}
+	contentType, data, err := codecs.MarshalEvent(event1)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if contentType != "" {
+		t.Error("there should be no content type:", contentType)
+	}
+	decoded1 := &TestEvent{}
+	if err := codecs.UnmarshalEvent(contentType, data, decoded1); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(decoded1, event1) {
+		t.Error("the event should be correct:", decoded1)
+	}
+
+	t.Log("marshal with the codec of the event type")
+	event2 := &TestEvent2{NewUUID(), "event2"}
+	contentType, data, err = codecs.MarshalEvent(event2)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if contentType != "application/test" || data[0] != '!' {
+		t.Error("the event should use the codec:", contentType, string(data))
+	}
+	decoded2 := &TestEvent2{}
+	if err := codecs.UnmarshalEvent(contentType, data, decoded2); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(decoded2, event2) {
+		t.Error("the event should be correct:", decoded2)
+	}
+
+	t.Log("unmarshal an unknown content type")
+	if err := codecs.UnmarshalEvent("application/unknown", data, decoded2); err != ErrUnknownContentType {
+		t.Error("there should be a ErrUnknownContentType error:", err)
+	}
+}
+
+func TestEventCodecsDefaultCodec(t *testing.T) {
+	codecs := NewEventCodecs(jsonCodec{})
+	codecs.SetDefaultCodec("application/test", prefixCodec{})
+
+	t.Log("marshal with the default codec")
+	event := &TestEvent{NewUUID(), "event1"}
+	contentType, data, err := codecs.MarshalEvent(event)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if contentType != "application/test" || data[0] != '!' {
+		t.Error("the event should use the codec:", contentType, string(data))
+	}
+	decoded := &TestEvent{}
+	if err := codecs.UnmarshalEvent(contentType, data, decoded); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(decoded, event) {
+		t.Error("the event should be correct:", decoded)
+	}
+
+	t.Log("unmarshal data without a content type")
+	data, _ = json.Marshal(event)
+	decoded = &TestEvent{}
+	if err := codecs.UnmarshalEvent("", data, decoded); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(decoded, event) {
+		t.Error("the event should be correct:", decoded)
+	}
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) MarshalEvent(event Event) ([]byte, error) { return json.Marshal(event) }
+
+func (jsonCodec) UnmarshalEvent(data []byte, event Event) error { return json.Unmarshal(data, event) }
+
+// prefixCodec is a JSON codec that prefixes the data, to tell it apart.
+type prefixCodec struct{}
+
+func (prefixCodec) MarshalEvent(event Event) ([]byte, error) {
+	data, err := json.Marshal(event)
+	return append([]byte("!"), data...), err
+}
+
+func (prefixCodec) UnmarshalEvent(data []byte, event Event) error {
+	return json.Unmarshal(data[1:], event)
+}
@@ -15,6 +15,7 @@
 package eventhorizon
 
 import (
+	"context"
 	"errors"
 )
 
@@ -29,6 +30,25 @@ type CommandHandler interface {
 	HandleCommand(Command) error
 }
 
+// ContextCommandHandler is an optional interface for command handlers that
+// want the context of the commands they handle, for example with the principal
+// that sent them.
+type ContextCommandHandler interface {
+	CommandHandler
+
+	// HandleCommandWithContext handles a command with its context.
+	HandleCommandWithContext(context.Context, Command) error
+}
+
+// HandleCommandWithContext lets a handler handle a command, with the context if
+// the handler implements ContextCommandHandler.
+func HandleCommandWithContext(ctx context.Context, handler CommandHandler, command Command) error {
+	if h, ok := handler.(ContextCommandHandler); ok {
+		return h.HandleCommandWithContext(ctx, command)
+	}
+	return handler.HandleCommand(command)
+}
+
 // CommandBus is an interface defining an event bus for distributing events.
 type CommandBus interface {
 	// HandleCommand handles a command on the event bus.
@@ -81,37 +81,49 @@ func (h *AggregateCommandHandler) SetAggregate(aggregate Aggregate, command Comm
 // HandleCommand handles a command with the registered aggregate.
 // Returns ErrAggregateNotFound if no aggregate could be found.
 func (h *AggregateCommandHandler) HandleCommand(command Command) error {
-	err := h.checkCommand(command)
+	_, err := h.HandleCommandWithVersion(command)
+	return err
+}
+
+// HandleCommandWithVersion handles a command as HandleCommand and returns the
+// version of the aggregate after saving its new events. The version can be
+// used to wait for the read models to reflect the command, see VersionWaiter.
+func (h *AggregateCommandHandler) HandleCommandWithVersion(command Command) (int, error) {
+	err := CheckCommand(command)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	var aggregateType string
 	var ok bool
 	if aggregateType, ok = h.aggregates[command.CommandType()]; !ok {
-		return ErrAggregateNotFound
+		return 0, ErrAggregateNotFound
 	}
 
 	var aggregate Aggregate
 	if aggregate, err = h.repository.Load(aggregateType, command.AggregateID()); err != nil {
-		return err
+		return 0, err
 	}
 	if aggregate == nil {
-		return ErrAggregateNotFound
+		return 0, ErrAggregateNotFound
 	}
 
 	if err = aggregate.HandleCommand(command); err != nil {
-		return err
+		return 0, err
 	}
 
+	version := aggregate.Version() + len(aggregate.GetUncommittedEvents())
 	if err = h.repository.Save(aggregate); err != nil {
-		return err
+		return 0, err
 	}
 
-	return nil
+	return version, nil
 }
 
-func (h *AggregateCommandHandler) checkCommand(command Command) error {
+// CheckCommand checks that the public fields of a command are set, except the
+// ones tagged as `eh:"optional"`. Returns a CommandFieldError for the first
+// field that is not set.
+func CheckCommand(command Command) error {
 	rv := reflect.Indirect(reflect.ValueOf(command))
 	rt := rv.Type()
 
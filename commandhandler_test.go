@@ -55,6 +55,19 @@ func TestCommandHandlerSimple(t *testing.T) {
 	}
 }
 
+func TestCommandHandlerWithVersion(t *testing.T) {
+	aggregate, handler := createAggregateAndHandler(t)
+
+	command1 := &TestCommand{aggregate.AggregateID(), "command1"}
+	version, err := handler.HandleCommandWithVersion(command1)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if version != 1 {
+		t.Error("the version should be correct:", version)
+	}
+}
+
 func TestCommandHandlerErrorInHandler(t *testing.T) {
 	aggregate, handler := createAggregateAndHandler(t)
 
@@ -88,53 +101,51 @@ func TestCommandHandlerSetHandlerTwice(t *testing.T) {
 	}
 }
 
-func TestCommandHandlerCheckCommand(t *testing.T) {
-	_, handler := createAggregateAndHandler(t)
-
+func TestCheckCommand(t *testing.T) {
 	// Check all fields.
-	err := handler.checkCommand(&TestCommand{NewUUID(), "command1"})
+	err := CheckCommand(&TestCommand{NewUUID(), "command1"})
 	if err != nil {
 		t.Error("there should be no error:", err)
 	}
 
 	// Missing required value.
-	err = handler.checkCommand(&TestCommandValue{TestID: NewUUID()})
+	err = CheckCommand(&TestCommandValue{TestID: NewUUID()})
 	if err == nil || err.Error() != "missing field: Content" {
 		t.Error("there should be a missing field error:", err)
 	}
 
 	// Missing required slice.
-	err = handler.checkCommand(&TestCommandSlice{TestID: NewUUID()})
+	err = CheckCommand(&TestCommandSlice{TestID: NewUUID()})
 	if err == nil || err.Error() != "missing field: Slice" {
 		t.Error("there should be a missing field error:", err)
 	}
 
 	// Missing required map.
-	err = handler.checkCommand(&TestCommandMap{TestID: NewUUID()})
+	err = CheckCommand(&TestCommandMap{TestID: NewUUID()})
 	if err == nil || err.Error() != "missing field: Map" {
 		t.Error("there should be a missing field error:", err)
 	}
 
 	// Missing required struct.
-	err = handler.checkCommand(&TestCommandStruct{TestID: NewUUID()})
+	err = CheckCommand(&TestCommandStruct{TestID: NewUUID()})
 	if err == nil || err.Error() != "missing field: Struct" {
 		t.Error("there should be a missing field error:", err)
 	}
 
 	// Missing required time.
-	err = handler.checkCommand(&TestCommandTime{TestID: NewUUID()})
+	err = CheckCommand(&TestCommandTime{TestID: NewUUID()})
 	if err == nil || err.Error() != "missing field: Time" {
 		t.Error("there should be a missing field error:", err)
 	}
 
 	// Missing optional field.
-	err = handler.checkCommand(&TestCommandOptional{TestID: NewUUID()})
+	err = CheckCommand(&TestCommandOptional{TestID: NewUUID()})
 	if err != nil {
 		t.Error("there should be no error:", err)
 	}
 
 	// Missing private field.
-	err = handler.checkCommand(&TestCommandPrivate{TestID: NewUUID()})
+	err = CheckCommand(&TestCommandPrivate{TestID: NewUUID()})
 	if err != nil {
 		t.Error("there should be no error:", err)
 	}
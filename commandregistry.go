@@ -0,0 +1,92 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+// ErrCommandAlreadyRegistered is when a command type is already registered.
+var ErrCommandAlreadyRegistered = errors.New("command is already registered")
+
+// ErrCommandNotRegistered is when a command type is not registered.
+var ErrCommandNotRegistered = errors.New("command is not registered")
+
+var commandFactories = make(map[string]func() Command)
+var commandFactoriesMu sync.RWMutex
+
+// RegisterCommandType registers a command factory for the type of the commands
+// it creates. The factory is used to create concrete commands when decoding
+// them by name, for example when they are received by a remote command bus.
+//
+// An example would be:
+//     RegisterCommandType(func() Command { return &MyCommand{} })
+func RegisterCommandType(factory func() Command) error {
+	commandType := factory().CommandType()
+
+	commandFactoriesMu.Lock()
+	defer commandFactoriesMu.Unlock()
+	if _, ok := commandFactories[commandType]; ok {
+		return ErrCommandAlreadyRegistered
+	}
+	commandFactories[commandType] = factory
+	return nil
+}
+
+// UnregisterCommandType removes the factory of a command type.
+func UnregisterCommandType(commandType string) {
+	commandFactoriesMu.Lock()
+	defer commandFactoriesMu.Unlock()
+	delete(commandFactories, commandType)
+}
+
+// CreateCommand creates an empty command of a type with its registered
+// factory. Returns ErrCommandNotRegistered if the type is not registered.
+func CreateCommand(commandType string) (Command, error) {
+	commandFactoriesMu.RLock()
+	defer commandFactoriesMu.RUnlock()
+	factory, ok := commandFactories[commandType]
+	if !ok {
+		return nil, ErrCommandNotRegistered
+	}
+	return factory(), nil
+}
+
+// CommandTypes returns the registered command types, sorted.
+func CommandTypes() []string {
+	commandFactoriesMu.RLock()
+	defer commandFactoriesMu.RUnlock()
+	commandTypes := make([]string, 0, len(commandFactories))
+	for commandType := range commandFactories {
+		commandTypes = append(commandTypes, commandType)
+	}
+	sort.Strings(commandTypes)
+	return commandTypes
+}
+
+// UnmarshalCommand creates a command of a type with its registered factory and
+// unmarshals data into it with a codec.
+func UnmarshalCommand(codec CommandCodec, commandType string, data []byte) (Command, error) {
+	command, err := CreateCommand(commandType)
+	if err != nil {
+		return nil, err
+	}
+	if err := codec.UnmarshalCommand(data, command); err != nil {
+		return nil, err
+	}
+	return command, nil
+}
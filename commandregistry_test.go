@@ -0,0 +1,45 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRegisterCommandType(t *testing.T) {
+	factory := func() Command { return &TestCommand{} }
+	if err := RegisterCommandType(factory); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	defer UnregisterCommandType("TestCommand")
+	if err := RegisterCommandType(factory); err != ErrCommandAlreadyRegistered {
+		t.Error("there should be a ErrCommandAlreadyRegistered error:", err)
+	}
+
+	command, err := CreateCommand("TestCommand")
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, ok := command.(*TestCommand); !ok {
+		t.Error("the command should be correct:", command)
+	}
+	if _, err := CreateCommand("TestCommand2"); err != ErrCommandNotRegistered {
+		t.Error("there should be a ErrCommandNotRegistered error:", err)
+	}
+	if commandTypes := CommandTypes(); !reflect.DeepEqual(commandTypes, []string{"TestCommand"}) {
+		t.Error("the command types should be correct:", commandTypes)
+	}
+}
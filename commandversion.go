@@ -0,0 +1,99 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"errors"
+)
+
+// ErrCommandVersionNotRegistered is when a version of a command type is not
+// registered.
+var ErrCommandVersionNotRegistered = errors.New("command version is not registered")
+
+// CommandUpcaster upcasts a command of an old version to the next version.
+type CommandUpcaster func(Command) (Command, error)
+
+type commandVersion struct {
+	factory  func() Command
+	upcaster CommandUpcaster
+}
+
+// Old versions of command types, by type and version-1.
+var commandVersions = make(map[string][]commandVersion)
+
+// RegisterCommandVersion registers a factory of an old version of a command
+// type, with an upcaster to the next version, so that clients can keep sending
+// old commands after the command struct has evolved. Versions are registered
+// in order from 1, and the current version is the one after the last
+// registered old version, which is created by the factory registered with
+// RegisterCommandType. The old struct returns the same command type.
+//
+// An example would be:
+//     RegisterCommandVersion(1, func() Command { return &CreateInviteV1{} }, UpcastCreateInviteV1)
+func RegisterCommandVersion(version int, factory func() Command, upcaster CommandUpcaster) error {
+	commandType := factory().CommandType()
+
+	commandFactoriesMu.Lock()
+	defer commandFactoriesMu.Unlock()
+	versions := commandVersions[commandType]
+	if version <= len(versions) {
+		return ErrCommandAlreadyRegistered
+	} else if version != len(versions)+1 {
+		return ErrCommandVersionNotRegistered
+	}
+	commandVersions[commandType] = append(versions, commandVersion{factory, upcaster})
+	return nil
+}
+
+// UnregisterCommandVersions removes the old versions of a command type.
+func UnregisterCommandVersions(commandType string) {
+	commandFactoriesMu.Lock()
+	defer commandFactoriesMu.Unlock()
+	delete(commandVersions, commandType)
+}
+
+// CommandVersion returns the current version of a command type, which is 1 for
+// command types without old versions.
+func CommandVersion(commandType string) int {
+	commandFactoriesMu.RLock()
+	defer commandFactoriesMu.RUnlock()
+	return len(commandVersions[commandType]) + 1
+}
+
+// UnmarshalCommandVersion unmarshals data of a version of a command type with a
+// codec, as UnmarshalCommand, and upcasts old versions to the current version.
+// Returns ErrCommandVersionNotRegistered for unknown versions.
+func UnmarshalCommandVersion(codec CommandCodec, commandType string, version int, data []byte) (Command, error) {
+	commandFactoriesMu.RLock()
+	versions := commandVersions[commandType]
+	commandFactoriesMu.RUnlock()
+	if version == len(versions)+1 {
+		return UnmarshalCommand(codec, commandType, data)
+	} else if version < 1 || version > len(versions) {
+		return nil, ErrCommandVersionNotRegistered
+	}
+
+	command := versions[version-1].factory()
+	if err := codec.UnmarshalCommand(data, command); err != nil {
+		return nil, err
+	}
+	for _, v := range versions[version-1:] {
+		var err error
+		if command, err = v.upcaster(command); err != nil {
+			return nil, err
+		}
+	}
+	return command, nil
+}
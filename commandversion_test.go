@@ -0,0 +1,105 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestCommandVersion(t *testing.T) {
+	if err := RegisterCommandType(func() Command { return &TestCommand{} }); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	defer UnregisterCommandType("TestCommand")
+	defer UnregisterCommandVersions("TestCommand")
+	if version := CommandVersion("TestCommand"); version != 1 {
+		t.Error("the version should be 1 without old versions:", version)
+	}
+
+	t.Log("register old versions")
+	if err := RegisterCommandVersion(2, func() Command { return &TestCommandV2{} }, nil); err != ErrCommandVersionNotRegistered {
+		t.Error("there should be a ErrCommandVersionNotRegistered error:", err)
+	}
+	if err := RegisterCommandVersion(1, func() Command { return &TestCommandV1{} },
+		func(c Command) (Command, error) {
+			v1 := c.(*TestCommandV1)
+			return &TestCommandV2{TestID: UUID(v1.ID), Text: v1.Text}, nil
+		}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := RegisterCommandVersion(2, func() Command { return &TestCommandV2{} },
+		func(c Command) (Command, error) {
+			v2 := c.(*TestCommandV2)
+			return &TestCommand{TestID: v2.TestID, Content: v2.Text}, nil
+		}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := RegisterCommandVersion(1, func() Command { return &TestCommandV1{} }, nil); err != ErrCommandAlreadyRegistered {
+		t.Error("there should be a ErrCommandAlreadyRegistered error:", err)
+	}
+	if version := CommandVersion("TestCommand"); version != 3 {
+		t.Error("the version should be 3:", version)
+	}
+
+	t.Log("upcast an old version")
+	id := NewUUID()
+	command, err := UnmarshalCommandVersion(jsonCodec{}, "TestCommand", 1,
+		[]byte(`{"ID":"`+id.String()+`","Text":"content"}`))
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	expected := &TestCommand{TestID: id, Content: "content"}
+	if !reflect.DeepEqual(command, expected) {
+		t.Error("the command should be upcast:", command)
+	}
+
+	t.Log("unmarshal the current version")
+	data, _ := json.Marshal(expected)
+	if command, err = UnmarshalCommandVersion(jsonCodec{}, "TestCommand", 3, data); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(command, expected) {
+		t.Error("the command should be correct:", command)
+	}
+	if _, err := UnmarshalCommandVersion(jsonCodec{}, "TestCommand", 4, data); err != ErrCommandVersionNotRegistered {
+		t.Error("there should be a ErrCommandVersionNotRegistered error:", err)
+	}
+}
+
+type TestCommandV1 struct {
+	ID   string
+	Text string
+}
+
+func (t *TestCommandV1) AggregateID() UUID     { return UUID(t.ID) }
+func (t *TestCommandV1) AggregateType() string { return "TestAggregate" }
+func (t *TestCommandV1) CommandType() string   { return "TestCommand" }
+
+type TestCommandV2 struct {
+	TestID UUID
+	Text   string
+}
+
+func (t *TestCommandV2) AggregateID() UUID     { return t.TestID }
+func (t *TestCommandV2) AggregateType() string { return "TestAggregate" }
+func (t *TestCommandV2) CommandType() string   { return "TestCommand" }
+
+func (jsonCodec) MarshalCommand(command Command) ([]byte, error) { return json.Marshal(command) }
+
+func (jsonCodec) UnmarshalCommand(data []byte, command Command) error {
+	return json.Unmarshal(data, command)
+}
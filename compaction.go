@@ -0,0 +1,143 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"strconv"
+)
+
+// archivedVersionHeader is the header with the version that an archived event
+// had in the compacted store.
+const archivedVersionHeader = "archived_version"
+
+// CompactableEventStore is an event store that can be compacted by a Compactor.
+type CompactableEventStore interface {
+	TruncatableEventStore
+
+	// LoadEnvelopes loads all events for the aggregate id in envelopes with
+	// their versions, timestamps and headers.
+	LoadEnvelopes(UUID) ([]EventEnvelope, error)
+}
+
+// Compactor moves the events of aggregates that are older than their latest
+// snapshots from an event store to an archive, to keep the store small. The
+// events are not lost, and ArchivedEventStore can load the full streams.
+type Compactor struct {
+	store     CompactableEventStore
+	archive   MetadataEventStore
+	snapshots SnapshotStore
+}
+
+// NewCompactor creates a Compactor. The store must use the same snapshot store
+// for checking before truncating.
+func NewCompactor(store CompactableEventStore, archive MetadataEventStore, snapshots SnapshotStore) *Compactor {
+	return &Compactor{
+		store:     store,
+		archive:   archive,
+		snapshots: snapshots,
+	}
+}
+
+// Compact archives the events of an aggregate before its latest snapshot and
+// then truncates them from the store. Events that were archived by a previous
+// call that failed to truncate are not archived again. Returns
+// ErrSnapshotNotFound if the aggregate has no snapshot.
+func (c *Compactor) Compact(id UUID) error {
+	snapshot, err := c.snapshots.LoadSnapshot(id)
+	if err != nil {
+		return err
+	}
+
+	envelopes, err := c.store.LoadEnvelopes(id)
+	if err != nil {
+		return err
+	}
+
+	// Find the last version that is already archived.
+	last := -1
+	archived, err := c.archive.LoadEnvelopes(id)
+	if err != nil && err != ErrNoEventsFound {
+		return err
+	}
+	if len(archived) > 0 {
+		headers := archived[len(archived)-1].Headers
+		if last, err = strconv.Atoi(headers[archivedVersionHeader]); err != nil {
+			return err
+		}
+	}
+
+	compacted := false
+	for _, envelope := range envelopes {
+		if envelope.Version >= snapshot.Version {
+			break
+		}
+		compacted = true
+		if envelope.Version <= last {
+			continue
+		}
+
+		// Keep the headers of the event, with the version it had.
+		headers := Headers{archivedVersionHeader: strconv.Itoa(envelope.Version)}
+		for k, v := range envelope.Headers {
+			headers[k] = v
+		}
+		ctx := NewContextWithHeaders(context.Background(), headers)
+		if err := c.archive.SaveWithContext(ctx, []Event{envelope.Event}); err != nil {
+			return err
+		}
+	}
+
+	if !compacted {
+		return nil
+	}
+	return c.store.TruncateBefore(id, snapshot.Version)
+}
+
+// ArchivedEventStore is an event store that loads the events of aggregates
+// from an archive followed by the events in the store, for replaying streams
+// that have been compacted. Events are saved in the store.
+type ArchivedEventStore struct {
+	store   EventStore
+	archive EventStore
+}
+
+// NewArchivedEventStore creates an ArchivedEventStore.
+func NewArchivedEventStore(store, archive EventStore) *ArchivedEventStore {
+	return &ArchivedEventStore{
+		store:   store,
+		archive: archive,
+	}
+}
+
+// Save implements the Save method of the EventStore interface.
+func (s *ArchivedEventStore) Save(events []Event) error {
+	return s.store.Save(events)
+}
+
+// Load implements the Load method of the EventStore interface.
+func (s *ArchivedEventStore) Load(id UUID) ([]Event, error) {
+	archived, err := s.archive.Load(id)
+	if err != nil && err != ErrNoEventsFound {
+		return nil, err
+	}
+	events, err := s.store.Load(id)
+	if err == ErrNoEventsFound && len(archived) > 0 {
+		return archived, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return append(archived, events...), nil
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// Divergence is where the streams of an aggregate in two event stores differ.
+// It is the first event that differs, with the hashes of the event in both
+// stores, where a missing event has an empty hash.
+type Divergence struct {
+	AggregateID UUID
+	Index       int
+	SourceHash  string
+	TargetHash  string
+}
+
+// HashStoredEvent returns a hash of a stored event, of its types, version,
+// timestamp, headers and data. The timestamp is in milliseconds, the precision
+// of most databases, and the data is hashed as JSON.
+func HashStoredEvent(event StoredEvent) (string, error) {
+	data, err := json.Marshal(struct {
+		Type          string
+		AggregateType string
+		AggregateID   UUID
+		Version       int
+		Timestamp     time.Time
+		Headers       Headers
+		Data          interface{}
+	}{
+		Type:          event.Type,
+		AggregateType: event.AggregateType,
+		AggregateID:   event.AggregateID,
+		Version:       event.Version,
+		Timestamp:     event.Timestamp.UTC().Truncate(time.Millisecond),
+		Headers:       event.Headers,
+		Data:          event.Data,
+	})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// CompareStores compares the streams of all aggregates in two event stores
+// event by event, for example after a migration or replication, and returns
+// the divergences in the order of the aggregate IDs. The events of each stream
+// are compared by their hashes up to the first event that differs.
+func CompareStores(ctx context.Context, source, target InspectableEventStore) ([]Divergence, error) {
+	sourceStreams, err := source.Streams(ctx)
+	if err != nil {
+		return nil, err
+	}
+	targetStreams, err := target.Streams(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Merge the streams, which are in the order of their IDs.
+	var ids []UUID
+	for i, j := 0, 0; i < len(sourceStreams) || j < len(targetStreams); {
+		switch {
+		case j == len(targetStreams) ||
+			(i < len(sourceStreams) && sourceStreams[i].AggregateID < targetStreams[j].AggregateID):
+			ids = append(ids, sourceStreams[i].AggregateID)
+			i++
+		case i == len(sourceStreams) || targetStreams[j].AggregateID < sourceStreams[i].AggregateID:
+			ids = append(ids, targetStreams[j].AggregateID)
+			j++
+		default:
+			ids = append(ids, sourceStreams[i].AggregateID)
+			i++
+			j++
+		}
+	}
+
+	var divergences []Divergence
+	for _, id := range ids {
+		sourceHashes, err := streamHashes(ctx, source, id)
+		if err != nil {
+			return nil, err
+		}
+		targetHashes, err := streamHashes(ctx, target, id)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := 0; i < len(sourceHashes) || i < len(targetHashes); i++ {
+			var d Divergence
+			if i < len(sourceHashes) {
+				d.SourceHash = sourceHashes[i]
+			}
+			if i < len(targetHashes) {
+				d.TargetHash = targetHashes[i]
+			}
+			if d.SourceHash != d.TargetHash {
+				d.AggregateID = id
+				d.Index = i
+				divergences = append(divergences, d)
+				break
+			}
+		}
+	}
+	return divergences, nil
+}
+
+// streamHashes returns the hashes of the events of an aggregate, or none if
+// there is no stream.
+func streamHashes(ctx context.Context, store InspectableEventStore, id UUID) ([]string, error) {
+	events, err := store.LoadStored(ctx, id)
+	if err == ErrNoEventsFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	hashes := make([]string, len(events))
+	for i, event := range events {
+		if hashes[i], err = HashStoredEvent(event); err != nil {
+			return nil, err
+		}
+	}
+	return hashes, nil
+}
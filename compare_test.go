@@ -0,0 +1,103 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCompareStores(t *testing.T) {
+	now := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	id1 := UUID("c1138e5f-f6fb-4dd0-8e79-255c6c8d3756")
+	id2 := UUID("c1138e5f-f6fb-4dd0-8e79-255c6c8d3757")
+	id3 := UUID("c1138e5f-f6fb-4dd0-8e79-255c6c8d3758")
+	event1 := StoredEvent{Type: "TestEvent", AggregateID: id1, Version: 1, Timestamp: now, Data: map[string]interface{}{"content": "event1"}}
+	event2 := StoredEvent{Type: "TestEvent", AggregateID: id1, Version: 2, Timestamp: now, Data: map[string]interface{}{"content": "event2"}}
+	event3 := StoredEvent{Type: "TestEvent", AggregateID: id2, Version: 1, Timestamp: now}
+	event4 := StoredEvent{Type: "TestEvent", AggregateID: id3, Version: 1, Timestamp: now}
+
+	t.Log("equal stores")
+	source := &mockInspectableEventStore{
+		streams: streamInfos(id1, id2),
+		events:  map[UUID][]StoredEvent{id1: {event1, event2}, id2: {event3}},
+	}
+	target := &mockInspectableEventStore{
+		streams: streamInfos(id1, id2),
+		events:  map[UUID][]StoredEvent{id1: {event1, event2}, id2: {event3}},
+	}
+	divergences, err := CompareStores(context.Background(), source, target)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(divergences) != 0 {
+		t.Error("there should be no divergences:", divergences)
+	}
+
+	t.Log("diverging stores")
+	changed := event2
+	changed.Data = map[string]interface{}{"content": "changed"}
+	target = &mockInspectableEventStore{
+		streams: streamInfos(id1, id3),
+		events:  map[UUID][]StoredEvent{id1: {event1, changed}, id3: {event4}},
+	}
+	divergences, err = CompareStores(context.Background(), source, target)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	hash2, _ := HashStoredEvent(event2)
+	hashChanged, _ := HashStoredEvent(changed)
+	hash3, _ := HashStoredEvent(event3)
+	hash4, _ := HashStoredEvent(event4)
+	expected := []Divergence{
+		{AggregateID: id1, Index: 1, SourceHash: hash2, TargetHash: hashChanged},
+		{AggregateID: id2, Index: 0, SourceHash: hash3},
+		{AggregateID: id3, Index: 0, TargetHash: hash4},
+	}
+	if !reflect.DeepEqual(divergences, expected) {
+		t.Error("the divergences should be correct:", divergences)
+	}
+}
+
+func TestHashStoredEvent(t *testing.T) {
+	now := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	event := StoredEvent{Type: "TestEvent", Version: 1, Timestamp: now}
+	hash1, err := HashStoredEvent(event)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("the timestamp is hashed in milliseconds")
+	event.Timestamp = now.Add(time.Microsecond)
+	if hash2, _ := HashStoredEvent(event); hash2 != hash1 {
+		t.Error("the hashes should be equal:", hash1, hash2)
+	}
+
+	t.Log("different data gives different hashes")
+	event.Data = "data"
+	if hash2, _ := HashStoredEvent(event); hash2 == hash1 {
+		t.Error("the hashes should differ:", hash1, hash2)
+	}
+}
+
+func streamInfos(ids ...UUID) []StreamInfo {
+	streams := make([]StreamInfo, len(ids))
+	for i, id := range ids {
+		streams[i] = StreamInfo{AggregateID: id}
+	}
+	return streams
+}
@@ -0,0 +1,181 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+)
+
+// FallibleEventPublisher is an optional interface for event buses that can
+// return the error of publishing an event, for example when the broker can not
+// be reached.
+type FallibleEventPublisher interface {
+	// TryPublishEvent publishes an event with the headers of the context, and
+	// returns the error if it could not be published.
+	TryPublishEvent(context.Context, Event) error
+}
+
+// TryPublishEvent publishes an event on a bus with the headers of the context,
+// and returns the error of publishing if the bus implements
+// FallibleEventPublisher. Other buses never fail.
+func TryPublishEvent(ctx context.Context, bus EventBus, event Event) error {
+	if p, ok := bus.(FallibleEventPublisher); ok {
+		return p.TryPublishEvent(ctx, event)
+	}
+	PublishEventWithContext(ctx, bus, event)
+	return nil
+}
+
+// ErrorPolicy is how a CompositeEventBus handles the errors of publishing to
+// one of its buses.
+type ErrorPolicy int
+
+const (
+	// LogErrors logs the errors of the bus and publishes to the next bus.
+	LogErrors ErrorPolicy = iota
+	// ReturnErrors returns the errors of the bus after publishing to the
+	// rest of the buses.
+	ReturnErrors
+	// StopOnErrors returns the errors of the bus without publishing to the
+	// rest of the buses.
+	StopOnErrors
+)
+
+// CompositeError is the errors of the buses of a CompositeEventBus that an
+// event could not be published to, in the order of the buses.
+type CompositeError struct {
+	Errors []error
+}
+
+// Error implements the Error method of the error interface.
+func (e *CompositeError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return "could not publish to all buses: " + strings.Join(msgs, "; ")
+}
+
+// Is returns true if any of the errors matches the target, for errors.Is.
+func (e *CompositeError) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// CompositeEventBus publishes every event to several buses in order, for
+// example to both the old and the new broker during a migration. Each bus has
+// an error policy for when publishing to it fails, which needs buses that
+// implement FallibleEventPublisher.
+//
+// Handlers are added to the first bus only, as they would otherwise handle the
+// events once per bus. Handlers of the other buses are added to them directly.
+type CompositeEventBus struct {
+	buses []compositeBus
+	mu    sync.RWMutex
+}
+
+type compositeBus struct {
+	bus    EventBus
+	policy ErrorPolicy
+}
+
+// NewCompositeEventBus creates a CompositeEventBus with a first bus and its
+// error policy.
+func NewCompositeEventBus(bus EventBus, policy ErrorPolicy) *CompositeEventBus {
+	return &CompositeEventBus{
+		buses: []compositeBus{{bus, policy}},
+	}
+}
+
+// AddBus adds a bus that events are published to after the buses before it.
+func (b *CompositeEventBus) AddBus(bus EventBus, policy ErrorPolicy) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buses = append(b.buses, compositeBus{bus, policy})
+}
+
+// PublishEvent implements the PublishEvent method of the EventBus interface.
+// The errors of buses that return or stop on errors are logged.
+func (b *CompositeEventBus) PublishEvent(event Event) {
+	b.PublishEventWithContext(context.Background(), event)
+}
+
+// PublishEventWithContext implements the PublishEventWithContext method of the
+// ContextEventPublisher interface.
+func (b *CompositeEventBus) PublishEventWithContext(ctx context.Context, event Event) {
+	if err := b.TryPublishEvent(ctx, event); err != nil {
+		log.Printf("error: composite event bus: could not publish %s: %v\n", event.EventType(), err)
+	}
+}
+
+// TryPublishEvent implements the TryPublishEvent method of the
+// FallibleEventPublisher interface. It returns a *CompositeError with the
+// errors of the buses that return or stop on errors.
+func (b *CompositeEventBus) TryPublishEvent(ctx context.Context, event Event) error {
+	b.mu.RLock()
+	buses := b.buses
+	b.mu.RUnlock()
+
+	var errs []error
+	for _, c := range buses {
+		err := TryPublishEvent(ctx, c.bus, event)
+		if err == nil {
+			continue
+		}
+		if c.policy == LogErrors {
+			log.Printf("error: composite event bus: could not publish %s: %v\n", event.EventType(), err)
+			continue
+		}
+		errs = append(errs, err)
+		if c.policy == StopOnErrors {
+			break
+		}
+	}
+	if len(errs) > 0 {
+		return &CompositeError{Errors: errs}
+	}
+	return nil
+}
+
+// AddHandler implements the AddHandler method of the EventBus interface.
+func (b *CompositeEventBus) AddHandler(handler EventHandler, event Event) {
+	b.first().AddHandler(handler, event)
+}
+
+// AddLocalHandler implements the AddLocalHandler method of the EventBus
+// interface.
+func (b *CompositeEventBus) AddLocalHandler(handler EventHandler) {
+	b.first().AddLocalHandler(handler)
+}
+
+// AddGlobalHandler implements the AddGlobalHandler method of the EventBus
+// interface.
+func (b *CompositeEventBus) AddGlobalHandler(handler EventHandler) {
+	b.first().AddGlobalHandler(handler)
+}
+
+func (b *CompositeEventBus) first() EventBus {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.buses[0].bus
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCompositeEventBus(t *testing.T) {
+	ctx := context.Background()
+	errFirst := errors.New("first")
+	errSecond := errors.New("second")
+	first := &fallibleEventBus{}
+	second := &fallibleEventBus{}
+	third := &MockEventBus{}
+	bus := NewCompositeEventBus(first, StopOnErrors)
+	bus.AddBus(second, ReturnErrors)
+	bus.AddBus(third, LogErrors)
+
+	t.Log("publish to all buses")
+	event1 := &TestEvent{NewUUID(), "event1"}
+	if err := bus.TryPublishEvent(ctx, event1); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	expected := []Event{event1}
+	if !reflect.DeepEqual(first.events, expected) ||
+		!reflect.DeepEqual(second.events, expected) ||
+		!reflect.DeepEqual(third.Events, expected) {
+		t.Error("the event should be published to all buses")
+	}
+
+	t.Log("return the error of a bus and publish to the rest")
+	second.err = errSecond
+	event2 := &TestEvent{NewUUID(), "event2"}
+	err := bus.TryPublishEvent(ctx, event2)
+	if !errors.Is(err, errSecond) {
+		t.Error("there should be an error:", err)
+	}
+	if !reflect.DeepEqual(third.Events, []Event{event1, event2}) {
+		t.Error("the event should be published to the last bus:", third.Events)
+	}
+
+	t.Log("stop on the error of a bus")
+	first.err = errFirst
+	event3 := &TestEvent{NewUUID(), "event3"}
+	err = bus.TryPublishEvent(ctx, event3)
+	if !reflect.DeepEqual(err, &CompositeError{Errors: []error{errFirst}}) {
+		t.Error("there should be only the first error:", err)
+	}
+	if len(second.events) != 1 || len(third.Events) != 2 {
+		t.Error("the event should not be published to the rest of the buses")
+	}
+
+	t.Log("add handlers to the first bus")
+	bus.AddGlobalHandler(NewEventHandlerFunc(func(Event) {}))
+	if first.handlers != 1 || second.handlers != 0 {
+		t.Error("the handler should only be added to the first bus")
+	}
+}
+
+type fallibleEventBus struct {
+	events   []Event
+	err      error
+	handlers int
+}
+
+func (b *fallibleEventBus) PublishEvent(event Event) {
+	b.TryPublishEvent(context.Background(), event)
+}
+
+func (b *fallibleEventBus) TryPublishEvent(ctx context.Context, event Event) error {
+	if b.err != nil {
+		return b.err
+	}
+	b.events = append(b.events, event)
+	return nil
+}
+
+func (b *fallibleEventBus) AddHandler(handler EventHandler, event Event) { b.handlers++ }
+func (b *fallibleEventBus) AddLocalHandler(handler EventHandler)         { b.handlers++ }
+func (b *fallibleEventBus) AddGlobalHandler(handler EventHandler)        { b.handlers++ }
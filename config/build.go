@@ -0,0 +1,200 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"context"
+	"database/sql"
+
+	goredis "github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/looplab/eventhorizon"
+	bsoncodec "github.com/looplab/eventhorizon/codec/bson"
+	jsoncodec "github.com/looplab/eventhorizon/codec/json"
+	"github.com/looplab/eventhorizon/messaging/local"
+	redisbus "github.com/looplab/eventhorizon/messaging/redis"
+	"github.com/looplab/eventhorizon/storage/memory"
+	"github.com/looplab/eventhorizon/storage/mongodb"
+	"github.com/looplab/eventhorizon/storage/postgres"
+)
+
+// Components are the components built from a config.
+type Components struct {
+	EventBus   eventhorizon.EventBus
+	CommandBus eventhorizon.CommandBus
+	EventStore eventhorizon.EventStore
+	Repository *eventhorizon.CallbackRepository
+
+	config  *Config
+	closers []func()
+}
+
+// Build builds the components of a config. The components are closed with
+// Close, which also closes the connections opened for them.
+func Build(ctx context.Context, config *Config) (*Components, error) {
+	c := &Components{config: config}
+	if err := c.build(ctx); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Components) build(ctx context.Context) error {
+	var err error
+	if c.EventBus, err = c.newEventBus(); err != nil {
+		return err
+	}
+	if c.CommandBus, err = c.newCommandBus(); err != nil {
+		return err
+	}
+	if c.EventStore, err = c.newEventStore(ctx); err != nil {
+		return err
+	}
+	c.Repository, err = eventhorizon.NewCallbackRepository(c.EventStore)
+	return err
+}
+
+// NewReadRepository creates a read repository of a collection, with the
+// backend of the read repository of the config.
+func (c *Components) NewReadRepository(collection string) (eventhorizon.ReadRepository, error) {
+	cfg := c.config.ReadRepository
+	switch cfg.Backend {
+	case "", "memory":
+		return memory.NewReadRepository(), nil
+	case "mongodb":
+		r, err := mongodb.NewReadRepository(cfg.URL, cfg.Database, collection, mongoOptions(cfg)...)
+		if err != nil {
+			return nil, err
+		}
+		c.closers = append(c.closers, r.Close)
+		return r, nil
+	}
+	return nil, &Error{Err: ErrUnknownBackend, Field: "read_repository.backend", Value: cfg.Backend}
+}
+
+// Close closes the components and their connections, in reverse order.
+func (c *Components) Close() {
+	for i := len(c.closers) - 1; i >= 0; i-- {
+		c.closers[i]()
+	}
+	c.closers = nil
+}
+
+func (c *Components) newEventBus() (eventhorizon.EventBus, error) {
+	cfg := c.config.EventBus
+	switch cfg.Backend {
+	case "", "local":
+		return local.NewEventBus(), nil
+	case "redis":
+		var options []redisbus.Option
+		switch c.config.Codec {
+		case "", "bson":
+		case "json":
+			options = append(options, redisbus.WithDefaultEventCodec(jsoncodec.ContentType, jsoncodec.EventCodec{}))
+		default:
+			return nil, &Error{Err: ErrUnknownCodec, Field: "codec", Value: c.config.Codec}
+		}
+		if c.config.Retry.Attempts > 0 {
+			options = append(options, redisbus.WithRetry(c.config.Retry.Backoff(), nil))
+		}
+		b, err := redisbus.NewEventBus(cfg.AppID, cfg.Address, cfg.Password, options...)
+		if err != nil {
+			return nil, err
+		}
+		c.closers = append(c.closers, b.Close)
+		return b, nil
+	}
+	return nil, &Error{Err: ErrUnknownBackend, Field: "event_bus.backend", Value: cfg.Backend}
+}
+
+func (c *Components) newCommandBus() (eventhorizon.CommandBus, error) {
+	cfg := c.config.CommandBus
+	switch cfg.Backend {
+	case "", "local":
+		return local.NewCommandBus(), nil
+	case "redis":
+		var codec eventhorizon.CommandCodec
+		switch c.config.Codec {
+		case "", "bson":
+			codec = bsoncodec.CommandCodec{}
+		case "json":
+			codec = jsoncodec.CommandCodec{}
+		default:
+			return nil, &Error{Err: ErrUnknownCodec, Field: "codec", Value: c.config.Codec}
+		}
+		client := goredis.NewClient(&goredis.Options{
+			Addr:     cfg.Address,
+			Password: cfg.Password,
+		})
+		c.closers = append(c.closers, func() { client.Close() })
+		b := redisbus.NewCommandBus(cfg.AppID, client)
+		b.SetCodec(codec)
+		return b, nil
+	}
+	return nil, &Error{Err: ErrUnknownBackend, Field: "command_bus.backend", Value: cfg.Backend}
+}
+
+func (c *Components) newEventStore(ctx context.Context) (eventhorizon.EventStore, error) {
+	cfg := c.config.EventStore
+	switch cfg.Backend {
+	case "", "memory":
+		return memory.NewEventStore(c.EventBus), nil
+	case "mongodb":
+		s, err := mongodb.NewEventStore(c.EventBus, cfg.URL, cfg.Database,
+			mongodb.WithClientOptions(mongoOptions(cfg)...))
+		if err != nil {
+			return nil, err
+		}
+		c.closers = append(c.closers, s.Close)
+		return s, nil
+	case "postgres":
+		driver := cfg.Driver
+		if driver == "" {
+			driver = "postgres"
+		}
+		db, err := sql.Open(driver, cfg.URL)
+		if err != nil {
+			return nil, err
+		}
+		c.closers = append(c.closers, func() { db.Close() })
+		s, err := postgres.NewEventStore(c.EventBus, db, eventhorizon.SystemClock{})
+		if err != nil {
+			return nil, err
+		}
+		if cfg.Table != "" {
+			s.SetTable(cfg.Table)
+		}
+		if cfg.CreateTables {
+			if err := s.CreateTables(ctx); err != nil {
+				return nil, err
+			}
+		}
+		return s, nil
+	}
+	return nil, &Error{Err: ErrUnknownBackend, Field: "event_store.backend", Value: cfg.Backend}
+}
+
+// mongoOptions returns the client options with the credentials of a store.
+func mongoOptions(cfg Store) []*options.ClientOptions {
+	if cfg.Username == "" {
+		return nil
+	}
+	return []*options.ClientOptions{options.Client().SetAuth(options.Credential{
+		Username: cfg.Username,
+		Password: cfg.Password,
+	})}
+}
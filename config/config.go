@@ -0,0 +1,252 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package config constructs the buses, stores and repositories of a service
+// from a declarative config, so that the backends can be switched per
+// environment without changing the code. A config is read from JSON and
+// environment variables, for example:
+//     cfg, err := config.LoadFile("eventhorizon.json")
+//     if err := cfg.LoadEnv("EH"); err != nil { ... }
+//     c, err := config.Build(ctx, cfg)
+//     defer c.Close()
+// where EH_EVENT_STORE_BACKEND=postgres selects the PostgreSQL event store. The
+// PostgreSQL driver is not imported, it has to be registered by the service.
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/looplab/eventhorizon"
+)
+
+// ErrUnknownBackend is when a component has a backend that is not supported.
+var ErrUnknownBackend = errors.New("unknown backend")
+
+// ErrUnknownCodec is when the codec is not supported.
+var ErrUnknownCodec = errors.New("unknown codec")
+
+// ErrInvalidValue is when a value of an environment variable can not be parsed.
+var ErrInvalidValue = errors.New("invalid value")
+
+// Error is an error of a field of a config, with the value of it.
+type Error struct {
+	// Err is the sentinel error.
+	Err error
+	// Field is the field, as its path of JSON keys.
+	Field string
+	// Value is the value of the field.
+	Value string
+}
+
+// Error implements the Error method of the error interface.
+func (e *Error) Error() string {
+	return e.Err.Error() + ": " + e.Field + " " + strconv.Quote(e.Value)
+}
+
+// Is returns true if the target is the sentinel error, for errors.Is.
+func (e *Error) Is(target error) bool {
+	return e.Err == target
+}
+
+// Config is the config of the components of a service. Empty fields use the
+// defaults of the components, and with an empty config everything is in
+// memory.
+type Config struct {
+	EventBus       Bus   `json:"event_bus"`
+	CommandBus     Bus   `json:"command_bus"`
+	EventStore     Store `json:"event_store"`
+	ReadRepository Store `json:"read_repository"`
+
+	// Codec is the codec of events and commands sent by the Redis buses,
+	// "bson" (the default) or "json". The stores use their own formats.
+	Codec string `json:"codec"`
+
+	// Retry is the retry policy of handlers of the Redis event bus, see
+	// eventhorizon.Backoff. Handlers are not retried if no attempts are set.
+	Retry Retry `json:"retry"`
+}
+
+// Bus is the config of an event or command bus.
+type Bus struct {
+	// Backend is "local" (the default) or "redis".
+	Backend  string `json:"backend"`
+	AppID    string `json:"app_id"`
+	Address  string `json:"address"`
+	Password string `json:"password"`
+}
+
+// Store is the config of an event store or read repository.
+type Store struct {
+	// Backend is "memory" (the default), "mongodb" or "postgres". There is no
+	// PostgreSQL read repository.
+	Backend string `json:"backend"`
+	// URL is the URL of MongoDB or the data source name of PostgreSQL.
+	URL      string `json:"url"`
+	Database string `json:"database"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// Driver is the database/sql driver of PostgreSQL, "postgres" by default.
+	Driver string `json:"driver"`
+	// Table is the table of the PostgreSQL event store.
+	Table string `json:"table"`
+	// CreateTables creates the tables of the PostgreSQL event store if they
+	// do not exist.
+	CreateTables bool `json:"create_tables"`
+}
+
+// Retry is the config of a retry policy.
+type Retry struct {
+	Attempts   int      `json:"attempts"`
+	Initial    Duration `json:"initial"`
+	Max        Duration `json:"max"`
+	Multiplier float64  `json:"multiplier"`
+	Jitter     float64  `json:"jitter"`
+}
+
+// Backoff returns the retry policy as a backoff.
+func (r Retry) Backoff() eventhorizon.Backoff {
+	return eventhorizon.Backoff{
+		Attempts:   r.Attempts,
+		Initial:    time.Duration(r.Initial),
+		Max:        time.Duration(r.Max),
+		Multiplier: r.Multiplier,
+		Jitter:     r.Jitter,
+	}
+}
+
+// Duration is a time.Duration written as a string in JSON, such as "100ms".
+type Duration time.Duration
+
+// MarshalJSON implements the MarshalJSON method of the json.Marshaler
+// interface.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON implements the UnmarshalJSON method of the json.Unmarshaler
+// interface.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Load reads a config from JSON. Unknown fields are an error, to catch typos.
+func Load(r io.Reader) (*Config, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	c := &Config{}
+	if err := dec.Decode(c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// LoadFile reads a config from a JSON file.
+func LoadFile(name string) (*Config, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Load(f)
+}
+
+// LoadEnv overrides the fields of the config with the environment variables
+// that are set. The name of the variable of a field is the prefix and the path
+// of its JSON keys in upper case, for example EH_EVENT_STORE_URL for the URL
+// of the event store with the prefix "EH".
+func (c *Config) LoadEnv(prefix string) error {
+	return loadEnv(reflect.ValueOf(c).Elem(), prefix, "")
+}
+
+var durationType = reflect.TypeOf(Duration(0))
+
+func loadEnv(v reflect.Value, env, field string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		key := t.Field(i).Tag.Get("json")
+		name := env + "_" + strings.ToUpper(key)
+		path := key
+		if field != "" {
+			path = field + "." + key
+		}
+
+		f := v.Field(i)
+		if f.Kind() == reflect.Struct {
+			if err := loadEnv(f, name, path); err != nil {
+				return err
+			}
+			continue
+		}
+
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := setValue(f, value); err != nil {
+			return &Error{Err: ErrInvalidValue, Field: path, Value: value}
+		}
+	}
+	return nil
+}
+
+func setValue(f reflect.Value, value string) error {
+	if f.Type() == durationType {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		f.SetInt(int64(d))
+		return nil
+	}
+
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		f.SetInt(int64(n))
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		f.SetFloat(n)
+	}
+	return nil
+}
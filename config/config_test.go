@@ -0,0 +1,125 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/looplab/eventhorizon/messaging/local"
+	"github.com/looplab/eventhorizon/storage/memory"
+)
+
+func TestLoad(t *testing.T) {
+	t.Log("load from JSON")
+	c, err := Load(strings.NewReader(`{
+		"event_bus": {"backend": "redis", "app_id": "app", "address": "localhost:6379"},
+		"event_store": {"backend": "postgres", "url": "postgres://localhost/app", "create_tables": true},
+		"codec": "json",
+		"retry": {"attempts": 3, "initial": "100ms", "max": "1s"}
+	}`))
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	expected := &Config{
+		EventBus:   Bus{Backend: "redis", AppID: "app", Address: "localhost:6379"},
+		EventStore: Store{Backend: "postgres", URL: "postgres://localhost/app", CreateTables: true},
+		Codec:      "json",
+		Retry:      Retry{Attempts: 3, Initial: Duration(100 * time.Millisecond), Max: Duration(time.Second)},
+	}
+	if !reflect.DeepEqual(c, expected) {
+		t.Error("the config should be correct:", c)
+	}
+
+	t.Log("load with an unknown field")
+	if _, err := Load(strings.NewReader(`{"event_buss": {}}`)); err == nil {
+		t.Error("there should be an error")
+	}
+
+	t.Log("override with environment variables")
+	t.Setenv("EH_EVENT_STORE_BACKEND", "mongodb")
+	t.Setenv("EH_EVENT_STORE_CREATE_TABLES", "false")
+	t.Setenv("EH_RETRY_MAX", "2s")
+	t.Setenv("EH_RETRY_JITTER", "0.5")
+	if err := c.LoadEnv("EH"); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	expected.EventStore.Backend = "mongodb"
+	expected.EventStore.CreateTables = false
+	expected.Retry.Max = Duration(2 * time.Second)
+	expected.Retry.Jitter = 0.5
+	if !reflect.DeepEqual(c, expected) {
+		t.Error("the config should be correct:", c)
+	}
+
+	t.Log("override with an invalid value")
+	t.Setenv("EH_RETRY_ATTEMPTS", "many")
+	err = c.LoadEnv("EH")
+	if !errors.Is(err, ErrInvalidValue) {
+		t.Error("there should be a ErrInvalidValue error:", err)
+	}
+	if e, ok := err.(*Error); !ok || e.Field != "retry.attempts" {
+		t.Error("the error should have the field:", err)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	ctx := context.Background()
+
+	t.Log("build the defaults")
+	c, err := Build(ctx, &Config{})
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer c.Close()
+	if _, ok := c.EventBus.(*local.EventBus); !ok {
+		t.Error("the event bus should be local:", c.EventBus)
+	}
+	if _, ok := c.CommandBus.(*local.CommandBus); !ok {
+		t.Error("the command bus should be local:", c.CommandBus)
+	}
+	if _, ok := c.EventStore.(*memory.EventStore); !ok {
+		t.Error("the event store should be in memory:", c.EventStore)
+	}
+	if c.Repository == nil {
+		t.Error("there should be a repository")
+	}
+	repo, err := c.NewReadRepository("invitations")
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, ok := repo.(*memory.ReadRepository); !ok {
+		t.Error("the read repository should be in memory:", repo)
+	}
+
+	t.Log("build an unknown backend")
+	_, err = Build(ctx, &Config{EventStore: Store{Backend: "cassandra"}})
+	if !errors.Is(err, ErrUnknownBackend) {
+		t.Error("there should be a ErrUnknownBackend error:", err)
+	}
+	if err != nil && err.Error() != `unknown backend: event_store.backend "cassandra"` {
+		t.Error("the error message should be correct:", err)
+	}
+
+	t.Log("build an unknown codec")
+	_, err = Build(ctx, &Config{EventBus: Bus{Backend: "redis"}, Codec: "xml"})
+	if !errors.Is(err, ErrUnknownCodec) {
+		t.Error("there should be a ErrUnknownCodec error:", err)
+	}
+}
@@ -0,0 +1,271 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package dashboard is an HTTP UI for the operational state of an app: recent
+// events, the lag of projections, the contents of the dead letter store, the
+// streams of aggregates, and the topology of the handlers. It only reads, and is meant to be served on an
+// internal port, for example:
+//     d := dashboard.New(eventStore)
+//     d.SetDeadLetterStore(deadLetterStore)
+//     d.AddProjection("invitations", invitationPosition)
+//     http.Handle("/dashboard/", http.StripPrefix("/dashboard", d))
+package dashboard
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/looplab/eventhorizon"
+)
+
+// MaxLag is the most events counted when computing the lag of a projection.
+const MaxLag = 10000
+
+// PositionFunc returns the position in the stream of all events that a
+// projection has handled events up to.
+type PositionFunc func(context.Context) (eventhorizon.Position, error)
+
+// ProjectionStatus is the status of a projection on the dashboard.
+type ProjectionStatus struct {
+	Name     string
+	Position eventhorizon.Position
+	// Lag is the number of events saved after the position, up to MaxLag, or
+	// -1 if it is not known.
+	Lag   int
+	Error string
+}
+
+// Dashboard is an http.Handler serving the dashboard of an event store.
+type Dashboard struct {
+	store        eventhorizon.InspectableEventStore
+	deadLetters  eventhorizon.DeadLetterStore
+	topology     *eventhorizon.Topology
+	projections  map[string]PositionFunc
+	recentWindow time.Duration
+	recentLimit  int
+	clock        eventhorizon.Clock
+	mu           sync.RWMutex
+}
+
+// New creates a new Dashboard for an event store. Recent events are shown if
+// the store is an eventhorizon.QueryableEventStore, and the lag of projections
+// if it is an eventhorizon.GlobalEventStore. The clock is used for finding
+// recent events.
+func New(store eventhorizon.InspectableEventStore, clock eventhorizon.Clock) *Dashboard {
+	return &Dashboard{
+		store:        store,
+		projections:  make(map[string]PositionFunc),
+		recentWindow: 24 * time.Hour,
+		recentLimit:  50,
+		clock:        clock,
+	}
+}
+
+// SetDeadLetterStore sets the dead letter store to show the contents of.
+func (d *Dashboard) SetDeadLetterStore(store eventhorizon.DeadLetterStore) {
+	d.deadLetters = store
+}
+
+// SetTopology sets the topology served at /topology, as a Mermaid flowchart
+// or as a Graphviz digraph with ?format=dot.
+func (d *Dashboard) SetTopology(topology *eventhorizon.Topology) {
+	d.topology = topology
+}
+
+// SetRecent sets how far back and how many of the recent events are shown,
+// 24 hours and 50 events by default.
+func (d *Dashboard) SetRecent(window time.Duration, limit int) {
+	d.recentWindow = window
+	d.recentLimit = limit
+}
+
+// AddProjection adds a projection to show the status of, with a function
+// returning its position.
+func (d *Dashboard) AddProjection(name string, position PositionFunc) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.projections[name] = position
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (d *Dashboard) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case parts[0] == "" && len(parts) == 1:
+		d.serveOverview(w, r)
+	case parts[0] == "streams" && len(parts) == 1:
+		d.serveStreams(w, r)
+	case parts[0] == "streams" && len(parts) == 2:
+		d.serveStream(w, r, eventhorizon.UUID(parts[1]))
+	case parts[0] == "deadletters" && len(parts) == 2 && d.deadLetters != nil:
+		d.serveDeadLetter(w, r, eventhorizon.UUID(parts[1]))
+	case parts[0] == "topology" && len(parts) == 1 && d.topology != nil:
+		d.serveTopology(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+type overview struct {
+	Projections []ProjectionStatus
+	Recent      []eventhorizon.EventEnvelope
+	// HasRecent is false if the store can't find recent events.
+	HasRecent   bool
+	DeadLetters []*eventhorizon.DeadLetter
+	// HasDeadLetters is false if there is no dead letter store.
+	HasDeadLetters bool
+}
+
+func (d *Dashboard) serveOverview(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	o := overview{
+		Projections: d.ProjectionStatuses(ctx),
+	}
+
+	if s, ok := d.store.(eventhorizon.QueryableEventStore); ok {
+		o.HasRecent = true
+		events, err := s.FindEvents(ctx, eventhorizon.Query{
+			From: d.clock.Now().Add(-d.recentWindow),
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// The most recent events first.
+		for i := len(events) - 1; i >= 0 && len(o.Recent) < d.recentLimit; i-- {
+			o.Recent = append(o.Recent, events[i])
+		}
+	}
+
+	if d.deadLetters != nil {
+		o.HasDeadLetters = true
+		deadLetters, err := d.deadLetters.DeadLetters(ctx)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		o.DeadLetters = deadLetters
+	}
+
+	render(w, r, overviewTemplate, o)
+}
+
+// ProjectionStatuses returns the status of the projections, in the order of
+// their names.
+func (d *Dashboard) ProjectionStatuses(ctx context.Context) []ProjectionStatus {
+	d.mu.RLock()
+	projections := make(map[string]PositionFunc, len(d.projections))
+	names := make([]string, 0, len(d.projections))
+	for name, position := range d.projections {
+		projections[name] = position
+		names = append(names, name)
+	}
+	d.mu.RUnlock()
+	sort.Strings(names)
+
+	global, isGlobal := d.store.(eventhorizon.GlobalEventStore)
+	statuses := make([]ProjectionStatus, len(names))
+	for i, name := range names {
+		status := ProjectionStatus{Name: name, Lag: -1}
+		p, err := projections[name](ctx)
+		if err != nil {
+			status.Error = err.Error()
+		} else {
+			status.Position = p
+			if isGlobal {
+				events, _, err := global.LoadAll(ctx, p, MaxLag)
+				if err != nil {
+					status.Error = err.Error()
+				} else {
+					status.Lag = len(events)
+				}
+			}
+		}
+		statuses[i] = status
+	}
+	return statuses
+}
+
+func (d *Dashboard) serveStreams(w http.ResponseWriter, r *http.Request) {
+	streams, err := d.store.Streams(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	render(w, r, streamsTemplate, struct {
+		Streams []eventhorizon.StreamInfo
+	}{streams})
+}
+
+func (d *Dashboard) serveStream(w http.ResponseWriter, r *http.Request, id eventhorizon.UUID) {
+	events, err := d.store.LoadStored(r.Context(), id)
+	if err == eventhorizon.ErrNoEventsFound || (err == nil && len(events) == 0) {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	render(w, r, streamTemplate, struct {
+		ID     eventhorizon.UUID
+		Events []eventhorizon.StoredEvent
+	}{id, events})
+}
+
+func (d *Dashboard) serveDeadLetter(w http.ResponseWriter, r *http.Request, id eventhorizon.UUID) {
+	deadLetter, err := d.deadLetters.DeadLetter(r.Context(), id)
+	if err == eventhorizon.ErrDeadLetterNotFound {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	render(w, r, deadLetterTemplate, deadLetter)
+}
+
+// render executes a template into a response.
+func render(w http.ResponseWriter, r *http.Request, t *template.Template, data interface{}) {
+	root := "./"
+	if depth := strings.Count(strings.Trim(r.URL.Path, "/"), "/"); depth > 0 {
+		root = strings.Repeat("../", depth)
+	}
+
+	var b strings.Builder
+	if err := t.Execute(&b, page{root, data}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(b.String()))
+}
+
+func (d *Dashboard) serveTopology(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if r.URL.Query().Get("format") == "dot" {
+		d.topology.WriteDOT(w)
+		return
+	}
+	d.topology.WriteMermaid(w)
+}
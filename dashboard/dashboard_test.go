@@ -0,0 +1,135 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dashboard
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/storage/memory"
+	"github.com/looplab/eventhorizon/testutil"
+)
+
+func TestDashboard(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := testutil.NewMockClock(now)
+	store := memory.NewEventStore(nil, memory.WithClock(clock))
+	id := eventhorizon.UUID("c1138e5f-f6fb-4dd0-8e79-255c6c8d3756")
+	store.Save([]eventhorizon.Event{
+		&testutil.TestEvent{id, "event1"},
+		&testutil.TestEvent{id, "event2"},
+		&testutil.TestEventOther{id, "event3"},
+	})
+	deadLetters := memory.NewDeadLetterStore()
+	deadLetters.SaveDeadLetter(ctx, &eventhorizon.DeadLetter{
+		ID:        "d1",
+		EventType: "TestEvent",
+		Event:     &testutil.TestEvent{id, "event1"},
+		Reason:    "shed",
+		Timestamp: now,
+	})
+
+	d := New(store, clock)
+	d.SetDeadLetterStore(deadLetters)
+	d.AddProjection("tests", func(ctx context.Context) (eventhorizon.Position, error) {
+		return "1", nil
+	})
+	d.AddProjection("failing", func(ctx context.Context) (eventhorizon.Position, error) {
+		return "", errors.New("projection error")
+	})
+
+	t.Log("projection statuses")
+	statuses := d.ProjectionStatuses(ctx)
+	expected := []ProjectionStatus{
+		{Name: "failing", Lag: -1, Error: "projection error"},
+		{Name: "tests", Position: "1", Lag: 2},
+	}
+	if !reflect.DeepEqual(statuses, expected) {
+		t.Error("the statuses should be correct:", statuses)
+	}
+
+	t.Log("show the overview")
+	w := serve(d, "/")
+	if w.Code != http.StatusOK {
+		t.Error("the status should be correct:", w.Code)
+	}
+	for _, s := range []string{
+		"<td>tests</td><td>1</td><td>2</td><td>ok</td>",
+		`<span class="error">projection error</span>`,
+		`<td>TestEventOther</td><td><a href="./streams/` + string(id) + `">Test ` + string(id) + `</a></td><td>2</td>`,
+		`<a href="./deadletters/d1">d1</a>`,
+	} {
+		if !strings.Contains(w.Body.String(), s) {
+			t.Errorf("the overview should contain %q: %s", s, w.Body.String())
+		}
+	}
+
+	t.Log("show the streams")
+	w = serve(d, "/streams")
+	if !strings.Contains(w.Body.String(), `<a href="./streams/`+string(id)+`">`) {
+		t.Error("the streams should be listed:", w.Body.String())
+	}
+	w = serve(d, "/streams/"+string(id))
+	for _, s := range []string{
+		"<h3>0: TestEvent</h3>",
+		"<h3>2: TestEventOther</h3>",
+		`&#34;Content&#34;: &#34;event3&#34;`,
+		`<a href="../">Overview</a>`,
+	} {
+		if !strings.Contains(w.Body.String(), s) {
+			t.Errorf("the stream should contain %q: %s", s, w.Body.String())
+		}
+	}
+	if w := serve(d, "/streams/"+string(eventhorizon.NewUUID())); w.Code != http.StatusNotFound {
+		t.Error("the status should be correct:", w.Code)
+	}
+
+	t.Log("show a dead letter")
+	w = serve(d, "/deadletters/d1")
+	if !strings.Contains(w.Body.String(), "<p>TestEvent, shed, 2016-01-01T00:00:00Z</p>") {
+		t.Error("the dead letter should be shown:", w.Body.String())
+	}
+	if w := serve(d, "/deadletters/d2"); w.Code != http.StatusNotFound {
+		t.Error("the status should be correct:", w.Code)
+	}
+
+	t.Log("show the topology")
+	if w := serve(d, "/topology"); w.Code != http.StatusNotFound {
+		t.Error("the status should be correct:", w.Code)
+	}
+	topology := eventhorizon.NewTopology()
+	topology.AddEdge(eventhorizon.TopologyEdge{From: "TestEvent", To: "projector"})
+	d.SetTopology(topology)
+	if w := serve(d, "/topology"); !strings.Contains(w.Body.String(), `("TestEvent") --> `) {
+		t.Error("the flowchart should be shown:", w.Body.String())
+	}
+	if w := serve(d, "/topology?format=dot"); !strings.Contains(w.Body.String(), `"TestEvent" -> "projector";`) {
+		t.Error("the graph should be shown:", w.Body.String())
+	}
+}
+
+func serve(d *Dashboard, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	d.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	return w
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dashboard
+
+import (
+	"encoding/json"
+	"html/template"
+	"time"
+)
+
+// page is the data of a page, with the relative path to the root of the
+// dashboard for links.
+type page struct {
+	Root string
+	Data interface{}
+}
+
+var funcs = template.FuncMap{
+	"json": func(v interface{}) string {
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err.Error()
+		}
+		return string(data)
+	},
+	"time": func(t time.Time) string {
+		return t.UTC().Format(time.RFC3339)
+	},
+}
+
+const layout = `{{define "header"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Event Horizon</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border-bottom: 1px solid #ddd; padding: 0.3em 1em; text-align: left; }
+pre { background: #f4f4f4; padding: 1em; }
+.error { color: #c00; }
+</style>
+</head>
+<body>
+<p><a href="{{.Root}}">Overview</a> | <a href="{{.Root}}streams">Streams</a></p>
+{{end}}
+{{define "footer"}}</body>
+</html>
+{{end}}`
+
+var overviewTemplate = template.Must(template.New("overview").Funcs(funcs).Parse(layout + `{{template "header" .}}{{with .Data}}
+<h2>Projections</h2>
+<table>
+<tr><th>Name</th><th>Position</th><th>Lag</th><th>Status</th></tr>
+{{range .Projections}}<tr><td>{{.Name}}</td><td>{{.Position}}</td><td>{{if lt .Lag 0}}?{{else}}{{.Lag}}{{end}}</td><td>{{if .Error}}<span class="error">{{.Error}}</span>{{else}}ok{{end}}</td></tr>
+{{end}}</table>
+{{if .HasRecent}}<h2>Recent events</h2>
+<table>
+<tr><th>Time</th><th>Type</th><th>Aggregate</th><th>Version</th></tr>
+{{range .Recent}}<tr><td>{{time .Timestamp}}</td><td>{{.Event.EventType}}</td><td><a href="{{$.Root}}streams/{{.Event.AggregateID}}">{{.Event.AggregateType}} {{.Event.AggregateID}}</a></td><td>{{.Version}}</td></tr>
+{{end}}</table>
+{{end}}{{if .HasDeadLetters}}<h2>Dead letters</h2>
+<table>
+<tr><th>ID</th><th>Type</th><th>Reason</th><th>Time</th></tr>
+{{range .DeadLetters}}<tr><td><a href="{{$.Root}}deadletters/{{.ID}}">{{.ID}}</a></td><td>{{.EventType}}</td><td>{{.Reason}}</td><td>{{time .Timestamp}}</td></tr>
+{{end}}</table>
+{{end}}{{end}}{{template "footer"}}`))
+
+var streamsTemplate = template.Must(template.New("streams").Funcs(funcs).Parse(layout + `{{template "header" .}}{{with .Data}}
+<h2>Streams</h2>
+<table>
+<tr><th>Aggregate</th><th>Type</th><th>Version</th><th>Events</th><th></th></tr>
+{{range .Streams}}<tr><td><a href="{{$.Root}}streams/{{.AggregateID}}">{{.AggregateID}}</a></td><td>{{.AggregateType}}</td><td>{{.Version}}</td><td>{{.Events}}</td><td>{{if .Deleted}}deleted{{end}}</td></tr>
+{{end}}</table>
+{{end}}{{template "footer"}}`))
+
+var streamTemplate = template.Must(template.New("stream").Funcs(funcs).Parse(layout + `{{template "header" .}}{{with .Data}}
+<h2>Stream {{.ID}}</h2>
+{{range .Events}}<h3>{{.Version}}: {{.Type}}</h3>
+<p>{{time .Timestamp}}</p>
+{{if .Headers}}<pre>{{json .Headers}}</pre>
+{{end}}<pre>{{json .Data}}</pre>
+{{end}}{{end}}{{template "footer"}}`))
+
+var deadLetterTemplate = template.Must(template.New("deadletter").Funcs(funcs).Parse(layout + `{{template "header" .}}{{with .Data}}
+<h2>Dead letter {{.ID}}</h2>
+<p>{{.EventType}}, {{.Reason}}, {{time .Timestamp}}</p>
+{{if .Errors}}<ol>{{range .Errors}}<li>{{.}}</li>{{end}}</ol>
+{{end}}{{if .Headers}}<pre>{{json .Headers}}</pre>
+{{end}}<pre>{{if .Event}}{{json .Event}}{{else}}{{json .Data}}{{end}}</pre>
+{{end}}{{template "footer"}}`))
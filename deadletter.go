@@ -0,0 +1,135 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+// ErrDeadLetterNotFound is when a dead letter could not be found.
+var ErrDeadLetterNotFound = errors.New("could not find dead letter")
+
+// ErrDeadLetterNotDecoded is when the event of a dead letter could not be
+// decoded, usually because its type is not registered with the store.
+var ErrDeadLetterNotDecoded = errors.New("dead letter event not decoded")
+
+// DeadLetter is an event that could not be delivered, kept so that it can be
+// inspected and requeued after fixing the cause. The event is nil if its type
+// could not be decoded by the store, and the data is then kept as stored.
+// Errors are the errors of the failed delivery attempts, oldest first.
+type DeadLetter struct {
+	ID        UUID
+	EventType string
+	Event     Event
+	Data      interface{}
+	Headers   Headers
+	Reason    string
+	Errors    []string
+	Timestamp time.Time
+}
+
+// DeadLetterStore is a store of dead letters.
+type DeadLetterStore interface {
+	// SaveDeadLetter saves a dead letter.
+	SaveDeadLetter(context.Context, *DeadLetter) error
+
+	// DeadLetters returns all dead letters, oldest first.
+	DeadLetters(context.Context) ([]*DeadLetter, error)
+
+	// DeadLetter returns a dead letter. Returns ErrDeadLetterNotFound if there
+	// is none.
+	DeadLetter(context.Context, UUID) (*DeadLetter, error)
+
+	// RemoveDeadLetter removes a dead letter. Returns ErrDeadLetterNotFound if
+	// there is none.
+	RemoveDeadLetter(context.Context, UUID) error
+}
+
+// DeadLetterHandler is an event handler that saves the events it handles as
+// dead letters, for example as the dead letter handler of an event bus.
+type DeadLetterHandler struct {
+	store  DeadLetterStore
+	reason string
+	clock  Clock
+}
+
+// NewDeadLetterHandler creates a new DeadLetterHandler, which saves the events
+// with a reason. The clock is used to timestamp dead letters.
+func NewDeadLetterHandler(store DeadLetterStore, reason string, clock Clock) *DeadLetterHandler {
+	return &DeadLetterHandler{
+		store:  store,
+		reason: reason,
+		clock:  clock,
+	}
+}
+
+// HandleEvent implements the HandleEvent method of the EventHandler interface.
+func (h *DeadLetterHandler) HandleEvent(event Event) {
+	h.HandleEventWithContext(context.Background(), event)
+}
+
+// HandleEventWithContext saves the event with the headers and delivery errors
+// of the context.
+func (h *DeadLetterHandler) HandleEventWithContext(ctx context.Context, event Event) {
+	var errs []string
+	for _, err := range DeliveryErrorsFromContext(ctx) {
+		errs = append(errs, err.Error())
+	}
+	if err := h.store.SaveDeadLetter(ctx, &DeadLetter{
+		ID:        NewUUID(),
+		EventType: event.EventType(),
+		Event:     event,
+		Headers:   HeadersFromContext(ctx),
+		Reason:    h.reason,
+		Errors:    errs,
+		Timestamp: h.clock.Now(),
+	}); err != nil {
+		log.Printf("error: dead letter: could not save %s: %v\n", event.EventType(), err)
+	}
+}
+
+type deliveryErrorsKey struct{}
+
+// NewContextWithDeliveryErrors returns a context with the errors of failed
+// attempts to deliver an event, for passing them on to dead letter handlers.
+func NewContextWithDeliveryErrors(ctx context.Context, errs []error) context.Context {
+	return context.WithValue(ctx, deliveryErrorsKey{}, errs)
+}
+
+// DeliveryErrorsFromContext returns the delivery errors of a context, or nil
+// if there are none.
+func DeliveryErrorsFromContext(ctx context.Context) []error {
+	errs, _ := ctx.Value(deliveryErrorsKey{}).([]error)
+	return errs
+}
+
+// RequeueDeadLetter publishes a dead letter again on an event bus, with its
+// headers, and removes it from the store. Returns ErrDeadLetterNotDecoded if
+// the event of the dead letter could not be decoded by the store.
+func RequeueDeadLetter(ctx context.Context, store DeadLetterStore, bus EventBus, id UUID) error {
+	d, err := store.DeadLetter(ctx, id)
+	if err != nil {
+		return err
+	}
+	if d.Event == nil {
+		return ErrDeadLetterNotDecoded
+	}
+
+	PublishEventWithContext(NewContextWithHeaders(ctx, d.Headers), bus, d.Event)
+	return store.RemoveDeadLetter(ctx, id)
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrDuplicateCommand is when a command with the same ID has already been
+// handled.
+var ErrDuplicateCommand = errors.New("duplicate command")
+
+// DedupStore remembers the IDs of handled commands for a TTL, so that commands
+// that are sent more than once, for example when a client retries after a
+// timeout, are only handled once. Stores shared by several instances
+// deduplicate commands across them.
+type DedupStore interface {
+	// Remember remembers an ID until the TTL has passed. Returns false if the
+	// ID is already remembered.
+	Remember(ctx context.Context, id string, ttl time.Duration) (bool, error)
+
+	// Forget forgets an ID, so that it can be remembered again.
+	Forget(ctx context.Context, id string) error
+}
+
+// IdempotentMiddleware returns a command handler middleware that handles
+// commands with the same ID only once within the TTL, and returns
+// ErrDuplicateCommand for the others. The ID of a command is the
+// HeaderCommandID header of its context, see HandleCommandWithContext, and
+// commands without an ID are always handled. IDs of commands that fail are
+// forgotten, so that they can be retried.
+func IdempotentMiddleware(store DedupStore, ttl time.Duration) CommandHandlerMiddleware {
+	return func(handler CommandHandler) CommandHandler {
+		return &idempotentHandler{handler, store, ttl}
+	}
+}
+
+type idempotentHandler struct {
+	handler CommandHandler
+	store   DedupStore
+	ttl     time.Duration
+}
+
+// HandleCommand implements the HandleCommand method of the CommandHandler
+// interface.
+func (h *idempotentHandler) HandleCommand(command Command) error {
+	return h.HandleCommandWithContext(context.Background(), command)
+}
+
+// HandleCommandWithContext implements the HandleCommandWithContext method of
+// the ContextCommandHandler interface.
+func (h *idempotentHandler) HandleCommandWithContext(ctx context.Context, command Command) error {
+	id := HeadersFromContext(ctx)[HeaderCommandID]
+	if id == "" {
+		return HandleCommandWithContext(ctx, h.handler, command)
+	}
+
+	ok, err := h.store.Remember(ctx, command.CommandType()+":"+id, h.ttl)
+	if err != nil {
+		return err
+	} else if !ok {
+		return ErrDuplicateCommand
+	}
+
+	if err := HandleCommandWithContext(ctx, h.handler, command); err != nil {
+		if forgetErr := h.store.Forget(ctx, command.CommandType()+":"+id); forgetErr != nil {
+			return forgetErr
+		}
+		return err
+	}
+	return nil
+}
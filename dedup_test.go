@@ -0,0 +1,84 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestIdempotentMiddleware(t *testing.T) {
+	store := &mapDedupStore{ids: map[string]bool{}}
+	var handled int
+	var failure error
+	handler := UseCommandHandlerMiddleware(CommandHandlerFunc(func(command Command) error {
+		handled++
+		return failure
+	}), IdempotentMiddleware(store, time.Minute))
+	command := &TestCommand{NewUUID(), "command1"}
+
+	t.Log("handle a command once")
+	ctx := NewContextWithHeaders(context.Background(), Headers{HeaderCommandID: "id1"})
+	if err := HandleCommandWithContext(ctx, handler, command); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := HandleCommandWithContext(ctx, handler, command); err != ErrDuplicateCommand {
+		t.Error("there should be a ErrDuplicateCommand error:", err)
+	}
+	if handled != 1 {
+		t.Error("the command should be handled once:", handled)
+	}
+
+	t.Log("handle commands without ID")
+	handler.HandleCommand(command)
+	handler.HandleCommand(command)
+	if handled != 3 {
+		t.Error("the commands should be handled:", handled)
+	}
+
+	t.Log("retry failed commands")
+	failure = errors.New("failed")
+	ctx = NewContextWithHeaders(context.Background(), Headers{HeaderCommandID: "id2"})
+	if err := HandleCommandWithContext(ctx, handler, command); err != failure {
+		t.Error("the error should be correct:", err)
+	}
+	failure = nil
+	if err := HandleCommandWithContext(ctx, handler, command); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if handled != 5 {
+		t.Error("the failed command should be retried:", handled)
+	}
+}
+
+// mapDedupStore is a DedupStore without expiry.
+type mapDedupStore struct {
+	ids map[string]bool
+}
+
+func (s *mapDedupStore) Remember(ctx context.Context, id string, ttl time.Duration) (bool, error) {
+	if s.ids[id] {
+		return false, nil
+	}
+	s.ids[id] = true
+	return true, nil
+}
+
+func (s *mapDedupStore) Forget(ctx context.Context, id string) error {
+	delete(s.ids, id)
+	return nil
+}
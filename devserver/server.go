@@ -0,0 +1,326 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package devserver runs an app with in-memory backends and an HTTP endpoint
+// for inspecting it, for development and trying out the library without Redis
+// or MongoDB. Nothing is persisted between runs.
+//
+// The endpoints are:
+//     GET  /events?from=POSITION&limit=N   all events in the order they were saved
+//     GET  /events/{aggregate ID}          the events of an aggregate
+//     POST /commands/{command type}        dispatch a command from its JSON fields
+//     GET  /models                         the names of the read models
+//     GET  /models/{name}                  all models of a read model
+//     GET  /models/{name}/{ID}             a model of a read model
+//
+// Commands with old versions registered with
+// eventhorizon.RegisterCommandVersion are sent with their version in the
+// Command-Version header, and are upcast to the current version. Commands
+// without the header are version 1, as sent by clients from before the command
+// was versioned.
+package devserver
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/looplab/eventhorizon"
+	jsoncodec "github.com/looplab/eventhorizon/codec/json"
+	"github.com/looplab/eventhorizon/messaging/local"
+	"github.com/looplab/eventhorizon/storage/memory"
+)
+
+// ErrReadModelAlreadyAdded is when a read model is added with a name in use.
+var ErrReadModelAlreadyAdded = errors.New("read model is already added")
+
+// Server wires an event bus, event store, aggregate repository and command bus
+// with in-memory implementations. Aggregates and read models are added with
+// SetAggregate and AddReadModel, and the server is run as an http.Handler.
+type Server struct {
+	EventBus       *local.EventBus
+	EventStore     *memory.EventStore
+	Repository     *eventhorizon.CallbackRepository
+	CommandHandler *eventhorizon.AggregateCommandHandler
+	CommandBus     *local.CommandBus
+
+	commands   map[string]reflect.Type
+	readModels map[string]*memory.ReadRepository
+	mu         sync.RWMutex
+}
+
+// NewServer creates a new Server with empty backends.
+func NewServer() (*Server, error) {
+	eventBus := local.NewEventBus()
+	eventStore := memory.NewEventStore(eventBus)
+	repository, err := eventhorizon.NewCallbackRepository(eventStore)
+	if err != nil {
+		return nil, err
+	}
+	handler, err := eventhorizon.NewAggregateCommandHandler(repository)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Server{
+		EventBus:       eventBus,
+		EventStore:     eventStore,
+		Repository:     repository,
+		CommandHandler: handler,
+		CommandBus:     local.NewCommandBus(),
+		commands:       make(map[string]reflect.Type),
+		readModels:     make(map[string]*memory.ReadRepository),
+	}, nil
+}
+
+// SetAggregate registers an aggregate with its factory, and handles the
+// commands with it. The commands can then be dispatched over HTTP.
+func (s *Server) SetAggregate(aggregate eventhorizon.Aggregate, factory func(eventhorizon.UUID) eventhorizon.Aggregate, commands ...eventhorizon.Command) error {
+	if err := s.Repository.RegisterAggregate(aggregate, factory); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, command := range commands {
+		if err := s.CommandHandler.SetAggregate(aggregate, command); err != nil {
+			return err
+		}
+		if err := s.CommandBus.SetHandler(s.CommandHandler, command); err != nil {
+			return err
+		}
+		s.commands[command.CommandType()] = reflect.TypeOf(command).Elem()
+	}
+	return nil
+}
+
+// AddReadModel adds a read model by name, with a projector created for its
+// repository that handles the events. The models can then be read over HTTP.
+func (s *Server) AddReadModel(name string, projector func(eventhorizon.ReadRepository) eventhorizon.EventHandler, events ...eventhorizon.Event) (*memory.ReadRepository, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.readModels[name]; ok {
+		return nil, ErrReadModelAlreadyAdded
+	}
+
+	repository := memory.NewReadRepository()
+	handler := projector(repository)
+	for _, event := range events {
+		s.EventBus.AddHandler(handler, event)
+	}
+	s.readModels[name] = repository
+	return repository, nil
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case parts[0] == "events" && r.Method == http.MethodGet:
+		if len(parts) == 1 {
+			s.serveAllEvents(w, r)
+			return
+		} else if len(parts) == 2 {
+			s.serveEvents(w, eventhorizon.UUID(parts[1]))
+			return
+		}
+	case parts[0] == "commands" && r.Method == http.MethodPost && len(parts) == 2:
+		s.serveCommand(w, r, parts[1])
+		return
+	case parts[0] == "models" && r.Method == http.MethodGet:
+		if len(parts) == 1 {
+			s.serveReadModels(w)
+			return
+		} else if len(parts) <= 3 {
+			s.serveModels(w, parts[1:]...)
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+// event is the JSON format of an event.
+type event struct {
+	Type          string                `json:"type"`
+	AggregateType string                `json:"aggregate_type"`
+	AggregateID   eventhorizon.UUID     `json:"aggregate_id"`
+	Version       int                   `json:"version"`
+	Timestamp     time.Time             `json:"timestamp"`
+	Position      eventhorizon.Position `json:"position,omitempty"`
+	Headers       eventhorizon.Headers  `json:"headers,omitempty"`
+	Data          eventhorizon.Event    `json:"data"`
+}
+
+func newEvent(e eventhorizon.EventEnvelope) event {
+	return event{
+		Type:          e.Event.EventType(),
+		AggregateType: e.Event.AggregateType(),
+		AggregateID:   e.Event.AggregateID(),
+		Version:       e.Version,
+		Timestamp:     e.Timestamp,
+		Position:      e.Position,
+		Headers:       e.Headers,
+		Data:          e.Event,
+	}
+}
+
+func (s *Server) serveAllEvents(w http.ResponseWriter, r *http.Request) {
+	var limit int
+	if l := r.URL.Query().Get("limit"); l != "" {
+		var err error
+		if limit, err = strconv.Atoi(l); err != nil || limit < 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	from := eventhorizon.Position(r.URL.Query().Get("from"))
+	envelopes, _, err := s.EventStore.LoadAll(r.Context(), from, limit)
+	if err == eventhorizon.ErrInvalidPosition {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	events := make([]event, len(envelopes))
+	for i, e := range envelopes {
+		events[i] = newEvent(e)
+	}
+	writeJSON(w, events)
+}
+
+func (s *Server) serveEvents(w http.ResponseWriter, id eventhorizon.UUID) {
+	envelopes, err := s.EventStore.LoadEnvelopes(id)
+	if err == eventhorizon.ErrNoEventsFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err == eventhorizon.ErrAggregateDeleted {
+		http.Error(w, err.Error(), http.StatusGone)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	events := make([]event, len(envelopes))
+	for i, e := range envelopes {
+		events[i] = newEvent(e)
+	}
+	writeJSON(w, events)
+}
+
+func (s *Server) serveCommand(w http.ResponseWriter, r *http.Request, commandType string) {
+	s.mu.RLock()
+	t, ok := s.commands[commandType]
+	s.mu.RUnlock()
+	if !ok {
+		http.Error(w, eventhorizon.ErrHandlerNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	current := eventhorizon.CommandVersion(commandType)
+	version := 1
+	if h := r.Header.Get("Command-Version"); h != "" {
+		var err error
+		if version, err = strconv.Atoi(h); err != nil {
+			http.Error(w, "invalid command version", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var command eventhorizon.Command
+	if version != current {
+		data, err := ioutil.ReadAll(r.Body)
+		if err == nil {
+			command, err = eventhorizon.UnmarshalCommandVersion(jsoncodec.CommandCodec{},
+				commandType, version, data)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else {
+		command = reflect.New(t).Interface().(eventhorizon.Command)
+		if err := json.NewDecoder(r.Body).Decode(command); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if err := s.CommandBus.HandleCommand(command); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *Server) serveReadModels(w http.ResponseWriter) {
+	s.mu.RLock()
+	names := make([]string, 0, len(s.readModels))
+	for name := range s.readModels {
+		names = append(names, name)
+	}
+	s.mu.RUnlock()
+	sort.Strings(names)
+	writeJSON(w, names)
+}
+
+func (s *Server) serveModels(w http.ResponseWriter, path ...string) {
+	s.mu.RLock()
+	repository, ok := s.readModels[path[0]]
+	s.mu.RUnlock()
+	if !ok {
+		http.Error(w, "read model not found", http.StatusNotFound)
+		return
+	}
+
+	if len(path) == 1 {
+		models, err := repository.FindAll()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, models)
+		return
+	}
+
+	model, err := repository.Find(eventhorizon.UUID(path[1]))
+	if err == eventhorizon.ErrModelNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, model)
+}
+
+// writeJSON writes a value as indented JSON.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(data, '\n'))
+}
@@ -0,0 +1,222 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package devserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/testutil"
+)
+
+func TestServer(t *testing.T) {
+	s, err := NewServer()
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := s.SetAggregate(&testAggregate{}, func(id eventhorizon.UUID) eventhorizon.Aggregate {
+		return &testAggregate{AggregateBase: eventhorizon.NewAggregateBase(id)}
+	}, &testutil.TestCommand{}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if _, err := s.AddReadModel("tests", newTestProjector, &testutil.TestEvent{}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if _, err := s.AddReadModel("tests", newTestProjector); err != ErrReadModelAlreadyAdded {
+		t.Error("there should be a ErrReadModelAlreadyAdded error:", err)
+	}
+
+	t.Log("dispatch a command")
+	id := eventhorizon.UUID("c1138e5f-f6fb-4dd0-8e79-255c6c8d3756")
+	w := serve(s, http.MethodPost, "/commands/TestCommand", `{"TestID": "`+string(id)+`", "Content": "content"}`)
+	if w.Code != http.StatusAccepted {
+		t.Error("the status should be correct:", w.Code, w.Body.String())
+	}
+	if w := serve(s, http.MethodPost, "/commands/TestCommandOther", `{}`); w.Code != http.StatusNotFound {
+		t.Error("the status should be correct:", w.Code)
+	}
+	if w := serve(s, http.MethodPost, "/commands/TestCommand", `{"TestID":`); w.Code != http.StatusBadRequest {
+		t.Error("the status should be correct:", w.Code)
+	}
+
+	t.Log("list all events")
+	var events []map[string]interface{}
+	w = serve(s, http.MethodGet, "/events", "")
+	if err := json.Unmarshal(w.Body.Bytes(), &events); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(events) != 1 {
+		t.Fatal("there should be one event:", events)
+	}
+	if events[0]["type"] != "TestEvent" || events[0]["aggregate_id"] != string(id) ||
+		events[0]["position"] != "1" {
+		t.Error("the event should be correct:", events[0])
+	}
+	expectedData := map[string]interface{}{"TestID": string(id), "Content": "content"}
+	if !reflect.DeepEqual(events[0]["data"], expectedData) {
+		t.Error("the event data should be correct:", events[0]["data"])
+	}
+	w = serve(s, http.MethodGet, "/events?from=1", "")
+	if strings.TrimSpace(w.Body.String()) != "[]" {
+		t.Error("there should be no events after the position:", w.Body.String())
+	}
+	if w := serve(s, http.MethodGet, "/events?from=invalid", ""); w.Code != http.StatusBadRequest {
+		t.Error("the status should be correct:", w.Code)
+	}
+
+	t.Log("list the events of an aggregate")
+	w = serve(s, http.MethodGet, "/events/"+string(id), "")
+	if err := json.Unmarshal(w.Body.Bytes(), &events); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(events) != 1 || events[0]["version"] != 0.0 {
+		t.Error("the events should be correct:", events)
+	}
+	if w := serve(s, http.MethodGet, "/events/"+string(eventhorizon.NewUUID()), ""); w.Code != http.StatusNotFound {
+		t.Error("the status should be correct:", w.Code)
+	}
+
+	t.Log("read the models")
+	w = serve(s, http.MethodGet, "/models", "")
+	if strings.TrimSpace(w.Body.String()) != `[
+  "tests"
+]` {
+		t.Error("the read models should be correct:", w.Body.String())
+	}
+	var models []map[string]interface{}
+	w = serve(s, http.MethodGet, "/models/tests", "")
+	if err := json.Unmarshal(w.Body.Bytes(), &models); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(models) != 1 || models[0]["content"] != "content" {
+		t.Error("the models should be correct:", models)
+	}
+	var model map[string]interface{}
+	w = serve(s, http.MethodGet, "/models/tests/"+string(id), "")
+	if err := json.Unmarshal(w.Body.Bytes(), &model); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if model["id"] != string(id) {
+		t.Error("the model should be correct:", model)
+	}
+	if w := serve(s, http.MethodGet, "/models/tests/"+string(eventhorizon.NewUUID()), ""); w.Code != http.StatusNotFound {
+		t.Error("the status should be correct:", w.Code)
+	}
+	if w := serve(s, http.MethodGet, "/models/other", ""); w.Code != http.StatusNotFound {
+		t.Error("the status should be correct:", w.Code)
+	}
+}
+
+func TestServerCommandVersion(t *testing.T) {
+	s, err := NewServer()
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := s.SetAggregate(&testAggregate{}, func(id eventhorizon.UUID) eventhorizon.Aggregate {
+		return &testAggregate{AggregateBase: eventhorizon.NewAggregateBase(id)}
+	}, &testutil.TestCommand{}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := eventhorizon.RegisterCommandVersion(1, func() eventhorizon.Command {
+		return &testCommandV1{}
+	}, func(c eventhorizon.Command) (eventhorizon.Command, error) {
+		v1 := c.(*testCommandV1)
+		return &testutil.TestCommand{TestID: v1.ID, Content: v1.Text}, nil
+	}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer eventhorizon.UnregisterCommandVersions("TestCommand")
+
+	t.Log("upcast a command without a version")
+	id := eventhorizon.NewUUID()
+	w := serve(s, http.MethodPost, "/commands/TestCommand", `{"ID": "`+string(id)+`", "Text": "content"}`)
+	if w.Code != http.StatusAccepted {
+		t.Error("the status should be correct:", w.Code, w.Body.String())
+	}
+	var events []map[string]interface{}
+	w = serve(s, http.MethodGet, "/events/"+string(id), "")
+	if err := json.Unmarshal(w.Body.Bytes(), &events); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	expectedData := map[string]interface{}{"TestID": string(id), "Content": "content"}
+	if len(events) != 1 || !reflect.DeepEqual(events[0]["data"], expectedData) {
+		t.Error("the events should be correct:", events)
+	}
+
+	t.Log("dispatch the current version")
+	r := httptest.NewRequest(http.MethodPost, "/commands/TestCommand",
+		strings.NewReader(`{"TestID": "`+string(id)+`", "Content": "content"}`))
+	r.Header.Set("Command-Version", "2")
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	if w.Code != http.StatusAccepted {
+		t.Error("the status should be correct:", w.Code, w.Body.String())
+	}
+	r.Header.Set("Command-Version", "3")
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Error("the status should be correct:", w.Code)
+	}
+}
+
+func serve(s *Server, method, path, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return w
+}
+
+type testAggregate struct {
+	*eventhorizon.AggregateBase
+}
+
+func (a *testAggregate) AggregateType() string { return "Test" }
+
+func (a *testAggregate) HandleCommand(command eventhorizon.Command) error {
+	if c, ok := command.(*testutil.TestCommand); ok {
+		a.StoreEvent(&testutil.TestEvent{c.TestID, c.Content})
+	}
+	return nil
+}
+
+func (a *testAggregate) ApplyEvent(event eventhorizon.Event) {}
+
+type testProjector struct {
+	repository eventhorizon.ReadRepository
+}
+
+func newTestProjector(repository eventhorizon.ReadRepository) eventhorizon.EventHandler {
+	return &testProjector{repository}
+}
+
+func (p *testProjector) HandleEvent(event eventhorizon.Event) {
+	if e, ok := event.(*testutil.TestEvent); ok {
+		p.repository.Save(e.TestID, &testutil.TestModel{ID: e.TestID, Content: e.Content})
+	}
+}
+
+type testCommandV1 struct {
+	ID   eventhorizon.UUID
+	Text string
+}
+
+func (c *testCommandV1) AggregateID() eventhorizon.UUID { return c.ID }
+func (c *testCommandV1) AggregateType() string          { return "Test" }
+func (c *testCommandV1) CommandType() string            { return "TestCommand" }
@@ -0,0 +1,108 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Elector elects a leader among processes with a lease on a lock, for running
+// components that must only run on one instance at a time, such as the
+// TimeoutManager. The lease is refreshed at a third of its TTL, and another
+// instance takes over when it expires.
+type Elector struct {
+	lock   Lock
+	key    string
+	ttl    time.Duration
+	clock  Clock
+	leader bool
+	mu     sync.RWMutex
+}
+
+// NewElector creates a new Elector for a key of a lock, with a TTL for the
+// lease. The clock is used for campaigning and refreshing the lease.
+func NewElector(lock Lock, key string, ttl time.Duration, clock Clock) *Elector {
+	return &Elector{
+		lock:  lock,
+		key:   key,
+		ttl:   ttl,
+		clock: clock,
+	}
+}
+
+// IsLeader returns true if this instance is the leader.
+func (e *Elector) IsLeader() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.leader
+}
+
+// Run campaigns for the leadership until the context is done, and runs a
+// function while it is the leader. The context of the function is canceled
+// when the leadership is lost, after which it campaigns again. Returns the
+// error of the function, if any.
+func (e *Elector) Run(ctx context.Context, f func(context.Context) error) error {
+	for {
+		token, err := e.lock.TryLock(e.key, e.ttl)
+		if err == nil {
+			if err := e.lead(ctx, token, f); err != nil {
+				return err
+			}
+		} else if err != ErrLockHeld {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-e.clock.After(e.ttl / 3):
+		}
+	}
+}
+
+// lead runs a function while refreshing the lease, until the function returns
+// or the lease is lost.
+func (e *Elector) lead(ctx context.Context, token string, f func(context.Context) error) error {
+	e.setLeader(true)
+	defer e.setLeader(false)
+
+	leaderCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- f(leaderCtx) }()
+
+	for {
+		select {
+		case err := <-done:
+			e.lock.Unlock(e.key, token)
+			return err
+		case <-e.clock.After(e.ttl / 3):
+			// Any error means that the lease can't be trusted anymore.
+			if err := e.lock.Refresh(e.key, token, e.ttl); err != nil {
+				cancel()
+				<-done
+				return nil
+			}
+		}
+	}
+}
+
+func (e *Elector) setLeader(leader bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.leader = leader
+}
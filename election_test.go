@@ -0,0 +1,80 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestElector(t *testing.T) {
+	lock := &mockLock{}
+	clock := &tickClock{now: time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC), ticks: make(chan time.Time)}
+	elector := NewElector(lock, "leader", time.Minute, clock)
+
+	started := make(chan struct{})
+	stopped := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- elector.Run(ctx, func(ctx context.Context) error {
+			started <- struct{}{}
+			<-ctx.Done()
+			stopped <- struct{}{}
+			return nil
+		})
+	}()
+
+	t.Log("become leader")
+	<-started
+	if !elector.IsLeader() {
+		t.Error("the elector should be the leader")
+	}
+	clock.ticks <- clock.now
+
+	t.Log("lose the lease")
+	lock.set(true, ErrLockNotHeld)
+	tickUntil(clock, stopped)
+
+	t.Log("campaign while the lock is held")
+	clock.ticks <- clock.now
+	if elector.IsLeader() {
+		t.Error("the elector should not be the leader")
+	}
+
+	t.Log("take over when the lock is free")
+	lock.set(false, nil)
+	tickUntil(clock, started)
+	cancel()
+	<-stopped
+	if err := <-done; err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if elector.IsLeader() || lock.held {
+		t.Error("the lease should be released")
+	}
+}
+
+// tickUntil sends ticks until a channel receives.
+func tickUntil(clock *tickClock, c chan struct{}) {
+	for {
+		select {
+		case clock.ticks <- clock.now:
+		case <-c:
+			return
+		}
+	}
+}
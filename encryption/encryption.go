@@ -0,0 +1,175 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package encryption contains per aggregate encryption of events in event
+// stores, with keys that can be deleted to make the events of an aggregate
+// unreadable, also known as crypto-shredding.
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+
+	"github.com/looplab/eventhorizon"
+)
+
+// ErrKeyNotFound is when there is no key for an aggregate.
+var ErrKeyNotFound = errors.New("could not find key")
+
+// ErrKeyExists is when a key is created for an aggregate that already has one.
+var ErrKeyExists = errors.New("key already exists")
+
+// ErrKeyDeleted is when the key of an aggregate has been deleted.
+var ErrKeyDeleted = errors.New("key is deleted")
+
+// ErrInvalidPayload is when encrypted data could not be decrypted.
+var ErrInvalidPayload = errors.New("invalid encrypted payload")
+
+// KeyStore is a storage for the keys of aggregates.
+type KeyStore interface {
+	// GetKey returns the key of an aggregate. Returns ErrKeyNotFound if there
+	// is none, or ErrKeyDeleted if it has been deleted.
+	GetKey(eventhorizon.UUID) ([]byte, error)
+
+	// CreateKey stores a new key for an aggregate. Returns ErrKeyExists if
+	// the aggregate already has a key, or ErrKeyDeleted if it has been deleted.
+	CreateKey(eventhorizon.UUID, []byte) error
+
+	// DeleteKey deletes the key of an aggregate, and remembers that it has
+	// been deleted so that no new key is created.
+	DeleteKey(eventhorizon.UUID) error
+}
+
+// KeyProvider provides the keys used to encrypt the events of aggregates.
+type KeyProvider interface {
+	// Key returns the key of an aggregate, creating one if it has none.
+	// Returns ErrKeyDeleted if the key has been deleted.
+	Key(eventhorizon.UUID) ([]byte, error)
+
+	// DeleteKey deletes the key of an aggregate, which makes its encrypted
+	// events unreadable.
+	DeleteKey(eventhorizon.UUID) error
+}
+
+// StoreKeyProvider is a KeyProvider with random keys kept in a KeyStore.
+type StoreKeyProvider struct {
+	store KeyStore
+}
+
+// NewKeyProvider creates a KeyProvider that creates random AES-256 keys in a
+// KeyStore.
+func NewKeyProvider(store KeyStore) *StoreKeyProvider {
+	return &StoreKeyProvider{
+		store: store,
+	}
+}
+
+// Key implements the Key method of the KeyProvider interface.
+func (p *StoreKeyProvider) Key(id eventhorizon.UUID) ([]byte, error) {
+	key, err := p.store.GetKey(id)
+	if err != ErrKeyNotFound {
+		return key, err
+	}
+
+	key = make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := p.store.CreateKey(id, key); err == ErrKeyExists {
+		// Created concurrently, use that key.
+		return p.store.GetKey(id)
+	} else if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// DeleteKey implements the DeleteKey method of the KeyProvider interface.
+func (p *StoreKeyProvider) DeleteKey(id eventhorizon.UUID) error {
+	return p.store.DeleteKey(id)
+}
+
+// Hook is an EventStorageHook that encrypts the data of events with AES-GCM,
+// using the key of their aggregates. The aggregate ID is kept unencrypted in
+// the payload to find the key when loading.
+//
+// An example would be:
+//     eventStore.SetStorageHook(encryption.NewHook(keyProvider))
+type Hook struct {
+	keys KeyProvider
+}
+
+// NewHook creates a Hook with keys from a KeyProvider.
+func NewHook(keys KeyProvider) *Hook {
+	return &Hook{
+		keys: keys,
+	}
+}
+
+// PrePersist implements the PrePersist method of the EventStorageHook
+// interface.
+func (h *Hook) PrePersist(event eventhorizon.Event, data []byte) ([]byte, error) {
+	id := event.AggregateID()
+	gcm, err := h.cipher(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// The payload is the length of the ID, the ID, the nonce and the sealed
+	// data.
+	payload := append([]byte{byte(len(id))}, id...)
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	payload = append(payload, nonce...)
+	return gcm.Seal(payload, nonce, data, []byte(id)), nil
+}
+
+// PostLoad implements the PostLoad method of the EventStorageHook interface.
+func (h *Hook) PostLoad(eventType string, payload []byte) ([]byte, error) {
+	if len(payload) < 1 || len(payload) < 1+int(payload[0]) {
+		return nil, ErrInvalidPayload
+	}
+	id := eventhorizon.UUID(payload[1 : 1+payload[0]])
+	payload = payload[1+payload[0]:]
+
+	gcm, err := h.cipher(id)
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) < gcm.NonceSize() {
+		return nil, ErrInvalidPayload
+	}
+	nonce, sealed := payload[:gcm.NonceSize()], payload[gcm.NonceSize():]
+	data, err := gcm.Open(nil, nonce, sealed, []byte(id))
+	if err != nil {
+		return nil, ErrInvalidPayload
+	}
+	return data, nil
+}
+
+func (h *Hook) cipher(id eventhorizon.UUID) (cipher.AEAD, error) {
+	key, err := h.keys.Key(id)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encryption
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/testutil"
+)
+
+func TestHook(t *testing.T) {
+	keys := NewKeyProvider(NewMemoryKeyStore())
+	hook := NewHook(keys)
+	id := eventhorizon.NewUUID()
+	event := &testutil.TestEvent{id, "event1"}
+	data := []byte("secret data")
+
+	t.Log("encrypt and decrypt")
+	payload, err := hook.PrePersist(event, data)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if bytes.Contains(payload, data) {
+		t.Error("the payload should be encrypted:", payload)
+	}
+	decrypted, err := hook.PostLoad(event.EventType(), payload)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(decrypted, data) {
+		t.Error("the data should be decrypted:", decrypted)
+	}
+
+	t.Log("tampered payload")
+	payload[len(payload)-1] ^= 0xff
+	if _, err := hook.PostLoad(event.EventType(), payload); err != ErrInvalidPayload {
+		t.Error("there should be a ErrInvalidPayload error:", err)
+	}
+	if _, err := hook.PostLoad(event.EventType(), nil); err != ErrInvalidPayload {
+		t.Error("there should be a ErrInvalidPayload error:", err)
+	}
+
+	t.Log("deleted key")
+	payload, _ = hook.PrePersist(event, data)
+	if err := keys.DeleteKey(id); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, err := hook.PostLoad(event.EventType(), payload); err != ErrKeyDeleted {
+		t.Error("there should be a ErrKeyDeleted error:", err)
+	}
+	if _, err := hook.PrePersist(event, data); err != ErrKeyDeleted {
+		t.Error("there should be a ErrKeyDeleted error:", err)
+	}
+}
+
+func TestKeyProvider(t *testing.T) {
+	keys := NewKeyProvider(NewMemoryKeyStore())
+	id := eventhorizon.NewUUID()
+
+	key1, err := keys.Key(id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(key1) != 32 {
+		t.Error("the key should be 32 bytes:", len(key1))
+	}
+	key2, err := keys.Key(id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(key1, key2) {
+		t.Error("the key should be the same:", key2)
+	}
+	if key3, _ := keys.Key(eventhorizon.NewUUID()); reflect.DeepEqual(key1, key3) {
+		t.Error("the keys of aggregates should be different:", key3)
+	}
+}
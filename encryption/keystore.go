@@ -0,0 +1,129 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encryption
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/looplab/eventhorizon"
+)
+
+// MemoryKeyStore is a KeyStore in memory, mostly for testing.
+type MemoryKeyStore struct {
+	keys map[eventhorizon.UUID][]byte // Deleted keys are nil.
+	mu   sync.RWMutex
+}
+
+// NewMemoryKeyStore creates a new MemoryKeyStore.
+func NewMemoryKeyStore() *MemoryKeyStore {
+	return &MemoryKeyStore{
+		keys: make(map[eventhorizon.UUID][]byte),
+	}
+}
+
+// GetKey implements the GetKey method of the KeyStore interface.
+func (s *MemoryKeyStore) GetKey(id eventhorizon.UUID) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	key, ok := s.keys[id]
+	if !ok {
+		return nil, ErrKeyNotFound
+	} else if key == nil {
+		return nil, ErrKeyDeleted
+	}
+	return key, nil
+}
+
+// CreateKey implements the CreateKey method of the KeyStore interface.
+func (s *MemoryKeyStore) CreateKey(id eventhorizon.UUID, key []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, ok := s.keys[id]; ok && existing == nil {
+		return ErrKeyDeleted
+	} else if ok {
+		return ErrKeyExists
+	}
+	s.keys[id] = key
+	return nil
+}
+
+// DeleteKey implements the DeleteKey method of the KeyStore interface.
+func (s *MemoryKeyStore) DeleteKey(id eventhorizon.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[id] = nil
+	return nil
+}
+
+// FileKeyStore is a KeyStore with one file per key in a directory. Deleted
+// keys are kept as empty files.
+type FileKeyStore struct {
+	dir string
+}
+
+// NewFileKeyStore creates a FileKeyStore in a directory, which is created if
+// it does not exist.
+func NewFileKeyStore(dir string) (*FileKeyStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FileKeyStore{
+		dir: dir,
+	}, nil
+}
+
+// GetKey implements the GetKey method of the KeyStore interface.
+func (s *FileKeyStore) GetKey(id eventhorizon.UUID) ([]byte, error) {
+	key, err := ioutil.ReadFile(s.path(id))
+	if os.IsNotExist(err) {
+		return nil, ErrKeyNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	if len(key) == 0 {
+		return nil, ErrKeyDeleted
+	}
+	return key, nil
+}
+
+// CreateKey implements the CreateKey method of the KeyStore interface.
+func (s *FileKeyStore) CreateKey(id eventhorizon.UUID, key []byte) error {
+	f, err := os.OpenFile(s.path(id), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if os.IsExist(err) {
+		if _, err := s.GetKey(id); err == ErrKeyDeleted {
+			return err
+		}
+		return ErrKeyExists
+	} else if err != nil {
+		return err
+	}
+	if _, err := f.Write(key); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// DeleteKey implements the DeleteKey method of the KeyStore interface.
+func (s *FileKeyStore) DeleteKey(id eventhorizon.UUID) error {
+	return ioutil.WriteFile(s.path(id), nil, 0600)
+}
+
+func (s *FileKeyStore) path(id eventhorizon.UUID) string {
+	return filepath.Join(s.dir, filepath.Base(id.String()))
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encryption
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/looplab/eventhorizon"
+)
+
+func TestMemoryKeyStore(t *testing.T) {
+	testKeyStore(t, NewMemoryKeyStore())
+}
+
+func TestFileKeyStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keys")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := NewFileKeyStore(dir)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	testKeyStore(t, store)
+}
+
+func testKeyStore(t *testing.T, store KeyStore) {
+	id := eventhorizon.NewUUID()
+	key := []byte("key")
+
+	t.Log("get non-existing key")
+	if _, err := store.GetKey(id); err != ErrKeyNotFound {
+		t.Error("there should be a ErrKeyNotFound error:", err)
+	}
+
+	t.Log("create and get key")
+	if err := store.CreateKey(id, key); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	result, err := store.GetKey(id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(result, key) {
+		t.Error("the key should be correct:", result)
+	}
+
+	t.Log("create existing key")
+	if err := store.CreateKey(id, []byte("other")); err != ErrKeyExists {
+		t.Error("there should be a ErrKeyExists error:", err)
+	}
+
+	t.Log("delete key")
+	if err := store.DeleteKey(id); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, err := store.GetKey(id); err != ErrKeyDeleted {
+		t.Error("there should be a ErrKeyDeleted error:", err)
+	}
+	if err := store.CreateKey(id, key); err != ErrKeyDeleted {
+		t.Error("there should be a ErrKeyDeleted error:", err)
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package kms contains a key provider for encryption keys using AWS KMS.
+package kms
+
+import (
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+
+	"github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/encryption"
+)
+
+// KeyProvider is an encryption.KeyProvider with data keys generated by AWS
+// KMS. The data keys are kept encrypted by a KMS master key in a KeyStore, and
+// decrypted keys are cached in memory.
+type KeyProvider struct {
+	client      kmsiface.KMSAPI
+	masterKeyID string
+	store       encryption.KeyStore
+
+	cache map[eventhorizon.UUID][]byte
+	mu    sync.Mutex
+}
+
+// NewKeyProvider creates a KeyProvider using a KMS master key.
+func NewKeyProvider(client kmsiface.KMSAPI, masterKeyID string, store encryption.KeyStore) *KeyProvider {
+	return &KeyProvider{
+		client:      client,
+		masterKeyID: masterKeyID,
+		store:       store,
+		cache:       make(map[eventhorizon.UUID][]byte),
+	}
+}
+
+// Key implements the Key method of the encryption.KeyProvider interface.
+func (p *KeyProvider) Key(id eventhorizon.UUID) ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.cache[id]; ok {
+		return key, nil
+	}
+
+	sealed, err := p.store.GetKey(id)
+	if err == encryption.ErrKeyNotFound {
+		resp, err := p.client.GenerateDataKey(&kms.GenerateDataKeyInput{
+			KeyId:   aws.String(p.masterKeyID),
+			KeySpec: aws.String(kms.DataKeySpecAes256),
+		})
+		if err != nil {
+			return nil, err
+		}
+		err = p.store.CreateKey(id, resp.CiphertextBlob)
+		if err == nil {
+			p.cache[id] = resp.Plaintext
+			return resp.Plaintext, nil
+		} else if err != encryption.ErrKeyExists {
+			return nil, err
+		}
+
+		// Created concurrently, use that key.
+		if sealed, err = p.store.GetKey(id); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.client.Decrypt(&kms.DecryptInput{
+		CiphertextBlob: sealed,
+	})
+	if err != nil {
+		return nil, err
+	}
+	p.cache[id] = resp.Plaintext
+	return resp.Plaintext, nil
+}
+
+// DeleteKey implements the DeleteKey method of the encryption.KeyProvider
+// interface.
+func (p *KeyProvider) DeleteKey(id eventhorizon.UUID) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.cache, id)
+	return p.store.DeleteKey(id)
+}
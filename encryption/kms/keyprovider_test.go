@@ -0,0 +1,90 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kms
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+
+	"github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/encryption"
+)
+
+func TestKeyProvider(t *testing.T) {
+	client := &mockKMS{}
+	store := encryption.NewMemoryKeyStore()
+	id := eventhorizon.NewUUID()
+
+	t.Log("generate key")
+	keys := NewKeyProvider(client, "master", store)
+	key, err := keys.Key(id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if string(key) != "plain" || client.generated != 1 {
+		t.Error("the key should be generated:", key)
+	}
+	if sealed, _ := store.GetKey(id); string(sealed) != "sealed" {
+		t.Error("the sealed key should be stored:", sealed)
+	}
+
+	t.Log("decrypt stored key")
+	keys = NewKeyProvider(client, "master", store)
+	key, err = keys.Key(id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(key, []byte("plain")) || client.decrypted != 1 {
+		t.Error("the key should be decrypted:", key)
+	}
+
+	t.Log("cached key")
+	keys.Key(id)
+	if client.decrypted != 1 {
+		t.Error("the key should be cached:", client.decrypted)
+	}
+
+	t.Log("delete key")
+	if err := keys.DeleteKey(id); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, err := keys.Key(id); err != encryption.ErrKeyDeleted {
+		t.Error("there should be a ErrKeyDeleted error:", err)
+	}
+}
+
+type mockKMS struct {
+	kmsiface.KMSAPI
+	generated, decrypted int
+}
+
+func (m *mockKMS) GenerateDataKey(input *kms.GenerateDataKeyInput) (*kms.GenerateDataKeyOutput, error) {
+	m.generated++
+	return &kms.GenerateDataKeyOutput{
+		KeyId:          input.KeyId,
+		CiphertextBlob: []byte("sealed"),
+		Plaintext:      []byte("plain"),
+	}, nil
+}
+
+func (m *mockKMS) Decrypt(input *kms.DecryptInput) (*kms.DecryptOutput, error) {
+	m.decrypted++
+	return &kms.DecryptOutput{
+		Plaintext: []byte("plain"),
+	}, nil
+}
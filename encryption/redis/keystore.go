@@ -0,0 +1,76 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package redis contains a key store for encryption keys using Redis.
+package redis
+
+import (
+	"context"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/encryption"
+)
+
+// KeyStore is an encryption.KeyStore that keeps keys in a Redis hash. Deleted
+// keys are kept as empty values.
+type KeyStore struct {
+	client redis.UniversalClient
+	key    string
+}
+
+// NewKeyStore creates a KeyStore using a hash with a key.
+func NewKeyStore(client redis.UniversalClient, key string) *KeyStore {
+	return &KeyStore{
+		client: client,
+		key:    key,
+	}
+}
+
+// GetKey implements the GetKey method of the encryption.KeyStore interface.
+func (s *KeyStore) GetKey(id eventhorizon.UUID) ([]byte, error) {
+	key, err := s.client.HGet(context.Background(), s.key, id.String()).Bytes()
+	if err == redis.Nil {
+		return nil, encryption.ErrKeyNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	if len(key) == 0 {
+		return nil, encryption.ErrKeyDeleted
+	}
+	return key, nil
+}
+
+// CreateKey implements the CreateKey method of the encryption.KeyStore
+// interface.
+func (s *KeyStore) CreateKey(id eventhorizon.UUID, key []byte) error {
+	created, err := s.client.HSetNX(context.Background(), s.key, id.String(), key).Result()
+	if err != nil {
+		return err
+	}
+	if !created {
+		if _, err := s.GetKey(id); err == encryption.ErrKeyDeleted {
+			return err
+		}
+		return encryption.ErrKeyExists
+	}
+	return nil
+}
+
+// DeleteKey implements the DeleteKey method of the encryption.KeyStore
+// interface.
+func (s *KeyStore) DeleteKey(id eventhorizon.UUID) error {
+	return s.client.HSet(context.Background(), s.key, id.String(), "").Err()
+}
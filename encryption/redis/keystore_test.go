@@ -0,0 +1,77 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/encryption"
+)
+
+func TestKeyStore(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: redisURL()})
+	defer client.Close()
+	store := NewKeyStore(client, "test:keys")
+	id := eventhorizon.NewUUID()
+	key := []byte("key")
+
+	t.Log("get non-existing key")
+	if _, err := store.GetKey(id); err != encryption.ErrKeyNotFound {
+		t.Error("there should be a ErrKeyNotFound error:", err)
+	}
+
+	t.Log("create and get key")
+	if err := store.CreateKey(id, key); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	result, err := store.GetKey(id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(result, key) {
+		t.Error("the key should be correct:", result)
+	}
+	if err := store.CreateKey(id, key); err != encryption.ErrKeyExists {
+		t.Error("there should be a ErrKeyExists error:", err)
+	}
+
+	t.Log("delete key")
+	if err := store.DeleteKey(id); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, err := store.GetKey(id); err != encryption.ErrKeyDeleted {
+		t.Error("there should be a ErrKeyDeleted error:", err)
+	}
+	if err := store.CreateKey(id, key); err != encryption.ErrKeyDeleted {
+		t.Error("there should be a ErrKeyDeleted error:", err)
+	}
+}
+
+// redisURL returns the Redis URL, with support for Wercker testing.
+func redisURL() string {
+	host := os.Getenv("REDIS_PORT_6379_TCP_ADDR")
+	port := os.Getenv("REDIS_PORT_6379_TCP_PORT")
+
+	url := ":6379"
+	if host != "" && port != "" {
+		url = host + ":" + port
+	}
+	return url
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"time"
+)
+
+// EventEnricher stamps the headers of published events with metadata, so that
+// command handlers don't have to remember to. The headers of the context are
+// kept and the ones that are missing are added:
+//
+//   - HeaderTimestamp is the time of publishing, in RFC 3339 format
+//   - HeaderNodeID is the ID of the node that published the event
+//   - HeaderUserID is the user from the context, see SetUserFunc
+//   - HeaderCorrelationID is a new ID, starting a new flow
+type EventEnricher struct {
+	nodeID   string
+	clock    Clock
+	userFunc func(context.Context) string
+}
+
+// NewEventEnricher creates a new EventEnricher for a node. The clock is used
+// for the timestamps.
+func NewEventEnricher(nodeID string, clock Clock) *EventEnricher {
+	return &EventEnricher{
+		nodeID: nodeID,
+		clock:  clock,
+	}
+}
+
+// SetUserFunc sets a function that returns the user of a context, for example
+// from the authentication of a request, or an empty string if there is none.
+func (e *EventEnricher) SetUserFunc(f func(context.Context) string) {
+	e.userFunc = f
+}
+
+// Context returns a context with the enriched headers of a context. It can
+// also be used with SaveWithContext to save the same headers with the events.
+func (e *EventEnricher) Context(ctx context.Context) context.Context {
+	headers := Headers{}
+	for k, v := range HeadersFromContext(ctx) {
+		headers[k] = v
+	}
+
+	if headers[HeaderTimestamp] == "" {
+		headers[HeaderTimestamp] = e.clock.Now().UTC().Format(time.RFC3339Nano)
+	}
+	if headers[HeaderNodeID] == "" && e.nodeID != "" {
+		headers[HeaderNodeID] = e.nodeID
+	}
+	if headers[HeaderUserID] == "" && e.userFunc != nil {
+		if user := e.userFunc(ctx); user != "" {
+			headers[HeaderUserID] = user
+		}
+	}
+	if headers[HeaderCorrelationID] == "" {
+		headers[HeaderCorrelationID] = NewUUID().String()
+	}
+
+	return NewContextWithHeaders(ctx, headers)
+}
+
+// Middleware returns an event bus middleware that publishes all events with
+// enriched headers. Events are published with PublishEventWithContext, so the
+// headers are only sent by buses that implement ContextEventPublisher.
+func (e *EventEnricher) Middleware() EventBusMiddleware {
+	return func(bus EventBus) EventBus {
+		return &enrichmentBus{bus, e}
+	}
+}
+
+type enrichmentBus struct {
+	EventBus
+	enricher *EventEnricher
+}
+
+// PublishEvent implements the PublishEvent method of the EventBus interface.
+func (b *enrichmentBus) PublishEvent(event Event) {
+	b.PublishEventWithContext(context.Background(), event)
+}
+
+// PublishEventWithContext implements the PublishEventWithContext method of the
+// ContextEventPublisher interface.
+func (b *enrichmentBus) PublishEventWithContext(ctx context.Context, event Event) {
+	PublishEventWithContext(b.enricher.Context(ctx), b.EventBus, event)
+}
+
+// PublishEvents implements the PublishEvents method of the EventBatchPublisher
+// interface. The events of a batch get the same correlation ID.
+func (b *enrichmentBus) PublishEvents(events []Event) {
+	ctx := NewContextWithHeaders(context.Background(), Headers{
+		HeaderCorrelationID: NewUUID().String(),
+	})
+	for _, event := range events {
+		b.PublishEventWithContext(ctx, event)
+	}
+}
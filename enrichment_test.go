@@ -0,0 +1,89 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestEventEnricher(t *testing.T) {
+	clock := &tickClock{now: time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)}
+	enricher := NewEventEnricher("node1", clock)
+	enricher.SetUserFunc(func(ctx context.Context) string {
+		user, _ := ctx.Value(userKey{}).(string)
+		return user
+	})
+	inner := &contextBus{}
+	bus := UseEventBusMiddleware(inner, enricher.Middleware())
+
+	t.Log("publish without headers")
+	event := &TestEvent{NewUUID(), "event1"}
+	bus.PublishEvent(event)
+	if len(inner.headers) != 1 {
+		t.Fatal("the event should be published:", inner.headers)
+	}
+	headers := inner.headers[0]
+	if headers[HeaderTimestamp] != "2016-01-01T00:00:00Z" {
+		t.Error("the timestamp should be correct:", headers[HeaderTimestamp])
+	}
+	if headers[HeaderNodeID] != "node1" {
+		t.Error("the node ID should be correct:", headers[HeaderNodeID])
+	}
+	if headers[HeaderCorrelationID] == "" {
+		t.Error("there should be a correlation ID")
+	}
+	if _, ok := headers[HeaderUserID]; ok {
+		t.Error("there should be no user:", headers[HeaderUserID])
+	}
+
+	t.Log("publish with headers and user")
+	original := Headers{HeaderCorrelationID: "abc"}
+	ctx := NewContextWithHeaders(context.WithValue(context.Background(), userKey{}, "user1"), original)
+	PublishEventWithContext(ctx, bus, event)
+	headers = inner.headers[1]
+	if headers[HeaderCorrelationID] != "abc" || headers[HeaderUserID] != "user1" {
+		t.Error("the headers should be correct:", headers)
+	}
+	if len(original) != 1 {
+		t.Error("the headers of the context should not be changed:", original)
+	}
+
+	t.Log("publish a batch")
+	PublishEvents(bus, []Event{event, event})
+	if len(inner.headers) != 4 {
+		t.Fatal("the events should be published:", inner.headers)
+	}
+	if inner.headers[2][HeaderCorrelationID] != inner.headers[3][HeaderCorrelationID] ||
+		inner.headers[2][HeaderCorrelationID] == headers[HeaderCorrelationID] {
+		t.Error("the batch should have its own correlation ID:", inner.headers[2], inner.headers[3])
+	}
+}
+
+type userKey struct{}
+
+type contextBus struct {
+	EventBus
+	headers []Headers
+}
+
+func (b *contextBus) PublishEvent(event Event) {
+	b.PublishEventWithContext(context.Background(), event)
+}
+
+func (b *contextBus) PublishEventWithContext(ctx context.Context, event Event) {
+	b.headers = append(b.headers, HeadersFromContext(ctx))
+}
@@ -0,0 +1,31 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"time"
+)
+
+// EventEnvelope is an event together with the version and timestamp that it
+// has (or will have) in the event store. The position is set for events loaded
+// with GlobalEventStore.LoadAll, and the headers are those saved with the event
+// by stores that implement MetadataEventStore.
+type EventEnvelope struct {
+	Event     Event
+	Version   int
+	Timestamp time.Time
+	Position  Position
+	Headers   Headers
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+// EventError is an error of an event store or bus, with its underlying cause
+// and the event type and aggregate ID it happened for, when known. It matches
+// its sentinel error, such as the ErrCouldNotSaveAggregate of a store, with
+// errors.Is, and unwraps to its cause:
+//     if errors.Is(err, mongodb.ErrCouldNotSaveAggregate) { ... }
+//     var e *eventhorizon.EventError
+//     if errors.As(err, &e) { log.Println(e.AggregateID, e.Cause) }
+type EventError struct {
+	// Err is the sentinel error.
+	Err error
+	// Cause is the underlying error, if any.
+	Cause error
+	// EventType is the type of the event, if known.
+	EventType string
+	// AggregateID is the ID of the aggregate, if known.
+	AggregateID UUID
+}
+
+// Error implements the Error method of the error interface.
+func (e *EventError) Error() string {
+	msg := e.Err.Error()
+	if e.Cause != nil {
+		msg += ": " + e.Cause.Error()
+	}
+	if e.EventType != "" {
+		msg += ", event type " + e.EventType
+	}
+	if e.AggregateID != "" {
+		msg += ", aggregate " + string(e.AggregateID)
+	}
+	return msg
+}
+
+// Is returns true if the target is the sentinel error, for errors.Is.
+func (e *EventError) Is(target error) bool {
+	return e.Err == target
+}
+
+// Unwrap returns the cause, for errors.Is and errors.As.
+func (e *EventError) Unwrap() error {
+	return e.Cause
+}
@@ -0,0 +1,50 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEventError(t *testing.T) {
+	errSave := errors.New("could not save")
+	cause := errors.New("connection lost")
+	id := UUID("c1138e5f-f6fb-4dd0-8e79-255c6c8d3756")
+	var err error = &EventError{Err: errSave, Cause: cause, EventType: "TestEvent", AggregateID: id}
+
+	if err.Error() != "could not save: connection lost, event type TestEvent, aggregate "+string(id) {
+		t.Error("the error message should be correct:", err)
+	}
+	if !errors.Is(err, errSave) {
+		t.Error("the error should match the sentinel error")
+	}
+	if !errors.Is(err, cause) {
+		t.Error("the error should match the cause")
+	}
+	var e *EventError
+	if !errors.As(err, &e) || e.AggregateID != id {
+		t.Error("the error should be an EventError:", e)
+	}
+
+	t.Log("without cause")
+	err = &EventError{Err: errSave}
+	if err.Error() != "could not save" {
+		t.Error("the error message should be correct:", err)
+	}
+	if errors.Is(err, cause) {
+		t.Error("the error should not match another error")
+	}
+}
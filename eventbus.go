@@ -14,6 +14,10 @@
 
 package eventhorizon
 
+import (
+	"context"
+)
+
 // EventHandler is an interface that all handlers of events should implement.
 type EventHandler interface {
 	// HandleEvent handles an event.
@@ -31,3 +35,114 @@ type EventBus interface {
 	// AddGlobalHandler adds a handler for global (remote) events.
 	AddGlobalHandler(EventHandler)
 }
+
+// PartitionKeyFunc returns the key used to partition events. Buses that
+// partition the delivery of events keep the order of events with the same key.
+type PartitionKeyFunc func(Event) string
+
+// AggregatePartitionKey partitions events by aggregate ID, which keeps the order
+// of the events of each aggregate. It is the default partition key.
+func AggregatePartitionKey(event Event) string {
+	return event.AggregateID().String()
+}
+
+// EventBatchPublisher is an optional interface for event buses that can publish
+// several events more efficiently than one at a time.
+type EventBatchPublisher interface {
+	// PublishEvents publishes events on the event bus, in order.
+	PublishEvents([]Event)
+}
+
+// PublishEvents publishes events on an event bus, as one batch if the bus
+// implements EventBatchPublisher.
+func PublishEvents(bus EventBus, events []Event) {
+	if p, ok := bus.(EventBatchPublisher); ok {
+		p.PublishEvents(events)
+		return
+	}
+	for _, event := range events {
+		bus.PublishEvent(event)
+	}
+}
+
+// ContextEventPublisher is an optional interface for event buses that can
+// publish events with the headers of a context.
+type ContextEventPublisher interface {
+	// PublishEventWithContext publishes an event with the headers of the
+	// context.
+	PublishEventWithContext(context.Context, Event)
+}
+
+// PublishEventWithContext publishes an event with the headers of the context if
+// the bus implements ContextEventPublisher, otherwise the headers are dropped.
+func PublishEventWithContext(ctx context.Context, bus EventBus, event Event) {
+	if p, ok := bus.(ContextEventPublisher); ok {
+		p.PublishEventWithContext(ctx, event)
+		return
+	}
+	bus.PublishEvent(event)
+}
+
+// PriorityEventBus is an optional interface for event buses that can order the
+// handlers of an event type by priority, for example so that validating
+// projections handle events before notification handlers.
+type PriorityEventBus interface {
+	EventBus
+
+	// AddHandlerWithPriority adds a handler for a specific event with a
+	// priority. Handlers with higher priorities handle events first, and
+	// handlers added with AddHandler have priority 0.
+	AddHandlerWithPriority(EventHandler, Event, int)
+}
+
+// AddHandlerWithPriority adds a handler with a priority if the bus implements
+// PriorityEventBus, otherwise the handler is added without an order.
+func AddHandlerWithPriority(bus EventBus, handler EventHandler, event Event, priority int) {
+	if b, ok := bus.(PriorityEventBus); ok {
+		b.AddHandlerWithPriority(handler, event, priority)
+		return
+	}
+	bus.AddHandler(handler, event)
+}
+
+// ConcurrentEventBus is an optional interface for event buses that can handle
+// events for a global handler concurrently, for example so that notification
+// handlers can run wide while projectors handle one event at a time.
+type ConcurrentEventBus interface {
+	EventBus
+
+	// AddGlobalHandlerWithConcurrency adds a handler for global events that
+	// handles up to a number of events at the same time.
+	AddGlobalHandlerWithConcurrency(EventHandler, int)
+}
+
+// AddGlobalHandlerWithConcurrency adds a global handler with a concurrency if
+// the bus implements ConcurrentEventBus, otherwise the handler is added with
+// the concurrency of the bus.
+func AddGlobalHandlerWithConcurrency(bus EventBus, handler EventHandler, concurrency int) {
+	if b, ok := bus.(ConcurrentEventBus); ok {
+		b.AddGlobalHandlerWithConcurrency(handler, concurrency)
+		return
+	}
+	bus.AddGlobalHandler(handler)
+}
+
+// HandlerGroups is a list of named groups of handlers, in the order in which
+// they should handle events.
+type HandlerGroups []string
+
+// Priority returns the priority of a group, which is higher for earlier
+// groups. Unknown groups have priority 0, which is lower than for all groups.
+func (g HandlerGroups) Priority(group string) int {
+	for i, name := range g {
+		if name == group {
+			return len(g) - i
+		}
+	}
+	return 0
+}
+
+// AddHandler adds a handler to a group on a bus, see AddHandlerWithPriority.
+func (g HandlerGroups) AddHandler(bus EventBus, group string, handler EventHandler, event Event) {
+	AddHandlerWithPriority(bus, handler, event, g.Priority(group))
+}
@@ -0,0 +1,49 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPublishEvents(t *testing.T) {
+	event1 := &TestEvent{NewUUID(), "event1"}
+	event2 := &TestEvent{NewUUID(), "event2"}
+
+	t.Log("publish one by one")
+	bus := &MockEventBus{}
+	PublishEvents(bus, []Event{event1, event2})
+	if !reflect.DeepEqual(bus.Events, []Event{event1, event2}) {
+		t.Error("the events should be published:", bus.Events)
+	}
+
+	t.Log("publish as batch")
+	batchBus := &MockBatchEventBus{}
+	PublishEvents(batchBus, []Event{event1, event2})
+	if !reflect.DeepEqual(batchBus.Batches, [][]Event{{event1, event2}}) {
+		t.Error("the events should be published as a batch:", batchBus.Batches)
+	}
+}
+
+func TestHandlerGroups(t *testing.T) {
+	groups := HandlerGroups{"validation", "projection"}
+	if groups.Priority("validation") <= groups.Priority("projection") {
+		t.Error("earlier groups should have higher priorities")
+	}
+	if groups.Priority("projection") <= groups.Priority("other") {
+		t.Error("unknown groups should have the lowest priority")
+	}
+}
@@ -40,3 +40,9 @@ type Event interface {
 	AggregateType() string
 	EventType() string
 }
+
+// EventTypeRegisterer is an event store or bus that needs factories for the
+// event types, to create concrete events when decoding them.
+type EventTypeRegisterer interface {
+	RegisterEventType(event Event, factory func() Event) error
+}
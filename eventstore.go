@@ -15,7 +15,10 @@
 package eventhorizon
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"time"
 )
 
 // ErrNoEventsToAppend is when no events are available to append.
@@ -27,6 +30,31 @@ var ErrNoEventsFound = errors.New("could not find events")
 // ErrNoEventStoreDefined is if no event store has been defined.
 var ErrNoEventStoreDefined = errors.New("no event store defined")
 
+// ErrInvalidPosition is when a position is not valid for an event store.
+var ErrInvalidPosition = errors.New("invalid position")
+
+// ErrAggregateDeleted is when an aggregate has been deleted.
+var ErrAggregateDeleted = errors.New("aggregate is deleted")
+
+// ErrVersionConflict is when events could not be saved because other events
+// have been saved for the aggregate since its version was read. It contains the
+// conflicting events so that callers can decide to merge or retry.
+//
+// ExpectedVersion is the version of the caller, which is the version of the
+// aggregate when saving and the version of the event when importing, and
+// ActualVersion is the stored version.
+type ErrVersionConflict struct {
+	AggregateID       UUID
+	ExpectedVersion   int
+	ActualVersion     int
+	ConflictingEvents []Event
+}
+
+func (e ErrVersionConflict) Error() string {
+	return fmt.Sprintf("version conflict for aggregate %s: expected version %d, actual version %d",
+		e.AggregateID, e.ExpectedVersion, e.ActualVersion)
+}
+
 // EventStore is an interface for an event sourcing event store.
 type EventStore interface {
 	// Save appends all events in the event stream to the store.
@@ -36,6 +64,225 @@ type EventStore interface {
 	Load(UUID) ([]Event, error)
 }
 
+// EventIterator is an iterator over events loaded from an event store.
+type EventIterator interface {
+	// Next advances the iterator to the next event, it returns false when
+	// there are no more events or if an error occurred.
+	Next() bool
+
+	// Event returns the current event.
+	Event() Event
+
+	// Err returns the error that stopped the iteration, if any.
+	Err() error
+
+	// Close releases the resources used by the iterator.
+	Close() error
+}
+
+// IteratorEventStore is an event store that can stream the events of an
+// aggregate with an iterator instead of loading them all at once.
+type IteratorEventStore interface {
+	EventStore
+
+	// LoadIterator returns an iterator over all events for the aggregate id.
+	// An aggregate without events gives an iterator without events.
+	LoadIterator(UUID) (EventIterator, error)
+}
+
+// LoadIterator returns an iterator over all events for the aggregate id. The
+// events are streamed if the store implements IteratorEventStore, otherwise
+// they are loaded with Load.
+func LoadIterator(eventStore EventStore, id UUID) (EventIterator, error) {
+	if s, ok := eventStore.(IteratorEventStore); ok {
+		return s.LoadIterator(id)
+	}
+
+	events, err := eventStore.Load(id)
+	if err != nil && err != ErrNoEventsFound {
+		return nil, err
+	}
+	return NewSliceEventIterator(events), nil
+}
+
+// SliceEventIterator is an EventIterator over a slice of events.
+type SliceEventIterator struct {
+	events []Event
+	index  int
+}
+
+// NewSliceEventIterator creates an iterator over a slice of events.
+func NewSliceEventIterator(events []Event) *SliceEventIterator {
+	return &SliceEventIterator{
+		events: events,
+		index:  -1,
+	}
+}
+
+// Next implements the Next method of the EventIterator interface.
+func (i *SliceEventIterator) Next() bool {
+	if i.index+1 >= len(i.events) {
+		return false
+	}
+	i.index++
+	return true
+}
+
+// Event implements the Event method of the EventIterator interface.
+func (i *SliceEventIterator) Event() Event {
+	if i.index < 0 || i.index >= len(i.events) {
+		return nil
+	}
+	return i.events[i.index]
+}
+
+// Err implements the Err method of the EventIterator interface.
+func (i *SliceEventIterator) Err() error {
+	return nil
+}
+
+// Close implements the Close method of the EventIterator interface.
+func (i *SliceEventIterator) Close() error {
+	return nil
+}
+
+// Position is an opaque token for a position in the stream of all events in an
+// event store. The empty position is the start of the stream.
+type Position string
+
+// GlobalEventStore is an event store that can load the events of all
+// aggregates in the order that they were saved, for example for projections
+// that need all events.
+type GlobalEventStore interface {
+	EventStore
+
+	// LoadAll loads up to limit events after a position, or all of them if
+	// limit is 0. Each event has the position to resume from after it, and the
+	// returned position is the one to continue from with the next call.
+	LoadAll(ctx context.Context, from Position, limit int) ([]EventEnvelope, Position, error)
+}
+
+// SubscribableEventStore is an event store that notifies subscribers of saved
+// events, so that they don't have to poll the store.
+type SubscribableEventStore interface {
+	EventStore
+
+	// Subscribe returns a channel that receives the events saved after the
+	// call, with their positions. The channel is closed when the context is
+	// done.
+	Subscribe(ctx context.Context) <-chan EventEnvelope
+}
+
+// DeletableEventStore is an event store that can soft delete aggregates. A
+// deleted aggregate can't be loaded or saved, but its events are kept.
+type DeletableEventStore interface {
+	EventStore
+
+	// Delete marks an aggregate as deleted and appends an AggregateDeleted
+	// event to its stream, which is published for projections to clean up.
+	Delete(UUID) error
+}
+
+// MetadataEventStore is an event store that persists the headers of events
+// together with them, for example for auditing.
+type MetadataEventStore interface {
+	EventStore
+
+	// SaveWithContext saves events as Save, with the headers of the context.
+	SaveWithContext(context.Context, []Event) error
+
+	// LoadEnvelopes loads all events for the aggregate id in envelopes with
+	// their versions, timestamps and headers.
+	LoadEnvelopes(UUID) ([]EventEnvelope, error)
+}
+
+// SaveWithContext saves events with the headers of the context if the store
+// implements MetadataEventStore, otherwise the headers are dropped.
+func SaveWithContext(ctx context.Context, eventStore EventStore, events []Event) error {
+	if s, ok := eventStore.(MetadataEventStore); ok {
+		return s.SaveWithContext(ctx, events)
+	}
+	return eventStore.Save(events)
+}
+
+// VersionedEventStore is an event store that checks the version of an
+// aggregate when saving its events, so that changes saved since the aggregate
+// was loaded are reported instead of appended.
+type VersionedEventStore interface {
+	EventStore
+
+	// SaveWithVersion saves the events of one aggregate as SaveWithContext, if
+	// the stored version of the aggregate is the original version that the
+	// events were created at. Otherwise it returns an ErrVersionConflict with
+	// the events saved since.
+	SaveWithVersion(ctx context.Context, events []Event, originalVersion int) error
+}
+
+// Query is a query for events of all aggregates. Empty fields match all events.
+type Query struct {
+	// EventTypes are the event types to find, any of them matches.
+	EventTypes []string
+	// AggregateType is the aggregate type of the events to find.
+	AggregateType string
+	// From and To is the time range of the events to find, From inclusive and
+	// To exclusive.
+	From, To time.Time
+	// Limit is the max number of events to find, or 0 for all.
+	Limit int
+}
+
+// Matches returns true if an event with a timestamp matches the query.
+func (q Query) Matches(event Event, timestamp time.Time) bool {
+	if len(q.EventTypes) > 0 {
+		found := false
+		for _, eventType := range q.EventTypes {
+			if event.EventType() == eventType {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if q.AggregateType != "" && event.AggregateType() != q.AggregateType {
+		return false
+	}
+	if !q.From.IsZero() && timestamp.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && !timestamp.Before(q.To) {
+		return false
+	}
+	return true
+}
+
+// QueryableEventStore is an event store that can find events of all aggregates
+// by a query, for operational queries that should not load whole streams.
+type QueryableEventStore interface {
+	EventStore
+
+	// FindEvents finds the events matching a query, in the order they were
+	// saved.
+	FindEvents(context.Context, Query) ([]EventEnvelope, error)
+}
+
+// AggregateDeleted is the tombstone event appended to the stream of a deleted
+// aggregate.
+type AggregateDeleted struct {
+	ID   UUID   `bson:"id"`
+	Type string `bson:"type"`
+}
+
+// AggregateID implements the AggregateID method of the Event interface.
+func (e *AggregateDeleted) AggregateID() UUID { return e.ID }
+
+// AggregateType implements the AggregateType method of the Event interface.
+func (e *AggregateDeleted) AggregateType() string { return e.Type }
+
+// EventType implements the EventType method of the Event interface.
+func (e *AggregateDeleted) EventType() string { return "AggregateDeleted" }
+
 // AggregateRecord is a stored record of an aggregate in form of its events.
 type AggregateRecord interface {
 	AggregateID() UUID
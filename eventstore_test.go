@@ -0,0 +1,89 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestLoadIterator(t *testing.T) {
+	id := NewUUID()
+	event1 := &TestEvent{id, "event1"}
+	event2 := &TestEvent{id, "event2"}
+
+	t.Log("fall back to Load")
+	store := &MockEventStore{Events: []Event{event1, event2}}
+	iter, err := LoadIterator(store, id)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	events := []Event{}
+	for iter.Next() {
+		events = append(events, iter.Event())
+	}
+	if err := iter.Err(); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := iter.Close(); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(events, []Event{event1, event2}) {
+		t.Error("the iterated events should be correct:", events)
+	}
+	if store.Loaded != id {
+		t.Error("the events should be loaded with the id:", store.Loaded)
+	}
+
+	t.Log("no events found")
+	iter, err = LoadIterator(&errorEventStore{ErrNoEventsFound}, id)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if iter.Next() {
+		t.Error("there should be no events:", iter.Event())
+	}
+
+	t.Log("load error")
+	loadErr := errors.New("load error")
+	if _, err = LoadIterator(&errorEventStore{loadErr}, id); err != loadErr {
+		t.Error("there should be a load error:", err)
+	}
+}
+
+type errorEventStore struct {
+	err error
+}
+
+func (s *errorEventStore) Save(events []Event) error     { return s.err }
+func (s *errorEventStore) Load(id UUID) ([]Event, error) { return nil, s.err }
+
+func TestErrVersionConflict(t *testing.T) {
+	id, _ := ParseUUID("a4da289d-466d-4a56-4521-1dbd455aa0cd")
+	var err error = ErrVersionConflict{
+		AggregateID:       id,
+		ExpectedVersion:   1,
+		ActualVersion:     2,
+		ConflictingEvents: []Event{&TestEvent{id, "event2"}},
+	}
+	expected := "version conflict for aggregate a4da289d-466d-4a56-4521-1dbd455aa0cd: expected version 1, actual version 2"
+	if err.Error() != expected {
+		t.Error("the error message should be correct:", err)
+	}
+	if conflict, ok := err.(ErrVersionConflict); !ok || len(conflict.ConflictingEvents) != 1 {
+		t.Error("the conflicting events should be available:", err)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command devserver runs the invitation example with in-memory backends and an
+// HTTP endpoint, without Redis or MongoDB. Try it with:
+//     curl -X POST -d '{"InvitationID": "c1138e5f-f6fb-4dd0-8e79-255c6c8d3756", "Name": "Athena", "Age": 42}' localhost:8080/commands/CreateInvite
+//     curl localhost:8080/events
+//     curl localhost:8080/models/invitations
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/devserver"
+
+	"github.com/looplab/eventhorizon/examples/domain"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:8080", "the address to listen on")
+	flag.Parse()
+
+	server, err := devserver.NewServer()
+	if err != nil {
+		log.Fatalf("could not create server: %s", err)
+	}
+
+	if err := server.SetAggregate(&domain.InvitationAggregate{},
+		func(id eventhorizon.UUID) eventhorizon.Aggregate {
+			return &domain.InvitationAggregate{
+				AggregateBase: eventhorizon.NewAggregateBase(id),
+			}
+		},
+		&domain.CreateInvite{}, &domain.AcceptInvite{}, &domain.DeclineInvite{},
+	); err != nil {
+		log.Fatalf("could not set aggregate: %s", err)
+	}
+
+	if _, err := server.AddReadModel("invitations",
+		func(repository eventhorizon.ReadRepository) eventhorizon.EventHandler {
+			return &InvitationProjector{repository}
+		},
+		&domain.InviteCreated{}, &domain.InviteAccepted{}, &domain.InviteDeclined{},
+	); err != nil {
+		log.Fatalf("could not add read model: %s", err)
+	}
+
+	log.Println("listening on", *addr)
+	log.Fatal(http.ListenAndServe(*addr, server))
+}
+
+// Invitation is a read model object for an invitation.
+type Invitation struct {
+	ID     eventhorizon.UUID `json:"id"`
+	Name   string            `json:"name"`
+	Age    int               `json:"age"`
+	Status string            `json:"status"`
+}
+
+// InvitationProjector is a projector that updates the invitations.
+type InvitationProjector struct {
+	repository eventhorizon.ReadRepository
+}
+
+// HandleEvent implements the HandleEvent method of the EventHandler interface.
+func (p *InvitationProjector) HandleEvent(event eventhorizon.Event) {
+	switch event := event.(type) {
+	case *domain.InviteCreated:
+		p.repository.Save(event.InvitationID, &Invitation{
+			ID:     event.InvitationID,
+			Name:   event.Name,
+			Age:    event.Age,
+			Status: "created",
+		})
+	case *domain.InviteAccepted:
+		p.setStatus(event.InvitationID, "accepted")
+	case *domain.InviteDeclined:
+		p.setStatus(event.InvitationID, "declined")
+	}
+}
+
+func (p *InvitationProjector) setStatus(id eventhorizon.UUID, status string) {
+	m, err := p.repository.Find(id)
+	if err != nil {
+		return
+	}
+	i := m.(*Invitation)
+	i.Status = status
+	p.repository.Save(id, i)
+}
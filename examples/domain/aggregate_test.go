@@ -0,0 +1,66 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package domain
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/testutil"
+)
+
+func TestInvitationAggregate(t *testing.T) {
+	id := eventhorizon.NewUUID()
+
+	t.Log("create invite")
+	testutil.NewAggregateTest(t, newInvitation(id)).
+		When(&CreateInvite{id, "Athena", 42}).
+		Then(&InviteCreated{id, "Athena", 42})
+
+	t.Log("accept invite")
+	testutil.NewAggregateTest(t, newInvitation(id)).
+		Given(&InviteCreated{id, "Athena", 42}).
+		When(&AcceptInvite{id}).
+		Then(&InviteAccepted{id})
+
+	t.Log("accept already accepted invite")
+	testutil.NewAggregateTest(t, newInvitation(id)).
+		Given(&InviteCreated{id, "Athena", 42}, &InviteAccepted{id}).
+		When(&AcceptInvite{id}).
+		Then()
+
+	t.Log("decline accepted invite")
+	testutil.NewAggregateTest(t, newInvitation(id)).
+		Given(&InviteCreated{id, "Athena", 42}, &InviteAccepted{id}).
+		When(&DeclineInvite{id}).
+		ThenError(errors.New("Athena already accepted"))
+
+	t.Log("accept non-existing invite")
+	testutil.NewAggregateTest(t, newInvitation(id)).
+		When(&AcceptInvite{id}).
+		ThenError(errors.New("invitee does not exist"))
+
+	t.Log("accept non-existing invite with any error")
+	testutil.NewAggregateTest(t, newInvitation(id)).
+		When(&AcceptInvite{id}).
+		ThenError(nil)
+}
+
+func newInvitation(id eventhorizon.UUID) *InvitationAggregate {
+	return &InvitationAggregate{
+		AggregateBase: eventhorizon.NewAggregateBase(id),
+	}
+}
@@ -19,30 +19,21 @@ import (
 )
 
 // CreateInvite is a command for creating invites.
+//eh:command aggregate=InvitationAggregateType
 type CreateInvite struct {
 	InvitationID eventhorizon.UUID
 	Name         string
 	Age          int `eh:"optional"`
 }
 
-func (c *CreateInvite) AggregateID() eventhorizon.UUID { return c.InvitationID }
-func (c *CreateInvite) AggregateType() string          { return InvitationAggregateType }
-func (c *CreateInvite) CommandType() string            { return "CreateInvite" }
-
 // AcceptInvite is a command for accepting invites.
+//eh:command aggregate=InvitationAggregateType
 type AcceptInvite struct {
 	InvitationID eventhorizon.UUID
 }
 
-func (c *AcceptInvite) AggregateID() eventhorizon.UUID { return c.InvitationID }
-func (c *AcceptInvite) AggregateType() string          { return InvitationAggregateType }
-func (c *AcceptInvite) CommandType() string            { return "AcceptInvite" }
-
 // DeclineInvite is a command for declining invites.
+//eh:command aggregate=InvitationAggregateType
 type DeclineInvite struct {
 	InvitationID eventhorizon.UUID
 }
-
-func (c *DeclineInvite) AggregateID() eventhorizon.UUID { return c.InvitationID }
-func (c *DeclineInvite) AggregateType() string          { return InvitationAggregateType }
-func (c *DeclineInvite) CommandType() string            { return "DeclineInvite" }
@@ -14,35 +14,29 @@
 
 package domain
 
+// The methods and factories of the events and commands are generated.
+//go:generate go run github.com/looplab/eventhorizon/cmd/ehgen -out types_gen.go events.go commands.go
+
 import (
 	"github.com/looplab/eventhorizon"
 )
 
 // InviteCreated is an event for when an invite has been created.
+//eh:event aggregate=InvitationAggregateType
 type InviteCreated struct {
 	InvitationID eventhorizon.UUID `bson:"invitation_id"`
 	Name         string            `bson:"name"`
 	Age          int               `bson:"age"`
 }
 
-func (c *InviteCreated) AggregateID() eventhorizon.UUID { return c.InvitationID }
-func (c *InviteCreated) AggregateType() string          { return InvitationAggregateType }
-func (c *InviteCreated) EventType() string              { return "InviteCreated" }
-
 // InviteAccepted is an event for when an invite has been accepted.
+//eh:event aggregate=InvitationAggregateType
 type InviteAccepted struct {
 	InvitationID eventhorizon.UUID `bson:"invitation_id"`
 }
 
-func (c *InviteAccepted) AggregateID() eventhorizon.UUID { return c.InvitationID }
-func (c *InviteAccepted) AggregateType() string          { return InvitationAggregateType }
-func (c *InviteAccepted) EventType() string              { return "InviteAccepted" }
-
 // InviteDeclined is an event for when an invite has been declined.
+//eh:event aggregate=InvitationAggregateType
 type InviteDeclined struct {
 	InvitationID eventhorizon.UUID `bson:"invitation_id"`
 }
-
-func (c *InviteDeclined) AggregateID() eventhorizon.UUID { return c.InvitationID }
-func (c *InviteDeclined) AggregateType() string          { return InvitationAggregateType }
-func (c *InviteDeclined) EventType() string              { return "InviteDeclined" }
@@ -0,0 +1,32 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package domain
+
+import (
+	"testing"
+
+	"github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/codec/bson"
+	"github.com/looplab/eventhorizon/testutil"
+)
+
+func TestEventsGolden(t *testing.T) {
+	id := eventhorizon.UUID("c1138e5f-f6fb-4dd0-8e79-255c6c8d3756")
+	testutil.CheckGoldenEvents(t, "testdata", bson.EventCodec{}, RegisterEventTypes,
+		&InviteCreated{id, "Athena", 42},
+		&InviteAccepted{id},
+		&InviteDeclined{id},
+	)
+}
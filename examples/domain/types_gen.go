@@ -0,0 +1,78 @@
+// Code generated by ehgen. DO NOT EDIT.
+
+package domain
+
+import (
+	"github.com/looplab/eventhorizon"
+)
+
+func (t *InviteCreated) AggregateID() eventhorizon.UUID { return t.InvitationID }
+func (t *InviteCreated) AggregateType() string          { return InvitationAggregateType }
+func (t *InviteCreated) EventType() string              { return "InviteCreated" }
+
+// NewInviteCreated creates an empty InviteCreated event.
+func NewInviteCreated() eventhorizon.Event { return &InviteCreated{} }
+
+func (t *InviteAccepted) AggregateID() eventhorizon.UUID { return t.InvitationID }
+func (t *InviteAccepted) AggregateType() string          { return InvitationAggregateType }
+func (t *InviteAccepted) EventType() string              { return "InviteAccepted" }
+
+// NewInviteAccepted creates an empty InviteAccepted event.
+func NewInviteAccepted() eventhorizon.Event { return &InviteAccepted{} }
+
+func (t *InviteDeclined) AggregateID() eventhorizon.UUID { return t.InvitationID }
+func (t *InviteDeclined) AggregateType() string          { return InvitationAggregateType }
+func (t *InviteDeclined) EventType() string              { return "InviteDeclined" }
+
+// NewInviteDeclined creates an empty InviteDeclined event.
+func NewInviteDeclined() eventhorizon.Event { return &InviteDeclined{} }
+
+func (t *CreateInvite) AggregateID() eventhorizon.UUID { return t.InvitationID }
+func (t *CreateInvite) AggregateType() string          { return InvitationAggregateType }
+func (t *CreateInvite) CommandType() string            { return "CreateInvite" }
+
+// NewCreateInvite creates an empty CreateInvite command.
+func NewCreateInvite() eventhorizon.Command { return &CreateInvite{} }
+
+func (t *AcceptInvite) AggregateID() eventhorizon.UUID { return t.InvitationID }
+func (t *AcceptInvite) AggregateType() string          { return InvitationAggregateType }
+func (t *AcceptInvite) CommandType() string            { return "AcceptInvite" }
+
+// NewAcceptInvite creates an empty AcceptInvite command.
+func NewAcceptInvite() eventhorizon.Command { return &AcceptInvite{} }
+
+func (t *DeclineInvite) AggregateID() eventhorizon.UUID { return t.InvitationID }
+func (t *DeclineInvite) AggregateType() string          { return InvitationAggregateType }
+func (t *DeclineInvite) CommandType() string            { return "DeclineInvite" }
+
+// NewDeclineInvite creates an empty DeclineInvite command.
+func NewDeclineInvite() eventhorizon.Command { return &DeclineInvite{} }
+
+// RegisterEventTypes registers the factories of the events with an event store
+// or bus.
+func RegisterEventTypes(r eventhorizon.EventTypeRegisterer) error {
+	if err := r.RegisterEventType(&InviteCreated{}, NewInviteCreated); err != nil {
+		return err
+	}
+	if err := r.RegisterEventType(&InviteAccepted{}, NewInviteAccepted); err != nil {
+		return err
+	}
+	if err := r.RegisterEventType(&InviteDeclined{}, NewInviteDeclined); err != nil {
+		return err
+	}
+	return nil
+}
+
+// RegisterCommandTypes registers the factories of the commands.
+func RegisterCommandTypes() error {
+	if err := eventhorizon.RegisterCommandType(NewCreateInvite); err != nil {
+		return err
+	}
+	if err := eventhorizon.RegisterCommandType(NewAcceptInvite); err != nil {
+		return err
+	}
+	if err := eventhorizon.RegisterCommandType(NewDeclineInvite); err != nil {
+		return err
+	}
+	return nil
+}
@@ -27,6 +27,11 @@ import (
 )
 
 func main() {
+	// Create the app that closes the stores and repositories on exit, in the
+	// reverse order that they are added.
+	app := eventhorizon.NewApp(eventhorizon.SystemClock{})
+	defer app.Close()
+
 	// Create the event bus that distributes events.
 	eventBus := local.NewEventBus()
 	eventBus.AddGlobalHandler(&LoggerSubscriber{})
@@ -36,10 +41,11 @@ func main() {
 	if err != nil {
 		log.Fatalf("could not create event store: %s", err)
 	}
+	app.Add("event store", eventStore)
 
-	eventStore.RegisterEventType(&domain.InviteCreated{}, func() eventhorizon.Event { return &domain.InviteCreated{} })
-	eventStore.RegisterEventType(&domain.InviteAccepted{}, func() eventhorizon.Event { return &domain.InviteAccepted{} })
-	eventStore.RegisterEventType(&domain.InviteDeclined{}, func() eventhorizon.Event { return &domain.InviteDeclined{} })
+	if err := domain.RegisterEventTypes(eventStore); err != nil {
+		log.Fatalf("could not register event types: %s", err)
+	}
 
 	// Create the aggregate repository.
 	repository, err := eventhorizon.NewCallbackRepository(eventStore)
@@ -79,6 +85,7 @@ func main() {
 	if err != nil {
 		log.Fatalf("could not create invitation repository: %s", err)
 	}
+	app.Add("invitation repository", invitationRepository)
 	invitationRepository.SetModel(func() interface{} { return &Invitation{} })
 	invitationProjector := NewInvitationProjector(invitationRepository)
 	eventBus.AddHandler(invitationProjector, &domain.InviteCreated{})
@@ -91,6 +98,7 @@ func main() {
 	if err != nil {
 		log.Fatalf("could not create guest list repository: %s", err)
 	}
+	app.Add("guest list repository", guestListRepository)
 	guestListRepository.SetModel(func() interface{} { return &GuestList{} })
 	guestListProjector := NewGuestListProjector(guestListRepository, eventID)
 	eventBus.AddHandler(guestListProjector, &domain.InviteCreated{})
@@ -77,10 +77,11 @@ func main() {
 	// Create and register a read model for a guest list.
 	eventID := eventhorizon.NewUUID()
 	guestListRepository := memory.NewReadRepository()
-	guestListProjector := NewGuestListProjector(guestListRepository, eventID)
-	eventBus.AddHandler(guestListProjector, &domain.InviteCreated{})
-	eventBus.AddHandler(guestListProjector, &domain.InviteAccepted{})
-	eventBus.AddHandler(guestListProjector, &domain.InviteDeclined{})
+	guestListProjector, err := NewGuestListProjector(guestListRepository, eventID)
+	if err != nil {
+		log.Fatalf("could not create guest list projector: %s", err)
+	}
+	guestListProjector.AddToBus(eventBus)
 
 	// Issue some invitations and responses.
 	// Note that Athena tries to decline the event, but that is not allowed
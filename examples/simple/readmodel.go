@@ -15,6 +15,8 @@
 package main
 
 import (
+	"context"
+
 	"github.com/looplab/eventhorizon"
 
 	"github.com/looplab/eventhorizon/examples/domain"
@@ -27,40 +29,8 @@ type Invitation struct {
 	Status string
 }
 
-// InvitationProjector is a projector that updates the invitations.
-type InvitationProjector struct {
-	repository eventhorizon.ReadRepository
-}
-
-// NewInvitationProjector creates a new InvitationProjector.
-func NewInvitationProjector(repository eventhorizon.ReadRepository) *InvitationProjector {
-	p := &InvitationProjector{
-		repository: repository,
-	}
-	return p
-}
-
-// HandleEvent implements the HandleEvent method of the EventHandler interface.
-func (p *InvitationProjector) HandleEvent(event eventhorizon.Event) {
-	switch event := event.(type) {
-	case *domain.InviteCreated:
-		i := &Invitation{
-			ID:   event.InvitationID,
-			Name: event.Name,
-		}
-		p.repository.Save(i.ID, i)
-	case *domain.InviteAccepted:
-		m, _ := p.repository.Find(event.InvitationID)
-		i := m.(*Invitation)
-		i.Status = "accepted"
-		p.repository.Save(i.ID, i)
-	case *domain.InviteDeclined:
-		m, _ := p.repository.Find(event.InvitationID)
-		i := m.(*Invitation)
-		i.Status = "declined"
-		p.repository.Save(i.ID, i)
-	}
-}
+// The InvitationProjector is generated from projector.json.
+//go:generate go run github.com/looplab/eventhorizon/cmd/ehprojector -in projector.json -out invitationprojector_gen.go
 
 // GuestList is a read model object for the guest list.
 type GuestList struct {
@@ -75,34 +45,58 @@ type GuestListProjector struct {
 	eventID    eventhorizon.UUID
 }
 
-// NewGuestListProjector creates a new GuestListProjector.
-func NewGuestListProjector(repository eventhorizon.ReadRepository, eventID eventhorizon.UUID) *GuestListProjector {
+// NewGuestListProjector creates a new projector for the guest list, which
+// handles each invite event with a typed handler.
+func NewGuestListProjector(repository eventhorizon.ReadRepository, eventID eventhorizon.UUID) (*eventhorizon.Projector, error) {
 	p := &GuestListProjector{
 		repository: repository,
 		eventID:    eventID,
 	}
-	return p
+	return eventhorizon.NewProjector(eventhorizon.SystemClock{}).
+		Named("GuestListProjector").
+		On(&domain.InviteCreated{}, eventhorizon.HandlerFunc[*domain.InviteCreated](p.inviteCreated)).
+		On(&domain.InviteAccepted{}, eventhorizon.HandlerFunc[*domain.InviteAccepted](p.inviteAccepted)).
+		On(&domain.InviteDeclined{}, eventhorizon.HandlerFunc[*domain.InviteDeclined](p.inviteDeclined)).
+		Build()
 }
 
-// HandleEvent implements the HandleEvent method of the EventHandler interface.
-func (p *GuestListProjector) HandleEvent(event eventhorizon.Event) {
-	switch event.(type) {
-	case *domain.InviteCreated:
-		m, _ := p.repository.Find(p.eventID)
-		if m == nil {
-			m = &GuestList{}
-		}
-		g := m.(*GuestList)
-		p.repository.Save(p.eventID, g)
-	case *domain.InviteAccepted:
-		m, _ := p.repository.Find(p.eventID)
-		g := m.(*GuestList)
-		g.NumAccepted++
-		p.repository.Save(p.eventID, g)
-	case *domain.InviteDeclined:
-		m, _ := p.repository.Find(p.eventID)
-		g := m.(*GuestList)
-		g.NumDeclined++
-		p.repository.Save(p.eventID, g)
+func (p *GuestListProjector) inviteCreated(ctx context.Context, event *domain.InviteCreated) error {
+	g, err := p.guestList()
+	if err != nil {
+		return err
+	}
+	return p.repository.Save(p.eventID, g)
+}
+
+func (p *GuestListProjector) inviteAccepted(ctx context.Context, event *domain.InviteAccepted) error {
+	g, err := p.guestList()
+	if err != nil {
+		return err
+	}
+	g.NumAccepted++
+	return p.repository.Save(p.eventID, g)
+}
+
+func (p *GuestListProjector) inviteDeclined(ctx context.Context, event *domain.InviteDeclined) error {
+	g, err := p.guestList()
+	if err != nil {
+		return err
+	}
+	g.NumDeclined++
+	return p.repository.Save(p.eventID, g)
+}
+
+// guestList finds the guest list, or creates it if there is none.
+func (p *GuestListProjector) guestList() (*GuestList, error) {
+	m, err := p.repository.Find(p.eventID)
+	if err == eventhorizon.ErrModelNotFound {
+		return &GuestList{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	g, ok := m.(*GuestList)
+	if !ok {
+		return nil, eventhorizon.ErrModelNotFound
 	}
+	return g, nil
 }
@@ -0,0 +1,168 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrNotRemovable is when handlers are removed from an event bus that can not
+// remove them.
+var ErrNotRemovable = errors.New("event bus can not remove handlers")
+
+// HandlerRemover is an optional interface for event buses that can remove
+// handlers while running. The remove methods return when the events being
+// delivered to the handler have been handled, so that a removed handler is not
+// called after that. A handler must not remove itself while handling an event,
+// as it would wait for itself.
+type HandlerRemover interface {
+	// RemoveHandler removes a handler for a specific local event.
+	RemoveHandler(EventHandler, Event)
+	// RemoveLocalHandler removes a handler for local events.
+	RemoveLocalHandler(EventHandler)
+	// RemoveGlobalHandler removes a handler for global (remote) events.
+	RemoveGlobalHandler(EventHandler)
+}
+
+// DeliveryTracker counts the events being delivered to each handler, for event
+// buses to wait for them when a handler is removed. A bus calls Begin for the
+// handlers while holding the lock that RemoveHandler takes to remove them, and
+// End when the handler has handled the event. The zero value is ready to use.
+type DeliveryTracker struct {
+	inflight map[EventHandler]int
+	cond     *sync.Cond
+	mu       sync.Mutex
+}
+
+// Begin counts an event being delivered to a handler.
+func (t *DeliveryTracker) Begin(handler EventHandler) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.inflight == nil {
+		t.inflight = make(map[EventHandler]int)
+	}
+	t.inflight[handler]++
+}
+
+// End counts an event as handled by a handler.
+func (t *DeliveryTracker) End(handler EventHandler) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.inflight[handler]--; t.inflight[handler] <= 0 {
+		delete(t.inflight, handler)
+		if t.cond != nil {
+			t.cond.Broadcast()
+		}
+	}
+}
+
+// Wait waits until there are no events being delivered to a handler.
+func (t *DeliveryTracker) Wait(handler EventHandler) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.cond == nil {
+		t.cond = sync.NewCond(&t.mu)
+	}
+	for t.inflight[handler] > 0 {
+		t.cond.Wait()
+	}
+}
+
+// HandlerSet is a set of handlers that are added to and removed from an event
+// bus together, such as the projections and sagas of a module that is loaded
+// and unloaded at runtime:
+//     set := eventhorizon.NewHandlerSet()
+//     set.AddHandler(invitationProjector, &InviteCreated{})
+//     set.AddGlobalHandler(responseSaga)
+//     set.AddToBus(bus)
+//     ...
+//     err := set.RemoveFromBus(bus)
+type HandlerSet struct {
+	handlers []setHandler
+	mu       sync.Mutex
+}
+
+type setHandler struct {
+	handler EventHandler
+	event   Event // Nil for local and global handlers.
+	global  bool
+}
+
+// NewHandlerSet creates an empty HandlerSet.
+func NewHandlerSet() *HandlerSet {
+	return &HandlerSet{}
+}
+
+// AddHandler adds a handler for a specific event to the set.
+func (s *HandlerSet) AddHandler(handler EventHandler, event Event) {
+	s.add(setHandler{handler: handler, event: event})
+}
+
+// AddLocalHandler adds a handler for local events to the set.
+func (s *HandlerSet) AddLocalHandler(handler EventHandler) {
+	s.add(setHandler{handler: handler})
+}
+
+// AddGlobalHandler adds a handler for global (remote) events to the set.
+func (s *HandlerSet) AddGlobalHandler(handler EventHandler) {
+	s.add(setHandler{handler: handler, global: true})
+}
+
+func (s *HandlerSet) add(h setHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers = append(s.handlers, h)
+}
+
+// AddToBus adds the handlers of the set to an event bus.
+func (s *HandlerSet) AddToBus(bus EventBus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, h := range s.handlers {
+		switch {
+		case h.event != nil:
+			bus.AddHandler(h.handler, h.event)
+		case h.global:
+			bus.AddGlobalHandler(h.handler)
+		default:
+			bus.AddLocalHandler(h.handler)
+		}
+	}
+}
+
+// RemoveFromBus removes the handlers of the set from an event bus, and returns
+// when they have handled the events being delivered to them. Returns
+// ErrNotRemovable if the bus does not implement HandlerRemover.
+func (s *HandlerSet) RemoveFromBus(bus EventBus) error {
+	r, ok := bus.(HandlerRemover)
+	if !ok {
+		return ErrNotRemovable
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, h := range s.handlers {
+		switch {
+		case h.event != nil:
+			r.RemoveHandler(h.handler, h.event)
+		case h.global:
+			r.RemoveGlobalHandler(h.handler)
+		default:
+			r.RemoveLocalHandler(h.handler)
+		}
+	}
+	return nil
+}
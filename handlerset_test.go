@@ -0,0 +1,111 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDeliveryTracker(t *testing.T) {
+	tracker := &DeliveryTracker{}
+	handler := NewEventHandlerFunc(func(Event) {})
+
+	t.Log("wait without deliveries")
+	tracker.Wait(handler)
+
+	t.Log("wait for a delivery")
+	tracker.Begin(handler)
+	done := make(chan struct{})
+	go func() {
+		tracker.Wait(handler)
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Error("the wait should not be done before the delivery")
+	case <-time.After(10 * time.Millisecond):
+	}
+	tracker.End(handler)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("the wait should be done after the delivery")
+	}
+}
+
+func TestHandlerSet(t *testing.T) {
+	handler1 := NewEventHandlerFunc(func(Event) {})
+	handler2 := NewEventHandlerFunc(func(Event) {})
+	handler3 := NewEventHandlerFunc(func(Event) {})
+	set := NewHandlerSet()
+	set.AddHandler(handler1, &TestEvent{})
+	set.AddLocalHandler(handler2)
+	set.AddGlobalHandler(handler3)
+
+	t.Log("add to a bus")
+	bus := &removableEventBus{}
+	set.AddToBus(bus)
+	expected := []string{"add TestEvent", "add local", "add global"}
+	if !reflect.DeepEqual(bus.calls, expected) {
+		t.Error("the handlers should be added:", bus.calls)
+	}
+
+	t.Log("remove from a bus")
+	bus.calls = nil
+	if err := set.RemoveFromBus(bus); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	expected = []string{"remove TestEvent", "remove local", "remove global"}
+	if !reflect.DeepEqual(bus.calls, expected) {
+		t.Error("the handlers should be removed:", bus.calls)
+	}
+
+	t.Log("remove from a bus that can not remove handlers")
+	if err := set.RemoveFromBus(&handlerEventBus{}); err != ErrNotRemovable {
+		t.Error("there should be a ErrNotRemovable error:", err)
+	}
+}
+
+type removableEventBus struct {
+	calls []string
+}
+
+func (b *removableEventBus) PublishEvent(event Event) {}
+
+func (b *removableEventBus) AddHandler(handler EventHandler, event Event) {
+	b.calls = append(b.calls, "add "+event.EventType())
+}
+
+func (b *removableEventBus) AddLocalHandler(handler EventHandler) {
+	b.calls = append(b.calls, "add local")
+}
+
+func (b *removableEventBus) AddGlobalHandler(handler EventHandler) {
+	b.calls = append(b.calls, "add global")
+}
+
+func (b *removableEventBus) RemoveHandler(handler EventHandler, event Event) {
+	b.calls = append(b.calls, "remove "+event.EventType())
+}
+
+func (b *removableEventBus) RemoveLocalHandler(handler EventHandler) {
+	b.calls = append(b.calls, "remove local")
+}
+
+func (b *removableEventBus) RemoveGlobalHandler(handler EventHandler) {
+	b.calls = append(b.calls, "remove global")
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+)
+
+// Headers is metadata that is sent together with an event by buses that
+// support it, but is not part of the event itself. Examples are trace IDs and
+// the tenant or user that caused the event.
+type Headers map[string]string
+
+// Well known headers, for tracing events to the commands and users that caused
+// them.
+const (
+	HeaderCorrelationID = "correlation_id"
+	HeaderCausationID   = "causation_id"
+	HeaderUserID        = "user_id"
+	HeaderEventID       = "event_id"
+	HeaderCommandID     = "command_id"
+	HeaderTimestamp     = "timestamp"
+	HeaderNodeID        = "node_id"
+)
+
+type headersKey struct{}
+
+// NewContextWithHeaders returns a context with headers, for publishing with
+// them or for passing them on to handlers.
+func NewContextWithHeaders(ctx context.Context, headers Headers) context.Context {
+	return context.WithValue(ctx, headersKey{}, headers)
+}
+
+// HeadersFromContext returns the headers of a context, or nil if there are
+// none.
+func HeadersFromContext(ctx context.Context) Headers {
+	headers, _ := ctx.Value(headersKey{}).(Headers)
+	return headers
+}
+
+// ContextEventHandler is an optional interface for event handlers that want
+// the context of the events they handle, with the headers of the events.
+type ContextEventHandler interface {
+	EventHandler
+
+	// HandleEventWithContext handles an event with its context.
+	HandleEventWithContext(context.Context, Event)
+}
+
+// HandleEventWithContext lets a handler handle an event, with the context if
+// the handler implements ContextEventHandler.
+func HandleEventWithContext(ctx context.Context, handler EventHandler, event Event) {
+	if h, ok := handler.(ContextEventHandler); ok {
+		h.HandleEventWithContext(ctx, event)
+		return
+	}
+	handler.HandleEvent(event)
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestHeaders(t *testing.T) {
+	ctx := context.Background()
+	if headers := HeadersFromContext(ctx); headers != nil {
+		t.Error("there should be no headers:", headers)
+	}
+
+	headers := Headers{"trace": "abc"}
+	ctx = NewContextWithHeaders(ctx, headers)
+	if h := HeadersFromContext(ctx); !reflect.DeepEqual(h, headers) {
+		t.Error("the headers should be correct:", h)
+	}
+}
+
+func TestHandleEventWithContext(t *testing.T) {
+	ctx := NewContextWithHeaders(context.Background(), Headers{"trace": "abc"})
+	event := &TestEvent{NewUUID(), "event1"}
+
+	t.Log("handler without context")
+	var events []Event
+	HandleEventWithContext(ctx, NewEventHandlerFunc(func(event Event) {
+		events = append(events, event)
+	}), event)
+	if !reflect.DeepEqual(events, []Event{event}) {
+		t.Error("the event should be handled:", events)
+	}
+
+	t.Log("handler with context")
+	handler := &contextHandler{}
+	HandleEventWithContext(ctx, handler, event)
+	if handler.event != event || handler.headers["trace"] != "abc" {
+		t.Error("the event should be handled with context:", handler.event, handler.headers)
+	}
+}
+
+type contextHandler struct {
+	event   Event
+	headers Headers
+}
+
+func (h *contextHandler) HandleEvent(event Event) {
+	h.HandleEventWithContext(context.Background(), event)
+}
+
+func (h *contextHandler) HandleEventWithContext(ctx context.Context, event Event) {
+	h.event = event
+	h.headers = HeadersFromContext(ctx)
+}
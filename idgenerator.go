@@ -0,0 +1,307 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+)
+
+// IDGenerator creates and parses IDs, for example to use IDs that can be
+// sorted by their creation time, which gives better index locality in stores.
+type IDGenerator interface {
+	// NewID creates a new unique ID.
+	NewID() UUID
+
+	// ParseID parses an ID from a string representation.
+	ParseID(string) (UUID, error)
+}
+
+var idGenerator IDGenerator = UUIDv4Generator{}
+var idGeneratorMu sync.RWMutex
+
+// SetIDGenerator sets the ID generator used by NewUUID and when unmarshaling
+// IDs. It should be set before any IDs are created.
+func SetIDGenerator(generator IDGenerator) {
+	idGeneratorMu.Lock()
+	defer idGeneratorMu.Unlock()
+	idGenerator = generator
+}
+
+func currentIDGenerator() IDGenerator {
+	idGeneratorMu.RLock()
+	defer idGeneratorMu.RUnlock()
+	return idGenerator
+}
+
+var aggregateIDGenerators = make(map[string]IDGenerator)
+
+// SetAggregateIDGenerator sets the ID generator used by NewAggregateID for an
+// aggregate type, for example a PrefixIDGenerator to tell the IDs of different
+// aggregate types apart. A nil generator removes it.
+func SetAggregateIDGenerator(aggregateType string, generator IDGenerator) {
+	idGeneratorMu.Lock()
+	defer idGeneratorMu.Unlock()
+	if generator == nil {
+		delete(aggregateIDGenerators, aggregateType)
+		return
+	}
+	aggregateIDGenerators[aggregateType] = generator
+}
+
+// NewAggregateID creates a new ID for an aggregate of a type, with the ID
+// generator of the type if set or else with NewUUID. It should be used to mint
+// the IDs of new aggregates, for example when creating commands for them.
+func NewAggregateID(aggregateType string) UUID {
+	idGeneratorMu.RLock()
+	generator, ok := aggregateIDGenerators[aggregateType]
+	idGeneratorMu.RUnlock()
+	if ok {
+		return generator.NewID()
+	}
+	return NewUUID()
+}
+
+// ParseID parses an ID with the ID generator, or with the ID generators of the
+// aggregate types if it fails. It is used when unmarshaling IDs.
+func ParseID(s string) (UUID, error) {
+	idGeneratorMu.RLock()
+	defer idGeneratorMu.RUnlock()
+	id, err := idGenerator.ParseID(s)
+	if err == nil {
+		return id, nil
+	}
+	for _, generator := range aggregateIDGenerators {
+		if id, err := generator.ParseID(s); err == nil {
+			return id, nil
+		}
+	}
+	return "", err
+}
+
+// ErrInvalidIDPrefix is when a string does not have the prefix of the IDs.
+var ErrInvalidIDPrefix = errors.New("invalid ID prefix")
+
+// PrefixIDGenerator creates IDs with another generator and adds a prefix to
+// them, such as "order_".
+type PrefixIDGenerator struct {
+	prefix    string
+	generator IDGenerator
+}
+
+// NewPrefixIDGenerator creates a new PrefixIDGenerator.
+func NewPrefixIDGenerator(prefix string, generator IDGenerator) *PrefixIDGenerator {
+	return &PrefixIDGenerator{
+		prefix:    prefix,
+		generator: generator,
+	}
+}
+
+// NewID implements the NewID method of the IDGenerator interface.
+func (g *PrefixIDGenerator) NewID() UUID {
+	return UUID(g.prefix) + g.generator.NewID()
+}
+
+// ParseID implements the ParseID method of the IDGenerator interface.
+func (g *PrefixIDGenerator) ParseID(s string) (UUID, error) {
+	if !strings.HasPrefix(s, g.prefix) {
+		return "", ErrInvalidIDPrefix
+	}
+	id, err := g.generator.ParseID(s[len(g.prefix):])
+	if err != nil {
+		return "", err
+	}
+	return UUID(g.prefix) + id, nil
+}
+
+// UUIDv4Generator creates random UUIDs of type v4, which is the default.
+type UUIDv4Generator struct{}
+
+// NewID implements the NewID method of the IDGenerator interface.
+func (UUIDv4Generator) NewID() UUID {
+	return newUUIDv4()
+}
+
+// ParseID implements the ParseID method of the IDGenerator interface.
+func (UUIDv4Generator) ParseID(s string) (UUID, error) {
+	return ParseUUID(s)
+}
+
+// UUIDv7Generator creates UUIDs of type v7, which start with the time in
+// milliseconds and are sortable by it.
+type UUIDv7Generator struct {
+	clock Clock
+}
+
+// NewUUIDv7Generator creates a new UUIDv7Generator. The clock is used for the
+// time of the IDs.
+func NewUUIDv7Generator(clock Clock) *UUIDv7Generator {
+	return &UUIDv7Generator{
+		clock: clock,
+	}
+}
+
+// NewID implements the NewID method of the IDGenerator interface.
+func (g *UUIDv7Generator) NewID() UUID {
+	var u [16]byte
+	randomBytes(u[6:])
+	putMillis(u[:6], g.clock)
+
+	// Set the RFC4122 flag.
+	u[8] = (u[8] & 0xBF) | 0x80
+
+	// Set the version to 7.
+	u[6] = (u[6] & 0xF) | 0x70
+
+	return UUID(fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:]))
+}
+
+// ParseID implements the ParseID method of the IDGenerator interface.
+func (g *UUIDv7Generator) ParseID(s string) (UUID, error) {
+	return ParseUUID(s)
+}
+
+// ErrInvalidULID is when a string is not a valid ULID.
+var ErrInvalidULID = errors.New("invalid ULID string")
+
+// ulidAlphabet is the Crockford base32 alphabet used by ULIDs.
+const ulidAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULIDGenerator creates ULIDs, which start with the time in milliseconds and
+// are sortable by it. They are 26 characters in Crockford base32.
+type ULIDGenerator struct {
+	clock Clock
+}
+
+// NewULIDGenerator creates a new ULIDGenerator. The clock is used for the time
+// of the IDs.
+func NewULIDGenerator(clock Clock) *ULIDGenerator {
+	return &ULIDGenerator{
+		clock: clock,
+	}
+}
+
+// NewID implements the NewID method of the IDGenerator interface.
+func (g *ULIDGenerator) NewID() UUID {
+	var u [16]byte
+	randomBytes(u[6:])
+	putMillis(u[:6], g.clock)
+	return UUID(encodeBase(u[:], ulidAlphabet, 26))
+}
+
+// ParseID implements the ParseID method of the IDGenerator interface.
+func (g *ULIDGenerator) ParseID(s string) (UUID, error) {
+	if !decodesToBytes(s, ulidAlphabet, 26, 16) {
+		return "", ErrInvalidULID
+	}
+	return UUID(s), nil
+}
+
+// ErrInvalidKSUID is when a string is not a valid KSUID.
+var ErrInvalidKSUID = errors.New("invalid KSUID string")
+
+// ksuidAlphabet is the base62 alphabet used by KSUIDs.
+const ksuidAlphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// ksuidEpoch is the start of the time of KSUIDs, in Unix seconds.
+const ksuidEpoch = 1400000000
+
+// KSUIDGenerator creates KSUIDs, which start with the time in seconds and are
+// sortable by it. They are 27 characters in base62.
+type KSUIDGenerator struct {
+	clock Clock
+}
+
+// NewKSUIDGenerator creates a new KSUIDGenerator. The clock is used for the
+// time of the IDs.
+func NewKSUIDGenerator(clock Clock) *KSUIDGenerator {
+	return &KSUIDGenerator{
+		clock: clock,
+	}
+}
+
+// NewID implements the NewID method of the IDGenerator interface.
+func (g *KSUIDGenerator) NewID() UUID {
+	var u [20]byte
+	randomBytes(u[4:])
+	binary.BigEndian.PutUint32(u[:4], uint32(g.clock.Now().Unix()-ksuidEpoch))
+	return UUID(encodeBase(u[:], ksuidAlphabet, 27))
+}
+
+// ParseID implements the ParseID method of the IDGenerator interface.
+func (g *KSUIDGenerator) ParseID(s string) (UUID, error) {
+	if !decodesToBytes(s, ksuidAlphabet, 27, 20) {
+		return "", ErrInvalidKSUID
+	}
+	return UUID(s), nil
+}
+
+// randomBytes fills a slice with random bytes.
+func randomBytes(b []byte) {
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+}
+
+// putMillis puts the time of a clock in Unix milliseconds as 48 bits.
+func putMillis(b []byte, clock Clock) {
+	var ms [8]byte
+	binary.BigEndian.PutUint64(ms[:], uint64(clock.Now().UnixNano()/1e6))
+	copy(b, ms[2:])
+}
+
+// encodeBase encodes bytes as a big endian number with an alphabet, padded to
+// a fixed length so that the strings sort as the bytes.
+func encodeBase(b []byte, alphabet string, length int) string {
+	n := new(big.Int).SetBytes(b)
+	base := big.NewInt(int64(len(alphabet)))
+	mod := new(big.Int)
+	s := make([]byte, length)
+	for i := length - 1; i >= 0; i-- {
+		n.DivMod(n, base, mod)
+		s[i] = alphabet[mod.Int64()]
+	}
+	return string(s)
+}
+
+// decodesToBytes returns true if a string of a length with an alphabet is a
+// number that fits in a number of bytes.
+func decodesToBytes(s, alphabet string, length, size int) bool {
+	if len(s) != length {
+		return false
+	}
+	n := new(big.Int)
+	base := big.NewInt(int64(len(alphabet)))
+	for i := 0; i < len(s); i++ {
+		digit := -1
+		for j := 0; j < len(alphabet); j++ {
+			if alphabet[j] == s[i] {
+				digit = j
+				break
+			}
+		}
+		if digit < 0 {
+			return false
+		}
+		n.Mul(n, base)
+		n.Add(n, big.NewInt(int64(digit)))
+	}
+	return n.BitLen() <= size*8
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIDGenerators(t *testing.T) {
+	clock := &tickClock{now: time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)}
+	uuidv7 := NewUUIDv7Generator(clock)
+	ulid := NewULIDGenerator(clock)
+	ksuid := NewKSUIDGenerator(clock)
+
+	generators := map[string]IDGenerator{
+		"UUIDv4": UUIDv4Generator{},
+		"UUIDv7": uuidv7,
+		"ULID":   ulid,
+		"KSUID":  ksuid,
+	}
+	for name, generator := range generators {
+		t.Log(name)
+		id := generator.NewID()
+		if id == generator.NewID() {
+			t.Error("the IDs should be unique:", id)
+		}
+		parsed, err := generator.ParseID(id.String())
+		if err != nil {
+			t.Error("there should be no error:", err)
+		}
+		if parsed != id {
+			t.Error("the ID should be correct:", parsed)
+		}
+		if _, err := generator.ParseID("not-an-id"); err == nil {
+			t.Error("there should be an error")
+		}
+
+		if name == "UUIDv4" {
+			continue
+		}
+		clock.now = clock.now.Add(time.Second)
+		if next := generator.NewID(); next <= id {
+			t.Error("the IDs should be sortable by time:", id, next)
+		}
+	}
+
+	if len(ulid.NewID()) != 26 || len(ksuid.NewID()) != 27 {
+		t.Error("the IDs should have the correct length")
+	}
+	if id := uuidv7.NewID(); id[14] != '7' {
+		t.Error("the version should be correct:", id)
+	}
+}
+
+func TestSetIDGenerator(t *testing.T) {
+	SetIDGenerator(NewULIDGenerator(SystemClock{}))
+	defer SetIDGenerator(UUIDv4Generator{})
+
+	id := NewUUID()
+	if len(id) != 26 {
+		t.Error("the ID should be a ULID:", id)
+	}
+
+	var v jsonType
+	if err := json.Unmarshal([]byte(`{"ID":"`+id.String()+`"}`), &v); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if *v.ID != id {
+		t.Error("the ID should be correct:", *v.ID)
+	}
+}
+
+func TestSetAggregateIDGenerator(t *testing.T) {
+	SetAggregateIDGenerator("TestAggregate", NewPrefixIDGenerator("test_", NewULIDGenerator(SystemClock{})))
+	defer SetAggregateIDGenerator("TestAggregate", nil)
+
+	id := NewAggregateID("TestAggregate")
+	if !strings.HasPrefix(id.String(), "test_") || len(id) != 31 {
+		t.Error("the ID should be a prefixed ULID:", id)
+	}
+	if other := NewAggregateID("OtherAggregate"); len(other) != 36 {
+		t.Error("the ID should be a UUID:", other)
+	}
+
+	t.Log("parse the prefixed ID")
+	var v jsonType
+	if err := json.Unmarshal([]byte(`{"ID":"`+id.String()+`"}`), &v); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if *v.ID != id {
+		t.Error("the ID should be correct:", *v.ID)
+	}
+	if _, err := ParseID("other_" + NewULIDGenerator(SystemClock{}).NewID().String()); err == nil {
+		t.Error("there should be an error")
+	}
+
+	t.Log("create a new aggregate")
+	if err := RegisterAggregateType(func(id UUID) Aggregate {
+		return &TestAggregate{
+			AggregateBase: NewAggregateBase(id),
+		}
+	}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	defer UnregisterAggregateType("TestAggregate")
+	aggregate, err := NewAggregate("TestAggregate")
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !strings.HasPrefix(aggregate.AggregateID().String(), "test_") {
+		t.Error("the aggregate ID should be prefixed:", aggregate.AggregateID())
+	}
+}
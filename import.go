@@ -0,0 +1,107 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrInvalidImport is when events to import are not valid, for example if an
+// event is missing or the versions of an aggregate have a gap.
+var ErrInvalidImport = errors.New("invalid event import")
+
+// ImportEventStore is an event store that can import historical events, for
+// example for seeding a new store from an export of another one.
+type ImportEventStore interface {
+	EventStore
+
+	// Import appends events with the versions, timestamps and headers of
+	// their envelopes, in one batch and without publishing them. Returns an
+	// ErrVersionConflict if the first event of an aggregate does not follow
+	// the events already stored for it.
+	Import(context.Context, []EventEnvelope) error
+}
+
+// ImportStream imports the events received on a channel into an event store in
+// batches of up to batchSize events, until the channel is closed. The versions
+// of each aggregate must follow each other without gaps and events that don't
+// are rejected with an EventError with ErrInvalidImport, before their batch is
+// imported. Returns the number of imported events.
+func ImportStream(ctx context.Context, eventStore ImportEventStore, envelopes <-chan EventEnvelope, batchSize int) (int, error) {
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+
+	n := 0
+	versions := map[UUID]int{} // The last imported version of each aggregate.
+	batch := make([]EventEnvelope, 0, batchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := eventStore.Import(ctx, batch); err != nil {
+			return err
+		}
+		n += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return n, ctx.Err()
+		case envelope, ok := <-envelopes:
+			if !ok {
+				return n, flush()
+			}
+			if err := checkImport(versions, envelope); err != nil {
+				return n, err
+			}
+			batch = append(batch, envelope)
+			if len(batch) >= batchSize {
+				if err := flush(); err != nil {
+					return n, err
+				}
+			}
+		}
+	}
+}
+
+// checkImport checks the integrity of an event to import and records its
+// version.
+func checkImport(versions map[UUID]int, envelope EventEnvelope) error {
+	event := envelope.Event
+	if event == nil || event.AggregateID() == "" {
+		return &EventError{Err: ErrInvalidImport}
+	}
+
+	id := event.AggregateID()
+	if version, ok := versions[id]; ok && envelope.Version != version+1 {
+		return &EventError{
+			Err: ErrInvalidImport,
+			Cause: ErrVersionConflict{
+				AggregateID:     id,
+				ExpectedVersion: envelope.Version,
+				ActualVersion:   version,
+			},
+			EventType:   event.EventType(),
+			AggregateID: id,
+		}
+	}
+	versions[id] = envelope.Version
+	return nil
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"testing"
+)
+
+type importEventStore struct {
+	errorEventStore
+	batches [][]EventEnvelope
+}
+
+func (s *importEventStore) Import(ctx context.Context, envelopes []EventEnvelope) error {
+	s.batches = append(s.batches, append([]EventEnvelope(nil), envelopes...))
+	return s.err
+}
+
+func TestImportStream(t *testing.T) {
+	id := NewUUID()
+	stream := func(envelopes ...EventEnvelope) <-chan EventEnvelope {
+		ch := make(chan EventEnvelope, len(envelopes))
+		for _, envelope := range envelopes {
+			ch <- envelope
+		}
+		close(ch)
+		return ch
+	}
+
+	t.Log("import in batches")
+	store := &importEventStore{}
+	n, err := ImportStream(context.Background(), store, stream(
+		EventEnvelope{Event: &TestEvent{id, "event1"}, Version: 1},
+		EventEnvelope{Event: &TestEvent{id, "event2"}, Version: 2},
+		EventEnvelope{Event: &TestEvent{id, "event3"}, Version: 3},
+	), 2)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if n != 3 {
+		t.Error("all events should be imported:", n)
+	}
+	if len(store.batches) != 2 || len(store.batches[0]) != 2 || len(store.batches[1]) != 1 {
+		t.Error("the events should be imported in batches:", store.batches)
+	}
+
+	t.Log("reject a version gap")
+	store = &importEventStore{}
+	n, err = ImportStream(context.Background(), store, stream(
+		EventEnvelope{Event: &TestEvent{id, "event1"}, Version: 1},
+		EventEnvelope{Event: &TestEvent{id, "event3"}, Version: 3},
+	), 10)
+	if e, ok := err.(*EventError); !ok || e.Err != ErrInvalidImport || e.AggregateID != id {
+		t.Error("there should be an ErrInvalidImport error:", err)
+	} else if conflict, ok := e.Cause.(ErrVersionConflict); !ok ||
+		conflict.ExpectedVersion != 3 || conflict.ActualVersion != 1 {
+		t.Error("the version conflict should be correct:", e.Cause)
+	}
+	if n != 0 || len(store.batches) != 0 {
+		t.Error("no events should be imported:", n, store.batches)
+	}
+
+	t.Log("reject a missing event")
+	_, err = ImportStream(context.Background(), &importEventStore{}, stream(EventEnvelope{}), 10)
+	if e, ok := err.(*EventError); !ok || e.Err != ErrInvalidImport {
+		t.Error("there should be an ErrInvalidImport error:", err)
+	}
+
+	t.Log("store error")
+	store = &importEventStore{errorEventStore: errorEventStore{err: ErrNoEventsToAppend}}
+	_, err = ImportStream(context.Background(), store, stream(
+		EventEnvelope{Event: &TestEvent{id, "event1"}, Version: 1},
+	), 10)
+	if err != ErrNoEventsToAppend {
+		t.Error("there should be an ErrNoEventsToAppend error:", err)
+	}
+}
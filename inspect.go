@@ -0,0 +1,57 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"time"
+)
+
+// StreamInfo describes the stream of events of an aggregate in an event store.
+type StreamInfo struct {
+	AggregateID   UUID
+	AggregateType string
+	Version       int
+	Events        int
+	Deleted       bool
+}
+
+// StoredEvent is an event as stored in an event store. The data of the event is
+// decoded generically, so that stores can be inspected without the event types
+// being registered.
+type StoredEvent struct {
+	Type          string
+	AggregateType string
+	AggregateID   UUID
+	Version       int
+	Timestamp     time.Time
+	Headers       Headers
+	Data          interface{}
+}
+
+// InspectableEventStore is an event store that can list its streams and load
+// them without decoding the events into their types, for example for debugging
+// a production store.
+type InspectableEventStore interface {
+	EventStore
+
+	// Streams returns the streams of all aggregates, also deleted ones, in the
+	// order of their aggregate IDs.
+	Streams(context.Context) ([]StreamInfo, error)
+
+	// LoadStored loads the stored events of an aggregate, also if it has been
+	// deleted. Returns ErrNoEventsFound if there is no stream.
+	LoadStored(context.Context, UUID) ([]StoredEvent, error)
+}
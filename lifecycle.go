@@ -0,0 +1,87 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"sync"
+)
+
+// Starter is a component that is started before it is used, for example to
+// warm up caches. An App starts its components in the order they were added.
+type Starter interface {
+	// Start starts the component.
+	Start(context.Context) error
+}
+
+// Stopper is a component that is stopped gracefully before it is closed. An
+// App stops its started components in the reverse order they were added.
+type Stopper interface {
+	// Stop stops the component, within the deadline of the context if any.
+	Stop(context.Context) error
+}
+
+// Lifecycle is embedded by long-running components, such as buses and
+// schedulers, to let applications add hooks that are called when the
+// components are started and stopped. It implements Starter and Stopper.
+type Lifecycle struct {
+	onStart []func(context.Context) error
+	onStop  []func(context.Context) error
+	hooksMu sync.Mutex
+}
+
+// OnStart adds a hook that is called when the component is started.
+func (l *Lifecycle) OnStart(f func(context.Context) error) {
+	l.hooksMu.Lock()
+	defer l.hooksMu.Unlock()
+	l.onStart = append(l.onStart, f)
+}
+
+// OnStop adds a hook that is called when the component is stopped.
+func (l *Lifecycle) OnStop(f func(context.Context) error) {
+	l.hooksMu.Lock()
+	defer l.hooksMu.Unlock()
+	l.onStop = append(l.onStop, f)
+}
+
+// Start implements the Start method of the Starter interface. It calls the
+// start hooks in the order they were added, until one of them fails.
+func (l *Lifecycle) Start(ctx context.Context) error {
+	l.hooksMu.Lock()
+	hooks := append([]func(context.Context) error{}, l.onStart...)
+	l.hooksMu.Unlock()
+	for _, f := range hooks {
+		if err := f(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stop implements the Stop method of the Stopper interface. It calls all the
+// stop hooks in the reverse order they were added, and returns the first
+// error, if any.
+func (l *Lifecycle) Stop(ctx context.Context) error {
+	l.hooksMu.Lock()
+	hooks := append([]func(context.Context) error{}, l.onStop...)
+	l.hooksMu.Unlock()
+	var err error
+	for i := len(hooks) - 1; i >= 0; i-- {
+		if hookErr := hooks[i](ctx); hookErr != nil && err == nil {
+			err = hookErr
+		}
+	}
+	return err
+}
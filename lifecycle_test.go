@@ -0,0 +1,72 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestLifecycle(t *testing.T) {
+	var l Lifecycle
+	var calls []string
+	hook := func(name string, err error) func(context.Context) error {
+		return func(ctx context.Context) error {
+			calls = append(calls, name)
+			return err
+		}
+	}
+	l.OnStart(hook("start1", nil))
+	l.OnStart(hook("start2", nil))
+	l.OnStop(hook("stop1", nil))
+	l.OnStop(hook("stop2", nil))
+
+	t.Log("start in order and stop in reverse order")
+	if err := l.Start(context.Background()); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := l.Stop(context.Background()); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(calls, []string{"start1", "start2", "stop2", "stop1"}) {
+		t.Error("the hooks should be called in order:", calls)
+	}
+
+	t.Log("stop starting at the first error")
+	errFailed := errors.New("failed")
+	l = Lifecycle{}
+	calls = nil
+	l.OnStart(hook("start1", errFailed))
+	l.OnStart(hook("start2", nil))
+	if err := l.Start(context.Background()); err != errFailed {
+		t.Error("the error should be correct:", err)
+	}
+	if !reflect.DeepEqual(calls, []string{"start1"}) {
+		t.Error("the later hooks should not be called:", calls)
+	}
+
+	t.Log("call all stop hooks on errors")
+	calls = nil
+	l.OnStop(hook("stop1", nil))
+	l.OnStop(hook("stop2", errFailed))
+	if err := l.Stop(context.Background()); err != errFailed {
+		t.Error("the error should be correct:", err)
+	}
+	if !reflect.DeepEqual(calls, []string{"stop2", "stop1"}) {
+		t.Error("all hooks should be called:", calls)
+	}
+}
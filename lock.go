@@ -0,0 +1,75 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrLockHeld is when a lock is held by someone else.
+var ErrLockHeld = errors.New("lock is held")
+
+// ErrLockNotHeld is when a lock is not held with a token, for example because
+// it has expired.
+var ErrLockNotHeld = errors.New("lock is not held")
+
+// Lock is a lock of keys that can be shared by processes, for guarding
+// operations that must only be done by one of them at a time. Locks expire
+// after a TTL so that a crashed holder does not keep them forever.
+type Lock interface {
+	// TryLock acquires the lock of a key for a TTL if it is free, and returns
+	// a token for unlocking and refreshing it. Returns ErrLockHeld if the
+	// lock is held.
+	TryLock(key string, ttl time.Duration) (string, error)
+
+	// Unlock releases the lock of a key held with a token. Returns
+	// ErrLockNotHeld if it is not held with the token.
+	Unlock(key, token string) error
+
+	// Refresh extends the lock of a key held with a token to a new TTL.
+	// Returns ErrLockNotHeld if it is not held with the token.
+	Refresh(key, token string, ttl time.Duration) error
+}
+
+// AcquireLock acquires the lock of a key, retrying at an interval while it is
+// held, until the context is done. The clock is used to wait between retries.
+func AcquireLock(ctx context.Context, lock Lock, key string, ttl, retry time.Duration, clock Clock) (string, error) {
+	for {
+		token, err := lock.TryLock(key, ttl)
+		if err != ErrLockHeld {
+			return token, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-clock.After(retry):
+		}
+	}
+}
+
+// WithLock calls a function if the lock of a key can be acquired, and then
+// unlocks it. Returns ErrLockHeld without calling the function if the lock is
+// held.
+func WithLock(lock Lock, key string, ttl time.Duration, f func() error) error {
+	token, err := lock.TryLock(key, ttl)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock(key, token)
+	return f()
+}
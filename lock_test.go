@@ -0,0 +1,103 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWithLock(t *testing.T) {
+	lock := &mockLock{}
+
+	t.Log("call with lock")
+	called := false
+	err := WithLock(lock, "key", time.Minute, func() error {
+		called = true
+		if !lock.held {
+			t.Error("the lock should be held")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !called || lock.held {
+		t.Error("the function should be called and the lock released")
+	}
+
+	t.Log("held lock")
+	lock.held = true
+	err = WithLock(lock, "key", time.Minute, func() error {
+		t.Error("the function should not be called")
+		return nil
+	})
+	if err != ErrLockHeld {
+		t.Error("there should be a ErrLockHeld error:", err)
+	}
+}
+
+func TestAcquireLock(t *testing.T) {
+	lock := &mockLock{held: true}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := AcquireLock(ctx, lock, "key", time.Minute, time.Millisecond, SystemClock{}); err != context.DeadlineExceeded {
+		t.Error("there should be a deadline error:", err)
+	}
+
+	lock.held = false
+	token, err := AcquireLock(context.Background(), lock, "key", time.Minute, time.Millisecond, SystemClock{})
+	if err != nil || token != "token" {
+		t.Error("the lock should be acquired:", token, err)
+	}
+}
+
+type mockLock struct {
+	held       bool
+	refreshErr error
+	mu         sync.Mutex
+}
+
+func (l *mockLock) TryLock(key string, ttl time.Duration) (string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.held {
+		return "", ErrLockHeld
+	}
+	l.held = true
+	return "token", nil
+}
+
+func (l *mockLock) Unlock(key, token string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.held = false
+	return nil
+}
+
+func (l *mockLock) Refresh(key, token string, ttl time.Duration) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.refreshErr
+}
+
+func (l *mockLock) set(held bool, refreshErr error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.held = held
+	l.refreshErr = refreshErr
+}
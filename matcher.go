@@ -0,0 +1,143 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"path"
+)
+
+// EventMatcher is a function that matches events, used to subscribe handlers
+// to more than one exact event type.
+type EventMatcher func(Event) bool
+
+// MatchEventType matches events with a type that matches a pattern, using the
+// same syntax as path.Match. For example "Invite*" matches both InviteCreated
+// and InviteAccepted.
+func MatchEventType(pattern string) EventMatcher {
+	return func(event Event) bool {
+		ok, _ := path.Match(pattern, event.EventType())
+		return ok
+	}
+}
+
+// MatchAggregateType matches events for an aggregate type.
+func MatchAggregateType(aggregateType string) EventMatcher {
+	return func(event Event) bool {
+		return event.AggregateType() == aggregateType
+	}
+}
+
+// MatchAny matches events that match any of the matchers.
+func MatchAny(matchers ...EventMatcher) EventMatcher {
+	return func(event Event) bool {
+		for _, m := range matchers {
+			if m(event) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// MatchingEventHandler is an optional interface for event handlers that only
+// handle some of the events they are added for. Event buses match the events
+// before delivering them, so that events that don't match are not queued or
+// counted for the handler.
+type MatchingEventHandler interface {
+	EventHandler
+
+	// MatchEvent returns if the handler handles an event.
+	MatchEvent(Event) bool
+}
+
+// MatchEvent returns if a handler handles an event, which all handlers do
+// unless they implement MatchingEventHandler.
+func MatchEvent(handler EventHandler, event Event) bool {
+	if h, ok := handler.(MatchingEventHandler); ok {
+		return h.MatchEvent(event)
+	}
+	return true
+}
+
+// AddMatchingHandler adds a handler for all local events that match, instead
+// of for an exact event type as with AddHandler. The returned handler is the
+// one added to the bus, to use when removing it.
+//
+// An example would be:
+//     AddMatchingHandler(bus, projector, MatchEventType("Invite*"))
+func AddMatchingHandler(bus EventBus, handler EventHandler, matcher EventMatcher) EventHandler {
+	h := &filteredHandler{handler, matcher}
+	bus.AddLocalHandler(h)
+	return h
+}
+
+// AddHandlerWithFilter adds a handler for a specific local event, as with
+// AddHandler, but only for the events that pass the filter. This is useful to
+// handle a subset of the events of a type, for example only for one region.
+// The returned handler is the one added to the bus, to use when removing it.
+//
+// An example would be:
+//     AddHandlerWithFilter(bus, handler, &InviteCreated{}, func(event Event) bool {
+//         return event.(*InviteCreated).Region == "eu"
+//     })
+func AddHandlerWithFilter(bus EventBus, handler EventHandler, event Event, filter EventMatcher) EventHandler {
+	h := &filteredHandler{handler, filter}
+	bus.AddHandler(h, event)
+	return h
+}
+
+// filteredHandler passes the events that match on to a handler. The events
+// are matched again when handled, for event buses that don't match them.
+type filteredHandler struct {
+	handler EventHandler
+	matcher EventMatcher
+}
+
+// MatchEvent implements the MatchEvent method of the MatchingEventHandler
+// interface.
+func (h *filteredHandler) MatchEvent(event Event) bool {
+	return h.matcher(event)
+}
+
+// HandleEvent implements the HandleEvent method of the EventHandler interface.
+func (h *filteredHandler) HandleEvent(event Event) {
+	if h.matcher(event) {
+		h.handler.HandleEvent(event)
+	}
+}
+
+// HandleEventWithContext implements the HandleEventWithContext method of the
+// ContextEventHandler interface.
+func (h *filteredHandler) HandleEventWithContext(ctx context.Context, event Event) {
+	if h.matcher(event) {
+		HandleEventWithContext(ctx, h.handler, event)
+	}
+}
+
+// TryHandleEvent implements the TryHandleEvent method of the
+// FallibleEventHandler interface.
+func (h *filteredHandler) TryHandleEvent(ctx context.Context, event Event) error {
+	if !h.matcher(event) {
+		return nil
+	}
+	return TryHandleEvent(ctx, h.handler, event)
+}
+
+// HandlerName implements the HandlerName method of the NamedEventHandler
+// interface, using the name of the filtered handler.
+func (h *filteredHandler) HandlerName() string {
+	return HandlerName(h.handler)
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEventMatchers(t *testing.T) {
+	event := &TestEvent{NewUUID(), "event1"}
+
+	if !MatchEventType("Test*")(event) {
+		t.Error("the event type pattern should match")
+	}
+	if MatchEventType("Other*")(event) {
+		t.Error("the event type pattern should not match")
+	}
+	if !MatchAggregateType("TestAggregate")(event) {
+		t.Error("the aggregate type should match")
+	}
+	if MatchAggregateType("OtherAggregate")(event) {
+		t.Error("the aggregate type should not match")
+	}
+	if !MatchAny(MatchEventType("Other*"), MatchAggregateType("TestAggregate"))(event) {
+		t.Error("any matcher should match")
+	}
+	if MatchAny()(event) {
+		t.Error("no matchers should not match")
+	}
+}
+
+func TestAddMatchingHandler(t *testing.T) {
+	bus := &handlerEventBus{}
+	var events []Event
+	AddMatchingHandler(bus, NewEventHandlerFunc(func(event Event) {
+		events = append(events, event)
+	}), MatchEventType("*Event"))
+
+	event1 := &TestEvent{NewUUID(), "event1"}
+	bus.PublishEvent(event1)
+	bus.PublishEvent(&TestEvent2{NewUUID(), "event2"})
+	if !reflect.DeepEqual(events, []Event{event1}) {
+		t.Error("only the matching events should be handled:", events)
+	}
+}
+
+func TestAddHandlerWithFilter(t *testing.T) {
+	bus := &handlerEventBus{}
+	var events []Event
+	handler := AddHandlerWithFilter(bus, NewEventHandlerFunc(func(event Event) {
+		events = append(events, event)
+	}), &TestEvent{}, func(event Event) bool {
+		return event.(*TestEvent).Content == "event1"
+	})
+	if !reflect.DeepEqual(bus.handlers, []EventHandler{handler}) {
+		t.Error("the added handler should be returned:", bus.handlers)
+	}
+
+	event1 := &TestEvent{NewUUID(), "event1"}
+	bus.PublishEvent(event1)
+	bus.PublishEvent(&TestEvent{NewUUID(), "event2"})
+	if !reflect.DeepEqual(events, []Event{event1}) {
+		t.Error("only the filtered events should be handled:", events)
+	}
+	if MatchEvent(handler, &TestEvent{NewUUID(), "event2"}) {
+		t.Error("the handler should not match filtered events")
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package bridge forwards events between event buses, for example between the
+// buses of two applications that each have their own namespace.
+package bridge
+
+import (
+	"sync"
+
+	"github.com/looplab/eventhorizon"
+)
+
+// Translator translates an event before it is forwarded, for example to an
+// event type of the other application. Returning nil drops the event.
+type Translator func(eventhorizon.Event) eventhorizon.Event
+
+// Bridge subscribes to the global events of one bus and publishes the selected
+// event types on another bus.
+type Bridge struct {
+	to          eventhorizon.EventBus
+	translators map[string]Translator
+	mu          sync.RWMutex
+}
+
+// NewBridge creates a Bridge from one bus to another. No events are forwarded
+// until selected with Forward.
+func NewBridge(from, to eventhorizon.EventBus) *Bridge {
+	b := &Bridge{
+		to:          to,
+		translators: make(map[string]Translator),
+	}
+	from.AddGlobalHandler(b)
+	return b
+}
+
+// Forward selects an event type to be forwarded. The translator is used to
+// translate the events before forwarding, use nil to forward them as is.
+//
+// An example would be:
+//     bridge.Forward(&InviteAccepted{}, func(event eventhorizon.Event) eventhorizon.Event {
+//         e := event.(*InviteAccepted)
+//         return &GuestConfirmed{e.InvitationID}
+//     })
+func (b *Bridge) Forward(event eventhorizon.Event, translator Translator) {
+	if translator == nil {
+		translator = func(event eventhorizon.Event) eventhorizon.Event { return event }
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.translators[event.EventType()] = translator
+}
+
+// HandleEvent implements the HandleEvent method of the eventhorizon.EventHandler
+// interface.
+func (b *Bridge) HandleEvent(event eventhorizon.Event) {
+	b.mu.RLock()
+	translator, ok := b.translators[event.EventType()]
+	b.mu.RUnlock()
+	if !ok {
+		return
+	}
+
+	if event = translator(event); event != nil {
+		b.to.PublishEvent(event)
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bridge
+
+import (
+	"testing"
+
+	"github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/messaging/testbus"
+	"github.com/looplab/eventhorizon/testutil"
+)
+
+func TestBridge(t *testing.T) {
+	from := testbus.NewEventBus()
+	to := testbus.NewEventBus()
+	bridge := NewBridge(from, to)
+
+	event1 := &testutil.TestEvent{eventhorizon.NewUUID(), "event1"}
+	event2 := &testutil.TestEventOther{eventhorizon.NewUUID(), "event2"}
+
+	t.Log("don't forward events that are not selected")
+	from.PublishEvent(event1)
+	to.AssertEvents(t)
+
+	t.Log("forward event as is")
+	bridge.Forward(&testutil.TestEvent{}, nil)
+	from.PublishEvent(event1)
+	to.AssertEvents(t, event1)
+
+	t.Log("forward translated event")
+	to.Reset()
+	bridge.Forward(&testutil.TestEventOther{}, func(event eventhorizon.Event) eventhorizon.Event {
+		e := event.(*testutil.TestEventOther)
+		return &testutil.TestEvent{e.TestID, "translated " + e.Content}
+	})
+	from.PublishEvent(event2)
+	to.AssertEvents(t, &testutil.TestEvent{event2.TestID, "translated event2"})
+
+	t.Log("drop event in translator")
+	to.Reset()
+	bridge.Forward(&testutil.TestEventOther{}, func(event eventhorizon.Event) eventhorizon.Event {
+		return nil
+	})
+	from.PublishEvent(event2)
+	to.AssertEvents(t)
+}
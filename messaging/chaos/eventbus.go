@@ -0,0 +1,122 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package chaos contains an event bus decorator that injects faults typical
+// for at-least-once delivery, for testing that handlers can cope with them.
+package chaos
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/looplab/eventhorizon"
+)
+
+// Config is the config for the chaos EventBus. Rates are probabilities between
+// 0 and 1 that are checked for every published event.
+type Config struct {
+	// MaxLatency is the max random delay added before publishing.
+	MaxLatency time.Duration
+
+	// DropRate is the rate of events that are silently dropped.
+	DropRate float64
+
+	// DuplicateRate is the rate of events that are published twice.
+	DuplicateRate float64
+
+	// ReorderRate is the rate of events that are held back and published
+	// after the next event.
+	ReorderRate float64
+
+	// Seed is the seed for the random source, use the same seed to get the
+	// same faults between runs.
+	Seed int64
+
+	// Clock is used to wait for the latency, the default is the system clock.
+	Clock eventhorizon.Clock
+}
+
+// EventBus wraps an EventBus and injects latency, drops, duplicates and
+// reordering when publishing events. Handlers are added to the base bus.
+type EventBus struct {
+	eventhorizon.EventBus
+
+	config Config
+	rand   *rand.Rand
+	held   eventhorizon.Event
+	mu     sync.Mutex
+}
+
+// NewEventBus creates a new EventBus.
+func NewEventBus(eventBus eventhorizon.EventBus, config Config) *EventBus {
+	if config.Clock == nil {
+		config.Clock = eventhorizon.SystemClock{}
+	}
+	b := &EventBus{
+		EventBus: eventBus,
+		config:   config,
+		rand:     rand.New(rand.NewSource(config.Seed)),
+	}
+	return b
+}
+
+// PublishEvent publishes an event on the base bus after injecting faults.
+func (b *EventBus) PublishEvent(event eventhorizon.Event) {
+	b.mu.Lock()
+	var latency time.Duration
+	if b.config.MaxLatency > 0 {
+		latency = time.Duration(b.rand.Int63n(int64(b.config.MaxLatency)))
+	}
+	drop := b.rand.Float64() < b.config.DropRate
+	duplicate := b.rand.Float64() < b.config.DuplicateRate
+	reorder := b.rand.Float64() < b.config.ReorderRate
+
+	// Hold back the event until the next one, or release a held event after
+	// this one.
+	var events []eventhorizon.Event
+	if !drop {
+		events = append(events, event)
+		if duplicate {
+			events = append(events, event)
+		}
+	}
+	if reorder && b.held == nil && len(events) > 0 {
+		b.held = events[0]
+		events = events[1:]
+	} else if b.held != nil {
+		events = append(events, b.held)
+		b.held = nil
+	}
+	b.mu.Unlock()
+
+	if latency > 0 {
+		<-b.config.Clock.After(latency)
+	}
+	for _, e := range events {
+		b.EventBus.PublishEvent(e)
+	}
+}
+
+// Flush publishes any event that is held back for reordering.
+func (b *EventBus) Flush() {
+	b.mu.Lock()
+	held := b.held
+	b.held = nil
+	b.mu.Unlock()
+
+	if held != nil {
+		b.EventBus.PublishEvent(held)
+	}
+}
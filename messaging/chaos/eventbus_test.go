@@ -0,0 +1,65 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chaos
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/testutil"
+)
+
+func TestEventBus(t *testing.T) {
+	event1 := &testutil.TestEvent{eventhorizon.NewUUID(), "event1"}
+	event2 := &testutil.TestEvent{eventhorizon.NewUUID(), "event2"}
+	event3 := &testutil.TestEvent{eventhorizon.NewUUID(), "event3"}
+
+	t.Log("no faults")
+	base := &testutil.MockEventBus{}
+	bus := NewEventBus(base, Config{})
+	bus.PublishEvent(event1)
+	bus.PublishEvent(event2)
+	if !reflect.DeepEqual(base.Events, []eventhorizon.Event{event1, event2}) {
+		t.Error("the events should be correct:", base.Events)
+	}
+
+	t.Log("drop all")
+	base = &testutil.MockEventBus{}
+	bus = NewEventBus(base, Config{DropRate: 1})
+	bus.PublishEvent(event1)
+	if len(base.Events) != 0 {
+		t.Error("there should be no events:", base.Events)
+	}
+
+	t.Log("duplicate all")
+	base = &testutil.MockEventBus{}
+	bus = NewEventBus(base, Config{DuplicateRate: 1})
+	bus.PublishEvent(event1)
+	if !reflect.DeepEqual(base.Events, []eventhorizon.Event{event1, event1}) {
+		t.Error("the events should be duplicated:", base.Events)
+	}
+
+	t.Log("reorder all")
+	base = &testutil.MockEventBus{}
+	bus = NewEventBus(base, Config{ReorderRate: 1})
+	bus.PublishEvent(event1)
+	bus.PublishEvent(event2)
+	bus.PublishEvent(event3)
+	bus.Flush()
+	if !reflect.DeepEqual(base.Events, []eventhorizon.Event{event2, event1, event3}) {
+		t.Error("the events should be reordered:", base.Events)
+	}
+}
@@ -0,0 +1,530 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kinesis
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/aws/aws-sdk-go/service/kinesis/kinesisiface"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/looplab/eventhorizon"
+	bsoncodec "github.com/looplab/eventhorizon/codec/bson"
+)
+
+// ErrEventNotRegistered is when an event is not registered.
+var ErrEventNotRegistered = errors.New("event not registered")
+
+// ErrCouldNotMarshalEvent is when an event could not be marshaled into BSON.
+var ErrCouldNotMarshalEvent = errors.New("could not marshal event")
+
+// ErrCouldNotUnmarshalEvent is when an event could not be unmarshaled into a concrete type.
+var ErrCouldNotUnmarshalEvent = errors.New("could not unmarshal event")
+
+// EventBusConfig is a config for the Kinesis event bus.
+type EventBusConfig struct {
+	// Stream is the name of the Kinesis stream.
+	Stream string
+	// Region is the AWS region of the stream and the lease table.
+	Region string
+	// App is the name of the app consuming the stream. Buses with the same
+	// app share the shards of the stream between them, each event is handled
+	// by one of them.
+	App string
+	// LeaseTable is the DynamoDB table of the shard leases and checkpoints.
+	LeaseTable string
+	// PollInterval is the time between reads of a shard.
+	PollInterval time.Duration
+	// LeaseDuration is the time a shard lease is held without being renewed.
+	LeaseDuration time.Duration
+	// InitialPosition is where shards without checkpoints are read from,
+	// kinesis.ShardIteratorTypeLatest or kinesis.ShardIteratorTypeTrimHorizon.
+	InitialPosition string
+	// Clock is used for the expiry and renewal of leases and for polling,
+	// the default is the system clock.
+	Clock eventhorizon.Clock
+}
+
+func (c *EventBusConfig) provideDefaults() {
+	if c.Stream == "" {
+		c.Stream = "eventhorizonEvents"
+	}
+	if c.Region == "" {
+		c.Region = "us-east-1"
+	}
+	if c.App == "" {
+		c.App = "eventhorizon"
+	}
+	if c.LeaseTable == "" {
+		c.LeaseTable = "eventhorizonLeases"
+	}
+	if c.PollInterval == 0 {
+		c.PollInterval = time.Second
+	}
+	if c.LeaseDuration == 0 {
+		c.LeaseDuration = 30 * time.Second
+	}
+	if c.InitialPosition == "" {
+		c.InitialPosition = kinesis.ShardIteratorTypeLatest
+	}
+	if c.Clock == nil {
+		c.Clock = eventhorizon.SystemClock{}
+	}
+}
+
+// EventBus is an event bus on a Kinesis Data Stream. Events are put on the
+// stream partitioned by aggregate ID, which keeps the order of the events of
+// each aggregate.
+//
+// The shards of the stream are consumed like the Kinesis Client Library does:
+// each shard is leased by one bus of the app at a time, children of resharded
+// shards are consumed after their parents, and the sequence number of the last
+// handled record is checkpointed in the LeaseStore after each batch. Global
+// handlers are called at least once per event; after a restart or a lost lease
+// the events since the last checkpoint are handled again.
+//
+// Hooks can be added with OnStart and OnStop, which are called when the bus is
+// started and stopped by an eventhorizon.App.
+type EventBus struct {
+	eventhorizon.Lifecycle
+
+	eventHandlers  map[string]map[eventhorizon.EventHandler]bool
+	localHandlers  map[eventhorizon.EventHandler]bool
+	globalHandlers map[eventhorizon.EventHandler]bool
+	factories      map[string]func() eventhorizon.Event
+	config         *EventBusConfig
+	service        kinesisiface.KinesisAPI
+	leases         LeaseStore
+	owner          string
+	shards         map[string]bool // The shards being consumed.
+	cancel         context.CancelFunc
+	wg             sync.WaitGroup
+	mu             sync.RWMutex
+}
+
+// NewEventBus creates a new EventBus with leases in the DynamoDB table of the
+// config.
+func NewEventBus(config *EventBusConfig) (*EventBus, error) {
+	config.provideDefaults()
+
+	awsConfig := &aws.Config{
+		Region: aws.String(config.Region),
+	}
+	sess, err := session.NewSession(awsConfig)
+	if err != nil {
+		return nil, err
+	}
+	leases := NewDynamoDBLeaseStore(dynamodb.New(sess), config.LeaseTable, config.App, config.Clock)
+
+	return NewEventBusWithClients(config, kinesis.New(sess), leases)
+}
+
+// NewEventBusWithClients creates a new EventBus with a Kinesis client and a
+// lease store.
+func NewEventBusWithClients(config *EventBusConfig, service kinesisiface.KinesisAPI, leases LeaseStore) (*EventBus, error) {
+	config.provideDefaults()
+
+	b := &EventBus{
+		eventHandlers:  make(map[string]map[eventhorizon.EventHandler]bool),
+		localHandlers:  make(map[eventhorizon.EventHandler]bool),
+		globalHandlers: make(map[eventhorizon.EventHandler]bool),
+		factories:      make(map[string]func() eventhorizon.Event),
+		config:         config,
+		service:        service,
+		leases:         leases,
+		owner:          eventhorizon.NewUUID().String(),
+		shards:         make(map[string]bool),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	b.cancel = cancel
+	b.wg.Add(1)
+	go b.coordinate(ctx)
+
+	return b, nil
+}
+
+// message is the record format of a published event.
+type message struct {
+	Type    string               `bson:"type"`
+	Data    bson.Raw             `bson:"data"`
+	Headers eventhorizon.Headers `bson:"headers,omitempty"`
+}
+
+// PublishEvent publishes an event to all handlers capable of handling it.
+func (b *EventBus) PublishEvent(event eventhorizon.Event) {
+	b.PublishEventWithContext(context.Background(), event)
+}
+
+// PublishEventWithContext publishes an event as PublishEvent, with the headers
+// of the context. The headers are put on the stream together with the event
+// and are passed on to handlers that implement
+// eventhorizon.ContextEventHandler.
+func (b *EventBus) PublishEventWithContext(ctx context.Context, event eventhorizon.Event) {
+	if err := b.TryPublishEvent(ctx, event); err != nil {
+		log.Printf("error: event bus publish: %v\n", err)
+	}
+}
+
+// TryPublishEvent implements the TryPublishEvent method of the
+// eventhorizon.FallibleEventPublisher interface. It publishes as
+// PublishEventWithContext, and returns the error of putting it on the stream.
+func (b *EventBus) TryPublishEvent(ctx context.Context, event eventhorizon.Event) error {
+	b.publishLocal(ctx, event)
+	return b.publishGlobal(ctx, event)
+}
+
+func (b *EventBus) publishLocal(ctx context.Context, event eventhorizon.Event) {
+	b.mu.RLock()
+	handlers := make([]eventhorizon.EventHandler, 0, len(b.localHandlers))
+	for handler := range b.eventHandlers[event.EventType()] {
+		handlers = append(handlers, handler)
+	}
+	for handler := range b.localHandlers {
+		handlers = append(handlers, handler)
+	}
+	b.mu.RUnlock()
+
+	for _, handler := range handlers {
+		eventhorizon.HandleEventWithContext(ctx, handler, event)
+	}
+}
+
+func (b *EventBus) publishGlobal(ctx context.Context, event eventhorizon.Event) error {
+	data, err := bsoncodec.EventCodec{}.MarshalEvent(event)
+	if err != nil {
+		return &eventhorizon.EventError{Err: ErrCouldNotMarshalEvent, Cause: err,
+			EventType: event.EventType(), AggregateID: event.AggregateID()}
+	}
+	if data, err = bson.Marshal(message{
+		Type:    event.EventType(),
+		Data:    bson.Raw(data),
+		Headers: eventhorizon.HeadersFromContext(ctx),
+	}); err != nil {
+		return &eventhorizon.EventError{Err: ErrCouldNotMarshalEvent, Cause: err,
+			EventType: event.EventType(), AggregateID: event.AggregateID()}
+	}
+
+	_, err = b.service.PutRecordWithContext(ctx, &kinesis.PutRecordInput{
+		StreamName:   aws.String(b.config.Stream),
+		PartitionKey: aws.String(eventhorizon.AggregatePartitionKey(event)),
+		Data:         data,
+	})
+	return err
+}
+
+// AddHandler adds a handler for a specific local event.
+func (b *EventBus) AddHandler(handler eventhorizon.EventHandler, event eventhorizon.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Create handler list for new event types.
+	if _, ok := b.eventHandlers[event.EventType()]; !ok {
+		b.eventHandlers[event.EventType()] = make(map[eventhorizon.EventHandler]bool)
+	}
+
+	// Add handler to event type.
+	b.eventHandlers[event.EventType()][handler] = true
+}
+
+// AddLocalHandler adds a handler for local events.
+func (b *EventBus) AddLocalHandler(handler eventhorizon.EventHandler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.localHandlers[handler] = true
+}
+
+// AddGlobalHandler adds a handler for global (remote) events.
+func (b *EventBus) AddGlobalHandler(handler eventhorizon.EventHandler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.globalHandlers[handler] = true
+}
+
+// RemoveGlobalHandler removes a handler for global (remote) events.
+func (b *EventBus) RemoveGlobalHandler(handler eventhorizon.EventHandler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.globalHandlers, handler)
+}
+
+// RegisterEventType registers an event factory for a event type. The factory is
+// used to create concrete event types when reading from the stream.
+//
+// An example would be:
+//     eventBus.RegisterEventType(&MyEvent{}, func() Event { return &MyEvent{} })
+func (b *EventBus) RegisterEventType(event eventhorizon.Event, factory func() eventhorizon.Event) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.factories[event.EventType()]; ok {
+		return eventhorizon.ErrHandlerAlreadySet
+	}
+
+	b.factories[event.EventType()] = factory
+
+	return nil
+}
+
+// Close stops consuming the stream and releases the leases of the shards, after
+// the batches being handled are done.
+func (b *EventBus) Close() {
+	b.cancel()
+	b.wg.Wait()
+}
+
+// coordinate leases the shards of the stream and consumes the leased shards,
+// until the context is done. Expired leases of other buses are taken over.
+func (b *EventBus) coordinate(ctx context.Context) {
+	defer b.wg.Done()
+
+	for {
+		if err := b.leaseShards(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("error: event bus shards: %v\n", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-b.config.Clock.After(b.config.LeaseDuration / 2):
+		}
+	}
+}
+
+func (b *EventBus) leaseShards(ctx context.Context) error {
+	var shards []*kinesis.Shard
+	input := &kinesis.ListShardsInput{StreamName: aws.String(b.config.Stream)}
+	for {
+		out, err := b.service.ListShardsWithContext(ctx, input)
+		if err != nil {
+			return err
+		}
+		shards = append(shards, out.Shards...)
+		if out.NextToken == nil {
+			break
+		}
+		input = &kinesis.ListShardsInput{NextToken: out.NextToken}
+	}
+
+	listed := make(map[string]bool, len(shards))
+	for _, shard := range shards {
+		listed[aws.StringValue(shard.ShardId)] = true
+	}
+
+	for _, shard := range shards {
+		id := aws.StringValue(shard.ShardId)
+		b.mu.RLock()
+		running := b.shards[id]
+		b.mu.RUnlock()
+		if running {
+			continue
+		}
+
+		// Children are consumed after their parents to keep the order of
+		// events. Parents that are trimmed from the stream are not listed.
+		if ready, err := b.parentsFinished(ctx, shard, listed); err != nil {
+			return err
+		} else if !ready {
+			continue
+		}
+
+		lease, ok, err := b.leases.AcquireLease(ctx, id, b.owner, b.config.Clock.Now().Add(b.config.LeaseDuration))
+		if err != nil {
+			return err
+		} else if !ok {
+			continue
+		}
+		if lease.Finished {
+			if err := b.leases.ReleaseLease(ctx, id, b.owner); err != nil {
+				return err
+			}
+			continue
+		}
+
+		b.mu.Lock()
+		b.shards[id] = true
+		b.mu.Unlock()
+		b.wg.Add(1)
+		go b.consume(ctx, id, lease.SequenceNumber)
+	}
+
+	return nil
+}
+
+func (b *EventBus) parentsFinished(ctx context.Context, shard *kinesis.Shard, listed map[string]bool) (bool, error) {
+	for _, parent := range []*string{shard.ParentShardId, shard.AdjacentParentShardId} {
+		id := aws.StringValue(parent)
+		if id == "" || !listed[id] {
+			continue
+		}
+		lease, err := b.leases.Lease(ctx, id)
+		if err != nil {
+			return false, err
+		}
+		if !lease.Finished {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// consume reads the records of a leased shard from the sequence number, or the
+// initial position if empty, and handles them until the end of the shard, the
+// lease is lost or the context is done.
+func (b *EventBus) consume(ctx context.Context, shardID, sequenceNumber string) {
+	defer b.wg.Done()
+	defer func() {
+		b.mu.Lock()
+		delete(b.shards, shardID)
+		b.mu.Unlock()
+	}()
+
+	iterator, err := b.shardIterator(ctx, shardID, sequenceNumber)
+	if err != nil {
+		b.release(shardID, err)
+		return
+	}
+
+	renewed := b.config.Clock.Now()
+	for {
+		out, err := b.service.GetRecordsWithContext(ctx, &kinesis.GetRecordsInput{
+			ShardIterator: iterator,
+		})
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == kinesis.ErrCodeExpiredIteratorException {
+			if iterator, err = b.shardIterator(ctx, shardID, sequenceNumber); err == nil {
+				continue
+			}
+		}
+		if err != nil {
+			b.release(shardID, err)
+			return
+		}
+
+		for _, record := range out.Records {
+			b.handleRecord(ctx, record)
+			sequenceNumber = aws.StringValue(record.SequenceNumber)
+		}
+
+		// Checkpoint after each batch, which also renews the lease.
+		if len(out.Records) > 0 || b.config.Clock.Now().Sub(renewed) > b.config.LeaseDuration/3 {
+			err := b.leases.Checkpoint(ctx, shardID, b.owner, sequenceNumber,
+				b.config.Clock.Now().Add(b.config.LeaseDuration))
+			if errors.Is(err, ErrLeaseLost) {
+				return
+			} else if err != nil {
+				b.release(shardID, err)
+				return
+			}
+			renewed = b.config.Clock.Now()
+		}
+
+		// The shard has been closed by resharding and fully read.
+		if out.NextShardIterator == nil {
+			if err := b.leases.FinishShard(ctx, shardID, b.owner); err != nil {
+				log.Printf("error: event bus shard %s: %v\n", shardID, err)
+			}
+			return
+		}
+		iterator = out.NextShardIterator
+
+		select {
+		case <-ctx.Done():
+			b.release(shardID, nil)
+			return
+		case <-b.config.Clock.After(b.config.PollInterval):
+		}
+	}
+}
+
+func (b *EventBus) shardIterator(ctx context.Context, shardID, sequenceNumber string) (*string, error) {
+	input := &kinesis.GetShardIteratorInput{
+		StreamName:        aws.String(b.config.Stream),
+		ShardId:           aws.String(shardID),
+		ShardIteratorType: aws.String(b.config.InitialPosition),
+	}
+	if sequenceNumber != "" {
+		input.ShardIteratorType = aws.String(kinesis.ShardIteratorTypeAfterSequenceNumber)
+		input.StartingSequenceNumber = aws.String(sequenceNumber)
+	}
+	out, err := b.service.GetShardIteratorWithContext(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	return out.ShardIterator, nil
+}
+
+// release releases the lease of a shard, logging the error that stopped the
+// consumption if any. The lease is released even if the context is done.
+func (b *EventBus) release(shardID string, err error) {
+	if err != nil && !errors.Is(err, context.Canceled) {
+		log.Printf("error: event bus shard %s: %v\n", shardID, err)
+	}
+	if err := b.leases.ReleaseLease(context.Background(), shardID, b.owner); err != nil &&
+		!errors.Is(err, ErrLeaseLost) {
+		log.Printf("error: event bus shard %s: %v\n", shardID, err)
+	}
+}
+
+func (b *EventBus) handleRecord(ctx context.Context, record *kinesis.Record) {
+	event, headers, err := b.unmarshalMessage(record.Data)
+	if err != nil {
+		log.Printf("error: event bus receive: %v\n", err)
+		return
+	}
+	if headers != nil {
+		ctx = eventhorizon.NewContextWithHeaders(ctx, headers)
+	}
+
+	b.mu.RLock()
+	handlers := make([]eventhorizon.EventHandler, 0, len(b.globalHandlers))
+	for handler := range b.globalHandlers {
+		handlers = append(handlers, handler)
+	}
+	b.mu.RUnlock()
+
+	for _, handler := range handlers {
+		eventhorizon.HandleEventWithLabels(ctx, handler, event)
+	}
+}
+
+func (b *EventBus) unmarshalMessage(data []byte) (eventhorizon.Event, eventhorizon.Headers, error) {
+	var m message
+	if err := bson.Unmarshal(data, &m); err != nil {
+		return nil, nil, &eventhorizon.EventError{Err: ErrCouldNotUnmarshalEvent, Cause: err}
+	}
+
+	// Get the registered factory function for creating events.
+	b.mu.RLock()
+	f, ok := b.factories[m.Type]
+	b.mu.RUnlock()
+	if !ok {
+		return nil, nil, &eventhorizon.EventError{Err: ErrEventNotRegistered, EventType: m.Type}
+	}
+
+	event := f()
+	if err := (bsoncodec.EventCodec{}).UnmarshalEvent(m.Data, event); err != nil {
+		return nil, nil, &eventhorizon.EventError{Err: ErrCouldNotUnmarshalEvent, Cause: err, EventType: m.Type}
+	}
+	return event, m.Headers, nil
+}
@@ -0,0 +1,360 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kinesis
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/aws/aws-sdk-go/service/kinesis/kinesisiface"
+
+	"github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/testutil"
+)
+
+func TestEventBus(t *testing.T) {
+	stream := newFakeStream("shard-0")
+	leases := newMemoryLeaseStore()
+	config := &EventBusConfig{
+		PollInterval:    time.Millisecond,
+		LeaseDuration:   20 * time.Millisecond,
+		InitialPosition: kinesis.ShardIteratorTypeTrimHorizon,
+	}
+	bus, err := NewEventBusWithClients(config, stream, leases)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := bus.RegisterEventType(&testutil.TestEvent{}, func() eventhorizon.Event {
+		return &testutil.TestEvent{}
+	}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	localHandler := testutil.NewMockEventHandler()
+	globalHandler := testutil.NewMockEventHandler()
+	bus.AddLocalHandler(localHandler)
+	bus.AddGlobalHandler(globalHandler)
+
+	t.Log("publish event")
+	event1 := &testutil.TestEvent{eventhorizon.NewUUID(), "event1"}
+	bus.PublishEvent(event1)
+	if !reflect.DeepEqual(localHandler.Events, []eventhorizon.Event{event1}) {
+		t.Error("the local handler events should be correct:", localHandler.Events)
+	}
+	if key := stream.partitionKey(0); key != event1.TestID.String() {
+		t.Error("the partition key should be the aggregate ID:", key)
+	}
+	select {
+	case event := <-globalHandler.Recv:
+		if !reflect.DeepEqual(event, event1) {
+			t.Error("the event should be correct:", event)
+		}
+	case <-time.After(time.Second):
+		t.Error("the event should be received")
+	}
+
+	t.Log("checkpoint the shard")
+	waitFor(t, func() bool {
+		lease, _ := leases.Lease(context.Background(), "shard-0")
+		return lease.SequenceNumber == "0"
+	})
+
+	t.Log("close and resume from the checkpoint")
+	bus.Close()
+	if owner := leases.owner("shard-0"); owner != "" {
+		t.Error("the lease should be released:", owner)
+	}
+	event2 := &testutil.TestEvent{eventhorizon.NewUUID(), "event2"}
+	stream.put("shard-0", event2)
+	bus, err = NewEventBusWithClients(config, stream, leases)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer bus.Close()
+	bus.RegisterEventType(&testutil.TestEvent{}, func() eventhorizon.Event {
+		return &testutil.TestEvent{}
+	})
+	globalHandler = testutil.NewMockEventHandler()
+	bus.AddGlobalHandler(globalHandler)
+	select {
+	case event := <-globalHandler.Recv:
+		if !reflect.DeepEqual(event, event2) {
+			t.Error("the event should be correct:", event)
+		}
+	case <-time.After(time.Second):
+		t.Error("the event should be received")
+	}
+}
+
+func TestEventBusResharding(t *testing.T) {
+	stream := newFakeStream("parent", "child")
+	stream.shards[1].ParentShardId = aws.String("parent")
+	stream.closed["parent"] = true
+	leases := newMemoryLeaseStore()
+
+	bus, err := NewEventBusWithClients(&EventBusConfig{
+		PollInterval:    time.Millisecond,
+		LeaseDuration:   20 * time.Millisecond,
+		InitialPosition: kinesis.ShardIteratorTypeTrimHorizon,
+	}, stream, leases)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer bus.Close()
+	bus.RegisterEventType(&testutil.TestEvent{}, func() eventhorizon.Event {
+		return &testutil.TestEvent{}
+	})
+
+	t.Log("consume the child after the parent")
+	event1 := &testutil.TestEvent{eventhorizon.NewUUID(), "event1"}
+	event2 := &testutil.TestEvent{eventhorizon.NewUUID(), "event2"}
+	stream.put("child", event2)
+	stream.put("parent", event1)
+	handler := testutil.NewMockEventHandler()
+	bus.AddGlobalHandler(handler)
+	var events []eventhorizon.Event
+	for i := 0; i < 2; i++ {
+		select {
+		case event := <-handler.Recv:
+			events = append(events, event)
+		case <-time.After(time.Second):
+			t.Fatal("the events should be received")
+		}
+	}
+	if !reflect.DeepEqual(events, []eventhorizon.Event{event1, event2}) {
+		t.Error("the events should be in order:", events)
+	}
+	waitFor(t, func() bool {
+		lease, _ := leases.Lease(context.Background(), "parent")
+		return lease.Finished
+	})
+}
+
+func waitFor(t *testing.T, f func() bool) {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		if f() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("the condition should be met")
+}
+
+// fakeStream is a Kinesis stream in memory. Records are put on the first
+// shard that is not closed, and the iterators are the indexes of the records.
+type fakeStream struct {
+	kinesisiface.KinesisAPI
+
+	shards  []*kinesis.Shard
+	records map[string][]*kinesis.Record
+	keys    []string
+	closed  map[string]bool
+	mu      sync.Mutex
+}
+
+func newFakeStream(ids ...string) *fakeStream {
+	s := &fakeStream{
+		records: make(map[string][]*kinesis.Record),
+		closed:  make(map[string]bool),
+	}
+	for _, id := range ids {
+		s.shards = append(s.shards, &kinesis.Shard{ShardId: aws.String(id)})
+	}
+	return s
+}
+
+func (s *fakeStream) partitionKey(i int) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.keys[i]
+}
+
+func (s *fakeStream) put(shardID string, event eventhorizon.Event) {
+	b := &EventBus{}
+	out := &recordingStream{}
+	b.service = out
+	b.config = &EventBusConfig{}
+	if err := b.publishGlobal(context.Background(), event); err != nil {
+		panic(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[shardID] = append(s.records[shardID], &kinesis.Record{
+		SequenceNumber: aws.String(strconv.Itoa(len(s.records[shardID]))),
+		Data:           out.data,
+	})
+}
+
+func (s *fakeStream) ListShardsWithContext(ctx aws.Context, input *kinesis.ListShardsInput, opts ...request.Option) (*kinesis.ListShardsOutput, error) {
+	return &kinesis.ListShardsOutput{Shards: s.shards}, nil
+}
+
+func (s *fakeStream) PutRecordWithContext(ctx aws.Context, input *kinesis.PutRecordInput, opts ...request.Option) (*kinesis.PutRecordOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = append(s.keys, aws.StringValue(input.PartitionKey))
+	for _, shard := range s.shards {
+		id := aws.StringValue(shard.ShardId)
+		if s.closed[id] {
+			continue
+		}
+		seq := aws.String(strconv.Itoa(len(s.records[id])))
+		s.records[id] = append(s.records[id], &kinesis.Record{SequenceNumber: seq, Data: input.Data})
+		return &kinesis.PutRecordOutput{ShardId: shard.ShardId, SequenceNumber: seq}, nil
+	}
+	return &kinesis.PutRecordOutput{}, nil
+}
+
+func (s *fakeStream) GetShardIteratorWithContext(ctx aws.Context, input *kinesis.GetShardIteratorInput, opts ...request.Option) (*kinesis.GetShardIteratorOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := aws.StringValue(input.ShardId)
+	i := 0
+	switch aws.StringValue(input.ShardIteratorType) {
+	case kinesis.ShardIteratorTypeLatest:
+		i = len(s.records[id])
+	case kinesis.ShardIteratorTypeAfterSequenceNumber:
+		seq, _ := strconv.Atoi(aws.StringValue(input.StartingSequenceNumber))
+		i = seq + 1
+	}
+	return &kinesis.GetShardIteratorOutput{ShardIterator: aws.String(id + ":" + strconv.Itoa(i))}, nil
+}
+
+func (s *fakeStream) GetRecordsWithContext(ctx aws.Context, input *kinesis.GetRecordsInput, opts ...request.Option) (*kinesis.GetRecordsOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	iterator := aws.StringValue(input.ShardIterator)
+	var id string
+	var i int
+	for j := len(iterator) - 1; j >= 0; j-- {
+		if iterator[j] == ':' {
+			id = iterator[:j]
+			i, _ = strconv.Atoi(iterator[j+1:])
+			break
+		}
+	}
+	records := s.records[id][i:]
+	out := &kinesis.GetRecordsOutput{Records: records}
+	if !s.closed[id] || len(records) > 0 {
+		out.NextShardIterator = aws.String(id + ":" + strconv.Itoa(i+len(records)))
+	}
+	return out, nil
+}
+
+// recordingStream records the data of the last put record.
+type recordingStream struct {
+	kinesisiface.KinesisAPI
+
+	data []byte
+}
+
+func (s *recordingStream) PutRecordWithContext(ctx aws.Context, input *kinesis.PutRecordInput, opts ...request.Option) (*kinesis.PutRecordOutput, error) {
+	s.data = input.Data
+	return &kinesis.PutRecordOutput{}, nil
+}
+
+type memoryLease struct {
+	Lease
+	owner   string
+	expires time.Time
+}
+
+// memoryLeaseStore is a LeaseStore in memory.
+type memoryLeaseStore struct {
+	leases map[string]*memoryLease
+	mu     sync.Mutex
+}
+
+func newMemoryLeaseStore() *memoryLeaseStore {
+	return &memoryLeaseStore{leases: make(map[string]*memoryLease)}
+}
+
+func (s *memoryLeaseStore) owner(shardID string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if l, ok := s.leases[shardID]; ok {
+		return l.owner
+	}
+	return ""
+}
+
+func (s *memoryLeaseStore) AcquireLease(ctx context.Context, shardID, owner string, expires time.Time) (Lease, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.leases[shardID]
+	if !ok {
+		l = &memoryLease{}
+		s.leases[shardID] = l
+	}
+	if l.owner != "" && l.owner != owner && time.Now().Before(l.expires) {
+		return Lease{}, false, nil
+	}
+	l.owner = owner
+	l.expires = expires
+	return l.Lease, true, nil
+}
+
+func (s *memoryLeaseStore) Lease(ctx context.Context, shardID string) (Lease, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if l, ok := s.leases[shardID]; ok {
+		return l.Lease, nil
+	}
+	return Lease{}, nil
+}
+
+func (s *memoryLeaseStore) Checkpoint(ctx context.Context, shardID, owner, sequenceNumber string, expires time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.leases[shardID]
+	if !ok || l.owner != owner {
+		return ErrLeaseLost
+	}
+	l.SequenceNumber = sequenceNumber
+	l.expires = expires
+	return nil
+}
+
+func (s *memoryLeaseStore) FinishShard(ctx context.Context, shardID, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.leases[shardID]
+	if !ok || l.owner != owner {
+		return ErrLeaseLost
+	}
+	l.Finished = true
+	l.owner = ""
+	return nil
+}
+
+func (s *memoryLeaseStore) ReleaseLease(ctx context.Context, shardID, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.leases[shardID]
+	if !ok || l.owner != owner {
+		return ErrLeaseLost
+	}
+	l.owner = ""
+	return nil
+}
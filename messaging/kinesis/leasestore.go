@@ -0,0 +1,222 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kinesis
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+
+	"github.com/looplab/eventhorizon"
+)
+
+// ErrLeaseLost is when a lease of a shard has been taken by another owner.
+var ErrLeaseLost = errors.New("lease lost")
+
+// Lease is the lease of a shard, with the sequence number of the last handled
+// record of the shard and if the shard has been handled to its end.
+type Lease struct {
+	SequenceNumber string
+	Finished       bool
+}
+
+// LeaseStore keeps leases of the shards of a stream and their checkpoints, so
+// that each shard is consumed by one bus at a time and the consumption resumes
+// from the checkpoints after restarts.
+type LeaseStore interface {
+	// AcquireLease acquires or renews the lease of a shard for an owner until
+	// it expires. Returns false if the lease is held by another owner.
+	AcquireLease(ctx context.Context, shardID, owner string, expires time.Time) (Lease, bool, error)
+
+	// Lease returns the lease of a shard, which is empty if there is none.
+	Lease(ctx context.Context, shardID string) (Lease, error)
+
+	// Checkpoint saves the sequence number of the last handled record of a
+	// shard and renews the lease. Returns ErrLeaseLost if the owner does not
+	// hold the lease.
+	Checkpoint(ctx context.Context, shardID, owner, sequenceNumber string, expires time.Time) error
+
+	// FinishShard marks a shard as handled to its end and releases its lease.
+	FinishShard(ctx context.Context, shardID, owner string) error
+
+	// ReleaseLease releases the lease of a shard held by an owner.
+	ReleaseLease(ctx context.Context, shardID, owner string) error
+}
+
+// DynamoDBLeaseStore is a LeaseStore in a DynamoDB table with the string hash
+// key "Shard", see CreateTable. The leases of different apps can share a
+// table.
+type DynamoDBLeaseStore struct {
+	service dynamodbiface.DynamoDBAPI
+	table   string
+	app     string
+	clock   eventhorizon.Clock
+}
+
+// NewDynamoDBLeaseStore creates a new DynamoDBLeaseStore for the leases of an
+// app. The clock is used for taking over expired leases.
+func NewDynamoDBLeaseStore(service dynamodbiface.DynamoDBAPI, table, app string, clock eventhorizon.Clock) *DynamoDBLeaseStore {
+	return &DynamoDBLeaseStore{
+		service: service,
+		table:   table,
+		app:     app,
+		clock:   clock,
+	}
+}
+
+func (s *DynamoDBLeaseStore) key(shardID string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		"Shard": {S: aws.String(s.app + ":" + shardID)},
+	}
+}
+
+// AcquireLease implements the AcquireLease method of the LeaseStore interface.
+func (s *DynamoDBLeaseStore) AcquireLease(ctx context.Context, shardID, owner string, expires time.Time) (Lease, bool, error) {
+	out, err := s.service.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(s.table),
+		Key:                 s.key(shardID),
+		UpdateExpression:    aws.String("SET #owner = :owner, Expires = :expires"),
+		ConditionExpression: aws.String("attribute_not_exists(#owner) OR #owner = :owner OR Expires < :now"),
+		ExpressionAttributeNames: map[string]*string{
+			"#owner": aws.String("Owner"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":owner":   {S: aws.String(owner)},
+			":expires": {N: aws.String(strconv.FormatInt(expires.UnixNano(), 10))},
+			":now":     {N: aws.String(strconv.FormatInt(s.clock.Now().UnixNano(), 10))},
+		},
+		ReturnValues: aws.String(dynamodb.ReturnValueAllNew),
+	})
+	if isConditionFailed(err) {
+		return Lease{}, false, nil
+	} else if err != nil {
+		return Lease{}, false, err
+	}
+	return leaseFromItem(out.Attributes), true, nil
+}
+
+// Lease implements the Lease method of the LeaseStore interface.
+func (s *DynamoDBLeaseStore) Lease(ctx context.Context, shardID string) (Lease, error) {
+	out, err := s.service.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(s.table),
+		Key:            s.key(shardID),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return Lease{}, err
+	}
+	return leaseFromItem(out.Item), nil
+}
+
+// Checkpoint implements the Checkpoint method of the LeaseStore interface.
+func (s *DynamoDBLeaseStore) Checkpoint(ctx context.Context, shardID, owner, sequenceNumber string, expires time.Time) error {
+	_, err := s.service.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(s.table),
+		Key:                 s.key(shardID),
+		UpdateExpression:    aws.String("SET SequenceNumber = :seq, Expires = :expires"),
+		ConditionExpression: aws.String("#owner = :owner"),
+		ExpressionAttributeNames: map[string]*string{
+			"#owner": aws.String("Owner"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":owner":   {S: aws.String(owner)},
+			":seq":     {S: aws.String(sequenceNumber)},
+			":expires": {N: aws.String(strconv.FormatInt(expires.UnixNano(), 10))},
+		},
+	})
+	if isConditionFailed(err) {
+		return ErrLeaseLost
+	}
+	return err
+}
+
+// FinishShard implements the FinishShard method of the LeaseStore interface.
+func (s *DynamoDBLeaseStore) FinishShard(ctx context.Context, shardID, owner string) error {
+	return s.release(ctx, shardID, owner, "SET Finished = :finished REMOVE #owner",
+		map[string]*dynamodb.AttributeValue{":finished": {BOOL: aws.Bool(true)}})
+}
+
+// ReleaseLease implements the ReleaseLease method of the LeaseStore interface.
+func (s *DynamoDBLeaseStore) ReleaseLease(ctx context.Context, shardID, owner string) error {
+	return s.release(ctx, shardID, owner, "REMOVE #owner", nil)
+}
+
+func (s *DynamoDBLeaseStore) release(ctx context.Context, shardID, owner, update string,
+	values map[string]*dynamodb.AttributeValue) error {
+	if values == nil {
+		values = make(map[string]*dynamodb.AttributeValue)
+	}
+	values[":owner"] = &dynamodb.AttributeValue{S: aws.String(owner)}
+	_, err := s.service.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(s.table),
+		Key:                 s.key(shardID),
+		UpdateExpression:    aws.String(update),
+		ConditionExpression: aws.String("#owner = :owner"),
+		ExpressionAttributeNames: map[string]*string{
+			"#owner": aws.String("Owner"),
+		},
+		ExpressionAttributeValues: values,
+	})
+	if isConditionFailed(err) {
+		return ErrLeaseLost
+	}
+	return err
+}
+
+// CreateTable creates the lease table if it does not exist.
+func (s *DynamoDBLeaseStore) CreateTable(ctx context.Context) error {
+	_, err := s.service.CreateTableWithContext(ctx, &dynamodb.CreateTableInput{
+		TableName: aws.String(s.table),
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{{
+			AttributeName: aws.String("Shard"),
+			AttributeType: aws.String("S"),
+		}},
+		KeySchema: []*dynamodb.KeySchemaElement{{
+			AttributeName: aws.String("Shard"),
+			KeyType:       aws.String("HASH"),
+		}},
+		BillingMode: aws.String(dynamodb.BillingModePayPerRequest),
+	})
+	if err, ok := err.(awserr.Error); ok && err.Code() == dynamodb.ErrCodeResourceInUseException {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return s.service.WaitUntilTableExistsWithContext(ctx, &dynamodb.DescribeTableInput{
+		TableName: aws.String(s.table),
+	})
+}
+
+func leaseFromItem(item map[string]*dynamodb.AttributeValue) Lease {
+	var l Lease
+	if v, ok := item["SequenceNumber"]; ok {
+		l.SequenceNumber = aws.StringValue(v.S)
+	}
+	if v, ok := item["Finished"]; ok {
+		l.Finished = aws.BoolValue(v.BOOL)
+	}
+	return l
+}
+
+func isConditionFailed(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException
+}
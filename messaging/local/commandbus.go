@@ -15,6 +15,8 @@
 package local
 
 import (
+	"context"
+
 	"github.com/looplab/eventhorizon"
 )
 
@@ -40,6 +42,15 @@ func (b *CommandBus) HandleCommand(command eventhorizon.Command) error {
 	return eventhorizon.ErrHandlerNotFound
 }
 
+// HandleCommandWithContext handles a command as HandleCommand, passing the
+// context on to handlers that implement eventhorizon.ContextCommandHandler.
+func (b *CommandBus) HandleCommandWithContext(ctx context.Context, command eventhorizon.Command) error {
+	if handler, ok := b.handlers[command.CommandType()]; ok {
+		return eventhorizon.HandleCommandWithContext(ctx, handler, command)
+	}
+	return eventhorizon.ErrHandlerNotFound
+}
+
 // SetHandler adds a handler for a specific command.
 func (b *CommandBus) SetHandler(handler eventhorizon.CommandHandler, command eventhorizon.Command) error {
 	if _, ok := b.handlers[command.CommandType()]; ok {
@@ -48,3 +59,13 @@ func (b *CommandBus) SetHandler(handler eventhorizon.CommandHandler, command eve
 	b.handlers[command.CommandType()] = handler
 	return nil
 }
+
+// CommandHandlers implements the CommandHandlers method of the
+// eventhorizon.InspectableCommandBus interface.
+func (b *CommandBus) CommandHandlers() map[string]eventhorizon.CommandHandler {
+	handlers := make(map[string]eventhorizon.CommandHandler, len(b.handlers))
+	for commandType, handler := range b.handlers {
+		handlers[commandType] = handler
+	}
+	return handlers
+}
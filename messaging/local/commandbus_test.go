@@ -15,6 +15,7 @@
 package local
 
 import (
+	"context"
 	"testing"
 
 	"github.com/looplab/eventhorizon"
@@ -56,6 +57,32 @@ func TestCommandBus(t *testing.T) {
 	}
 }
 
+func TestCommandBusWithContext(t *testing.T) {
+	bus := NewCommandBus()
+	authorizer := eventhorizon.NewPolicyAuthorizer()
+	authorizer.SetPolicy(eventhorizon.RequireRoles("admin"), &testutil.TestCommand{})
+	handler := &TestCommandHandler{}
+	err := bus.SetHandler(eventhorizon.UseCommandHandlerMiddleware(handler,
+		eventhorizon.AuthorizationMiddleware(authorizer)), &testutil.TestCommand{})
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("handle with the principal of the context")
+	command1 := &testutil.TestCommand{eventhorizon.NewUUID(), "command1"}
+	ctx := eventhorizon.NewContextWithPrincipal(context.Background(),
+		eventhorizon.Principal{ID: "user1", Roles: []string{"admin"}})
+	if err := bus.HandleCommandWithContext(ctx, command1); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if handler.command != command1 {
+		t.Error("the handled command should be correct:", handler.command)
+	}
+	if _, ok := bus.HandleCommand(command1).(eventhorizon.ErrUnauthorized); !ok {
+		t.Error("there should be a ErrUnauthorized error without a principal")
+	}
+}
+
 type TestCommandHandler struct {
 	command eventhorizon.Command
 }
@@ -64,3 +91,14 @@ func (t *TestCommandHandler) HandleCommand(command eventhorizon.Command) error {
 	t.command = command
 	return nil
 }
+
+func TestCommandBusCommandHandlers(t *testing.T) {
+	bus := NewCommandBus()
+	handler := &TestCommandHandler{}
+	bus.SetHandler(handler, &testutil.TestCommand{})
+
+	handlers := bus.CommandHandlers()
+	if len(handlers) != 1 || handlers["TestCommand"] != handler {
+		t.Error("the handlers should be correct:", handlers)
+	}
+}
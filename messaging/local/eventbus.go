@@ -15,61 +15,252 @@
 package local
 
 import (
+	"context"
+	"sort"
+	"sync"
+
 	"github.com/looplab/eventhorizon"
 )
 
 // EventBus is an event bus that notifies registered EventHandlers of
 // published events.
+//
+// The handlers of an event type handle the events in order of priority, see
+// AddHandlerWithPriority, and then in the order they were added. The local and
+// global handlers handle the events after them, in the order they were added.
+//
+// Handlers can be added and removed while events are published, see
+// eventhorizon.HandlerRemover.
 type EventBus struct {
-	eventHandlers  map[string]map[eventhorizon.EventHandler]bool
-	localHandlers  map[eventhorizon.EventHandler]bool
-	globalHandlers map[eventhorizon.EventHandler]bool
+	eventHandlers  map[string][]priorityHandler
+	localHandlers  []eventhorizon.EventHandler
+	globalHandlers []eventhorizon.EventHandler
+	mu             sync.RWMutex
+	deliveries     eventhorizon.DeliveryTracker
+	stats          *eventhorizon.StatsCounter
+}
+
+type priorityHandler struct {
+	handler  eventhorizon.EventHandler
+	priority int
 }
 
 // NewEventBus creates a EventBus.
 func NewEventBus() *EventBus {
 	b := &EventBus{
-		eventHandlers:  make(map[string]map[eventhorizon.EventHandler]bool),
-		localHandlers:  make(map[eventhorizon.EventHandler]bool),
-		globalHandlers: make(map[eventhorizon.EventHandler]bool),
+		eventHandlers: make(map[string][]priorityHandler),
+		stats:         eventhorizon.NewStatsCounter(eventhorizon.SystemClock{}),
 	}
 	return b
 }
 
 // PublishEvent publishes an event to all handlers capable of handling it.
 func (b *EventBus) PublishEvent(event eventhorizon.Event) {
-	if handlers, ok := b.eventHandlers[event.EventType()]; ok {
-		for handler := range handlers {
-			handler.HandleEvent(event)
+	b.PublishEventWithContext(context.Background(), event)
+}
+
+// PublishEventWithContext publishes an event as PublishEvent, passing the
+// context on to handlers that implement eventhorizon.ContextEventHandler.
+func (b *EventBus) PublishEventWithContext(ctx context.Context, event eventhorizon.Event) {
+	// Copy the handlers so that they can add or remove handlers while handling.
+	b.mu.RLock()
+	eventHandlers := b.eventHandlers[event.EventType()]
+	handlers := make([]eventhorizon.EventHandler, 0,
+		len(eventHandlers)+len(b.localHandlers)+len(b.globalHandlers))
+	for _, h := range eventHandlers {
+		handlers = append(handlers, h.handler)
+	}
+	handlers = append(handlers, b.localHandlers...)
+	handlers = append(handlers, b.globalHandlers...)
+	b.mu.RUnlock()
+
+	for _, handler := range handlers {
+		// Skip handlers removed by the handlers before them.
+		if !eventhorizon.MatchEvent(handler, event) || !b.begin(handler, event.EventType()) {
+			continue
 		}
+		b.deliver(ctx, handler, event)
 	}
+	b.stats.AddEvents(1)
+}
 
-	// Publish to local and global handlers.
-	for handler := range b.localHandlers {
-		handler.HandleEvent(event)
+// begin counts a delivery to a handler if it is still added, so that removing
+// the handler waits for it.
+func (b *EventBus) begin(handler eventhorizon.EventHandler, eventType string) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, h := range b.eventHandlers[eventType] {
+		if h.handler == handler {
+			b.deliveries.Begin(handler)
+			return true
+		}
 	}
-	for handler := range b.globalHandlers {
-		handler.HandleEvent(event)
+	if containsHandler(b.localHandlers, handler) || containsHandler(b.globalHandlers, handler) {
+		b.deliveries.Begin(handler)
+		return true
 	}
+	return false
 }
 
-// AddHandler adds a handler for a specific local event.
-func (b *EventBus) AddHandler(handler eventhorizon.EventHandler, event eventhorizon.Event) {
-	// Create handler list for new event types.
-	if _, ok := b.eventHandlers[event.EventType()]; !ok {
-		b.eventHandlers[event.EventType()] = make(map[eventhorizon.EventHandler]bool)
+func (b *EventBus) deliver(ctx context.Context, handler eventhorizon.EventHandler, event eventhorizon.Event) {
+	defer b.deliveries.End(handler)
+	eventhorizon.HandleEventWithContext(ctx, handler, event)
+}
+
+// PublishEventAndWait publishes an event and waits until all handlers have
+// handled it, for flows that must not race the read side. It returns the error
+// of the context if it is done first, while the handlers keep running.
+func (b *EventBus) PublishEventAndWait(ctx context.Context, event eventhorizon.Event) error {
+	if err := ctx.Err(); err != nil {
+		return err
 	}
 
-	// Add handler to event type.
-	b.eventHandlers[event.EventType()][handler] = true
+	done := make(chan struct{})
+	go func() {
+		b.PublishEvent(event)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// AddHandler adds a handler for a specific local event, with priority 0.
+func (b *EventBus) AddHandler(handler eventhorizon.EventHandler, event eventhorizon.Event) {
+	b.AddHandlerWithPriority(handler, event, 0)
+}
+
+// AddHandlerWithPriority adds a handler for a specific local event with a
+// priority. Adding a handler again only changes its priority.
+func (b *EventBus) AddHandlerWithPriority(handler eventhorizon.EventHandler, event eventhorizon.Event, priority int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	handlers := removePriorityHandler(b.eventHandlers[event.EventType()], handler)
+	handlers = append(handlers, priorityHandler{handler, priority})
+
+	// Keep the order of handlers with the same priority.
+	sort.SliceStable(handlers, func(i, j int) bool {
+		return handlers[i].priority > handlers[j].priority
+	})
+	b.eventHandlers[event.EventType()] = handlers
+}
+
+// RemoveHandler removes a handler for a specific local event, and returns when
+// it has handled the events being published to it.
+func (b *EventBus) RemoveHandler(handler eventhorizon.EventHandler, event eventhorizon.Event) {
+	b.mu.Lock()
+	handlers := removePriorityHandler(b.eventHandlers[event.EventType()], handler)
+	if len(handlers) == 0 {
+		delete(b.eventHandlers, event.EventType())
+	} else {
+		b.eventHandlers[event.EventType()] = handlers
+	}
+	b.mu.Unlock()
+	b.deliveries.Wait(handler)
 }
 
 // AddLocalHandler adds a handler for local events.
 func (b *EventBus) AddLocalHandler(handler eventhorizon.EventHandler) {
-	b.localHandlers[handler] = true
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.localHandlers = appendHandler(b.localHandlers, handler)
+}
+
+// RemoveLocalHandler removes a handler for local events, and returns when it
+// has handled the events being published to it.
+func (b *EventBus) RemoveLocalHandler(handler eventhorizon.EventHandler) {
+	b.mu.Lock()
+	b.localHandlers = removeHandler(b.localHandlers, handler)
+	b.mu.Unlock()
+	b.deliveries.Wait(handler)
 }
 
 // AddGlobalHandler adds a handler for global (remote) events.
 func (b *EventBus) AddGlobalHandler(handler eventhorizon.EventHandler) {
-	b.globalHandlers[handler] = true
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.globalHandlers = appendHandler(b.globalHandlers, handler)
+}
+
+// RemoveGlobalHandler removes a handler for global (remote) events, and returns
+// when it has handled the events being published to it.
+func (b *EventBus) RemoveGlobalHandler(handler eventhorizon.EventHandler) {
+	b.mu.Lock()
+	b.globalHandlers = removeHandler(b.globalHandlers, handler)
+	b.mu.Unlock()
+	b.deliveries.Wait(handler)
+}
+
+// removePriorityHandler returns the handlers without a handler. The slice is
+// copied, as publishing may still use the old one.
+func removePriorityHandler(handlers []priorityHandler, handler eventhorizon.EventHandler) []priorityHandler {
+	result := make([]priorityHandler, 0, len(handlers))
+	for _, h := range handlers {
+		if h.handler != handler {
+			result = append(result, h)
+		}
+	}
+	return result
+}
+
+func containsHandler(handlers []eventhorizon.EventHandler, handler eventhorizon.EventHandler) bool {
+	for _, h := range handlers {
+		if h == handler {
+			return true
+		}
+	}
+	return false
+}
+
+// removeHandler returns the handlers without a handler. The slice is copied,
+// as publishing may still use the old one.
+func removeHandler(handlers []eventhorizon.EventHandler, handler eventhorizon.EventHandler) []eventhorizon.EventHandler {
+	result := make([]eventhorizon.EventHandler, 0, len(handlers))
+	for _, h := range handlers {
+		if h != handler {
+			result = append(result, h)
+		}
+	}
+	return result
+}
+
+// Handlers implements the Handlers method of the
+// eventhorizon.InspectableEventBus interface.
+func (b *EventBus) Handlers() []eventhorizon.HandlerRegistration {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	var registrations []eventhorizon.HandlerRegistration
+	eventTypes := make([]string, 0, len(b.eventHandlers))
+	for eventType := range b.eventHandlers {
+		eventTypes = append(eventTypes, eventType)
+	}
+	sort.Strings(eventTypes)
+	for _, eventType := range eventTypes {
+		for _, h := range b.eventHandlers[eventType] {
+			registrations = append(registrations, eventhorizon.HandlerRegistration{
+				EventType: eventType,
+				Handler:   h.handler,
+			})
+		}
+	}
+	for _, handler := range b.localHandlers {
+		registrations = append(registrations, eventhorizon.HandlerRegistration{Handler: handler})
+	}
+	for _, handler := range b.globalHandlers {
+		registrations = append(registrations, eventhorizon.HandlerRegistration{Handler: handler, Global: true})
+	}
+	return registrations
+}
+
+// Stats implements the Stats method of the eventhorizon.StatsProvider
+// interface, with the published events. Events are handled as they are
+// published, so there is no queue.
+func (b *EventBus) Stats() eventhorizon.ComponentStats {
+	return b.stats.Stats()
 }
@@ -15,8 +15,10 @@
 package local
 
 import (
+	"context"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/looplab/eventhorizon"
 	"github.com/looplab/eventhorizon/testutil"
@@ -71,3 +73,239 @@ func TestEventBus(t *testing.T) {
 		t.Error("the global handler events should be correct:", globalHandler.Events)
 	}
 }
+
+func TestEventBusPublishEventAndWait(t *testing.T) {
+	bus := NewEventBus()
+	release := make(chan struct{})
+	var handled []eventhorizon.Event
+	bus.AddLocalHandler(eventhorizon.NewEventHandlerFunc(func(event eventhorizon.Event) {
+		<-release
+		handled = append(handled, event)
+	}))
+
+	t.Log("wait for the handlers")
+	event1 := &testutil.TestEvent{eventhorizon.NewUUID(), "event1"}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		release <- struct{}{}
+	}()
+	if err := bus.PublishEventAndWait(context.Background(), event1); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(handled, []eventhorizon.Event{event1}) {
+		t.Error("the event should be handled:", handled)
+	}
+
+	t.Log("timeout before the handlers are done")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := bus.PublishEventAndWait(ctx, event1); err != context.DeadlineExceeded {
+		t.Error("there should be a DeadlineExceeded error:", err)
+	}
+	release <- struct{}{}
+}
+
+func TestEventBusHandlerPriority(t *testing.T) {
+	bus := NewEventBus()
+	var order []string
+	handler := func(name string) eventhorizon.EventHandler {
+		return eventhorizon.NewEventHandlerFunc(func(event eventhorizon.Event) {
+			order = append(order, name)
+		})
+	}
+
+	groups := eventhorizon.HandlerGroups{"validation", "projection"}
+	bus.AddHandler(handler("notification"), &testutil.TestEvent{})
+	groups.AddHandler(bus, "projection", handler("projection1"), &testutil.TestEvent{})
+	groups.AddHandler(bus, "validation", handler("validation"), &testutil.TestEvent{})
+	groups.AddHandler(bus, "projection", handler("projection2"), &testutil.TestEvent{})
+	bus.AddLocalHandler(handler("local"))
+
+	bus.PublishEvent(&testutil.TestEvent{eventhorizon.NewUUID(), "event1"})
+	expected := []string{"validation", "projection1", "projection2", "notification", "local"}
+	if !reflect.DeepEqual(order, expected) {
+		t.Error("the handlers should be called in order:", order)
+	}
+}
+
+func TestEventBusPublishEventWithContext(t *testing.T) {
+	bus := NewEventBus()
+	handler := &contextHandler{}
+	bus.AddHandler(handler, &testutil.TestEvent{})
+	bus.AddGlobalHandler(handler)
+
+	ctx := eventhorizon.NewContextWithHeaders(context.Background(), eventhorizon.Headers{"trace": "abc"})
+	event := &testutil.TestEvent{eventhorizon.NewUUID(), "event1"}
+	bus.PublishEventWithContext(ctx, event)
+	if !reflect.DeepEqual(handler.headers, []eventhorizon.Headers{{"trace": "abc"}, {"trace": "abc"}}) {
+		t.Error("the handlers should get the headers:", handler.headers)
+	}
+}
+
+type contextHandler struct {
+	headers []eventhorizon.Headers
+}
+
+func (h *contextHandler) HandleEvent(event eventhorizon.Event) {
+	h.HandleEventWithContext(context.Background(), event)
+}
+
+func (h *contextHandler) HandleEventWithContext(ctx context.Context, event eventhorizon.Event) {
+	h.headers = append(h.headers, eventhorizon.HeadersFromContext(ctx))
+}
+
+func TestEventBusHandlers(t *testing.T) {
+	bus := NewEventBus()
+	handler1 := testutil.NewMockEventHandler()
+	handler2 := testutil.NewMockEventHandler()
+	bus.AddHandler(handler1, &testutil.TestEvent{})
+	bus.AddLocalHandler(handler2)
+	bus.AddGlobalHandler(handler1)
+
+	expected := []eventhorizon.HandlerRegistration{
+		{EventType: "TestEvent", Handler: handler1},
+		{Handler: handler2},
+		{Handler: handler1, Global: true},
+	}
+	if handlers := bus.Handlers(); !reflect.DeepEqual(handlers, expected) {
+		t.Error("the handlers should be correct:", handlers)
+	}
+}
+
+func TestEventBusStats(t *testing.T) {
+	bus := NewEventBus()
+	bus.PublishEvent(&testutil.TestEvent{eventhorizon.NewUUID(), "event1"})
+	bus.PublishEvent(&testutil.TestEvent{eventhorizon.NewUUID(), "event2"})
+	stats := bus.Stats()
+	if stats.Events != 2 {
+		t.Error("there should be two events:", stats.Events)
+	}
+	if stats.LastEvent.IsZero() {
+		t.Error("there should be a last event time")
+	}
+}
+
+func TestEventBusRemoveHandler(t *testing.T) {
+	bus := NewEventBus()
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var handled []eventhorizon.Event
+	handler := eventhorizon.NewEventHandlerFunc(func(event eventhorizon.Event) {
+		if len(handled) == 0 {
+			close(started)
+			<-release
+		}
+		handled = append(handled, event)
+	})
+	bus.AddHandler(handler, &testutil.TestEvent{})
+
+	t.Log("remove while an event is handled")
+	event1 := &testutil.TestEvent{eventhorizon.NewUUID(), "event1"}
+	go bus.PublishEvent(event1)
+	<-started
+	removed := make(chan struct{})
+	go func() {
+		bus.RemoveHandler(handler, &testutil.TestEvent{})
+		close(removed)
+	}()
+	select {
+	case <-removed:
+		t.Error("the handler should not be removed while handling")
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(release)
+	select {
+	case <-removed:
+	case <-time.After(time.Second):
+		t.Fatal("the handler should be removed after handling")
+	}
+
+	t.Log("publish after removing")
+	bus.PublishEvent(&testutil.TestEvent{eventhorizon.NewUUID(), "event2"})
+	if !reflect.DeepEqual(handled, []eventhorizon.Event{event1}) {
+		t.Error("the removed handler should not handle events:", handled)
+	}
+	if len(bus.Handlers()) != 0 {
+		t.Error("there should be no handlers:", bus.Handlers())
+	}
+
+	t.Log("remove local and global handlers")
+	bus.AddLocalHandler(handler)
+	bus.AddGlobalHandler(handler)
+	bus.RemoveLocalHandler(handler)
+	bus.RemoveGlobalHandler(handler)
+	if len(bus.Handlers()) != 0 {
+		t.Error("there should be no handlers:", bus.Handlers())
+	}
+}
+
+func TestEventBusMatchingHandler(t *testing.T) {
+	bus := NewEventBus()
+	handler := &matchingHandler{content: "event1"}
+	bus.AddHandler(handler, &testutil.TestEvent{})
+	bus.AddLocalHandler(handler)
+
+	t.Log("publish matching and other events")
+	event1 := &testutil.TestEvent{eventhorizon.NewUUID(), "event1"}
+	bus.PublishEvent(event1)
+	bus.PublishEvent(&testutil.TestEvent{eventhorizon.NewUUID(), "event2"})
+	if !reflect.DeepEqual(handler.handled, []eventhorizon.Event{event1, event1}) {
+		t.Error("only the matching events should be delivered:", handler.handled)
+	}
+
+	t.Log("remove a filtered handler")
+	var handled []eventhorizon.Event
+	filtered := eventhorizon.AddHandlerWithFilter(bus, eventhorizon.NewEventHandlerFunc(func(event eventhorizon.Event) {
+		handled = append(handled, event)
+	}), &testutil.TestEvent{}, func(event eventhorizon.Event) bool {
+		return true
+	})
+	bus.RemoveHandler(filtered, &testutil.TestEvent{})
+	bus.PublishEvent(&testutil.TestEvent{eventhorizon.NewUUID(), "event3"})
+	if len(handled) != 0 {
+		t.Error("the removed handler should not handle events:", handled)
+	}
+}
+
+// matchingHandler handles the events with some content, and records the events
+// that are delivered to it.
+type matchingHandler struct {
+	content string
+	handled []eventhorizon.Event
+}
+
+func (h *matchingHandler) HandleEvent(event eventhorizon.Event) {
+	h.handled = append(h.handled, event)
+}
+
+func (h *matchingHandler) MatchEvent(event eventhorizon.Event) bool {
+	return event.(*testutil.TestEvent).Content == h.content
+}
+
+func TestEventBusRemoveHandlerWhileHandling(t *testing.T) {
+	bus := NewEventBus()
+	var handled []eventhorizon.Event
+	h2 := eventhorizon.NewEventHandlerFunc(func(event eventhorizon.Event) {
+		handled = append(handled, event)
+	})
+	h1 := eventhorizon.NewEventHandlerFunc(func(event eventhorizon.Event) {
+		bus.RemoveHandler(h2, &testutil.TestEvent{})
+	})
+	bus.AddHandler(h1, &testutil.TestEvent{})
+	bus.AddHandler(h2, &testutil.TestEvent{})
+
+	t.Log("remove a handler from a handler of the same event")
+	done := make(chan struct{})
+	go func() {
+		bus.PublishEvent(&testutil.TestEvent{eventhorizon.NewUUID(), "event1"})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("removing the handler should not deadlock")
+	}
+	if len(handled) != 0 {
+		t.Error("the removed handler should not handle the event:", handled)
+	}
+}
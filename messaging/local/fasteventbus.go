@@ -0,0 +1,132 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/looplab/eventhorizon"
+)
+
+// FastEventBus is an event bus optimized for throughput in a single process.
+//
+// Handlers are kept in an immutable dispatch table with one preallocated
+// handler slice per event type. The table is replaced when handlers are added,
+// so publishing never takes a lock and is safe to do concurrently. Adding
+// handlers is comparatively expensive and is expected to happen at startup.
+type FastEventBus struct {
+	table atomic.Value // *dispatchTable
+	mu    sync.Mutex   // Serializes writers.
+}
+
+type dispatchTable struct {
+	// Handlers for specific event types, with the local and global handlers
+	// appended to each slice.
+	eventHandlers map[string][]eventhorizon.EventHandler
+	// Local and global handlers, used for events without specific handlers.
+	defaultHandlers []eventhorizon.EventHandler
+
+	// The original registrations, used when rebuilding the table.
+	typeHandlers   map[string][]eventhorizon.EventHandler
+	localHandlers  []eventhorizon.EventHandler
+	globalHandlers []eventhorizon.EventHandler
+}
+
+// NewFastEventBus creates a FastEventBus.
+func NewFastEventBus() *FastEventBus {
+	b := &FastEventBus{}
+	b.table.Store(&dispatchTable{
+		eventHandlers: make(map[string][]eventhorizon.EventHandler),
+		typeHandlers:  make(map[string][]eventhorizon.EventHandler),
+	})
+	return b
+}
+
+// PublishEvent publishes an event to all handlers capable of handling it.
+func (b *FastEventBus) PublishEvent(event eventhorizon.Event) {
+	t := b.table.Load().(*dispatchTable)
+	handlers, ok := t.eventHandlers[event.EventType()]
+	if !ok {
+		handlers = t.defaultHandlers
+	}
+	for _, handler := range handlers {
+		handler.HandleEvent(event)
+	}
+}
+
+// AddHandler adds a handler for a specific local event.
+func (b *FastEventBus) AddHandler(handler eventhorizon.EventHandler, event eventhorizon.Event) {
+	b.update(func(t *dispatchTable) {
+		t.typeHandlers[event.EventType()] = appendHandler(t.typeHandlers[event.EventType()], handler)
+	})
+}
+
+// AddLocalHandler adds a handler for local events.
+func (b *FastEventBus) AddLocalHandler(handler eventhorizon.EventHandler) {
+	b.update(func(t *dispatchTable) {
+		t.localHandlers = appendHandler(t.localHandlers, handler)
+	})
+}
+
+// AddGlobalHandler adds a handler for global (remote) events.
+func (b *FastEventBus) AddGlobalHandler(handler eventhorizon.EventHandler) {
+	b.update(func(t *dispatchTable) {
+		t.globalHandlers = appendHandler(t.globalHandlers, handler)
+	})
+}
+
+// update copies the current table, modifies the registrations and rebuilds the
+// dispatch slices before storing the new table.
+func (b *FastEventBus) update(f func(*dispatchTable)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	old := b.table.Load().(*dispatchTable)
+	t := &dispatchTable{
+		eventHandlers:  make(map[string][]eventhorizon.EventHandler),
+		typeHandlers:   make(map[string][]eventhorizon.EventHandler),
+		localHandlers:  append([]eventhorizon.EventHandler{}, old.localHandlers...),
+		globalHandlers: append([]eventhorizon.EventHandler{}, old.globalHandlers...),
+	}
+	for eventType, handlers := range old.typeHandlers {
+		t.typeHandlers[eventType] = append([]eventhorizon.EventHandler{}, handlers...)
+	}
+
+	f(t)
+
+	t.defaultHandlers = make([]eventhorizon.EventHandler, 0,
+		len(t.localHandlers)+len(t.globalHandlers))
+	t.defaultHandlers = append(t.defaultHandlers, t.localHandlers...)
+	t.defaultHandlers = append(t.defaultHandlers, t.globalHandlers...)
+	for eventType, handlers := range t.typeHandlers {
+		all := make([]eventhorizon.EventHandler, 0, len(handlers)+len(t.defaultHandlers))
+		all = append(all, handlers...)
+		all = append(all, t.defaultHandlers...)
+		t.eventHandlers[eventType] = all
+	}
+
+	b.table.Store(t)
+}
+
+// appendHandler appends a handler if it is not already in the slice.
+func appendHandler(handlers []eventhorizon.EventHandler, handler eventhorizon.EventHandler) []eventhorizon.EventHandler {
+	for _, h := range handlers {
+		if h == handler {
+			return handlers
+		}
+	}
+	return append(handlers, handler)
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/looplab/eventhorizon"
+	bsoncodec "github.com/looplab/eventhorizon/codec/bson"
+)
+
+// ErrCouldNotMarshalCommand is when a command could not be marshaled.
+var ErrCouldNotMarshalCommand = errors.New("could not marshal command")
+
+// ErrCouldNotUnmarshalCommand is when a command could not be unmarshaled into
+// a concrete type.
+var ErrCouldNotUnmarshalCommand = errors.New("could not unmarshal command")
+
+// commandMessage is the wire format of a queued command. The version is missing
+// in commands from older senders, which is version 1.
+type commandMessage struct {
+	Type    string `bson:"type"`
+	Version int    `bson:"version,omitempty"`
+	Data    []byte `bson:"data"`
+}
+
+// CommandBus is a command bus that queues commands in Redis, so that they can
+// be handled by workers in other processes than the ones sending them.
+// HandleCommand only queues the command, any errors from handling it are
+// logged by the worker.
+//
+// Workers set their handlers with SetHandler and consume the queue with Run.
+// The command types must be registered with eventhorizon.RegisterCommandType
+// in the workers, and old versions of them with
+// eventhorizon.RegisterCommandVersion to be upcast. A command is removed from the queue when it is received, so
+// it is lost if the worker crashes while handling it.
+type CommandBus struct {
+	eventhorizon.Lifecycle
+
+	queue    string
+	client   redis.UniversalClient
+	codec    eventhorizon.CommandCodec
+	handlers map[string]eventhorizon.CommandHandler
+	mu       sync.RWMutex
+}
+
+// NewCommandBus creates a CommandBus for remote commands.
+func NewCommandBus(appID string, client redis.UniversalClient) *CommandBus {
+	return &CommandBus{
+		queue:    appID + ":commands",
+		client:   client,
+		codec:    bsoncodec.CommandCodec{},
+		handlers: make(map[string]eventhorizon.CommandHandler),
+	}
+}
+
+// SetCodec sets the codec used for the commands, BSON by default.
+func (b *CommandBus) SetCodec(codec eventhorizon.CommandCodec) {
+	b.codec = codec
+}
+
+// HandleCommand queues a command for a worker to handle.
+func (b *CommandBus) HandleCommand(command eventhorizon.Command) error {
+	data, err := b.codec.MarshalCommand(command)
+	if err != nil {
+		return ErrCouldNotMarshalCommand
+	}
+	m, err := bson.Marshal(commandMessage{command.CommandType(),
+		eventhorizon.CommandVersion(command.CommandType()), data})
+	if err != nil {
+		return ErrCouldNotMarshalCommand
+	}
+
+	return b.client.LPush(context.Background(), b.queue, m).Err()
+}
+
+// SetHandler sets the handler of a command type in this worker.
+func (b *CommandBus) SetHandler(handler eventhorizon.CommandHandler, command eventhorizon.Command) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.handlers[command.CommandType()]; ok {
+		return eventhorizon.ErrHandlerAlreadySet
+	}
+	b.handlers[command.CommandType()] = handler
+	return nil
+}
+
+// Run receives queued commands and handles them with the handlers of this
+// worker, until the context is done. Several workers can consume the same
+// queue, each command is handled by one of them.
+func (b *CommandBus) Run(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+		}
+
+		// Block for at most a second to notice when the context is done.
+		reply, err := b.client.BRPop(ctx, time.Second, b.queue).Result()
+		if err == redis.Nil {
+			continue
+		} else if ctx.Err() != nil {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if err := b.handle([]byte(reply[1])); err != nil {
+			log.Printf("error: command bus handle: %v\n", err)
+		}
+	}
+}
+
+// handle decodes a queued command and handles it.
+func (b *CommandBus) handle(data []byte) error {
+	var m commandMessage
+	if err := bson.Unmarshal(data, &m); err != nil {
+		return ErrCouldNotUnmarshalCommand
+	}
+	if m.Version == 0 {
+		m.Version = 1
+	}
+	command, err := eventhorizon.UnmarshalCommandVersion(b.codec, m.Type, m.Version, m.Data)
+	if err == eventhorizon.ErrCommandNotRegistered || err == eventhorizon.ErrCommandVersionNotRegistered {
+		return err
+	} else if err != nil {
+		return ErrCouldNotUnmarshalCommand
+	}
+
+	b.mu.RLock()
+	handler, ok := b.handlers[m.Type]
+	b.mu.RUnlock()
+	if !ok {
+		return eventhorizon.ErrHandlerNotFound
+	}
+	return handler.HandleCommand(command)
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/testutil"
+)
+
+func TestCommandBus(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: redisURL()})
+	defer client.Close()
+	if err := eventhorizon.RegisterCommandType(func() eventhorizon.Command {
+		return &testutil.TestCommand{}
+	}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer eventhorizon.UnregisterCommandType("TestCommand")
+
+	appID := "test-" + eventhorizon.NewUUID().String()
+	bus := NewCommandBus(appID, client)
+	worker := NewCommandBus(appID, client)
+	handled := make(chan eventhorizon.Command, 1)
+	err := worker.SetHandler(eventhorizon.CommandHandlerFunc(func(command eventhorizon.Command) error {
+		handled <- command
+		return nil
+	}), &testutil.TestCommand{})
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("queue command")
+	command := &testutil.TestCommand{eventhorizon.NewUUID(), "command1"}
+	if err := bus.HandleCommand(command); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("handle command in worker")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- worker.Run(ctx) }()
+	if received := <-handled; !reflect.DeepEqual(received, command) {
+		t.Error("the command should be correct:", received)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Error("there should be no error:", err)
+	}
+}
+
+func TestCommandBusUpcast(t *testing.T) {
+	if err := eventhorizon.RegisterCommandType(func() eventhorizon.Command {
+		return &testutil.TestCommand{}
+	}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer eventhorizon.UnregisterCommandType("TestCommand")
+	if err := eventhorizon.RegisterCommandVersion(1, func() eventhorizon.Command {
+		return &testCommandV1{}
+	}, func(c eventhorizon.Command) (eventhorizon.Command, error) {
+		v1 := c.(*testCommandV1)
+		return &testutil.TestCommand{TestID: eventhorizon.UUID(v1.ID), Content: v1.Text}, nil
+	}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer eventhorizon.UnregisterCommandVersions("TestCommand")
+
+	worker := NewCommandBus("test", nil)
+	var handled eventhorizon.Command
+	worker.SetHandler(eventhorizon.CommandHandlerFunc(func(command eventhorizon.Command) error {
+		handled = command
+		return nil
+	}), &testutil.TestCommand{})
+
+	t.Log("upcast a command from an older sender")
+	id := eventhorizon.NewUUID()
+	data, _ := bson.Marshal(&testCommandV1{ID: id.String(), Text: "command1"})
+	m, _ := bson.Marshal(bson.M{"type": "TestCommand", "data": data})
+	if err := worker.handle(m); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	expected := &testutil.TestCommand{TestID: id, Content: "command1"}
+	if !reflect.DeepEqual(handled, expected) {
+		t.Error("the command should be upcast:", handled)
+	}
+}
+
+type testCommandV1 struct {
+	ID   string
+	Text string
+}
+
+func (c *testCommandV1) AggregateID() eventhorizon.UUID { return eventhorizon.UUID(c.ID) }
+func (c *testCommandV1) AggregateType() string          { return "TestAggregate" }
+func (c *testCommandV1) CommandType() string            { return "TestCommand" }
@@ -0,0 +1,106 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/looplab/eventhorizon"
+)
+
+// Counters are counters of an EventBus since it was created, for monitoring
+// without a metrics library. They can be published with expvar:
+//     expvar.Publish("eventbus", expvar.Func(func() interface{} {
+//         return bus.Counters()
+//     }))
+type Counters struct {
+	// Published is the number of events sent to Redis, and PublishErrors the
+	// number of events that could not be sent.
+	Published     uint64
+	PublishErrors uint64
+	// Received is the number of events received from Redis, ReceiveErrors the
+	// number of messages that could not be received or decoded, and Expired
+	// the number of events dropped because of their TTL.
+	Received      uint64
+	ReceiveErrors uint64
+	Expired       uint64
+	// Handled is the number of deliveries of received events to global
+	// handlers, and Shed the number of deliveries shed by backpressure.
+	Handled uint64
+	Shed    uint64
+	// Reconnects is the number of times the subscription was lost and
+	// subscribed again.
+	Reconnects uint64
+	// Pool are the stats of the connection pool of the client.
+	Pool *redis.PoolStats
+}
+
+// counters are the counters of an EventBus, updated atomically.
+type counters struct {
+	published     atomic.Uint64
+	publishErrors atomic.Uint64
+	received      atomic.Uint64
+	receiveErrors atomic.Uint64
+	expired       atomic.Uint64
+	handled       atomic.Uint64
+	reconnects    atomic.Uint64
+	lastEvent     atomic.Int64 // In Unix nanoseconds.
+	start         time.Time
+}
+
+// Counters returns the current counters of the event bus.
+func (b *EventBus) Counters() Counters {
+	c := Counters{
+		Published:     b.counters.published.Load(),
+		PublishErrors: b.counters.publishErrors.Load(),
+		Received:      b.counters.received.Load(),
+		ReceiveErrors: b.counters.receiveErrors.Load(),
+		Expired:       b.counters.expired.Load(),
+		Handled:       b.counters.handled.Load(),
+		Reconnects:    b.counters.reconnects.Load(),
+		Pool:          b.client.PoolStats(),
+	}
+	if b.dispatcher != nil {
+		c.Handled += b.dispatcher.handledCount.Load()
+		c.Shed = b.dispatcher.shedCount.Load()
+	}
+	return c
+}
+
+// Stats implements the Stats method of the eventhorizon.StatsProvider
+// interface. The events are the events published to and received from Redis,
+// the errors those that could not be published or received, and the queue
+// depth the events waiting to be published asynchronously or to be delivered
+// by the worker pool.
+func (b *EventBus) Stats() eventhorizon.ComponentStats {
+	stats := eventhorizon.ComponentStats{
+		Events:     b.counters.published.Load() + b.counters.received.Load(),
+		Errors:     b.counters.publishErrors.Load() + b.counters.receiveErrors.Load(),
+		QueueDepth: len(b.async),
+	}
+	if b.dispatcher != nil {
+		stats.QueueDepth += b.dispatcher.queued()
+	}
+	if last := b.counters.lastEvent.Load(); last != 0 {
+		stats.LastEvent = time.Unix(0, last).UTC()
+	}
+	if elapsed := b.clock.Now().Sub(b.counters.start); elapsed > 0 {
+		stats.Throughput = float64(stats.Events) / elapsed.Seconds()
+	}
+	return stats
+}
@@ -0,0 +1,354 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"context"
+	"hash/fnv"
+	"log"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/looplab/eventhorizon"
+)
+
+// dispatcher delivers received events to global handlers using a bounded
+// queue and a number of workers per handler, so that a slow handler does not
+// stall delivery to the others until its own queue is full.
+//
+// Each worker of a handler takes events from its own partition, selected by
+// the partition key of the events, so that events with the same key are
+// handled in order. Each partition has one queue per priority level, and
+// queued events with a higher priority are handled first.
+//
+// The number of workers can be set per handler, and the number of events of a
+// type that are handled at the same time can be limited.
+type dispatcher struct {
+	queueSize     int
+	concurrency   int
+	concurrencies map[eventhorizon.EventHandler]int // Per handler, guarded by mu.
+	slots         chan struct{}                     // Limits the total number of busy workers.
+	typeSlots     map[string]chan struct{}          // Limits the busy workers per event type.
+	shed          bool
+	deadLetter    eventhorizon.EventHandler
+	priorities    map[string]int
+	levels        []int // The priority levels, highest first.
+	key           eventhorizon.PartitionKeyFunc
+
+	handledCount atomic.Uint64
+	shedCount    atomic.Uint64
+
+	lanes   map[eventhorizon.EventHandler]*lane
+	removed map[eventhorizon.EventHandler]bool // Handlers without new lanes, guarded by mu.
+	mu      sync.RWMutex
+	wg      sync.WaitGroup
+}
+
+type lane struct {
+	partitions []*partition  // One partition per worker.
+	closing    chan struct{} // Closed when the lane is removed.
+	wg         sync.WaitGroup
+}
+
+type partition struct {
+	queues []chan delivery // One queue per priority level.
+}
+
+// delivery is a queued event with its context.
+type delivery struct {
+	ctx   context.Context
+	event eventhorizon.Event
+}
+
+func newDispatcher(workers, queueSize, concurrency int) *dispatcher {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	d := &dispatcher{
+		queueSize:     queueSize,
+		concurrency:   concurrency,
+		concurrencies: make(map[eventhorizon.EventHandler]int),
+		typeSlots:     make(map[string]chan struct{}),
+		lanes:         make(map[eventhorizon.EventHandler]*lane),
+		removed:       make(map[eventhorizon.EventHandler]bool),
+		levels:        []int{0},
+		key:           eventhorizon.AggregatePartitionKey,
+	}
+	if workers > 0 {
+		d.slots = make(chan struct{}, workers)
+	}
+	return d
+}
+
+// setPriorities sets the priorities of event types, other event types have
+// priority 0. It must be called before dispatching.
+func (d *dispatcher) setPriorities(priorities map[string]int) {
+	d.priorities = priorities
+	seen := map[int]bool{0: true}
+	d.levels = []int{0}
+	for _, priority := range priorities {
+		if !seen[priority] {
+			seen[priority] = true
+			d.levels = append(d.levels, priority)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(d.levels)))
+}
+
+// setConcurrency sets the number of workers of a handler, which is used when
+// the first event is dispatched to it.
+func (d *dispatcher) setConcurrency(handler eventhorizon.EventHandler, concurrency int) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.concurrencies[handler] = concurrency
+}
+
+// setEventConcurrency limits the number of events of a type that are handled
+// at the same time by all handlers. It must be called before dispatching.
+func (d *dispatcher) setEventConcurrency(eventType string, concurrency int) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	d.typeSlots[eventType] = make(chan struct{}, concurrency)
+}
+
+// level returns the index of the priority level of an event.
+func (d *dispatcher) level(event eventhorizon.Event) int {
+	if len(d.levels) == 1 {
+		return 0
+	}
+	priority := d.priorities[event.EventType()]
+	for i, level := range d.levels {
+		if level == priority {
+			return i
+		}
+	}
+	return 0
+}
+
+// partition returns the index of the partition of an event, out of n.
+func (d *dispatcher) partition(event eventhorizon.Event, n int) int {
+	if n == 1 {
+		return 0
+	}
+	h := fnv.New32a()
+	h.Write([]byte(d.key(event)))
+	return int(h.Sum32() % uint32(n))
+}
+
+// dispatch queues an event for a handler. If the queue of the handler is full
+// it blocks, or sheds the event to the dead letter handler if shedding is used.
+// The lock is not held while blocked, a removed handler stops the wait instead.
+// Events for a removed handler are dropped, as they can be dispatched after it
+// has been removed by a delivery that started before.
+func (d *dispatcher) dispatch(ctx context.Context, handler eventhorizon.EventHandler, event eventhorizon.Event) {
+	d.mu.RLock()
+	l, ok := d.lanes[handler]
+	d.mu.RUnlock()
+	if !ok {
+		d.mu.Lock()
+		if d.removed[handler] {
+			d.mu.Unlock()
+			return
+		}
+		if l, ok = d.lanes[handler]; !ok {
+			concurrency, ok := d.concurrencies[handler]
+			if !ok {
+				concurrency = d.concurrency
+			}
+			l = &lane{
+				partitions: make([]*partition, concurrency),
+				closing:    make(chan struct{}),
+			}
+			for i := range l.partitions {
+				p := &partition{queues: make([]chan delivery, len(d.levels))}
+				for j := range p.queues {
+					p.queues[j] = make(chan delivery, d.queueSize)
+				}
+				l.partitions[i] = p
+				d.wg.Add(1)
+				l.wg.Add(1)
+				go d.work(handler, l, p)
+			}
+			d.lanes[handler] = l
+		}
+		d.mu.Unlock()
+	}
+
+	queue := l.partitions[d.partition(event, len(l.partitions))].queues[d.level(event)]
+	if !d.shed {
+		select {
+		case queue <- delivery{ctx, event}:
+		case <-l.closing:
+		}
+		return
+	}
+
+	select {
+	case queue <- delivery{ctx, event}:
+	case <-l.closing:
+	default:
+		log.Printf("error: event bus dispatch: %v: %s\n", ErrEventShed, event.EventType())
+		d.shedCount.Add(1)
+		if d.deadLetter != nil {
+			eventhorizon.HandleEventWithContext(ctx, d.deadLetter, event)
+		}
+	}
+}
+
+func (d *dispatcher) work(handler eventhorizon.EventHandler, l *lane, p *partition) {
+	defer d.wg.Done()
+	defer l.wg.Done()
+
+	// Without priorities there is only one queue to take events from.
+	if len(p.queues) == 1 {
+		for {
+			select {
+			case dl := <-p.queues[0]:
+				d.handle(handler, l, dl)
+			case <-l.closing:
+				d.drain(handler, l, p)
+				return
+			}
+		}
+	}
+
+	// Take queued events by priority, or wait for any queue when all are
+	// empty. The last case is the closing of the lane.
+	cases := make([]reflect.SelectCase, len(p.queues)+1)
+	for i, queue := range p.queues {
+		cases[i] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(queue)}
+	}
+	cases[len(p.queues)] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(l.closing)}
+	for {
+		dl, ok := receivePriority(p.queues)
+		if !ok {
+			i, v, _ := reflect.Select(cases)
+			if i == len(p.queues) {
+				d.drain(handler, l, p)
+				return
+			}
+			dl = v.Interface().(delivery)
+		}
+		d.handle(handler, l, dl)
+	}
+}
+
+// drain handles the events left in the queues of a closing lane.
+func (d *dispatcher) drain(handler eventhorizon.EventHandler, l *lane, p *partition) {
+	for {
+		dl, ok := receivePriority(p.queues)
+		if !ok {
+			return
+		}
+		d.handle(handler, l, dl)
+	}
+}
+
+// receivePriority receives from the first queue that has an event without
+// blocking. It returns false if all queues are empty.
+func receivePriority(queues []chan delivery) (delivery, bool) {
+	for _, queue := range queues {
+		select {
+		case dl := <-queue:
+			return dl, true
+		default:
+		}
+	}
+	return delivery{}, false
+}
+
+func (d *dispatcher) handle(handler eventhorizon.EventHandler, l *lane, dl delivery) {
+	// Take the slot of the event type before a worker slot, so that workers
+	// waiting for the event type don't hold worker slots.
+	typeSlots := d.typeSlots[dl.event.EventType()]
+	if typeSlots != nil && acquire(typeSlots, l.closing) {
+		defer func() { <-typeSlots }()
+	}
+	if d.slots != nil && acquire(d.slots, l.closing) {
+		defer func() { <-d.slots }()
+	}
+	eventhorizon.HandleEventWithLabels(dl.ctx, handler, dl.event)
+	d.handledCount.Add(1)
+}
+
+// acquire takes a slot, or gives up when the lane is closing. A closing lane
+// is drained without slots, as the slots could be held by a handler that is
+// waiting for the lane to be removed.
+func acquire(slots chan struct{}, closing chan struct{}) bool {
+	select {
+	case slots <- struct{}{}:
+		return true
+	case <-closing:
+		return false
+	}
+}
+
+// add lets events be dispatched to a handler that has been removed before.
+func (d *dispatcher) add(handler eventhorizon.EventHandler) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.removed, handler)
+}
+
+// remove stops the workers of a handler after its queue has been drained, and
+// waits for them to finish. Events dispatched to the handler after this are
+// dropped until it is added again.
+func (d *dispatcher) remove(handler eventhorizon.EventHandler) {
+	d.mu.Lock()
+	l, ok := d.lanes[handler]
+	if ok {
+		delete(d.lanes, handler)
+	}
+	delete(d.concurrencies, handler)
+	d.removed[handler] = true
+	d.mu.Unlock()
+
+	if ok {
+		close(l.closing)
+		l.wg.Wait()
+	}
+}
+
+// queued returns the number of events waiting in the queues of all handlers.
+func (d *dispatcher) queued() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	n := 0
+	for _, l := range d.lanes {
+		for _, p := range l.partitions {
+			for _, queue := range p.queues {
+				n += len(queue)
+			}
+		}
+	}
+	return n
+}
+
+// close stops all workers and waits for the queued events to be handled.
+func (d *dispatcher) close() {
+	d.mu.Lock()
+	for handler, l := range d.lanes {
+		close(l.closing)
+		delete(d.lanes, handler)
+	}
+	d.mu.Unlock()
+	d.wg.Wait()
+}
@@ -0,0 +1,347 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/testutil"
+)
+
+func TestDispatcher(t *testing.T) {
+	ctx := context.Background()
+	d := newDispatcher(0, 10, 1)
+
+	t.Log("a slow handler does not block a fast one")
+	slow := &blockingHandler{release: make(chan struct{})}
+	fast := testutil.NewMockEventHandler()
+	event1 := &testutil.TestEvent{eventhorizon.NewUUID(), "event1"}
+	d.dispatch(ctx, slow, event1)
+	d.dispatch(ctx, fast, event1)
+	select {
+	case <-fast.Recv:
+	case <-time.After(time.Second):
+		t.Error("the fast handler should receive the event")
+	}
+
+	t.Log("close waits for queued events")
+	d.dispatch(ctx, slow, event1)
+	close(slow.release)
+	d.close()
+	if slow.handled() != 2 {
+		t.Error("the slow handler should handle all events:", slow.handled())
+	}
+}
+
+func TestDispatcherConcurrency(t *testing.T) {
+	ctx := context.Background()
+	d := newDispatcher(2, 10, 4)
+	handler := &blockingHandler{release: make(chan struct{})}
+	for _, event := range partitionedEvents(d, 4) {
+		d.dispatch(ctx, handler, event)
+	}
+
+	// Only two workers can be busy at the same time.
+	time.Sleep(10 * time.Millisecond)
+	if n := handler.maxActive(); n != 2 {
+		t.Error("there should be two active workers:", n)
+	}
+	close(handler.release)
+	d.close()
+	if handler.handled() != 4 {
+		t.Error("the handler should handle all events:", handler.handled())
+	}
+}
+
+func TestDispatcherHandlerConcurrency(t *testing.T) {
+	ctx := context.Background()
+	d := newDispatcher(0, 10, 1)
+	wide := &blockingHandler{release: make(chan struct{})}
+	serial := &blockingHandler{release: make(chan struct{})}
+	d.setConcurrency(wide, 3)
+
+	t.Log("handle events with the concurrency of each handler")
+	for _, event := range partitionedEvents(d, 3) {
+		d.dispatch(ctx, wide, event)
+		d.dispatch(ctx, serial, event)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if n := wide.maxActive(); n != 3 {
+		t.Error("there should be three active workers:", n)
+	}
+	if n := serial.maxActive(); n != 1 {
+		t.Error("there should be one active worker:", n)
+	}
+	close(wide.release)
+	close(serial.release)
+	d.close()
+}
+
+func TestDispatcherEventConcurrency(t *testing.T) {
+	ctx := context.Background()
+	d := newDispatcher(0, 10, 4)
+	d.setEventConcurrency("TestEvent", 2)
+	handler := &blockingHandler{release: make(chan struct{})}
+	other := &blockingHandler{release: make(chan struct{})}
+
+	t.Log("limit the events of a type handled at the same time")
+	for _, event := range partitionedEvents(d, 4) {
+		d.dispatch(ctx, handler, event)
+		d.dispatch(ctx, other, event)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if n := handler.maxActive() + other.maxActive(); n != 2 {
+		t.Error("there should be two active workers:", n)
+	}
+	close(handler.release)
+	close(other.release)
+	d.close()
+	if n := handler.handled() + other.handled(); n != 8 {
+		t.Error("the handlers should handle all events:", n)
+	}
+}
+
+func TestDispatcherPartition(t *testing.T) {
+	ctx := context.Background()
+	d := newDispatcher(0, 10, 4)
+	handler := &orderHandler{
+		blockingHandler: blockingHandler{release: make(chan struct{})},
+	}
+	close(handler.release)
+
+	t.Log("handle events for the same aggregate in order")
+	id := eventhorizon.NewUUID()
+	var events []eventhorizon.Event
+	for i := 0; i < 20; i++ {
+		event := &testutil.TestEvent{id, "event"}
+		events = append(events, event)
+		d.dispatch(ctx, handler, event)
+	}
+	d.close()
+	for i := range events {
+		if handler.events[i] != events[i] {
+			t.Error("the events should be handled in order:", i)
+		}
+	}
+}
+
+func TestDispatcherShed(t *testing.T) {
+	ctx := context.Background()
+	d := newDispatcher(0, 1, 1)
+	deadLetter := testutil.NewMockEventHandler()
+	d.shed = true
+	d.deadLetter = deadLetter
+
+	handler := &blockingHandler{release: make(chan struct{})}
+	event1 := &testutil.TestEvent{eventhorizon.NewUUID(), "event1"}
+	event2 := &testutil.TestEvent{eventhorizon.NewUUID(), "event2"}
+	event3 := &testutil.TestEvent{eventhorizon.NewUUID(), "event3"}
+
+	t.Log("shed event when the buffer is full")
+	d.dispatch(ctx, handler, event1)
+	time.Sleep(10 * time.Millisecond) // Let the worker take the first event.
+	d.dispatch(ctx, handler, event2)
+	d.dispatch(ctx, handler, event3)
+	select {
+	case event := <-deadLetter.Recv:
+		if event != event3 {
+			t.Error("the shed event should be correct:", event)
+		}
+	case <-time.After(time.Second):
+		t.Error("the dead letter handler should receive the event")
+	}
+
+	close(handler.release)
+	d.close()
+	if handler.handled() != 2 {
+		t.Error("the handler should handle the buffered events:", handler.handled())
+	}
+}
+
+func TestDispatcherPriority(t *testing.T) {
+	ctx := context.Background()
+	d := newDispatcher(0, 10, 1)
+	d.setPriorities(map[string]int{"TestEventOther": 1})
+
+	handler := &orderHandler{
+		blockingHandler: blockingHandler{release: make(chan struct{})},
+	}
+	event1 := &testutil.TestEvent{eventhorizon.NewUUID(), "event1"}
+	event2 := &testutil.TestEvent{eventhorizon.NewUUID(), "event2"}
+	event3 := &testutil.TestEventOther{eventhorizon.NewUUID(), "event3"}
+
+	t.Log("handle events with higher priority first")
+	d.dispatch(ctx, handler, event1)
+	time.Sleep(10 * time.Millisecond) // Let the worker take the first event.
+	d.dispatch(ctx, handler, event2)
+	d.dispatch(ctx, handler, event3)
+	close(handler.release)
+	d.close()
+	if !reflect.DeepEqual(handler.events, []eventhorizon.Event{event1, event3, event2}) {
+		t.Error("the events should be handled by priority:", handler.events)
+	}
+}
+
+// partitionedEvents returns one event for each of n partitions.
+func partitionedEvents(d *dispatcher, n int) []eventhorizon.Event {
+	events := make([]eventhorizon.Event, n)
+	for found := 0; found < n; {
+		event := &testutil.TestEvent{eventhorizon.NewUUID(), "event"}
+		if i := d.partition(event, n); events[i] == nil {
+			events[i] = event
+			found++
+		}
+	}
+	return events
+}
+
+func TestDispatcherRemove(t *testing.T) {
+	ctx := context.Background()
+	d := newDispatcher(1, 1, 1)
+	removed := &blockingHandler{release: make(chan struct{})}
+	close(removed.release)
+	release := make(chan struct{})
+	remover := eventhorizon.NewEventHandlerFunc(func(event eventhorizon.Event) {
+		<-release
+		d.remove(removed)
+	})
+
+	t.Log("remove a handler from a handler holding the worker slot")
+	event1 := &testutil.TestEvent{eventhorizon.NewUUID(), "event1"}
+	d.dispatch(ctx, remover, event1)
+	time.Sleep(10 * time.Millisecond) // Let the remover take the worker slot.
+	d.dispatch(ctx, removed, event1)
+	blocked := make(chan struct{})
+	go func() {
+		// Blocks on the full queue until the handler is removed.
+		for i := 0; i < 3; i++ {
+			d.dispatch(ctx, removed, event1)
+		}
+		close(blocked)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+
+	closed := make(chan struct{})
+	go func() {
+		<-blocked
+		d.close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("removing the handler should not deadlock")
+	}
+	if removed.handled() < 2 {
+		t.Error("the removed handler should handle the queued events:", removed.handled())
+	}
+}
+
+func TestDispatcherRemoveWhileDispatching(t *testing.T) {
+	ctx := context.Background()
+	d := newDispatcher(0, 10, 2)
+	handler := &blockingHandler{release: make(chan struct{})}
+	close(handler.release)
+	event1 := &testutil.TestEvent{eventhorizon.NewUUID(), "event1"}
+
+	t.Log("dispatch while the handler is removed")
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				d.dispatch(ctx, handler, event1)
+			}
+		}
+	}()
+	time.Sleep(10 * time.Millisecond)
+	d.remove(handler)
+	handled := handler.handled()
+	time.Sleep(10 * time.Millisecond)
+	close(stop)
+	<-done
+	if n := handler.handled(); n != handled {
+		t.Error("the removed handler should not handle more events:", n-handled)
+	}
+	if n := len(d.lanes); n != 0 {
+		t.Error("there should be no lanes for the removed handler:", n)
+	}
+
+	t.Log("add the handler again")
+	d.add(handler)
+	d.dispatch(ctx, handler, event1)
+	d.close()
+	if handler.handled() != handled+1 {
+		t.Error("the added handler should handle the event:", handler.handled()-handled)
+	}
+}
+
+type orderHandler struct {
+	blockingHandler
+	events []eventhorizon.Event
+}
+
+func (h *orderHandler) HandleEvent(event eventhorizon.Event) {
+	h.blockingHandler.HandleEvent(event)
+	h.mu.Lock()
+	h.events = append(h.events, event)
+	h.mu.Unlock()
+}
+
+type blockingHandler struct {
+	release chan struct{}
+	mu      sync.Mutex
+	active  int
+	max     int
+	n       int
+}
+
+func (h *blockingHandler) HandleEvent(event eventhorizon.Event) {
+	h.mu.Lock()
+	h.active++
+	if h.active > h.max {
+		h.max = h.active
+	}
+	h.mu.Unlock()
+
+	<-h.release
+
+	h.mu.Lock()
+	h.active--
+	h.n++
+	h.mu.Unlock()
+}
+
+func (h *blockingHandler) handled() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.n
+}
+
+func (h *blockingHandler) maxActive() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.max
+}
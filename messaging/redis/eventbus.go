@@ -15,15 +15,17 @@
 package redis
 
 import (
+	"context"
 	"errors"
 	"log"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/garyburd/redigo/redis"
-	"gopkg.in/mgo.v2/bson"
+	"github.com/redis/go-redis/v9"
 
 	"github.com/looplab/eventhorizon"
+	bsoncodec "github.com/looplab/eventhorizon/codec/bson"
 )
 
 // ErrEventNotRegistered is when an event is not registered.
@@ -35,92 +37,418 @@ var ErrCouldNotMarshalEvent = errors.New("could not marshal event")
 // ErrCouldNotUnmarshalEvent is when an event could not be unmarshaled into a concrete type.
 var ErrCouldNotUnmarshalEvent = errors.New("could not unmarshal event")
 
+// ErrEventBusClosed is when an event is published on a closed event bus.
+var ErrEventBusClosed = errors.New("event bus is closed")
+
+// ErrEventShed is when an event is dropped because a handler can't keep up.
+var ErrEventShed = errors.New("event shed")
+
+// ErrInvalidBufferSize is when a negative buffer size is used.
+var ErrInvalidBufferSize = errors.New("invalid buffer size")
+
+// ErrMessageExpired is when a received event has passed its expiry.
+var ErrMessageExpired = errors.New("message expired")
+
 // EventBus is an event bus that notifies registered EventHandlers of
 // published events.
+//
+// Received events are handled by global handlers with the pprof labels of
+// eventhorizon.HandleEventWithLabels, so that CPU profiles show the time spent
+// per handler and event type. Handlers can be named for the profiles by
+// implementing eventhorizon.NamedEventHandler.
+//
+// Hooks can be added with OnStart and OnStop, which are called when the bus is
+// started and stopped by an eventhorizon.App.
 type EventBus struct {
+	eventhorizon.Lifecycle
+
 	eventHandlers  map[string]map[eventhorizon.EventHandler]bool
 	localHandlers  map[eventhorizon.EventHandler]bool
-	globalHandlers map[eventhorizon.EventHandler]bool
+	globalHandlers map[eventhorizon.EventHandler]eventhorizon.EventHandler // The handlers as delivered to.
 	prefix         string
-	pool           *redis.Pool
-	conn           *redis.PubSubConn
+	client         redis.UniversalClient
+	ownClient      bool
+	pubsub         *redis.PubSub
+	cancel         context.CancelFunc
 	factories      map[string]func() eventhorizon.Event
 	exit           chan struct{}
+	dispatcher     *dispatcher
+	backpressure   *backpressure
+	priorities     map[string]int
+	typeLimits     map[string]int
+	partitionKey   eventhorizon.PartitionKeyFunc
+	ttl            time.Duration
+	ttls           map[string]time.Duration
+	clock          eventhorizon.Clock
+	historySize    int
+	codecs         *eventhorizon.EventCodecs
+	retry          *retry
+	deliverMu      sync.Mutex
+	deliveries     eventhorizon.DeliveryTracker
+	received       []eventhorizon.EventHandler
+	async          chan asyncPublish
+	asyncDone      chan struct{}
+	asyncClosed    bool
+	asyncMu        sync.RWMutex
+	counters       counters
+	mu             sync.RWMutex
 }
 
-// NewEventBus creates a EventBus for remote events.
-func NewEventBus(appID, server, password string) (*EventBus, error) {
-	pool := &redis.Pool{
-		MaxIdle:     3,
-		IdleTimeout: 240 * time.Second,
-		Dial: func() (redis.Conn, error) {
-			c, err := redis.Dial("tcp", server)
-			if err != nil {
-				return nil, err
-			}
-			if password != "" {
-				if _, err := c.Do("AUTH", password); err != nil {
-					c.Close()
-					return nil, err
-				}
-			}
-			return c, err
-		},
-		TestOnBorrow: func(c redis.Conn, t time.Time) error {
-			_, err := c.Do("PING")
-			return err
-		},
+// Option is an option setter used to configure creation.
+type Option func(*EventBus) error
+
+// WithWorkerPool delivers received events to global handlers from a pool of
+// workers instead of the receiving goroutine. Each handler gets
+// handlerConcurrency workers with a queue of queueSize events each, and at most
+// workers handlers run at the same time (0 means no limit). The receiver blocks
+// when a queue is full. Events are partitioned between the workers of a handler
+// by their partition key, see WithPartitionKey, and events with the same key
+// are delivered in order.
+func WithWorkerPool(workers, queueSize, handlerConcurrency int) Option {
+	return func(b *EventBus) error {
+		b.dispatcher = newDispatcher(workers, queueSize, handlerConcurrency)
+		return nil
 	}
+}
+
+// Backpressure is a policy for when a global handler can't keep up with the
+// received events.
+type Backpressure int
 
-	return NewEventBusWithPool(appID, pool)
+const (
+	// BackpressureBlock blocks the receiver when the queue of a handler is full.
+	BackpressureBlock Backpressure = iota
+
+	// BackpressureShed drops events for a handler with a full queue and passes
+	// them to the dead letter handler, if any.
+	BackpressureShed
+)
+
+type backpressure struct {
+	policy     Backpressure
+	bufferSize int
+	deadLetter eventhorizon.EventHandler
+}
+
+// WithBackpressure buffers up to bufferSize received events per global handler
+// and applies the policy when the buffer is full. A bufferSize of 0 with
+// BackpressureBlock blocks the receiver until the handler is done. Shed events
+// are passed to deadLetter, which may be nil. The buffer size replaces the
+// queue size of WithWorkerPool.
+func WithBackpressure(policy Backpressure, bufferSize int, deadLetter eventhorizon.EventHandler) Option {
+	return func(b *EventBus) error {
+		if bufferSize < 0 {
+			return ErrInvalidBufferSize
+		}
+		b.backpressure = &backpressure{
+			policy:     policy,
+			bufferSize: bufferSize,
+			deadLetter: deadLetter,
+		}
+		return nil
+	}
+}
+
+// WithAsyncQueue sets the number of events that can be queued by
+// PublishEventAsync before it blocks, the default is 100.
+func WithAsyncQueue(size int) Option {
+	return func(b *EventBus) error {
+		b.async = make(chan asyncPublish, size)
+		return nil
+	}
 }
 
-// NewEventBusWithPool creates a EventBus for remote events.
-func NewEventBusWithPool(appID string, pool *redis.Pool) (*EventBus, error) {
+// WithPartitionKey sets the key used to partition received events between the
+// workers of a handler, the default is eventhorizon.AggregatePartitionKey.
+func WithPartitionKey(f eventhorizon.PartitionKeyFunc) Option {
+	return func(b *EventBus) error {
+		b.partitionKey = f
+		return nil
+	}
+}
+
+// WithPriority sets the priority of event types for delivery to global
+// handlers, the default is 0. When events are queued for a handler the ones with
+// a higher priority are handled first. Queues are needed for this, so a worker
+// pool with a queue size of 100 is used if none is set.
+func WithPriority(priority int, events ...eventhorizon.Event) Option {
+	return func(b *EventBus) error {
+		if b.priorities == nil {
+			b.priorities = make(map[string]int)
+		}
+		for _, event := range events {
+			b.priorities[event.EventType()] = priority
+		}
+		return nil
+	}
+}
+
+// WithEventConcurrency limits the number of events of the event types that
+// are handled at the same time by all global handlers, for example for events
+// whose handlers call a rate limited service. Queues are needed for this, so
+// a worker pool with a queue size of 100 is used if none is set.
+func WithEventConcurrency(concurrency int, events ...eventhorizon.Event) Option {
+	return func(b *EventBus) error {
+		if b.typeLimits == nil {
+			b.typeLimits = make(map[string]int)
+		}
+		for _, event := range events {
+			b.typeLimits[event.EventType()] = concurrency
+		}
+		return nil
+	}
+}
+
+// WithTTL stamps published events with an expiry after ttl, after which they
+// are dropped by the receivers instead of handled. The TTL is used for the
+// given event types, or for all event types if none are given.
+func WithTTL(ttl time.Duration, events ...eventhorizon.Event) Option {
+	return func(b *EventBus) error {
+		if len(events) == 0 {
+			b.ttl = ttl
+			return nil
+		}
+		for _, event := range events {
+			b.ttls[event.EventType()] = ttl
+		}
+		return nil
+	}
+}
+
+// WithClock sets the clock used to stamp and check the expiry of events.
+func WithClock(clock eventhorizon.Clock) Option {
+	return func(b *EventBus) error {
+		b.clock = clock
+		return nil
+	}
+}
+
+type retry struct {
+	backoff    eventhorizon.Backoff
+	deadLetter eventhorizon.EventHandler
+	quarantine eventhorizon.DeadLetterStore
+}
+
+// WithRetry retries global handlers that fail to handle received events, see
+// eventhorizon.FallibleEventHandler, with exponential backoff. Events that
+// still fail after all attempts are passed to deadLetter, which may be nil.
+// Handlers added as an eventhorizon.RetryHandler use their own backoff instead.
+func WithRetry(backoff eventhorizon.Backoff, deadLetter eventhorizon.EventHandler) Option {
+	return func(b *EventBus) error {
+		b.retry = &retry{
+			backoff:    backoff,
+			deadLetter: deadLetter,
+		}
+		return nil
+	}
+}
+
+// WithQuarantine retries global handlers as WithRetry and parks events that
+// still fail after the attempts of the backoff in a dead letter store, with
+// the errors of the attempts, so that a poison event does not block the events
+// after it. See eventhorizon.NewQuarantineHandler for doing this per handler.
+func WithQuarantine(backoff eventhorizon.Backoff, store eventhorizon.DeadLetterStore) Option {
+	return func(b *EventBus) error {
+		b.retry = &retry{
+			backoff:    backoff,
+			quarantine: store,
+		}
+		return nil
+	}
+}
+
+// WithEventCodec marshals events of the event types with a codec instead of
+// BSON, and sends them with the content type of the codec. Receivers need the
+// codec for the content type to unmarshal them, which is set for receiving
+// only if no event types are given.
+func WithEventCodec(contentType string, codec eventhorizon.EventCodec, events ...eventhorizon.Event) Option {
+	return func(b *EventBus) error {
+		b.codecs.SetCodec(contentType, codec, events...)
+		return nil
+	}
+}
+
+// WithDefaultEventCodec marshals events without a codec of their own, see
+// WithEventCodec, with a codec instead of BSON, and sends them with the content
+// type of the codec. Events without a content type are still unmarshaled as
+// BSON, so that events from older senders can be received.
+func WithDefaultEventCodec(contentType string, codec eventhorizon.EventCodec) Option {
+	return func(b *EventBus) error {
+		b.codecs.SetDefaultCodec(contentType, codec)
+		return nil
+	}
+}
+
+// NewEventBus creates a EventBus for remote events.
+func NewEventBus(appID, server, password string, options ...Option) (*EventBus, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     server,
+		Password: password,
+	})
+
+	b, err := NewEventBusWithClient(appID, client, options...)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	b.ownClient = true
+	return b, nil
+}
+
+// NewEventBusWithClient creates a EventBus for remote events with a client.
+// Any of the clients of go-redis can be used, such as redis.NewFailoverClient
+// for Sentinel or redis.NewClusterClient for Cluster. The client is not closed
+// by Close.
+func NewEventBusWithClient(appID string, client redis.UniversalClient, options ...Option) (*EventBus, error) {
 	b := &EventBus{
 		eventHandlers:  make(map[string]map[eventhorizon.EventHandler]bool),
 		localHandlers:  make(map[eventhorizon.EventHandler]bool),
-		globalHandlers: make(map[eventhorizon.EventHandler]bool),
+		globalHandlers: make(map[eventhorizon.EventHandler]eventhorizon.EventHandler),
 		prefix:         appID + ":events:",
-		pool:           pool,
+		client:         client,
 		factories:      make(map[string]func() eventhorizon.Event),
 		exit:           make(chan struct{}),
+		async:          make(chan asyncPublish, 100),
+		asyncDone:      make(chan struct{}),
+		ttls:           make(map[string]time.Duration),
+		clock:          eventhorizon.SystemClock{},
+		codecs:         eventhorizon.NewEventCodecs(bsoncodec.EventCodec{}),
 	}
 
-	// Add a patten matching subscription.
-	b.conn = &redis.PubSubConn{Conn: b.pool.Get()}
-	ready := make(chan struct{})
-	go b.receiveGlobal(ready)
-	err := b.conn.PSubscribe(b.prefix + "*")
-	if err != nil {
-		b.Close()
+	for _, option := range options {
+		if err := option(b); err != nil {
+			return nil, err
+		}
+	}
+	b.counters.start = b.clock.Now()
+
+	if r := b.retry; r != nil && r.quarantine != nil {
+		r.deadLetter = eventhorizon.NewDeadLetterHandler(r.quarantine,
+			eventhorizon.ErrMaxDeliveryAttempts.Error(), b.clock)
+	}
+
+	if bp := b.backpressure; bp != nil {
+		if b.dispatcher == nil {
+			b.dispatcher = newDispatcher(0, bp.bufferSize, 1)
+		}
+		b.dispatcher.queueSize = bp.bufferSize
+		b.dispatcher.shed = bp.policy == BackpressureShed
+		b.dispatcher.deadLetter = bp.deadLetter
+	}
+	if b.priorities != nil {
+		if b.dispatcher == nil {
+			b.dispatcher = newDispatcher(0, 100, 1)
+		}
+		b.dispatcher.setPriorities(b.priorities)
+	}
+	if b.typeLimits != nil {
+		if b.dispatcher == nil {
+			b.dispatcher = newDispatcher(0, 100, 1)
+		}
+		for eventType, concurrency := range b.typeLimits {
+			b.dispatcher.setEventConcurrency(eventType, concurrency)
+		}
+	}
+	if b.partitionKey != nil && b.dispatcher != nil {
+		b.dispatcher.key = b.partitionKey
+	}
+
+	// Add a patten matching subscription and wait for it to be confirmed.
+	ctx, cancel := context.WithCancel(context.Background())
+	b.pubsub = b.client.PSubscribe(ctx, b.prefix+"*")
+	if _, err := b.pubsub.Receive(ctx); err != nil {
+		cancel()
+		b.pubsub.Close()
+		if b.dispatcher != nil {
+			b.dispatcher.close()
+		}
 		return nil, err
 	}
-	<-ready
+	b.cancel = cancel
+
+	go b.sendAsync()
+	go b.receiveGlobal(ctx)
 
 	return b, nil
 }
 
 // PublishEvent publishes an event to all handlers capable of handling it.
 func (b *EventBus) PublishEvent(event eventhorizon.Event) {
-	if handlers, ok := b.eventHandlers[event.EventType()]; ok {
-		for handler := range handlers {
-			handler.HandleEvent(event)
-		}
+	b.publishLocal(context.Background(), event)
+	b.publishGlobal(context.Background(), event)
+}
+
+// PublishEventWithContext publishes an event as PublishEvent, with the headers
+// of the context. The headers are sent together with the event and are passed
+// on to handlers that implement eventhorizon.ContextEventHandler. Sending the
+// event to Redis is canceled if the context is done.
+func (b *EventBus) PublishEventWithContext(ctx context.Context, event eventhorizon.Event) {
+	if err := b.TryPublishEvent(ctx, event); err != nil {
+		log.Printf("error: event bus publish: %v\n", err)
 	}
+}
+
+// TryPublishEvent implements the TryPublishEvent method of the
+// eventhorizon.FallibleEventPublisher interface. It publishes as
+// PublishEventWithContext, and returns the error of sending to Redis.
+func (b *EventBus) TryPublishEvent(ctx context.Context, event eventhorizon.Event) error {
+	b.publishLocal(ctx, event)
+	headers := []eventhorizon.Headers{eventhorizon.HeadersFromContext(ctx)}
+	return b.sendGlobal(ctx, []eventhorizon.Event{event}, headers)[0]
+}
 
-	// Publish to local handlers.
+// PublishEvents publishes events to all handlers capable of handling them. The
+// events are pipelined to Redis in one round trip.
+func (b *EventBus) PublishEvents(events []eventhorizon.Event) {
+	for _, event := range events {
+		b.publishLocal(context.Background(), event)
+	}
+	b.publishGlobal(context.Background(), events...)
+}
+
+func (b *EventBus) publishLocal(ctx context.Context, event eventhorizon.Event) {
+	// Copy the handlers so that they can add or remove handlers while handling.
+	// The slice is reused between calls to avoid an allocation per event.
+	hp := handlerSlicePool.Get().(*[]eventhorizon.EventHandler)
+	handlers := (*hp)[:0]
+	b.mu.RLock()
+	for handler := range b.eventHandlers[event.EventType()] {
+		handlers = append(handlers, handler)
+	}
 	for handler := range b.localHandlers {
-		handler.HandleEvent(event)
+		handlers = append(handlers, handler)
+	}
+	b.mu.RUnlock()
+
+	// Publish to event and local handlers, skipping handlers removed by the
+	// handlers before them.
+	for _, handler := range handlers {
+		if !eventhorizon.MatchEvent(handler, event) || !b.beginLocal(handler, event.EventType()) {
+			continue
+		}
+		b.deliver(ctx, handler, event)
 	}
 
-	// Publish to global handlers.
-	b.publishGlobal(event)
+	// Don't keep references to the handlers in the pool.
+	for i := range handlers {
+		handlers[i] = nil
+	}
+	*hp = handlers[:0]
+	handlerSlicePool.Put(hp)
+}
 
+var handlerSlicePool = sync.Pool{
+	New: func() interface{} {
+		handlers := make([]eventhorizon.EventHandler, 0, 16)
+		return &handlers
+	},
 }
 
 // AddHandler adds a handler for a specific local event.
 func (b *EventBus) AddHandler(handler eventhorizon.EventHandler, event eventhorizon.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
 	// Create handler list for new event types.
 	if _, ok := b.eventHandlers[event.EventType()]; !ok {
 		b.eventHandlers[event.EventType()] = make(map[eventhorizon.EventHandler]bool)
@@ -130,14 +458,109 @@ func (b *EventBus) AddHandler(handler eventhorizon.EventHandler, event eventhori
 	b.eventHandlers[event.EventType()][handler] = true
 }
 
+// RemoveHandler removes a handler for a specific local event, and returns when
+// it has handled the events being published to it.
+func (b *EventBus) RemoveHandler(handler eventhorizon.EventHandler, event eventhorizon.Event) {
+	b.mu.Lock()
+	if handlers, ok := b.eventHandlers[event.EventType()]; ok {
+		delete(handlers, handler)
+		if len(handlers) == 0 {
+			delete(b.eventHandlers, event.EventType())
+		}
+	}
+	b.mu.Unlock()
+	b.deliveries.Wait(handler)
+}
+
 // AddLocalHandler adds a handler for local events.
 func (b *EventBus) AddLocalHandler(handler eventhorizon.EventHandler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
 	b.localHandlers[handler] = true
 }
 
+// RemoveLocalHandler removes a handler for local events, and returns when it
+// has handled the events being published to it.
+func (b *EventBus) RemoveLocalHandler(handler eventhorizon.EventHandler) {
+	b.mu.Lock()
+	delete(b.localHandlers, handler)
+	b.mu.Unlock()
+	b.deliveries.Wait(handler)
+}
+
+// Handlers implements the Handlers method of the
+// eventhorizon.InspectableEventBus interface. Global handlers are returned as
+// added, without the retry handlers they are delivered through.
+func (b *EventBus) Handlers() []eventhorizon.HandlerRegistration {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	var registrations []eventhorizon.HandlerRegistration
+	for eventType, handlers := range b.eventHandlers {
+		for handler := range handlers {
+			registrations = append(registrations, eventhorizon.HandlerRegistration{
+				EventType: eventType,
+				Handler:   handler,
+			})
+		}
+	}
+	for handler := range b.localHandlers {
+		registrations = append(registrations, eventhorizon.HandlerRegistration{Handler: handler})
+	}
+	for handler := range b.globalHandlers {
+		registrations = append(registrations, eventhorizon.HandlerRegistration{Handler: handler, Global: true})
+	}
+	return registrations
+}
+
 // AddGlobalHandler adds a handler for global (remote) events.
 func (b *EventBus) AddGlobalHandler(handler eventhorizon.EventHandler) {
-	b.globalHandlers[handler] = true
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delivered := handler
+	if !eventhorizon.IsRetryHandler(handler) && b.retry != nil {
+		h := eventhorizon.NewRetryHandler(handler, b.retry.backoff, b.clock)
+		h.SetDeadLetterHandler(b.retry.deadLetter)
+		delivered = h
+	}
+	b.globalHandlers[handler] = delivered
+	if b.dispatcher != nil {
+		b.dispatcher.add(delivered)
+	}
+}
+
+// AddGlobalHandlerWithConcurrency adds a handler for global (remote) events,
+// which handles up to concurrency events at the same time. Events are
+// partitioned between its workers as with WithWorkerPool, which is needed for
+// this; without a worker pool the handler handles one event at a time.
+func (b *EventBus) AddGlobalHandlerWithConcurrency(handler eventhorizon.EventHandler, concurrency int) {
+	b.AddGlobalHandler(handler)
+	if b.dispatcher == nil {
+		return
+	}
+	b.mu.RLock()
+	delivered := b.globalHandlers[handler]
+	b.mu.RUnlock()
+	b.dispatcher.setConcurrency(delivered, concurrency)
+}
+
+// RemoveGlobalHandler removes a handler for global (remote) events, and returns
+// when it has handled the received events, including those queued for it by
+// the worker pool.
+func (b *EventBus) RemoveGlobalHandler(handler eventhorizon.EventHandler) {
+	b.mu.Lock()
+	delivered, ok := b.globalHandlers[handler]
+	delete(b.globalHandlers, handler)
+	b.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	if b.dispatcher != nil {
+		b.dispatcher.remove(delivered)
+		return
+	}
+	b.deliveries.Wait(delivered)
 }
 
 // RegisterEventType registers an event factory for a event type. The factory is
@@ -146,6 +569,9 @@ func (b *EventBus) AddGlobalHandler(handler eventhorizon.EventHandler) {
 // An example would be:
 //     eventStore.RegisterEventType(&MyEvent{}, func() Event { return &MyEvent{} })
 func (b *EventBus) RegisterEventType(event eventhorizon.Event, factory func() eventhorizon.Event) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
 	if _, ok := b.factories[event.EventType()]; ok {
 		return eventhorizon.ErrHandlerAlreadySet
 	}
@@ -155,78 +581,288 @@ func (b *EventBus) RegisterEventType(event eventhorizon.Event, factory func() ev
 	return nil
 }
 
-// Close exits the recive goroutine by unsubscribing to all channels.
+// Close sends any events queued by PublishEventAsync and exits the recive
+// goroutine by closing the subscription. The client is only closed if it was
+// created by NewEventBus.
 func (b *EventBus) Close() {
-	err := b.conn.PUnsubscribe()
-	if err != nil {
+	b.asyncMu.Lock()
+	if !b.asyncClosed {
+		b.asyncClosed = true
+		close(b.async)
+	}
+	b.asyncMu.Unlock()
+	<-b.asyncDone
+
+	if err := b.pubsub.Close(); err != nil {
 		log.Printf("error: event bus close: %v\n", err)
 	}
+	b.cancel()
 	<-b.exit
-	err = b.conn.Close()
-	if err != nil {
-		log.Printf("error: event bus close: %v\n", err)
+	if b.dispatcher != nil {
+		b.dispatcher.close()
+	}
+	if b.ownClient {
+		if err := b.client.Close(); err != nil {
+			log.Printf("error: event bus close: %v\n", err)
+		}
 	}
 }
 
-func (b *EventBus) publishGlobal(event eventhorizon.Event) {
-	conn := b.pool.Get()
-	defer conn.Close()
-	if err := conn.Err(); err != nil {
-		log.Printf("error: event bus publish: %v\n", err)
+func (b *EventBus) publishGlobal(ctx context.Context, events ...eventhorizon.Event) {
+	for _, err := range b.sendGlobal(ctx, events, nil) {
+		if err != nil {
+			log.Printf("error: event bus publish: %v\n", err)
+		}
+	}
+}
+
+// sendGlobal pipelines the events to Redis in one round trip, publishing all
+// events on their own channel. The headers, if not nil, are sent with the event
+// at the same index. It returns the error for each event.
+func (b *EventBus) sendGlobal(ctx context.Context, events []eventhorizon.Event, headers []eventhorizon.Headers) []error {
+	errs := make([]error, len(events))
+
+	// The sent commands and the buffers of their messages are reused between
+	// calls, once the pipeline has been sent.
+	sp := sentSlicePool.Get().(*[]sentEvent)
+	sent := (*sp)[:0]
+	defer func() {
+		for i := range sent {
+			putBuffer(sent[i].buf)
+			sent[i] = sentEvent{}
+		}
+		*sp = sent[:0]
+		sentSlicePool.Put(sp)
+	}()
+
+	pipe := b.client.Pipeline()
+	for i, event := range events {
+		var h eventhorizon.Headers
+		if headers != nil {
+			h = headers[i]
+		}
+		buf := getBuffer()
+		data, err := b.marshalMessage(*buf, event, h)
+		if err != nil {
+			putBuffer(buf)
+			errs[i] = err
+			continue
+		}
+		*buf = data
+
+		s := sentEvent{index: i, buf: buf}
+		if b.historySize > 0 {
+			s.history = pipe.XAdd(ctx, &redis.XAddArgs{
+				Stream: b.historyKey(),
+				MaxLen: int64(b.historySize),
+				Approx: true,
+				Values: []interface{}{"type", event.EventType(), "data", data},
+			})
+		}
+		s.publish = pipe.Publish(ctx, b.prefix+event.EventType(), data)
+		sent = append(sent, s)
+	}
+	if len(sent) == 0 {
+		b.counters.publishErrors.Add(uint64(len(errs)))
+		return errs
 	}
 
-	// Marshal event data.
-	var data []byte
-	var err error
-	if data, err = bson.Marshal(event); err != nil {
-		log.Printf("error: event bus publish: %v\n", ErrCouldNotMarshalEvent)
+	// The errors are checked per command below.
+	pipe.Exec(ctx)
+	for _, s := range sent {
+		if s.history != nil && s.history.Err() != nil {
+			errs[s.index] = s.history.Err()
+		}
+		if err := s.publish.Err(); err != nil {
+			errs[s.index] = err
+		}
 	}
+	for _, err := range errs {
+		if err != nil {
+			b.counters.publishErrors.Add(1)
+		} else {
+			b.counters.published.Add(1)
+			b.counters.lastEvent.Store(b.clock.Now().UnixNano())
+		}
+	}
+	return errs
+}
 
-	// Publish all events on their own channel.
-	if _, err = conn.Do("PUBLISH", b.prefix+event.EventType(), data); err != nil {
-		log.Printf("error: event bus publish: %v\n", err)
+// sentEvent is an event queued in a pipeline.
+type sentEvent struct {
+	index   int
+	buf     *[]byte
+	history *redis.StringCmd
+	publish *redis.IntCmd
+}
+
+// handleGlobal delivers a received event to the global handlers. It is only
+// called with deliverMu held.
+func (b *EventBus) handleGlobal(ctx context.Context, event eventhorizon.Event) {
+	// The handler slice is reused for every received event.
+	b.mu.RLock()
+	handlers := b.received[:0]
+	for handler := range b.globalHandlers {
+		handlers = append(handlers, handler)
 	}
+	b.mu.RUnlock()
+
+	// Skip handlers removed by the handlers before them.
+	for _, handler := range handlers {
+		if !eventhorizon.MatchEvent(handler, event) {
+			continue
+		}
+		delivered, ok := b.beginGlobal(handler)
+		if !ok {
+			continue
+		}
+		if b.dispatcher != nil {
+			b.dispatcher.dispatch(ctx, delivered, event)
+			continue
+		}
+		b.deliverGlobal(ctx, delivered, event)
+		b.counters.handled.Add(1)
+	}
+	b.received = handlers[:0]
 }
 
-func (b *EventBus) receiveGlobal(ready chan struct{}) {
-	for {
-		switch n := b.conn.Receive().(type) {
-		case redis.PMessage:
-			// Extract the event type from the channel name.
-			eventType := strings.TrimPrefix(n.Channel, b.prefix)
-
-			// Get the registered factory function for creating events.
-			f, ok := b.factories[eventType]
-			if !ok {
-				log.Printf("error: event bus receive: %v\n", ErrEventNotRegistered)
-				continue
-			}
+// beginLocal counts a delivery to a local handler if it is still added, so
+// that removing the handler waits for it.
+func (b *EventBus) beginLocal(handler eventhorizon.EventHandler, eventType string) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if !b.eventHandlers[eventType][handler] && !b.localHandlers[handler] {
+		return false
+	}
+	b.deliveries.Begin(handler)
+	return true
+}
 
-			// Manually decode the raw BSON event.
-			data := bson.Raw{3, n.Data}
-			event := f()
-			if err := data.Unmarshal(event); err != nil {
-				log.Printf("error: event bus receive: %v\n", ErrCouldNotUnmarshalEvent)
-				continue
-			}
+// beginGlobal returns the handler that a global handler is delivered through if
+// it is still added. Without the worker pool the delivery is counted, so that
+// removing the handler waits for it.
+func (b *EventBus) beginGlobal(handler eventhorizon.EventHandler) (eventhorizon.EventHandler, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	delivered, ok := b.globalHandlers[handler]
+	if ok && b.dispatcher == nil {
+		b.deliveries.Begin(delivered)
+	}
+	return delivered, ok
+}
 
-			for handler := range b.globalHandlers {
-				handler.HandleEvent(event)
-			}
-		case redis.Subscription:
-			switch n.Kind {
-			case "psubscribe":
-				close(ready)
-			case "punsubscribe":
-				if n.Count == 0 {
-					close(b.exit)
-					return
+// deliver lets a local handler handle an event, counted by the deliveries.
+func (b *EventBus) deliver(ctx context.Context, handler eventhorizon.EventHandler, event eventhorizon.Event) {
+	defer b.deliveries.End(handler)
+	eventhorizon.HandleEventWithContext(ctx, handler, event)
+}
+
+// deliverGlobal lets a global handler handle an event without the worker
+// pool, counted by the deliveries.
+func (b *EventBus) deliverGlobal(ctx context.Context, handler eventhorizon.EventHandler, event eventhorizon.Event) {
+	defer b.deliveries.End(handler)
+	eventhorizon.HandleEventWithLabels(ctx, handler, event)
+}
+
+var sentSlicePool = sync.Pool{
+	New: func() interface{} {
+		sent := make([]sentEvent, 0, 16)
+		return &sent
+	},
+}
+
+// PublishEventAsync publishes an event to all local handlers and queues it for
+// publishing to global handlers without waiting for Redis. The returned channel
+// receives the result of the global publishing, nil on success, and is then
+// closed. Queued events are pipelined to Redis together.
+func (b *EventBus) PublishEventAsync(event eventhorizon.Event) <-chan error {
+	result := make(chan error, 1)
+
+	b.publishLocal(context.Background(), event)
+
+	b.asyncMu.RLock()
+	defer b.asyncMu.RUnlock()
+	if b.asyncClosed {
+		result <- ErrEventBusClosed
+		close(result)
+		return result
+	}
+	b.async <- asyncPublish{event, result}
+	return result
+}
+
+type asyncPublish struct {
+	event  eventhorizon.Event
+	result chan error
+}
+
+// sendAsync sends queued events until the queue is closed.
+func (b *EventBus) sendAsync() {
+	defer close(b.asyncDone)
+	for p := range b.async {
+		batch := []asyncPublish{p}
+
+		// Take all queued events to pipeline them in one round trip.
+	drain:
+		for len(batch) < cap(b.async) {
+			select {
+			case p, ok := <-b.async:
+				if !ok {
+					break drain
 				}
+				batch = append(batch, p)
+			default:
+				break drain
 			}
-		case error:
-			log.Printf("error: event bus receive: %v\n", n)
-			close(b.exit)
+		}
+
+		events := make([]eventhorizon.Event, len(batch))
+		for i, p := range batch {
+			events[i] = p.event
+		}
+		for i, err := range b.sendGlobal(context.Background(), events, nil) {
+			batch[i].result <- err
+			close(batch[i].result)
+		}
+	}
+}
+
+func (b *EventBus) receiveGlobal(ctx context.Context) {
+	defer close(b.exit)
+	for {
+		msg, err := b.pubsub.ReceiveMessage(ctx)
+		if err == redis.ErrClosed || ctx.Err() != nil {
 			return
+		} else if err != nil {
+			// The client reconnects and subscribes again on the next receive.
+			log.Printf("error: event bus receive: %v\n", err)
+			b.counters.receiveErrors.Add(1)
+			b.counters.reconnects.Add(1)
+			select {
+			case <-ctx.Done():
+				return
+			case <-b.clock.After(time.Second):
+			}
+			continue
 		}
+
+		// Extract the event type from the channel name.
+		eventType := strings.TrimPrefix(msg.Channel, b.prefix)
+
+		event, headers, err := b.unmarshalMessage(eventType, []byte(msg.Payload))
+		if err == ErrMessageExpired {
+			b.counters.expired.Add(1)
+			continue
+		} else if err != nil {
+			log.Printf("error: event bus receive: %v\n", err)
+			b.counters.receiveErrors.Add(1)
+			continue
+		}
+		b.counters.received.Add(1)
+		b.counters.lastEvent.Store(b.clock.Now().UnixNano())
+
+		b.deliverMu.Lock()
+		b.handleGlobal(eventhorizon.NewContextWithHeaders(context.Background(), headers), event)
+		b.deliverMu.Unlock()
 	}
 }
@@ -0,0 +1,92 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"context"
+	"testing"
+
+	"github.com/looplab/eventhorizon"
+	bsoncodec "github.com/looplab/eventhorizon/codec/bson"
+	"github.com/looplab/eventhorizon/testutil"
+)
+
+// BenchmarkEventBusPublishLocal measures local publishing, which
+// TestEventBusAllocs guards to not allocate per event.
+func BenchmarkEventBusPublishLocal(b *testing.B) {
+	bus := &EventBus{
+		eventHandlers:  make(map[string]map[eventhorizon.EventHandler]bool),
+		localHandlers:  make(map[eventhorizon.EventHandler]bool),
+		globalHandlers: make(map[eventhorizon.EventHandler]eventhorizon.EventHandler),
+	}
+	for i := 0; i < 5; i++ {
+		bus.AddHandler(&nopHandler{i}, &testutil.TestEvent{})
+		bus.AddLocalHandler(&nopHandler{i})
+	}
+	event := &testutil.TestEvent{eventhorizon.NewUUID(), "event"}
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		bus.publishLocal(ctx, event)
+	}
+}
+
+func TestEventBusAllocs(t *testing.T) {
+	bus := &EventBus{
+		eventHandlers:  make(map[string]map[eventhorizon.EventHandler]bool),
+		localHandlers:  make(map[eventhorizon.EventHandler]bool),
+		globalHandlers: make(map[eventhorizon.EventHandler]eventhorizon.EventHandler),
+		codecs:         eventhorizon.NewEventCodecs(bsoncodec.EventCodec{}),
+		clock:          eventhorizon.SystemClock{},
+	}
+	for i := 0; i < 5; i++ {
+		bus.AddHandler(&nopHandler{i}, &testutil.TestEvent{})
+		bus.AddLocalHandler(&nopHandler{i})
+	}
+	event := &testutil.TestEvent{eventhorizon.NewUUID(), "event"}
+	ctx := context.Background()
+
+	t.Log("publish locally")
+	if allocs := testing.AllocsPerRun(100, func() {
+		bus.publishLocal(ctx, event)
+	}); allocs != 0 {
+		t.Error("local publishing should not allocate:", allocs)
+	}
+
+	t.Log("marshal messages into pooled buffers")
+	eventAllocs := testing.AllocsPerRun(100, func() {
+		bus.codecs.MarshalEvent(event)
+	})
+	messageAllocs := testing.AllocsPerRun(100, func() {
+		buf := getBuffer()
+		data, err := bus.marshalMessage(*buf, event, nil)
+		if err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+		*buf = data
+		putBuffer(buf)
+	})
+	if messageAllocs > eventAllocs {
+		t.Error("the message should not allocate more than the event:", messageAllocs, eventAllocs)
+	}
+}
+
+type nopHandler struct {
+	id int
+}
+
+func (h *nopHandler) HandleEvent(event eventhorizon.Event) {}
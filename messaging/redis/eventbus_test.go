@@ -15,23 +15,21 @@
 package redis
 
 import (
+	"context"
+	"errors"
 	"os"
 	"reflect"
 	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
 
 	"github.com/looplab/eventhorizon"
 	"github.com/looplab/eventhorizon/testutil"
 )
 
 func TestEventBus(t *testing.T) {
-	// Support Wercker testing with MongoDB.
-	host := os.Getenv("REDIS_PORT_6379_TCP_ADDR")
-	port := os.Getenv("REDIS_PORT_6379_TCP_PORT")
-
-	url := ":6379"
-	if host != "" && port != "" {
-		url = host + ":" + port
-	}
+	url := redisURL()
 
 	bus, err := NewEventBus("test", url, "")
 	if err != nil {
@@ -128,3 +126,409 @@ func TestEventBus(t *testing.T) {
 		t.Error("the second global handler events should be correct:", globalHandler2.Events)
 	}
 }
+
+func TestEventBusWithClient(t *testing.T) {
+	client := redis.NewUniversalClient(&redis.UniversalOptions{
+		Addrs: []string{redisURL()},
+	})
+	defer client.Close()
+
+	bus, err := NewEventBusWithClient("test", client)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err = bus.RegisterEventType(&testutil.TestEvent{}, func() eventhorizon.Event {
+		return &testutil.TestEvent{}
+	}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	handler := testutil.NewMockEventHandler()
+	bus.AddGlobalHandler(handler)
+
+	t.Log("publish event")
+	event := &testutil.TestEvent{eventhorizon.NewUUID(), "event1"}
+	bus.PublishEvent(event)
+	<-handler.Recv
+	if !reflect.DeepEqual(handler.Events, []eventhorizon.Event{event}) {
+		t.Error("the handler events should be correct:", handler.Events)
+	}
+
+	t.Log("close the bus, the client should still be open")
+	bus.Close()
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		t.Error("there should be no error:", err)
+	}
+}
+
+func TestEventBusPublishEvents(t *testing.T) {
+	bus, err := NewEventBus("test", redisURL(), "")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer bus.Close()
+	if err = bus.RegisterEventType(&testutil.TestEvent{}, func() eventhorizon.Event {
+		return &testutil.TestEvent{}
+	}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	localHandler := testutil.NewMockEventHandler()
+	globalHandler := testutil.NewMockEventHandler()
+	bus.AddLocalHandler(localHandler)
+	bus.AddGlobalHandler(globalHandler)
+
+	event1 := &testutil.TestEvent{eventhorizon.NewUUID(), "event1"}
+	event2 := &testutil.TestEvent{eventhorizon.NewUUID(), "event2"}
+	bus.PublishEvents([]eventhorizon.Event{event1, event2})
+	if !reflect.DeepEqual(localHandler.Events, []eventhorizon.Event{event1, event2}) {
+		t.Error("the local handler events should be correct:", localHandler.Events)
+	}
+	<-globalHandler.Recv
+	<-globalHandler.Recv
+	if !reflect.DeepEqual(globalHandler.Events, []eventhorizon.Event{event1, event2}) {
+		t.Error("the global handler events should be correct:", globalHandler.Events)
+	}
+
+	t.Log("count the events")
+	counters := bus.Counters()
+	if counters.Published != 2 || counters.Received < 2 || counters.PublishErrors != 0 {
+		t.Error("the counters should be correct:", counters)
+	}
+	if counters.Pool == nil {
+		t.Error("there should be pool stats")
+	}
+}
+
+func TestEventBusPublishEventAsync(t *testing.T) {
+	bus, err := NewEventBus("test", redisURL(), "")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err = bus.RegisterEventType(&testutil.TestEvent{}, func() eventhorizon.Event {
+		return &testutil.TestEvent{}
+	}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	localHandler := testutil.NewMockEventHandler()
+	globalHandler := testutil.NewMockEventHandler()
+	bus.AddLocalHandler(localHandler)
+	bus.AddGlobalHandler(globalHandler)
+
+	event1 := &testutil.TestEvent{eventhorizon.NewUUID(), "event1"}
+	result := bus.PublishEventAsync(event1)
+	if !reflect.DeepEqual(localHandler.Events, []eventhorizon.Event{event1}) {
+		t.Error("the local handler events should be correct:", localHandler.Events)
+	}
+	if err := <-result; err != nil {
+		t.Error("there should be no error:", err)
+	}
+	<-globalHandler.Recv
+	if !reflect.DeepEqual(globalHandler.Events, []eventhorizon.Event{event1}) {
+		t.Error("the global handler events should be correct:", globalHandler.Events)
+	}
+
+	t.Log("publish on closed bus")
+	bus.Close()
+	if err := <-bus.PublishEventAsync(event1); err != ErrEventBusClosed {
+		t.Error("there should be a ErrEventBusClosed error:", err)
+	}
+}
+
+func TestEventBusWorkerPool(t *testing.T) {
+	bus, err := NewEventBus("test", redisURL(), "", WithWorkerPool(4, 10, 1))
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer bus.Close()
+	if err = bus.RegisterEventType(&testutil.TestEvent{}, func() eventhorizon.Event {
+		return &testutil.TestEvent{}
+	}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	globalHandler := testutil.NewMockEventHandler()
+	bus.AddGlobalHandler(globalHandler)
+
+	event1 := &testutil.TestEvent{eventhorizon.NewUUID(), "event1"}
+	bus.PublishEvent(event1)
+	<-globalHandler.Recv
+	if !reflect.DeepEqual(globalHandler.Events, []eventhorizon.Event{event1}) {
+		t.Error("the global handler events should be correct:", globalHandler.Events)
+	}
+}
+
+func TestEventBusRemoveHandlers(t *testing.T) {
+	bus, err := NewEventBus("test", redisURL(), "")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer bus.Close()
+	if err = bus.RegisterEventType(&testutil.TestEvent{}, func() eventhorizon.Event {
+		return &testutil.TestEvent{}
+	}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	handler := testutil.NewMockEventHandler()
+	localHandler := testutil.NewMockEventHandler()
+	globalHandler := testutil.NewMockEventHandler()
+	bus.AddHandler(handler, &testutil.TestEvent{})
+	bus.AddLocalHandler(localHandler)
+	bus.AddGlobalHandler(globalHandler)
+
+	t.Log("remove handlers")
+	bus.RemoveHandler(handler, &testutil.TestEvent{})
+	bus.RemoveLocalHandler(localHandler)
+	bus.RemoveGlobalHandler(globalHandler)
+
+	// Use another global handler to know when the event has been received.
+	doneHandler := testutil.NewMockEventHandler()
+	bus.AddGlobalHandler(doneHandler)
+
+	event1 := &testutil.TestEvent{eventhorizon.NewUUID(), "event1"}
+	bus.PublishEvent(event1)
+	<-doneHandler.Recv
+	if len(handler.Events) != 0 {
+		t.Error("there should be no handler events:", handler.Events)
+	}
+	if len(localHandler.Events) != 0 {
+		t.Error("there should be no local handler events:", localHandler.Events)
+	}
+	if len(globalHandler.Events) != 0 {
+		t.Error("there should be no global handler events:", globalHandler.Events)
+	}
+}
+
+func TestEventBusRemoveHandlerWhileHandling(t *testing.T) {
+	bus, err := NewEventBus("test", redisURL(), "")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer bus.Close()
+
+	h2 := testutil.NewMockEventHandler()
+	h1 := eventhorizon.NewEventHandlerFunc(func(event eventhorizon.Event) {
+		bus.RemoveHandler(h2, &testutil.TestEvent{})
+	})
+	bus.AddHandler(h1, &testutil.TestEvent{})
+	bus.AddHandler(h2, &testutil.TestEvent{})
+
+	t.Log("remove a handler from a handler of the same event")
+	done := make(chan struct{})
+	go func() {
+		bus.publishLocal(context.Background(), &testutil.TestEvent{eventhorizon.NewUUID(), "event1"})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-h2.Recv:
+		// The handlers are copied from a map, H2 can be handled before H1.
+		<-done
+	case <-time.After(time.Second):
+		t.Fatal("removing the handler should not deadlock")
+	}
+}
+
+func TestEventBusTail(t *testing.T) {
+	appID := "test-" + string(eventhorizon.NewUUID())
+	bus, err := NewEventBus(appID, redisURL(), "")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer bus.Close()
+	if err = bus.RegisterEventType(&testutil.TestEvent{}, func() eventhorizon.Event {
+		return &testutil.TestEvent{}
+	}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("tail events of a type")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	tail, err := bus.Tail(ctx, "TestEventOther")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	event1 := &testutil.TestEvent{eventhorizon.NewUUID(), "event1"}
+	event2 := &testutil.TestEventOther{eventhorizon.NewUUID(), "event2"}
+	bus.PublishEvents([]eventhorizon.Event{event1, event2})
+	select {
+	case e := <-tail:
+		if e.Type != "TestEventOther" || e.Event != nil || e.Data["content"] != "event2" {
+			t.Error("the unregistered event should be decoded as data:", e)
+		}
+	case <-time.After(time.Second):
+		t.Error("there should be an event")
+	}
+
+	t.Log("tail all events")
+	all, err := bus.Tail(ctx)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	bus.PublishEvent(event1)
+	select {
+	case e := <-all:
+		if e.Type != "TestEvent" || !reflect.DeepEqual(e.Event, event1) {
+			t.Error("the registered event should be decoded:", e)
+		}
+	case <-time.After(time.Second):
+		t.Error("there should be an event")
+	}
+
+	t.Log("the channel is closed with the context")
+	cancel()
+	for range all {
+	}
+}
+
+func TestEventBusReplay(t *testing.T) {
+	appID := "test-" + string(eventhorizon.NewUUID())
+	bus, err := NewEventBus(appID, redisURL(), "", WithHistory(10))
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer bus.Close()
+
+	event1 := &testutil.TestEvent{eventhorizon.NewUUID(), "event1"}
+	event2 := &testutil.TestEvent{eventhorizon.NewUUID(), "event2"}
+	bus.PublishEvents([]eventhorizon.Event{event1, event2})
+	position, err := bus.Position()
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	// A restarted consumer.
+	bus2, err := NewEventBus(appID, redisURL(), "", WithHistory(10))
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer bus2.Close()
+	if err = bus2.RegisterEventType(&testutil.TestEvent{}, func() eventhorizon.Event {
+		return &testutil.TestEvent{}
+	}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	globalHandler := testutil.NewMockEventHandler()
+	bus2.AddGlobalHandler(globalHandler)
+
+	t.Log("replay the last events")
+	last, err := bus2.Replay(2)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if last != position {
+		t.Error("the position should be correct:", last, position)
+	}
+	if !reflect.DeepEqual(globalHandler.Events, []eventhorizon.Event{event1, event2}) {
+		t.Error("the global handler events should be correct:", globalHandler.Events)
+	}
+
+	t.Log("replay from a position")
+	event3 := &testutil.TestEvent{eventhorizon.NewUUID(), "event3"}
+	bus.PublishEvent(event3)
+	<-globalHandler.Recv
+	<-globalHandler.Recv
+	<-globalHandler.Recv
+	globalHandler.Events = nil
+	if _, err = bus2.ReplayFrom(position); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(globalHandler.Events, []eventhorizon.Event{event3}) {
+		t.Error("the global handler events should be correct:", globalHandler.Events)
+	}
+}
+
+func TestEventBusHeaders(t *testing.T) {
+	bus, err := NewEventBus("test", redisURL(), "")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer bus.Close()
+	if err = bus.RegisterEventType(&testutil.TestEvent{}, func() eventhorizon.Event {
+		return &testutil.TestEvent{}
+	}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	globalHandler := &headersHandler{recv: make(chan eventhorizon.Headers, 1)}
+	bus.AddGlobalHandler(globalHandler)
+
+	headers := eventhorizon.Headers{"trace": "abc"}
+	ctx := eventhorizon.NewContextWithHeaders(context.Background(), headers)
+	bus.PublishEventWithContext(ctx, &testutil.TestEvent{eventhorizon.NewUUID(), "event1"})
+	if h := <-globalHandler.recv; !reflect.DeepEqual(h, headers) {
+		t.Error("the headers should be correct:", h)
+	}
+}
+
+type headersHandler struct {
+	recv chan eventhorizon.Headers
+}
+
+func (h *headersHandler) HandleEvent(event eventhorizon.Event) {
+	h.recv <- nil
+}
+
+func (h *headersHandler) HandleEventWithContext(ctx context.Context, event eventhorizon.Event) {
+	h.recv <- eventhorizon.HeadersFromContext(ctx)
+}
+
+func TestEventBusRetry(t *testing.T) {
+	deadLetter := testutil.NewMockEventHandler()
+	bus, err := NewEventBus("test", redisURL(), "",
+		WithWorkerPool(0, 10, 1),
+		WithRetry(eventhorizon.Backoff{Attempts: 3, Initial: time.Millisecond}, deadLetter),
+	)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer bus.Close()
+	if err = bus.RegisterEventType(&testutil.TestEvent{}, func() eventhorizon.Event {
+		return &testutil.TestEvent{}
+	}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	globalHandler := &flakyHandler{failures: 2, recv: make(chan int, 1)}
+	bus.AddGlobalHandler(globalHandler)
+
+	bus.PublishEvent(&testutil.TestEvent{eventhorizon.NewUUID(), "event1"})
+	if calls := <-globalHandler.recv; calls != 3 {
+		t.Error("the handler should be called 3 times:", calls)
+	}
+
+	t.Log("give up after all attempts")
+	globalHandler.failures = 10
+	event2 := &testutil.TestEvent{eventhorizon.NewUUID(), "event2"}
+	bus.PublishEvent(event2)
+	<-deadLetter.Recv
+	if !reflect.DeepEqual(deadLetter.Events, []eventhorizon.Event{event2}) {
+		t.Error("the dead letter events should be correct:", deadLetter.Events)
+	}
+}
+
+type flakyHandler struct {
+	failures int
+	calls    int
+	recv     chan int
+}
+
+func (h *flakyHandler) HandleEvent(event eventhorizon.Event) {}
+
+func (h *flakyHandler) TryHandleEvent(ctx context.Context, event eventhorizon.Event) error {
+	h.calls++
+	if h.calls <= h.failures {
+		return errors.New("failed")
+	}
+	h.recv <- h.calls
+	return nil
+}
+
+// redisURL returns the Redis URL, with support for Wercker testing.
+func redisURL() string {
+	host := os.Getenv("REDIS_PORT_6379_TCP_ADDR")
+	port := os.Getenv("REDIS_PORT_6379_TCP_PORT")
+
+	url := ":6379"
+	if host != "" && port != "" {
+		url = host + ":" + port
+	}
+	return url
+}
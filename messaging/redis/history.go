@@ -0,0 +1,132 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"context"
+	"errors"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/looplab/eventhorizon"
+)
+
+// ErrNoHistory is when replaying from a bus without history.
+var ErrNoHistory = errors.New("no history")
+
+// WithHistory keeps about the last size published events in a Redis stream, so
+// that they can be replayed by a restarted consumer with Replay or ReplayFrom.
+// Redis 5 or later is needed for streams.
+func WithHistory(size int) Option {
+	return func(b *EventBus) error {
+		b.historySize = size
+		return nil
+	}
+}
+
+// Replay delivers the last count events in the history to the global handlers,
+// before any events received meanwhile. It returns the position of the last
+// replayed event, to be used with ReplayFrom.
+//
+// Events published while replaying can be both replayed and received, so the
+// handlers should be idempotent.
+func (b *EventBus) Replay(count int) (string, error) {
+	if b.historySize == 0 {
+		return "", ErrNoHistory
+	}
+
+	entries, err := b.client.XRevRangeN(context.Background(), b.historyKey(), "+", "-", int64(count)).Result()
+	if err != nil {
+		return "", err
+	}
+
+	// Replay the oldest events first.
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return b.replay(entries, "")
+}
+
+// ReplayFrom delivers all events in the history after a position, as returned
+// by Replay, ReplayFrom or Position, to the global handlers. It returns the
+// position of the last replayed event, or the same position if there were no
+// newer events.
+func (b *EventBus) ReplayFrom(position string) (string, error) {
+	if b.historySize == 0 {
+		return "", ErrNoHistory
+	}
+
+	entries, err := b.client.XRange(context.Background(), b.historyKey(), position, "+").Result()
+	if err != nil {
+		return "", err
+	}
+
+	last, err := b.replay(entries, position)
+	if last == "" {
+		last = position
+	}
+	return last, err
+}
+
+// Position returns the position of the latest event in the history. Storing
+// it regularly lets a restarted consumer catch up with ReplayFrom.
+func (b *EventBus) Position() (string, error) {
+	if b.historySize == 0 {
+		return "", ErrNoHistory
+	}
+
+	entries, err := b.client.XRevRangeN(context.Background(), b.historyKey(), "+", "-", 1).Result()
+	if err != nil || len(entries) == 0 {
+		return "", err
+	}
+	return entries[0].ID, nil
+}
+
+// replay delivers the history entries, skipping the one at the position.
+func (b *EventBus) replay(entries []redis.XMessage, position string) (string, error) {
+	// Hold back live events until the replay is done.
+	b.deliverMu.Lock()
+	defer b.deliverMu.Unlock()
+
+	last := ""
+	for _, entry := range entries {
+		if entry.ID == position {
+			continue
+		}
+		eventType, ok := entry.Values["type"].(string)
+		if !ok {
+			return last, ErrCouldNotUnmarshalEvent
+		}
+		data, ok := entry.Values["data"].(string)
+		if !ok {
+			return last, &eventhorizon.EventError{Err: ErrCouldNotUnmarshalEvent, EventType: eventType}
+		}
+
+		event, headers, err := b.unmarshalMessage(eventType, []byte(data))
+		if err == ErrMessageExpired {
+			last = entry.ID
+			continue
+		} else if err != nil {
+			return last, err
+		}
+		b.handleGlobal(eventhorizon.NewContextWithHeaders(context.Background(), headers), event)
+		last = entry.ID
+	}
+	return last, nil
+}
+
+func (b *EventBus) historyKey() string {
+	return b.prefix + "history"
+}
@@ -0,0 +1,178 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+
+	"github.com/looplab/eventhorizon"
+)
+
+// message is the wire format of a published event. The event type is sent as
+// part of the channel name. Events marshaled with the default BSON codec are
+// embedded as data, and events of other codecs are sent as a payload with the
+// content type of the codec.
+type message struct {
+	Data        bson.Raw             `bson:"data,omitempty"`
+	ContentType string               `bson:"content_type,omitempty"`
+	Payload     []byte               `bson:"payload,omitempty"`
+	Expires     time.Time            `bson:"expires,omitempty"`
+	Headers     eventhorizon.Headers `bson:"headers,omitempty"`
+}
+
+// appendBSON appends the message marshaled as BSON to dst, as bson.Marshal
+// would marshal it. Marshaling it by hand doesn't allocate, which the
+// reflection of bson.Marshal does for every message.
+func (m *message) appendBSON(dst []byte) ([]byte, error) {
+	idx, dst := bsoncore.AppendDocumentStart(dst)
+	if len(m.Data) > 0 {
+		dst = bsoncore.AppendDocumentElement(dst, "data", m.Data)
+	}
+	if m.ContentType != "" {
+		dst = bsoncore.AppendStringElement(dst, "content_type", m.ContentType)
+	}
+	if len(m.Payload) > 0 {
+		dst = bsoncore.AppendBinaryElement(dst, "payload", bsontype.BinaryGeneric, m.Payload)
+	}
+	if !m.Expires.IsZero() {
+		dst = bsoncore.AppendDateTimeElement(dst, "expires", int64(primitive.NewDateTimeFromTime(m.Expires)))
+	}
+	if len(m.Headers) > 0 {
+		var hidx int32
+		dst = bsoncore.AppendHeader(dst, bsontype.EmbeddedDocument, "headers")
+		hidx, dst = bsoncore.AppendDocumentStart(dst)
+		for k, v := range m.Headers {
+			dst = bsoncore.AppendStringElement(dst, k, v)
+		}
+		var err error
+		if dst, err = bsoncore.AppendDocumentEnd(dst, hidx); err != nil {
+			return nil, err
+		}
+	}
+	return bsoncore.AppendDocumentEnd(dst, idx)
+}
+
+// event returns the marshaled event of the message.
+func (m message) event() []byte {
+	if m.ContentType != "" {
+		return m.Payload
+	}
+	return m.Data
+}
+
+// marshalMessage marshals an event and its headers into a message, stamped
+// with an expiry if a TTL is set for the event type. The message is appended to
+// buf, which can be a buffer from getBuffer.
+func (b *EventBus) marshalMessage(buf []byte, event eventhorizon.Event, headers eventhorizon.Headers) ([]byte, error) {
+	contentType, data, err := b.codecs.MarshalEvent(event)
+	if err != nil {
+		return nil, &eventhorizon.EventError{Err: ErrCouldNotMarshalEvent, Cause: err,
+			EventType: event.EventType(), AggregateID: event.AggregateID()}
+	}
+
+	m := message{Headers: headers}
+	if contentType != "" {
+		m.ContentType = contentType
+		m.Payload = data
+	} else {
+		m.Data = bson.Raw(data)
+	}
+	ttl, ok := b.ttls[event.EventType()]
+	if !ok {
+		ttl = b.ttl
+	}
+	if ttl > 0 {
+		m.Expires = b.clock.Now().Add(ttl)
+	}
+
+	if data, err = m.appendBSON(buf); err != nil {
+		return nil, &eventhorizon.EventError{Err: ErrCouldNotMarshalEvent, Cause: err,
+			EventType: event.EventType(), AggregateID: event.AggregateID()}
+	}
+	return data, nil
+}
+
+// maxPooledBuffer is the largest buffer that is kept for reuse, so that a few
+// large events don't keep their memory.
+const maxPooledBuffer = 64 * 1024
+
+// getBuffer gets an empty buffer to marshal a message into.
+func getBuffer() *[]byte {
+	return bufferPool.Get().(*[]byte)
+}
+
+// putBuffer returns a buffer when the message marshaled into it has been sent.
+func putBuffer(buf *[]byte) {
+	if cap(*buf) > maxPooledBuffer {
+		return
+	}
+	*buf = (*buf)[:0]
+	bufferPool.Put(buf)
+}
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, 0, 512)
+		return &buf
+	},
+}
+
+// unmarshalMessage unmarshals a message into an event of the event type and
+// its headers. Returns ErrMessageExpired if the expiry of the message has
+// passed.
+func (b *EventBus) unmarshalMessage(eventType string, data []byte) (eventhorizon.Event, eventhorizon.Headers, error) {
+	// Get the registered factory function for creating events.
+	b.mu.RLock()
+	f, ok := b.factories[eventType]
+	b.mu.RUnlock()
+	if !ok {
+		return nil, nil, &eventhorizon.EventError{Err: ErrEventNotRegistered, EventType: eventType}
+	}
+
+	m, err := b.decodeMessage(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	event := f()
+	if err := b.codecs.UnmarshalEvent(m.ContentType, m.event(), event); err != nil {
+		return nil, nil, &eventhorizon.EventError{Err: ErrCouldNotUnmarshalEvent, Cause: err, EventType: eventType}
+	}
+	return event, m.Headers, nil
+}
+
+// decodeMessage decodes a message, without decoding its event. Returns
+// ErrMessageExpired if the expiry of the message has passed.
+func (b *EventBus) decodeMessage(data []byte) (message, error) {
+	var m message
+	if err := bson.Unmarshal(data, &m); err != nil {
+		return m, &eventhorizon.EventError{Err: ErrCouldNotUnmarshalEvent, Cause: err}
+	}
+	if !m.Expires.IsZero() && !b.clock.Now().Before(m.Expires) {
+		return m, ErrMessageExpired
+	}
+
+	// Messages from older versions are plain events.
+	if m.Data == nil && m.ContentType == "" {
+		m.Data = bson.Raw(data)
+	}
+	return m, nil
+}
@@ -0,0 +1,161 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/looplab/eventhorizon"
+	bsoncodec "github.com/looplab/eventhorizon/codec/bson"
+	jsoncodec "github.com/looplab/eventhorizon/codec/json"
+	"github.com/looplab/eventhorizon/testutil"
+)
+
+func TestMessage(t *testing.T) {
+	clock := testutil.NewMockClock(time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC))
+	b := &EventBus{
+		factories: map[string]func() eventhorizon.Event{
+			"TestEvent":      func() eventhorizon.Event { return &testutil.TestEvent{} },
+			"TestEventOther": func() eventhorizon.Event { return &testutil.TestEventOther{} },
+		},
+		ttls:   make(map[string]time.Duration),
+		clock:  clock,
+		codecs: eventhorizon.NewEventCodecs(bsoncodec.EventCodec{}),
+	}
+	if err := WithTTL(time.Minute, &testutil.TestEvent{})(b); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	t.Log("marshal and unmarshal event with headers, without TTL")
+	event1 := &testutil.TestEventOther{eventhorizon.NewUUID(), "event1"}
+	data, err := b.marshalMessage(nil, event1, eventhorizon.Headers{"trace": "abc"})
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	clock.Advance(time.Hour)
+	event, headers, err := b.unmarshalMessage("TestEventOther", data)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(event, event1) {
+		t.Error("the event should be correct:", event)
+	}
+	if !reflect.DeepEqual(headers, eventhorizon.Headers{"trace": "abc"}) {
+		t.Error("the headers should be correct:", headers)
+	}
+
+	t.Log("unmarshal event before and after expiry")
+	event2 := &testutil.TestEvent{eventhorizon.NewUUID(), "event2"}
+	if data, err = b.marshalMessage(nil, event2, nil); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	clock.Advance(30 * time.Second)
+	event, _, err = b.unmarshalMessage("TestEvent", data)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(event, event2) {
+		t.Error("the event should be correct:", event)
+	}
+	clock.Advance(30 * time.Second)
+	if _, _, err = b.unmarshalMessage("TestEvent", data); err != ErrMessageExpired {
+		t.Error("there should be a ErrMessageExpired error:", err)
+	}
+
+	t.Log("unmarshal plain event from older versions")
+	if data, err = bson.Marshal(event2); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	event, _, err = b.unmarshalMessage("TestEvent", data)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(event, event2) {
+		t.Error("the event should be correct:", event)
+	}
+
+	t.Log("marshal and unmarshal event with another codec")
+	if err := WithEventCodec(jsoncodec.ContentType, jsoncodec.EventCodec{}, &testutil.TestEventOther{})(b); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if data, err = b.marshalMessage(nil, event1, nil); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	m, err := b.decodeMessage(data)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if m.ContentType != jsoncodec.ContentType || m.Data != nil {
+		t.Error("the message should have the content type:", m)
+	}
+	event, _, err = b.unmarshalMessage("TestEventOther", data)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(event, event1) {
+		t.Error("the event should be correct:", event)
+	}
+	tailed, err := b.tailedEvent("TestEventOther", data)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(tailed.Event, event1) || tailed.ContentType != jsoncodec.ContentType {
+		t.Error("the tailed event should be correct:", tailed)
+	}
+
+	t.Log("unmarshal event with an unknown content type")
+	b.codecs = eventhorizon.NewEventCodecs(bsoncodec.EventCodec{})
+	if _, _, err = b.unmarshalMessage("TestEventOther", data); !errors.Is(err, eventhorizon.ErrUnknownContentType) {
+		t.Error("there should be a ErrUnknownContentType error:", err)
+	}
+
+	t.Log("unmarshal unregistered event")
+	if _, _, err = b.unmarshalMessage("Unknown", data); !errors.Is(err, ErrEventNotRegistered) {
+		t.Error("there should be a ErrEventNotRegistered error:", err)
+	}
+	var e *eventhorizon.EventError
+	if !errors.As(err, &e) || e.EventType != "Unknown" {
+		t.Error("the error should have the event type:", err)
+	}
+}
+
+func TestMessageAppendBSON(t *testing.T) {
+	expires := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	messages := []message{
+		{},
+		{Data: bson.Raw{5, 0, 0, 0, 0}},
+		{ContentType: "application/json", Payload: []byte(`{"a":1}`)},
+		{Data: bson.Raw{5, 0, 0, 0, 0}, Expires: expires, Headers: eventhorizon.Headers{"trace": "abc"}},
+	}
+	for _, m := range messages {
+		expected, err := bson.Marshal(m)
+		if err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+		data, err := m.appendBSON(nil)
+		if err != nil {
+			t.Error("there should be no error:", err)
+		}
+		if !bytes.Equal(data, expected) {
+			t.Error("the message should be marshaled as with bson.Marshal:", data, expected)
+		}
+	}
+}
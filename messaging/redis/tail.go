@@ -0,0 +1,125 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/looplab/eventhorizon"
+)
+
+// TailedEvent is an event received by Tail. The data of the event is decoded
+// if it is BSON, and the event itself if its type is registered. The content
+// type is set for events of other codecs than the default, see WithEventCodec.
+type TailedEvent struct {
+	Type        string
+	Event       eventhorizon.Event
+	Data        bson.M
+	ContentType string
+	Headers     eventhorizon.Headers
+}
+
+// Tail subscribes to the events published on the bus, of the event types or of
+// all types if none are given, for example for debugging. Events of types that
+// are not registered are received with only their data decoded. The channel is
+// closed when the context is done.
+func (b *EventBus) Tail(ctx context.Context, eventTypes ...string) (<-chan TailedEvent, error) {
+	patterns := []string{b.prefix + "*"}
+	if len(eventTypes) > 0 {
+		patterns = make([]string, len(eventTypes))
+		for i, eventType := range eventTypes {
+			patterns[i] = b.prefix + eventType
+		}
+	}
+
+	// Wait for the subscription, to not miss events published after the call.
+	pubsub := b.client.PSubscribe(ctx, patterns...)
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, err
+	}
+
+	ch := make(chan TailedEvent, 100)
+	go func() {
+		defer close(ch)
+		defer pubsub.Close()
+		for {
+			msg, err := pubsub.ReceiveMessage(ctx)
+			if err == redis.ErrClosed || ctx.Err() != nil {
+				return
+			} else if err != nil {
+				log.Printf("error: event bus tail: %v\n", err)
+				select {
+				case <-ctx.Done():
+					return
+				case <-b.clock.After(time.Second):
+				}
+				continue
+			}
+
+			event, err := b.tailedEvent(strings.TrimPrefix(msg.Channel, b.prefix), []byte(msg.Payload))
+			if err == ErrMessageExpired {
+				continue
+			} else if err != nil {
+				log.Printf("error: event bus tail: %v\n", err)
+				continue
+			}
+
+			select {
+			case ch <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// tailedEvent decodes a message of an event type.
+func (b *EventBus) tailedEvent(eventType string, data []byte) (TailedEvent, error) {
+	m, err := b.decodeMessage(data)
+	if err != nil {
+		return TailedEvent{}, err
+	}
+
+	e := TailedEvent{
+		Type:        eventType,
+		ContentType: m.ContentType,
+		Headers:     m.Headers,
+	}
+	if m.ContentType == "" {
+		e.Data = bson.M{}
+		if err := bson.Unmarshal(m.Data, &e.Data); err != nil {
+			return TailedEvent{}, &eventhorizon.EventError{Err: ErrCouldNotUnmarshalEvent, Cause: err, EventType: eventType}
+		}
+	}
+
+	b.mu.RLock()
+	f, ok := b.factories[eventType]
+	b.mu.RUnlock()
+	if ok {
+		e.Event = f()
+		if err := b.codecs.UnmarshalEvent(m.ContentType, m.event(), e.Event); err != nil {
+			return TailedEvent{}, &eventhorizon.EventError{Err: ErrCouldNotUnmarshalEvent, Cause: err, EventType: eventType}
+		}
+	}
+	return e, nil
+}
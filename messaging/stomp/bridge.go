@@ -0,0 +1,391 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package stomp bridges events between event buses and a STOMP 1.2 broker,
+// such as ActiveMQ or Artemis, for integrating with systems that use JMS.
+// Events are sent to the destinations they are forwarded to, and the messages
+// of subscribed destinations are published on a bus:
+//     b, err := stomp.Dial("activemq:61613", stomp.WithLogin("user", "secret"))
+//     b.Forward(&InviteAccepted{}, "/topic/invitations")
+//     bus.AddGlobalHandler(b)
+//     b.Receive("/queue/orders", func() eventhorizon.Event { return &OrderPlaced{} })
+//     go b.Run(ctx, bus)
+package stomp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/looplab/eventhorizon"
+	jsoncodec "github.com/looplab/eventhorizon/codec/json"
+)
+
+// ErrBrokerError is when the broker sends an error frame.
+var ErrBrokerError = errors.New("broker error")
+
+// ErrCouldNotMarshalEvent is when an event could not be marshaled.
+var ErrCouldNotMarshalEvent = errors.New("could not marshal event")
+
+// ErrCouldNotUnmarshalEvent is when a message could not be unmarshaled into an
+// event.
+var ErrCouldNotUnmarshalEvent = errors.New("could not unmarshal event")
+
+// ErrEventNotRegistered is when a message has an event type that is not
+// received from its destination.
+var ErrEventNotRegistered = errors.New("event not registered")
+
+// ErrBridgeClosed is when the bridge is used after it has been closed.
+var ErrBridgeClosed = errors.New("bridge is closed")
+
+// The headers of the messages with the type and aggregate of their events.
+// Headers of the context of an event are sent with the HeaderPrefix.
+const (
+	HeaderEventType     = "event-type"
+	HeaderAggregateType = "aggregate-type"
+	HeaderAggregateID   = "aggregate-id"
+	HeaderPrefix        = "eh-"
+)
+
+// Option is an option for a Bridge.
+type Option func(*Bridge) error
+
+// WithLogin connects to the broker with a login and passcode.
+func WithLogin(login, passcode string) Option {
+	return func(b *Bridge) error {
+		b.login = login
+		b.passcode = passcode
+		return nil
+	}
+}
+
+// WithHost connects to a virtual host of the broker, the host of the address by
+// default when using Dial.
+func WithHost(host string) Option {
+	return func(b *Bridge) error {
+		b.host = host
+		return nil
+	}
+}
+
+// WithCodec marshals events with a codec instead of JSON, and sends them with
+// the content type of the codec.
+func WithCodec(contentType string, codec eventhorizon.EventCodec) Option {
+	return func(b *Bridge) error {
+		b.contentType = contentType
+		b.codec = codec
+		return nil
+	}
+}
+
+// Bridge sends events to and receives events from a STOMP broker. It is an
+// event handler that sends the events it handles to the destinations they are
+// forwarded to, see Forward, and it publishes the messages of the destinations
+// it receives from on a bus, see Receive and Run.
+//
+// Received messages are acknowledged when they have been published, and those
+// that can not be unmarshaled are rejected with a NACK, for the broker to move
+// them to its dead letter queue.
+type Bridge struct {
+	conn        io.ReadWriteCloser
+	r           *bufio.Reader
+	w           *bufio.Writer
+	writeMu     sync.Mutex
+	login       string
+	passcode    string
+	host        string
+	contentType string
+	codec       eventhorizon.EventCodec
+
+	destinations  map[string]string // By event type.
+	subscriptions map[string]*subscription
+	closed        bool
+	mu            sync.RWMutex
+}
+
+type subscription struct {
+	destination string
+	factories   map[string]func() eventhorizon.Event
+	only        func() eventhorizon.Event // Used when there is one factory.
+}
+
+// Dial connects to a broker at a TCP address.
+func Dial(addr string, options ...Option) (*Bridge, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	host, _, _ := net.SplitHostPort(addr)
+	b, err := NewBridge(conn, append([]Option{WithHost(host)}, options...)...)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return b, nil
+}
+
+// NewBridge connects to a broker over a connection, for example a TLS
+// connection. The connection is closed by Close.
+func NewBridge(conn io.ReadWriteCloser, options ...Option) (*Bridge, error) {
+	b := &Bridge{
+		conn:          conn,
+		r:             bufio.NewReader(conn),
+		w:             bufio.NewWriter(conn),
+		host:          "/",
+		contentType:   jsoncodec.ContentType,
+		codec:         jsoncodec.EventCodec{},
+		destinations:  make(map[string]string),
+		subscriptions: make(map[string]*subscription),
+	}
+	for _, option := range options {
+		if err := option(b); err != nil {
+			return nil, err
+		}
+	}
+
+	f := &frame{command: "CONNECT"}
+	f.add("accept-version", "1.2")
+	f.add("host", b.host)
+	f.add("login", b.login)
+	f.add("passcode", b.passcode)
+	f.add("heart-beat", "0,0")
+	if err := b.write(f); err != nil {
+		return nil, err
+	}
+	f, err := readFrame(b.r)
+	if err != nil {
+		return nil, err
+	}
+	switch f.command {
+	case "CONNECTED":
+		return b, nil
+	case "ERROR":
+		return nil, brokerError(f)
+	}
+	return nil, ErrInvalidFrame
+}
+
+// Forward sends the events of the type of an event to a destination, such as
+// "/topic/invitations" or "/queue/orders".
+func (b *Bridge) Forward(event eventhorizon.Event, destination string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.destinations[event.EventType()] = destination
+}
+
+// HandlerName implements the HandlerName method of the
+// eventhorizon.NamedEventHandler interface.
+func (b *Bridge) HandlerName() string {
+	return "stomp-bridge"
+}
+
+// HandleEvent implements the HandleEvent method of the
+// eventhorizon.EventHandler interface.
+func (b *Bridge) HandleEvent(event eventhorizon.Event) {
+	b.HandleEventWithContext(context.Background(), event)
+}
+
+// HandleEventWithContext implements the HandleEventWithContext method of the
+// eventhorizon.ContextEventHandler interface. Errors are logged.
+func (b *Bridge) HandleEventWithContext(ctx context.Context, event eventhorizon.Event) {
+	if err := b.TryHandleEvent(ctx, event); err != nil {
+		log.Printf("error: stomp bridge: could not send %s: %v\n", event.EventType(), err)
+	}
+}
+
+// TryHandleEvent implements the TryHandleEvent method of the
+// eventhorizon.FallibleEventHandler interface, by sending the event to its
+// destination. Events that are not forwarded are ignored.
+func (b *Bridge) TryHandleEvent(ctx context.Context, event eventhorizon.Event) error {
+	b.mu.RLock()
+	destination, ok := b.destinations[event.EventType()]
+	b.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	data, err := b.codec.MarshalEvent(event)
+	if err != nil {
+		return &eventhorizon.EventError{Err: ErrCouldNotMarshalEvent, Cause: err,
+			EventType: event.EventType(), AggregateID: event.AggregateID()}
+	}
+
+	f := &frame{command: "SEND", body: data}
+	f.add("destination", destination)
+	f.add("content-type", b.contentType)
+	f.add("persistent", "true")
+	f.add(HeaderEventType, event.EventType())
+	f.add(HeaderAggregateType, event.AggregateType())
+	f.add(HeaderAggregateID, event.AggregateID().String())
+	for key, value := range eventhorizon.HeadersFromContext(ctx) {
+		f.add(HeaderPrefix+key, value)
+	}
+	return b.write(f)
+}
+
+// Receive subscribes to a destination and publishes its messages on the bus of
+// Run, as events created by the factories. With one factory all messages are
+// unmarshaled into its events, with several the factory is selected by the
+// HeaderEventType header of the message.
+func (b *Bridge) Receive(destination string, factories ...func() eventhorizon.Event) error {
+	s := &subscription{
+		destination: destination,
+		factories:   make(map[string]func() eventhorizon.Event),
+	}
+	for _, factory := range factories {
+		s.factories[factory().EventType()] = factory
+	}
+	if len(factories) == 1 {
+		s.only = factories[0]
+	}
+
+	b.mu.Lock()
+	id := strconv.Itoa(len(b.subscriptions))
+	b.subscriptions[id] = s
+	b.mu.Unlock()
+
+	f := &frame{command: "SUBSCRIBE"}
+	f.add("id", id)
+	f.add("destination", destination)
+	f.add("ack", "client-individual")
+	return b.write(f)
+}
+
+// Run receives the messages of the subscribed destinations and publishes them
+// on a bus, with the headers sent with the HeaderPrefix in the context, until
+// the context is done, the bridge is closed or the connection fails. It returns
+// an error if the broker sends an error frame. The connection is closed when
+// the context is done.
+func (b *Bridge) Run(ctx context.Context, bus eventhorizon.EventBus) error {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			b.conn.Close()
+		case <-done:
+		}
+	}()
+
+	for {
+		f, err := readFrame(b.r)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			b.mu.RLock()
+			closed := b.closed
+			b.mu.RUnlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+
+		switch f.command {
+		case "MESSAGE":
+			if err := b.receive(ctx, bus, f); err != nil {
+				return err
+			}
+		case "ERROR":
+			return brokerError(f)
+		}
+	}
+}
+
+func (b *Bridge) receive(ctx context.Context, bus eventhorizon.EventBus, f *frame) error {
+	event, err := b.unmarshal(f)
+	if err != nil {
+		log.Printf("error: stomp bridge: could not receive from %s: %v\n", f.header("destination"), err)
+		nack := &frame{command: "NACK"}
+		nack.add("id", f.header("ack"))
+		return b.write(nack)
+	}
+
+	headers := eventhorizon.Headers{}
+	for _, h := range f.headers {
+		if strings.HasPrefix(h.key, HeaderPrefix) {
+			headers[strings.TrimPrefix(h.key, HeaderPrefix)] = h.value
+		}
+	}
+	eventhorizon.PublishEventWithContext(eventhorizon.NewContextWithHeaders(ctx, headers), bus, event)
+
+	ack := &frame{command: "ACK"}
+	ack.add("id", f.header("ack"))
+	return b.write(ack)
+}
+
+func (b *Bridge) unmarshal(f *frame) (eventhorizon.Event, error) {
+	b.mu.RLock()
+	s, ok := b.subscriptions[f.header("subscription")]
+	b.mu.RUnlock()
+	if !ok {
+		return nil, ErrEventNotRegistered
+	}
+
+	eventType := f.header(HeaderEventType)
+	factory, ok := s.factories[eventType]
+	if !ok && s.only != nil {
+		factory, ok = s.only, true
+	}
+	if !ok {
+		return nil, &eventhorizon.EventError{Err: ErrEventNotRegistered, EventType: eventType}
+	}
+
+	event := factory()
+	if err := b.codec.UnmarshalEvent(f.body, event); err != nil {
+		return nil, &eventhorizon.EventError{Err: ErrCouldNotUnmarshalEvent, Cause: err,
+			EventType: event.EventType()}
+	}
+	return event, nil
+}
+
+// Close disconnects from the broker and closes the connection.
+func (b *Bridge) Close() error {
+	err := b.write(&frame{command: "DISCONNECT"})
+	b.mu.Lock()
+	b.closed = true
+	b.mu.Unlock()
+	if cerr := b.conn.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (b *Bridge) write(f *frame) error {
+	b.mu.RLock()
+	closed := b.closed
+	b.mu.RUnlock()
+	if closed {
+		return ErrBridgeClosed
+	}
+
+	b.writeMu.Lock()
+	defer b.writeMu.Unlock()
+	return writeFrame(b.w, f)
+}
+
+func brokerError(f *frame) error {
+	msg := f.header("message")
+	if len(f.body) > 0 {
+		msg += ": " + string(f.body)
+	}
+	return &eventhorizon.EventError{Err: ErrBrokerError, Cause: errors.New(msg)}
+}
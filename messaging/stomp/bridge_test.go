@@ -0,0 +1,171 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stomp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/messaging/testbus"
+	"github.com/looplab/eventhorizon/testutil"
+)
+
+func TestBridge(t *testing.T) {
+	conn, brokerConn := net.Pipe()
+	broker := &fakeBroker{t, bufio.NewReader(brokerConn), bufio.NewWriter(brokerConn)}
+
+	t.Log("connect")
+	connected := make(chan *Bridge)
+	go func() {
+		b, err := NewBridge(conn, WithLogin("user", "secret"))
+		if err != nil {
+			t.Error("there should be no error:", err)
+		}
+		connected <- b
+	}()
+	f := broker.read("CONNECT")
+	if f.header("login") != "user" || f.header("passcode") != "secret" || f.header("accept-version") != "1.2" {
+		t.Error("the connect frame should be correct:", f.headers)
+	}
+	broker.write(&frame{command: "CONNECTED", headers: []header{{"version", "1.2"}}})
+	b := <-connected
+	if b == nil {
+		t.FailNow()
+	}
+
+	t.Log("send a forwarded event")
+	b.Forward(&testutil.TestEvent{}, "/topic/test")
+	event := &testutil.TestEvent{eventhorizon.NewUUID(), "event1"}
+	ctx := eventhorizon.NewContextWithHeaders(context.Background(), eventhorizon.Headers{"trace": "abc"})
+	go b.HandleEventWithContext(ctx, event)
+	f = broker.read("SEND")
+	if f.header("destination") != "/topic/test" ||
+		f.header(HeaderEventType) != event.EventType() ||
+		f.header(HeaderAggregateID) != event.AggregateID().String() ||
+		f.header("content-type") != "application/json" ||
+		f.header("eh-trace") != "abc" {
+		t.Error("the send frame should be correct:", f.headers)
+	}
+	sent := &testutil.TestEvent{}
+	if err := json.Unmarshal(f.body, sent); err != nil || !reflect.DeepEqual(sent, event) {
+		t.Error("the event should be sent as JSON:", string(f.body))
+	}
+
+	t.Log("ignore events that are not forwarded")
+	if err := b.TryHandleEvent(context.Background(), &testutil.TestEventOther{}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("receive events")
+	go func() {
+		if err := b.Receive("/queue/test", func() eventhorizon.Event { return &testutil.TestEvent{} }); err != nil {
+			t.Error("there should be no error:", err)
+		}
+	}()
+	f = broker.read("SUBSCRIBE")
+	if f.header("destination") != "/queue/test" || f.header("ack") != "client-individual" {
+		t.Error("the subscribe frame should be correct:", f.headers)
+	}
+	bus := testbus.NewEventBus()
+	runCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	runErr := make(chan error, 1)
+	go func() { runErr <- b.Run(runCtx, bus) }()
+
+	data, _ := json.Marshal(event)
+	broker.write(&frame{command: "MESSAGE", body: data, headers: []header{
+		{"subscription", f.header("id")},
+		{"message-id", "1"},
+		{"ack", "a1"},
+	}})
+	f = broker.read("ACK")
+	if f.header("id") != "a1" {
+		t.Error("the message should be acknowledged:", f.headers)
+	}
+	bus.AssertEvents(t, event)
+
+	t.Log("reject a message that can not be unmarshaled")
+	broker.write(&frame{command: "MESSAGE", body: []byte("{"), headers: []header{
+		{"subscription", "0"},
+		{"ack", "a2"},
+	}})
+	f = broker.read("NACK")
+	if f.header("id") != "a2" {
+		t.Error("the message should be rejected:", f.headers)
+	}
+
+	t.Log("stop on a broker error")
+	broker.write(&frame{command: "ERROR", headers: []header{{"message", "access denied"}}})
+	select {
+	case err := <-runErr:
+		if !errors.Is(err, ErrBrokerError) || err.Error() != "broker error: access denied" {
+			t.Error("there should be a ErrBrokerError error:", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("run should return")
+	}
+
+	t.Log("close")
+	go broker.read("DISCONNECT")
+	if err := b.Close(); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := b.TryHandleEvent(context.Background(), event); err != ErrBridgeClosed {
+		t.Error("there should be a ErrBridgeClosed error:", err)
+	}
+}
+
+func TestBridgeConnectError(t *testing.T) {
+	conn, brokerConn := net.Pipe()
+	broker := &fakeBroker{t, bufio.NewReader(brokerConn), bufio.NewWriter(brokerConn)}
+	go func() {
+		broker.read("CONNECT")
+		broker.write(&frame{command: "ERROR", headers: []header{{"message", "bad login"}}})
+	}()
+	if _, err := NewBridge(conn); !errors.Is(err, ErrBrokerError) {
+		t.Error("there should be a ErrBrokerError error:", err)
+	}
+}
+
+type fakeBroker struct {
+	t *testing.T
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+func (b *fakeBroker) read(command string) *frame {
+	f, err := readFrame(b.r)
+	if err != nil {
+		b.t.Error("there should be no error:", err)
+		return &frame{}
+	}
+	if f.command != command {
+		b.t.Error("the frame should be a", command, "frame:", f.command)
+	}
+	return f
+}
+
+func (b *fakeBroker) write(f *frame) {
+	if err := writeFrame(b.w, f); err != nil {
+		b.t.Error("there should be no error:", err)
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stomp
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidFrame is when a frame from the broker can not be parsed.
+var ErrInvalidFrame = errors.New("invalid frame")
+
+// frame is a STOMP frame. Headers are kept in order, as the first of repeated
+// headers is the one that counts.
+type frame struct {
+	command string
+	headers []header
+	body    []byte
+}
+
+type header struct {
+	key, value string
+}
+
+// header returns the value of the first header with a key.
+func (f *frame) header(key string) string {
+	for _, h := range f.headers {
+		if h.key == key {
+			return h.value
+		}
+	}
+	return ""
+}
+
+// add adds a header, which is skipped if the value is empty.
+func (f *frame) add(key, value string) {
+	if value != "" {
+		f.headers = append(f.headers, header{key, value})
+	}
+}
+
+// The headers of CONNECT and CONNECTED frames are not escaped.
+var (
+	escaper   = strings.NewReplacer("\\", "\\\\", "\r", "\\r", "\n", "\\n", ":", "\\c")
+	unescaper = strings.NewReplacer("\\\\", "\\", "\\r", "\r", "\\n", "\n", "\\c", ":")
+)
+
+func escaped(command string) bool {
+	return command != "CONNECT" && command != "CONNECTED"
+}
+
+// writeFrame writes a frame with its content length and flushes it.
+func writeFrame(w *bufio.Writer, f *frame) error {
+	w.WriteString(f.command + "\n")
+	for _, h := range f.headers {
+		if escaped(f.command) {
+			h.key, h.value = escaper.Replace(h.key), escaper.Replace(h.value)
+		}
+		w.WriteString(h.key + ":" + h.value + "\n")
+	}
+	if f.body != nil {
+		w.WriteString("content-length:" + strconv.Itoa(len(f.body)) + "\n")
+	}
+	w.WriteString("\n")
+	w.Write(f.body)
+	w.WriteByte(0)
+	return w.Flush()
+}
+
+// readFrame reads the next frame, skipping heart-beats.
+func readFrame(r *bufio.Reader) (*frame, error) {
+	f := &frame{}
+	for f.command == "" {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		f.command = line
+	}
+
+	length := -1
+	for {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if line == "" {
+			break
+		}
+		i := strings.IndexByte(line, ':')
+		if i < 0 {
+			return nil, ErrInvalidFrame
+		}
+		h := header{line[:i], line[i+1:]}
+		if escaped(f.command) {
+			h.key, h.value = unescaper.Replace(h.key), unescaper.Replace(h.value)
+		}
+		if h.key == "content-length" && length < 0 {
+			if length, err = strconv.Atoi(h.value); err != nil || length < 0 {
+				return nil, ErrInvalidFrame
+			}
+		}
+		f.headers = append(f.headers, h)
+	}
+
+	if length >= 0 {
+		f.body = make([]byte, length+1)
+		if _, err := io.ReadFull(r, f.body); err != nil {
+			return nil, err
+		}
+		if f.body[length] != 0 {
+			return nil, ErrInvalidFrame
+		}
+		f.body = f.body[:length]
+		return f, nil
+	}
+
+	body, err := r.ReadBytes(0)
+	if err != nil {
+		return nil, err
+	}
+	f.body = body[:len(body)-1]
+	return f, nil
+}
+
+// readLine reads a line without its EOL, which is LF or CRLF.
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(line[:len(line)-1], "\r"), nil
+}
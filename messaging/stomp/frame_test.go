@@ -0,0 +1,73 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stomp
+
+import (
+	"bufio"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFrame(t *testing.T) {
+	t.Log("write and read a frame with escaped headers")
+	f := &frame{command: "SEND", body: []byte("a\x00b")}
+	f.add("destination", "/queue/a:b")
+	f.add("note", "line1\nline2\\")
+	f.add("empty", "")
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	if err := writeFrame(w, f); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if !strings.Contains(buf.String(), "destination:/queue/a\\cb\n") {
+		t.Error("the header should be escaped:", buf.String())
+	}
+	read, err := readFrame(bufio.NewReader(&buf))
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	expected := &frame{command: "SEND", body: []byte("a\x00b"), headers: []header{
+		{"destination", "/queue/a:b"},
+		{"note", "line1\nline2\\"},
+		{"content-length", "3"},
+	}}
+	if !reflect.DeepEqual(read, expected) {
+		t.Error("the frame should be correct:", read)
+	}
+
+	t.Log("read a frame after heart-beats, without a content length")
+	r := bufio.NewReader(strings.NewReader("\n\r\nMESSAGE\r\nsubscription:0\r\n\r\nbody\x00"))
+	read, err = readFrame(r)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	expected = &frame{command: "MESSAGE", body: []byte("body"), headers: []header{
+		{"subscription", "0"},
+	}}
+	if !reflect.DeepEqual(read, expected) {
+		t.Error("the frame should be correct:", read)
+	}
+	if read.header("subscription") != "0" || read.header("missing") != "" {
+		t.Error("the headers should be correct:", read.headers)
+	}
+
+	t.Log("read an invalid header")
+	r = bufio.NewReader(strings.NewReader("MESSAGE\ninvalid\n\n\x00"))
+	if _, err := readFrame(r); err != ErrInvalidFrame {
+		t.Error("there should be a ErrInvalidFrame error:", err)
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package testbus contains an event bus for tests with deterministic delivery
+// and helpers for waiting on and asserting published events.
+package testbus
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/looplab/eventhorizon"
+)
+
+// EventBus is an event bus for tests. Events are delivered synchronously to
+// handlers in the order they were added, and every published event is recorded
+// so that tests can wait for and assert on them.
+//
+// The bus is also an EventHandler, which makes it possible to add it as a
+// global handler on another bus (for example the Redis bus) and wait for remote
+// events instead of sleeping.
+type EventBus struct {
+	eventHandlers  map[string][]eventhorizon.EventHandler
+	localHandlers  []eventhorizon.EventHandler
+	globalHandlers []eventhorizon.EventHandler
+
+	events  []eventhorizon.Event
+	cursors map[string]int
+	changed chan struct{}
+	mu      sync.Mutex
+}
+
+// NewEventBus creates a EventBus.
+func NewEventBus() *EventBus {
+	b := &EventBus{
+		eventHandlers: make(map[string][]eventhorizon.EventHandler),
+		cursors:       make(map[string]int),
+		changed:       make(chan struct{}),
+	}
+	return b
+}
+
+// PublishEvent records the event and publishes it to all handlers capable of
+// handling it, in the order they were added.
+func (b *EventBus) PublishEvent(event eventhorizon.Event) {
+	b.mu.Lock()
+	b.events = append(b.events, event)
+	handlers := append([]eventhorizon.EventHandler{}, b.eventHandlers[event.EventType()]...)
+	handlers = append(handlers, b.localHandlers...)
+	handlers = append(handlers, b.globalHandlers...)
+	close(b.changed)
+	b.changed = make(chan struct{})
+	b.mu.Unlock()
+
+	for _, handler := range handlers {
+		handler.HandleEvent(event)
+	}
+}
+
+// HandleEvent implements the HandleEvent method of the EventHandler interface
+// by publishing the event on the bus.
+func (b *EventBus) HandleEvent(event eventhorizon.Event) {
+	b.PublishEvent(event)
+}
+
+// AddHandler adds a handler for a specific local event.
+func (b *EventBus) AddHandler(handler eventhorizon.EventHandler, event eventhorizon.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.eventHandlers[event.EventType()] = append(b.eventHandlers[event.EventType()], handler)
+}
+
+// AddLocalHandler adds a handler for local events.
+func (b *EventBus) AddLocalHandler(handler eventhorizon.EventHandler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.localHandlers = append(b.localHandlers, handler)
+}
+
+// AddGlobalHandler adds a handler for global (remote) events.
+func (b *EventBus) AddGlobalHandler(handler eventhorizon.EventHandler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.globalHandlers = append(b.globalHandlers, handler)
+}
+
+// Events returns all recorded events in the order they were published.
+func (b *EventBus) Events() []eventhorizon.Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]eventhorizon.Event{}, b.events...)
+}
+
+// EventsOfType returns all recorded events of a type in the order they were
+// published.
+func (b *EventBus) EventsOfType(eventType string) []eventhorizon.Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	events := []eventhorizon.Event{}
+	for _, event := range b.events {
+		if event.EventType() == eventType {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// Reset clears all recorded events and wait positions, handlers are kept.
+func (b *EventBus) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.events = nil
+	b.cursors = make(map[string]int)
+}
+
+// WaitForEvent waits for the next event of a type that has not already been
+// returned by a previous wait, and returns it. The test fails if no such event
+// is published before the timeout.
+func (b *EventBus) WaitForEvent(t *testing.T, eventType string, timeout time.Duration) eventhorizon.Event {
+	deadline := time.After(timeout)
+	for {
+		b.mu.Lock()
+		for i := b.cursors[eventType]; i < len(b.events); i++ {
+			if b.events[i].EventType() == eventType {
+				b.cursors[eventType] = i + 1
+				event := b.events[i]
+				b.mu.Unlock()
+				return event
+			}
+		}
+		b.cursors[eventType] = len(b.events)
+		changed := b.changed
+		b.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-deadline:
+			t.Fatalf("timeout waiting for event: %s", eventType)
+			return nil
+		}
+	}
+}
+
+// AssertEvents checks that the recorded events are exactly the expected events,
+// in order.
+func (b *EventBus) AssertEvents(t *testing.T, expected ...eventhorizon.Event) {
+	events := b.Events()
+	if len(expected) == 0 && len(events) == 0 {
+		return
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("the recorded events should be correct:\nhave: %v\nwant: %v", events, expected)
+	}
+}
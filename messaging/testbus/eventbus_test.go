@@ -0,0 +1,92 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testbus
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/testutil"
+)
+
+func TestEventBus(t *testing.T) {
+	bus := NewEventBus()
+	if bus == nil {
+		t.Fatal("there should be a bus")
+	}
+
+	var order []string
+	handler1 := &orderHandler{"handler1", &order}
+	handler2 := &orderHandler{"handler2", &order}
+	local := &orderHandler{"local", &order}
+	global := &orderHandler{"global", &order}
+	bus.AddGlobalHandler(global)
+	bus.AddLocalHandler(local)
+	bus.AddHandler(handler1, &testutil.TestEvent{})
+	bus.AddHandler(handler2, &testutil.TestEvent{})
+
+	t.Log("publish event")
+	event1 := &testutil.TestEvent{eventhorizon.NewUUID(), "event1"}
+	bus.PublishEvent(event1)
+	if !reflect.DeepEqual(order, []string{"handler1", "handler2", "local", "global"}) {
+		t.Error("the handlers should be called in order:", order)
+	}
+
+	t.Log("publish another event")
+	event2 := &testutil.TestEventOther{eventhorizon.NewUUID(), "event2"}
+	bus.PublishEvent(event2)
+	bus.AssertEvents(t, event1, event2)
+	events := bus.EventsOfType("TestEventOther")
+	if !reflect.DeepEqual(events, []eventhorizon.Event{event2}) {
+		t.Error("the events of type should be correct:", events)
+	}
+
+	t.Log("reset")
+	bus.Reset()
+	bus.AssertEvents(t)
+}
+
+func TestEventBusWaitForEvent(t *testing.T) {
+	bus := NewEventBus()
+
+	t.Log("wait for already published event")
+	event1 := &testutil.TestEvent{eventhorizon.NewUUID(), "event1"}
+	bus.PublishEvent(event1)
+	if event := bus.WaitForEvent(t, "TestEvent", time.Second); event != event1 {
+		t.Error("the event should be correct:", event)
+	}
+
+	t.Log("wait for event published later")
+	event2 := &testutil.TestEvent{eventhorizon.NewUUID(), "event2"}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		bus.HandleEvent(&testutil.TestEventOther{eventhorizon.NewUUID(), "other"})
+		bus.HandleEvent(event2)
+	}()
+	if event := bus.WaitForEvent(t, "TestEvent", time.Second); event != event2 {
+		t.Error("the event should be correct:", event)
+	}
+}
+
+type orderHandler struct {
+	name  string
+	order *[]string
+}
+
+func (h *orderHandler) HandleEvent(event eventhorizon.Event) {
+	*h.order = append(*h.order, h.name)
+}
@@ -0,0 +1,314 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"sync"
+)
+
+// EventHandlerFunc is a function that can be used as an event handler. Note
+// that functions can't be compared, so buses that keep their handlers in maps
+// need a handler that is comparable, see NewEventHandlerFunc.
+type EventHandlerFunc func(Event)
+
+// HandleEvent implements the HandleEvent method of the EventHandler interface.
+func (f EventHandlerFunc) HandleEvent(event Event) {
+	f(event)
+}
+
+// NewEventHandlerFunc returns a comparable handler that calls a function.
+func NewEventHandlerFunc(f func(Event)) EventHandler {
+	return &funcHandler{f}
+}
+
+type funcHandler struct {
+	f func(Event)
+}
+
+// HandleEvent implements the HandleEvent method of the EventHandler interface.
+func (h *funcHandler) HandleEvent(event Event) {
+	h.f(event)
+}
+
+// EventHandlerMiddleware wraps an event handler, for example to add metrics or
+// tracing around the handling of events.
+type EventHandlerMiddleware func(EventHandler) EventHandler
+
+// EventBusMiddleware wraps an event bus, for example to enrich or deduplicate
+// events before they are published.
+type EventBusMiddleware func(EventBus) EventBus
+
+// UseEventHandlerMiddleware wraps a handler with middleware. The first
+// middleware is the outermost and sees the events first.
+func UseEventHandlerMiddleware(handler EventHandler, middleware ...EventHandlerMiddleware) EventHandler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
+}
+
+// UseEventBusMiddleware wraps a bus with middleware. The first middleware is
+// the outermost and sees the events first.
+func UseEventBusMiddleware(bus EventBus, middleware ...EventBusMiddleware) EventBus {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		bus = middleware[i](bus)
+	}
+	return bus
+}
+
+// HandlerMiddleware returns a bus middleware that wraps all handlers added to
+// the bus with the handler middleware. Each handler is wrapped by a comparable
+// handler that keeps its name and context, so the original handlers can be
+// used to remove them again. The optional interfaces of the bus are forwarded,
+// falling back as the package functions for them do.
+func HandlerMiddleware(middleware ...EventHandlerMiddleware) EventBusMiddleware {
+	return func(bus EventBus) EventBus {
+		return &handlerMiddlewareBus{
+			EventBus:   bus,
+			middleware: middleware,
+			wrapped:    make(map[EventHandler]*middlewareHandler),
+		}
+	}
+}
+
+type handlerMiddlewareBus struct {
+	EventBus
+	middleware []EventHandlerMiddleware
+	wrapped    map[EventHandler]*middlewareHandler
+	mu         sync.Mutex
+}
+
+// PublishEvents implements the PublishEvents method of the EventBatchPublisher
+// interface.
+func (b *handlerMiddlewareBus) PublishEvents(events []Event) {
+	PublishEvents(b.EventBus, events)
+}
+
+// PublishEventWithContext implements the PublishEventWithContext method of the
+// ContextEventPublisher interface.
+func (b *handlerMiddlewareBus) PublishEventWithContext(ctx context.Context, event Event) {
+	PublishEventWithContext(ctx, b.EventBus, event)
+}
+
+// TryPublishEvent implements the TryPublishEvent method of the
+// FallibleEventPublisher interface.
+func (b *handlerMiddlewareBus) TryPublishEvent(ctx context.Context, event Event) error {
+	return TryPublishEvent(ctx, b.EventBus, event)
+}
+
+// AddHandler implements the AddHandler method of the EventBus interface.
+func (b *handlerMiddlewareBus) AddHandler(handler EventHandler, event Event) {
+	b.EventBus.AddHandler(b.wrap(handler), event)
+}
+
+// AddHandlerWithPriority implements the AddHandlerWithPriority method of the
+// PriorityEventBus interface.
+func (b *handlerMiddlewareBus) AddHandlerWithPriority(handler EventHandler, event Event, priority int) {
+	AddHandlerWithPriority(b.EventBus, b.wrap(handler), event, priority)
+}
+
+// AddLocalHandler implements the AddLocalHandler method of the EventBus interface.
+func (b *handlerMiddlewareBus) AddLocalHandler(handler EventHandler) {
+	b.EventBus.AddLocalHandler(b.wrap(handler))
+}
+
+// AddGlobalHandler implements the AddGlobalHandler method of the EventBus interface.
+func (b *handlerMiddlewareBus) AddGlobalHandler(handler EventHandler) {
+	b.EventBus.AddGlobalHandler(b.wrap(handler))
+}
+
+// AddGlobalHandlerWithConcurrency implements the
+// AddGlobalHandlerWithConcurrency method of the ConcurrentEventBus interface.
+func (b *handlerMiddlewareBus) AddGlobalHandlerWithConcurrency(handler EventHandler, concurrency int) {
+	AddGlobalHandlerWithConcurrency(b.EventBus, b.wrap(handler), concurrency)
+}
+
+// RemoveHandler implements the RemoveHandler method of the HandlerRemover
+// interface. Nothing is removed if the bus can't remove handlers.
+func (b *handlerMiddlewareBus) RemoveHandler(handler EventHandler, event Event) {
+	if r, ok := b.EventBus.(HandlerRemover); ok {
+		if h := b.unwrap(handler); h != nil {
+			r.RemoveHandler(h, event)
+		}
+	}
+}
+
+// RemoveLocalHandler implements the RemoveLocalHandler method of the
+// HandlerRemover interface. Nothing is removed if the bus can't remove
+// handlers.
+func (b *handlerMiddlewareBus) RemoveLocalHandler(handler EventHandler) {
+	if r, ok := b.EventBus.(HandlerRemover); ok {
+		if h := b.unwrap(handler); h != nil {
+			r.RemoveLocalHandler(h)
+		}
+	}
+}
+
+// RemoveGlobalHandler implements the RemoveGlobalHandler method of the
+// HandlerRemover interface. Nothing is removed if the bus can't remove
+// handlers.
+func (b *handlerMiddlewareBus) RemoveGlobalHandler(handler EventHandler) {
+	if r, ok := b.EventBus.(HandlerRemover); ok {
+		if h := b.unwrap(handler); h != nil {
+			r.RemoveGlobalHandler(h)
+		}
+	}
+}
+
+// Handlers implements the Handlers method of the InspectableEventBus
+// interface, with the handlers as they were added. There are no handlers if
+// the bus can't list them.
+func (b *handlerMiddlewareBus) Handlers() []HandlerRegistration {
+	bus, ok := b.EventBus.(InspectableEventBus)
+	if !ok {
+		return nil
+	}
+	registrations := bus.Handlers()
+	for i, r := range registrations {
+		if h, ok := r.Handler.(*middlewareHandler); ok {
+			registrations[i].Handler = h.handler
+		}
+	}
+	return registrations
+}
+
+// wrap wraps a handler with the middleware. A handler that is added several
+// times is wrapped once, so that the bus sees the same handler.
+func (b *handlerMiddlewareBus) wrap(handler EventHandler) EventHandler {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	h, ok := b.wrapped[handler]
+	if !ok {
+		h = &middlewareHandler{
+			handler: handler,
+			wrapped: UseEventHandlerMiddleware(handler, b.middleware...),
+		}
+		b.wrapped[handler] = h
+	}
+	h.added++
+	return h
+}
+
+// unwrap returns the wrapped handler of a handler that is removed, or nil if
+// it was not added. The wrapped handler is forgotten when it has been removed
+// as many times as it was added.
+func (b *handlerMiddlewareBus) unwrap(handler EventHandler) EventHandler {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	h, ok := b.wrapped[handler]
+	if !ok {
+		return nil
+	}
+	if h.added--; h.added <= 0 {
+		delete(b.wrapped, handler)
+	}
+	return h
+}
+
+// middlewareHandler is a handler wrapped with middleware, which keeps the
+// optional interfaces of event handlers.
+type middlewareHandler struct {
+	handler EventHandler // The handler as added.
+	wrapped EventHandler // The handler with the middleware.
+	added   int          // Guarded by the mutex of the bus.
+}
+
+// HandleEvent implements the HandleEvent method of the EventHandler interface.
+func (h *middlewareHandler) HandleEvent(event Event) {
+	h.wrapped.HandleEvent(event)
+}
+
+// HandleEventWithContext implements the HandleEventWithContext method of the
+// ContextEventHandler interface.
+func (h *middlewareHandler) HandleEventWithContext(ctx context.Context, event Event) {
+	HandleEventWithContext(ctx, h.wrapped, event)
+}
+
+// TryHandleEvent implements the TryHandleEvent method of the
+// FallibleEventHandler interface.
+func (h *middlewareHandler) TryHandleEvent(ctx context.Context, event Event) error {
+	return TryHandleEvent(ctx, h.wrapped, event)
+}
+
+// HandlerName implements the HandlerName method of the NamedEventHandler
+// interface, using the name of the handler as added.
+func (h *middlewareHandler) HandlerName() string {
+	return HandlerName(h.handler)
+}
+
+// MatchEvent implements the MatchEvent method of the MatchingEventHandler
+// interface, matching with the handler as added.
+func (h *middlewareHandler) MatchEvent(event Event) bool {
+	return MatchEvent(h.handler, event)
+}
+
+// CommandHandlerFunc is a function that can be used as a command handler.
+type CommandHandlerFunc func(Command) error
+
+// HandleCommand implements the HandleCommand method of the CommandHandler
+// interface.
+func (f CommandHandlerFunc) HandleCommand(command Command) error {
+	return f(command)
+}
+
+// CommandHandlerMiddleware wraps a command handler, for example to add
+// validation or rate limiting before commands are handled.
+type CommandHandlerMiddleware func(CommandHandler) CommandHandler
+
+// CommandBusMiddleware wraps a command bus.
+type CommandBusMiddleware func(CommandBus) CommandBus
+
+// UseCommandHandlerMiddleware wraps a handler with middleware. The first
+// middleware is the outermost and sees the commands first.
+func UseCommandHandlerMiddleware(handler CommandHandler, middleware ...CommandHandlerMiddleware) CommandHandler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
+}
+
+// UseCommandBusMiddleware wraps a bus with middleware. The first middleware is
+// the outermost and sees the commands first.
+func UseCommandBusMiddleware(bus CommandBus, middleware ...CommandBusMiddleware) CommandBus {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		bus = middleware[i](bus)
+	}
+	return bus
+}
+
+// CommandMiddleware returns a bus middleware that wraps the handling of all
+// commands on the bus with the handler middleware.
+func CommandMiddleware(middleware ...CommandHandlerMiddleware) CommandBusMiddleware {
+	return func(bus CommandBus) CommandBus {
+		return &commandMiddlewareBus{bus, UseCommandHandlerMiddleware(bus, middleware...)}
+	}
+}
+
+type commandMiddlewareBus struct {
+	CommandBus
+	handler CommandHandler
+}
+
+// HandleCommand implements the HandleCommand method of the CommandBus interface.
+func (b *commandMiddlewareBus) HandleCommand(command Command) error {
+	return b.handler.HandleCommand(command)
+}
+
+// HandleCommandWithContext implements the HandleCommandWithContext method of
+// the ContextCommandHandler interface.
+func (b *commandMiddlewareBus) HandleCommandWithContext(ctx context.Context, command Command) error {
+	return HandleCommandWithContext(ctx, b.handler, command)
+}
@@ -0,0 +1,191 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestUseEventHandlerMiddleware(t *testing.T) {
+	var order []string
+	handler := EventHandlerFunc(func(event Event) {
+		order = append(order, "handler")
+	})
+	handler2 := UseEventHandlerMiddleware(handler,
+		orderMiddleware("first", &order),
+		orderMiddleware("second", &order),
+	)
+	handler2.HandleEvent(&TestEvent{NewUUID(), "event1"})
+	if !reflect.DeepEqual(order, []string{"first", "second", "handler"}) {
+		t.Error("the middleware should be called in order:", order)
+	}
+}
+
+func TestUseEventBusMiddleware(t *testing.T) {
+	var order []string
+	bus := &handlerEventBus{}
+	bus2 := UseEventBusMiddleware(bus,
+		publishOrderMiddleware("publish", &order),
+		HandlerMiddleware(
+			orderMiddleware("first", &order),
+			orderMiddleware("second", &order),
+		),
+	)
+	bus2.AddHandler(NewEventHandlerFunc(func(event Event) {
+		order = append(order, "handler")
+	}), &TestEvent{})
+
+	t.Log("publish event")
+	bus2.PublishEvent(&TestEvent{NewUUID(), "event1"})
+	if !reflect.DeepEqual(order, []string{"publish", "first", "second", "handler"}) {
+		t.Error("the middleware should be called in order:", order)
+	}
+
+	t.Log("publish events as batch")
+	order = nil
+	PublishEvents(bus2, []Event{&TestEvent{NewUUID(), "event2"}})
+	if !reflect.DeepEqual(order, []string{"publish", "first", "second", "handler"}) {
+		t.Error("the middleware should be called in order:", order)
+	}
+}
+
+func TestHandlerMiddlewareWrappedHandler(t *testing.T) {
+	bus := &handlerEventBus{}
+	bus2 := HandlerMiddleware(RetryMiddleware(Backoff{Attempts: 1}, SystemClock{}))(bus)
+	handler := &namedContextHandler{}
+	bus2.AddHandler(handler, &TestEvent{})
+	bus2.AddGlobalHandler(handler)
+	wrapped := bus.handlers[0]
+
+	t.Log("wrap a handler once")
+	if bus.handlers[1] != wrapped {
+		t.Error("the handler should be wrapped once:", bus.handlers)
+	}
+
+	t.Log("keep the name and context of the handler")
+	if name := HandlerName(wrapped); name != "named" {
+		t.Error("the name should be correct:", name)
+	}
+	ctx := NewContextWithHeaders(context.Background(), Headers{HeaderUserID: "user"})
+	HandleEventWithContext(ctx, wrapped, &TestEvent{NewUUID(), "event1"})
+	if handler.headers[HeaderUserID] != "user" {
+		t.Error("the handler should get the context:", handler.headers)
+	}
+
+	t.Log("detect retrying middleware")
+	if !IsRetryHandler(wrapped) {
+		t.Error("the wrapped handler should retry")
+	}
+}
+
+func TestHandlerMiddlewareRemoveHandler(t *testing.T) {
+	bus := &removableEventBus{}
+	bus2 := HandlerMiddleware(orderMiddleware("first", &[]string{}))(bus)
+	handler := &namedContextHandler{}
+
+	t.Log("remove with the handler as added")
+	bus2.AddGlobalHandler(handler)
+	r, ok := bus2.(HandlerRemover)
+	if !ok {
+		t.Fatal("the bus should be a HandlerRemover")
+	}
+	r.RemoveGlobalHandler(handler)
+	if !reflect.DeepEqual(bus.calls, []string{"add global", "remove global"}) {
+		t.Error("the handler should be removed:", bus.calls)
+	}
+
+	t.Log("remove a handler that was not added")
+	r.RemoveGlobalHandler(handler)
+	if len(bus.calls) != 2 {
+		t.Error("nothing should be removed:", bus.calls)
+	}
+}
+
+type namedContextHandler struct {
+	headers Headers
+}
+
+func (h *namedContextHandler) HandlerName() string {
+	return "named"
+}
+
+func (h *namedContextHandler) HandleEvent(event Event) {
+	h.HandleEventWithContext(context.Background(), event)
+}
+
+func (h *namedContextHandler) HandleEventWithContext(ctx context.Context, event Event) {
+	h.headers = HeadersFromContext(ctx)
+}
+
+func publishOrderMiddleware(name string, order *[]string) EventBusMiddleware {
+	return func(bus EventBus) EventBus {
+		return &publishOrderBus{bus, name, order}
+	}
+}
+
+type publishOrderBus struct {
+	EventBus
+	name  string
+	order *[]string
+}
+
+func (b *publishOrderBus) PublishEvent(event Event) {
+	*b.order = append(*b.order, b.name)
+	b.EventBus.PublishEvent(event)
+}
+
+func orderMiddleware(name string, order *[]string) EventHandlerMiddleware {
+	return func(handler EventHandler) EventHandler {
+		return EventHandlerFunc(func(event Event) {
+			*order = append(*order, name)
+			handler.HandleEvent(event)
+		})
+	}
+}
+
+// handlerEventBus is a minimal bus that calls all added handlers. Handlers
+// are checked to be comparable like in buses that keep them in maps.
+type handlerEventBus struct {
+	handlers []EventHandler
+	seen     map[EventHandler]bool
+}
+
+func (b *handlerEventBus) PublishEvent(event Event) {
+	for _, handler := range b.handlers {
+		handler.HandleEvent(event)
+	}
+}
+
+func (b *handlerEventBus) AddHandler(handler EventHandler, event Event) {
+	b.add(handler)
+}
+
+func (b *handlerEventBus) AddLocalHandler(handler EventHandler) {
+	b.add(handler)
+}
+
+func (b *handlerEventBus) AddGlobalHandler(handler EventHandler) {
+	b.add(handler)
+}
+
+func (b *handlerEventBus) add(handler EventHandler) {
+	if b.seen == nil {
+		b.seen = make(map[EventHandler]bool)
+	}
+	b.seen[handler] = true
+	b.handlers = append(b.handlers, handler)
+}
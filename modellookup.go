@@ -0,0 +1,169 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// ErrIncorrectModelType is when a read model is not of the expected type.
+var ErrIncorrectModelType = errors.New("incorrect model type")
+
+// MissPolicy is what a ModelLookup does when a read model is not found.
+type MissPolicy int
+
+const (
+	// MissFail returns ErrModelNotFound.
+	MissFail MissPolicy = iota
+
+	// MissWait polls until the model is found or the context is done, for
+	// models that are saved by another projector that may not have caught up.
+	MissWait
+
+	// MissZero returns a new zero model of the type.
+	MissZero
+)
+
+// ModelLookup finds read models of one type in another read model's
+// repository, for projectors that need their data, such as a guest list that
+// needs the names of invitations. Found models are checked to be of the type,
+// and can be cached with SetCacheSize. The lookup is an event handler that
+// invalidates the cached models of the aggregates of the events it handles.
+type ModelLookup struct {
+	repo      ReadRepository
+	modelType reflect.Type
+	policy    MissPolicy
+	clock     Clock
+	interval  time.Duration
+	cacheSize int
+	cache     map[UUID]interface{}
+	mu        sync.Mutex
+}
+
+// NewModelLookup creates a new ModelLookup for models of the type of a model,
+// such as &Invitation{}. Misses fail by default. The clock is used for polling
+// with MissWait.
+func NewModelLookup(repo ReadRepository, model interface{}, clock Clock) *ModelLookup {
+	return &ModelLookup{
+		repo:      repo,
+		modelType: reflect.TypeOf(model),
+		clock:     clock,
+		interval:  10 * time.Millisecond,
+		cache:     make(map[UUID]interface{}),
+	}
+}
+
+// SetMissPolicy sets what to do when a model is not found.
+func (l *ModelLookup) SetMissPolicy(policy MissPolicy) {
+	l.policy = policy
+}
+
+// SetInterval sets the interval between polls with MissWait.
+func (l *ModelLookup) SetInterval(interval time.Duration) {
+	l.interval = interval
+}
+
+// SetCacheSize sets the number of models to cache, the default is 0 which
+// means no caching. The cache is cleared when it is full. Cached models are
+// shared between finds and must not be modified.
+func (l *ModelLookup) SetCacheSize(size int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.cacheSize = size
+	l.cache = make(map[UUID]interface{})
+}
+
+// Find returns the model with an ID, which is of the type of the lookup.
+func (l *ModelLookup) Find(ctx context.Context, id UUID) (interface{}, error) {
+	l.mu.Lock()
+	if model, ok := l.cache[id]; ok {
+		l.mu.Unlock()
+		return model, nil
+	}
+	l.mu.Unlock()
+
+	for {
+		model, err := l.repo.Find(id)
+		if err == nil {
+			if reflect.TypeOf(model) != l.modelType {
+				return nil, ErrIncorrectModelType
+			}
+			l.add(id, model)
+			return model, nil
+		} else if err != ErrModelNotFound {
+			return nil, err
+		}
+
+		switch l.policy {
+		case MissZero:
+			if l.modelType.Kind() == reflect.Ptr {
+				return reflect.New(l.modelType.Elem()).Interface(), nil
+			}
+			return reflect.Zero(l.modelType).Interface(), nil
+		case MissWait:
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-l.clock.After(l.interval):
+			}
+		default:
+			return nil, err
+		}
+	}
+}
+
+// FindInto finds the model with an ID as Find and sets it to a target, which
+// is a pointer to a variable of the type of the lookup.
+func (l *ModelLookup) FindInto(ctx context.Context, id UUID, target interface{}) error {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Type() != l.modelType {
+		return ErrIncorrectModelType
+	}
+	model, err := l.Find(ctx, id)
+	if err != nil {
+		return err
+	}
+	v.Elem().Set(reflect.ValueOf(model))
+	return nil
+}
+
+// HandleEvent implements the HandleEvent method of the EventHandler interface,
+// invalidating the cached model of the aggregate of the event.
+func (l *ModelLookup) HandleEvent(event Event) {
+	l.Invalidate(event.AggregateID())
+}
+
+// Invalidate removes a model from the cache.
+func (l *ModelLookup) Invalidate(id UUID) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.cache, id)
+}
+
+func (l *ModelLookup) add(id UUID, model interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.cacheSize <= 0 {
+		return
+	}
+	if len(l.cache) >= l.cacheSize {
+		l.cache = make(map[UUID]interface{})
+	}
+	l.cache[id] = model
+}
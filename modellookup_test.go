@@ -0,0 +1,127 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+type lookupModel struct {
+	Name string
+}
+
+func TestModelLookup(t *testing.T) {
+	repo := &lookupRepository{models: map[UUID]interface{}{}}
+	clock := &tickClock{now: time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC), ticks: make(chan time.Time)}
+	lookup := NewModelLookup(repo, &lookupModel{}, clock)
+	id := NewUUID()
+	repo.set(id, &lookupModel{"Athena"})
+
+	t.Log("find into a typed variable")
+	var model *lookupModel
+	if err := lookup.FindInto(context.Background(), id, &model); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if model.Name != "Athena" {
+		t.Error("the model should be correct:", model)
+	}
+	var other string
+	if err := lookup.FindInto(context.Background(), id, &other); err != ErrIncorrectModelType {
+		t.Error("there should be a ErrIncorrectModelType error:", err)
+	}
+
+	t.Log("find a model of another type")
+	otherID := NewUUID()
+	repo.set(otherID, "not a model")
+	if _, err := lookup.Find(context.Background(), otherID); err != ErrIncorrectModelType {
+		t.Error("there should be a ErrIncorrectModelType error:", err)
+	}
+
+	t.Log("miss policies")
+	missing := NewUUID()
+	if _, err := lookup.Find(context.Background(), missing); err != ErrModelNotFound {
+		t.Error("there should be a ErrModelNotFound error:", err)
+	}
+	lookup.SetMissPolicy(MissZero)
+	m, err := lookup.Find(context.Background(), missing)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if *m.(*lookupModel) != (lookupModel{}) {
+		t.Error("the model should be zero:", m)
+	}
+
+	lookup.SetMissPolicy(MissWait)
+	done := make(chan struct{})
+	go func() {
+		m, err = lookup.Find(context.Background(), missing)
+		close(done)
+	}()
+	clock.ticks <- clock.now
+	repo.set(missing, &lookupModel{"Hades"})
+	tickUntil(clock, done)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if m.(*lookupModel).Name != "Hades" {
+		t.Error("the model should be correct:", m)
+	}
+}
+
+func TestModelLookupCache(t *testing.T) {
+	repo := &lookupRepository{models: map[UUID]interface{}{}}
+	lookup := NewModelLookup(repo, &lookupModel{}, SystemClock{})
+	lookup.SetCacheSize(10)
+	id := NewUUID()
+	repo.set(id, &lookupModel{"Athena"})
+
+	lookup.Find(context.Background(), id)
+	repo.set(id, &lookupModel{"Zeus"})
+	m, _ := lookup.Find(context.Background(), id)
+	if m.(*lookupModel).Name != "Athena" {
+		t.Error("the model should be cached:", m)
+	}
+
+	t.Log("invalidate by an event")
+	lookup.HandleEvent(&TestEvent{id, "event1"})
+	m, _ = lookup.Find(context.Background(), id)
+	if m.(*lookupModel).Name != "Zeus" {
+		t.Error("the model should be invalidated:", m)
+	}
+}
+
+type lookupRepository struct {
+	ReadRepository
+	models map[UUID]interface{}
+	mu     sync.Mutex
+}
+
+func (r *lookupRepository) set(id UUID, model interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.models[id] = model
+}
+
+func (r *lookupRepository) Find(id UUID) (interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if model, ok := r.models[id]; ok {
+		return model, nil
+	}
+	return nil, ErrModelNotFound
+}
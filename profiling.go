@@ -0,0 +1,50 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"fmt"
+	"runtime/pprof"
+)
+
+// NamedEventHandler is an event handler with a name, used to identify it in
+// profiles instead of its type.
+type NamedEventHandler interface {
+	EventHandler
+
+	// HandlerName returns the name of the handler.
+	HandlerName() string
+}
+
+// HandlerName returns the name of a handler if it is a NamedEventHandler, or
+// else its type.
+func HandlerName(handler EventHandler) string {
+	if h, ok := handler.(NamedEventHandler); ok {
+		return h.HandlerName()
+	}
+	return fmt.Sprintf("%T", handler)
+}
+
+// HandleEventWithLabels lets a handler handle an event as
+// HandleEventWithContext, with the pprof labels "handler" and "event_type" set
+// while handling it. Buses that handle events in their own goroutines use it
+// so that CPU profiles attribute the time to the handlers.
+func HandleEventWithLabels(ctx context.Context, handler EventHandler, event Event) {
+	labels := pprof.Labels("handler", HandlerName(handler), "event_type", event.EventType())
+	pprof.Do(ctx, labels, func(ctx context.Context) {
+		HandleEventWithContext(ctx, handler, event)
+	})
+}
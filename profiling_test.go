@@ -0,0 +1,56 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"runtime/pprof"
+	"testing"
+)
+
+func TestHandleEventWithLabels(t *testing.T) {
+	handler := &labelsHandler{}
+	HandleEventWithLabels(context.Background(), handler, &TestEvent{NewUUID(), "event1"})
+	if handler.handler != "*eventhorizon.labelsHandler" {
+		t.Error("the handler label should be correct:", handler.handler)
+	}
+	if handler.eventType != "TestEvent" {
+		t.Error("the event type label should be correct:", handler.eventType)
+	}
+
+	t.Log("named handler")
+	named := &namedLabelsHandler{}
+	HandleEventWithLabels(context.Background(), named, &TestEvent{NewUUID(), "event1"})
+	if named.handler != "projector" {
+		t.Error("the handler label should be correct:", named.handler)
+	}
+}
+
+type labelsHandler struct {
+	handler, eventType string
+}
+
+func (h *labelsHandler) HandleEvent(event Event) {}
+
+func (h *labelsHandler) HandleEventWithContext(ctx context.Context, event Event) {
+	h.handler, _ = pprof.Label(ctx, "handler")
+	h.eventType, _ = pprof.Label(ctx, "event_type")
+}
+
+type namedLabelsHandler struct {
+	labelsHandler
+}
+
+func (h *namedLabelsHandler) HandlerName() string { return "projector" }
@@ -0,0 +1,158 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"log"
+)
+
+// ProjectorBuilder builds a Projector from one handler per event type, for
+// example:
+//   projector, err := eventhorizon.NewProjector(eventhorizon.SystemClock{}).
+//       Named("GuestListProjector").
+//       On(&InviteCreated{}, eventhorizon.HandlerFunc[*InviteCreated](p.inviteCreated)).
+//       On(&InviteAccepted{}, eventhorizon.HandlerFunc[*InviteAccepted](p.inviteAccepted)).
+//       Build()
+// With typed HandlerFuncs the handlers don't have to switch on or assert the
+// types of events.
+type ProjectorBuilder struct {
+	name     string
+	events   []Event
+	handlers map[string]EventHandler
+	err      error
+	clock    Clock
+}
+
+// NewProjector starts building a Projector, with a clock for its stats.
+func NewProjector(clock Clock) *ProjectorBuilder {
+	return &ProjectorBuilder{
+		name:     "projector",
+		handlers: make(map[string]EventHandler),
+		clock:    clock,
+	}
+}
+
+// Named sets the handler name of the projector, the default is "projector".
+func (b *ProjectorBuilder) Named(name string) *ProjectorBuilder {
+	b.name = name
+	return b
+}
+
+// On sets the handler of the events with the type of an event. Setting a
+// handler for a type twice makes Build return ErrHandlerAlreadySet.
+func (b *ProjectorBuilder) On(event Event, handler EventHandler) *ProjectorBuilder {
+	if _, ok := b.handlers[event.EventType()]; ok {
+		b.err = ErrHandlerAlreadySet
+		return b
+	}
+	b.events = append(b.events, event)
+	b.handlers[event.EventType()] = handler
+	return b
+}
+
+// Build builds the projector, or returns the first error of the builder.
+func (b *ProjectorBuilder) Build() (*Projector, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	p := &Projector{
+		name:     b.name,
+		events:   append([]Event(nil), b.events...),
+		handlers: make(map[string]EventHandler, len(b.handlers)),
+		stats:    NewStatsCounter(b.clock),
+	}
+	for eventType, handler := range b.handlers {
+		p.handlers[eventType] = handler
+	}
+	return p, nil
+}
+
+// Projector is an event handler that dispatches events to a handler per event
+// type, built with a ProjectorBuilder. Events of other types are ignored.
+type Projector struct {
+	name     string
+	events   []Event
+	handlers map[string]EventHandler
+	stats    *StatsCounter
+}
+
+// Events returns an event of each type that the projector handles, in the
+// order they were added.
+func (p *Projector) Events() []Event {
+	return p.events
+}
+
+// AddToBus adds the projector to a bus as the handler of its event types.
+func (p *Projector) AddToBus(bus EventBus) {
+	for _, event := range p.events {
+		bus.AddHandler(p, event)
+	}
+}
+
+// RemoveFromBus removes the projector from a bus, see HandlerRemover. Returns
+// ErrNotRemovable if the bus can not remove handlers.
+func (p *Projector) RemoveFromBus(bus EventBus) error {
+	r, ok := bus.(HandlerRemover)
+	if !ok {
+		return ErrNotRemovable
+	}
+	for _, event := range p.events {
+		r.RemoveHandler(p, event)
+	}
+	return nil
+}
+
+// HandlerName implements the HandlerName method of the NamedEventHandler
+// interface.
+func (p *Projector) HandlerName() string {
+	return p.name
+}
+
+// HandleEvent implements the HandleEvent method of the EventHandler interface.
+func (p *Projector) HandleEvent(event Event) {
+	p.HandleEventWithContext(context.Background(), event)
+}
+
+// HandleEventWithContext implements the HandleEventWithContext method of the
+// ContextEventHandler interface, logging the error if the event could not be
+// handled.
+func (p *Projector) HandleEventWithContext(ctx context.Context, event Event) {
+	if err := p.TryHandleEvent(ctx, event); err != nil {
+		log.Printf("error: %s: could not handle %s: %v\n", p.name, event.EventType(), err)
+	}
+}
+
+// TryHandleEvent implements the TryHandleEvent method of the
+// FallibleEventHandler interface.
+func (p *Projector) TryHandleEvent(ctx context.Context, event Event) error {
+	handler, ok := p.handlers[event.EventType()]
+	if !ok {
+		return nil
+	}
+	if err := TryHandleEvent(ctx, handler, event); err != nil {
+		p.stats.AddError()
+		return err
+	}
+	p.stats.AddEvents(1)
+	return nil
+}
+
+// Stats implements the Stats method of the StatsProvider interface, with the
+// events handled and the events that failed. Ignored events are not counted.
+func (p *Projector) Stats() ComponentStats {
+	return p.stats.Stats()
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestProjector(t *testing.T) {
+	var handled []string
+	handleErr := errors.New("error")
+	projector, err := NewProjector(SystemClock{}).
+		Named("test").
+		On(&TestEvent{}, HandlerFunc[*TestEvent](func(ctx context.Context, event *TestEvent) error {
+			handled = append(handled, "TestEvent:"+event.Content)
+			return nil
+		})).
+		On(&TestEvent2{}, HandlerFunc[*TestEvent2](func(ctx context.Context, event *TestEvent2) error {
+			return handleErr
+		})).
+		Build()
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if HandlerName(projector) != "test" {
+		t.Error("the handler name should be correct:", HandlerName(projector))
+	}
+
+	t.Log("add to a bus")
+	bus := &handlerEventBus{}
+	projector.AddToBus(bus)
+	if len(bus.handlers) != 2 {
+		t.Error("the projector should be added for each event type:", bus.handlers)
+	}
+
+	t.Log("remove from a bus")
+	if err := projector.RemoveFromBus(bus); err != ErrNotRemovable {
+		t.Error("there should be a ErrNotRemovable error:", err)
+	}
+	removable := &removableEventBus{}
+	if err := projector.RemoveFromBus(removable); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(removable.calls, []string{"remove TestEvent", "remove TestEvent2"}) {
+		t.Error("the projector should be removed for each event type:", removable.calls)
+	}
+
+	t.Log("dispatch by event type")
+	id := NewUUID()
+	projector.HandleEvent(&TestEvent{id, "event1"})
+	if !reflect.DeepEqual(handled, []string{"TestEvent:event1"}) {
+		t.Error("the event should be handled:", handled)
+	}
+	if err := projector.TryHandleEvent(context.Background(), &TestEvent2{id, "event2"}); err != handleErr {
+		t.Error("the error should be returned:", err)
+	}
+
+	t.Log("count handled events and errors")
+	projector.HandleEvent(&AggregateDeleted{ID: id})
+	if stats := projector.Stats(); stats.Events != 1 || stats.Errors != 1 {
+		t.Error("the stats should be correct:", stats)
+	}
+
+	t.Log("set a handler twice")
+	_, err = NewProjector(SystemClock{}).
+		On(&TestEvent{}, EventHandlerFunc(func(Event) {})).
+		On(&TestEvent{}, EventHandlerFunc(func(Event) {})).
+		Build()
+	if err != ErrHandlerAlreadySet {
+		t.Error("there should be a ErrHandlerAlreadySet error:", err)
+	}
+}
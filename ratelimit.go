@@ -0,0 +1,139 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited is when a command is rejected because its rate limit is
+// exceeded.
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+// maxRateLimitBuckets is the number of buckets after which full buckets are
+// removed, to not keep one for every aggregate that has been seen.
+const maxRateLimitBuckets = 10000
+
+// RateLimit is a token bucket limit of a rate of commands per second, with a
+// burst of commands that can be handled at once.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// RateLimiter limits the rate of commands per command type, and optionally per
+// aggregate, with token buckets. Commands without a limit are not limited.
+type RateLimiter struct {
+	limits       map[string]RateLimit
+	perAggregate bool
+	clock        Clock
+	buckets      map[string]*tokenBucket
+	mu           sync.Mutex
+}
+
+type tokenBucket struct {
+	commandType string
+	tokens      float64
+	updated     time.Time
+}
+
+// NewRateLimiter creates a new RateLimiter. The clock is used for refilling
+// the buckets.
+func NewRateLimiter(clock Clock) *RateLimiter {
+	return &RateLimiter{
+		limits:  make(map[string]RateLimit),
+		clock:   clock,
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// SetLimit sets the limit of a command type.
+func (l *RateLimiter) SetLimit(commandType string, limit RateLimit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limits[commandType] = limit
+}
+
+// SetPerAggregate sets if the limits are per aggregate instead of shared by
+// all aggregates.
+func (l *RateLimiter) SetPerAggregate(perAggregate bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.perAggregate = perAggregate
+}
+
+// Allow takes a token for a command, and returns false if there is none left.
+func (l *RateLimiter) Allow(command Command) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	limit, ok := l.limits[command.CommandType()]
+	if !ok {
+		return true
+	}
+
+	key := command.CommandType()
+	if l.perAggregate {
+		key += "/" + command.AggregateID().String()
+	}
+
+	now := l.clock.Now()
+	bucket, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= maxRateLimitBuckets {
+			l.removeFullBuckets(now)
+		}
+		bucket = &tokenBucket{command.CommandType(), float64(limit.Burst), now}
+		l.buckets[key] = bucket
+	}
+
+	bucket.tokens += now.Sub(bucket.updated).Seconds() * limit.Rate
+	if bucket.tokens > float64(limit.Burst) {
+		bucket.tokens = float64(limit.Burst)
+	}
+	bucket.updated = now
+
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+// removeFullBuckets removes the buckets that would be full by now, which is
+// the same as not having them.
+func (l *RateLimiter) removeFullBuckets(now time.Time) {
+	for key, bucket := range l.buckets {
+		limit := l.limits[bucket.commandType]
+		if bucket.tokens+now.Sub(bucket.updated).Seconds()*limit.Rate >= float64(limit.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Middleware returns a command handler middleware that returns ErrRateLimited
+// for commands over their limit, without handling them.
+func (l *RateLimiter) Middleware() CommandHandlerMiddleware {
+	return func(handler CommandHandler) CommandHandler {
+		return CommandHandlerFunc(func(command Command) error {
+			if !l.Allow(command) {
+				return ErrRateLimited
+			}
+			return handler.HandleCommand(command)
+		})
+	}
+}
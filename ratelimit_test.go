@@ -0,0 +1,81 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	clock := &tickClock{now: time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)}
+	limiter := NewRateLimiter(clock)
+	limiter.SetLimit("TestCommand", RateLimit{Rate: 1, Burst: 2})
+
+	handled := 0
+	bus := UseCommandBusMiddleware(&handlerCommandBus{CommandHandlerFunc(func(command Command) error {
+		handled++
+		return nil
+	})}, CommandMiddleware(limiter.Middleware()))
+
+	t.Log("allow a burst")
+	id := NewUUID()
+	for i := 0; i < 2; i++ {
+		if err := bus.HandleCommand(&TestCommand{id, "command"}); err != nil {
+			t.Error("there should be no error:", err)
+		}
+	}
+	if err := bus.HandleCommand(&TestCommand{id, "command"}); err != ErrRateLimited {
+		t.Error("there should be a ErrRateLimited error:", err)
+	}
+	if handled != 2 {
+		t.Error("the limited command should not be handled:", handled)
+	}
+
+	t.Log("not limited command type")
+	if err := bus.HandleCommand(&TestCommand2{id, "command"}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("refill at the rate")
+	clock.now = clock.now.Add(time.Second)
+	if err := bus.HandleCommand(&TestCommand{id, "command"}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := bus.HandleCommand(&TestCommand{id, "command"}); err != ErrRateLimited {
+		t.Error("there should be a ErrRateLimited error:", err)
+	}
+
+	t.Log("limit per aggregate")
+	limiter.SetPerAggregate(true)
+	if err := bus.HandleCommand(&TestCommand{NewUUID(), "command"}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := bus.HandleCommand(&TestCommand{NewUUID(), "command"}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+}
+
+type handlerCommandBus struct {
+	handler CommandHandler
+}
+
+func (b *handlerCommandBus) HandleCommand(command Command) error {
+	return b.handler.HandleCommand(command)
+}
+
+func (b *handlerCommandBus) SetHandler(handler CommandHandler, command Command) error {
+	return nil
+}
@@ -0,0 +1,335 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Operator is a comparison operator of a query condition.
+type Operator int
+
+const (
+	// Eq matches fields equal to the value.
+	Eq Operator = iota
+	// Ne matches fields not equal to the value, or missing fields.
+	Ne
+	// Lt matches fields less than the value.
+	Lt
+	// Lte matches fields less than or equal to the value.
+	Lte
+	// Gt matches fields greater than the value.
+	Gt
+	// Gte matches fields greater than or equal to the value.
+	Gte
+	// In matches fields equal to any of the values in a slice.
+	In
+)
+
+// Condition is a condition on a field of read models.
+type Condition struct {
+	Field    string
+	Operator Operator
+	Value    interface{}
+}
+
+// SortOrder is the order of read models by a field.
+type SortOrder struct {
+	Field      string
+	Descending bool
+}
+
+// ModelQuery is a query for read models that is translated by each read
+// repository, so that query code is portable between them. Fields are named as
+// they are stored, which is the BSON or JSON name of a struct field or its
+// lowercase name. Nested fields are separated by dots.
+//
+// An example would be:
+//     Where("status", Eq, "accepted").OrderBy("name").Limit(50)
+type ModelQuery struct {
+	// Conditions must all match.
+	Conditions []Condition
+	// Sort is the order of the models, by the first field first.
+	Sort []SortOrder
+	// Max is the max number of models to find, or 0 for all.
+	Max int
+}
+
+// Where creates a query with a condition.
+func Where(field string, operator Operator, value interface{}) *ModelQuery {
+	return (&ModelQuery{}).Where(field, operator, value)
+}
+
+// Where adds a condition to the query.
+func (q *ModelQuery) Where(field string, operator Operator, value interface{}) *ModelQuery {
+	q.Conditions = append(q.Conditions, Condition{field, operator, value})
+	return q
+}
+
+// OrderBy sorts the models by a field in ascending order, after any previous
+// orders.
+func (q *ModelQuery) OrderBy(field string) *ModelQuery {
+	q.Sort = append(q.Sort, SortOrder{field, false})
+	return q
+}
+
+// OrderByDesc sorts the models by a field in descending order, after any
+// previous orders.
+func (q *ModelQuery) OrderByDesc(field string) *ModelQuery {
+	q.Sort = append(q.Sort, SortOrder{field, true})
+	return q
+}
+
+// Limit sets the max number of models to find.
+func (q *ModelQuery) Limit(max int) *ModelQuery {
+	q.Max = max
+	return q
+}
+
+// Matches returns true if a read model matches all conditions of the query.
+func (q *ModelQuery) Matches(model interface{}) bool {
+	for _, c := range q.Conditions {
+		value, ok := FieldValue(model, c.Field)
+		if !ok {
+			if c.Operator == Ne {
+				continue
+			}
+			return false
+		}
+		if !c.matches(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// Apply returns the read models that match the query, sorted and limited. It
+// is used by read repositories that can't translate queries.
+func (q *ModelQuery) Apply(models []interface{}) []interface{} {
+	result := []interface{}{}
+	for _, model := range models {
+		if q.Matches(model) {
+			result = append(result, model)
+		}
+	}
+
+	if len(q.Sort) > 0 {
+		sort.SliceStable(result, func(i, j int) bool {
+			for _, o := range q.Sort {
+				a, aok := FieldValue(result[i], o.Field)
+				b, bok := FieldValue(result[j], o.Field)
+				c := 0
+				switch {
+				case !aok && bok:
+					c = -1
+				case aok && !bok:
+					c = 1
+				case aok && bok:
+					c, _ = compareValues(a, b)
+				}
+				if o.Descending {
+					c = -c
+				}
+				if c != 0 {
+					return c < 0
+				}
+			}
+			return false
+		})
+	}
+
+	if q.Max > 0 && len(result) > q.Max {
+		result = result[:q.Max]
+	}
+	return result
+}
+
+func (c Condition) matches(value interface{}) bool {
+	switch c.Operator {
+	case Eq:
+		return equalValues(value, c.Value)
+	case Ne:
+		return !equalValues(value, c.Value)
+	case In:
+		values := reflect.ValueOf(c.Value)
+		if values.Kind() != reflect.Slice && values.Kind() != reflect.Array {
+			return false
+		}
+		for i := 0; i < values.Len(); i++ {
+			if equalValues(value, values.Index(i).Interface()) {
+				return true
+			}
+		}
+		return false
+	}
+
+	cmp, ok := compareValues(value, c.Value)
+	if !ok {
+		return false
+	}
+	switch c.Operator {
+	case Lt:
+		return cmp < 0
+	case Lte:
+		return cmp <= 0
+	case Gt:
+		return cmp > 0
+	case Gte:
+		return cmp >= 0
+	}
+	return false
+}
+
+// QueryableReadRepository is a read repository that can find read models by a
+// query.
+type QueryableReadRepository interface {
+	ReadRepository
+
+	// FindQuery returns the read models matching a query.
+	FindQuery(context.Context, *ModelQuery) ([]interface{}, error)
+}
+
+// FindQuery finds the read models matching a query, with FindQuery if the
+// repository implements QueryableReadRepository, otherwise by applying the
+// query to all models.
+func FindQuery(ctx context.Context, repo ReadRepository, query *ModelQuery) ([]interface{}, error) {
+	if r, ok := repo.(QueryableReadRepository); ok {
+		return r.FindQuery(ctx, query)
+	}
+	models, err := repo.FindAll()
+	if err != nil {
+		return nil, err
+	}
+	return query.Apply(models), nil
+}
+
+// FieldValue returns the value of a field of a read model, named as in a
+// ModelQuery. Returns false if the model has no such field.
+func FieldValue(model interface{}, field string) (interface{}, bool) {
+	v := reflect.ValueOf(model)
+	for _, name := range strings.Split(field, ".") {
+		for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+			if v.IsNil() {
+				return nil, false
+			}
+			v = v.Elem()
+		}
+
+		switch v.Kind() {
+		case reflect.Map:
+			if v.Type().Key().Kind() != reflect.String {
+				return nil, false
+			}
+			v = v.MapIndex(reflect.ValueOf(name).Convert(v.Type().Key()))
+			if !v.IsValid() {
+				return nil, false
+			}
+		case reflect.Struct:
+			f, ok := structField(v, name)
+			if !ok {
+				return nil, false
+			}
+			v = f
+		default:
+			return nil, false
+		}
+	}
+	return v.Interface(), true
+}
+
+// structField returns the exported field of a struct with a stored name.
+func structField(v reflect.Value, name string) (reflect.Value, bool) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		if tagName(f.Tag.Get("bson")) == name || tagName(f.Tag.Get("json")) == name ||
+			strings.EqualFold(f.Name, name) {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+func tagName(tag string) string {
+	if i := strings.Index(tag, ","); i >= 0 {
+		return tag[:i]
+	}
+	return tag
+}
+
+// equalValues returns true if two values are equal, comparing numbers of
+// different types by value.
+func equalValues(a, b interface{}) bool {
+	if cmp, ok := compareValues(a, b); ok {
+		return cmp == 0
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// compareValues compares two numbers, strings or times, and returns false if
+// they can't be compared.
+func compareValues(a, b interface{}) (int, bool) {
+	if at, ok := a.(time.Time); ok {
+		bt, ok := b.(time.Time)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case at.Before(bt):
+			return -1, true
+		case at.After(bt):
+			return 1, true
+		}
+		return 0, true
+	}
+
+	av, bv := reflect.ValueOf(a), reflect.ValueOf(b)
+	if af, ok := toFloat(av); ok {
+		bf, ok := toFloat(bv)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case af < bf:
+			return -1, true
+		case af > bf:
+			return 1, true
+		}
+		return 0, true
+	}
+	if av.Kind() == reflect.String && bv.Kind() == reflect.String {
+		return strings.Compare(av.String(), bv.String()), true
+	}
+	return 0, false
+}
+
+func toFloat(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
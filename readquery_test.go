@@ -0,0 +1,120 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type queryModel struct {
+	ID      UUID      `bson:"_id"`
+	Name    string    `json:"name"`
+	Status  string    `bson:"status"`
+	Count   int       `bson:"count"`
+	Created time.Time `bson:"created"`
+	Address *struct {
+		City string `bson:"city"`
+	} `bson:"address"`
+}
+
+func TestModelQuery(t *testing.T) {
+	now := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	m1 := &queryModel{Name: "c", Status: "accepted", Count: 1, Created: now}
+	m2 := &queryModel{Name: "a", Status: "accepted", Count: 2, Created: now.Add(time.Hour)}
+	m3 := &queryModel{Name: "b", Status: "rejected", Count: 3, Created: now.Add(2 * time.Hour)}
+	m3.Address = &struct {
+		City string `bson:"city"`
+	}{"Stockholm"}
+	m4 := map[string]interface{}{"name": "d", "status": "accepted", "count": 4.0}
+	models := []interface{}{m1, m2, m3, m4}
+
+	testCases := map[string]struct {
+		query  *ModelQuery
+		result []interface{}
+	}{
+		"equal": {
+			Where("status", Eq, "accepted"),
+			[]interface{}{m1, m2, m4},
+		},
+		"not equal": {
+			Where("status", Ne, "accepted"),
+			[]interface{}{m3},
+		},
+		"less than, numbers of other types": {
+			Where("count", Lt, 2.5),
+			[]interface{}{m1, m2},
+		},
+		"greater than or equal": {
+			Where("count", Gte, int64(3)),
+			[]interface{}{m3, m4},
+		},
+		"times": {
+			Where("created", Gt, now).Where("created", Lte, now.Add(time.Hour)),
+			[]interface{}{m2},
+		},
+		"in": {
+			Where("name", In, []string{"a", "d"}),
+			[]interface{}{m2, m4},
+		},
+		"nested field": {
+			Where("address.city", Eq, "Stockholm"),
+			[]interface{}{m3},
+		},
+		"missing field": {
+			Where("missing", Eq, "x"),
+			[]interface{}{},
+		},
+		"order and limit": {
+			Where("status", Eq, "accepted").OrderBy("name").Limit(2),
+			[]interface{}{m2, m1},
+		},
+		"order descending": {
+			(&ModelQuery{}).OrderByDesc("count"),
+			[]interface{}{m4, m3, m2, m1},
+		},
+	}
+	for name, tc := range testCases {
+		t.Log(name)
+		if result := tc.query.Apply(models); !reflect.DeepEqual(result, tc.result) {
+			t.Error("the result should be correct:", result)
+		}
+	}
+}
+
+func TestFindQuery(t *testing.T) {
+	repo := &mockReadRepository{models: []interface{}{
+		&queryModel{Name: "a", Status: "accepted"},
+		&queryModel{Name: "b", Status: "rejected"},
+	}}
+	result, err := FindQuery(context.Background(), repo, Where("status", Eq, "rejected"))
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(result) != 1 || result[0].(*queryModel).Name != "b" {
+		t.Error("the result should be correct:", result)
+	}
+}
+
+type mockReadRepository struct {
+	ReadRepository
+	models []interface{}
+}
+
+func (r *mockReadRepository) FindAll() ([]interface{}, error) {
+	return r.models, nil
+}
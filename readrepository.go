@@ -15,7 +15,9 @@
 package eventhorizon
 
 import (
+	"context"
 	"errors"
+	"time"
 )
 
 // ErrCouldNotSaveModel is when a model could not be found.
@@ -24,6 +26,14 @@ var ErrCouldNotSaveModel = errors.New("could not save model")
 // ErrModelNotFound is when a model could not be found.
 var ErrModelNotFound = errors.New("could not find model")
 
+// ErrSoftDeleteNotSupported is when a read repository can not soft delete read
+// models.
+var ErrSoftDeleteNotSupported = errors.New("soft delete not supported")
+
+// ErrIncorrectModelVersion is when a read model revision is not newer than the
+// last one.
+var ErrIncorrectModelVersion = errors.New("incorrect model version")
+
 // ReadRepository is a storage for read models.
 type ReadRepository interface {
 	// Save saves a read model with id to the repository.
@@ -38,3 +48,51 @@ type ReadRepository interface {
 	// Remove removes a read model with id from the repository.
 	Remove(UUID) error
 }
+
+// ModelRevision is a revision of a read model, with the version of the event
+// that produced it. The model of a removed read model is nil.
+type ModelRevision struct {
+	Version   int
+	Timestamp time.Time
+	Model     interface{}
+}
+
+// VersionedReadRepository is a read repository that keeps every revision of
+// the read models, for point in time queries and for debugging projections.
+type VersionedReadRepository interface {
+	ReadRepository
+
+	// SaveVersion saves a read model as Save, as the revision produced by the
+	// event with a version. The version must be newer than the last one.
+	SaveVersion(UUID, interface{}, int) error
+
+	// FindVersion returns the revision of a read model with a version.
+	FindVersion(UUID, int) (interface{}, error)
+
+	// FindAt returns the revision of a read model at a time.
+	FindAt(UUID, time.Time) (interface{}, error)
+
+	// FindRevisions returns all revisions of a read model, oldest first.
+	FindRevisions(UUID) ([]ModelRevision, error)
+}
+
+// SoftDeleteReadRepository is a read repository that can soft delete read
+// models, for projectors that handle deletion events without removing the
+// data that support still needs to see. Soft deleted models are not returned
+// by Find, FindAll and queries, including custom queries of the stores, but
+// only by FindDeleted, until restored.
+// Saving a soft deleted model keeps it deleted, and Remove removes it.
+type SoftDeleteReadRepository interface {
+	ReadRepository
+
+	// SoftDelete soft deletes a read model. Returns ErrModelNotFound if
+	// there is no model that is not deleted.
+	SoftDelete(context.Context, UUID) error
+
+	// Restore restores a soft deleted read model. Returns ErrModelNotFound
+	// if there is no deleted model.
+	Restore(context.Context, UUID) error
+
+	// FindDeleted returns all soft deleted read models.
+	FindDeleted(context.Context) ([]interface{}, error)
+}
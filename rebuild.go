@@ -0,0 +1,193 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrProjectionAlreadyRegistered is when a projection is already registered.
+var ErrProjectionAlreadyRegistered = errors.New("projection is already registered")
+
+// ErrProjectionNotRegistered is when a projection is not registered.
+var ErrProjectionNotRegistered = errors.New("projection is not registered")
+
+// Projection is an event handler that projects events into read models, and
+// that can be rebuilt from all events.
+type Projection interface {
+	EventHandler
+
+	// Clear removes the read models of the projection before it is rebuilt.
+	Clear(context.Context) error
+}
+
+var projectionFactories = make(map[string]func() Projection)
+var projectionFactoriesMu sync.RWMutex
+
+// RegisterProjection registers a factory of a projection by name, so that it
+// can be rebuilt by tools, for example by ehctl.
+func RegisterProjection(name string, factory func() Projection) error {
+	projectionFactoriesMu.Lock()
+	defer projectionFactoriesMu.Unlock()
+	if _, ok := projectionFactories[name]; ok {
+		return ErrProjectionAlreadyRegistered
+	}
+	projectionFactories[name] = factory
+	return nil
+}
+
+// UnregisterProjection removes the factory of a projection.
+func UnregisterProjection(name string) {
+	projectionFactoriesMu.Lock()
+	defer projectionFactoriesMu.Unlock()
+	delete(projectionFactories, name)
+}
+
+// CreateProjection creates a projection with its registered factory. Returns
+// ErrProjectionNotRegistered if it is not registered.
+func CreateProjection(name string) (Projection, error) {
+	projectionFactoriesMu.RLock()
+	defer projectionFactoriesMu.RUnlock()
+	factory, ok := projectionFactories[name]
+	if !ok {
+		return nil, ErrProjectionNotRegistered
+	}
+	return factory(), nil
+}
+
+// ProjectionNames returns the names of the registered projections, sorted.
+func ProjectionNames() []string {
+	projectionFactoriesMu.RLock()
+	defer projectionFactoriesMu.RUnlock()
+	names := make([]string, 0, len(projectionFactories))
+	for name := range projectionFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RebuildProgress is the progress of a rebuild, with the number of events
+// handled and the position to resume from.
+type RebuildProgress struct {
+	Events   int
+	Position Position
+}
+
+// Rebuilder rebuilds a projection by handling all events of an event store in
+// the order they were saved, optionally at a limited rate to not overload the
+// read model storage.
+type Rebuilder struct {
+	store      GlobalEventStore
+	projection Projection
+	batchSize  int
+	rate       float64
+	clock      Clock
+	progress   func(RebuildProgress)
+	stats      *StatsCounter
+}
+
+// NewRebuilder creates a new Rebuilder. The clock is used for limiting the
+// rate and for the stats.
+func NewRebuilder(store GlobalEventStore, projection Projection, clock Clock) *Rebuilder {
+	return &Rebuilder{
+		store:      store,
+		projection: projection,
+		batchSize:  100,
+		clock:      clock,
+		stats:      NewStatsCounter(clock),
+	}
+}
+
+// SetBatchSize sets the number of events to load at a time.
+func (r *Rebuilder) SetBatchSize(size int) {
+	r.batchSize = size
+}
+
+// SetRate sets the maximum number of events to handle per second, or 0 for no
+// limit.
+func (r *Rebuilder) SetRate(eventsPerSecond float64) {
+	r.rate = eventsPerSecond
+}
+
+// SetProgressFunc sets a function that is called with the progress after each
+// batch of events.
+func (r *Rebuilder) SetProgressFunc(f func(RebuildProgress)) {
+	r.progress = f
+}
+
+// Stats implements the Stats method of the StatsProvider interface, with the
+// events handled by the projection and the events that failed.
+func (r *Rebuilder) Stats() ComponentStats {
+	return r.stats.Stats()
+}
+
+// Rebuild handles the events after a position. If the position is empty the
+// projection is cleared first, and all events are handled. The progress is
+// returned also when the context is done or loading fails, with the position
+// of the last handled event, so that the rebuild can be resumed from it.
+func (r *Rebuilder) Rebuild(ctx context.Context, from Position) (RebuildProgress, error) {
+	progress := RebuildProgress{Position: from}
+	if from == "" {
+		if err := r.projection.Clear(ctx); err != nil {
+			return progress, err
+		}
+	}
+
+	start := r.clock.Now()
+	for {
+		envelopes, _, err := r.store.LoadAll(ctx, progress.Position, r.batchSize)
+		if err != nil {
+			return progress, err
+		}
+		if len(envelopes) == 0 {
+			return progress, nil
+		}
+
+		for _, envelope := range envelopes {
+			if r.rate > 0 {
+				due := start.Add(time.Duration(float64(progress.Events) / r.rate * float64(time.Second)))
+				if wait := due.Sub(r.clock.Now()); wait > 0 {
+					select {
+					case <-r.clock.After(wait):
+					case <-ctx.Done():
+						return progress, ctx.Err()
+					}
+				}
+			}
+			if err := ctx.Err(); err != nil {
+				return progress, err
+			}
+
+			if err := TryHandleEvent(NewContextWithHeaders(ctx, envelope.Headers), r.projection, envelope.Event); err != nil {
+				log.Printf("error: rebuild: could not handle %s: %v\n", envelope.Event.EventType(), err)
+				r.stats.AddError()
+			} else {
+				r.stats.AddEvents(1)
+			}
+			progress.Events++
+			progress.Position = envelope.Position
+		}
+
+		if r.progress != nil {
+			r.progress(progress)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRebuilder(t *testing.T) {
+	store := &globalEventStore{}
+	var events []Event
+	for i := 0; i < 3; i++ {
+		event := &TestEvent{NewUUID(), "event" + strconv.Itoa(i)}
+		events = append(events, event)
+		store.envelopes = append(store.envelopes, EventEnvelope{
+			Event:    event,
+			Position: Position(strconv.Itoa(i + 1)),
+		})
+	}
+	projection := &mockProjection{}
+	clock := &tickClock{now: time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC), ticks: make(chan time.Time)}
+	rebuilder := NewRebuilder(store, projection, clock)
+	var progress []RebuildProgress
+	rebuilder.SetProgressFunc(func(p RebuildProgress) {
+		progress = append(progress, p)
+	})
+
+	t.Log("interrupt a rebuild")
+	ctx, cancel := context.WithCancel(context.Background())
+	projection.handled = func(n int) {
+		if n == 2 {
+			cancel()
+		}
+	}
+	result, err := rebuilder.Rebuild(ctx, "")
+	if err != context.Canceled {
+		t.Error("there should be a context error:", err)
+	}
+	if result != (RebuildProgress{2, "2"}) || projection.cleared != 1 {
+		t.Error("the rebuild should stop after the second event:", result, projection.cleared)
+	}
+
+	t.Log("resume the rebuild")
+	projection.handled = nil
+	if result, err = rebuilder.Rebuild(context.Background(), result.Position); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if result != (RebuildProgress{1, "3"}) || projection.cleared != 1 {
+		t.Error("the rebuild should resume without clearing:", result, projection.cleared)
+	}
+	if !reflect.DeepEqual(projection.events, events) {
+		t.Error("the events should be handled:", projection.events)
+	}
+	expected := []RebuildProgress{{1, "1"}, {2, "2"}, {1, "3"}}
+	if !reflect.DeepEqual(progress, expected) {
+		t.Error("the progress should be correct:", progress)
+	}
+	if stats := rebuilder.Stats(); stats.Events != 3 || stats.Errors != 0 {
+		t.Error("the stats should count the handled events:", stats)
+	}
+
+	t.Log("rebuild at a limited rate")
+	projection.events = nil
+	rebuilder.SetRate(1)
+	done := make(chan struct{})
+	go func() {
+		_, err = rebuilder.Rebuild(context.Background(), "")
+		close(done)
+	}()
+	clock.ticks <- clock.now
+	clock.ticks <- clock.now
+	<-done
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(projection.events, events) {
+		t.Error("the events should be handled:", projection.events)
+	}
+}
+
+func TestProjectionRegistry(t *testing.T) {
+	factory := func() Projection { return &mockProjection{} }
+	if err := RegisterProjection("test", factory); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	defer UnregisterProjection("test")
+	if err := RegisterProjection("test", factory); err != ErrProjectionAlreadyRegistered {
+		t.Error("there should be a ErrProjectionAlreadyRegistered error:", err)
+	}
+	if names := ProjectionNames(); !reflect.DeepEqual(names, []string{"test"}) {
+		t.Error("the names should be correct:", names)
+	}
+	if _, err := CreateProjection("test"); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, err := CreateProjection("other"); err != ErrProjectionNotRegistered {
+		t.Error("there should be a ErrProjectionNotRegistered error:", err)
+	}
+}
+
+type mockProjection struct {
+	events  []Event
+	cleared int
+	handled func(int)
+}
+
+func (p *mockProjection) HandleEvent(event Event) {
+	p.events = append(p.events, event)
+	if p.handled != nil {
+		p.handled(len(p.events))
+	}
+}
+
+func (p *mockProjection) Clear(ctx context.Context) error {
+	p.cleared++
+	return nil
+}
@@ -0,0 +1,255 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrReplicationConflict is when a replica has events of an aggregate that
+// were not replicated from the primary, usually because they were saved
+// directly in the replica.
+var ErrReplicationConflict = errors.New("replication conflict")
+
+// HeaderReplicatedPosition is the header with the position in the primary
+// event store of an event replicated by a Replicator.
+const HeaderReplicatedPosition = "replicated_position"
+
+// maxReplicatedVersions is the number of aggregates whose replicated versions
+// are kept by a Replicator, after which they are loaded from the replica again.
+const maxReplicatedVersions = 10000
+
+// PositionStore is a store of named positions in event stores, for example of
+// how far a replicator has replicated the events or a listener has passed them
+// on, so that components persist where they are in the stream the same way.
+type PositionStore interface {
+	// LoadPosition loads a position, which is empty if none is saved.
+	LoadPosition(ctx context.Context, name string) (Position, error)
+
+	// SavePosition saves a position.
+	SavePosition(ctx context.Context, name string, position Position) error
+}
+
+// Replicator ships the events saved in a primary event store to a replica,
+// for example in another region for disaster recovery and local reads. The
+// events are replicated asynchronously in the order they were saved, with
+// their headers and the header HeaderReplicatedPosition, and the position is
+// saved in a PositionStore after each batch so that it can resume.
+//
+// Events are replicated at least once; events that the replica already has
+// are skipped by their versions, so the replica must get the streams from
+// their first event. The replicated version of an aggregate is loaded from the
+// replica when it is first seen and then kept. If the replica has events of an
+// aggregate that were not replicated the replication stops with an EventError
+// with ErrReplicationConflict, with an ErrVersionConflict with those events as
+// the cause.
+//
+// Events are only replicated in order if LoadAll of the primary never returns
+// an event after ones with higher positions, which the stores of this project
+// guarantee.
+type Replicator struct {
+	Lifecycle
+
+	name      string
+	primary   GlobalEventStore
+	replica   MetadataEventStore
+	positions PositionStore
+	batchSize int
+	interval  time.Duration
+	clock     Clock
+	position  Position
+	loaded    bool
+	versions  map[UUID]int
+	stats     *StatsCounter
+	mu        sync.Mutex
+}
+
+// NewReplicator creates a Replicator, which saves its position with a name.
+// The clock is used for the interval.
+func NewReplicator(name string, primary GlobalEventStore, replica MetadataEventStore, positions PositionStore, clock Clock) *Replicator {
+	return &Replicator{
+		name:      name,
+		primary:   primary,
+		replica:   replica,
+		positions: positions,
+		batchSize: 100,
+		interval:  time.Second,
+		clock:     clock,
+		versions:  make(map[UUID]int),
+		stats:     NewStatsCounter(clock),
+	}
+}
+
+// SetBatchSize sets the number of events to replicate at a time.
+func (r *Replicator) SetBatchSize(size int) {
+	r.batchSize = size
+}
+
+// SetInterval sets the interval to check for new events at when running.
+func (r *Replicator) SetInterval(interval time.Duration) {
+	r.interval = interval
+}
+
+// Stats implements the Stats method of the StatsProvider interface, with the
+// replicated events and the replications that failed.
+func (r *Replicator) Stats() ComponentStats {
+	return r.stats.Stats()
+}
+
+// Position returns the position in the primary of the last replicated event.
+func (r *Replicator) Position() Position {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.position
+}
+
+// Run replicates events now and then at every interval, until the context is
+// done or the events could not be replicated.
+func (r *Replicator) Run(ctx context.Context) error {
+	for {
+		if _, err := r.Replicate(ctx); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-r.clock.After(r.interval):
+		}
+	}
+}
+
+// Replicate replicates the events saved since the last replication, and
+// returns the number of replicated events.
+func (r *Replicator) Replicate(ctx context.Context) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n, err := r.replicate(ctx)
+	r.stats.AddEvents(n)
+	if err != nil && ctx.Err() == nil {
+		r.stats.AddError()
+	}
+	return n, err
+}
+
+// replicate replicates the events saved since the last replication.
+func (r *Replicator) replicate(ctx context.Context) (int, error) {
+	if !r.loaded {
+		position, err := r.positions.LoadPosition(ctx, r.name)
+		if err != nil {
+			return 0, err
+		}
+		r.position, r.loaded = position, true
+	}
+
+	n := 0
+	for {
+		envelopes, next, err := r.primary.LoadAll(ctx, r.position, r.batchSize)
+		if err != nil {
+			return n, err
+		}
+		if len(envelopes) == 0 {
+			return n, nil
+		}
+
+		for _, envelope := range envelopes {
+			if err := ctx.Err(); err != nil {
+				return n, err
+			}
+
+			id := envelope.Event.AggregateID()
+			version, ok := r.versions[id]
+			if !ok {
+				if version, err = r.replicatedVersion(ctx, id); err != nil {
+					return n, err
+				}
+				if len(r.versions) >= maxReplicatedVersions {
+					r.versions = make(map[UUID]int)
+				}
+				r.versions[id] = version
+			}
+			if envelope.Version <= version {
+				continue
+			}
+
+			headers := Headers{}
+			for k, v := range envelope.Headers {
+				headers[k] = v
+			}
+			headers[HeaderReplicatedPosition] = string(envelope.Position)
+			if err := r.replica.SaveWithContext(NewContextWithHeaders(ctx, headers), []Event{envelope.Event}); err != nil {
+				// Load the version again to check for conflicts when retrying.
+				delete(r.versions, id)
+				return n, err
+			}
+			r.versions[id] = envelope.Version
+			n++
+		}
+
+		r.position = next
+		if err := r.positions.SavePosition(ctx, r.name, next); err != nil {
+			return n, err
+		}
+	}
+}
+
+// replicatedVersion returns the version of an aggregate in the replica.
+// Returns ErrReplicationConflict if the replica has events of the aggregate
+// that were not replicated.
+func (r *Replicator) replicatedVersion(ctx context.Context, id UUID) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	envelopes, err := r.replica.LoadEnvelopes(id)
+	if err == ErrNoEventsFound {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	replicated := 0
+	var local []Event
+	for _, envelope := range envelopes {
+		if _, ok := envelope.Headers[HeaderReplicatedPosition]; ok {
+			replicated++
+		} else {
+			local = append(local, envelope.Event)
+		}
+	}
+	if len(local) > 0 {
+		return 0, &EventError{
+			Err: ErrReplicationConflict,
+			Cause: ErrVersionConflict{
+				AggregateID:       id,
+				ExpectedVersion:   replicated,
+				ActualVersion:     len(envelopes),
+				ConflictingEvents: local,
+			},
+			EventType:   local[0].EventType(),
+			AggregateID: id,
+		}
+	}
+	if len(envelopes) == 0 {
+		return 0, nil
+	}
+	return envelopes[len(envelopes)-1].Version, nil
+}
@@ -0,0 +1,127 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestReplicator(t *testing.T) {
+	id1, id2 := NewUUID(), NewUUID()
+	event1 := &TestEvent{id1, "event1"}
+	event2 := &TestEvent{id2, "event2"}
+	event3 := &TestEvent{id1, "event3"}
+	primary := &globalEventStore{envelopes: []EventEnvelope{
+		{Event: event1, Version: 1, Position: "1", Headers: Headers{HeaderUserID: "user"}},
+		{Event: event2, Version: 1, Position: "2"},
+	}}
+	replica := &replicaEventStore{envelopes: map[UUID][]EventEnvelope{}}
+	positions := &positionStore{}
+	r := NewReplicator("replica", primary, replica, positions, SystemClock{})
+
+	t.Log("replicate the events with their headers")
+	n, err := r.Replicate(context.Background())
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if n != 2 {
+		t.Error("two events should be replicated:", n)
+	}
+	expected := []EventEnvelope{{Event: event1, Version: 1, Headers: Headers{HeaderUserID: "user", HeaderReplicatedPosition: "1"}}}
+	if !reflect.DeepEqual(replica.envelopes[id1], expected) {
+		t.Error("the replicated events should be correct:", replica.envelopes[id1])
+	}
+	if r.Position() != "2" || positions.position != "2" {
+		t.Error("the position should be saved:", r.Position(), positions.position)
+	}
+
+	t.Log("skip events that are already replicated")
+	r = NewReplicator("replica", primary, replica, &positionStore{}, SystemClock{})
+	if n, err = r.Replicate(context.Background()); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if n != 0 || len(replica.envelopes[id1]) != 1 {
+		t.Error("no events should be replicated:", n)
+	}
+
+	t.Log("keep the replicated versions between batches")
+	replica.loads = 0
+	primary.envelopes = append(primary.envelopes, EventEnvelope{Event: event3, Version: 2, Position: "3"})
+	if n, err = r.Replicate(context.Background()); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if n != 1 || len(replica.envelopes[id1]) != 2 {
+		t.Error("one event should be replicated:", n)
+	}
+	if replica.loads != 0 {
+		t.Error("the replica should not be loaded again:", replica.loads)
+	}
+
+	t.Log("detect events saved in the replica")
+	local := &TestEvent{id1, "local"}
+	replica.envelopes[id1] = append(replica.envelopes[id1], EventEnvelope{Event: local, Version: 3})
+	primary.envelopes = append(primary.envelopes, EventEnvelope{Event: &TestEvent{id1, "event4"}, Version: 3, Position: "4"})
+	r = NewReplicator("replica", primary, replica, positions, SystemClock{})
+	_, err = r.Replicate(context.Background())
+	if !errors.Is(err, ErrReplicationConflict) {
+		t.Error("there should be a ErrReplicationConflict error:", err)
+	}
+	var conflict ErrVersionConflict
+	if !errors.As(err, &conflict) || !reflect.DeepEqual(conflict.ConflictingEvents, []Event{local}) {
+		t.Error("the conflicting events should be correct:", err)
+	}
+	if r.Position() != "2" {
+		t.Error("the position should not change:", r.Position())
+	}
+}
+
+type replicaEventStore struct {
+	MockEventStore
+	envelopes map[UUID][]EventEnvelope
+	loads     int
+}
+
+func (s *replicaEventStore) SaveWithContext(ctx context.Context, events []Event) error {
+	for _, event := range events {
+		id := event.AggregateID()
+		s.envelopes[id] = append(s.envelopes[id],
+			EventEnvelope{Event: event, Version: len(s.envelopes[id]) + 1, Headers: HeadersFromContext(ctx)})
+	}
+	return nil
+}
+
+func (s *replicaEventStore) LoadEnvelopes(id UUID) ([]EventEnvelope, error) {
+	s.loads++
+	if len(s.envelopes[id]) == 0 {
+		return nil, ErrNoEventsFound
+	}
+	return s.envelopes[id], nil
+}
+
+type positionStore struct {
+	position Position
+}
+
+func (s *positionStore) LoadPosition(ctx context.Context, name string) (Position, error) {
+	return s.position, nil
+}
+
+func (s *positionStore) SavePosition(ctx context.Context, name string, position Position) error {
+	s.position = position
+	return nil
+}
@@ -15,7 +15,10 @@
 package eventhorizon
 
 import (
+	"context"
 	"errors"
+	"sync"
+	"time"
 )
 
 // ErrNilEventStore is when a dispatcher is created with a nil event store.
@@ -30,6 +33,13 @@ var ErrAggregateNotRegistered = errors.New("aggregate is not registered")
 // ErrMismatchedEventType occurs when loaded events from ID does not match aggregate type.
 var ErrMismatchedEventType = errors.New("mismatched event type and aggregate type")
 
+// ErrAggregateVersionNotFound is when an aggregate has not reached a version.
+var ErrAggregateVersionNotFound = errors.New("aggregate version not found")
+
+// ErrNoEventTimestamps is when an event store does not return the timestamps
+// of events.
+var ErrNoEventTimestamps = errors.New("event store has no timestamps")
+
 // Repository is a repository responsible for loading and saving aggregates.
 type Repository interface {
 	// Load loads an aggregate with a type and id.
@@ -41,8 +51,9 @@ type Repository interface {
 
 // CallbackRepository is an aggregate repository using factory functions.
 type CallbackRepository struct {
-	eventStore EventStore
-	callbacks  map[string]func(UUID) Aggregate
+	eventStore    EventStore
+	snapshotStore SnapshotStore
+	callbacks     map[string]func(UUID) Aggregate
 }
 
 // NewCallbackRepository creates a repository and associates it with an event store.
@@ -73,40 +84,184 @@ func (r *CallbackRepository) RegisterAggregate(aggregate Aggregate, callback fun
 	return nil
 }
 
-// Load loads an aggregate by creating it and applying all events.
-func (r *CallbackRepository) Load(aggregateType string, id UUID) (Aggregate, error) {
-	// Get the registered factory function for creating aggregates.
-	f, ok := r.callbacks[aggregateType]
-	if !ok {
-		return nil, ErrAggregateNotRegistered
+// SetSnapshotStore sets a snapshot store that aggregates are restored from
+// before the newer events are applied. Only aggregates that implement
+// SnapshotAggregate are restored, and only if the event store implements
+// SnapshotEventStore.
+func (r *CallbackRepository) SetSnapshotStore(snapshotStore SnapshotStore) {
+	r.snapshotStore = snapshotStore
+}
+
+// createAggregate creates an aggregate with the factory of the repository, or
+// the one registered with RegisterAggregateType if the repository has none.
+func (r *CallbackRepository) createAggregate(aggregateType string, id UUID) (Aggregate, error) {
+	if f, ok := r.callbacks[aggregateType]; ok {
+		return f(id), nil
 	}
+	return CreateAggregate(aggregateType, id)
+}
 
-	// Create aggregate with factory.
-	aggregate := f(id)
+// Load loads an aggregate by creating it and applying all events. With a
+// snapshot store the aggregate is restored from its latest snapshot, and only
+// the newer events are applied.
+func (r *CallbackRepository) Load(aggregateType string, id UUID) (Aggregate, error) {
+	// Create aggregate with the registered factory.
+	aggregate, err := r.createAggregate(aggregateType, id)
+	if err != nil {
+		return nil, err
+	}
 
-	// Load aggregate events.
-	events, _ := r.eventStore.Load(aggregate.AggregateID())
+	// Load aggregate events after the snapshot, or all of them streamed if
+	// supported by the store.
+	iter, err := r.restore(aggregate, aggregateType, -1)
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
 
 	// Apply the events.
-	for _, event := range events {
-		if event.AggregateType() != aggregateType {
-			return nil, ErrMismatchedEventType
+	for iter.Next() {
+		if err := applyEvent(aggregate, aggregateType, iter.Event()); err != nil {
+			return nil, err
 		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
 
-		aggregate.ApplyEvent(event)
-		aggregate.IncrementVersion()
+	return aggregate, nil
+}
+
+// LoadVersion loads an aggregate as it was at a version, by applying only the
+// events up to that version. With a snapshot store it is restored from the
+// latest snapshot that is not newer than the version. Returns
+// ErrAggregateVersionNotFound if the aggregate has not reached the version.
+func (r *CallbackRepository) LoadVersion(ctx context.Context, aggregateType string, id UUID, version int) (Aggregate, error) {
+	aggregate, err := r.createAggregate(aggregateType, id)
+	if err != nil {
+		return nil, err
+	}
+
+	iter, err := r.restore(aggregate, aggregateType, version)
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	for aggregate.Version() < version && iter.Next() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := applyEvent(aggregate, aggregateType, iter.Event()); err != nil {
+			return nil, err
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	if aggregate.Version() < version {
+		return nil, ErrAggregateVersionNotFound
+	}
+
+	return aggregate, nil
+}
+
+// LoadAt loads an aggregate as it was at a time, by applying only the events
+// saved until then. The event store must implement MetadataEventStore for the
+// timestamps of the events, otherwise ErrNoEventTimestamps is returned.
+func (r *CallbackRepository) LoadAt(ctx context.Context, aggregateType string, id UUID, asOf time.Time) (Aggregate, error) {
+	aggregate, err := r.createAggregate(aggregateType, id)
+	if err != nil {
+		return nil, err
+	}
+
+	store, ok := r.eventStore.(MetadataEventStore)
+	if !ok {
+		return nil, ErrNoEventTimestamps
+	}
+	envelopes, err := store.LoadEnvelopes(aggregate.AggregateID())
+	if err != nil && err != ErrNoEventsFound {
+		return nil, err
+	}
+
+	for _, envelope := range envelopes {
+		if envelope.Timestamp.After(asOf) {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := applyEvent(aggregate, aggregateType, envelope.Event); err != nil {
+			return nil, err
+		}
 	}
 
 	return aggregate, nil
 }
 
-// Save saves all uncommitted events from an aggregate.
+// restore restores an aggregate from its latest snapshot if there is one that
+// is not newer than a version, or of any version if it is negative. It returns
+// an iterator over the events after the snapshot, or over all events if the
+// aggregate was not restored.
+func (r *CallbackRepository) restore(aggregate Aggregate, aggregateType string, version int) (EventIterator, error) {
+	a, ok := aggregate.(SnapshotAggregate)
+	store, ok2 := r.eventStore.(SnapshotEventStore)
+	if r.snapshotStore == nil || !ok || !ok2 {
+		return LoadIterator(r.eventStore, aggregate.AggregateID())
+	}
+
+	snapshot, err := r.snapshotStore.LoadSnapshot(aggregate.AggregateID())
+	if err == ErrSnapshotNotFound {
+		return LoadIterator(r.eventStore, aggregate.AggregateID())
+	} else if err != nil {
+		return nil, err
+	}
+
+	// Snapshots of other types or of newer versions can't be used.
+	if snapshot.AggregateType != aggregateType || (version >= 0 && snapshot.Version > version) {
+		return LoadIterator(r.eventStore, aggregate.AggregateID())
+	}
+
+	events, err := store.LoadAfter(aggregate.AggregateID(), snapshot.Version)
+	if err != nil && err != ErrNoEventsFound {
+		return nil, err
+	}
+	if err := a.ApplySnapshot(snapshot); err != nil {
+		return nil, err
+	}
+	for aggregate.Version() < snapshot.Version {
+		aggregate.IncrementVersion()
+	}
+	return NewSliceEventIterator(events), nil
+}
+
+// applyEvent applies an event to an aggregate of a type and increments its
+// version.
+func applyEvent(aggregate Aggregate, aggregateType string, event Event) error {
+	if event.AggregateType() != aggregateType {
+		return ErrMismatchedEventType
+	}
+
+	aggregate.ApplyEvent(event)
+	aggregate.IncrementVersion()
+	return nil
+}
+
+// Save saves all uncommitted events from an aggregate. If the event store is a
+// VersionedEventStore the events are only saved if no other events have been
+// saved since the aggregate was loaded, otherwise an ErrVersionConflict is
+// returned.
 func (r *CallbackRepository) Save(aggregate Aggregate) error {
 	resultEvents := aggregate.GetUncommittedEvents()
 
 	if len(resultEvents) > 0 {
 		// Store events
-		err := r.eventStore.Save(resultEvents)
+		var err error
+		if s, ok := r.eventStore.(VersionedEventStore); ok {
+			err = s.SaveWithVersion(context.Background(), resultEvents, aggregate.Version())
+		} else {
+			err = r.eventStore.Save(resultEvents)
+		}
 		if err != nil {
 			return err
 		}
@@ -116,3 +271,38 @@ func (r *CallbackRepository) Save(aggregate Aggregate) error {
 
 	return nil
 }
+
+// LoadAggregates loads many aggregates of a type concurrently, with at most
+// parallelism loads at the same time. The aggregates are returned in the same
+// order as the ids. If any load fails the first error is returned.
+//
+// Each aggregate is loaded with the Load method of the repository, so a
+// CallbackRepository with a snapshot store restores them from their snapshots
+// and loads only the newer events.
+func LoadAggregates(repository Repository, aggregateType string, ids []UUID, parallelism int) ([]Aggregate, error) {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	aggregates := make([]Aggregate, len(ids))
+	errs := make([]error, len(ids))
+	slots := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i, id := range ids {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int, id UUID) {
+			defer wg.Done()
+			aggregates[i], errs[i] = repository.Load(aggregateType, id)
+			<-slots
+		}(i, id)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return aggregates, nil
+}
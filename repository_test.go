@@ -14,7 +14,14 @@
 
 package eventhorizon
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
 
 func TestNewRepository(t *testing.T) {
 	store := &MockEventStore{
@@ -223,3 +230,234 @@ func createRepoAndStore(t *testing.T) (*CallbackRepository, *MockEventStore) {
 	}
 	return repo, store
 }
+
+func TestLoadAggregates(t *testing.T) {
+	id1, id2, id3 := NewUUID(), NewUUID(), NewUUID()
+	agg1 := &TestAggregate{AggregateBase: NewAggregateBase(id1)}
+	agg2 := &TestAggregate{AggregateBase: NewAggregateBase(id2)}
+	agg3 := &TestAggregate{AggregateBase: NewAggregateBase(id3)}
+	repo := &slowRepository{
+		MockRepository: MockRepository{
+			Aggregates: map[UUID]Aggregate{id1: agg1, id2: agg2, id3: agg3},
+		},
+	}
+
+	t.Log("load in order with limited parallelism")
+	aggregates, err := LoadAggregates(repo, "TestAggregate", []UUID{id3, id1, id2}, 2)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(aggregates, []Aggregate{agg3, agg1, agg2}) {
+		t.Error("the aggregates should be correct:", aggregates)
+	}
+	if repo.max != 2 {
+		t.Error("there should be two concurrent loads:", repo.max)
+	}
+
+	t.Log("load error")
+	repo.err = errors.New("load error")
+	if _, err := LoadAggregates(repo, "TestAggregate", []UUID{id1}, 2); err != repo.err {
+		t.Error("there should be a load error:", err)
+	}
+}
+
+type slowRepository struct {
+	MockRepository
+	err    error
+	active int
+	max    int
+	mu     sync.Mutex
+}
+
+func (r *slowRepository) Load(aggregateType string, id UUID) (Aggregate, error) {
+	r.mu.Lock()
+	r.active++
+	if r.active > r.max {
+		r.max = r.active
+	}
+	r.mu.Unlock()
+
+	time.Sleep(10 * time.Millisecond)
+
+	r.mu.Lock()
+	r.active--
+	r.mu.Unlock()
+
+	if r.err != nil {
+		return nil, r.err
+	}
+	return r.MockRepository.Load(aggregateType, id)
+}
+
+func TestRepositoryLoadVersion(t *testing.T) {
+	repo, store := createRepoAndStore(t)
+	repo.RegisterAggregate(&TestAggregate{}, func(id UUID) Aggregate {
+		return &TestAggregate{AggregateBase: NewAggregateBase(id)}
+	})
+	id := NewUUID()
+	event1 := &TestEvent{id, "event1"}
+	event2 := &TestEvent{id, "event2"}
+	event3 := &TestEvent{id, "event3"}
+	store.Save([]Event{event1, event2, event3})
+
+	t.Log("load at version")
+	agg, err := repo.LoadVersion(context.Background(), "TestAggregate", id, 2)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if agg.Version() != 2 || agg.(*TestAggregate).appliedEvent != event2 {
+		t.Error("the aggregate should be at version 2:", agg.Version())
+	}
+
+	t.Log("load at future version")
+	if _, err := repo.LoadVersion(context.Background(), "TestAggregate", id, 4); err != ErrAggregateVersionNotFound {
+		t.Error("there should be a ErrAggregateVersionNotFound error:", err)
+	}
+}
+
+func TestRepositoryLoadSnapshot(t *testing.T) {
+	id := NewUUID()
+	event1 := &TestEvent{id, "event1"}
+	event2 := &TestEvent{id, "event2"}
+	event3 := &TestEvent{id, "event3"}
+	store := &snapshotEventStore{}
+	store.Save([]Event{event1, event2, event3})
+	snapshots := &mockSnapshotStore{}
+	repo, _ := NewCallbackRepository(store)
+	repo.SetSnapshotStore(snapshots)
+	repo.RegisterAggregate(&TestAggregate{}, func(id UUID) Aggregate {
+		return &snapshotAggregate{TestAggregate{AggregateBase: NewAggregateBase(id)}, nil}
+	})
+
+	t.Log("load all events without a snapshot")
+	agg, err := repo.Load("TestAggregate", id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if agg.Version() != 3 || agg.(*snapshotAggregate).restored != nil {
+		t.Error("the aggregate should not be restored:", agg.Version())
+	}
+
+	t.Log("restore from the snapshot and apply the newer events")
+	snapshot := &Snapshot{AggregateID: id, AggregateType: "TestAggregate", Version: 2}
+	snapshots.snapshot = snapshot
+	agg, err = repo.Load("TestAggregate", id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if agg.Version() != 3 || agg.(*snapshotAggregate).restored != snapshot {
+		t.Error("the aggregate should be restored:", agg.Version())
+	}
+	if agg.(*snapshotAggregate).appliedEvent != event3 || store.after != 2 {
+		t.Error("only the newer events should be applied:", agg.(*snapshotAggregate).appliedEvent, store.after)
+	}
+
+	t.Log("load aggregates from snapshots")
+	aggregates, err := LoadAggregates(repo, "TestAggregate", []UUID{id}, 1)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if aggregates[0].Version() != 3 || aggregates[0].(*snapshotAggregate).restored != snapshot {
+		t.Error("the aggregate should be restored:", aggregates[0].Version())
+	}
+
+	t.Log("load a version from the snapshot")
+	agg, err = repo.LoadVersion(context.Background(), "TestAggregate", id, 2)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if agg.Version() != 2 || agg.(*snapshotAggregate).restored != snapshot {
+		t.Error("the aggregate should be restored at version 2:", agg.Version())
+	}
+
+	t.Log("load a version before the snapshot")
+	agg, err = repo.LoadVersion(context.Background(), "TestAggregate", id, 1)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if agg.Version() != 1 || agg.(*snapshotAggregate).restored != nil {
+		t.Error("the aggregate should not be restored:", agg.Version())
+	}
+}
+
+type snapshotAggregate struct {
+	TestAggregate
+	restored *Snapshot
+}
+
+func (a *snapshotAggregate) ApplySnapshot(snapshot *Snapshot) error {
+	a.restored = snapshot
+	return nil
+}
+
+type snapshotEventStore struct {
+	MockEventStore
+	after int
+}
+
+func (s *snapshotEventStore) LoadAfter(id UUID, version int) ([]Event, error) {
+	s.after = version
+	return s.Events[version:], nil
+}
+
+type mockSnapshotStore struct {
+	snapshot *Snapshot
+}
+
+func (s *mockSnapshotStore) SaveSnapshot(snapshot *Snapshot) error {
+	s.snapshot = snapshot
+	return nil
+}
+
+func (s *mockSnapshotStore) LoadSnapshot(id UUID) (*Snapshot, error) {
+	if s.snapshot == nil {
+		return nil, ErrSnapshotNotFound
+	}
+	return s.snapshot, nil
+}
+
+func TestRepositoryLoadAt(t *testing.T) {
+	id := NewUUID()
+	event1 := &TestEvent{id, "event1"}
+	event2 := &TestEvent{id, "event2"}
+	start := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := &envelopeEventStore{envelopes: []EventEnvelope{
+		{Event: event1, Version: 1, Timestamp: start},
+		{Event: event2, Version: 2, Timestamp: start.Add(time.Hour)},
+	}}
+	repo, _ := NewCallbackRepository(store)
+	repo.RegisterAggregate(&TestAggregate{}, func(id UUID) Aggregate {
+		return &TestAggregate{AggregateBase: NewAggregateBase(id)}
+	})
+
+	t.Log("load at time")
+	agg, err := repo.LoadAt(context.Background(), "TestAggregate", id, start.Add(time.Minute))
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if agg.Version() != 1 || agg.(*TestAggregate).appliedEvent != event1 {
+		t.Error("the aggregate should be at version 1:", agg.Version())
+	}
+
+	t.Log("load without timestamps")
+	repo, _ = createRepoAndStore(t)
+	repo.RegisterAggregate(&TestAggregate{}, func(id UUID) Aggregate {
+		return &TestAggregate{AggregateBase: NewAggregateBase(id)}
+	})
+	if _, err := repo.LoadAt(context.Background(), "TestAggregate", id, start); err != ErrNoEventTimestamps {
+		t.Error("there should be a ErrNoEventTimestamps error:", err)
+	}
+}
+
+type envelopeEventStore struct {
+	MockEventStore
+	envelopes []EventEnvelope
+}
+
+func (s *envelopeEventStore) SaveWithContext(ctx context.Context, events []Event) error {
+	return s.Save(events)
+}
+
+func (s *envelopeEventStore) LoadEnvelopes(id UUID) ([]EventEnvelope, error) {
+	return s.envelopes, nil
+}
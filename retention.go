@@ -0,0 +1,119 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"time"
+)
+
+// RetentionPolicy is a policy for how long events are kept in an event store.
+// Events that are older than the max age, or that are not among the latest
+// max events of their aggregate, are removed. Zero values are not enforced.
+//
+// Aggregates are only removed when all their events have expired. Otherwise
+// the expired events are only removed as far as the latest snapshot of the
+// aggregate covers them, as for TruncatableEventStore.TruncateBefore, and
+// aggregates without a snapshot keep all their events.
+type RetentionPolicy struct {
+	// MaxAge is the max age of events.
+	MaxAge time.Duration
+	// MaxEvents is the max number of events per aggregate.
+	MaxEvents int
+	// Exempt are the aggregate types that the policy does not apply to.
+	Exempt []string
+}
+
+// IsExempt returns true if the policy does not apply to an aggregate type.
+func (p RetentionPolicy) IsExempt(aggregateType string) bool {
+	for _, t := range p.Exempt {
+		if t == aggregateType {
+			return true
+		}
+	}
+	return false
+}
+
+// Expired returns true if the policy does not retain an event with a timestamp
+// at an index of the events of an aggregate, out of a number of events.
+func (p RetentionPolicy) Expired(index, events int, timestamp, now time.Time) bool {
+	return (p.MaxAge > 0 && timestamp.Before(now.Add(-p.MaxAge))) ||
+		(p.MaxEvents > 0 && index < events-p.MaxEvents)
+}
+
+// RetentionEventStore is an event store that can remove events by a retention
+// policy.
+type RetentionEventStore interface {
+	EventStore
+
+	// ApplyRetention removes the events that are not retained by a policy at
+	// a time. Aggregates without retained events are removed, other events
+	// only as far as a snapshot covers them.
+	ApplyRetention(ctx context.Context, policy RetentionPolicy, now time.Time) error
+}
+
+// RetentionJob enforces a retention policy on an event store at an interval.
+type RetentionJob struct {
+	Lifecycle
+
+	store    RetentionEventStore
+	policy   RetentionPolicy
+	interval time.Duration
+	clock    Clock
+	lock     Lock
+}
+
+// NewRetentionJob creates a RetentionJob. The clock is used for the age of
+// events and the interval.
+func NewRetentionJob(store RetentionEventStore, policy RetentionPolicy, interval time.Duration, clock Clock) *RetentionJob {
+	return &RetentionJob{
+		store:    store,
+		policy:   policy,
+		interval: interval,
+		clock:    clock,
+	}
+}
+
+// SetLock sets a lock that is held while enforcing the policy, so that only one
+// of several jobs for the same store enforces it at a time.
+func (j *RetentionJob) SetLock(lock Lock) {
+	j.lock = lock
+}
+
+// Run enforces the policy now and then at every interval, until the context
+// is done or the policy could not be enforced. If a lock is set, the policy is
+// only enforced when it could be acquired.
+func (j *RetentionJob) Run(ctx context.Context) error {
+	apply := func() error {
+		return j.store.ApplyRetention(ctx, j.policy, j.clock.Now())
+	}
+	for {
+		var err error
+		if j.lock != nil {
+			err = WithLock(j.lock, "retention", j.interval, apply)
+		} else {
+			err = apply()
+		}
+		if err != nil && err != ErrLockHeld {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-j.clock.After(j.interval):
+		}
+	}
+}
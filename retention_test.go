@@ -0,0 +1,101 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRetentionPolicyIsExempt(t *testing.T) {
+	policy := RetentionPolicy{Exempt: []string{"Invoice"}}
+	if !policy.IsExempt("Invoice") {
+		t.Error("the aggregate type should be exempt")
+	}
+	if policy.IsExempt("Invite") {
+		t.Error("the aggregate type should not be exempt")
+	}
+}
+
+func TestRetentionPolicyExpired(t *testing.T) {
+	now := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	policy := RetentionPolicy{MaxAge: time.Hour, MaxEvents: 2}
+	if !policy.Expired(1, 4, now, now) {
+		t.Error("the event should be expired by size")
+	}
+	if !policy.Expired(3, 4, now.Add(-2*time.Hour), now) {
+		t.Error("the event should be expired by age")
+	}
+	if policy.Expired(3, 4, now, now) {
+		t.Error("the event should be retained")
+	}
+}
+
+func TestRetentionJob(t *testing.T) {
+	store := &retentionEventStore{}
+	policy := RetentionPolicy{MaxAge: time.Hour}
+	clock := &tickClock{now: time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC), ticks: make(chan time.Time)}
+	job := NewRetentionJob(store, policy, time.Minute, clock)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- job.Run(ctx) }()
+
+	t.Log("enforce at every interval")
+	clock.ticks <- clock.now
+	clock.ticks <- clock.now
+	cancel()
+	if err := <-done; err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if store.applied < 3 {
+		t.Error("the policy should be enforced at every interval:", store.applied)
+	}
+	if store.policy.MaxAge != time.Hour || !store.now.Equal(clock.now) {
+		t.Error("the policy should be enforced at the time of the clock:", store.policy, store.now)
+	}
+
+	t.Log("stop on error")
+	store.err = errors.New("error")
+	if err := job.Run(context.Background()); err != store.err {
+		t.Error("the error should be returned:", err)
+	}
+}
+
+type retentionEventStore struct {
+	MockEventStore
+	applied int
+	policy  RetentionPolicy
+	now     time.Time
+	err     error
+}
+
+func (s *retentionEventStore) ApplyRetention(ctx context.Context, policy RetentionPolicy, now time.Time) error {
+	s.applied++
+	s.policy = policy
+	s.now = now
+	return s.err
+}
+
+// tickClock is a clock where After fires when a tick is sent.
+type tickClock struct {
+	now   time.Time
+	ticks chan time.Time
+}
+
+func (c *tickClock) Now() time.Time                         { return c.now }
+func (c *tickClock) After(d time.Duration) <-chan time.Time { return c.ticks }
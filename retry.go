@@ -0,0 +1,212 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand"
+	"time"
+)
+
+// ErrMaxDeliveryAttempts is when an event could not be handled in the maximum
+// number of delivery attempts.
+var ErrMaxDeliveryAttempts = errors.New("max delivery attempts reached")
+
+// FallibleEventHandler is an optional interface for event handlers that can
+// report a failure to handle an event, so that it can be retried.
+type FallibleEventHandler interface {
+	EventHandler
+
+	// TryHandleEvent handles an event with its context and returns an error
+	// if it could not be handled.
+	TryHandleEvent(context.Context, Event) error
+}
+
+// TryHandleEvent lets a handler handle an event, returning the error if the
+// handler implements FallibleEventHandler. Other handlers never fail.
+func TryHandleEvent(ctx context.Context, handler EventHandler, event Event) error {
+	if h, ok := handler.(FallibleEventHandler); ok {
+		return h.TryHandleEvent(ctx, event)
+	}
+	HandleEventWithContext(ctx, handler, event)
+	return nil
+}
+
+// Backoff is a policy for retrying failed handling of events with an
+// exponentially increasing delay.
+type Backoff struct {
+	// Attempts is the total number of attempts, including the first.
+	Attempts int
+
+	// Initial is the delay before the first retry.
+	Initial time.Duration
+
+	// Max is the longest delay between retries, 0 means no limit.
+	Max time.Duration
+
+	// Multiplier is the factor the delay grows by after each retry, the
+	// default is 2.
+	Multiplier float64
+
+	// Jitter is the fraction of each delay, between 0 and 1, that is randomly
+	// subtracted from it to spread out retries from many handlers.
+	Jitter float64
+}
+
+// DefaultBackoff makes 5 attempts, with delays from 100 ms up to 10 s.
+var DefaultBackoff = Backoff{
+	Attempts:   5,
+	Initial:    100 * time.Millisecond,
+	Max:        10 * time.Second,
+	Multiplier: 2,
+	Jitter:     0.2,
+}
+
+// Delay returns the delay before a retry, where retry 1 is the first retry.
+func (b Backoff) Delay(retry int) time.Duration {
+	multiplier := b.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+	delay := float64(b.Initial)
+	for i := 1; i < retry; i++ {
+		delay *= multiplier
+		if b.Max > 0 && delay >= float64(b.Max) {
+			break
+		}
+	}
+	if b.Max > 0 && delay > float64(b.Max) {
+		delay = float64(b.Max)
+	}
+	if b.Jitter > 0 {
+		delay -= delay * b.Jitter * rand.Float64()
+	}
+	return time.Duration(delay)
+}
+
+// RetryHandler is an event handler that retries a FallibleEventHandler with
+// exponential backoff when it fails to handle an event. When the attempts are
+// used up the event is passed to the dead letter handler, if any, with the
+// errors of the attempts in the context, see DeliveryErrorsFromContext.
+//
+// Use the RetryHandler itself when adding and removing it from buses, as it
+// is not equal to the handler it wraps.
+type RetryHandler struct {
+	handler    EventHandler
+	backoff    Backoff
+	deadLetter EventHandler
+	clock      Clock
+}
+
+// NewRetryHandler creates a new RetryHandler, which retries a handler with a
+// backoff policy. The clock is used to wait between retries.
+func NewRetryHandler(handler EventHandler, backoff Backoff, clock Clock) *RetryHandler {
+	return &RetryHandler{
+		handler: handler,
+		backoff: backoff,
+		clock:   clock,
+	}
+}
+
+// NewQuarantineHandler creates a new RetryHandler that parks events which
+// still fail after the attempts of the backoff in a dead letter store, with
+// the errors of the attempts. The handler then goes on with the next event, so
+// that a poison event does not block the ones after it. The clock is used for
+// the retries and the dead letters.
+func NewQuarantineHandler(handler EventHandler, backoff Backoff, store DeadLetterStore, clock Clock) *RetryHandler {
+	h := NewRetryHandler(handler, backoff, clock)
+	h.SetDeadLetterHandler(NewDeadLetterHandler(store, ErrMaxDeliveryAttempts.Error(), clock))
+	return h
+}
+
+// IsRetryHandler returns true if a handler is a RetryHandler, also when it is
+// wrapped with middleware by a bus, see HandlerMiddleware. Buses that retry
+// handlers use it to not retry them twice.
+func IsRetryHandler(handler EventHandler) bool {
+	if h, ok := handler.(*middlewareHandler); ok {
+		handler = h.wrapped
+	}
+	_, ok := handler.(*RetryHandler)
+	return ok
+}
+
+// RetryMiddleware returns a handler middleware that retries handlers with a
+// backoff policy, using a clock to wait between retries.
+func RetryMiddleware(backoff Backoff, clock Clock) EventHandlerMiddleware {
+	return func(handler EventHandler) EventHandler {
+		return NewRetryHandler(handler, backoff, clock)
+	}
+}
+
+// SetDeadLetterHandler sets the handler of events that could not be handled
+// after all attempts.
+func (h *RetryHandler) SetDeadLetterHandler(deadLetter EventHandler) {
+	h.deadLetter = deadLetter
+}
+
+// HandlerName implements the HandlerName method of the NamedEventHandler
+// interface, using the name of the wrapped handler.
+func (h *RetryHandler) HandlerName() string {
+	return HandlerName(h.handler)
+}
+
+// HandleEvent implements the HandleEvent method of the EventHandler interface.
+func (h *RetryHandler) HandleEvent(event Event) {
+	h.HandleEventWithContext(context.Background(), event)
+}
+
+// HandleEventWithContext handles an event, logging it if it could not be
+// handled.
+func (h *RetryHandler) HandleEventWithContext(ctx context.Context, event Event) {
+	if err := h.TryHandleEvent(ctx, event); err != nil {
+		log.Printf("error: retry handler: could not handle %s: %v\n", event.EventType(), err)
+	}
+}
+
+// TryHandleEvent implements the TryHandleEvent method of the
+// FallibleEventHandler interface. It returns an EventError with
+// ErrMaxDeliveryAttempts and the last error of the handler if all attempts
+// failed, or the error of the context if it was done while waiting to retry.
+func (h *RetryHandler) TryHandleEvent(ctx context.Context, event Event) error {
+	var errs []error
+	for attempt := 1; ; attempt++ {
+		err := TryHandleEvent(ctx, h.handler, event)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+		if attempt >= h.backoff.Attempts {
+			break
+		}
+
+		select {
+		case <-h.clock.After(h.backoff.Delay(attempt)):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if h.deadLetter != nil {
+		HandleEventWithContext(NewContextWithDeliveryErrors(ctx, errs), h.deadLetter, event)
+	}
+	return &EventError{
+		Err:         ErrMaxDeliveryAttempts,
+		Cause:       errs[len(errs)-1],
+		EventType:   event.EventType(),
+		AggregateID: event.AggregateID(),
+	}
+}
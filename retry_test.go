@@ -0,0 +1,172 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	backoff := Backoff{Initial: time.Second, Max: 5 * time.Second}
+	var delays []time.Duration
+	for retry := 1; retry <= 5; retry++ {
+		delays = append(delays, backoff.Delay(retry))
+	}
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	if !reflect.DeepEqual(delays, expected) {
+		t.Error("the delays should be correct:", delays)
+	}
+
+	t.Log("with jitter")
+	backoff.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if d := backoff.Delay(2); d <= time.Second || d > 2*time.Second {
+			t.Fatal("the delay should be within the jitter:", d)
+		}
+	}
+}
+
+func TestRetryHandler(t *testing.T) {
+	errFailed := errors.New("failed")
+	inner := &failingHandler{failures: 2, err: errFailed}
+	clock := &delayClock{}
+	h := NewRetryHandler(inner, Backoff{Attempts: 3, Initial: time.Second}, clock)
+	deadLetter := &failingHandler{}
+	h.SetDeadLetterHandler(deadLetter)
+
+	event := &TestEvent{NewUUID(), "event1"}
+	if err := h.TryHandleEvent(context.Background(), event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if inner.calls != 3 {
+		t.Error("the handler should be called 3 times:", inner.calls)
+	}
+	if !reflect.DeepEqual(clock.delays, []time.Duration{time.Second, 2 * time.Second}) {
+		t.Error("the delays should be correct:", clock.delays)
+	}
+	if deadLetter.calls != 0 {
+		t.Error("there should be no dead letter")
+	}
+
+	t.Log("give up after all attempts")
+	inner.calls, inner.failures = 0, 5
+	err := h.TryHandleEvent(context.Background(), event)
+	if !errors.Is(err, ErrMaxDeliveryAttempts) || !errors.Is(err, errFailed) {
+		t.Error("the error should be correct:", err)
+	}
+	if inner.calls != 3 {
+		t.Error("the handler should be called 3 times:", inner.calls)
+	}
+	if deadLetter.calls != 1 {
+		t.Error("the event should be a dead letter")
+	}
+
+	t.Log("stop when the context is done")
+	inner.calls, inner.failures = 0, 5
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	h2 := NewRetryHandler(inner, Backoff{Attempts: 3, Initial: time.Second}, &tickClock{})
+	if err := h2.TryHandleEvent(ctx, event); err != context.Canceled {
+		t.Error("the error should be correct:", err)
+	}
+	if inner.calls != 1 {
+		t.Error("the handler should be called once:", inner.calls)
+	}
+
+	t.Log("handlers that can't fail are not retried")
+	calls := 0
+	plain := EventHandlerFunc(func(Event) { calls++ })
+	if err := NewRetryHandler(plain, Backoff{Attempts: 3}, clock).TryHandleEvent(context.Background(), event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if calls != 1 {
+		t.Error("the handler should be called once:", calls)
+	}
+	if HandlerName(h) != "*eventhorizon.failingHandler" {
+		t.Error("the handler name should be correct:", HandlerName(h))
+	}
+}
+
+func TestQuarantineHandler(t *testing.T) {
+	inner := &failingHandler{failures: 5, err: errors.New("failed")}
+	store := &deadLetterStore{}
+	h := NewQuarantineHandler(inner, Backoff{Attempts: 2}, store, &delayClock{})
+
+	event1 := &TestEvent{NewUUID(), "event1"}
+	h.HandleEvent(event1)
+	if len(store.deadLetters) != 1 {
+		t.Fatal("there should be a dead letter:", store.deadLetters)
+	}
+	d := store.deadLetters[0]
+	if d.Event != event1 || d.Reason != ErrMaxDeliveryAttempts.Error() {
+		t.Error("the dead letter should be correct:", d)
+	}
+	if !reflect.DeepEqual(d.Errors, []string{"failed", "failed"}) {
+		t.Error("the dead letter errors should be correct:", d.Errors)
+	}
+
+	t.Log("handle the next event")
+	inner.calls, inner.failures = 0, 0
+	h.HandleEvent(&TestEvent{NewUUID(), "event2"})
+	if inner.calls != 1 || len(store.deadLetters) != 1 {
+		t.Error("the next event should be handled:", inner.calls, store.deadLetters)
+	}
+}
+
+type deadLetterStore struct {
+	DeadLetterStore
+	deadLetters []*DeadLetter
+}
+
+func (s *deadLetterStore) SaveDeadLetter(ctx context.Context, d *DeadLetter) error {
+	s.deadLetters = append(s.deadLetters, d)
+	return nil
+}
+
+type failingHandler struct {
+	failures int
+	err      error
+	calls    int
+}
+
+func (h *failingHandler) HandleEvent(event Event) {
+	h.calls++
+}
+
+func (h *failingHandler) TryHandleEvent(ctx context.Context, event Event) error {
+	h.calls++
+	if h.calls <= h.failures {
+		return h.err
+	}
+	return nil
+}
+
+// delayClock records the delays waited for and returns at once.
+type delayClock struct {
+	delays []time.Duration
+}
+
+func (c *delayClock) Now() time.Time { return time.Time{} }
+
+func (c *delayClock) After(d time.Duration) <-chan time.Time {
+	c.delays = append(c.delays, d)
+	ch := make(chan time.Time, 1)
+	ch <- time.Time{}
+	return ch
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"errors"
+)
+
+// ErrSagaStateNotFound is when no saga state can be found.
+var ErrSagaStateNotFound = errors.New("could not find saga state")
+
+// ErrSagaVersionConflict is when a saga state could not be saved because it
+// has been saved by someone else since it was loaded.
+var ErrSagaVersionConflict = errors.New("saga state version conflict")
+
+// SagaState is the state of a saga instance, keyed by the correlation ID of
+// the flow that it manages. The version is used for optimistic locking, and is
+// 0 for a state that has not been saved.
+type SagaState struct {
+	CorrelationID string
+	Version       int
+	State         interface{}
+}
+
+// SagaStateStore is a storage of saga states, so that sagas survive restarts
+// and can run on several instances.
+type SagaStateStore interface {
+	// LoadSagaState loads the state of a saga. Returns ErrSagaStateNotFound if
+	// there is none.
+	LoadSagaState(correlationID string) (*SagaState, error)
+
+	// SaveSagaState saves the state of a saga if it has not been saved since
+	// it was loaded, and increments its version. Returns
+	// ErrSagaVersionConflict otherwise, in which case the state should be
+	// loaded again and the change retried.
+	SaveSagaState(*SagaState) error
+
+	// RemoveSagaState removes the state of a finished saga. Returns
+	// ErrSagaStateNotFound if there is none.
+	RemoveSagaState(correlationID string) error
+}
@@ -0,0 +1,122 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"sync/atomic"
+)
+
+// HeaderShadow is the header set to "true" on events mirrored to a shadow bus
+// by an EventMirror.
+const HeaderShadow = "shadow"
+
+// EventMirror mirrors a sample of the published events to a shadow bus, for
+// example a bus of a staging namespace, so that new projections can be load
+// tested with production traffic without touching the production read models.
+//
+// Events are sampled by aggregate, so that the shadow bus gets all the events
+// of the sampled aggregates and projections of them stay consistent. Mirrored
+// events are published with the HeaderShadow header, which is only sent by
+// shadow buses that implement ContextEventPublisher.
+type EventMirror struct {
+	shadow   EventBus
+	rate     float64
+	types    map[string]bool
+	mirrored atomic.Uint64
+}
+
+// NewEventMirror creates a new EventMirror that mirrors the events of a rate of
+// the aggregates, between 0 and 1, to a shadow bus.
+func NewEventMirror(shadow EventBus, rate float64) *EventMirror {
+	return &EventMirror{
+		shadow: shadow,
+		rate:   rate,
+	}
+}
+
+// SetEvents limits the mirroring to events of the types of the events. All
+// events are mirrored by default.
+func (m *EventMirror) SetEvents(events ...Event) {
+	m.types = make(map[string]bool, len(events))
+	for _, event := range events {
+		m.types[event.EventType()] = true
+	}
+}
+
+// Mirrored returns the number of mirrored events.
+func (m *EventMirror) Mirrored() uint64 {
+	return m.mirrored.Load()
+}
+
+// Sampled returns true if the event is mirrored.
+func (m *EventMirror) Sampled(event Event) bool {
+	if len(m.types) > 0 && !m.types[event.EventType()] {
+		return false
+	}
+	h := fnv.New32a()
+	h.Write([]byte(event.AggregateID()))
+	return float64(h.Sum32()) < m.rate*(math.MaxUint32+1)
+}
+
+// Middleware returns an event bus middleware that publishes all events on the
+// bus and the sampled events also on the shadow bus, after the bus.
+func (m *EventMirror) Middleware() EventBusMiddleware {
+	return func(bus EventBus) EventBus {
+		return &mirrorBus{bus, m}
+	}
+}
+
+func (m *EventMirror) mirror(ctx context.Context, event Event) {
+	if !m.Sampled(event) {
+		return
+	}
+	headers := Headers{}
+	for k, v := range HeadersFromContext(ctx) {
+		headers[k] = v
+	}
+	headers[HeaderShadow] = "true"
+	PublishEventWithContext(NewContextWithHeaders(ctx, headers), m.shadow, event)
+	m.mirrored.Add(1)
+}
+
+type mirrorBus struct {
+	EventBus
+	mirror *EventMirror
+}
+
+// PublishEvent implements the PublishEvent method of the EventBus interface.
+func (b *mirrorBus) PublishEvent(event Event) {
+	b.EventBus.PublishEvent(event)
+	b.mirror.mirror(context.Background(), event)
+}
+
+// PublishEventWithContext implements the PublishEventWithContext method of the
+// ContextEventPublisher interface.
+func (b *mirrorBus) PublishEventWithContext(ctx context.Context, event Event) {
+	PublishEventWithContext(ctx, b.EventBus, event)
+	b.mirror.mirror(ctx, event)
+}
+
+// PublishEvents implements the PublishEvents method of the EventBatchPublisher
+// interface.
+func (b *mirrorBus) PublishEvents(events []Event) {
+	PublishEvents(b.EventBus, events)
+	for _, event := range events {
+		b.mirror.mirror(context.Background(), event)
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"testing"
+)
+
+func TestEventMirror(t *testing.T) {
+	primary := &contextBus{}
+	shadow := &contextBus{}
+	mirror := NewEventMirror(shadow, 1)
+	bus := UseEventBusMiddleware(primary, mirror.Middleware())
+
+	t.Log("mirror all events")
+	ctx := NewContextWithHeaders(context.Background(), Headers{HeaderCorrelationID: "abc"})
+	PublishEventWithContext(ctx, bus, &TestEvent{NewUUID(), "event1"})
+	if len(primary.headers) != 1 || primary.headers[0][HeaderShadow] != "" {
+		t.Error("the event should be published on the bus:", primary.headers)
+	}
+	if len(shadow.headers) != 1 {
+		t.Fatal("the event should be mirrored:", shadow.headers)
+	}
+	if shadow.headers[0][HeaderShadow] != "true" || shadow.headers[0][HeaderCorrelationID] != "abc" {
+		t.Error("the headers should be correct:", shadow.headers[0])
+	}
+
+	t.Log("mirror only events of some types")
+	mirror.SetEvents(&TestEvent2{})
+	PublishEvents(bus, []Event{&TestEvent{NewUUID(), "event2"}, &TestEvent2{NewUUID(), "event3"}})
+	if len(primary.headers) != 3 {
+		t.Error("the events should be published on the bus:", primary.headers)
+	}
+	if len(shadow.headers) != 2 || mirror.Mirrored() != 2 {
+		t.Error("only the event of the type should be mirrored:", shadow.headers)
+	}
+
+	t.Log("sample by aggregate")
+	mirror = NewEventMirror(shadow, 0.5)
+	sampled := 0
+	for i := 0; i < 1000; i++ {
+		id := NewUUID()
+		first := mirror.Sampled(&TestEvent{id, "event"})
+		if mirror.Sampled(&TestEvent2{id, "event"}) != first {
+			t.Fatal("all events of an aggregate should be sampled the same")
+		}
+		if first {
+			sampled++
+		}
+	}
+	if sampled < 400 || sampled > 600 {
+		t.Error("about half of the aggregates should be sampled:", sampled)
+	}
+	if NewEventMirror(shadow, 0).Sampled(&TestEvent{NewUUID(), "event"}) {
+		t.Error("no events should be sampled with a zero rate")
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrSnapshotNotFound is when no snapshot can be found.
+var ErrSnapshotNotFound = errors.New("could not find snapshot")
+
+// ErrNoNewerSnapshot is when events would be truncated without a snapshot
+// that covers them.
+var ErrNoNewerSnapshot = errors.New("no newer snapshot")
+
+// Snapshot is the state of an aggregate at a version.
+type Snapshot struct {
+	AggregateID   UUID
+	AggregateType string
+	Version       int
+	Timestamp     time.Time
+	State         interface{}
+}
+
+// SnapshotStore is a store for snapshots of aggregates.
+type SnapshotStore interface {
+	// SaveSnapshot saves a snapshot, replacing any older one.
+	SaveSnapshot(*Snapshot) error
+
+	// LoadSnapshot loads the latest snapshot of an aggregate. Returns
+	// ErrSnapshotNotFound if there is none.
+	LoadSnapshot(UUID) (*Snapshot, error)
+}
+
+// SnapshotAggregate is an aggregate that can be restored from snapshots by a
+// repository, instead of applying all of its events.
+type SnapshotAggregate interface {
+	Aggregate
+
+	// ApplySnapshot restores the state of the aggregate from a snapshot. The
+	// version is restored by the repository.
+	ApplySnapshot(*Snapshot) error
+}
+
+// SnapshotEventStore is an event store that can load the events of an
+// aggregate that are newer than a snapshot.
+type SnapshotEventStore interface {
+	EventStore
+
+	// LoadAfter loads the events of an aggregate that follow its state at a
+	// version, which are the events that a snapshot of that version doesn't
+	// cover. Returns ErrNoEventsFound if the aggregate has no events.
+	LoadAfter(UUID, int) ([]Event, error)
+}
+
+// TruncatableEventStore is an event store that can remove events.
+type TruncatableEventStore interface {
+	EventStore
+
+	// TruncateBefore removes the events of an aggregate before a version. A
+	// snapshot of at least that version must exist, or ErrNoNewerSnapshot is
+	// returned. Truncated aggregates must be loaded by a repository with the
+	// snapshot store, see CallbackRepository.SetSnapshotStore.
+	TruncateBefore(UUID, int) error
+
+	// Purge removes all events of an aggregate, for example for legal
+	// deletion requests. This can't be undone.
+	Purge(UUID) error
+}
+
+// CheckSnapshot returns ErrNoNewerSnapshot unless there is a snapshot of the
+// aggregate with at least the version, for stores to check before truncating.
+func CheckSnapshot(snapshotStore SnapshotStore, id UUID, version int) error {
+	if snapshotStore == nil {
+		return ErrNoNewerSnapshot
+	}
+	snapshot, err := snapshotStore.LoadSnapshot(id)
+	if err == ErrSnapshotNotFound {
+		return ErrNoNewerSnapshot
+	} else if err != nil {
+		return err
+	}
+	if snapshot.Version < version {
+		return ErrNoNewerSnapshot
+	}
+	return nil
+}
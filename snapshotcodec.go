@@ -0,0 +1,208 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrSnapshotStateNotRegistered is when the state of a snapshot has no
+// registered type for its aggregate type and version.
+var ErrSnapshotStateNotRegistered = errors.New("snapshot state not registered")
+
+// ErrNoSnapshotMigration is when the state of a snapshot is of an old version
+// without a migration to the next one.
+var ErrNoSnapshotMigration = errors.New("no snapshot migration")
+
+// SnapshotCodec is a codec for marshaling the states of snapshots to and from
+// bytes. It is separate from the codecs of events, as the states of aggregates
+// change independently of their events.
+type SnapshotCodec interface {
+	// MarshalState marshals a state into bytes.
+	MarshalState(interface{}) ([]byte, error)
+
+	// UnmarshalState unmarshals bytes into a state, which is created by a
+	// factory registered with a SnapshotSerializer.
+	UnmarshalState([]byte, interface{}) error
+}
+
+// JSONSnapshotCodec is a SnapshotCodec that marshals states to JSON.
+type JSONSnapshotCodec struct{}
+
+// MarshalState implements the MarshalState method of the SnapshotCodec
+// interface.
+func (JSONSnapshotCodec) MarshalState(state interface{}) ([]byte, error) {
+	return json.Marshal(state)
+}
+
+// UnmarshalState implements the UnmarshalState method of the SnapshotCodec
+// interface.
+func (JSONSnapshotCodec) UnmarshalState(data []byte, state interface{}) error {
+	return json.Unmarshal(data, state)
+}
+
+// GobSnapshotCodec is a SnapshotCodec that marshals states with encoding/gob,
+// which also handles unexported state structs.
+type GobSnapshotCodec struct{}
+
+// MarshalState implements the MarshalState method of the SnapshotCodec
+// interface.
+func (GobSnapshotCodec) MarshalState(state interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	if err := gob.NewEncoder(&b).Encode(state); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// UnmarshalState implements the UnmarshalState method of the SnapshotCodec
+// interface.
+func (GobSnapshotCodec) UnmarshalState(data []byte, state interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(state)
+}
+
+// SerializedSnapshot is a snapshot with its state marshaled, for snapshot
+// stores that persist snapshots. The state version is the version of the
+// state type, not of the aggregate.
+type SerializedSnapshot struct {
+	AggregateID   UUID
+	AggregateType string
+	Version       int
+	Timestamp     time.Time
+	StateVersion  int
+	State         []byte
+}
+
+// SnapshotMigration migrates the state of a snapshot from a version of its
+// type to the next one.
+type SnapshotMigration func(state interface{}) (interface{}, error)
+
+// SnapshotSerializer marshals the states of snapshots with a codec, tagged
+// with the version of their state types. The state types are registered per
+// aggregate type and version, and states of older versions are migrated to
+// the latest one when unmarshaled.
+type SnapshotSerializer struct {
+	codec      SnapshotCodec
+	factories  map[string]map[int]func() interface{}
+	latest     map[string]int
+	migrations map[string]map[int]SnapshotMigration
+	mu         sync.RWMutex
+}
+
+// NewSnapshotSerializer creates a SnapshotSerializer with a codec.
+func NewSnapshotSerializer(codec SnapshotCodec) *SnapshotSerializer {
+	return &SnapshotSerializer{
+		codec:      codec,
+		factories:  make(map[string]map[int]func() interface{}),
+		latest:     make(map[string]int),
+		migrations: make(map[string]map[int]SnapshotMigration),
+	}
+}
+
+// RegisterState registers a factory of the state type of an aggregate type at
+// a version. The highest registered version is the one that states are
+// marshaled as.
+//
+// An example would be:
+//     serializer.RegisterState("User", 2, func() interface{} { return &UserStateV2{} })
+func (s *SnapshotSerializer) RegisterState(aggregateType string, version int, factory func() interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.factories[aggregateType] == nil {
+		s.factories[aggregateType] = make(map[int]func() interface{})
+	}
+	s.factories[aggregateType][version] = factory
+	if version > s.latest[aggregateType] {
+		s.latest[aggregateType] = version
+	}
+}
+
+// RegisterMigration registers a migration of the state of an aggregate type
+// from a version to the next one.
+func (s *SnapshotSerializer) RegisterMigration(aggregateType string, from int, migration SnapshotMigration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.migrations[aggregateType] == nil {
+		s.migrations[aggregateType] = make(map[int]SnapshotMigration)
+	}
+	s.migrations[aggregateType][from] = migration
+}
+
+// Marshal marshals a snapshot, tagged with the latest state version of its
+// aggregate type. Returns ErrSnapshotStateNotRegistered if the aggregate type
+// has no registered state.
+func (s *SnapshotSerializer) Marshal(snapshot *Snapshot) (*SerializedSnapshot, error) {
+	s.mu.RLock()
+	version, ok := s.latest[snapshot.AggregateType]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, ErrSnapshotStateNotRegistered
+	}
+
+	data, err := s.codec.MarshalState(snapshot.State)
+	if err != nil {
+		return nil, err
+	}
+	return &SerializedSnapshot{
+		AggregateID:   snapshot.AggregateID,
+		AggregateType: snapshot.AggregateType,
+		Version:       snapshot.Version,
+		Timestamp:     snapshot.Timestamp,
+		StateVersion:  version,
+		State:         data,
+	}, nil
+}
+
+// Unmarshal unmarshals a snapshot and migrates its state to the latest
+// version. Returns ErrSnapshotStateNotRegistered if the state version has no
+// registered type, or ErrNoSnapshotMigration if a migration is missing.
+func (s *SnapshotSerializer) Unmarshal(serialized *SerializedSnapshot) (*Snapshot, error) {
+	s.mu.RLock()
+	factory, ok := s.factories[serialized.AggregateType][serialized.StateVersion]
+	latest := s.latest[serialized.AggregateType]
+	migrations := s.migrations[serialized.AggregateType]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, ErrSnapshotStateNotRegistered
+	}
+
+	state := factory()
+	if err := s.codec.UnmarshalState(serialized.State, state); err != nil {
+		return nil, err
+	}
+	for version := serialized.StateVersion; version < latest; version++ {
+		migration, ok := migrations[version]
+		if !ok {
+			return nil, ErrNoSnapshotMigration
+		}
+		var err error
+		if state, err = migration(state); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Snapshot{
+		AggregateID:   serialized.AggregateID,
+		AggregateType: serialized.AggregateType,
+		Version:       serialized.Version,
+		Timestamp:     serialized.Timestamp,
+		State:         state,
+	}, nil
+}
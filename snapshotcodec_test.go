@@ -0,0 +1,114 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type snapshotStateV1 struct {
+	Name string
+}
+
+type snapshotStateV2 struct {
+	FirstName string
+	LastName  string
+}
+
+func TestSnapshotSerializer(t *testing.T) {
+	for name, codec := range map[string]SnapshotCodec{
+		"json": JSONSnapshotCodec{},
+		"gob":  GobSnapshotCodec{},
+	} {
+		t.Run(name, func(t *testing.T) {
+			testSnapshotSerializer(t, codec)
+		})
+	}
+}
+
+func testSnapshotSerializer(t *testing.T, codec SnapshotCodec) {
+	serializer := NewSnapshotSerializer(codec)
+	id := NewUUID()
+	now := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Log("marshal an unregistered state")
+	snapshot := &Snapshot{AggregateID: id, AggregateType: "User", Version: 3, Timestamp: now,
+		State: &snapshotStateV1{Name: "Ada Lovelace"}}
+	if _, err := serializer.Marshal(snapshot); err != ErrSnapshotStateNotRegistered {
+		t.Error("there should be a ErrSnapshotStateNotRegistered error:", err)
+	}
+
+	t.Log("marshal and unmarshal a state")
+	serializer.RegisterState("User", 1, func() interface{} { return &snapshotStateV1{} })
+	serialized, err := serializer.Marshal(snapshot)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if serialized.StateVersion != 1 {
+		t.Error("the state version should be tagged:", serialized.StateVersion)
+	}
+	unmarshaled, err := serializer.Unmarshal(serialized)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(unmarshaled, snapshot) {
+		t.Error("the snapshot should be correct:", unmarshaled)
+	}
+
+	t.Log("unmarshal an old state without a migration")
+	serializer.RegisterState("User", 2, func() interface{} { return &snapshotStateV2{} })
+	if _, err := serializer.Unmarshal(serialized); err != ErrNoSnapshotMigration {
+		t.Error("there should be a ErrNoSnapshotMigration error:", err)
+	}
+
+	t.Log("migrate an old state")
+	serializer.RegisterMigration("User", 1, func(state interface{}) (interface{}, error) {
+		s := state.(*snapshotStateV1)
+		first, last := s.Name, ""
+		for i, c := range s.Name {
+			if c == ' ' {
+				first, last = s.Name[:i], s.Name[i+1:]
+				break
+			}
+		}
+		return &snapshotStateV2{FirstName: first, LastName: last}, nil
+	})
+	unmarshaled, err = serializer.Unmarshal(serialized)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	expected := &snapshotStateV2{FirstName: "Ada", LastName: "Lovelace"}
+	if !reflect.DeepEqual(unmarshaled.State, expected) {
+		t.Error("the state should be migrated:", unmarshaled.State)
+	}
+
+	t.Log("migration error")
+	migrationErr := errors.New("error")
+	serializer.RegisterMigration("User", 1, func(state interface{}) (interface{}, error) {
+		return nil, migrationErr
+	})
+	if _, err := serializer.Unmarshal(serialized); err != migrationErr {
+		t.Error("the migration error should be returned:", err)
+	}
+
+	t.Log("unmarshal an unregistered version")
+	serialized.StateVersion = 5
+	if _, err := serializer.Unmarshal(serialized); err != ErrSnapshotStateNotRegistered {
+		t.Error("there should be a ErrSnapshotStateNotRegistered error:", err)
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EventStats are statistics of the events in an event store, for example to
+// spot aggregates with unbounded streams.
+type EventStats struct {
+	Events     int
+	Aggregates int
+
+	// EventTypes and AggregateTypes are the number of events by type.
+	EventTypes     map[string]int
+	AggregateTypes map[string]int
+
+	// Buckets are the number of events by the start of their time bucket.
+	Buckets map[time.Time]int
+
+	// LargestStreams are the streams with the most events, largest first.
+	LargestStreams []StreamInfo
+}
+
+// StatsEventStore is an event store that can compute statistics of its events
+// itself, for example in the database.
+type StatsEventStore interface {
+	InspectableEventStore
+
+	// EventStats returns the statistics of all events, with events counted in
+	// time buckets of a size, if not 0, and up to top of the largest streams.
+	EventStats(ctx context.Context, bucket time.Duration, top int) (*EventStats, error)
+}
+
+// CollectStats returns the statistics of all events in a store, with events
+// counted in time buckets of a size, if not 0, and up to top of the largest
+// streams. The statistics are computed by the store if it implements
+// StatsEventStore, otherwise all streams are loaded.
+func CollectStats(ctx context.Context, store InspectableEventStore, bucket time.Duration, top int) (*EventStats, error) {
+	if s, ok := store.(StatsEventStore); ok {
+		return s.EventStats(ctx, bucket, top)
+	}
+
+	streams, err := store.Streams(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &EventStats{
+		Aggregates:     len(streams),
+		EventTypes:     map[string]int{},
+		AggregateTypes: map[string]int{},
+		Buckets:        map[time.Time]int{},
+	}
+	for _, stream := range streams {
+		events, err := store.LoadStored(ctx, stream.AggregateID)
+		if err != nil {
+			return nil, err
+		}
+		for _, event := range events {
+			stats.Events++
+			stats.EventTypes[event.Type]++
+			stats.AggregateTypes[event.AggregateType]++
+			if bucket > 0 {
+				stats.Buckets[event.Timestamp.UTC().Truncate(bucket)]++
+			}
+		}
+	}
+
+	sort.SliceStable(streams, func(i, j int) bool {
+		return streams[i].Events > streams[j].Events
+	})
+	if top < len(streams) {
+		streams = streams[:top]
+	}
+	stats.LargestStreams = streams
+	return stats, nil
+}
+
+// ComponentStats is a snapshot of the runtime statistics of a component, such
+// as a bus, a store or a runner of projections, for applications to expose
+// however they like.
+type ComponentStats struct {
+	// Events is the number of events published, saved or handled, and Errors
+	// the number of failures.
+	Events uint64
+	Errors uint64
+
+	// QueueDepth is the number of events waiting, always 0 for components
+	// without queues.
+	QueueDepth int
+
+	// LastEvent is the time of the last event, zero if there was none.
+	LastEvent time.Time
+
+	// Throughput is the average number of events per second since the
+	// component was created.
+	Throughput float64
+}
+
+// StatsProvider is a component with runtime statistics.
+type StatsProvider interface {
+	// Stats returns a snapshot of the statistics of the component.
+	Stats() ComponentStats
+}
+
+// StatsCounter counts the events and errors of a component for its
+// ComponentStats. It is safe for concurrent use.
+type StatsCounter struct {
+	events atomic.Uint64
+	errors atomic.Uint64
+	last   atomic.Int64 // In Unix nanoseconds.
+	clock  Clock
+	start  time.Time
+	mu     sync.RWMutex
+}
+
+// NewStatsCounter creates a StatsCounter, with a clock for the times of events
+// and the throughput.
+func NewStatsCounter(clock Clock) *StatsCounter {
+	c := &StatsCounter{}
+	c.SetClock(clock)
+	return c
+}
+
+// SetClock sets the clock used for the times of events and the throughput,
+// and restarts the throughput from now.
+func (c *StatsCounter) SetClock(clock Clock) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.clock = clock
+	c.start = clock.Now()
+}
+
+// AddEvents counts a number of events at the current time.
+func (c *StatsCounter) AddEvents(n int) {
+	if n <= 0 {
+		return
+	}
+	c.mu.RLock()
+	now := c.clock.Now()
+	c.mu.RUnlock()
+	c.events.Add(uint64(n))
+	c.last.Store(now.UnixNano())
+}
+
+// AddError counts an error.
+func (c *StatsCounter) AddError() {
+	c.errors.Add(1)
+}
+
+// Stats returns the stats of the counted events and errors, with a queue
+// depth of 0.
+func (c *StatsCounter) Stats() ComponentStats {
+	c.mu.RLock()
+	elapsed := c.clock.Now().Sub(c.start)
+	c.mu.RUnlock()
+
+	stats := ComponentStats{
+		Events: c.events.Load(),
+		Errors: c.errors.Load(),
+	}
+	if last := c.last.Load(); last != 0 {
+		stats.LastEvent = time.Unix(0, last).UTC()
+	}
+	if elapsed > 0 {
+		stats.Throughput = float64(stats.Events) / elapsed.Seconds()
+	}
+	return stats
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCollectStats(t *testing.T) {
+	now := time.Date(2016, 1, 1, 12, 0, 0, 0, time.UTC)
+	id1, id2 := NewUUID(), NewUUID()
+	store := &mockInspectableEventStore{
+		streams: []StreamInfo{
+			{AggregateID: id1, AggregateType: "Test", Version: 1, Events: 1},
+			{AggregateID: id2, AggregateType: "Test", Version: 2, Events: 2},
+		},
+		events: map[UUID][]StoredEvent{
+			id1: {
+				{Type: "TestEvent", AggregateType: "Test", Timestamp: now},
+			},
+			id2: {
+				{Type: "TestEvent", AggregateType: "Test", Timestamp: now},
+				{Type: "OtherEvent", AggregateType: "Test", Timestamp: now.Add(24 * time.Hour)},
+			},
+		},
+	}
+
+	stats, err := CollectStats(context.Background(), store, 24*time.Hour, 1)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	expected := &EventStats{
+		Events:         3,
+		Aggregates:     2,
+		EventTypes:     map[string]int{"TestEvent": 2, "OtherEvent": 1},
+		AggregateTypes: map[string]int{"Test": 3},
+		Buckets: map[time.Time]int{
+			time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC): 2,
+			time.Date(2016, 1, 2, 0, 0, 0, 0, time.UTC): 1,
+		},
+		LargestStreams: []StreamInfo{store.streams[1]},
+	}
+	if !reflect.DeepEqual(stats, expected) {
+		t.Error("the stats should be correct:", stats)
+	}
+}
+
+type mockInspectableEventStore struct {
+	InspectableEventStore
+	streams []StreamInfo
+	events  map[UUID][]StoredEvent
+}
+
+func (s *mockInspectableEventStore) Streams(ctx context.Context) ([]StreamInfo, error) {
+	return append([]StreamInfo{}, s.streams...), nil
+}
+
+func (s *mockInspectableEventStore) LoadStored(ctx context.Context, id UUID) ([]StoredEvent, error) {
+	return s.events[id], nil
+}
+
+func TestStatsCounter(t *testing.T) {
+	now := time.Date(2016, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := &tickClock{now: now}
+	counter := NewStatsCounter(clock)
+
+	t.Log("no events")
+	if stats := counter.Stats(); !reflect.DeepEqual(stats, ComponentStats{}) {
+		t.Error("the stats should be empty:", stats)
+	}
+
+	t.Log("count events and errors")
+	clock.now = now.Add(time.Second)
+	counter.AddEvents(2)
+	clock.now = now.Add(2 * time.Second)
+	counter.AddEvents(2)
+	counter.AddError()
+	expected := ComponentStats{
+		Events:     4,
+		Errors:     1,
+		LastEvent:  now.Add(2 * time.Second),
+		Throughput: 2,
+	}
+	if stats := counter.Stats(); !reflect.DeepEqual(stats, expected) {
+		t.Error("the stats should be correct:", stats)
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bleve
+
+import (
+	"context"
+	"errors"
+
+	"github.com/blevesearch/bleve/v2"
+
+	"github.com/looplab/eventhorizon"
+)
+
+// ErrCouldNotIndexModel is when a read model could not be indexed.
+var ErrCouldNotIndexModel = errors.New("could not index model")
+
+// ReadRepository is a read repository that indexes string fields of the read
+// models saved to another read repository in a Bleve index, for full-text
+// search without an external search engine. The models are stored and found
+// by the other repository.
+type ReadRepository struct {
+	eventhorizon.ReadRepository
+	index  bleve.Index
+	fields []string
+}
+
+// NewReadRepository creates a new ReadRepository that indexes fields of the
+// models of a repository, named as in an eventhorizon.ModelQuery. The index is
+// created at a path, or opened if it exists, or kept in memory if the path is
+// empty.
+func NewReadRepository(repo eventhorizon.ReadRepository, path string, fields ...string) (*ReadRepository, error) {
+	var index bleve.Index
+	var err error
+	if path == "" {
+		index, err = bleve.NewMemOnly(bleve.NewIndexMapping())
+	} else {
+		index, err = bleve.Open(path)
+		if err == bleve.ErrorIndexPathDoesNotExist {
+			index, err = bleve.New(path, bleve.NewIndexMapping())
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	r := &ReadRepository{
+		ReadRepository: repo,
+		index:          index,
+		fields:         fields,
+	}
+	return r, nil
+}
+
+// Save saves a read model to the repository and indexes it.
+func (r *ReadRepository) Save(id eventhorizon.UUID, model interface{}) error {
+	if err := r.ReadRepository.Save(id, model); err != nil {
+		return err
+	}
+
+	doc := map[string]interface{}{}
+	for _, field := range r.fields {
+		if value, ok := eventhorizon.FieldValue(model, field); ok {
+			if s, ok := value.(string); ok {
+				doc[field] = s
+			}
+		}
+	}
+	if err := r.index.Index(id.String(), doc); err != nil {
+		return ErrCouldNotIndexModel
+	}
+	return nil
+}
+
+// Remove removes a read model from the repository and the index.
+func (r *ReadRepository) Remove(id eventhorizon.UUID) error {
+	if err := r.ReadRepository.Remove(id); err != nil {
+		return err
+	}
+	if err := r.index.Delete(id.String()); err != nil {
+		return ErrCouldNotIndexModel
+	}
+	return nil
+}
+
+// Search returns the read models matching a query in the Bleve query string
+// syntax, by relevance. At most limit models are returned, or 10 if limit is
+// 0. A field can be searched with "field:text".
+func (r *ReadRepository) Search(ctx context.Context, query string, limit int) ([]interface{}, error) {
+	if limit == 0 {
+		limit = 10
+	}
+	req := bleve.NewSearchRequestOptions(bleve.NewQueryStringQuery(query), limit, 0, false)
+	result, err := r.index.SearchInContext(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	models := []interface{}{}
+	for _, hit := range result.Hits {
+		model, err := r.ReadRepository.Find(eventhorizon.UUID(hit.ID))
+		if err == eventhorizon.ErrModelNotFound {
+			// The model was removed from the other repository meanwhile.
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		models = append(models, model)
+	}
+	return models, nil
+}
+
+// Close closes the index.
+func (r *ReadRepository) Close() error {
+	return r.index.Close()
+}
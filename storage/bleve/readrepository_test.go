@@ -0,0 +1,110 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bleve
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/storage/memory"
+	"github.com/looplab/eventhorizon/testutil"
+)
+
+func TestReadRepository(t *testing.T) {
+	repo, err := NewReadRepository(memory.NewReadRepository(), "", "content")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer repo.Close()
+
+	model1 := &testutil.TestModel{eventhorizon.NewUUID(), "the quick brown fox", time.Now().Round(time.Millisecond)}
+	model2 := &testutil.TestModel{eventhorizon.NewUUID(), "a lazy dog", time.Now().Round(time.Millisecond)}
+	for _, model := range []*testutil.TestModel{model1, model2} {
+		if err := repo.Save(model.ID, model); err != nil {
+			t.Error("there should be no error:", err)
+		}
+	}
+
+	t.Log("find a saved model")
+	model, err := repo.Find(model1.ID)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(model, model1) {
+		t.Error("the model should be correct:", model)
+	}
+
+	t.Log("search")
+	result, err := repo.Search(context.Background(), "fox", 0)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(result, []interface{}{model1}) {
+		t.Error("the result should be correct:", result)
+	}
+	result, err = repo.Search(context.Background(), "content:dog", 0)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(result, []interface{}{model2}) {
+		t.Error("the result should be correct:", result)
+	}
+
+	t.Log("search for a removed model")
+	if err := repo.Remove(model2.ID); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	result, err = repo.Search(context.Background(), "dog", 0)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(result) != 0 {
+		t.Error("there should be no models:", result)
+	}
+}
+
+func TestReadRepositoryOnDisk(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index")
+	inner := memory.NewReadRepository()
+	repo, err := NewReadRepository(inner, path, "content")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	model := &testutil.TestModel{eventhorizon.NewUUID(), "the quick brown fox", time.Now().Round(time.Millisecond)}
+	if err := repo.Save(model.ID, model); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := repo.Close(); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("reopen the index")
+	repo, err = NewReadRepository(inner, path, "content")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer repo.Close()
+	result, err := repo.Search(context.Background(), "quick", 0)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(result, []interface{}{model}) {
+		t.Error("the result should be correct:", result)
+	}
+}
@@ -61,12 +61,15 @@ type EventStore struct {
 	service   *dynamodb.DynamoDB
 	config    *EventStoreConfig
 	factories map[string]func() eventhorizon.Event
+	clock     eventhorizon.Clock
 }
 
 // EventStoreConfig is a config for the DynamoDB event store.
 type EventStoreConfig struct {
 	Table  string
 	Region string
+	// Clock is the clock used to timestamp events, the system clock by default.
+	Clock eventhorizon.Clock
 }
 
 func (c *EventStoreConfig) provideDefaults() {
@@ -76,6 +79,9 @@ func (c *EventStoreConfig) provideDefaults() {
 	if c.Region == "" {
 		c.Region = "us-east-1"
 	}
+	if c.Clock == nil {
+		c.Clock = eventhorizon.SystemClock{}
+	}
 }
 
 // NewEventStore creates a new EventStore.
@@ -92,6 +98,7 @@ func NewEventStore(eventBus eventhorizon.EventBus, config *EventStoreConfig) (*E
 		service:   service,
 		config:    config,
 		factories: make(map[string]func() eventhorizon.Event),
+		clock:     config.Clock,
 	}
 
 	return s, nil
@@ -152,15 +159,15 @@ func (s *EventStore) Save(events []eventhorizon.Event) error {
 		// Marshal event payload.
 		payload, err := dynamodbattribute.MarshalMap(event)
 		if err != nil {
-			// return ErrCouldNotMarshalEvent
-			return err
+			return &eventhorizon.EventError{Err: ErrCouldNotMarshalEvent, Cause: err,
+				EventType: event.EventType(), AggregateID: event.AggregateID()}
 		}
 
 		// Create the event record with current version and timestamp.
 		record := &eventRecord{
 			AggregateID: event.AggregateID().String(),
 			Version:     version,
-			Timestamp:   time.Now(),
+			Timestamp:   s.clock.Now(),
 			EventType:   event.EventType(),
 			Payload:     payload,
 		}
@@ -177,7 +184,7 @@ func (s *EventStore) Save(events []eventhorizon.Event) error {
 		}
 		if _, err = s.service.PutItem(putParams); err != nil {
 			if err, ok := err.(awserr.RequestFailure); ok && err.Code() == "ConditionalCheckFailedException" {
-				return ErrCouldNotSaveAggregate
+				return s.versionConflict(event.AggregateID(), version-1)
 			}
 			return err
 		}
@@ -191,6 +198,25 @@ func (s *EventStore) Save(events []eventhorizon.Event) error {
 	return nil
 }
 
+// versionConflict creates an ErrVersionConflict with the events saved after
+// the expected version.
+func (s *EventStore) versionConflict(id eventhorizon.UUID, version int) error {
+	events, err := s.Load(id)
+	if err != nil {
+		return &eventhorizon.EventError{Err: ErrCouldNotSaveAggregate, Cause: err, AggregateID: id}
+	}
+
+	conflict := eventhorizon.ErrVersionConflict{
+		AggregateID:     id,
+		ExpectedVersion: version,
+		ActualVersion:   len(events),
+	}
+	if version < len(events) {
+		conflict.ConflictingEvents = events[version:]
+	}
+	return conflict
+}
+
 // Load loads all events for the aggregate id from the database.
 // Returns ErrNoEventsFound if no events can be found.
 func (s *EventStore) Load(id eventhorizon.UUID) ([]eventhorizon.Event, error) {
@@ -224,12 +250,13 @@ func (s *EventStore) Load(id eventhorizon.UUID) ([]eventhorizon.Event, error) {
 	for i, record := range eventRecords {
 		f, ok := s.factories[record.EventType]
 		if !ok {
-			return nil, ErrEventNotRegistered
+			return nil, &eventhorizon.EventError{Err: ErrEventNotRegistered,
+				EventType: record.EventType, AggregateID: id}
 		}
 		event := f()
 		if err := dynamodbattribute.UnmarshalMap(record.Payload, event); err != nil {
-			// 	return nil, ErrCouldNotUnmarshalEvent
-			return nil, err
+			return nil, &eventhorizon.EventError{Err: ErrCouldNotUnmarshalEvent, Cause: err,
+				EventType: record.EventType, AggregateID: id}
 		}
 		events[i] = event
 	}
@@ -237,6 +264,94 @@ func (s *EventStore) Load(id eventhorizon.UUID) ([]eventhorizon.Event, error) {
 	return events, nil
 }
 
+// LoadIterator returns an iterator over all events for the aggregate id. The
+// events are fetched from the database one page at a time.
+func (s *EventStore) LoadIterator(id eventhorizon.UUID) (eventhorizon.EventIterator, error) {
+	return &eventIterator{
+		store: s,
+		params: &dynamodb.QueryInput{
+			TableName:              aws.String(s.config.Table),
+			KeyConditionExpression: aws.String("AggregateID = :id"),
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":id": {S: aws.String(id.String())},
+			},
+			ConsistentRead: aws.Bool(true),
+		},
+	}, nil
+}
+
+// eventIterator is an EventIterator using paginated queries.
+type eventIterator struct {
+	store  *EventStore
+	params *dynamodb.QueryInput
+	items  []map[string]*dynamodb.AttributeValue
+	done   bool
+	event  eventhorizon.Event
+	err    error
+}
+
+// Next implements the Next method of the eventhorizon.EventIterator interface.
+func (i *eventIterator) Next() bool {
+	if i.err != nil {
+		return false
+	}
+
+	// Fetch the next page when needed.
+	for len(i.items) == 0 {
+		if i.done {
+			return false
+		}
+		resp, err := i.store.service.Query(i.params)
+		if err != nil {
+			i.err = err
+			return false
+		}
+		i.items = resp.Items
+		if len(resp.LastEvaluatedKey) == 0 {
+			i.done = true
+		}
+		i.params.ExclusiveStartKey = resp.LastEvaluatedKey
+	}
+
+	item := i.items[0]
+	i.items = i.items[1:]
+
+	record := &eventRecord{}
+	if err := dynamodbattribute.UnmarshalMap(item, record); err != nil {
+		i.err = err
+		return false
+	}
+	f, ok := i.store.factories[record.EventType]
+	if !ok {
+		i.err = &eventhorizon.EventError{Err: ErrEventNotRegistered,
+			EventType: record.EventType, AggregateID: eventhorizon.UUID(record.AggregateID)}
+		return false
+	}
+	event := f()
+	if err := dynamodbattribute.UnmarshalMap(record.Payload, event); err != nil {
+		i.err = &eventhorizon.EventError{Err: ErrCouldNotUnmarshalEvent, Cause: err,
+			EventType: record.EventType, AggregateID: eventhorizon.UUID(record.AggregateID)}
+		return false
+	}
+	i.event = event
+	return true
+}
+
+// Event implements the Event method of the eventhorizon.EventIterator interface.
+func (i *eventIterator) Event() eventhorizon.Event {
+	return i.event
+}
+
+// Err implements the Err method of the eventhorizon.EventIterator interface.
+func (i *eventIterator) Err() error {
+	return i.err
+}
+
+// Close implements the Close method of the eventhorizon.EventIterator interface.
+func (i *eventIterator) Close() error {
+	return nil
+}
+
 // RegisterEventType registers an event factory for a event type. The factory is
 // used to create concrete event types when loading from the database.
 //
@@ -0,0 +1,149 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/looplab/eventhorizon"
+)
+
+// CacheEventStore wraps an EventStore and keeps the event streams of the most
+// recently loaded aggregates in memory, to speed up the load-handle-save cycle
+// of hot aggregates. A cached stream is invalidated when events are saved for
+// its aggregate.
+//
+// The cache only knows about saves made through it, it should not be used when
+// other processes write to the same aggregates.
+type CacheEventStore struct {
+	eventStore eventhorizon.EventStore
+	size       int
+	streams    map[eventhorizon.UUID]*list.Element
+	lru        *list.List
+	loads      map[eventhorizon.UUID]*streamLoads
+	mu         sync.Mutex
+}
+
+// streamLoads counts the loads of a stream from the base store, with a
+// generation that is incremented by saves, so that a load that raced a save
+// does not cache the stream as it was before the save.
+type streamLoads struct {
+	n          int
+	generation int
+}
+
+type cachedStream struct {
+	id      eventhorizon.UUID
+	version int
+	events  []eventhorizon.Event
+}
+
+// NewCacheEventStore creates a new CacheEventStore that keeps at most size
+// streams.
+func NewCacheEventStore(eventStore eventhorizon.EventStore, size int) *CacheEventStore {
+	s := &CacheEventStore{
+		eventStore: eventStore,
+		size:       size,
+		streams:    make(map[eventhorizon.UUID]*list.Element),
+		lru:        list.New(),
+		loads:      make(map[eventhorizon.UUID]*streamLoads),
+	}
+	return s
+}
+
+// Save saves the events in the base store and then invalidates their cached
+// streams, also when saving failed as some events may have been saved.
+func (s *CacheEventStore) Save(events []eventhorizon.Event) error {
+	err := s.eventStore.Save(events)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, event := range events {
+		s.remove(event.AggregateID())
+		if l, ok := s.loads[event.AggregateID()]; ok {
+			l.generation++
+		}
+	}
+	return err
+}
+
+// Load loads all events for the aggregate id from the cache, or from the base
+// store if not cached. Streams loaded from the base store are cached unless
+// events were saved for the aggregate while loading.
+func (s *CacheEventStore) Load(id eventhorizon.UUID) ([]eventhorizon.Event, error) {
+	s.mu.Lock()
+	if e, ok := s.streams[id]; ok {
+		s.lru.MoveToFront(e)
+		events := append([]eventhorizon.Event{}, e.Value.(*cachedStream).events...)
+		s.mu.Unlock()
+		return events, nil
+	}
+	l, ok := s.loads[id]
+	if !ok {
+		l = &streamLoads{}
+		s.loads[id] = l
+	}
+	l.n++
+	generation := l.generation
+	s.mu.Unlock()
+
+	events, err := s.eventStore.Load(id)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if l.n--; l.n == 0 {
+		delete(s.loads, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := s.streams[id]; !ok && s.size > 0 && l.generation == generation {
+		s.streams[id] = s.lru.PushFront(&cachedStream{
+			id:      id,
+			version: len(events),
+			events:  append([]eventhorizon.Event{}, events...),
+		})
+		if s.lru.Len() > s.size {
+			s.remove(s.lru.Back().Value.(*cachedStream).id)
+		}
+	}
+	return events, nil
+}
+
+// Version returns the version of a cached stream, and false if the stream is
+// not cached.
+func (s *CacheEventStore) Version(id eventhorizon.UUID) (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.streams[id]; ok {
+		return e.Value.(*cachedStream).version, true
+	}
+	return 0, false
+}
+
+// Invalidate removes a stream from the cache.
+func (s *CacheEventStore) Invalidate(id eventhorizon.UUID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remove(id)
+}
+
+func (s *CacheEventStore) remove(id eventhorizon.UUID) {
+	if e, ok := s.streams[id]; ok {
+		s.lru.Remove(e)
+		delete(s.streams, id)
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/testutil"
+)
+
+func TestCacheEventStore(t *testing.T) {
+	baseStore := &testutil.MockEventStore{}
+	store := NewCacheEventStore(baseStore, 1)
+	if store == nil {
+		t.Fatal("there should be a store")
+	}
+
+	id := eventhorizon.NewUUID()
+	event1 := &testutil.TestEvent{id, "event1"}
+	if err := store.Save([]eventhorizon.Event{event1}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("load from base store")
+	events, err := store.Load(id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(events, []eventhorizon.Event{event1}) {
+		t.Error("the loaded events should be correct:", events)
+	}
+	if version, ok := store.Version(id); !ok || version != 1 {
+		t.Error("the stream should be cached with version 1:", version, ok)
+	}
+
+	t.Log("load from cache")
+	baseStore.Loaded = ""
+	events, err = store.Load(id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(events, []eventhorizon.Event{event1}) {
+		t.Error("the loaded events should be correct:", events)
+	}
+	if baseStore.Loaded != "" {
+		t.Error("the base store should not be used:", baseStore.Loaded)
+	}
+
+	t.Log("invalidate on save")
+	event2 := &testutil.TestEvent{id, "event2"}
+	if err := store.Save([]eventhorizon.Event{event2}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, ok := store.Version(id); ok {
+		t.Error("the stream should not be cached")
+	}
+	events, err = store.Load(id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(events, []eventhorizon.Event{event1, event2}) {
+		t.Error("the loaded events should be correct:", events)
+	}
+
+	t.Log("evict least recently used")
+	id2 := eventhorizon.NewUUID()
+	if _, err := store.Load(id2); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, ok := store.Version(id); ok {
+		t.Error("the first stream should be evicted")
+	}
+	if _, ok := store.Version(id2); !ok {
+		t.Error("the second stream should be cached")
+	}
+}
+
+func TestCacheEventStoreSaveWhileLoading(t *testing.T) {
+	baseStore := &blockingEventStore{
+		loading: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	store := NewCacheEventStore(baseStore, 1)
+	id := eventhorizon.NewUUID()
+	event1 := &testutil.TestEvent{id, "event1"}
+	if err := store.Save([]eventhorizon.Event{event1}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("save while loading")
+	done := make(chan struct{})
+	go func() {
+		store.Load(id)
+		close(done)
+	}()
+	<-baseStore.loading
+	event2 := &testutil.TestEvent{id, "event2"}
+	if err := store.Save([]eventhorizon.Event{event2}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	close(baseStore.release)
+	<-done
+	if _, ok := store.Version(id); ok {
+		t.Error("the stream loaded before the save should not be cached")
+	}
+
+	t.Log("load after saving")
+	events, err := store.Load(id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(events, []eventhorizon.Event{event1, event2}) {
+		t.Error("the events should be correct:", events)
+	}
+	if version, ok := store.Version(id); !ok || version != 2 {
+		t.Error("the stream should be cached:", version, ok)
+	}
+}
+
+// blockingEventStore is an event store that blocks the first load until it is
+// released, with the events as they were when loading started.
+type blockingEventStore struct {
+	testutil.MockEventStore
+	loading chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func (s *blockingEventStore) Load(id eventhorizon.UUID) ([]eventhorizon.Event, error) {
+	events := append([]eventhorizon.Event{}, s.Events...)
+	s.once.Do(func() {
+		close(s.loading)
+		<-s.release
+	})
+	return events, nil
+}
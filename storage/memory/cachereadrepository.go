@@ -0,0 +1,189 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/looplab/eventhorizon"
+)
+
+// CacheReadRepository wraps a ReadRepository and keeps the most recently found
+// read models in memory. A cached model is invalidated when it is saved or
+// removed through the cache.
+//
+// To invalidate models that are saved by projectors in other processes, add the
+// cache as a global handler on the event bus. The models of the aggregates of
+// the received events are then invalidated, see SetInvalidateFunc. An event
+// can arrive before the model is saved by a projector elsewhere, so a TTL
+// should be set as well in that case.
+type CacheReadRepository struct {
+	eventhorizon.ReadRepository
+	size          int
+	ttl           time.Duration
+	clock         eventhorizon.Clock
+	invalidate    func(eventhorizon.Event) []eventhorizon.UUID
+	models        map[eventhorizon.UUID]*list.Element
+	lru           *list.List
+	invalidations uint64
+	mu            sync.Mutex
+}
+
+type cachedModel struct {
+	id      eventhorizon.UUID
+	model   interface{}
+	expires time.Time
+}
+
+// NewCacheReadRepository creates a new CacheReadRepository that keeps at most
+// size models. The clock is used for expiring models.
+func NewCacheReadRepository(repo eventhorizon.ReadRepository, size int, clock eventhorizon.Clock) *CacheReadRepository {
+	return &CacheReadRepository{
+		ReadRepository: repo,
+		size:           size,
+		clock:          clock,
+		invalidate: func(event eventhorizon.Event) []eventhorizon.UUID {
+			return []eventhorizon.UUID{event.AggregateID()}
+		},
+		models: make(map[eventhorizon.UUID]*list.Element),
+		lru:    list.New(),
+	}
+}
+
+// SetTTL sets the time after which cached models expire, the default is 0
+// which means never.
+func (r *CacheReadRepository) SetTTL(ttl time.Duration) {
+	r.ttl = ttl
+}
+
+// SetInvalidateFunc sets the function that returns the IDs of the models to
+// invalidate for a received event. The default is the aggregate ID of the
+// event, for read models with the same ID as their aggregate.
+func (r *CacheReadRepository) SetInvalidateFunc(f func(eventhorizon.Event) []eventhorizon.UUID) {
+	r.invalidate = f
+}
+
+// Save invalidates the cached model and saves it in the base repository.
+func (r *CacheReadRepository) Save(id eventhorizon.UUID, model interface{}) error {
+	r.Invalidate(id)
+	return r.ReadRepository.Save(id, model)
+}
+
+// Find returns a read model from the cache, or from the base repository if not
+// cached.
+func (r *CacheReadRepository) Find(id eventhorizon.UUID) (interface{}, error) {
+	r.mu.Lock()
+	if e, ok := r.models[id]; ok {
+		cached := e.Value.(*cachedModel)
+		if cached.expires.IsZero() || r.clock.Now().Before(cached.expires) {
+			r.lru.MoveToFront(e)
+			r.mu.Unlock()
+			return copyModel(cached.model), nil
+		}
+		r.remove(id)
+	}
+	invalidations := r.invalidations
+	r.mu.Unlock()
+
+	model, err := r.ReadRepository.Find(id)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// Don't cache a model that may have been invalidated while finding it.
+	if _, ok := r.models[id]; !ok && r.size > 0 && r.invalidations == invalidations {
+		cached := &cachedModel{
+			id:    id,
+			model: copyModel(model),
+		}
+		if r.ttl > 0 {
+			cached.expires = r.clock.Now().Add(r.ttl)
+		}
+		r.models[id] = r.lru.PushFront(cached)
+		if r.lru.Len() > r.size {
+			r.remove(r.lru.Back().Value.(*cachedModel).id)
+		}
+	}
+	return model, nil
+}
+
+// Remove invalidates the cached model and removes it from the base repository.
+func (r *CacheReadRepository) Remove(id eventhorizon.UUID) error {
+	r.Invalidate(id)
+	return r.ReadRepository.Remove(id)
+}
+
+// SoftDelete invalidates the cached model and soft deletes it in the base
+// repository, see eventhorizon.SoftDeleteReadRepository. Returns
+// ErrSoftDeleteNotSupported if the base repository can not soft delete.
+func (r *CacheReadRepository) SoftDelete(ctx context.Context, id eventhorizon.UUID) error {
+	repo, ok := r.ReadRepository.(eventhorizon.SoftDeleteReadRepository)
+	if !ok {
+		return eventhorizon.ErrSoftDeleteNotSupported
+	}
+	r.Invalidate(id)
+	return repo.SoftDelete(ctx, id)
+}
+
+// Restore restores a soft deleted model in the base repository, see
+// eventhorizon.SoftDeleteReadRepository. Returns ErrSoftDeleteNotSupported if
+// the base repository can not soft delete.
+func (r *CacheReadRepository) Restore(ctx context.Context, id eventhorizon.UUID) error {
+	repo, ok := r.ReadRepository.(eventhorizon.SoftDeleteReadRepository)
+	if !ok {
+		return eventhorizon.ErrSoftDeleteNotSupported
+	}
+	r.Invalidate(id)
+	return repo.Restore(ctx, id)
+}
+
+// FindDeleted returns the soft deleted models of the base repository, which
+// are not cached. Returns ErrSoftDeleteNotSupported if the base repository can
+// not soft delete.
+func (r *CacheReadRepository) FindDeleted(ctx context.Context) ([]interface{}, error) {
+	repo, ok := r.ReadRepository.(eventhorizon.SoftDeleteReadRepository)
+	if !ok {
+		return nil, eventhorizon.ErrSoftDeleteNotSupported
+	}
+	return repo.FindDeleted(ctx)
+}
+
+// HandleEvent implements the HandleEvent method of the EventHandler interface,
+// invalidating the models of the event.
+func (r *CacheReadRepository) HandleEvent(event eventhorizon.Event) {
+	for _, id := range r.invalidate(event) {
+		r.Invalidate(id)
+	}
+}
+
+// Invalidate removes a model from the cache.
+func (r *CacheReadRepository) Invalidate(id eventhorizon.UUID) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.invalidations++
+	r.remove(id)
+}
+
+func (r *CacheReadRepository) remove(id eventhorizon.UUID) {
+	if e, ok := r.models[id]; ok {
+		r.lru.Remove(e)
+		delete(r.models, id)
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/messaging/local"
+	"github.com/looplab/eventhorizon/testutil"
+)
+
+func TestCacheReadRepository(t *testing.T) {
+	base := NewReadRepository()
+	repo := NewCacheReadRepository(base, 1, eventhorizon.SystemClock{})
+	bus := local.NewEventBus()
+	bus.AddGlobalHandler(repo)
+
+	id := eventhorizon.NewUUID()
+	if err := repo.Save(id, &testutil.TestModel{ID: id, Content: "model1"}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	model, err := repo.Find(id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if model.(*testutil.TestModel).Content != "model1" {
+		t.Error("the model should be correct:", model)
+	}
+
+	t.Log("find a cached model saved elsewhere")
+	base.Save(id, &testutil.TestModel{ID: id, Content: "model2"})
+	model, _ = repo.Find(id)
+	if model.(*testutil.TestModel).Content != "model1" {
+		t.Error("the model should be cached:", model)
+	}
+
+	t.Log("invalidate by an event")
+	bus.PublishEvent(&testutil.TestEvent{id, "event1"})
+	model, _ = repo.Find(id)
+	if model.(*testutil.TestModel).Content != "model2" {
+		t.Error("the model should be invalidated:", model)
+	}
+
+	t.Log("evict the least recently found model")
+	id2 := eventhorizon.NewUUID()
+	repo.Save(id2, &testutil.TestModel{ID: id2, Content: "other"})
+	repo.Find(id2)
+	base.Save(id, &testutil.TestModel{ID: id, Content: "model3"})
+	model, _ = repo.Find(id)
+	if model.(*testutil.TestModel).Content != "model3" {
+		t.Error("the model should be evicted:", model)
+	}
+
+	t.Log("remove a model")
+	if err := repo.Remove(id); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, err := repo.Find(id); err != eventhorizon.ErrModelNotFound {
+		t.Error("there should be a ErrModelNotFound error:", err)
+	}
+}
+
+func TestCacheReadRepositoryTTL(t *testing.T) {
+	base := NewReadRepository()
+	clock := testutil.NewMockClock(time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC))
+	repo := NewCacheReadRepository(base, 10, clock)
+	repo.SetTTL(time.Minute)
+
+	id := eventhorizon.NewUUID()
+	repo.Save(id, &testutil.TestModel{ID: id, Content: "model1"})
+	repo.Find(id)
+	base.Save(id, &testutil.TestModel{ID: id, Content: "model2"})
+	model, _ := repo.Find(id)
+	if model.(*testutil.TestModel).Content != "model1" {
+		t.Error("the model should be cached:", model)
+	}
+
+	t.Log("expire the cached model")
+	clock.Advance(time.Minute)
+	model, _ = repo.Find(id)
+	if model.(*testutil.TestModel).Content != "model2" {
+		t.Error("the model should be expired:", model)
+	}
+}
+
+func TestCacheReadRepositorySoftDelete(t *testing.T) {
+	ctx := context.Background()
+	repo := NewCacheReadRepository(NewReadRepository(), 1, eventhorizon.SystemClock{})
+	id := eventhorizon.NewUUID()
+	if err := repo.Save(id, &testutil.TestModel{ID: id, Content: "model1"}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, err := repo.Find(id); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("soft delete a cached model")
+	if err := repo.SoftDelete(ctx, id); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, err := repo.Find(id); err != eventhorizon.ErrModelNotFound {
+		t.Error("there should be a ErrModelNotFound error:", err)
+	}
+	if models, _ := repo.FindDeleted(ctx); len(models) != 1 {
+		t.Error("there should be a deleted model:", models)
+	}
+	if err := repo.Restore(ctx, id); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, err := repo.Find(id); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("soft delete in a base repository that can not")
+	repo = NewCacheReadRepository(struct{ eventhorizon.ReadRepository }{NewReadRepository()}, 1, eventhorizon.SystemClock{})
+	if err := repo.SoftDelete(ctx, id); err != eventhorizon.ErrSoftDeleteNotSupported {
+		t.Error("there should be a ErrSoftDeleteNotSupported error:", err)
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/looplab/eventhorizon"
+)
+
+// DeadLetterStore implements DeadLetterStore as an in memory structure.
+type DeadLetterStore struct {
+	deadLetters []*eventhorizon.DeadLetter
+	mu          sync.RWMutex
+}
+
+// NewDeadLetterStore creates a new DeadLetterStore.
+func NewDeadLetterStore() *DeadLetterStore {
+	return &DeadLetterStore{}
+}
+
+// SaveDeadLetter saves a dead letter.
+func (s *DeadLetterStore) SaveDeadLetter(ctx context.Context, d *eventhorizon.DeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deadLetters = append(s.deadLetters, d)
+	return nil
+}
+
+// DeadLetters returns all dead letters, in the order they were saved.
+func (s *DeadLetterStore) DeadLetters(ctx context.Context) ([]*eventhorizon.DeadLetter, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]*eventhorizon.DeadLetter{}, s.deadLetters...), nil
+}
+
+// DeadLetter returns a dead letter. Returns ErrDeadLetterNotFound if there is
+// none.
+func (s *DeadLetterStore) DeadLetter(ctx context.Context, id eventhorizon.UUID) (*eventhorizon.DeadLetter, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, d := range s.deadLetters {
+		if d.ID == id {
+			return d, nil
+		}
+	}
+	return nil, eventhorizon.ErrDeadLetterNotFound
+}
+
+// RemoveDeadLetter removes a dead letter. Returns ErrDeadLetterNotFound if
+// there is none.
+func (s *DeadLetterStore) RemoveDeadLetter(ctx context.Context, id eventhorizon.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, d := range s.deadLetters {
+		if d.ID == id {
+			s.deadLetters = append(s.deadLetters[:i], s.deadLetters[i+1:]...)
+			return nil
+		}
+	}
+	return eventhorizon.ErrDeadLetterNotFound
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/testutil"
+)
+
+func TestDeadLetterStore(t *testing.T) {
+	store := NewDeadLetterStore()
+	now := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	handler := eventhorizon.NewDeadLetterHandler(store, "shed", testutil.NewMockClock(now))
+	ctx := context.Background()
+
+	t.Log("handle events as dead letters")
+	event1 := &testutil.TestEvent{eventhorizon.NewUUID(), "event1"}
+	event2 := &testutil.TestEvent{eventhorizon.NewUUID(), "event2"}
+	headers := eventhorizon.Headers{eventhorizon.HeaderCorrelationID: "correlation"}
+	eventhorizon.HandleEventWithContext(eventhorizon.NewContextWithHeaders(ctx, headers), handler, event1)
+	handler.HandleEvent(event2)
+	deadLetters, err := store.DeadLetters(ctx)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(deadLetters) != 2 {
+		t.Fatal("there should be two dead letters:", deadLetters)
+	}
+	expected := &eventhorizon.DeadLetter{
+		ID:        deadLetters[0].ID,
+		EventType: "TestEvent",
+		Event:     event1,
+		Headers:   headers,
+		Reason:    "shed",
+		Timestamp: now,
+	}
+	if !reflect.DeepEqual(deadLetters[0], expected) {
+		t.Error("the dead letter should be correct:", deadLetters[0])
+	}
+
+	t.Log("find a dead letter")
+	d, err := store.DeadLetter(ctx, deadLetters[1].ID)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if d.Event != event2 {
+		t.Error("the dead letter should be correct:", d)
+	}
+	if _, err := store.DeadLetter(ctx, eventhorizon.NewUUID()); err != eventhorizon.ErrDeadLetterNotFound {
+		t.Error("there should be a ErrDeadLetterNotFound error:", err)
+	}
+
+	t.Log("requeue a dead letter")
+	bus := &testutil.MockEventBus{}
+	if err := eventhorizon.RequeueDeadLetter(ctx, store, bus, deadLetters[0].ID); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(bus.Events, []eventhorizon.Event{event1}) {
+		t.Error("the event should be published:", bus.Events)
+	}
+	if _, err := store.DeadLetter(ctx, deadLetters[0].ID); err != eventhorizon.ErrDeadLetterNotFound {
+		t.Error("there should be a ErrDeadLetterNotFound error:", err)
+	}
+
+	t.Log("remove a dead letter")
+	if err := store.RemoveDeadLetter(ctx, deadLetters[1].ID); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := store.RemoveDeadLetter(ctx, deadLetters[1].ID); err != eventhorizon.ErrDeadLetterNotFound {
+		t.Error("there should be a ErrDeadLetterNotFound error:", err)
+	}
+}
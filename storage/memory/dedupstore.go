@@ -0,0 +1,68 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/looplab/eventhorizon"
+)
+
+// DedupStore implements DedupStore as an in memory structure, for one
+// instance.
+type DedupStore struct {
+	expires map[string]time.Time
+	clock   eventhorizon.Clock
+	mu      sync.Mutex
+}
+
+// NewDedupStore creates a new DedupStore. The clock is used for expiring the
+// IDs.
+func NewDedupStore(clock eventhorizon.Clock) *DedupStore {
+	return &DedupStore{
+		expires: make(map[string]time.Time),
+		clock:   clock,
+	}
+}
+
+// Remember implements the Remember method of the DedupStore interface.
+func (s *DedupStore) Remember(ctx context.Context, id string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Expired IDs are removed when remembering.
+	now := s.clock.Now()
+	for i, expires := range s.expires {
+		if !now.Before(expires) {
+			delete(s.expires, i)
+		}
+	}
+
+	if _, ok := s.expires[id]; ok {
+		return false, nil
+	}
+	s.expires[id] = now.Add(ttl)
+	return true, nil
+}
+
+// Forget implements the Forget method of the DedupStore interface.
+func (s *DedupStore) Forget(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.expires, id)
+	return nil
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/looplab/eventhorizon/testutil"
+)
+
+func TestDedupStore(t *testing.T) {
+	clock := testutil.NewMockClock(time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC))
+	store := NewDedupStore(clock)
+	ctx := context.Background()
+
+	t.Log("remember an ID once")
+	if ok, err := store.Remember(ctx, "id1", time.Minute); err != nil || !ok {
+		t.Error("the ID should be remembered:", ok, err)
+	}
+	if ok, err := store.Remember(ctx, "id1", time.Minute); err != nil || ok {
+		t.Error("the ID should already be remembered:", ok, err)
+	}
+
+	t.Log("forget an ID")
+	if err := store.Forget(ctx, "id1"); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if ok, _ := store.Remember(ctx, "id1", time.Minute); !ok {
+		t.Error("the forgotten ID should be remembered again")
+	}
+
+	t.Log("expire an ID")
+	clock.Advance(time.Minute)
+	if ok, _ := store.Remember(ctx, "id1", time.Minute); !ok {
+		t.Error("the expired ID should be remembered again")
+	}
+}
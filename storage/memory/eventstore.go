@@ -15,7 +15,11 @@
 package memory
 
 import (
+	"context"
 	"errors"
+	"sort"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/looplab/eventhorizon"
@@ -25,28 +29,99 @@ import (
 type EventStore struct {
 	eventBus         eventhorizon.EventBus
 	aggregateRecords map[eventhorizon.UUID]*memoryAggregateRecord
+	all              []*memoryEventRecord // All events, in the order saved.
+	clock            eventhorizon.Clock
+	subscribers      map[chan eventhorizon.EventEnvelope]context.Context
+	subscribersMu    sync.Mutex
+	snapshotStore    eventhorizon.SnapshotStore
+	stats            *eventhorizon.StatsCounter
+}
+
+// Option is an option for an EventStore.
+type Option func(*EventStore)
+
+// WithClock sets the clock used to timestamp events.
+func WithClock(clock eventhorizon.Clock) Option {
+	return func(s *EventStore) {
+		s.clock = clock
+	}
 }
 
 // NewEventStore creates a new EventStore.
-func NewEventStore(eventBus eventhorizon.EventBus) *EventStore {
+func NewEventStore(eventBus eventhorizon.EventBus, options ...Option) *EventStore {
 	s := &EventStore{
 		eventBus:         eventBus,
 		aggregateRecords: make(map[eventhorizon.UUID]*memoryAggregateRecord),
+		clock:            eventhorizon.SystemClock{},
+		subscribers:      make(map[chan eventhorizon.EventEnvelope]context.Context),
+	}
+	for _, option := range options {
+		option(s)
 	}
+	s.stats = eventhorizon.NewStatsCounter(s.clock)
 	return s
 }
 
 // Save appends all events in the event stream to the memory store.
 func (s *EventStore) Save(events []eventhorizon.Event) error {
+	return s.SaveWithContext(context.Background(), events)
+}
+
+// SaveWithContext appends all events as Save, with the headers of the context.
+func (s *EventStore) SaveWithContext(ctx context.Context, events []eventhorizon.Event) error {
+	return s.save(ctx, events, -1)
+}
+
+// SaveWithVersion implements the SaveWithVersion method of the
+// eventhorizon.VersionedEventStore interface. The version of an aggregate is
+// its number of events, as the events are versioned from 0.
+func (s *EventStore) SaveWithVersion(ctx context.Context, events []eventhorizon.Event, originalVersion int) error {
+	return s.save(ctx, events, originalVersion)
+}
+
+// save appends events, checking the version of their aggregate unless the
+// original version is negative.
+func (s *EventStore) save(ctx context.Context, events []eventhorizon.Event, originalVersion int) error {
 	if len(events) == 0 {
 		return eventhorizon.ErrNoEventsToAppend
 	}
 
+	for _, event := range events {
+		if a, ok := s.aggregateRecords[event.AggregateID()]; ok && a.deleted {
+			s.stats.AddError()
+			return eventhorizon.ErrAggregateDeleted
+		}
+	}
+
+	if originalVersion >= 0 {
+		id := events[0].AggregateID()
+		version := 0
+		var conflicting []eventhorizon.Event
+		if a, ok := s.aggregateRecords[id]; ok {
+			version = a.version + 1
+			for _, r := range a.events {
+				if r.version >= originalVersion {
+					conflicting = append(conflicting, r.event)
+				}
+			}
+		}
+		if version != originalVersion {
+			s.stats.AddError()
+			return eventhorizon.ErrVersionConflict{
+				AggregateID:       id,
+				ExpectedVersion:   originalVersion,
+				ActualVersion:     version,
+				ConflictingEvents: conflicting,
+			}
+		}
+	}
+
 	for _, event := range events {
 		r := &memoryEventRecord{
 			eventType: event.EventType(),
-			timestamp: time.Now(),
+			timestamp: s.clock.Now(),
 			event:     event,
+			headers:   eventhorizon.HeadersFromContext(ctx),
 		}
 
 		if a, ok := s.aggregateRecords[event.AggregateID()]; ok {
@@ -60,13 +135,79 @@ func (s *EventStore) Save(events []eventhorizon.Event) error {
 				events:      []*memoryEventRecord{r},
 			}
 		}
+		s.all = append(s.all, r)
+	}
+
+	// Notify subscribers of the saved events.
+	s.notify(len(s.all) - len(events))
+	s.stats.AddEvents(len(events))
+
+	// Publish events on the bus.
+	if s.eventBus != nil {
+		eventhorizon.PublishEvents(s.eventBus, events)
+	}
+
+	return nil
+}
+
+// Import appends events with the versions, timestamps and headers of their
+// envelopes, without publishing them on the bus.
+func (s *EventStore) Import(ctx context.Context, envelopes []eventhorizon.EventEnvelope) error {
+	if len(envelopes) == 0 {
+		return eventhorizon.ErrNoEventsToAppend
+	}
+
+	// Check that the first event of each aggregate follows the stored ones.
+	checked := make(map[eventhorizon.UUID]bool)
+	for _, envelope := range envelopes {
+		id := envelope.Event.AggregateID()
+		if checked[id] {
+			continue
+		}
+		checked[id] = true
+
+		version := -1
+		if a, ok := s.aggregateRecords[id]; ok {
+			if a.deleted {
+				return eventhorizon.ErrAggregateDeleted
+			}
+			version = a.version
+		}
+		if envelope.Version != version+1 {
+			return eventhorizon.ErrVersionConflict{
+				AggregateID:     id,
+				ExpectedVersion: envelope.Version,
+				ActualVersion:   version,
+			}
+		}
+	}
+
+	for _, envelope := range envelopes {
+		event := envelope.Event
+		r := &memoryEventRecord{
+			eventType: event.EventType(),
+			version:   envelope.Version,
+			timestamp: envelope.Timestamp,
+			event:     event,
+			headers:   envelope.Headers,
+		}
 
-		// Publish event on the bus.
-		if s.eventBus != nil {
-			s.eventBus.PublishEvent(event)
+		if a, ok := s.aggregateRecords[event.AggregateID()]; ok {
+			a.version = r.version
+			a.events = append(a.events, r)
+		} else {
+			s.aggregateRecords[event.AggregateID()] = &memoryAggregateRecord{
+				aggregateID: event.AggregateID(),
+				version:     r.version,
+				events:      []*memoryEventRecord{r},
+			}
 		}
+		s.all = append(s.all, r)
 	}
 
+	// Notify subscribers of the imported events.
+	s.notify(len(s.all) - len(envelopes))
+
 	return nil
 }
 
@@ -74,6 +215,9 @@ func (s *EventStore) Save(events []eventhorizon.Event) error {
 // Returns ErrNoEventsFound if no events can be found.
 func (s *EventStore) Load(id eventhorizon.UUID) ([]eventhorizon.Event, error) {
 	if a, ok := s.aggregateRecords[id]; ok {
+		if a.deleted {
+			return nil, eventhorizon.ErrAggregateDeleted
+		}
 		events := make([]eventhorizon.Event, len(a.events))
 		for i, r := range a.events {
 			events[i] = r.event
@@ -84,10 +228,311 @@ func (s *EventStore) Load(id eventhorizon.UUID) ([]eventhorizon.Event, error) {
 	return nil, eventhorizon.ErrNoEventsFound
 }
 
+// LoadAfter loads the events of an aggregate that follow its state at a
+// version, for restoring it from a snapshot. Events are versioned from 0 in
+// the memory store, so the event with the version is the first one loaded.
+func (s *EventStore) LoadAfter(id eventhorizon.UUID, version int) ([]eventhorizon.Event, error) {
+	a, ok := s.aggregateRecords[id]
+	if !ok {
+		return nil, eventhorizon.ErrNoEventsFound
+	}
+	if a.deleted {
+		return nil, eventhorizon.ErrAggregateDeleted
+	}
+
+	var events []eventhorizon.Event
+	for _, r := range a.events {
+		if r.version >= version {
+			events = append(events, r.event)
+		}
+	}
+	return events, nil
+}
+
+// LoadEnvelopes loads all events for the aggregate id in envelopes with their
+// versions, timestamps and headers.
+func (s *EventStore) LoadEnvelopes(id eventhorizon.UUID) ([]eventhorizon.EventEnvelope, error) {
+	if a, ok := s.aggregateRecords[id]; ok {
+		if a.deleted {
+			return nil, eventhorizon.ErrAggregateDeleted
+		}
+		envelopes := make([]eventhorizon.EventEnvelope, len(a.events))
+		for i, r := range a.events {
+			envelopes[i] = r.envelope()
+		}
+		return envelopes, nil
+	}
+
+	return nil, eventhorizon.ErrNoEventsFound
+}
+
+// Streams returns the streams of all aggregates, also deleted ones, in the order
+// of their aggregate IDs.
+func (s *EventStore) Streams(ctx context.Context) ([]eventhorizon.StreamInfo, error) {
+	streams := make([]eventhorizon.StreamInfo, 0, len(s.aggregateRecords))
+	for id, a := range s.aggregateRecords {
+		stream := eventhorizon.StreamInfo{
+			AggregateID: id,
+			Version:     a.version,
+			Events:      len(a.events),
+			Deleted:     a.deleted,
+		}
+		if len(a.events) > 0 {
+			stream.AggregateType = a.events[0].event.AggregateType()
+		}
+		streams = append(streams, stream)
+	}
+	sort.Slice(streams, func(i, j int) bool {
+		return streams[i].AggregateID < streams[j].AggregateID
+	})
+	return streams, nil
+}
+
+// LoadStored loads the stored events of an aggregate, also if it has been
+// deleted. The data of the events are the events themselves.
+func (s *EventStore) LoadStored(ctx context.Context, id eventhorizon.UUID) ([]eventhorizon.StoredEvent, error) {
+	a, ok := s.aggregateRecords[id]
+	if !ok {
+		return nil, eventhorizon.ErrNoEventsFound
+	}
+
+	events := make([]eventhorizon.StoredEvent, len(a.events))
+	for i, r := range a.events {
+		events[i] = eventhorizon.StoredEvent{
+			Type:          r.eventType,
+			AggregateType: r.event.AggregateType(),
+			AggregateID:   id,
+			Version:       r.version,
+			Timestamp:     r.timestamp,
+			Headers:       r.headers,
+			Data:          r.event,
+		}
+	}
+	return events, nil
+}
+
+// Delete marks an aggregate as deleted and appends and publishes an
+// AggregateDeleted event. Returns ErrNoEventsFound if there is no aggregate.
+func (s *EventStore) Delete(id eventhorizon.UUID) error {
+	a, ok := s.aggregateRecords[id]
+	if !ok {
+		return eventhorizon.ErrNoEventsFound
+	}
+	if a.deleted {
+		return eventhorizon.ErrAggregateDeleted
+	}
+
+	event := &eventhorizon.AggregateDeleted{ID: id}
+	if len(a.events) > 0 {
+		event.Type = a.events[len(a.events)-1].event.AggregateType()
+	}
+	if err := s.Save([]eventhorizon.Event{event}); err != nil {
+		return err
+	}
+	a.deleted = true
+	return nil
+}
+
+// TruncateBefore removes the events of an aggregate before a version, if there
+// is a snapshot of at least that version in the snapshot store.
+func (s *EventStore) TruncateBefore(id eventhorizon.UUID, version int) error {
+	a, ok := s.aggregateRecords[id]
+	if !ok {
+		return eventhorizon.ErrNoEventsFound
+	}
+	if err := eventhorizon.CheckSnapshot(s.snapshotStore, id, version); err != nil {
+		return err
+	}
+
+	events := a.events[:0]
+	for _, r := range a.events {
+		if r.version < version {
+			r.removed = true
+			continue
+		}
+		events = append(events, r)
+	}
+	a.events = events
+	return nil
+}
+
+// Purge removes all events of an aggregate.
+func (s *EventStore) Purge(id eventhorizon.UUID) error {
+	a, ok := s.aggregateRecords[id]
+	if !ok {
+		return eventhorizon.ErrNoEventsFound
+	}
+	for _, r := range a.events {
+		r.removed = true
+	}
+	delete(s.aggregateRecords, id)
+	return nil
+}
+
+// ApplyRetention removes the events that are not retained by a policy at a
+// time. Aggregates without retained events are removed, other events only as
+// far as the latest snapshot of their aggregate covers them.
+func (s *EventStore) ApplyRetention(ctx context.Context, policy eventhorizon.RetentionPolicy, now time.Time) error {
+	for id, a := range s.aggregateRecords {
+		if len(a.events) == 0 || policy.IsExempt(a.events[0].event.AggregateType()) {
+			continue
+		}
+
+		// Count the expired events at the start of the stream.
+		expired := 0
+		for i, r := range a.events {
+			if policy.Expired(i, len(a.events), r.timestamp, now) {
+				expired = i + 1
+			}
+		}
+		if expired == 0 {
+			continue
+		}
+
+		if expired == len(a.events) {
+			for _, r := range a.events {
+				r.removed = true
+			}
+			delete(s.aggregateRecords, id)
+			continue
+		}
+
+		// Truncate before the first retained event, or before the snapshot.
+		version := a.events[expired].version
+		if s.snapshotStore == nil {
+			continue
+		}
+		snapshot, err := s.snapshotStore.LoadSnapshot(id)
+		if err == eventhorizon.ErrSnapshotNotFound {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if snapshot.Version < version {
+			version = snapshot.Version
+		}
+
+		events := a.events[:0]
+		for _, r := range a.events {
+			if r.version < version {
+				r.removed = true
+				continue
+			}
+			events = append(events, r)
+		}
+		a.events = events
+	}
+	return nil
+}
+
+// SetSnapshotStore sets the snapshot store that is checked before truncating.
+func (s *EventStore) SetSnapshotStore(snapshotStore eventhorizon.SnapshotStore) {
+	s.snapshotStore = snapshotStore
+}
+
+// Stats implements the Stats method of the eventhorizon.StatsProvider
+// interface, with the saved events and the saves that failed.
+func (s *EventStore) Stats() eventhorizon.ComponentStats {
+	return s.stats.Stats()
+}
+
+// LoadIterator returns an iterator over all events for the aggregate id.
+func (s *EventStore) LoadIterator(id eventhorizon.UUID) (eventhorizon.EventIterator, error) {
+	events, err := s.Load(id)
+	if err != nil && err != eventhorizon.ErrNoEventsFound {
+		return nil, err
+	}
+	return eventhorizon.NewSliceEventIterator(events), nil
+}
+
+// LoadAll loads up to limit events of all aggregates after a position, in the
+// order they were saved. The position is the number of events before it.
+func (s *EventStore) LoadAll(ctx context.Context, from eventhorizon.Position, limit int) ([]eventhorizon.EventEnvelope, eventhorizon.Position, error) {
+	start := 0
+	if from != "" {
+		var err error
+		if start, err = strconv.Atoi(string(from)); err != nil || start < 0 || start > len(s.all) {
+			return nil, from, eventhorizon.ErrInvalidPosition
+		}
+	}
+
+	end := len(s.all)
+	if limit > 0 && start+limit < end {
+		end = start + limit
+	}
+
+	envelopes := make([]eventhorizon.EventEnvelope, 0, end-start)
+	for i, r := range s.all[start:end] {
+		if r.removed {
+			continue
+		}
+		envelope := r.envelope()
+		envelope.Position = eventhorizon.Position(strconv.Itoa(start + i + 1))
+		envelopes = append(envelopes, envelope)
+	}
+	return envelopes, eventhorizon.Position(strconv.Itoa(end)), nil
+}
+
+// FindEvents finds the events matching a query, in the order they were saved.
+func (s *EventStore) FindEvents(ctx context.Context, query eventhorizon.Query) ([]eventhorizon.EventEnvelope, error) {
+	envelopes := []eventhorizon.EventEnvelope{}
+	for i, r := range s.all {
+		if query.Limit > 0 && len(envelopes) == query.Limit {
+			break
+		}
+		if r.removed || !query.Matches(r.event, r.timestamp) {
+			continue
+		}
+		envelope := r.envelope()
+		envelope.Position = eventhorizon.Position(strconv.Itoa(i + 1))
+		envelopes = append(envelopes, envelope)
+	}
+	return envelopes, nil
+}
+
+// Subscribe returns a channel that receives the events saved after the call.
+// Saving blocks until all subscribers have received the events, or their
+// contexts are done.
+func (s *EventStore) Subscribe(ctx context.Context) <-chan eventhorizon.EventEnvelope {
+	ch := make(chan eventhorizon.EventEnvelope, 100)
+	s.subscribersMu.Lock()
+	s.subscribers[ch] = ctx
+	s.subscribersMu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		s.subscribersMu.Lock()
+		delete(s.subscribers, ch)
+		close(ch)
+		s.subscribersMu.Unlock()
+	}()
+	return ch
+}
+
+// notify sends the events from a position in the log to the subscribers.
+func (s *EventStore) notify(from int) {
+	s.subscribersMu.Lock()
+	defer s.subscribersMu.Unlock()
+	if len(s.subscribers) == 0 {
+		return
+	}
+
+	envelopes, _, _ := s.LoadAll(context.Background(), eventhorizon.Position(strconv.Itoa(from)), 0)
+	for ch, ctx := range s.subscribers {
+		for _, envelope := range envelopes {
+			select {
+			case ch <- envelope:
+			case <-ctx.Done():
+			}
+		}
+	}
+}
+
 type memoryAggregateRecord struct {
 	aggregateID eventhorizon.UUID
 	version     int
 	events      []*memoryEventRecord
+	deleted     bool
 }
 
 type memoryEventRecord struct {
@@ -95,6 +540,17 @@ type memoryEventRecord struct {
 	version   int
 	timestamp time.Time
 	event     eventhorizon.Event
+	headers   eventhorizon.Headers
+	removed   bool // Truncated or purged, but kept in the log for positions.
+}
+
+func (r *memoryEventRecord) envelope() eventhorizon.EventEnvelope {
+	return eventhorizon.EventEnvelope{
+		Event:     r.event,
+		Version:   r.version,
+		Timestamp: r.timestamp,
+		Headers:   r.headers,
+	}
 }
 
 // ErrNoEventStoreDefined is if no event store has been defined.
@@ -15,8 +15,10 @@
 package memory
 
 import (
+	"context"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/looplab/eventhorizon"
 	"github.com/looplab/eventhorizon/testutil"
@@ -219,3 +221,688 @@ func TestTraceEventStore(t *testing.T) {
 		t.Error("the loaded events should be correct:", events)
 	}
 }
+
+func TestEventStoreClock(t *testing.T) {
+	now := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := NewEventStore(nil, WithClock(testutil.NewMockClock(now)))
+
+	id := eventhorizon.NewUUID()
+	if err := store.Save([]eventhorizon.Event{&testutil.TestEvent{id, "event1"}}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if ts := store.aggregateRecords[id].events[0].timestamp; !ts.Equal(now) {
+		t.Error("the timestamp should be from the clock:", ts)
+	}
+}
+
+func TestEventStoreLoadIterator(t *testing.T) {
+	store := NewEventStore(nil)
+	id := eventhorizon.NewUUID()
+	event1 := &testutil.TestEvent{id, "event1"}
+	event2 := &testutil.TestEvent{id, "event2"}
+	if err := store.Save([]eventhorizon.Event{event1, event2}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	iter, err := store.LoadIterator(id)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	events := []eventhorizon.Event{}
+	for iter.Next() {
+		events = append(events, iter.Event())
+	}
+	if !reflect.DeepEqual(events, []eventhorizon.Event{event1, event2}) {
+		t.Error("the iterated events should be correct:", events)
+	}
+
+	t.Log("iterate events for non-existing aggregate")
+	iter, err = store.LoadIterator(eventhorizon.NewUUID())
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if iter.Next() {
+		t.Error("there should be no events:", iter.Event())
+	}
+}
+
+func TestEventStoreLoadAll(t *testing.T) {
+	store := NewEventStore(nil)
+	ctx := context.Background()
+	id1, id2 := eventhorizon.NewUUID(), eventhorizon.NewUUID()
+	event1 := &testutil.TestEvent{id1, "event1"}
+	event2 := &testutil.TestEvent{id2, "event2"}
+	event3 := &testutil.TestEvent{id1, "event3"}
+	if err := store.Save([]eventhorizon.Event{event1}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := store.Save([]eventhorizon.Event{event2, event3}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	t.Log("load from the start with limit")
+	envelopes, position, err := store.LoadAll(ctx, "", 2)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(envelopes) != 2 || envelopes[0].Event != event1 || envelopes[1].Event != event2 {
+		t.Error("the events should be correct:", envelopes)
+	}
+	if position != envelopes[1].Position {
+		t.Error("the position should be the last event:", position)
+	}
+
+	t.Log("resume from position")
+	envelopes, position, err = store.LoadAll(ctx, position, 0)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(envelopes) != 1 || envelopes[0].Event != event3 {
+		t.Error("the events should be correct:", envelopes)
+	}
+
+	t.Log("no more events")
+	envelopes, _, err = store.LoadAll(ctx, position, 0)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(envelopes) != 0 {
+		t.Error("there should be no events:", envelopes)
+	}
+
+	t.Log("invalid position")
+	if _, _, err = store.LoadAll(ctx, "invalid", 0); err != eventhorizon.ErrInvalidPosition {
+		t.Error("there should be a ErrInvalidPosition error:", err)
+	}
+}
+
+func TestEventStoreSubscribe(t *testing.T) {
+	store := NewEventStore(nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	events := store.Subscribe(ctx)
+
+	t.Log("receive saved events")
+	event1 := &testutil.TestEvent{eventhorizon.NewUUID(), "event1"}
+	event2 := &testutil.TestEvent{eventhorizon.NewUUID(), "event2"}
+	if err := store.Save([]eventhorizon.Event{event1, event2}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	for _, event := range []eventhorizon.Event{event1, event2} {
+		select {
+		case envelope := <-events:
+			if envelope.Event != event {
+				t.Error("the event should be correct:", envelope.Event)
+			}
+		case <-time.After(time.Second):
+			t.Error("there should be an event")
+		}
+	}
+
+	t.Log("close on cancel")
+	cancel()
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Error("the channel should be closed")
+		}
+	case <-time.After(time.Second):
+		t.Error("the channel should be closed")
+	}
+}
+
+func TestEventStoreDelete(t *testing.T) {
+	bus := &testutil.MockEventBus{
+		Events: make([]eventhorizon.Event, 0),
+	}
+	store := NewEventStore(bus)
+	id := eventhorizon.NewUUID()
+	event1 := &testutil.TestEvent{id, "event1"}
+	if err := store.Save([]eventhorizon.Event{event1}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	t.Log("delete aggregate")
+	if err := store.Delete(id); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	tombstone := &eventhorizon.AggregateDeleted{id, "Test"}
+	if !reflect.DeepEqual(bus.Events, []eventhorizon.Event{event1, tombstone}) {
+		t.Error("the tombstone should be published:", bus.Events)
+	}
+	if _, err := store.Load(id); err != eventhorizon.ErrAggregateDeleted {
+		t.Error("there should be a ErrAggregateDeleted error:", err)
+	}
+	if err := store.Save([]eventhorizon.Event{event1}); err != eventhorizon.ErrAggregateDeleted {
+		t.Error("there should be a ErrAggregateDeleted error:", err)
+	}
+	if err := store.Delete(id); err != eventhorizon.ErrAggregateDeleted {
+		t.Error("there should be a ErrAggregateDeleted error:", err)
+	}
+
+	t.Log("the history is kept")
+	envelopes, _, err := store.LoadAll(context.Background(), "", 0)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(envelopes) != 2 || envelopes[1].Event != bus.Events[1] {
+		t.Error("the history should be kept:", envelopes)
+	}
+
+	t.Log("delete non-existing aggregate")
+	if err := store.Delete(eventhorizon.NewUUID()); err != eventhorizon.ErrNoEventsFound {
+		t.Error("there should be a ErrNoEventsFound error:", err)
+	}
+}
+
+func TestEventStoreTruncate(t *testing.T) {
+	store := NewEventStore(nil)
+	snapshots := NewSnapshotStore()
+	id := eventhorizon.NewUUID()
+	event1 := &testutil.TestEvent{id, "event1"}
+	event2 := &testutil.TestEvent{id, "event2"}
+	event3 := &testutil.TestEvent{id, "event3"}
+	if err := store.Save([]eventhorizon.Event{event1, event2, event3}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	t.Log("truncate without snapshot store")
+	if err := store.TruncateBefore(id, 2); err != eventhorizon.ErrNoNewerSnapshot {
+		t.Error("there should be a ErrNoNewerSnapshot error:", err)
+	}
+
+	t.Log("truncate with older snapshot")
+	store.SetSnapshotStore(snapshots)
+	snapshots.SaveSnapshot(&eventhorizon.Snapshot{AggregateID: id, Version: 1})
+	if err := store.TruncateBefore(id, 2); err != eventhorizon.ErrNoNewerSnapshot {
+		t.Error("there should be a ErrNoNewerSnapshot error:", err)
+	}
+
+	t.Log("truncate with newer snapshot")
+	snapshots.SaveSnapshot(&eventhorizon.Snapshot{
+		AggregateID:   id,
+		AggregateType: "Test",
+		Version:       2,
+		State:         []eventhorizon.Event{event1, event2},
+	})
+	if err := store.TruncateBefore(id, 2); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	events, err := store.Load(id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(events, []eventhorizon.Event{event3}) {
+		t.Error("the events should be truncated:", events)
+	}
+
+	t.Log("load the truncated aggregate from the snapshot")
+	repo, _ := eventhorizon.NewCallbackRepository(store)
+	repo.SetSnapshotStore(snapshots)
+	repo.RegisterAggregate(&snapshotAggregate{}, func(id eventhorizon.UUID) eventhorizon.Aggregate {
+		return &snapshotAggregate{AggregateBase: eventhorizon.NewAggregateBase(id)}
+	})
+	agg, err := repo.Load("Test", id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if agg.Version() != 3 {
+		t.Error("the version should be 3:", agg.Version())
+	}
+	if events := agg.(*snapshotAggregate).events; !reflect.DeepEqual(events, []eventhorizon.Event{event1, event2, event3}) {
+		t.Error("the aggregate should have all events:", events)
+	}
+
+	t.Log("purge")
+	if err := store.Purge(id); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, err := store.Load(id); err != eventhorizon.ErrNoEventsFound {
+		t.Error("there should be a ErrNoEventsFound error:", err)
+	}
+	envelopes, _, err := store.LoadAll(context.Background(), "", 0)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(envelopes) != 0 {
+		t.Error("there should be no events:", envelopes)
+	}
+}
+
+// snapshotAggregate keeps the events applied to it, and restores them from
+// snapshots.
+type snapshotAggregate struct {
+	*eventhorizon.AggregateBase
+	events []eventhorizon.Event
+}
+
+func (a *snapshotAggregate) AggregateType() string {
+	return "Test"
+}
+
+func (a *snapshotAggregate) HandleCommand(command eventhorizon.Command) error {
+	return nil
+}
+
+func (a *snapshotAggregate) ApplyEvent(event eventhorizon.Event) {
+	a.events = append(a.events, event)
+}
+
+func (a *snapshotAggregate) ApplySnapshot(snapshot *eventhorizon.Snapshot) error {
+	a.events = append([]eventhorizon.Event(nil), snapshot.State.([]eventhorizon.Event)...)
+	return nil
+}
+
+func TestEventStoreMetadata(t *testing.T) {
+	now := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := NewEventStore(nil, WithClock(testutil.NewMockClock(now)))
+	id := eventhorizon.NewUUID()
+	event1 := &testutil.TestEvent{id, "event1"}
+	event2 := &testutil.TestEvent{id, "event2"}
+
+	t.Log("save with and without headers")
+	headers := eventhorizon.Headers{
+		eventhorizon.HeaderCorrelationID: "correlation",
+		eventhorizon.HeaderUserID:        "user",
+	}
+	ctx := eventhorizon.NewContextWithHeaders(context.Background(), headers)
+	if err := eventhorizon.SaveWithContext(ctx, store, []eventhorizon.Event{event1}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := store.Save([]eventhorizon.Event{event2}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("load envelopes")
+	envelopes, err := store.LoadEnvelopes(id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	expected := []eventhorizon.EventEnvelope{
+		{Event: event1, Version: 0, Timestamp: now, Headers: headers},
+		{Event: event2, Version: 1, Timestamp: now},
+	}
+	if !reflect.DeepEqual(envelopes, expected) {
+		t.Error("the envelopes should be correct:", envelopes)
+	}
+
+	t.Log("load all")
+	envelopes, _, err = store.LoadAll(context.Background(), "", 1)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(envelopes) != 1 || !reflect.DeepEqual(envelopes[0].Headers, headers) {
+		t.Error("the headers should be loaded:", envelopes)
+	}
+
+	t.Log("load non-existing aggregate")
+	if _, err := store.LoadEnvelopes(eventhorizon.NewUUID()); err != eventhorizon.ErrNoEventsFound {
+		t.Error("there should be a ErrNoEventsFound error:", err)
+	}
+}
+
+func TestEventStoreVersionConflict(t *testing.T) {
+	store := NewEventStore(nil)
+	ctx := context.Background()
+	id := eventhorizon.NewUUID()
+	event1 := &testutil.TestEvent{id, "event1"}
+	event2 := &testutil.TestEvent{id, "event2"}
+	event3 := &testutil.TestEvent{id, "event3"}
+	if err := store.SaveWithVersion(ctx, []eventhorizon.Event{event1}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	t.Log("save from the same original version twice")
+	if err := store.SaveWithVersion(ctx, []eventhorizon.Event{event2}, 1); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	err := store.SaveWithVersion(ctx, []eventhorizon.Event{event3}, 1)
+	expected := eventhorizon.ErrVersionConflict{
+		AggregateID:       id,
+		ExpectedVersion:   1,
+		ActualVersion:     2,
+		ConflictingEvents: []eventhorizon.Event{event2},
+	}
+	if !reflect.DeepEqual(err, expected) {
+		t.Error("there should be a version conflict:", err)
+	}
+	if events, _ := store.Load(id); !reflect.DeepEqual(events, []eventhorizon.Event{event1, event2}) {
+		t.Error("the conflicting events should not be saved:", events)
+	}
+
+	t.Log("save a new aggregate that exists")
+	err = store.SaveWithVersion(ctx, []eventhorizon.Event{event3}, 0)
+	if conflict, ok := err.(eventhorizon.ErrVersionConflict); !ok ||
+		conflict.ExpectedVersion != 0 || conflict.ActualVersion != 2 {
+		t.Error("there should be a version conflict:", err)
+	}
+}
+
+func TestEventStoreInspect(t *testing.T) {
+	now := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := NewEventStore(nil, WithClock(testutil.NewMockClock(now)))
+	id1 := eventhorizon.UUID("c1138e5f-f6fb-4dd0-8e79-255c6c8d3756")
+	id2 := eventhorizon.UUID("c1138e5f-f6fb-4dd0-8e79-255c6c8d3757")
+	event1 := &testutil.TestEvent{id1, "event1"}
+	event2 := &testutil.TestEvent{id1, "event2"}
+	event3 := &testutil.TestEvent{id2, "event3"}
+	if err := store.Save([]eventhorizon.Event{event3, event1, event2}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("list streams")
+	streams, err := store.Streams(context.Background())
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	expectedStreams := []eventhorizon.StreamInfo{
+		{AggregateID: id1, AggregateType: "Test", Version: 1, Events: 2},
+		{AggregateID: id2, AggregateType: "Test", Version: 0, Events: 1},
+	}
+	if !reflect.DeepEqual(streams, expectedStreams) {
+		t.Error("the streams should be correct:", streams)
+	}
+
+	t.Log("load stored events of a deleted aggregate")
+	if err := store.Delete(id2); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	events, err := store.LoadStored(context.Background(), id2)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(events) != 2 || events[1].Type != "AggregateDeleted" {
+		t.Error("the events should include the tombstone:", events)
+	}
+	expected := eventhorizon.StoredEvent{
+		Type:          "TestEvent",
+		AggregateType: "Test",
+		AggregateID:   id2,
+		Timestamp:     now,
+		Data:          event3,
+	}
+	if len(events) > 0 && !reflect.DeepEqual(events[0], expected) {
+		t.Error("the event should be correct:", events[0])
+	}
+
+	t.Log("load non-existing aggregate")
+	if _, err := store.LoadStored(context.Background(), eventhorizon.NewUUID()); err != eventhorizon.ErrNoEventsFound {
+		t.Error("there should be a ErrNoEventsFound error:", err)
+	}
+}
+
+func TestEventStoreFindEvents(t *testing.T) {
+	clock := testutil.NewMockClock(time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC))
+	store := NewEventStore(nil, WithClock(clock))
+	id := eventhorizon.NewUUID()
+	event1 := &testutil.TestEvent{id, "event1"}
+	event2 := &testutil.TestEventOther{id, "event2"}
+	event3 := &testutil.TestEvent{id, "event3"}
+	for _, event := range []eventhorizon.Event{event1, event2, event3} {
+		if err := store.Save([]eventhorizon.Event{event}); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+		clock.Advance(time.Hour)
+	}
+
+	t.Log("find by event type")
+	ctx := context.Background()
+	envelopes, err := store.FindEvents(ctx, eventhorizon.Query{
+		EventTypes: []string{event1.EventType()},
+	})
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(envelopes) != 2 || envelopes[0].Event != event1 || envelopes[1].Event != event3 {
+		t.Error("the events should be correct:", envelopes)
+	}
+
+	t.Log("find by time range with limit")
+	envelopes, err = store.FindEvents(ctx, eventhorizon.Query{
+		From:  time.Date(2016, 1, 1, 1, 0, 0, 0, time.UTC),
+		To:    time.Date(2016, 1, 1, 3, 0, 0, 0, time.UTC),
+		Limit: 1,
+	})
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(envelopes) != 1 || envelopes[0].Event != event2 || envelopes[0].Position != "2" {
+		t.Error("the events should be correct:", envelopes)
+	}
+
+	t.Log("find by aggregate type")
+	envelopes, err = store.FindEvents(ctx, eventhorizon.Query{AggregateType: "Other"})
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(envelopes) != 0 {
+		t.Error("there should be no events:", envelopes)
+	}
+}
+
+func TestEventStoreCompaction(t *testing.T) {
+	snapshots := NewSnapshotStore()
+	store := NewEventStore(nil)
+	store.SetSnapshotStore(snapshots)
+	archive := NewEventStore(nil)
+	compactor := eventhorizon.NewCompactor(store, archive, snapshots)
+	id := eventhorizon.NewUUID()
+	event1 := &testutil.TestEvent{id, "event1"}
+	event2 := &testutil.TestEvent{id, "event2"}
+	event3 := &testutil.TestEvent{id, "event3"}
+	headers := eventhorizon.Headers{eventhorizon.HeaderUserID: "user"}
+	ctx := eventhorizon.NewContextWithHeaders(context.Background(), headers)
+	if err := store.SaveWithContext(ctx, []eventhorizon.Event{event1, event2, event3}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	t.Log("compact without snapshot")
+	if err := compactor.Compact(id); err != eventhorizon.ErrSnapshotNotFound {
+		t.Error("there should be a ErrSnapshotNotFound error:", err)
+	}
+
+	t.Log("compact with snapshot")
+	snapshots.SaveSnapshot(&eventhorizon.Snapshot{AggregateID: id, Version: 2})
+	if err := compactor.Compact(id); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	events, _ := store.Load(id)
+	if !reflect.DeepEqual(events, []eventhorizon.Event{event3}) {
+		t.Error("the events should be truncated:", events)
+	}
+	envelopes, _ := archive.LoadEnvelopes(id)
+	if len(envelopes) != 2 || envelopes[1].Event != event2 ||
+		envelopes[1].Headers[eventhorizon.HeaderUserID] != "user" {
+		t.Error("the events should be archived:", envelopes)
+	}
+
+	t.Log("compact again")
+	if err := compactor.Compact(id); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if envelopes, _ := archive.LoadEnvelopes(id); len(envelopes) != 2 {
+		t.Error("the events should not be archived again:", envelopes)
+	}
+
+	t.Log("load from archive")
+	archived := eventhorizon.NewArchivedEventStore(store, archive)
+	events, err := archived.Load(id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(events, []eventhorizon.Event{event1, event2, event3}) {
+		t.Error("the events should be correct:", events)
+	}
+}
+
+func TestEventStoreApplyRetention(t *testing.T) {
+	now := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := testutil.NewMockClock(now)
+	store := NewEventStore(nil, WithClock(clock))
+	id1 := eventhorizon.NewUUID()
+	id2 := eventhorizon.NewUUID()
+	event1 := &testutil.TestEvent{id1, "event1"}
+	event2 := &testutil.TestEvent{id1, "event2"}
+	event3 := &testutil.TestEvent{id2, "event3"}
+	if err := store.Save([]eventhorizon.Event{event1, event3}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	clock.Advance(2 * time.Hour)
+	if err := store.Save([]eventhorizon.Event{event2}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	t.Log("exempt aggregate type")
+	ctx := context.Background()
+	policy := eventhorizon.RetentionPolicy{MaxAge: time.Hour, Exempt: []string{"Test"}}
+	if err := store.ApplyRetention(ctx, policy, clock.Now()); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if events, _ := store.Load(id1); len(events) != 2 {
+		t.Error("the events should be retained:", events)
+	}
+
+	t.Log("by age without snapshots")
+	policy.Exempt = nil
+	if err := store.ApplyRetention(ctx, policy, clock.Now()); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if events, _ := store.Load(id1); len(events) != 2 {
+		t.Error("the events should be retained without a snapshot:", events)
+	}
+	if _, err := store.Load(id2); err != eventhorizon.ErrNoEventsFound {
+		t.Error("the aggregate should be removed:", err)
+	}
+
+	t.Log("by age with a snapshot")
+	snapshots := NewSnapshotStore()
+	store.SetSnapshotStore(snapshots)
+	snapshots.SaveSnapshot(&eventhorizon.Snapshot{AggregateID: id1, Version: 1})
+	if err := store.ApplyRetention(ctx, policy, clock.Now()); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if events, _ := store.Load(id1); !reflect.DeepEqual(events, []eventhorizon.Event{event2}) {
+		t.Error("the old events should be removed:", events)
+	}
+
+	t.Log("by size as far as the snapshot covers")
+	event4 := &testutil.TestEvent{id1, "event4"}
+	if err := store.Save([]eventhorizon.Event{event4}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	policy = eventhorizon.RetentionPolicy{MaxEvents: 1}
+	if err := store.ApplyRetention(ctx, policy, clock.Now()); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if events, _ := store.Load(id1); !reflect.DeepEqual(events, []eventhorizon.Event{event2, event4}) {
+		t.Error("the events after the snapshot should be retained:", events)
+	}
+
+	t.Log("by size")
+	snapshots.SaveSnapshot(&eventhorizon.Snapshot{AggregateID: id1, Version: 2})
+	if err := store.ApplyRetention(ctx, policy, clock.Now()); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if events, _ := store.Load(id1); !reflect.DeepEqual(events, []eventhorizon.Event{event4}) {
+		t.Error("the events should be limited:", events)
+	}
+	if envelopes, _, _ := store.LoadAll(ctx, "", 0); len(envelopes) != 1 {
+		t.Error("the removed events should not be loaded:", envelopes)
+	}
+}
+
+func TestEventStoreImport(t *testing.T) {
+	now := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	source := NewEventStore(nil, WithClock(testutil.NewMockClock(now)))
+	id1 := eventhorizon.NewUUID()
+	id2 := eventhorizon.NewUUID()
+	headers := eventhorizon.Headers{eventhorizon.HeaderUserID: "user"}
+	ctx := eventhorizon.NewContextWithHeaders(context.Background(), headers)
+	if err := source.SaveWithContext(ctx, []eventhorizon.Event{
+		&testutil.TestEvent{id1, "event1"},
+		&testutil.TestEvent{id2, "event2"},
+		&testutil.TestEvent{id1, "event3"},
+	}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	exported, _, err := source.LoadAll(context.Background(), "", 0)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	t.Log("import an export")
+	bus := &testutil.MockEventBus{Events: make([]eventhorizon.Event, 0)}
+	store := NewEventStore(bus)
+	ch := make(chan eventhorizon.EventEnvelope, len(exported))
+	for _, envelope := range exported {
+		ch <- envelope
+	}
+	close(ch)
+	n, err := eventhorizon.ImportStream(context.Background(), store, ch, 2)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if n != 3 {
+		t.Error("all events should be imported:", n)
+	}
+	expected, _ := source.LoadEnvelopes(id1)
+	if envelopes, _ := store.LoadEnvelopes(id1); !reflect.DeepEqual(envelopes, expected) {
+		t.Error("the envelopes should be imported as exported:", envelopes)
+	}
+	if len(bus.Events) != 0 {
+		t.Error("the imported events should not be published:", bus.Events)
+	}
+
+	t.Log("import an event that doesn't follow the stored ones")
+	err = store.Import(context.Background(), []eventhorizon.EventEnvelope{
+		{Event: &testutil.TestEvent{id1, "event4"}, Version: 1},
+	})
+	if conflict, ok := err.(eventhorizon.ErrVersionConflict); !ok ||
+		conflict.ExpectedVersion != 1 || conflict.ActualVersion != 1 {
+		t.Error("there should be a version conflict:", err)
+	}
+
+	t.Log("append after an import")
+	if err := store.Save([]eventhorizon.Event{&testutil.TestEvent{id1, "event4"}}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if envelopes, _ := store.LoadEnvelopes(id1); len(envelopes) != 3 || envelopes[2].Version != 2 {
+		t.Error("the event should follow the imported ones:", envelopes)
+	}
+}
+
+func TestEventStoreStats(t *testing.T) {
+	now := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := testutil.NewMockClock(now)
+	store := NewEventStore(nil, WithClock(clock))
+
+	t.Log("save two events")
+	id := eventhorizon.NewUUID()
+	clock.Advance(time.Second)
+	if err := store.Save([]eventhorizon.Event{
+		&testutil.TestEvent{id, "event1"},
+		&testutil.TestEvent{id, "event2"},
+	}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	clock.Advance(time.Second)
+	stats := store.Stats()
+	expected := eventhorizon.ComponentStats{
+		Events:     2,
+		LastEvent:  now.Add(time.Second),
+		Throughput: 1,
+	}
+	if !reflect.DeepEqual(stats, expected) {
+		t.Error("the stats should be correct:", stats)
+	}
+
+	t.Log("save to a deleted aggregate")
+	if err := store.Delete(id); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := store.Save([]eventhorizon.Event{&testutil.TestEvent{id, "event3"}}); err != eventhorizon.ErrAggregateDeleted {
+		t.Error("there should be a ErrAggregateDeleted error:", err)
+	}
+	if stats := store.Stats(); stats.Errors != 1 {
+		t.Error("there should be one error:", stats.Errors)
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"sync"
+	"time"
+
+	"github.com/looplab/eventhorizon"
+)
+
+// Lock implements Lock in memory, for use within one process.
+type Lock struct {
+	locks map[string]memoryLock
+	clock eventhorizon.Clock
+	mu    sync.Mutex
+}
+
+type memoryLock struct {
+	token   string
+	expires time.Time
+}
+
+// NewLock creates a new Lock. The clock is used for expiring locks.
+func NewLock(clock eventhorizon.Clock) *Lock {
+	return &Lock{
+		locks: make(map[string]memoryLock),
+		clock: clock,
+	}
+}
+
+// TryLock acquires the lock of a key for a TTL if it is free.
+func (l *Lock) TryLock(key string, ttl time.Duration) (string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.clock.Now()
+	if existing, ok := l.locks[key]; ok && existing.expires.After(now) {
+		return "", eventhorizon.ErrLockHeld
+	}
+	token := eventhorizon.NewUUID().String()
+	l.locks[key] = memoryLock{token, now.Add(ttl)}
+	return token, nil
+}
+
+// Unlock releases the lock of a key held with a token.
+func (l *Lock) Unlock(key, token string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.held(key, token) {
+		return eventhorizon.ErrLockNotHeld
+	}
+	delete(l.locks, key)
+	return nil
+}
+
+// Refresh extends the lock of a key held with a token to a new TTL.
+func (l *Lock) Refresh(key, token string, ttl time.Duration) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.held(key, token) {
+		return eventhorizon.ErrLockNotHeld
+	}
+	l.locks[key] = memoryLock{token, l.clock.Now().Add(ttl)}
+	return nil
+}
+
+func (l *Lock) held(key, token string) bool {
+	existing, ok := l.locks[key]
+	return ok && existing.token == token && existing.expires.After(l.clock.Now())
+}
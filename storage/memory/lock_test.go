@@ -0,0 +1,64 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"testing"
+	"time"
+
+	"github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/testutil"
+)
+
+func TestLock(t *testing.T) {
+	clock := testutil.NewMockClock(time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC))
+	lock := NewLock(clock)
+
+	t.Log("lock and unlock")
+	token, err := lock.TryLock("key", time.Minute)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, err := lock.TryLock("key", time.Minute); err != eventhorizon.ErrLockHeld {
+		t.Error("there should be a ErrLockHeld error:", err)
+	}
+	if _, err := lock.TryLock("other", time.Minute); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := lock.Unlock("key", "wrong"); err != eventhorizon.ErrLockNotHeld {
+		t.Error("there should be a ErrLockNotHeld error:", err)
+	}
+	if err := lock.Unlock("key", token); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("refresh and expire")
+	token, _ = lock.TryLock("key", time.Minute)
+	clock.Advance(50 * time.Second)
+	if err := lock.Refresh("key", token, time.Minute); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	clock.Advance(50 * time.Second)
+	if _, err := lock.TryLock("key", time.Minute); err != eventhorizon.ErrLockHeld {
+		t.Error("there should be a ErrLockHeld error:", err)
+	}
+	clock.Advance(time.Minute)
+	if err := lock.Refresh("key", token, time.Minute); err != eventhorizon.ErrLockNotHeld {
+		t.Error("there should be a ErrLockNotHeld error:", err)
+	}
+	if _, err := lock.TryLock("key", time.Minute); err != nil {
+		t.Error("there should be no error:", err)
+	}
+}
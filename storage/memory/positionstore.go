@@ -0,0 +1,50 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/looplab/eventhorizon"
+)
+
+// PositionStore implements PositionStore as an in memory structure.
+type PositionStore struct {
+	positions map[string]eventhorizon.Position
+	mu        sync.RWMutex
+}
+
+// NewPositionStore creates a new PositionStore.
+func NewPositionStore() *PositionStore {
+	return &PositionStore{
+		positions: make(map[string]eventhorizon.Position),
+	}
+}
+
+// LoadPosition loads a position, which is empty if none is saved.
+func (s *PositionStore) LoadPosition(ctx context.Context, name string) (eventhorizon.Position, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.positions[name], nil
+}
+
+// SavePosition saves a position.
+func (s *PositionStore) SavePosition(ctx context.Context, name string, position eventhorizon.Position) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.positions[name] = position
+	return nil
+}
@@ -0,0 +1,40 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"context"
+	"testing"
+)
+
+func TestPositionStore(t *testing.T) {
+	store := NewPositionStore()
+	ctx := context.Background()
+
+	position, err := store.LoadPosition(ctx, "replica")
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if position != "" {
+		t.Error("there should be no position:", position)
+	}
+
+	if err := store.SavePosition(ctx, "replica", "42"); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if position, _ = store.LoadPosition(ctx, "replica"); position != "42" {
+		t.Error("the position should be correct:", position)
+	}
+}
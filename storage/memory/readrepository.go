@@ -15,33 +15,88 @@
 package memory
 
 import (
+	"context"
+	"hash/fnv"
+	"reflect"
+	"sync"
+	"time"
+
 	"github.com/looplab/eventhorizon"
 )
 
-// ReadRepository implements an in memory repository of read models.
+// shardCount is the number of shards in a ReadRepository.
+const shardCount = 32
+
+// ReadRepository implements an in memory repository of read models. The models
+// are sharded by ID so that concurrent access to different models does not
+// contend for the same lock.
+//
+// Models are copied when read, so that callers can modify the returned models
+// without affecting the stored ones. The copy is shallow; pointers, maps and
+// slices inside a model are shared.
+//
+// Fields can be indexed with AddIndex, for lookups of models by field value
+// without scanning all models. The fields are indexed when models are saved,
+// so saved models must not be modified.
+//
+// Models can be soft deleted, see eventhorizon.SoftDeleteReadRepository. Soft
+// deleted models are kept apart from the others and are not indexed.
 type ReadRepository struct {
-	data map[eventhorizon.UUID]interface{}
+	shards  [shardCount]*readShard
+	indexes map[string]fieldIndex
+	indexMu sync.RWMutex
+}
+
+// fieldIndex is the IDs of the models by the value of a field.
+type fieldIndex map[interface{}]map[eventhorizon.UUID]struct{}
+
+type readShard struct {
+	data    map[eventhorizon.UUID]interface{}
+	deleted map[eventhorizon.UUID]interface{}
+	mu      sync.RWMutex
 }
 
 // NewReadRepository creates a new ReadRepository.
 func NewReadRepository() *ReadRepository {
 	r := &ReadRepository{
-		data: make(map[eventhorizon.UUID]interface{}),
+		indexes: make(map[string]fieldIndex),
+	}
+	for i := range r.shards {
+		r.shards[i] = &readShard{
+			data:    make(map[eventhorizon.UUID]interface{}),
+			deleted: make(map[eventhorizon.UUID]interface{}),
+		}
 	}
 	return r
 }
 
-// Save saves a read model with id to the repository.
+// Save saves a read model with id to the repository. A soft deleted model is
+// kept deleted.
 func (r *ReadRepository) Save(id eventhorizon.UUID, model interface{}) error {
-	r.data[id] = model
+	shard := r.shard(id)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	if _, ok := shard.deleted[id]; ok {
+		shard.deleted[id] = model
+		return nil
+	}
+	if old, ok := shard.data[id]; ok {
+		r.unindex(id, old)
+	}
+	shard.data[id] = model
+	r.index(id, model)
 	return nil
 }
 
 // Find returns one read model with using an id. Returns
 // ErrModelNotFound if no model could be found.
 func (r *ReadRepository) Find(id eventhorizon.UUID) (interface{}, error) {
-	if model, ok := r.data[id]; ok {
-		return model, nil
+	shard := r.shard(id)
+	shard.mu.RLock()
+	model, ok := shard.data[id]
+	shard.mu.RUnlock()
+	if ok {
+		return copyModel(model), nil
 	}
 
 	return nil, eventhorizon.ErrModelNotFound
@@ -50,19 +105,255 @@ func (r *ReadRepository) Find(id eventhorizon.UUID) (interface{}, error) {
 // FindAll returns all read models in the repository.
 func (r *ReadRepository) FindAll() ([]interface{}, error) {
 	models := []interface{}{}
-	for _, model := range r.data {
-		models = append(models, model)
+	for _, shard := range r.shards {
+		shard.mu.RLock()
+		for _, model := range shard.data {
+			models = append(models, model)
+		}
+		shard.mu.RUnlock()
+	}
+	for i, model := range models {
+		models[i] = copyModel(model)
 	}
 	return models, nil
 }
 
-// Remove removes a read model with id from the repository. Returns
-// ErrModelNotFound if no model could be found.
+// FindQuery returns the read models matching a query.
+func (r *ReadRepository) FindQuery(ctx context.Context, query *eventhorizon.ModelQuery) ([]interface{}, error) {
+	for _, c := range query.Conditions {
+		if c.Operator != eventhorizon.Eq {
+			continue
+		}
+		if models, ok := r.findIndexed(c.Field, c.Value); ok {
+			return query.Apply(models), nil
+		}
+	}
+
+	models, err := r.FindAll()
+	if err != nil {
+		return nil, err
+	}
+	return query.Apply(models), nil
+}
+
+// AddIndex indexes a field of the models, named as in a ModelQuery, which is
+// used by FindByField and FindQuery. Existing models are indexed as well.
+func (r *ReadRepository) AddIndex(field string) {
+	r.indexMu.Lock()
+	if _, ok := r.indexes[field]; ok {
+		r.indexMu.Unlock()
+		return
+	}
+	r.indexes[field] = make(fieldIndex)
+	r.indexMu.Unlock()
+
+	for _, shard := range r.shards {
+		shard.mu.RLock()
+		r.indexMu.Lock()
+		for id, model := range shard.data {
+			r.indexes[field].add(field, id, model)
+		}
+		r.indexMu.Unlock()
+		shard.mu.RUnlock()
+	}
+}
+
+// FindByField returns the read models with a field equal to a value. The
+// lookup uses the index of the field if there is one, otherwise all models are
+// scanned.
+func (r *ReadRepository) FindByField(field string, value interface{}) ([]interface{}, error) {
+	query := eventhorizon.Where(field, eventhorizon.Eq, value)
+	if models, ok := r.findIndexed(field, value); ok {
+		return query.Apply(models), nil
+	}
+	return r.FindQuery(context.Background(), query)
+}
+
+// findIndexed returns the models with a value in the index of a field, or
+// false if the field is not indexed.
+func (r *ReadRepository) findIndexed(field string, value interface{}) ([]interface{}, bool) {
+	key, ok := indexKey(value)
+	if !ok {
+		return nil, false
+	}
+
+	r.indexMu.RLock()
+	index, ok := r.indexes[field]
+	if !ok {
+		r.indexMu.RUnlock()
+		return nil, false
+	}
+	ids := make([]eventhorizon.UUID, 0, len(index[key]))
+	for id := range index[key] {
+		ids = append(ids, id)
+	}
+	r.indexMu.RUnlock()
+
+	models := []interface{}{}
+	for _, id := range ids {
+		// Models removed meanwhile are skipped.
+		if model, err := r.Find(id); err == nil {
+			models = append(models, model)
+		}
+	}
+	return models, true
+}
+
+// index adds a model to all indexes. It is called with the lock of the shard of
+// the model held.
+func (r *ReadRepository) index(id eventhorizon.UUID, model interface{}) {
+	r.indexMu.Lock()
+	defer r.indexMu.Unlock()
+	for field, index := range r.indexes {
+		index.add(field, id, model)
+	}
+}
+
+// unindex removes a model from all indexes. It is called with the lock of the
+// shard of the model held.
+func (r *ReadRepository) unindex(id eventhorizon.UUID, model interface{}) {
+	r.indexMu.Lock()
+	defer r.indexMu.Unlock()
+	for field, index := range r.indexes {
+		value, ok := eventhorizon.FieldValue(model, field)
+		if !ok {
+			continue
+		}
+		key, ok := indexKey(value)
+		if !ok {
+			continue
+		}
+		delete(index[key], id)
+		if len(index[key]) == 0 {
+			delete(index, key)
+		}
+	}
+}
+
+func (i fieldIndex) add(field string, id eventhorizon.UUID, model interface{}) {
+	value, ok := eventhorizon.FieldValue(model, field)
+	if !ok {
+		return
+	}
+	key, ok := indexKey(value)
+	if !ok {
+		return
+	}
+	if i[key] == nil {
+		i[key] = make(map[eventhorizon.UUID]struct{})
+	}
+	i[key][id] = struct{}{}
+}
+
+// timeKey is the index key of a time, as times that are equal can have
+// different locations.
+type timeKey int64
+
+// indexKey returns the key of a value in an index, so that values that are
+// equal in a query have the same key. Returns false for values that can't be
+// used as keys.
+func indexKey(value interface{}) (interface{}, bool) {
+	if t, ok := value.(time.Time); ok {
+		return timeKey(t.UnixNano()), true
+	}
+
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Invalid:
+		return nil, true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	case reflect.String:
+		return v.String(), true
+	case reflect.Bool:
+		return v.Bool(), true
+	}
+	return nil, false
+}
+
+// Remove removes a read model with id from the repository, also if it is soft
+// deleted. Returns ErrModelNotFound if no model could be found.
 func (r *ReadRepository) Remove(id eventhorizon.UUID) error {
-	if _, ok := r.data[id]; ok {
-		delete(r.data, id)
+	shard := r.shard(id)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	if model, ok := shard.data[id]; ok {
+		r.unindex(id, model)
+		delete(shard.data, id)
+		return nil
+	}
+	if _, ok := shard.deleted[id]; ok {
+		delete(shard.deleted, id)
 		return nil
 	}
 
 	return eventhorizon.ErrModelNotFound
 }
+
+// SoftDelete implements the SoftDelete method of the
+// eventhorizon.SoftDeleteReadRepository interface.
+func (r *ReadRepository) SoftDelete(ctx context.Context, id eventhorizon.UUID) error {
+	shard := r.shard(id)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	model, ok := shard.data[id]
+	if !ok {
+		return eventhorizon.ErrModelNotFound
+	}
+	r.unindex(id, model)
+	delete(shard.data, id)
+	shard.deleted[id] = model
+	return nil
+}
+
+// Restore implements the Restore method of the
+// eventhorizon.SoftDeleteReadRepository interface.
+func (r *ReadRepository) Restore(ctx context.Context, id eventhorizon.UUID) error {
+	shard := r.shard(id)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	model, ok := shard.deleted[id]
+	if !ok {
+		return eventhorizon.ErrModelNotFound
+	}
+	delete(shard.deleted, id)
+	shard.data[id] = model
+	r.index(id, model)
+	return nil
+}
+
+// FindDeleted implements the FindDeleted method of the
+// eventhorizon.SoftDeleteReadRepository interface.
+func (r *ReadRepository) FindDeleted(ctx context.Context) ([]interface{}, error) {
+	models := []interface{}{}
+	for _, shard := range r.shards {
+		shard.mu.RLock()
+		for _, model := range shard.deleted {
+			models = append(models, copyModel(model))
+		}
+		shard.mu.RUnlock()
+	}
+	return models, nil
+}
+
+func (r *ReadRepository) shard(id eventhorizon.UUID) *readShard {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return r.shards[h.Sum32()%shardCount]
+}
+
+// copyModel returns a shallow copy of a model that is a pointer, other models
+// are already copied by value.
+func copyModel(model interface{}) interface{} {
+	v := reflect.ValueOf(model)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return model
+	}
+	c := reflect.New(v.Elem().Type())
+	c.Elem().Set(v.Elem())
+	return c.Interface()
+}
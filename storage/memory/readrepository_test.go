@@ -15,7 +15,9 @@
 package memory
 
 import (
+	"context"
 	"reflect"
+	"sync"
 	"testing"
 	"time"
 
@@ -126,3 +128,230 @@ func TestReadRepository(t *testing.T) {
 		t.Error("there should be a ErrModelNotFound error:", err)
 	}
 }
+
+func TestReadRepositoryFindQuery(t *testing.T) {
+	repo := NewReadRepository()
+	now := time.Now().Round(time.Millisecond)
+	model1 := &testutil.TestModel{eventhorizon.NewUUID(), "b", now}
+	model2 := &testutil.TestModel{eventhorizon.NewUUID(), "a", now.Add(time.Second)}
+	model3 := &testutil.TestModel{eventhorizon.NewUUID(), "c", now.Add(2 * time.Second)}
+	for _, model := range []*testutil.TestModel{model1, model2, model3} {
+		if err := repo.Save(model.ID, model); err != nil {
+			t.Error("there should be no error:", err)
+		}
+	}
+
+	query := eventhorizon.Where("created_at", eventhorizon.Gt, now).OrderBy("content").Limit(1)
+	result, err := repo.FindQuery(context.Background(), query)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(result, []interface{}{model2}) {
+		t.Error("the result should be correct:", result)
+	}
+}
+
+func TestReadRepositoryIndex(t *testing.T) {
+	repo := NewReadRepository()
+	model1 := &testutil.TestModel{eventhorizon.NewUUID(), "a", time.Now().Round(time.Millisecond)}
+	model2 := &testutil.TestModel{eventhorizon.NewUUID(), "b", time.Now().Round(time.Millisecond)}
+	if err := repo.Save(model1.ID, model1); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("index existing models")
+	repo.AddIndex("content")
+	if err := repo.Save(model2.ID, model2); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	result, err := repo.FindByField("content", "b")
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(result, []interface{}{model2}) {
+		t.Error("the result should be correct:", result)
+	}
+	result, err = repo.FindQuery(context.Background(), eventhorizon.Where("content", eventhorizon.Eq, "a"))
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(result, []interface{}{model1}) {
+		t.Error("the result should be correct:", result)
+	}
+
+	t.Log("update an indexed model")
+	model1Alt := &testutil.TestModel{model1.ID, "b", model1.CreatedAt}
+	if err := repo.Save(model1Alt.ID, model1Alt); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if result, _ := repo.FindByField("content", "a"); len(result) != 0 {
+		t.Error("there should be no models:", result)
+	}
+	if result, _ := repo.FindByField("content", "b"); len(result) != 2 {
+		t.Error("there should be two models:", result)
+	}
+
+	t.Log("remove an indexed model")
+	if err := repo.Remove(model2.ID); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if result, _ := repo.FindByField("content", "b"); !reflect.DeepEqual(result, []interface{}{model1Alt}) {
+		t.Error("the result should be correct:", result)
+	}
+
+	t.Log("find by a field without index")
+	result, err = repo.FindByField("created_at", model1.CreatedAt)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(result, []interface{}{model1Alt}) {
+		t.Error("the result should be correct:", result)
+	}
+}
+
+func BenchmarkReadRepositoryFindByField(b *testing.B) {
+	repo := NewReadRepository()
+	repo.AddIndex("content")
+	for i := 0; i < 10000; i++ {
+		id := eventhorizon.NewUUID()
+		repo.Save(id, &testutil.TestModel{ID: id, Content: id.String()})
+	}
+	id := eventhorizon.NewUUID()
+	repo.Save(id, &testutil.TestModel{ID: id, Content: "needle"})
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		repo.FindByField("content", "needle")
+	}
+}
+
+func TestReadRepositoryCopyOnRead(t *testing.T) {
+	repo := NewReadRepository()
+	model1 := &testutil.TestModel{eventhorizon.NewUUID(), "model1", time.Now().Round(time.Millisecond)}
+	if err := repo.Save(model1.ID, model1); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("modify a found model")
+	model, err := repo.Find(model1.ID)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	model.(*testutil.TestModel).Content = "modified"
+	model, err = repo.Find(model1.ID)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if model.(*testutil.TestModel).Content != "model1" {
+		t.Error("the stored item should not be modified:", model)
+	}
+}
+
+func TestReadRepositoryConcurrency(t *testing.T) {
+	repo := NewReadRepository()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				id := eventhorizon.NewUUID()
+				if err := repo.Save(id, &testutil.TestModel{ID: id}); err != nil {
+					t.Error("there should be no error:", err)
+				}
+				if _, err := repo.Find(id); err != nil {
+					t.Error("there should be no error:", err)
+				}
+				if _, err := repo.FindAll(); err != nil {
+					t.Error("there should be no error:", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	result, err := repo.FindAll()
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(result) != 800 {
+		t.Error("there should be 800 items:", len(result))
+	}
+}
+
+func TestReadRepositorySoftDelete(t *testing.T) {
+	ctx := context.Background()
+	repo := NewReadRepository()
+	repo.AddIndex("content")
+	model1 := &testutil.TestModel{eventhorizon.NewUUID(), "a", time.Now().Round(time.Millisecond)}
+	model2 := &testutil.TestModel{eventhorizon.NewUUID(), "b", time.Now().Round(time.Millisecond)}
+	if err := repo.Save(model1.ID, model1); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := repo.Save(model2.ID, model2); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("soft delete a model")
+	if err := repo.SoftDelete(ctx, model1.ID); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, err := repo.Find(model1.ID); err != eventhorizon.ErrModelNotFound {
+		t.Error("there should be a ErrModelNotFound error:", err)
+	}
+	result, err := repo.FindAll()
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(result, []interface{}{model2}) {
+		t.Error("the deleted model should not be found:", result)
+	}
+	if result, _ := repo.FindByField("content", "a"); len(result) != 0 {
+		t.Error("the deleted model should not be indexed:", result)
+	}
+	if err := repo.SoftDelete(ctx, model1.ID); err != eventhorizon.ErrModelNotFound {
+		t.Error("there should be a ErrModelNotFound error:", err)
+	}
+
+	t.Log("save a deleted model")
+	model1Alt := &testutil.TestModel{model1.ID, "c", model1.CreatedAt}
+	if err := repo.Save(model1.ID, model1Alt); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	result, err = repo.FindDeleted(ctx)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(result, []interface{}{model1Alt}) {
+		t.Error("the deleted model should be saved:", result)
+	}
+
+	t.Log("restore a model")
+	if err := repo.Restore(ctx, model1.ID); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	model, err := repo.Find(model1.ID)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(model, model1Alt) {
+		t.Error("the model should be restored:", model)
+	}
+	if result, _ := repo.FindByField("content", "c"); !reflect.DeepEqual(result, []interface{}{model1Alt}) {
+		t.Error("the restored model should be indexed:", result)
+	}
+	if err := repo.Restore(ctx, model1.ID); err != eventhorizon.ErrModelNotFound {
+		t.Error("there should be a ErrModelNotFound error:", err)
+	}
+
+	t.Log("remove a deleted model")
+	if err := repo.SoftDelete(ctx, model2.ID); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := repo.Remove(model2.ID); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if result, _ := repo.FindDeleted(ctx); len(result) != 0 {
+		t.Error("there should be no deleted models:", result)
+	}
+}
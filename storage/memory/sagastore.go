@@ -0,0 +1,75 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"sync"
+
+	"github.com/looplab/eventhorizon"
+)
+
+// SagaStateStore implements SagaStateStore as an in memory structure.
+type SagaStateStore struct {
+	states map[string]eventhorizon.SagaState
+	mu     sync.RWMutex
+}
+
+// NewSagaStateStore creates a new SagaStateStore.
+func NewSagaStateStore() *SagaStateStore {
+	s := &SagaStateStore{
+		states: make(map[string]eventhorizon.SagaState),
+	}
+	return s
+}
+
+// LoadSagaState loads the state of a saga. Returns ErrSagaStateNotFound if
+// there is none.
+func (s *SagaStateStore) LoadSagaState(correlationID string) (*eventhorizon.SagaState, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	state, ok := s.states[correlationID]
+	if !ok {
+		return nil, eventhorizon.ErrSagaStateNotFound
+	}
+	state.State = copyModel(state.State)
+	return &state, nil
+}
+
+// SaveSagaState saves the state of a saga if it has not been saved since it
+// was loaded, and increments its version.
+func (s *SagaStateStore) SaveSagaState(state *eventhorizon.SagaState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.states[state.CorrelationID].Version != state.Version {
+		return eventhorizon.ErrSagaVersionConflict
+	}
+	state.Version++
+	stored := *state
+	stored.State = copyModel(state.State)
+	s.states[state.CorrelationID] = stored
+	return nil
+}
+
+// RemoveSagaState removes the state of a saga. Returns ErrSagaStateNotFound if
+// there is none.
+func (s *SagaStateStore) RemoveSagaState(correlationID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.states[correlationID]; !ok {
+		return eventhorizon.ErrSagaStateNotFound
+	}
+	delete(s.states, correlationID)
+	return nil
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/looplab/eventhorizon"
+)
+
+type orderSaga struct {
+	Paid bool
+}
+
+func TestSagaStateStore(t *testing.T) {
+	store := NewSagaStateStore()
+
+	t.Log("load non-existing state")
+	if _, err := store.LoadSagaState("order"); err != eventhorizon.ErrSagaStateNotFound {
+		t.Error("there should be a ErrSagaStateNotFound error:", err)
+	}
+
+	t.Log("save new state")
+	state := &eventhorizon.SagaState{CorrelationID: "order", State: &orderSaga{}}
+	if err := store.SaveSagaState(state); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if state.Version != 1 {
+		t.Error("the version should be incremented:", state.Version)
+	}
+
+	t.Log("load and save state")
+	loaded1, err := store.LoadSagaState("order")
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	loaded2, _ := store.LoadSagaState("order")
+	loaded1.State.(*orderSaga).Paid = true
+	if err := store.SaveSagaState(loaded1); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("save stale state")
+	if err := store.SaveSagaState(loaded2); err != eventhorizon.ErrSagaVersionConflict {
+		t.Error("there should be a ErrSagaVersionConflict error:", err)
+	}
+	if loaded2.State.(*orderSaga).Paid {
+		t.Error("the loaded states should be copies")
+	}
+	loaded, _ := store.LoadSagaState("order")
+	expected := &eventhorizon.SagaState{CorrelationID: "order", Version: 2, State: &orderSaga{Paid: true}}
+	if !reflect.DeepEqual(loaded, expected) {
+		t.Error("the state should be correct:", loaded)
+	}
+
+	t.Log("remove state")
+	if err := store.RemoveSagaState("order"); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := store.RemoveSagaState("order"); err != eventhorizon.ErrSagaStateNotFound {
+		t.Error("there should be a ErrSagaStateNotFound error:", err)
+	}
+}
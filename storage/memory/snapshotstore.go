@@ -0,0 +1,87 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"sync"
+
+	"github.com/looplab/eventhorizon"
+)
+
+// SnapshotStore implements SnapshotStore as an in memory structure.
+type SnapshotStore struct {
+	snapshots  map[eventhorizon.UUID]*eventhorizon.Snapshot
+	serialized map[eventhorizon.UUID]*eventhorizon.SerializedSnapshot
+	serializer *eventhorizon.SnapshotSerializer
+	mu         sync.RWMutex
+}
+
+// NewSnapshotStore creates a new SnapshotStore.
+func NewSnapshotStore() *SnapshotStore {
+	s := &SnapshotStore{
+		snapshots:  make(map[eventhorizon.UUID]*eventhorizon.Snapshot),
+		serialized: make(map[eventhorizon.UUID]*eventhorizon.SerializedSnapshot),
+	}
+	return s
+}
+
+// SetSerializer sets a serializer that snapshots are kept marshaled with, as
+// in a persistent store, instead of keeping their states as is.
+func (s *SnapshotStore) SetSerializer(serializer *eventhorizon.SnapshotSerializer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.serializer = serializer
+}
+
+// SaveSnapshot saves a snapshot, unless there is a newer one.
+func (s *SnapshotStore) SaveSnapshot(snapshot *eventhorizon.Snapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.serializer != nil {
+		if existing, ok := s.serialized[snapshot.AggregateID]; ok && existing.Version > snapshot.Version {
+			return nil
+		}
+		serialized, err := s.serializer.Marshal(snapshot)
+		if err != nil {
+			return err
+		}
+		s.serialized[snapshot.AggregateID] = serialized
+		return nil
+	}
+
+	if existing, ok := s.snapshots[snapshot.AggregateID]; ok && existing.Version > snapshot.Version {
+		return nil
+	}
+	s.snapshots[snapshot.AggregateID] = snapshot
+	return nil
+}
+
+// LoadSnapshot loads the latest snapshot of an aggregate. Returns
+// ErrSnapshotNotFound if there is none.
+func (s *SnapshotStore) LoadSnapshot(id eventhorizon.UUID) (*eventhorizon.Snapshot, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.serializer != nil {
+		if serialized, ok := s.serialized[id]; ok {
+			return s.serializer.Unmarshal(serialized)
+		}
+		return nil, eventhorizon.ErrSnapshotNotFound
+	}
+
+	if snapshot, ok := s.snapshots[id]; ok {
+		return snapshot, nil
+	}
+	return nil, eventhorizon.ErrSnapshotNotFound
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/testutil"
+)
+
+func TestSnapshotStore(t *testing.T) {
+	store := NewSnapshotStore()
+	id := eventhorizon.NewUUID()
+
+	t.Log("load non-existing snapshot")
+	if _, err := store.LoadSnapshot(id); err != eventhorizon.ErrSnapshotNotFound {
+		t.Error("there should be a ErrSnapshotNotFound error:", err)
+	}
+
+	t.Log("save and load snapshot")
+	snapshot1 := &eventhorizon.Snapshot{AggregateID: id, Version: 2}
+	if err := store.SaveSnapshot(snapshot1); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	snapshot, err := store.LoadSnapshot(id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if snapshot != snapshot1 {
+		t.Error("the snapshot should be correct:", snapshot)
+	}
+
+	t.Log("don't replace with older snapshot")
+	if err := store.SaveSnapshot(&eventhorizon.Snapshot{AggregateID: id, Version: 1}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if snapshot, _ = store.LoadSnapshot(id); snapshot != snapshot1 {
+		t.Error("the snapshot should not be replaced:", snapshot)
+	}
+}
+
+func TestSnapshotStoreSerializer(t *testing.T) {
+	store := NewSnapshotStore()
+	serializer := eventhorizon.NewSnapshotSerializer(eventhorizon.JSONSnapshotCodec{})
+	serializer.RegisterState("Test", 1, func() interface{} { return &testutil.TestEvent{} })
+	store.SetSerializer(serializer)
+	id := eventhorizon.NewUUID()
+
+	t.Log("save and load a serialized snapshot")
+	state := &testutil.TestEvent{TestID: id, Content: "state"}
+	snapshot1 := &eventhorizon.Snapshot{AggregateID: id, AggregateType: "Test", Version: 2, State: state}
+	if err := store.SaveSnapshot(snapshot1); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	state.Content = "changed"
+	snapshot, err := store.LoadSnapshot(id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	expected := &testutil.TestEvent{TestID: id, Content: "state"}
+	if snapshot.Version != 2 || !reflect.DeepEqual(snapshot.State, expected) {
+		t.Error("the snapshot should be a copy of the saved one:", snapshot)
+	}
+
+	t.Log("don't replace with older snapshot")
+	if err := store.SaveSnapshot(&eventhorizon.Snapshot{AggregateID: id, AggregateType: "Test", Version: 1}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if snapshot, _ = store.LoadSnapshot(id); snapshot.Version != 2 {
+		t.Error("the snapshot should not be replaced:", snapshot)
+	}
+
+	t.Log("save an unregistered state")
+	other := &eventhorizon.Snapshot{AggregateID: eventhorizon.NewUUID(), AggregateType: "Other", Version: 1}
+	if err := store.SaveSnapshot(other); err != eventhorizon.ErrSnapshotStateNotRegistered {
+		t.Error("there should be a ErrSnapshotStateNotRegistered error:", err)
+	}
+}
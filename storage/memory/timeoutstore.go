@@ -0,0 +1,77 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/looplab/eventhorizon"
+)
+
+// TimeoutStore implements TimeoutStore as an in memory structure.
+type TimeoutStore struct {
+	timeouts map[eventhorizon.UUID]*eventhorizon.Timeout
+	mu       sync.RWMutex
+}
+
+// NewTimeoutStore creates a new TimeoutStore.
+func NewTimeoutStore() *TimeoutStore {
+	s := &TimeoutStore{
+		timeouts: make(map[eventhorizon.UUID]*eventhorizon.Timeout),
+	}
+	return s
+}
+
+// SaveTimeout saves a timeout.
+func (s *TimeoutStore) SaveTimeout(timeout *eventhorizon.Timeout) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.timeouts[timeout.ID] = timeout
+	return nil
+}
+
+// RemoveTimeout removes a timeout. Returns ErrTimeoutNotFound if there is none.
+func (s *TimeoutStore) RemoveTimeout(id eventhorizon.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.timeouts[id]; !ok {
+		return eventhorizon.ErrTimeoutNotFound
+	}
+	delete(s.timeouts, id)
+	return nil
+}
+
+// DueTimeouts returns the timeouts with deadlines at or before a time, in the
+// order of their deadlines.
+func (s *TimeoutStore) DueTimeouts(now time.Time) ([]*eventhorizon.Timeout, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	timeouts := []*eventhorizon.Timeout{}
+	for _, timeout := range s.timeouts {
+		if !timeout.Deadline.After(now) {
+			timeouts = append(timeouts, timeout)
+		}
+	}
+	sort.Sort(byDeadline(timeouts))
+	return timeouts, nil
+}
+
+type byDeadline []*eventhorizon.Timeout
+
+func (t byDeadline) Len() int           { return len(t) }
+func (t byDeadline) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+func (t byDeadline) Less(i, j int) bool { return t[i].Deadline.Before(t[j].Deadline) }
@@ -0,0 +1,56 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/looplab/eventhorizon"
+)
+
+func TestTimeoutStore(t *testing.T) {
+	store := NewTimeoutStore()
+	now := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	timeout1 := &eventhorizon.Timeout{ID: eventhorizon.NewUUID(), Name: "1", Deadline: now.Add(time.Hour)}
+	timeout2 := &eventhorizon.Timeout{ID: eventhorizon.NewUUID(), Name: "2", Deadline: now}
+	timeout3 := &eventhorizon.Timeout{ID: eventhorizon.NewUUID(), Name: "3", Deadline: now.Add(2 * time.Hour)}
+	for _, timeout := range []*eventhorizon.Timeout{timeout1, timeout2, timeout3} {
+		if err := store.SaveTimeout(timeout); err != nil {
+			t.Error("there should be no error:", err)
+		}
+	}
+
+	t.Log("due timeouts in order")
+	timeouts, err := store.DueTimeouts(now.Add(time.Hour))
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(timeouts, []*eventhorizon.Timeout{timeout2, timeout1}) {
+		t.Error("the timeouts should be correct:", timeouts)
+	}
+
+	t.Log("remove timeout")
+	if err := store.RemoveTimeout(timeout2.ID); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := store.RemoveTimeout(timeout2.ID); err != eventhorizon.ErrTimeoutNotFound {
+		t.Error("there should be a ErrTimeoutNotFound error:", err)
+	}
+	if timeouts, _ := store.DueTimeouts(now.Add(time.Hour)); len(timeouts) != 1 {
+		t.Error("the timeout should be removed:", timeouts)
+	}
+}
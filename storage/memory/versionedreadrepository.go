@@ -0,0 +1,148 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"sync"
+	"time"
+
+	"github.com/looplab/eventhorizon"
+)
+
+// VersionedReadRepository wraps a ReadRepository and keeps every revision of
+// the read models saved through it in memory. Models saved with Save get the
+// version after the last one, use SaveVersion to save them with the version of
+// the event that produced them.
+type VersionedReadRepository struct {
+	eventhorizon.ReadRepository
+	revisions map[eventhorizon.UUID][]eventhorizon.ModelRevision
+	clock     eventhorizon.Clock
+	mu        sync.RWMutex
+}
+
+// NewVersionedReadRepository creates a new VersionedReadRepository. The clock
+// is used for the timestamps of the revisions.
+func NewVersionedReadRepository(repo eventhorizon.ReadRepository, clock eventhorizon.Clock) *VersionedReadRepository {
+	return &VersionedReadRepository{
+		ReadRepository: repo,
+		revisions:      make(map[eventhorizon.UUID][]eventhorizon.ModelRevision),
+		clock:          clock,
+	}
+}
+
+// Save saves a read model as a revision with the version after the last one.
+func (r *VersionedReadRepository) Save(id eventhorizon.UUID, model interface{}) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.save(id, model, r.lastVersion(id)+1)
+}
+
+// SaveVersion implements the SaveVersion method of the
+// eventhorizon.VersionedReadRepository interface.
+func (r *VersionedReadRepository) SaveVersion(id eventhorizon.UUID, model interface{}, version int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if version <= r.lastVersion(id) {
+		return eventhorizon.ErrIncorrectModelVersion
+	}
+	return r.save(id, model, version)
+}
+
+// Remove removes a read model, and saves a revision without a model so that it
+// is not found at later times. The earlier revisions are kept.
+func (r *VersionedReadRepository) Remove(id eventhorizon.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.ReadRepository.Remove(id); err != nil {
+		return err
+	}
+	r.revisions[id] = append(r.revisions[id], eventhorizon.ModelRevision{
+		Version:   r.lastVersion(id) + 1,
+		Timestamp: r.clock.Now(),
+	})
+	return nil
+}
+
+// FindVersion implements the FindVersion method of the
+// eventhorizon.VersionedReadRepository interface.
+func (r *VersionedReadRepository) FindVersion(id eventhorizon.UUID, version int) (interface{}, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, revision := range r.revisions[id] {
+		if revision.Version == version && revision.Model != nil {
+			return copyModel(revision.Model), nil
+		}
+	}
+	return nil, eventhorizon.ErrModelNotFound
+}
+
+// FindAt implements the FindAt method of the
+// eventhorizon.VersionedReadRepository interface.
+func (r *VersionedReadRepository) FindAt(id eventhorizon.UUID, t time.Time) (interface{}, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	revisions := r.revisions[id]
+	for i := len(revisions) - 1; i >= 0; i-- {
+		if revisions[i].Timestamp.After(t) {
+			continue
+		}
+		if revisions[i].Model == nil {
+			break
+		}
+		return copyModel(revisions[i].Model), nil
+	}
+	return nil, eventhorizon.ErrModelNotFound
+}
+
+// FindRevisions implements the FindRevisions method of the
+// eventhorizon.VersionedReadRepository interface.
+func (r *VersionedReadRepository) FindRevisions(id eventhorizon.UUID) ([]eventhorizon.ModelRevision, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	revisions := r.revisions[id]
+	if len(revisions) == 0 {
+		return nil, eventhorizon.ErrModelNotFound
+	}
+	result := make([]eventhorizon.ModelRevision, len(revisions))
+	for i, revision := range revisions {
+		revision.Model = copyModel(revision.Model)
+		result[i] = revision
+	}
+	return result, nil
+}
+
+// save saves a model and a copy of it as a revision. It is called with the lock
+// held.
+func (r *VersionedReadRepository) save(id eventhorizon.UUID, model interface{}, version int) error {
+	if err := r.ReadRepository.Save(id, model); err != nil {
+		return err
+	}
+	r.revisions[id] = append(r.revisions[id], eventhorizon.ModelRevision{
+		Version:   version,
+		Timestamp: r.clock.Now(),
+		Model:     copyModel(model),
+	})
+	return nil
+}
+
+// lastVersion returns the version of the last revision of a model, or 0. It is
+// called with the lock held.
+func (r *VersionedReadRepository) lastVersion(id eventhorizon.UUID) int {
+	revisions := r.revisions[id]
+	if len(revisions) == 0 {
+		return 0
+	}
+	return revisions[len(revisions)-1].Version
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/testutil"
+)
+
+func TestVersionedReadRepository(t *testing.T) {
+	start := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := testutil.NewMockClock(start)
+	var repo eventhorizon.VersionedReadRepository
+	r := NewVersionedReadRepository(NewReadRepository(), clock)
+	repo = r
+
+	id := eventhorizon.NewUUID()
+	model1 := &testutil.TestModel{id, "model1", start}
+	if err := repo.SaveVersion(id, model1, 1); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	clock.Advance(time.Minute)
+	model1.Content = "model1Alt"
+	if err := repo.SaveVersion(id, model1, 3); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := repo.SaveVersion(id, model1, 2); err != eventhorizon.ErrIncorrectModelVersion {
+		t.Error("there should be a ErrIncorrectModelVersion error:", err)
+	}
+
+	t.Log("find the latest model")
+	model, err := repo.Find(id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if model.(*testutil.TestModel).Content != "model1Alt" {
+		t.Error("the model should be correct:", model)
+	}
+
+	t.Log("find a version")
+	model, err = repo.FindVersion(id, 1)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(model, &testutil.TestModel{id, "model1", start}) {
+		t.Error("the model should be correct:", model)
+	}
+	if _, err := repo.FindVersion(id, 2); err != eventhorizon.ErrModelNotFound {
+		t.Error("there should be a ErrModelNotFound error:", err)
+	}
+
+	t.Log("find at a time")
+	model, err = repo.FindAt(id, start.Add(30*time.Second))
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if model.(*testutil.TestModel).Content != "model1" {
+		t.Error("the model should be correct:", model)
+	}
+	if _, err := repo.FindAt(id, start.Add(-time.Second)); err != eventhorizon.ErrModelNotFound {
+		t.Error("there should be a ErrModelNotFound error:", err)
+	}
+
+	t.Log("remove and save with the next version")
+	clock.Advance(time.Minute)
+	if err := repo.Remove(id); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, err := repo.FindAt(id, clock.Now()); err != eventhorizon.ErrModelNotFound {
+		t.Error("there should be a ErrModelNotFound error:", err)
+	}
+	model, err = repo.FindAt(id, start.Add(time.Minute))
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if model.(*testutil.TestModel).Content != "model1Alt" {
+		t.Error("the model should be correct:", model)
+	}
+	if err := repo.Save(id, model1); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	revisions, err := repo.FindRevisions(id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	versions := []int{}
+	for _, revision := range revisions {
+		versions = append(versions, revision.Version)
+	}
+	if !reflect.DeepEqual(versions, []int{1, 3, 4, 5}) {
+		t.Error("the versions should be correct:", versions)
+	}
+	if revisions[2].Model != nil {
+		t.Error("the removed revision should have no model:", revisions[2].Model)
+	}
+}
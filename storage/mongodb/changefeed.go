@@ -0,0 +1,162 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodb
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/looplab/eventhorizon"
+)
+
+// ChangeFeed publishes the events saved in an EventStore on an event bus by
+// watching the change stream of the event collection. The events are
+// published after they are committed, in the order of the commits, also when
+// saved by other processes, so the store should be created without a bus to
+// not publish them twice.
+//
+// The resume token of the change stream is saved after each change, so that
+// publishing resumes after a restart. Events can be published again if the
+// feed stops between publishing and saving the token. Change streams need a
+// replica set or a sharded cluster.
+type ChangeFeed struct {
+	eventhorizon.Lifecycle
+
+	name  string
+	store *EventStore
+	bus   eventhorizon.EventBus
+}
+
+// NewChangeFeed creates a ChangeFeed, which saves its resume token with a
+// name in the database of the store.
+func NewChangeFeed(name string, store *EventStore, bus eventhorizon.EventBus) *ChangeFeed {
+	return &ChangeFeed{
+		name:  name,
+		store: store,
+		bus:   bus,
+	}
+}
+
+// change is a change of an aggregate document in the change stream.
+type change struct {
+	Token         bson.Raw              `bson:"_id"`
+	OperationType string                `bson:"operationType"`
+	FullDocument  *mongoAggregateRecord `bson:"fullDocument"`
+	DocumentKey   struct {
+		ID string `bson:"_id"`
+	} `bson:"documentKey"`
+	UpdateDescription struct {
+		UpdatedFields bson.Raw `bson:"updatedFields"`
+	} `bson:"updateDescription"`
+}
+
+// Run publishes the events of the changes until the context is done or the
+// change stream fails.
+func (f *ChangeFeed) Run(ctx context.Context) error {
+	tokens := f.store.c("change_feeds")
+	var saved struct {
+		Token bson.Raw `bson:"token"`
+	}
+	err := tokens.FindOne(ctx, bson.M{"_id": f.name}).Decode(&saved)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return err
+	}
+
+	opts := options.ChangeStream()
+	if saved.Token != nil {
+		opts.SetResumeAfter(saved.Token)
+	}
+	stream, err := f.store.c("events").Watch(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"operationType": bson.M{"$in": bson.A{"insert", "update"}}}}},
+	}, opts)
+	if err != nil {
+		return err
+	}
+	defer stream.Close(context.Background())
+
+	for stream.Next(ctx) {
+		var c change
+		if err := stream.Decode(&c); err != nil {
+			return err
+		}
+		records, err := c.records()
+		if err != nil {
+			return err
+		}
+
+		id := eventhorizon.UUID(c.DocumentKey.ID)
+		for _, record := range records {
+			event, err := f.store.decodeEvent(record, id)
+			if err != nil {
+				return err
+			}
+			eventhorizon.PublishEventWithContext(
+				eventhorizon.NewContextWithHeaders(ctx, record.Headers), f.bus, event)
+		}
+
+		if _, err := tokens.UpdateOne(ctx,
+			bson.M{"_id": f.name},
+			bson.M{"$set": bson.M{"token": c.Token}},
+			options.Update().SetUpsert(true),
+		); err != nil {
+			return err
+		}
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return stream.Err()
+}
+
+// records returns the event records added by a change, in the order of their
+// versions. Inserted aggregates add all their events, and updates add the
+// events appended to the events array. Other updates, such as truncating
+// the events, add none.
+func (c change) records() ([]*mongoEventRecord, error) {
+	if c.OperationType == "insert" {
+		if c.FullDocument == nil {
+			return nil, nil
+		}
+		return c.FullDocument.Events, nil
+	}
+
+	if c.UpdateDescription.UpdatedFields == nil {
+		return nil, nil
+	}
+	elements, err := c.UpdateDescription.UpdatedFields.Elements()
+	if err != nil {
+		return nil, err
+	}
+	var records []*mongoEventRecord
+	for _, element := range elements {
+		if !strings.HasPrefix(element.Key(), "events.") {
+			continue
+		}
+		record := &mongoEventRecord{}
+		if err := element.Value().Unmarshal(record); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Version < records[j].Version
+	})
+	return records, nil
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodb
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestChangeRecords(t *testing.T) {
+	record1 := &mongoEventRecord{Type: "TestEvent", Version: 1, Position: 1}
+	record2 := &mongoEventRecord{Type: "TestEvent", Version: 2, Position: 5}
+	record3 := &mongoEventRecord{Type: "TestEventOther", Version: 3, Position: 6}
+
+	t.Log("insert of an aggregate")
+	c := change{
+		OperationType: "insert",
+		FullDocument:  &mongoAggregateRecord{Events: []*mongoEventRecord{record1}},
+	}
+	records, err := c.records()
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(records, []*mongoEventRecord{record1}) {
+		t.Error("the records should be correct:", records)
+	}
+
+	t.Log("update with appended events")
+	fields, err := bson.Marshal(bson.D{
+		{Key: "events.2", Value: record3},
+		{Key: "version", Value: 3},
+		{Key: "events.1", Value: record2},
+	})
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	c = change{OperationType: "update"}
+	c.UpdateDescription.UpdatedFields = fields
+	if records, err = c.records(); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(records) != 2 || records[0].Version != 2 || records[1].Type != "TestEventOther" {
+		t.Error("the records should be correct:", records)
+	}
+
+	t.Log("update without appended events")
+	if fields, err = bson.Marshal(bson.D{{Key: "deleted", Value: true}}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	c.UpdateDescription.UpdatedFields = fields
+	if records, err = c.records(); err != nil || len(records) != 0 {
+		t.Error("there should be no records:", records, err)
+	}
+}
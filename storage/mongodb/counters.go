@@ -0,0 +1,105 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodb
+
+import (
+	"sync/atomic"
+
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/looplab/eventhorizon"
+)
+
+// Counters are counters of an EventStore since it was created, for monitoring
+// without a metrics library. They can be published with expvar:
+//     expvar.Publish("eventstore", expvar.Func(func() interface{} {
+//         return store.Counters()
+//     }))
+type Counters struct {
+	// Saved is the number of saved events, SaveErrors the number of failed
+	// saves, and Conflicts the number of saves with a version conflict.
+	Saved      uint64
+	SaveErrors uint64
+	Conflicts  uint64
+	// Loads is the number of loaded aggregates, Loaded the number of loaded
+	// events, and LoadErrors the number of events that could not be decoded.
+	Loads      uint64
+	Loaded     uint64
+	LoadErrors uint64
+	// Connections is the number of open connections in the pool, and
+	// CheckedOut the number of them in use. They are only counted for stores
+	// created with NewEventStore.
+	Connections int64
+	CheckedOut  int64
+	// CheckOutErrors is the number of times a connection could not be taken
+	// from the pool.
+	CheckOutErrors uint64
+}
+
+// counters are the counters of an EventStore, updated atomically.
+type counters struct {
+	saved          atomic.Uint64
+	saveErrors     atomic.Uint64
+	conflicts      atomic.Uint64
+	loads          atomic.Uint64
+	loaded         atomic.Uint64
+	loadErrors     atomic.Uint64
+	connections    atomic.Int64
+	checkedOut     atomic.Int64
+	checkOutErrors atomic.Uint64
+}
+
+// poolMonitor returns client options that count the connections of the pool.
+func (c *counters) poolMonitor() *options.ClientOptions {
+	return options.Client().SetPoolMonitor(&event.PoolMonitor{
+		Event: func(e *event.PoolEvent) {
+			switch e.Type {
+			case event.ConnectionCreated:
+				c.connections.Add(1)
+			case event.ConnectionClosed:
+				c.connections.Add(-1)
+			case event.GetSucceeded:
+				c.checkedOut.Add(1)
+			case event.ConnectionReturned:
+				c.checkedOut.Add(-1)
+			case event.GetFailed:
+				c.checkOutErrors.Add(1)
+			}
+		},
+	})
+}
+
+// Counters returns the current counters of the event store.
+func (s *EventStore) Counters() Counters {
+	return Counters{
+		Saved:          s.counters.saved.Load(),
+		SaveErrors:     s.counters.saveErrors.Load(),
+		Conflicts:      s.counters.conflicts.Load(),
+		Loads:          s.counters.loads.Load(),
+		Loaded:         s.counters.loaded.Load(),
+		LoadErrors:     s.counters.loadErrors.Load(),
+		Connections:    s.counters.connections.Load(),
+		CheckedOut:     s.counters.checkedOut.Load(),
+		CheckOutErrors: s.counters.checkOutErrors.Load(),
+	}
+}
+
+// Stats implements the Stats method of the eventhorizon.StatsProvider
+// interface, with the saved events and the saves that failed, including
+// version conflicts.
+func (s *EventStore) Stats() eventhorizon.ComponentStats {
+	return s.stats.Stats()
+}
@@ -0,0 +1,206 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/looplab/eventhorizon"
+)
+
+// ErrCouldNotSaveDeadLetter is when a dead letter could not be saved.
+var ErrCouldNotSaveDeadLetter = errors.New("could not save dead letter")
+
+// ErrCouldNotLoadDeadLetters is when dead letters could not be loaded.
+var ErrCouldNotLoadDeadLetters = errors.New("could not load dead letters")
+
+// DeadLetterStore implements a DeadLetterStore for MongoDB. The events of dead
+// letters are decoded with the factories registered for their types, and are
+// kept as bson.M data otherwise, for inspecting them.
+type DeadLetterStore struct {
+	client    *mongo.Client
+	db        string
+	factories map[string]func() eventhorizon.Event
+	mu        sync.RWMutex
+}
+
+// NewDeadLetterStore creates a new DeadLetterStore. Client options, such as
+// the size of the connection pool, can be passed to override the ones of the
+// URL.
+func NewDeadLetterStore(url, database string, opts ...*options.ClientOptions) (*DeadLetterStore, error) {
+	client, err := connect(url, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewDeadLetterStoreWithClient(client, database)
+}
+
+// NewDeadLetterStoreWithClient creates a new DeadLetterStore with a client.
+func NewDeadLetterStoreWithClient(client *mongo.Client, database string) (*DeadLetterStore, error) {
+	if client == nil {
+		return nil, ErrNoDBClient
+	}
+
+	s := &DeadLetterStore{
+		client:    client,
+		db:        database,
+		factories: make(map[string]func() eventhorizon.Event),
+	}
+
+	return s, nil
+}
+
+type mongoDeadLetter struct {
+	ID        string               `bson:"_id"`
+	EventType string               `bson:"event_type"`
+	Data      bson.Raw             `bson:"data"`
+	Headers   eventhorizon.Headers `bson:"headers,omitempty"`
+	Reason    string               `bson:"reason"`
+	Errors    []string             `bson:"errors,omitempty"`
+	Timestamp time.Time            `bson:"timestamp"`
+}
+
+// c returns the collection of the dead letters.
+func (s *DeadLetterStore) c() *mongo.Collection {
+	return s.client.Database(s.db).Collection("dead_letters")
+}
+
+// SaveDeadLetter saves a dead letter.
+func (s *DeadLetterStore) SaveDeadLetter(ctx context.Context, d *eventhorizon.DeadLetter) error {
+	data, err := bson.Marshal(d.Event)
+	if err != nil {
+		return &eventhorizon.EventError{Err: ErrCouldNotMarshalEvent, Cause: err, EventType: d.EventType}
+	}
+	if _, err := s.c().InsertOne(ctx, mongoDeadLetter{
+		ID:        d.ID.String(),
+		EventType: d.EventType,
+		Data:      bson.Raw(data),
+		Headers:   d.Headers,
+		Reason:    d.Reason,
+		Errors:    d.Errors,
+		Timestamp: d.Timestamp,
+	}); err != nil {
+		return ErrCouldNotSaveDeadLetter
+	}
+	return nil
+}
+
+// DeadLetters returns all dead letters, oldest first.
+func (s *DeadLetterStore) DeadLetters(ctx context.Context) ([]*eventhorizon.DeadLetter, error) {
+	cursor, err := s.c().Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"timestamp": 1}))
+	if err != nil {
+		return nil, ErrCouldNotLoadDeadLetters
+	}
+	var records []mongoDeadLetter
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, ErrCouldNotLoadDeadLetters
+	}
+
+	deadLetters := make([]*eventhorizon.DeadLetter, len(records))
+	for i, record := range records {
+		if deadLetters[i], err = s.decode(record); err != nil {
+			return nil, err
+		}
+	}
+	return deadLetters, nil
+}
+
+// DeadLetter returns a dead letter. Returns ErrDeadLetterNotFound if there is
+// none.
+func (s *DeadLetterStore) DeadLetter(ctx context.Context, id eventhorizon.UUID) (*eventhorizon.DeadLetter, error) {
+	var record mongoDeadLetter
+	err := s.c().FindOne(ctx, bson.M{"_id": id.String()}).Decode(&record)
+	if err == mongo.ErrNoDocuments {
+		return nil, eventhorizon.ErrDeadLetterNotFound
+	} else if err != nil {
+		return nil, ErrCouldNotLoadDeadLetters
+	}
+	return s.decode(record)
+}
+
+// decode decodes a dead letter, with its event if the type is registered.
+func (s *DeadLetterStore) decode(record mongoDeadLetter) (*eventhorizon.DeadLetter, error) {
+	d := &eventhorizon.DeadLetter{
+		ID:        eventhorizon.UUID(record.ID),
+		EventType: record.EventType,
+		Headers:   record.Headers,
+		Reason:    record.Reason,
+		Errors:    record.Errors,
+		Timestamp: record.Timestamp,
+	}
+
+	s.mu.RLock()
+	f, ok := s.factories[record.EventType]
+	s.mu.RUnlock()
+	if ok {
+		d.Event = f()
+		if err := bson.Unmarshal(record.Data, d.Event); err != nil {
+			return nil, &eventhorizon.EventError{Err: ErrCouldNotUnmarshalEvent, Cause: err, EventType: record.EventType}
+		}
+		return d, nil
+	}
+
+	data := bson.M{}
+	if err := bson.Unmarshal(record.Data, &data); err != nil {
+		return nil, &eventhorizon.EventError{Err: ErrCouldNotUnmarshalEvent, Cause: err, EventType: record.EventType}
+	}
+	d.Data = data
+	return d, nil
+}
+
+// RemoveDeadLetter removes a dead letter. Returns ErrDeadLetterNotFound if
+// there is none.
+func (s *DeadLetterStore) RemoveDeadLetter(ctx context.Context, id eventhorizon.UUID) error {
+	result, err := s.c().DeleteOne(ctx, bson.M{"_id": id.String()})
+	if err != nil {
+		return ErrCouldNotSaveDeadLetter
+	} else if result.DeletedCount == 0 {
+		return eventhorizon.ErrDeadLetterNotFound
+	}
+	return nil
+}
+
+// RegisterEventType registers an event factory for a event type. The factory
+// is used to create concrete event types when loading dead letters.
+func (s *DeadLetterStore) RegisterEventType(event eventhorizon.Event, factory func() eventhorizon.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.factories[event.EventType()]; ok {
+		return eventhorizon.ErrHandlerAlreadySet
+	}
+	s.factories[event.EventType()] = factory
+	return nil
+}
+
+// Clear clears the dead letter storage.
+func (s *DeadLetterStore) Clear() error {
+	if err := s.c().Drop(context.Background()); err != nil {
+		return ErrCouldNotClearDB
+	}
+	return nil
+}
+
+// Close disconnects the database client.
+func (s *DeadLetterStore) Close() {
+	s.client.Disconnect(context.Background())
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodb
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/testutil"
+)
+
+func TestDeadLetterStore(t *testing.T) {
+	store, err := NewDeadLetterStore(mongoURL(), "test")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer store.Close()
+	defer store.Clear()
+	if err := store.RegisterEventType(&testutil.TestEvent{}, func() eventhorizon.Event {
+		return &testutil.TestEvent{}
+	}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	ctx := context.Background()
+
+	now := time.Date(2016, 1, 1, 0, 0, 0, 0, time.Local)
+	event1 := &testutil.TestEvent{eventhorizon.NewUUID(), "event1"}
+	event2 := &testutil.TestEventOther{eventhorizon.NewUUID(), "event2"}
+	d1 := &eventhorizon.DeadLetter{
+		ID:        eventhorizon.NewUUID(),
+		EventType: event1.EventType(),
+		Event:     event1,
+		Headers:   eventhorizon.Headers{eventhorizon.HeaderCorrelationID: "correlation"},
+		Reason:    "shed",
+		Timestamp: now,
+	}
+	d2 := &eventhorizon.DeadLetter{
+		ID:        eventhorizon.NewUUID(),
+		EventType: event2.EventType(),
+		Event:     event2,
+		Reason:    eventhorizon.ErrMaxDeliveryAttempts.Error(),
+		Errors:    []string{"timeout", "connection refused"},
+		Timestamp: now.Add(time.Second),
+	}
+	for _, d := range []*eventhorizon.DeadLetter{d1, d2} {
+		if err := store.SaveDeadLetter(ctx, d); err != nil {
+			t.Error("there should be no error:", err)
+		}
+	}
+
+	t.Log("list dead letters")
+	deadLetters, err := store.DeadLetters(ctx)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(deadLetters) != 2 {
+		t.Fatal("there should be two dead letters:", deadLetters)
+	}
+	if !reflect.DeepEqual(deadLetters[0], d1) {
+		t.Error("the registered event should be decoded:", deadLetters[0])
+	}
+	if deadLetters[1].Event != nil || deadLetters[1].Data.(bson.M)["content"] != "event2" {
+		t.Error("the unregistered event should be kept as data:", deadLetters[1])
+	}
+
+	t.Log("find and remove a dead letter")
+	if d, err := store.DeadLetter(ctx, d1.ID); err != nil || d.ID != d1.ID {
+		t.Error("the dead letter should be found:", d, err)
+	}
+	if err := store.RemoveDeadLetter(ctx, d1.ID); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, err := store.DeadLetter(ctx, d1.ID); err != eventhorizon.ErrDeadLetterNotFound {
+		t.Error("there should be a ErrDeadLetterNotFound error:", err)
+	}
+	if err := store.RemoveDeadLetter(ctx, d1.ID); err != eventhorizon.ErrDeadLetterNotFound {
+		t.Error("there should be a ErrDeadLetterNotFound error:", err)
+	}
+}
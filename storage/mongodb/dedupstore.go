@@ -0,0 +1,121 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodb
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/looplab/eventhorizon"
+)
+
+// DedupStore implements a DedupStore for MongoDB. Expired IDs are removed by a
+// TTL index, and until then they are overwritten when remembered again.
+type DedupStore struct {
+	client      *mongo.Client
+	db          string
+	clock       eventhorizon.Clock
+	indexesOnce sync.Once
+	indexesErr  error
+}
+
+// NewDedupStore creates a new DedupStore, with a clock for expiring the IDs.
+// Client options, such as the size of the connection pool, can be passed to
+// override the ones of the URL.
+func NewDedupStore(url, database string, clock eventhorizon.Clock, opts ...*options.ClientOptions) (*DedupStore, error) {
+	client, err := connect(url, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewDedupStoreWithClient(client, database, clock)
+}
+
+// NewDedupStoreWithClient creates a new DedupStore with a client, and a clock
+// for expiring the IDs.
+func NewDedupStoreWithClient(client *mongo.Client, database string, clock eventhorizon.Clock) (*DedupStore, error) {
+	if client == nil {
+		return nil, ErrNoDBClient
+	}
+
+	s := &DedupStore{
+		client: client,
+		db:     database,
+		clock:  clock,
+	}
+
+	return s, nil
+}
+
+// c returns the collection of the IDs.
+func (s *DedupStore) c() *mongo.Collection {
+	return s.client.Database(s.db).Collection("dedup")
+}
+
+// Remember implements the Remember method of the DedupStore interface. An ID
+// that is remembered and not expired makes the upsert insert a duplicate key.
+func (s *DedupStore) Remember(ctx context.Context, id string, ttl time.Duration) (bool, error) {
+	if err := s.ensureIndexes(ctx); err != nil {
+		return false, err
+	}
+
+	now := s.clock.Now()
+	_, err := s.c().UpdateOne(ctx,
+		bson.M{"_id": id, "expires": bson.M{"$lte": now}},
+		bson.M{"$set": bson.M{"expires": now.Add(ttl)}},
+		options.Update().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Forget implements the Forget method of the DedupStore interface.
+func (s *DedupStore) Forget(ctx context.Context, id string) error {
+	_, err := s.c().DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+// ensureIndexes creates the TTL index of the IDs, once.
+func (s *DedupStore) ensureIndexes(ctx context.Context) error {
+	s.indexesOnce.Do(func() {
+		_, s.indexesErr = s.c().Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys:    bson.D{{Key: "expires", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		})
+	})
+	return s.indexesErr
+}
+
+// Clear clears the dedup storage.
+func (s *DedupStore) Clear() error {
+	if err := s.c().Drop(context.Background()); err != nil {
+		return ErrCouldNotClearDB
+	}
+	return nil
+}
+
+// Close closes the database client.
+func (s *DedupStore) Close() {
+	s.client.Disconnect(context.Background())
+}
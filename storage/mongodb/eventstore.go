@@ -15,11 +15,18 @@
 package mongodb
 
 import (
+	"context"
 	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
-	"gopkg.in/mgo.v2"
-	"gopkg.in/mgo.v2/bson"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 
 	"github.com/looplab/eventhorizon"
 )
@@ -27,8 +34,8 @@ import (
 // ErrCouldNotDialDB is when the database could not be dialed.
 var ErrCouldNotDialDB = errors.New("could not dial database")
 
-// ErrNoDBSession is when no database session is set.
-var ErrNoDBSession = errors.New("no database session")
+// ErrNoDBClient is when no database client is set.
+var ErrNoDBClient = errors.New("no database client")
 
 // ErrCouldNotClearDB is when the database could not be cleared.
 var ErrCouldNotClearDB = errors.New("could not clear database")
@@ -51,170 +58,1413 @@ var ErrCouldNotSaveAggregate = errors.New("could not save aggregate")
 // ErrInvalidEvent is when an event does not implement the Event interface.
 var ErrInvalidEvent = errors.New("invalid event")
 
+// ErrNoTransactions is when events are saved to a standalone server, which has
+// no transactions, without WithStandaloneLocking.
+var ErrNoTransactions = errors.New("no transactions")
+
+// connect connects a client to a URL and checks that the server is reachable.
+// The "mongodb://" scheme is added to URLs without one. Times are decoded in
+// the local time zone, as with the previous driver. Options, for example for
+// the size of the connection pool, are applied after the URL.
+func connect(url string, opts ...*options.ClientOptions) (*mongo.Client, error) {
+	if !strings.Contains(url, "://") {
+		url = "mongodb://" + url
+	}
+	defaults := options.Client().ApplyURI(url).
+		SetBSONOptions(&options.BSONOptions{UseLocalTimeZone: true})
+	opts = append([]*options.ClientOptions{defaults}, opts...)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client, err := mongo.Connect(ctx, opts...)
+	if err != nil {
+		return nil, ErrCouldNotDialDB
+	}
+	if err := client.Ping(ctx, readpref.Primary()); err != nil {
+		client.Disconnect(ctx)
+		return nil, ErrCouldNotDialDB
+	}
+	return client, nil
+}
+
 // EventStore implements an EventStore for MongoDB.
 type EventStore struct {
 	eventBus  eventhorizon.EventBus
-	session   *mgo.Session
+	client    *mongo.Client
 	db        string
 	factories map[string]func() eventhorizon.Event
+	clock     eventhorizon.Clock
+
+	snapshotStore eventhorizon.SnapshotStore
+	storageHook   eventhorizon.EventStorageHook
+
+	notificationsOnce sync.Once
+	notificationsErr  error
+	indexesOnce       sync.Once
+	indexesErr        error
+	transactions      *bool
+	transactionsMu    sync.Mutex
+	saveMu            sync.Mutex
+	standaloneLocking bool
+	clientOptions     []*options.ClientOptions
+
+	// notifyInTransaction is set if the notifications collection can be
+	// written in transactions, which capped collections can't.
+	notifyInTransaction bool
+
+	counters *counters
+	stats    *eventhorizon.StatsCounter
+}
+
+// Option is an option for an EventStore.
+type Option func(*EventStore) error
+
+// WithClientOptions sets client options, such as the size of the connection
+// pool, which override the ones of the URL. They are only used by
+// NewEventStore, which connects the client.
+func WithClientOptions(opts ...*options.ClientOptions) Option {
+	return func(s *EventStore) error {
+		s.clientOptions = append(s.clientOptions, opts...)
+		return nil
+	}
+}
+
+// WithClock sets the clock used to timestamp events.
+func WithClock(clock eventhorizon.Clock) Option {
+	return func(s *EventStore) error {
+		s.clock = clock
+		return nil
+	}
+}
+
+// WithStandaloneLocking allows saving to standalone servers, which have no
+// transactions. The events of each aggregate are then written in one version
+// checked update of its document, one aggregate at a time, while holding a
+// lock of the store. The lock only serializes the saves of this process, so
+// saves of several aggregates are not atomic and saves of other processes can
+// interleave with them. Without it saving to a standalone server returns an
+// error with ErrNoTransactions.
+func WithStandaloneLocking() Option {
+	return func(s *EventStore) error {
+		s.standaloneLocking = true
+		return nil
+	}
 }
 
 // NewEventStore creates a new EventStore.
-func NewEventStore(eventBus eventhorizon.EventBus, url, database string) (*EventStore, error) {
-	session, err := mgo.Dial(url)
+func NewEventStore(eventBus eventhorizon.EventBus, url, database string, opts ...Option) (*EventStore, error) {
+	s, err := newEventStore(eventBus, database, opts)
 	if err != nil {
-		return nil, ErrCouldNotDialDB
+		return nil, err
 	}
 
-	session.SetMode(mgo.Strong, true)
-	session.SetSafe(&mgo.Safe{W: 1})
-
-	return NewEventStoreWithSession(eventBus, session, database)
+	// The pool is monitored for the counters, unless a monitor is passed.
+	client, err := connect(url, append([]*options.ClientOptions{s.counters.poolMonitor()}, s.clientOptions...)...)
+	if err != nil {
+		return nil, err
+	}
+	s.client = client
+	return s, nil
 }
 
-// NewEventStoreWithSession creates a new EventStore with a session.
-func NewEventStoreWithSession(eventBus eventhorizon.EventBus, session *mgo.Session, database string) (*EventStore, error) {
-	if session == nil {
-		return nil, ErrNoDBSession
+// NewEventStoreWithClient creates a new EventStore with a client.
+func NewEventStoreWithClient(eventBus eventhorizon.EventBus, client *mongo.Client, database string, opts ...Option) (*EventStore, error) {
+	if client == nil {
+		return nil, ErrNoDBClient
 	}
 
+	s, err := newEventStore(eventBus, database, opts)
+	if err != nil {
+		return nil, err
+	}
+	s.client = client
+	return s, nil
+}
+
+// newEventStore creates an EventStore without a client and applies options.
+func newEventStore(eventBus eventhorizon.EventBus, database string, opts []Option) (*EventStore, error) {
 	s := &EventStore{
 		eventBus:  eventBus,
 		factories: make(map[string]func() eventhorizon.Event),
-		session:   session,
 		db:        database,
+		clock:     eventhorizon.SystemClock{},
+		counters:  &counters{},
+	}
+
+	// Tombstones of deleted aggregates are decoded as any other event.
+	s.factories["AggregateDeleted"] = func() eventhorizon.Event {
+		return &eventhorizon.AggregateDeleted{}
 	}
 
+	for _, option := range opts {
+		if err := option(s); err != nil {
+			return nil, err
+		}
+	}
+	s.stats = eventhorizon.NewStatsCounter(s.clock)
+
 	return s, nil
 }
 
 type mongoAggregateRecord struct {
 	AggregateID string              `bson:"_id"`
 	Version     int                 `bson:"version"`
+	Deleted     bool                `bson:"deleted,omitempty"`
 	Events      []*mongoEventRecord `bson:"events"`
 	// Type        string        `bson:"type"`
 	// Snapshot    bson.Raw      `bson:"snapshot"`
 }
 
 type mongoEventRecord struct {
-	Type      string             `bson:"type"`
-	Version   int                `bson:"version"`
-	Timestamp time.Time          `bson:"timestamp"`
-	Event     eventhorizon.Event `bson:"-"`
-	Data      bson.Raw           `bson:"data"`
+	Type          string               `bson:"type"`
+	AggregateType string               `bson:"aggregate_type,omitempty"`
+	Version       int                  `bson:"version"`
+	Position      int64                `bson:"position"`
+	Timestamp     time.Time            `bson:"timestamp"`
+	Headers       eventhorizon.Headers `bson:"headers,omitempty"`
+	Event         eventhorizon.Event   `bson:"-"`
+	Data          bson.Raw             `bson:"data,omitempty"`
+	Payload       []byte               `bson:"payload,omitempty"` // Data passed through the storage hook.
+}
+
+// c returns a collection of the database.
+func (s *EventStore) c(name string) *mongo.Collection {
+	return s.client.Database(s.db).Collection(name)
 }
 
-// Save appends all events in the event stream to the database.
+// Save appends all events in the event stream to the database. On replica
+// sets and sharded clusters the events of all aggregates, their positions and
+// the notification of subscribers are written in one transaction, so either
+// all or none of them are saved. Standalone servers have no transactions, so
+// saving to them returns an error with ErrNoTransactions, unless allowed with
+// WithStandaloneLocking.
 func (s *EventStore) Save(events []eventhorizon.Event) error {
+	return s.SaveWithContext(context.Background(), events)
+}
+
+// SaveWithContext appends all events as Save, with the headers of the context
+// stored in the event records.
+func (s *EventStore) SaveWithContext(ctx context.Context, events []eventhorizon.Event) error {
 	if len(events) == 0 {
 		return eventhorizon.ErrNoEventsToAppend
 	}
 
-	sess := s.session.Copy()
-	defer sess.Close()
-
+	// Group the events by aggregate, keeping the order of the aggregates.
+	ids := []eventhorizon.UUID{}
+	grouped := make(map[eventhorizon.UUID][]eventhorizon.Event)
 	for _, event := range events {
-		// Get an existing aggregate, if any.
-		var existing []mongoAggregateRecord
-		err := sess.DB(s.db).C("events").FindId(event.AggregateID().String()).
-			Select(bson.M{"version": 1}).Limit(1).All(&existing)
-		if err != nil || len(existing) > 1 {
-			return ErrCouldNotLoadAggregate
-		}
-
-		// Marshal event data.
-		var data []byte
-		if data, err = bson.Marshal(event); err != nil {
-			return ErrCouldNotMarshalEvent
-		}
-
-		// Create the event record with timestamp.
-		r := &mongoEventRecord{
-			Type:      event.EventType(),
-			Version:   1,
-			Timestamp: time.Now(),
-			Data:      bson.Raw{3, data},
-		}
-
-		// Either insert a new aggregate or append to an existing.
-		if len(existing) == 0 {
-			aggregate := mongoAggregateRecord{
-				AggregateID: event.AggregateID().String(),
-				Version:     1,
-				Events:      []*mongoEventRecord{r},
-			}
+		id := event.AggregateID()
+		if _, ok := grouped[id]; !ok {
+			ids = append(ids, id)
+		}
+		grouped[id] = append(grouped[id], event)
+	}
 
-			if err := sess.DB(s.db).C("events").Insert(aggregate); err != nil {
-				return ErrCouldNotSaveAggregate
-			}
-		} else {
-			// Increment record version before inserting.
-			r.Version = existing[0].Version + 1
-
-			// Increment aggregate version on insert of new event record, and
-			// only insert if version of aggregate is matching (ie not changed
-			// since the query above).
-			err = sess.DB(s.db).C("events").Update(
-				bson.M{
-					"_id":     event.AggregateID().String(),
-					"version": existing[0].Version,
-				},
-				bson.M{
-					"$push": bson.M{"events": r},
-					"$inc":  bson.M{"version": 1},
-				},
-			)
+	// Collections can't be created in transactions.
+	notificationsErr := s.ensureNotifications(ctx)
+	if notificationsErr != nil {
+		log.Printf("error: event store notify: %v\n", notificationsErr)
+	}
+
+	var last int64
+	headers := eventhorizon.HeadersFromContext(ctx)
+	err := s.withTransaction(ctx, func(ctx context.Context) error {
+		last = 0
+		for _, id := range ids {
+			position, err := s.writeAggregate(ctx, id, grouped[id], headers)
 			if err != nil {
-				return ErrCouldNotSaveAggregate
+				return err
+			}
+			if position > last {
+				last = position
 			}
 		}
+		if s.notifyInTransaction {
+			return s.notify(ctx, last)
+		}
+		return nil
+	})
+	if conflict, ok := err.(versionConflictError); ok {
+		s.counters.conflicts.Add(1)
+		s.stats.AddError()
+		return s.versionConflict(ctx, conflict.id, conflict.version)
+	} else if err != nil {
+		s.counters.saveErrors.Add(1)
+		s.stats.AddError()
+		return err
+	}
+	s.counters.saved.Add(uint64(len(events)))
+	s.stats.AddEvents(len(events))
 
-		// Publish event on the bus.
-		if s.eventBus != nil {
-			s.eventBus.PublishEvent(event)
+	// Notify subscribers of the saved events, if not done in the transaction.
+	if !s.notifyInTransaction && notificationsErr == nil {
+		if err := s.notify(ctx, last); err != nil {
+			log.Printf("error: event store notify: %v\n", err)
 		}
 	}
 
+	// Publish events on the bus.
+	if s.eventBus != nil {
+		eventhorizon.PublishEvents(s.eventBus, events)
+	}
+
 	return nil
 }
 
+// Import implements the Import method of the eventhorizon.ImportEventStore
+// interface. The events of all aggregates are written with one ordered bulk
+// write, in a transaction where supported as with Save. A document is inserted
+// for each new aggregate and the events of existing ones are pushed only if
+// the version of the aggregate is unchanged.
+func (s *EventStore) Import(ctx context.Context, envelopes []eventhorizon.EventEnvelope) error {
+	if len(envelopes) == 0 {
+		return eventhorizon.ErrNoEventsToAppend
+	}
+
+	// Group the events by aggregate, keeping the order of the aggregates.
+	ids := []eventhorizon.UUID{}
+	grouped := make(map[eventhorizon.UUID][]eventhorizon.EventEnvelope)
+	for _, envelope := range envelopes {
+		id := envelope.Event.AggregateID()
+		if _, ok := grouped[id]; !ok {
+			ids = append(ids, id)
+		}
+		grouped[id] = append(grouped[id], envelope)
+	}
+
+	// Collections can't be created in transactions.
+	notificationsErr := s.ensureNotifications(ctx)
+	if notificationsErr != nil {
+		log.Printf("error: event store notify: %v\n", notificationsErr)
+	}
+
+	var last int64
+	err := s.withTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		if last, err = s.importAggregates(ctx, ids, grouped); err != nil {
+			return err
+		}
+		if s.notifyInTransaction {
+			return s.notify(ctx, last)
+		}
+		return nil
+	})
+	if conflict, ok := err.(versionConflictError); ok {
+		s.counters.conflicts.Add(1)
+		s.stats.AddError()
+		return s.versionConflict(ctx, conflict.id, conflict.version)
+	} else if _, ok := err.(eventhorizon.ErrVersionConflict); ok {
+		s.counters.conflicts.Add(1)
+		s.stats.AddError()
+		return err
+	} else if err != nil {
+		s.counters.saveErrors.Add(1)
+		s.stats.AddError()
+		return err
+	}
+	s.counters.saved.Add(uint64(len(envelopes)))
+	s.stats.AddEvents(len(envelopes))
+
+	// Notify subscribers of the imported events, if not done in the
+	// transaction.
+	if !s.notifyInTransaction && notificationsErr == nil {
+		if err := s.notify(ctx, last); err != nil {
+			log.Printf("error: event store notify: %v\n", err)
+		}
+	}
+
+	return nil
+}
+
+// importAggregates writes the imported events of the aggregates in one bulk
+// write and returns the position of the last event. Returns an
+// ErrVersionConflict if the first event of an aggregate doesn't follow the
+// stored ones, and a versionConflictError if an aggregate changes while
+// importing.
+func (s *EventStore) importAggregates(ctx context.Context, ids []eventhorizon.UUID, grouped map[eventhorizon.UUID][]eventhorizon.EventEnvelope) (int64, error) {
+	// Allocate global positions for all events, as when saving.
+	total := 0
+	for _, envelopes := range grouped {
+		total += len(envelopes)
+	}
+	var counter struct {
+		Position int64 `bson:"position"`
+	}
+	err := s.c("counters").FindOneAndUpdate(ctx,
+		bson.M{"_id": "position"},
+		bson.M{"$inc": bson.M{"position": total}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&counter)
+	if err != nil {
+		return 0, &eventhorizon.EventError{Err: ErrCouldNotSaveAggregate, Cause: err}
+	}
+	position := counter.Position - int64(total)
+
+	models := make([]mongo.WriteModel, 0, len(ids))
+	versions := make([]int, 0, len(ids))
+	for _, id := range ids {
+		var existing *mongoAggregateRecord
+		err := s.c("events").FindOne(ctx, bson.M{"_id": id.String()},
+			options.FindOne().SetProjection(bson.M{"version": 1, "deleted": 1})).Decode(&existing)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return 0, &eventhorizon.EventError{Err: ErrCouldNotLoadAggregate, Cause: err, AggregateID: id}
+		}
+		if existing != nil && existing.Deleted {
+			return 0, eventhorizon.ErrAggregateDeleted
+		}
+		version := 0
+		if existing != nil {
+			version = existing.Version
+		}
+
+		// Check that the first event of the aggregate follows the stored ones.
+		envelopes := grouped[id]
+		if envelopes[0].Version != version+1 {
+			return 0, eventhorizon.ErrVersionConflict{
+				AggregateID:     id,
+				ExpectedVersion: envelopes[0].Version,
+				ActualVersion:   version,
+			}
+		}
+
+		records := make([]*mongoEventRecord, len(envelopes))
+		for i, envelope := range envelopes {
+			position++
+			if records[i], err = s.newRecord(envelope.Event, envelope.Version, position,
+				envelope.Timestamp, envelope.Headers); err != nil {
+				return 0, err
+			}
+		}
+		lastVersion := envelopes[len(envelopes)-1].Version
+
+		if existing == nil {
+			models = append(models, mongo.NewInsertOneModel().SetDocument(mongoAggregateRecord{
+				AggregateID: id.String(),
+				Version:     lastVersion,
+				Events:      records,
+			}))
+		} else {
+			// The upsert inserts a document with the same id if the version
+			// has changed, which fails with a duplicate key error for the
+			// aggregate, as the insert of a new aggregate does.
+			models = append(models, mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"_id": id.String(), "version": version}).
+				SetUpdate(bson.M{
+					"$push": bson.M{"events": bson.M{"$each": records}},
+					"$set":  bson.M{"version": lastVersion},
+				}).
+				SetUpsert(true))
+		}
+		versions = append(versions, version)
+	}
+
+	_, err = s.c("events").BulkWrite(ctx, models, options.BulkWrite().SetOrdered(true))
+	var bulkErr mongo.BulkWriteException
+	if errors.As(err, &bulkErr) && mongo.IsDuplicateKeyError(err) && len(bulkErr.WriteErrors) > 0 {
+		i := bulkErr.WriteErrors[0].Index
+		return 0, versionConflictError{ids[i], versions[i]}
+	} else if err != nil {
+		return 0, &eventhorizon.EventError{Err: ErrCouldNotSaveAggregate, Cause: err}
+	}
+	return position, nil
+}
+
+// versionConflictError is returned from a transaction when the version of an
+// aggregate has changed since it was read, to create the ErrVersionConflict
+// after the transaction has been aborted.
+type versionConflictError struct {
+	id      eventhorizon.UUID
+	version int
+}
+
+func (e versionConflictError) Error() string {
+	return "version conflict"
+}
+
+// writeAggregate allocates positions for the events of one aggregate and
+// inserts or appends them, returning the position of the last event.
+func (s *EventStore) writeAggregate(ctx context.Context, id eventhorizon.UUID, events []eventhorizon.Event, headers eventhorizon.Headers) (int64, error) {
+	// Get an existing aggregate, if any.
+	var existing *mongoAggregateRecord
+	err := s.c("events").FindOne(ctx, bson.M{"_id": id.String()},
+		options.FindOne().SetProjection(bson.M{"version": 1, "deleted": 1})).Decode(&existing)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return 0, &eventhorizon.EventError{Err: ErrCouldNotLoadAggregate, Cause: err, AggregateID: id}
+	}
+	if existing != nil && existing.Deleted {
+		return 0, eventhorizon.ErrAggregateDeleted
+	}
+
+	version := 0
+	if existing != nil {
+		version = existing.Version
+	}
+
+	// Allocate global positions for the events, for LoadAll. The counter is
+	// written in the same transaction as the events, so concurrent saves are
+	// serialized on it and commit in the order of their positions.
+	var counter struct {
+		Position int64 `bson:"position"`
+	}
+	err = s.c("counters").FindOneAndUpdate(ctx,
+		bson.M{"_id": "position"},
+		bson.M{"$inc": bson.M{"position": len(events)}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&counter)
+	if err != nil {
+		return 0, &eventhorizon.EventError{Err: ErrCouldNotSaveAggregate, Cause: err, AggregateID: id}
+	}
+	position := counter.Position - int64(len(events))
+
+	// Create the event records with version, position and timestamp.
+	records := make([]*mongoEventRecord, len(events))
+	for i, event := range events {
+		if records[i], err = s.newRecord(event, version+i+1, position+int64(i)+1,
+			s.clock.Now(), headers); err != nil {
+			return 0, err
+		}
+	}
+
+	// Either insert a new aggregate or append to an existing.
+	if existing == nil {
+		aggregate := mongoAggregateRecord{
+			AggregateID: id.String(),
+			Version:     len(records),
+			Events:      records,
+		}
+
+		if _, err := s.c("events").InsertOne(ctx, aggregate); mongo.IsDuplicateKeyError(err) {
+			return 0, versionConflictError{id, version}
+		} else if err != nil {
+			return 0, &eventhorizon.EventError{Err: ErrCouldNotSaveAggregate, Cause: err, AggregateID: id}
+		}
+		return position + int64(len(events)), nil
+	}
+
+	// Increment aggregate version on insert of the new event records, and
+	// only insert if version of aggregate is matching (ie not changed since
+	// the query above).
+	result, err := s.c("events").UpdateOne(ctx,
+		bson.M{
+			"_id":     id.String(),
+			"version": version,
+		},
+		bson.M{
+			"$push": bson.M{"events": bson.M{"$each": records}},
+			"$inc":  bson.M{"version": len(records)},
+		},
+	)
+	if err != nil {
+		return 0, &eventhorizon.EventError{Err: ErrCouldNotSaveAggregate, Cause: err, AggregateID: id}
+	} else if result.MatchedCount == 0 {
+		return 0, versionConflictError{id, version}
+	}
+
+	return position + int64(len(events)), nil
+}
+
+// newRecord creates the record of an event, with the event data marshaled and
+// passed through the storage hook, if any.
+func (s *EventStore) newRecord(event eventhorizon.Event, version int, position int64, timestamp time.Time, headers eventhorizon.Headers) (*mongoEventRecord, error) {
+	data, err := bson.Marshal(event)
+	if err != nil {
+		return nil, &eventhorizon.EventError{Err: ErrCouldNotMarshalEvent, Cause: err,
+			EventType: event.EventType(), AggregateID: event.AggregateID()}
+	}
+
+	record := &mongoEventRecord{
+		Type:          event.EventType(),
+		AggregateType: event.AggregateType(),
+		Version:       version,
+		Position:      position,
+		Timestamp:     timestamp,
+		Headers:       headers,
+	}
+	if s.storageHook != nil {
+		if record.Payload, err = s.storageHook.PrePersist(event, data); err != nil {
+			return nil, err
+		}
+	} else {
+		record.Data = bson.Raw(data)
+	}
+	return record, nil
+}
+
+// withTransaction runs f in a transaction if the deployment supports them,
+// which replica sets and sharded clusters do. Standalone servers don't, so
+// there f is run while holding a lock of the store if enabled with
+// WithStandaloneLocking, which only serializes the saves of this process.
+func (s *EventStore) withTransaction(ctx context.Context, f func(context.Context) error) error {
+	supported, err := s.supportsTransactions(ctx)
+	if err != nil {
+		return &eventhorizon.EventError{Err: ErrCouldNotSaveAggregate, Cause: err}
+	}
+	if !supported {
+		if !s.standaloneLocking {
+			return &eventhorizon.EventError{Err: ErrCouldNotSaveAggregate, Cause: ErrNoTransactions}
+		}
+		s.saveMu.Lock()
+		defer s.saveMu.Unlock()
+		return f(ctx)
+	}
+
+	session, err := s.client.StartSession()
+	if err != nil {
+		return &eventhorizon.EventError{Err: ErrCouldNotSaveAggregate, Cause: err}
+	}
+	defer session.EndSession(ctx)
+	_, err = session.WithTransaction(ctx, func(ctx mongo.SessionContext) (interface{}, error) {
+		return nil, f(ctx)
+	})
+	return err
+}
+
+// supportsTransactions returns true if the deployment is a replica set or a
+// sharded cluster. It is checked once, unless the server can't be reached.
+func (s *EventStore) supportsTransactions(ctx context.Context) (bool, error) {
+	s.transactionsMu.Lock()
+	defer s.transactionsMu.Unlock()
+	if s.transactions != nil {
+		return *s.transactions, nil
+	}
+
+	// Servers before MongoDB 4.4.2 only have the isMaster command.
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	admin := s.client.Database("admin")
+	if err := admin.RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		if err := admin.RunCommand(ctx, bson.D{{Key: "isMaster", Value: 1}}).Decode(&hello); err != nil {
+			return false, err
+		}
+	}
+	supported := hello.SetName != "" || hello.Msg == "isdbgrid"
+	s.transactions = &supported
+	return supported, nil
+}
+
+// versionConflict creates an ErrVersionConflict with the events saved after
+// the expected version.
+func (s *EventStore) versionConflict(ctx context.Context, id eventhorizon.UUID, version int) error {
+	var aggregate mongoAggregateRecord
+	err := s.c("events").FindOne(ctx, bson.M{"_id": id.String()}).Decode(&aggregate)
+	if err != nil {
+		return &eventhorizon.EventError{Err: ErrCouldNotLoadAggregate, Cause: err, AggregateID: id}
+	}
+
+	conflict := eventhorizon.ErrVersionConflict{
+		AggregateID:     id,
+		ExpectedVersion: version,
+		ActualVersion:   aggregate.Version,
+	}
+	for _, record := range aggregate.Events {
+		if record.Version <= version {
+			continue
+		}
+		event, err := s.decodeEvent(record, id)
+		if err != nil {
+			return err
+		}
+		conflict.ConflictingEvents = append(conflict.ConflictingEvents, event)
+	}
+	return conflict
+}
+
 // Load loads all events for the aggregate id from the database.
 // Returns ErrNoEventsFound if no events can be found.
 func (s *EventStore) Load(id eventhorizon.UUID) ([]eventhorizon.Event, error) {
-	sess := s.session.Copy()
-	defer sess.Close()
+	return s.LoadWithContext(context.Background(), id)
+}
 
+// LoadWithContext loads all events for the aggregate id as Load, with a
+// context for the database calls.
+func (s *EventStore) LoadWithContext(ctx context.Context, id eventhorizon.UUID) ([]eventhorizon.Event, error) {
 	var aggregate mongoAggregateRecord
-	err := sess.DB(s.db).C("events").FindId(id.String()).One(&aggregate)
+	err := s.c("events").FindOne(ctx, bson.M{"_id": id.String()}).Decode(&aggregate)
 	if err != nil {
 		return nil, eventhorizon.ErrNoEventsFound
 	}
+	if aggregate.Deleted {
+		return nil, eventhorizon.ErrAggregateDeleted
+	}
 
 	events := make([]eventhorizon.Event, len(aggregate.Events))
 	for i, record := range aggregate.Events {
-		// Get the registered factory function for creating events.
-		f, ok := s.factories[record.Type]
-		if !ok {
-			return nil, ErrEventNotRegistered
+		if events[i], err = s.decodeEvent(record, id); err != nil {
+			s.counters.loadErrors.Add(1)
+			return nil, err
 		}
+	}
+	s.counters.loads.Add(1)
+	s.counters.loaded.Add(uint64(len(events)))
+
+	return events, nil
+}
 
-		// Manually decode the raw BSON event.
-		event := f()
-		if err := record.Data.Unmarshal(event); err != nil {
-			return nil, ErrCouldNotUnmarshalEvent
+// LoadAfter loads the events of an aggregate that follow its state at a
+// version, for restoring it from a snapshot. Only those events are read from
+// the database.
+func (s *EventStore) LoadAfter(id eventhorizon.UUID, version int) ([]eventhorizon.Event, error) {
+	var aggregate mongoAggregateRecord
+	err := s.c("events").FindOne(context.Background(), bson.M{"_id": id.String()},
+		options.FindOne().SetProjection(bson.M{
+			"deleted": 1,
+			"events": bson.M{"$filter": bson.M{
+				"input": "$events",
+				"cond":  bson.M{"$gt": bson.A{"$$this.version", version}},
+			}},
+		})).Decode(&aggregate)
+	if err != nil {
+		return nil, eventhorizon.ErrNoEventsFound
+	}
+	if aggregate.Deleted {
+		return nil, eventhorizon.ErrAggregateDeleted
+	}
+
+	events := make([]eventhorizon.Event, len(aggregate.Events))
+	for i, record := range aggregate.Events {
+		if events[i], err = s.decodeEvent(record, id); err != nil {
+			s.counters.loadErrors.Add(1)
+			return nil, err
 		}
-		if events[i], ok = event.(eventhorizon.Event); !ok {
-			return nil, ErrInvalidEvent
+	}
+	s.counters.loads.Add(1)
+	s.counters.loaded.Add(uint64(len(events)))
+
+	return events, nil
+}
+
+// LoadEnvelopes loads all events for the aggregate id in envelopes with their
+// versions, timestamps and headers.
+func (s *EventStore) LoadEnvelopes(id eventhorizon.UUID) ([]eventhorizon.EventEnvelope, error) {
+	var aggregate mongoAggregateRecord
+	err := s.c("events").FindOne(context.Background(), bson.M{"_id": id.String()}).Decode(&aggregate)
+	if err != nil {
+		return nil, eventhorizon.ErrNoEventsFound
+	}
+	if aggregate.Deleted {
+		return nil, eventhorizon.ErrAggregateDeleted
+	}
+
+	envelopes := make([]eventhorizon.EventEnvelope, len(aggregate.Events))
+	for i, record := range aggregate.Events {
+		event, err := s.decodeEvent(record, id)
+		if err != nil {
+			return nil, err
+		}
+		envelopes[i] = eventhorizon.EventEnvelope{
+			Event:     event,
+			Version:   record.Version,
+			Timestamp: record.Timestamp,
+			Headers:   record.Headers,
 		}
+	}
+	return envelopes, nil
+}
+
+// Streams returns the streams of all aggregates, also deleted ones, in the order
+// of their aggregate IDs. The aggregate type is the one of the first event,
+// which is empty for events saved before aggregate types were stored.
+func (s *EventStore) Streams(ctx context.Context) ([]eventhorizon.StreamInfo, error) {
+	return s.findStreams(ctx, bson.D{{Key: "_id", Value: 1}}, 0)
+}
+
+// findStreams returns the streams of the aggregates in an order, up to limit of
+// them, or all if limit is 0.
+func (s *EventStore) findStreams(ctx context.Context, order bson.D, limit int) ([]eventhorizon.StreamInfo, error) {
+	pipeline := []bson.M{
+		{"$project": bson.M{
+			"version":        1,
+			"deleted":        1,
+			"count":          bson.M{"$size": "$events"},
+			"aggregate_type": bson.M{"$arrayElemAt": bson.A{"$events.aggregate_type", 0}},
+		}},
+		{"$sort": order},
+	}
+	if limit > 0 {
+		pipeline = append(pipeline, bson.M{"$limit": limit})
+	}
+	cursor, err := s.c("events").Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return nil, &eventhorizon.EventError{Err: ErrCouldNotLoadAggregate, Cause: err}
+	}
+	var results []struct {
+		AggregateID   string `bson:"_id"`
+		AggregateType string `bson:"aggregate_type"`
+		Version       int    `bson:"version"`
+		Count         int    `bson:"count"`
+		Deleted       bool   `bson:"deleted"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, &eventhorizon.EventError{Err: ErrCouldNotLoadAggregate, Cause: err}
+	}
 
-		// Set conrcete event and zero out the decoded event.
-		record.Event = events[i]
-		record.Data = bson.Raw{}
+	streams := make([]eventhorizon.StreamInfo, len(results))
+	for i, result := range results {
+		streams[i] = eventhorizon.StreamInfo{
+			AggregateID:   eventhorizon.UUID(result.AggregateID),
+			AggregateType: result.AggregateType,
+			Version:       result.Version,
+			Events:        result.Count,
+			Deleted:       result.Deleted,
+		}
 	}
+	return streams, nil
+}
 
+// EventStats returns the statistics of all events, with events counted in time
+// buckets of a size, if not 0, and up to top of the largest streams. The events
+// are counted in the database. Buckets are aligned to the Unix epoch.
+func (s *EventStore) EventStats(ctx context.Context, bucket time.Duration, top int) (*eventhorizon.EventStats, error) {
+	count := func(field interface{}) bson.A {
+		return bson.A{bson.M{"$group": bson.M{"_id": field, "count": bson.M{"$sum": 1}}}}
+	}
+	facets := bson.M{
+		"types":           count("$events.type"),
+		"aggregate_types": count("$events.aggregate_type"),
+	}
+	if bucket > 0 {
+		millis := bson.M{"$toLong": "$events.timestamp"}
+		facets["buckets"] = count(bson.M{"$subtract": bson.A{millis,
+			bson.M{"$mod": bson.A{millis, int64(bucket / time.Millisecond)}}}})
+	}
+	cursor, err := s.c("events").Aggregate(ctx, []bson.M{
+		{"$unwind": "$events"},
+		{"$facet": facets},
+	})
+	if err != nil {
+		return nil, &eventhorizon.EventError{Err: ErrCouldNotLoadAggregate, Cause: err}
+	}
+	type group struct {
+		ID    interface{} `bson:"_id"`
+		Count int         `bson:"count"`
+	}
+	var results []struct {
+		Types          []group `bson:"types"`
+		AggregateTypes []group `bson:"aggregate_types"`
+		Buckets        []group `bson:"buckets"`
+	}
+	if err := cursor.All(ctx, &results); err != nil || len(results) != 1 {
+		return nil, &eventhorizon.EventError{Err: ErrCouldNotLoadAggregate, Cause: err}
+	}
+
+	stats := &eventhorizon.EventStats{
+		EventTypes:     map[string]int{},
+		AggregateTypes: map[string]int{},
+		Buckets:        map[time.Time]int{},
+	}
+	for _, g := range results[0].Types {
+		t, _ := g.ID.(string)
+		stats.EventTypes[t] = g.Count
+		stats.Events += g.Count
+	}
+	for _, g := range results[0].AggregateTypes {
+		t, _ := g.ID.(string)
+		stats.AggregateTypes[t] = g.Count
+	}
+	for _, g := range results[0].Buckets {
+		if millis, ok := g.ID.(int64); ok {
+			stats.Buckets[time.Unix(0, millis*int64(time.Millisecond)).UTC()] = g.Count
+		}
+	}
+
+	aggregates, err := s.c("events").CountDocuments(ctx, bson.M{})
+	if err != nil {
+		return nil, &eventhorizon.EventError{Err: ErrCouldNotLoadAggregate, Cause: err}
+	}
+	stats.Aggregates = int(aggregates)
+
+	if top > 0 {
+		if stats.LargestStreams, err = s.findStreams(ctx,
+			bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}, top); err != nil {
+			return nil, err
+		}
+	}
+	return stats, nil
+}
+
+// LoadStored loads the stored events of an aggregate, also if it has been
+// deleted. The data of the events are decoded as bson.M, after passing it back
+// through the storage hook if there is one, or kept as bytes otherwise.
+func (s *EventStore) LoadStored(ctx context.Context, id eventhorizon.UUID) ([]eventhorizon.StoredEvent, error) {
+	var aggregate mongoAggregateRecord
+	err := s.c("events").FindOne(ctx, bson.M{"_id": id.String()}).Decode(&aggregate)
+	if err == mongo.ErrNoDocuments {
+		return nil, eventhorizon.ErrNoEventsFound
+	} else if err != nil {
+		return nil, &eventhorizon.EventError{Err: ErrCouldNotLoadAggregate, Cause: err, AggregateID: id}
+	}
+
+	events := make([]eventhorizon.StoredEvent, len(aggregate.Events))
+	for i, record := range aggregate.Events {
+		events[i] = eventhorizon.StoredEvent{
+			Type:          record.Type,
+			AggregateType: record.AggregateType,
+			AggregateID:   id,
+			Version:       record.Version,
+			Timestamp:     record.Timestamp,
+			Headers:       record.Headers,
+		}
+
+		data := record.Data
+		if record.Payload != nil {
+			if s.storageHook == nil {
+				events[i].Data = record.Payload
+				continue
+			}
+			d, err := s.storageHook.PostLoad(record.Type, record.Payload)
+			if err != nil {
+				return nil, err
+			}
+			data = bson.Raw(d)
+		}
+		if data == nil {
+			continue
+		}
+		m := bson.M{}
+		if err := bson.Unmarshal(data, &m); err != nil {
+			return nil, &eventhorizon.EventError{Err: ErrCouldNotUnmarshalEvent, Cause: err,
+				EventType: record.Type, AggregateID: id}
+		}
+		events[i].Data = m
+	}
 	return events, nil
 }
 
+// LoadAll loads up to limit events of all aggregates after a position, in the
+// order of their positions. Positions are allocated in the transaction that
+// saves the events, so events become visible in the order of their positions
+// and a position can be used to resume. On standalone servers, which have no
+// transactions, this only holds for saves by the same process, see
+// WithStandaloneLocking. Events saved before positions were added are not
+// included.
+func (s *EventStore) LoadAll(ctx context.Context, from eventhorizon.Position, limit int) ([]eventhorizon.EventEnvelope, eventhorizon.Position, error) {
+	if err := s.ensureIndexes(ctx); err != nil {
+		return nil, from, err
+	}
+
+	var start int64
+	if from != "" {
+		var err error
+		if start, err = strconv.ParseInt(string(from), 10, 64); err != nil || start < 0 {
+			return nil, from, eventhorizon.ErrInvalidPosition
+		}
+	}
+
+	// Select the aggregates with the index before unwinding their events.
+	after := bson.M{"events.position": bson.M{"$gt": start}}
+	pipeline := []bson.M{
+		{"$match": after},
+		{"$unwind": "$events"},
+		{"$match": after},
+		{"$sort": bson.M{"events.position": 1}},
+	}
+	if limit > 0 {
+		pipeline = append(pipeline, bson.M{"$limit": limit})
+	}
+	pipeline = append(pipeline, bson.M{"$project": bson.M{"events": 1}})
+
+	envelopes, err := s.aggregateEnvelopes(ctx, pipeline)
+	if err != nil {
+		return nil, from, err
+	}
+	if len(envelopes) == 0 {
+		return envelopes, from, nil
+	}
+	return envelopes, envelopes[len(envelopes)-1].Position, nil
+}
+
+// FindEvents finds the events matching a query, in the order of their
+// positions. Events saved before aggregate types were stored don't match a
+// query with an aggregate type.
+func (s *EventStore) FindEvents(ctx context.Context, query eventhorizon.Query) ([]eventhorizon.EventEnvelope, error) {
+	if err := s.ensureIndexes(ctx); err != nil {
+		return nil, err
+	}
+
+	match := bson.M{}
+	if len(query.EventTypes) > 0 {
+		match["type"] = bson.M{"$in": query.EventTypes}
+	}
+	if query.AggregateType != "" {
+		match["aggregate_type"] = query.AggregateType
+	}
+	timestamp := bson.M{}
+	if !query.From.IsZero() {
+		timestamp["$gte"] = query.From
+	}
+	if !query.To.IsZero() {
+		timestamp["$lt"] = query.To
+	}
+	if len(timestamp) > 0 {
+		match["timestamp"] = timestamp
+	}
+
+	// Select the aggregates with the index before unwinding their events.
+	unwound := bson.M{}
+	for k, v := range match {
+		unwound["events."+k] = v
+	}
+	pipeline := []bson.M{
+		{"$match": bson.M{"events": bson.M{"$elemMatch": match}}},
+		{"$unwind": "$events"},
+		{"$match": unwound},
+		{"$sort": bson.M{"events.position": 1}},
+	}
+	if query.Limit > 0 {
+		pipeline = append(pipeline, bson.M{"$limit": query.Limit})
+	}
+	pipeline = append(pipeline, bson.M{"$project": bson.M{"events": 1}})
+
+	return s.aggregateEnvelopes(ctx, pipeline)
+}
+
+// aggregateEnvelopes runs a pipeline that results in one event record per
+// document, and decodes them into envelopes with their positions.
+func (s *EventStore) aggregateEnvelopes(ctx context.Context, pipeline []bson.M) ([]eventhorizon.EventEnvelope, error) {
+	cursor, err := s.c("events").Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return nil, &eventhorizon.EventError{Err: ErrCouldNotLoadAggregate, Cause: err}
+	}
+	var results []struct {
+		Record mongoEventRecord `bson:"events"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, &eventhorizon.EventError{Err: ErrCouldNotLoadAggregate, Cause: err}
+	}
+
+	envelopes := make([]eventhorizon.EventEnvelope, len(results))
+	for i, result := range results {
+		event, err := s.decodeEvent(&result.Record, "")
+		if err != nil {
+			return nil, err
+		}
+		envelopes[i] = eventhorizon.EventEnvelope{
+			Event:     event,
+			Version:   result.Record.Version,
+			Timestamp: result.Record.Timestamp,
+			Position:  eventhorizon.Position(strconv.FormatInt(result.Record.Position, 10)),
+			Headers:   result.Record.Headers,
+		}
+	}
+	return envelopes, nil
+}
+
+// ensureIndexes creates the indexes used for finding and loading all events,
+// once.
+func (s *EventStore) ensureIndexes(ctx context.Context) error {
+	s.indexesOnce.Do(func() {
+		_, s.indexesErr = s.c("events").Indexes().CreateMany(ctx, []mongo.IndexModel{
+			{Keys: bson.D{{Key: "events.type", Value: 1}, {Key: "events.timestamp", Value: 1}}},
+			{Keys: bson.D{{Key: "events.aggregate_type", Value: 1}, {Key: "events.timestamp", Value: 1}}},
+			{Keys: bson.D{{Key: "events.timestamp", Value: 1}}},
+			{Keys: bson.D{{Key: "events.position", Value: 1}}},
+		})
+	})
+	return s.indexesErr
+}
+
+// Subscribe returns a channel that receives the events saved after the call,
+// also by other processes. Saves are signaled with a capped collection that is
+// watched with a change stream, or tailed if the server does not support
+// change streams, and the events are then loaded with LoadAll.
+func (s *EventStore) Subscribe(ctx context.Context) <-chan eventhorizon.EventEnvelope {
+	ch := make(chan eventhorizon.EventEnvelope, 100)
+	go func() {
+		defer close(ch)
+
+		// Start from the latest allocated position.
+		var counter struct {
+			Position int64 `bson:"position"`
+		}
+		err := s.c("counters").FindOne(ctx, bson.M{"_id": "position"}).Decode(&counter)
+		if err != nil && err != mongo.ErrNoDocuments {
+			log.Printf("error: event store subscribe: %v\n", err)
+			return
+		}
+		if err := s.ensureNotifications(ctx); err != nil {
+			log.Printf("error: event store subscribe: %v\n", err)
+			return
+		}
+		position := eventhorizon.Position(strconv.FormatInt(counter.Position, 10))
+
+		for ctx.Err() == nil {
+			notifications, err := s.watchNotifications(ctx, position)
+			if err != nil {
+				log.Printf("error: event store subscribe: %v\n", err)
+				return
+			}
+			for notifications.Next(ctx) {
+				envelopes, next, err := s.LoadAll(ctx, position, 0)
+				if err != nil {
+					log.Printf("error: event store subscribe: %v\n", err)
+					continue
+				}
+				position = next
+				for _, envelope := range envelopes {
+					select {
+					case ch <- envelope:
+					case <-ctx.Done():
+						notifications.Close(context.Background())
+						return
+					}
+				}
+			}
+			if err := notifications.Err(); err != nil && ctx.Err() == nil {
+				log.Printf("error: event store subscribe: %v\n", err)
+			}
+			notifications.Close(context.Background())
+
+			// Tailable cursors are closed by the server when there are no
+			// notifications after the position yet.
+			select {
+			case <-ctx.Done():
+			case <-s.clock.After(time.Second):
+			}
+		}
+	}()
+	return ch
+}
+
+// notificationStream is a stream of notifications of saves, either a change
+// stream or a tailable cursor.
+type notificationStream interface {
+	Next(context.Context) bool
+	Err() error
+	Close(context.Context) error
+}
+
+// watchNotifications returns a stream of the notifications after a position.
+// Change streams need a replica set, on standalone servers the capped
+// collection is tailed instead.
+func (s *EventStore) watchNotifications(ctx context.Context, position eventhorizon.Position) (notificationStream, error) {
+	after, _ := strconv.ParseInt(string(position), 10, 64)
+
+	stream, err := s.c("notifications").Watch(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"operationType": "insert"}}},
+	})
+	if err == nil {
+		return stream, nil
+	}
+
+	return s.c("notifications").Find(ctx,
+		bson.M{"position": bson.M{"$gt": after}},
+		options.Find().SetCursorType(options.TailableAwait).SetMaxAwaitTime(time.Second),
+	)
+}
+
+// ensureNotifications creates the collection used for notifying subscribers,
+// once. Deployments with transactions watch it with a change stream, so there
+// it is a regular collection where notifications expire, which can be written
+// in the transaction of the events. Standalone servers tail it instead, which
+// needs a capped collection. Collections created as capped by older versions
+// are kept, and notified after the transaction.
+func (s *EventStore) ensureNotifications(ctx context.Context) error {
+	s.notificationsOnce.Do(func() {
+		transactions, err := s.supportsTransactions(ctx)
+		if err != nil {
+			s.notificationsErr = err
+			return
+		}
+		opts := options.CreateCollection().SetCapped(true).SetSizeInBytes(1 << 20)
+		if transactions {
+			opts = options.CreateCollection()
+		}
+		err = s.client.Database(s.db).CreateCollection(ctx, "notifications", opts)
+		if err != nil && !strings.Contains(err.Error(), "already exists") {
+			s.notificationsErr = err
+			return
+		}
+		if !transactions {
+			return
+		}
+
+		specs, err := s.client.Database(s.db).ListCollectionSpecifications(ctx, bson.M{"name": "notifications"})
+		if err != nil {
+			s.notificationsErr = err
+			return
+		}
+		for _, spec := range specs {
+			if capped, ok := spec.Options.Lookup("capped").BooleanOK(); ok && capped {
+				return
+			}
+		}
+		if _, err := s.c("notifications").Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys:    bson.D{{Key: "timestamp", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(3600),
+		}); err != nil {
+			s.notificationsErr = err
+			return
+		}
+		s.notifyInTransaction = true
+	})
+	return s.notificationsErr
+}
+
+// notify inserts a notification of saved events up to a position.
+func (s *EventStore) notify(ctx context.Context, position int64) error {
+	_, err := s.c("notifications").InsertOne(ctx, bson.M{
+		"position":  position,
+		"timestamp": s.clock.Now(),
+	})
+	return err
+}
+
+// decodeEvent decodes the event of a record using the registered factories.
+// The aggregate ID, if known, is set on errors.
+func (s *EventStore) decodeEvent(record *mongoEventRecord, id eventhorizon.UUID) (eventhorizon.Event, error) {
+	// Get the registered factory function for creating events.
+	f, ok := s.factories[record.Type]
+	if !ok {
+		return nil, &eventhorizon.EventError{Err: ErrEventNotRegistered,
+			EventType: record.Type, AggregateID: id}
+	}
+
+	// Data that was passed through the storage hook is passed back first.
+	if record.Payload != nil {
+		if s.storageHook == nil {
+			return nil, &eventhorizon.EventError{Err: ErrCouldNotUnmarshalEvent,
+				EventType: record.Type, AggregateID: id}
+		}
+		data, err := s.storageHook.PostLoad(record.Type, record.Payload)
+		if err != nil {
+			return nil, err
+		}
+		record.Data = bson.Raw(data)
+	}
+
+	// Manually decode the raw BSON event.
+	event := f()
+	if err := bson.Unmarshal(record.Data, event); err != nil {
+		return nil, &eventhorizon.EventError{Err: ErrCouldNotUnmarshalEvent, Cause: err,
+			EventType: record.Type, AggregateID: id}
+	}
+	return event, nil
+}
+
+// LoadIterator returns an iterator over all events for the aggregate id. The
+// events are streamed from the database with a cursor.
+func (s *EventStore) LoadIterator(id eventhorizon.UUID) (eventhorizon.EventIterator, error) {
+	ctx := context.Background()
+
+	deleted, err := s.c("events").CountDocuments(ctx, bson.M{"_id": id.String(), "deleted": true})
+	if err != nil {
+		return nil, &eventhorizon.EventError{Err: ErrCouldNotLoadAggregate, Cause: err, AggregateID: id}
+	}
+	if deleted > 0 {
+		return nil, eventhorizon.ErrAggregateDeleted
+	}
+
+	// Unwind the events of the aggregate to get one event per document.
+	cursor, err := s.c("events").Aggregate(ctx, []bson.M{
+		{"$match": bson.M{"_id": id.String()}},
+		{"$unwind": "$events"},
+		{"$project": bson.M{"events": 1}},
+	})
+	if err != nil {
+		return nil, &eventhorizon.EventError{Err: ErrCouldNotLoadAggregate, Cause: err, AggregateID: id}
+	}
+
+	return &eventIterator{
+		store:  s,
+		cursor: cursor,
+	}, nil
+}
+
+// eventIterator is an EventIterator using a MongoDB cursor.
+type eventIterator struct {
+	store  *EventStore
+	cursor *mongo.Cursor
+	event  eventhorizon.Event
+	err    error
+}
+
+// Next implements the Next method of the eventhorizon.EventIterator interface.
+func (i *eventIterator) Next() bool {
+	if i.err != nil {
+		return false
+	}
+
+	if !i.cursor.Next(context.Background()) {
+		return false
+	}
+	var result struct {
+		Record mongoEventRecord `bson:"events"`
+	}
+	if err := i.cursor.Decode(&result); err != nil {
+		i.err = &eventhorizon.EventError{Err: ErrCouldNotUnmarshalEvent, Cause: err}
+		return false
+	}
+
+	event, err := i.store.decodeEvent(&result.Record, "")
+	if err != nil {
+		i.err = err
+		return false
+	}
+	i.event = event
+	return true
+}
+
+// Event implements the Event method of the eventhorizon.EventIterator interface.
+func (i *eventIterator) Event() eventhorizon.Event {
+	return i.event
+}
+
+// Err implements the Err method of the eventhorizon.EventIterator interface.
+func (i *eventIterator) Err() error {
+	if i.err != nil {
+		return i.err
+	}
+	return i.cursor.Err()
+}
+
+// Close implements the Close method of the eventhorizon.EventIterator interface.
+func (i *eventIterator) Close() error {
+	return i.cursor.Close(context.Background())
+}
+
+// Delete marks an aggregate as deleted and appends and publishes an
+// AggregateDeleted event. Returns ErrNoEventsFound if there is no aggregate.
+func (s *EventStore) Delete(id eventhorizon.UUID) error {
+	ctx := context.Background()
+
+	// Get the last event for the aggregate type.
+	var aggregate mongoAggregateRecord
+	err := s.c("events").FindOne(ctx, bson.M{"_id": id.String()},
+		options.FindOne().SetProjection(bson.M{"deleted": 1, "events": bson.M{"$slice": -1}}),
+	).Decode(&aggregate)
+	if err == mongo.ErrNoDocuments || (err == nil && len(aggregate.Events) == 0) {
+		return eventhorizon.ErrNoEventsFound
+	} else if err != nil {
+		return &eventhorizon.EventError{Err: ErrCouldNotLoadAggregate, Cause: err, AggregateID: id}
+	}
+	if aggregate.Deleted {
+		return eventhorizon.ErrAggregateDeleted
+	}
+	last, err := s.decodeEvent(aggregate.Events[0], id)
+	if err != nil {
+		return err
+	}
+
+	event := &eventhorizon.AggregateDeleted{
+		ID:   id,
+		Type: last.AggregateType(),
+	}
+	if err := s.Save([]eventhorizon.Event{event}); err != nil {
+		return err
+	}
+	if _, err := s.c("events").UpdateOne(ctx, bson.M{"_id": id.String()},
+		bson.M{"$set": bson.M{"deleted": true}}); err != nil {
+		return &eventhorizon.EventError{Err: ErrCouldNotSaveAggregate, Cause: err, AggregateID: id}
+	}
+	return nil
+}
+
+// TruncateBefore removes the events of an aggregate before a version, if there
+// is a snapshot of at least that version in the snapshot store.
+func (s *EventStore) TruncateBefore(id eventhorizon.UUID, version int) error {
+	if err := eventhorizon.CheckSnapshot(s.snapshotStore, id, version); err != nil {
+		return err
+	}
+
+	result, err := s.c("events").UpdateOne(context.Background(), bson.M{"_id": id.String()},
+		bson.M{"$pull": bson.M{"events": bson.M{"version": bson.M{"$lt": version}}}})
+	if err != nil {
+		return &eventhorizon.EventError{Err: ErrCouldNotSaveAggregate, Cause: err, AggregateID: id}
+	} else if result.MatchedCount == 0 {
+		return eventhorizon.ErrNoEventsFound
+	}
+	return nil
+}
+
+// Purge removes all events of an aggregate.
+func (s *EventStore) Purge(id eventhorizon.UUID) error {
+	result, err := s.c("events").DeleteOne(context.Background(), bson.M{"_id": id.String()})
+	if err != nil {
+		return &eventhorizon.EventError{Err: ErrCouldNotSaveAggregate, Cause: err, AggregateID: id}
+	} else if result.DeletedCount == 0 {
+		return eventhorizon.ErrNoEventsFound
+	}
+	return nil
+}
+
+// ApplyRetention removes the events that are not retained by a policy at a
+// time. Aggregates without retained events are removed, other events only as
+// far as the latest snapshot of their aggregate covers them.
+func (s *EventStore) ApplyRetention(ctx context.Context, policy eventhorizon.RetentionPolicy, now time.Time) error {
+	c := s.c("events")
+	selector := bson.M{"events.aggregate_type": bson.M{"$nin": append([]string{}, policy.Exempt...)}}
+
+	// Remove the aggregates without any retained events.
+	if policy.MaxAge > 0 {
+		if _, err := c.DeleteMany(ctx, bson.M{"$and": bson.A{selector, bson.M{
+			"events.timestamp": bson.M{"$not": bson.M{"$gte": now.Add(-policy.MaxAge)}},
+		}}}); err != nil {
+			return &eventhorizon.EventError{Err: ErrCouldNotSaveAggregate, Cause: err}
+		}
+	}
+
+	// Find the aggregates with expired events, which are truncated as far
+	// as their snapshots cover them.
+	var expired bson.A
+	if policy.MaxAge > 0 {
+		expired = append(expired, bson.M{"events.timestamp": bson.M{"$lt": now.Add(-policy.MaxAge)}})
+	}
+	if policy.MaxEvents > 0 {
+		expired = append(expired, bson.M{"events." + strconv.Itoa(policy.MaxEvents): bson.M{"$exists": true}})
+	}
+	if len(expired) == 0 || s.snapshotStore == nil {
+		return nil
+	}
+	cursor, err := c.Find(ctx, bson.M{"$and": bson.A{selector, bson.M{"$or": expired}}},
+		options.Find().SetProjection(bson.M{"events.version": 1, "events.timestamp": 1}))
+	if err != nil {
+		return &eventhorizon.EventError{Err: ErrCouldNotLoadAggregate, Cause: err}
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var aggregate mongoAggregateRecord
+		if err := cursor.Decode(&aggregate); err != nil {
+			return &eventhorizon.EventError{Err: ErrCouldNotLoadAggregate, Cause: err}
+		}
+		id := eventhorizon.UUID(aggregate.AggregateID)
+
+		// Truncate before the first retained event, or before the snapshot.
+		version := 0
+		for i, record := range aggregate.Events {
+			if !policy.Expired(i, len(aggregate.Events), record.Timestamp, now) {
+				version = record.Version
+				break
+			}
+		}
+		snapshot, err := s.snapshotStore.LoadSnapshot(id)
+		if err == eventhorizon.ErrSnapshotNotFound {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if snapshot.Version < version {
+			version = snapshot.Version
+		}
+
+		if _, err := c.UpdateOne(ctx, bson.M{"_id": aggregate.AggregateID},
+			bson.M{"$pull": bson.M{"events": bson.M{"version": bson.M{"$lt": version}}}}); err != nil {
+			return &eventhorizon.EventError{Err: ErrCouldNotSaveAggregate, Cause: err, AggregateID: id}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return &eventhorizon.EventError{Err: ErrCouldNotLoadAggregate, Cause: err}
+	}
+	return nil
+}
+
+// SetSnapshotStore sets the snapshot store that is checked before truncating.
+func (s *EventStore) SetSnapshotStore(snapshotStore eventhorizon.SnapshotStore) {
+	s.snapshotStore = snapshotStore
+}
+
 // RegisterEventType registers an event factory for a event type. The factory is
 // used to create concrete event types when loading from the database.
 //
@@ -230,20 +1480,27 @@ func (s *EventStore) RegisterEventType(event eventhorizon.Event, factory func()
 	return nil
 }
 
-// SetDB sets the database session.
+// SetDB sets the database.
 func (s *EventStore) SetDB(db string) {
 	s.db = db
 }
 
+// SetStorageHook sets a hook for the data of events before it is persisted and
+// after it is loaded, for example for encryption. Events saved with a hook
+// can only be loaded with it.
+func (s *EventStore) SetStorageHook(hook eventhorizon.EventStorageHook) {
+	s.storageHook = hook
+}
+
 // Clear clears the event storge.
 func (s *EventStore) Clear() error {
-	if err := s.session.DB(s.db).C("events").DropCollection(); err != nil {
+	if err := s.c("events").Drop(context.Background()); err != nil {
 		return ErrCouldNotClearDB
 	}
 	return nil
 }
 
-// Close closes the database session.
+// Close disconnects the database client.
 func (s *EventStore) Close() {
-	s.session.Close()
+	s.client.Disconnect(context.Background())
 }
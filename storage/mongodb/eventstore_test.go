@@ -15,28 +15,27 @@
 package mongodb
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
 
 	"github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/storage/memory"
 	"github.com/looplab/eventhorizon/testutil"
 )
 
 func TestEventStore(t *testing.T) {
-	// Support Wercker testing with MongoDB.
-	host := os.Getenv("MONGO_PORT_27017_TCP_ADDR")
-	port := os.Getenv("MONGO_PORT_27017_TCP_PORT")
-
-	url := "localhost"
-	if host != "" && port != "" {
-		url = host + ":" + port
-	}
-
 	bus := &testutil.MockEventBus{
 		Events: make([]eventhorizon.Event, 0),
 	}
-	store, err := NewEventStore(bus, url, "test")
+	store, err := NewEventStore(bus, mongoURL(), "test", WithStandaloneLocking())
 	if err != nil {
 		t.Fatal("there should be no error:", err)
 	}
@@ -129,4 +128,619 @@ func TestEventStore(t *testing.T) {
 	if !reflect.DeepEqual(events, []eventhorizon.Event{event3}) {
 		t.Error("the loaded events should be correct:", events)
 	}
+
+	t.Log("count the saved and loaded events")
+	counters := store.Counters()
+	if counters.Saved != 4 || counters.Loads != 2 || counters.Loaded != 4 ||
+		counters.SaveErrors != 0 || counters.Connections == 0 {
+		t.Error("the counters should be correct:", counters)
+	}
+
+	t.Log("load events of an unregistered type")
+	id3 := eventhorizon.NewUUID()
+	if err := store.Save([]eventhorizon.Event{&testutil.TestEventOther{id3, "event4"}}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	_, err = store.Load(id3)
+	if !errors.Is(err, ErrEventNotRegistered) {
+		t.Error("there should be a ErrEventNotRegistered error:", err)
+	}
+	var e *eventhorizon.EventError
+	if !errors.As(err, &e) || e.EventType != "TestEventOther" || e.AggregateID != id3 {
+		t.Error("the error should have the event type and aggregate ID:", err)
+	}
+}
+
+func TestEventStoreLoadIterator(t *testing.T) {
+	store, _ := newTestEventStore(t)
+	defer closeTestEventStore(t, store)
+
+	id := eventhorizon.NewUUID()
+	event1 := &testutil.TestEvent{id, "event1"}
+	event2 := &testutil.TestEvent{id, "event2"}
+	if err := store.Save([]eventhorizon.Event{event1, event2}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	t.Log("iterate events")
+	iter, err := store.LoadIterator(id)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	events := []eventhorizon.Event{}
+	for iter.Next() {
+		events = append(events, iter.Event())
+	}
+	if err := iter.Err(); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := iter.Close(); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(events, []eventhorizon.Event{event1, event2}) {
+		t.Error("the iterated events should be correct:", events)
+	}
+
+	t.Log("iterate events for non-existing aggregate")
+	iter, err = store.LoadIterator(eventhorizon.NewUUID())
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if iter.Next() {
+		t.Error("there should be no events:", iter.Event())
+	}
+	iter.Close()
+}
+
+func TestEventStoreSaveMultiple(t *testing.T) {
+	store, bus := newTestEventStore(t)
+	defer closeTestEventStore(t, store)
+
+	id := eventhorizon.NewUUID()
+	event1 := &testutil.TestEvent{id, "event1"}
+	event2 := &testutil.TestEvent{id, "event2"}
+	event3 := &testutil.TestEvent{id, "event3"}
+	event4 := &testutil.TestEvent{id, "event4"}
+
+	t.Log("save multiple events, new and existing aggregate")
+	if err := store.Save([]eventhorizon.Event{event1, event2}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := store.Save([]eventhorizon.Event{event3, event4}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	var aggregate mongoAggregateRecord
+	if err := store.c("events").FindOne(context.Background(), bson.M{"_id": id.String()}).Decode(&aggregate); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if aggregate.Version != 4 {
+		t.Error("the aggregate version should be 4:", aggregate.Version)
+	}
+	for i, record := range aggregate.Events {
+		if record.Version != i+1 {
+			t.Error("the event version should be correct:", i, record.Version)
+		}
+	}
+
+	events, err := store.Load(id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	expected := []eventhorizon.Event{event1, event2, event3, event4}
+	if !reflect.DeepEqual(events, expected) {
+		t.Error("the loaded events should be correct:", events)
+	}
+	if !reflect.DeepEqual(bus.Events, expected) {
+		t.Error("the published events should be correct:", bus.Events)
+	}
+}
+
+func TestEventStoreLoadAll(t *testing.T) {
+	store, _ := newTestEventStore(t)
+	defer closeTestEventStore(t, store)
+	ctx := context.Background()
+
+	// Start after any events from earlier tests.
+	_, start, err := store.LoadAll(ctx, "", 0)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	id1, id2 := eventhorizon.NewUUID(), eventhorizon.NewUUID()
+	event1 := &testutil.TestEvent{id1, "event1"}
+	event2 := &testutil.TestEvent{id2, "event2"}
+	event3 := &testutil.TestEvent{id1, "event3"}
+	if err := store.Save([]eventhorizon.Event{event1}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := store.Save([]eventhorizon.Event{event2, event3}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	t.Log("load with limit")
+	envelopes, position, err := store.LoadAll(ctx, start, 2)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(envelopes) != 2 ||
+		!reflect.DeepEqual(envelopes[0].Event, event1) ||
+		!reflect.DeepEqual(envelopes[1].Event, event2) {
+		t.Error("the events should be correct:", envelopes)
+	}
+
+	t.Log("resume from position")
+	envelopes, _, err = store.LoadAll(ctx, position, 0)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(envelopes) != 1 || !reflect.DeepEqual(envelopes[0].Event, event3) {
+		t.Error("the events should be correct:", envelopes)
+	}
+
+	t.Log("invalid position")
+	if _, _, err = store.LoadAll(ctx, "invalid", 0); err != eventhorizon.ErrInvalidPosition {
+		t.Error("there should be a ErrInvalidPosition error:", err)
+	}
+}
+
+func TestEventStoreSubscribe(t *testing.T) {
+	store, _ := newTestEventStore(t)
+	defer closeTestEventStore(t, store)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := store.Subscribe(ctx)
+	time.Sleep(100 * time.Millisecond) // Let the subscription start.
+
+	event1 := &testutil.TestEvent{eventhorizon.NewUUID(), "event1"}
+	if err := store.Save([]eventhorizon.Event{event1}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	select {
+	case envelope := <-events:
+		if !reflect.DeepEqual(envelope.Event, event1) {
+			t.Error("the event should be correct:", envelope.Event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("there should be an event")
+	}
+}
+
+func TestEventStoreDelete(t *testing.T) {
+	store, bus := newTestEventStore(t)
+	defer closeTestEventStore(t, store)
+
+	id := eventhorizon.NewUUID()
+	event1 := &testutil.TestEvent{id, "event1"}
+	if err := store.Save([]eventhorizon.Event{event1}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	t.Log("delete aggregate")
+	if err := store.Delete(id); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	tombstone := &eventhorizon.AggregateDeleted{id, "Test"}
+	if !reflect.DeepEqual(bus.Events, []eventhorizon.Event{event1, tombstone}) {
+		t.Error("the tombstone should be published:", bus.Events)
+	}
+	if _, err := store.Load(id); err != eventhorizon.ErrAggregateDeleted {
+		t.Error("there should be a ErrAggregateDeleted error:", err)
+	}
+	if _, err := store.LoadIterator(id); err != eventhorizon.ErrAggregateDeleted {
+		t.Error("there should be a ErrAggregateDeleted error:", err)
+	}
+	if err := store.Save([]eventhorizon.Event{event1}); err != eventhorizon.ErrAggregateDeleted {
+		t.Error("there should be a ErrAggregateDeleted error:", err)
+	}
+
+	t.Log("delete non-existing aggregate")
+	if err := store.Delete(eventhorizon.NewUUID()); err != eventhorizon.ErrNoEventsFound {
+		t.Error("there should be a ErrNoEventsFound error:", err)
+	}
+}
+
+func TestEventStoreTruncate(t *testing.T) {
+	store, _ := newTestEventStore(t)
+	defer closeTestEventStore(t, store)
+
+	id := eventhorizon.NewUUID()
+	event1 := &testutil.TestEvent{id, "event1"}
+	event2 := &testutil.TestEvent{id, "event2"}
+	event3 := &testutil.TestEvent{id, "event3"}
+	if err := store.Save([]eventhorizon.Event{event1, event2, event3}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	t.Log("truncate without snapshot")
+	snapshots := memory.NewSnapshotStore()
+	store.SetSnapshotStore(snapshots)
+	if err := store.TruncateBefore(id, 3); err != eventhorizon.ErrNoNewerSnapshot {
+		t.Error("there should be a ErrNoNewerSnapshot error:", err)
+	}
+
+	t.Log("truncate with snapshot")
+	snapshots.SaveSnapshot(&eventhorizon.Snapshot{AggregateID: id, Version: 3})
+	if err := store.TruncateBefore(id, 3); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	events, err := store.Load(id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(events, []eventhorizon.Event{event3}) {
+		t.Error("the events should be truncated:", events)
+	}
+
+	t.Log("purge")
+	if err := store.Purge(id); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, err := store.Load(id); err != eventhorizon.ErrNoEventsFound {
+		t.Error("there should be a ErrNoEventsFound error:", err)
+	}
+	if err := store.Purge(id); err != eventhorizon.ErrNoEventsFound {
+		t.Error("there should be a ErrNoEventsFound error:", err)
+	}
+}
+
+func TestEventStoreMetadata(t *testing.T) {
+	store, _ := newTestEventStore(t)
+	defer closeTestEventStore(t, store)
+
+	id := eventhorizon.NewUUID()
+	event1 := &testutil.TestEvent{id, "event1"}
+	headers := eventhorizon.Headers{eventhorizon.HeaderCorrelationID: "correlation"}
+	ctx := eventhorizon.NewContextWithHeaders(context.Background(), headers)
+	if err := store.SaveWithContext(ctx, []eventhorizon.Event{event1}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	envelopes, err := store.LoadEnvelopes(id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(envelopes) != 1 || envelopes[0].Version != 1 ||
+		!reflect.DeepEqual(envelopes[0].Event, event1) ||
+		!reflect.DeepEqual(envelopes[0].Headers, headers) {
+		t.Error("the envelopes should be correct:", envelopes)
+	}
+}
+
+func TestEventStoreInspect(t *testing.T) {
+	store, _ := newTestEventStore(t)
+	defer closeTestEventStore(t, store)
+
+	id := eventhorizon.NewUUID()
+	event1 := &testutil.TestEvent{id, "event1"}
+	event2 := &testutil.TestEvent{id, "event2"}
+	if err := store.Save([]eventhorizon.Event{event1, event2}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	t.Log("list streams")
+	streams, err := store.Streams(context.Background())
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	expectedStreams := []eventhorizon.StreamInfo{
+		{AggregateID: id, AggregateType: "Test", Version: 2, Events: 2},
+	}
+	if !reflect.DeepEqual(streams, expectedStreams) {
+		t.Error("the streams should be correct:", streams)
+	}
+
+	t.Log("load stored events")
+	events, err := store.LoadStored(context.Background(), id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(events) != 2 || events[1].Version != 2 || events[1].Type != "TestEvent" ||
+		events[1].Data.(bson.M)["content"] != "event2" {
+		t.Error("the events should be correct:", events)
+	}
+
+	t.Log("load non-existing aggregate")
+	if _, err := store.LoadStored(context.Background(), eventhorizon.NewUUID()); err != eventhorizon.ErrNoEventsFound {
+		t.Error("there should be a ErrNoEventsFound error:", err)
+	}
+}
+
+func TestEventStoreStats(t *testing.T) {
+	now := time.Date(2016, 1, 1, 12, 0, 0, 0, time.UTC)
+	store, _ := newTestEventStore(t, WithClock(testutil.NewMockClock(now)))
+	defer closeTestEventStore(t, store)
+
+	id1 := eventhorizon.NewUUID()
+	id2 := eventhorizon.NewUUID()
+	if err := store.Save([]eventhorizon.Event{
+		&testutil.TestEvent{id1, "event1"},
+		&testutil.TestEvent{id1, "event2"},
+		&testutil.TestEvent{id2, "event3"},
+	}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	stats, err := store.EventStats(context.Background(), 24*time.Hour, 1)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	expected := &eventhorizon.EventStats{
+		Events:         3,
+		Aggregates:     2,
+		EventTypes:     map[string]int{"TestEvent": 3},
+		AggregateTypes: map[string]int{"Test": 3},
+		Buckets:        map[time.Time]int{time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC): 3},
+		LargestStreams: []eventhorizon.StreamInfo{
+			{AggregateID: id1, AggregateType: "Test", Version: 2, Events: 2},
+		},
+	}
+	if !reflect.DeepEqual(stats, expected) {
+		t.Error("the stats should be correct:", stats)
+	}
+
+	t.Log("count the saved events")
+	if c := store.Stats(); c.Events != 3 || c.Errors != 0 || !c.LastEvent.Equal(now) {
+		t.Error("the component stats should be correct:", c)
+	}
+}
+
+func TestEventStoreImport(t *testing.T) {
+	store, bus := newTestEventStore(t)
+	defer closeTestEventStore(t, store)
+
+	now := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	id1 := eventhorizon.NewUUID()
+	id2 := eventhorizon.NewUUID()
+	headers := eventhorizon.Headers{eventhorizon.HeaderUserID: "user"}
+
+	t.Log("import events of two aggregates")
+	err := store.Import(context.Background(), []eventhorizon.EventEnvelope{
+		{Event: &testutil.TestEvent{id1, "event1"}, Version: 1, Timestamp: now, Headers: headers},
+		{Event: &testutil.TestEvent{id2, "event2"}, Version: 1, Timestamp: now},
+		{Event: &testutil.TestEvent{id1, "event3"}, Version: 2, Timestamp: now.Add(time.Hour)},
+	})
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	envelopes, err := store.LoadEnvelopes(id1)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(envelopes) != 2 || envelopes[1].Version != 2 ||
+		!envelopes[1].Timestamp.Equal(now.Add(time.Hour)) ||
+		!reflect.DeepEqual(envelopes[0].Headers, headers) {
+		t.Error("the envelopes should be imported:", envelopes)
+	}
+	if len(bus.Events) != 0 {
+		t.Error("the imported events should not be published:", bus.Events)
+	}
+
+	t.Log("import an event that doesn't follow the stored ones")
+	err = store.Import(context.Background(), []eventhorizon.EventEnvelope{
+		{Event: &testutil.TestEvent{id1, "event4"}, Version: 2, Timestamp: now},
+	})
+	if conflict, ok := err.(eventhorizon.ErrVersionConflict); !ok ||
+		conflict.ExpectedVersion != 2 || conflict.ActualVersion != 2 {
+		t.Error("there should be a version conflict:", err)
+	}
+
+	t.Log("import and append after an import")
+	if err := store.Import(context.Background(), []eventhorizon.EventEnvelope{
+		{Event: &testutil.TestEvent{id1, "event4"}, Version: 3, Timestamp: now},
+	}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := store.Save([]eventhorizon.Event{&testutil.TestEvent{id1, "event5"}}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if envelopes, _ := store.LoadEnvelopes(id1); len(envelopes) != 4 || envelopes[3].Version != 4 {
+		t.Error("the event should follow the imported ones:", envelopes)
+	}
+}
+
+func TestEventStoreFindEvents(t *testing.T) {
+	clock := testutil.NewMockClock(time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC))
+	store, _ := newTestEventStore(t, WithClock(clock))
+	defer closeTestEventStore(t, store)
+
+	id := eventhorizon.NewUUID()
+	event1 := &testutil.TestEvent{id, "event1"}
+	event2 := &testutil.TestEvent{id, "event2"}
+	for _, event := range []eventhorizon.Event{event1, event2} {
+		if err := store.Save([]eventhorizon.Event{event}); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+		clock.Advance(time.Hour)
+	}
+
+	envelopes, err := store.FindEvents(context.Background(), eventhorizon.Query{
+		EventTypes:    []string{event1.EventType()},
+		AggregateType: event1.AggregateType(),
+		From:          time.Date(2016, 1, 1, 1, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(envelopes) != 1 || !reflect.DeepEqual(envelopes[0].Event, event2) {
+		t.Error("the events should be correct:", envelopes)
+	}
+}
+
+func TestEventStoreStorageHook(t *testing.T) {
+	store, _ := newTestEventStore(t)
+	defer closeTestEventStore(t, store)
+
+	store.SetStorageHook(xorHook{})
+	id := eventhorizon.NewUUID()
+	event1 := &testutil.TestEvent{id, "secret"}
+	if err := store.Save([]eventhorizon.Event{event1}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("the data should be persisted through the hook")
+	var raw bson.M
+	if err := store.c("events").FindOne(context.Background(), bson.M{"_id": id.String()}).Decode(&raw); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if strings.Contains(fmt.Sprint(raw), "secret") {
+		t.Error("the data should not be persisted as is:", raw)
+	}
+
+	t.Log("load through the hook")
+	events, err := store.Load(id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(events, []eventhorizon.Event{event1}) {
+		t.Error("the events should be correct:", events)
+	}
+}
+
+// xorHook is a storage hook that obfuscates data, for testing.
+type xorHook struct{}
+
+func (xorHook) PrePersist(event eventhorizon.Event, data []byte) ([]byte, error) {
+	return xor(data), nil
+}
+
+func (xorHook) PostLoad(eventType string, data []byte) ([]byte, error) {
+	return xor(data), nil
+}
+
+func xor(data []byte) []byte {
+	result := make([]byte, len(data))
+	for i, b := range data {
+		result[i] = b ^ 0xff
+	}
+	return result
+}
+
+func TestEventStoreApplyRetention(t *testing.T) {
+	now := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := testutil.NewMockClock(now)
+	store, _ := newTestEventStore(t, WithClock(clock))
+	defer closeTestEventStore(t, store)
+
+	id := eventhorizon.NewUUID()
+	event1 := &testutil.TestEvent{id, "event1"}
+	event2 := &testutil.TestEvent{id, "event2"}
+	event3 := &testutil.TestEvent{id, "event3"}
+	if err := store.Save([]eventhorizon.Event{event1}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	clock.Advance(2 * time.Hour)
+	if err := store.Save([]eventhorizon.Event{event2, event3}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	t.Log("exempt aggregate type")
+	ctx := context.Background()
+	policy := eventhorizon.RetentionPolicy{MaxAge: time.Hour, Exempt: []string{"Test"}}
+	if err := store.ApplyRetention(ctx, policy, clock.Now()); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if events, _ := store.Load(id); len(events) != 3 {
+		t.Error("the events should be retained:", events)
+	}
+
+	t.Log("by age and size without snapshots")
+	policy = eventhorizon.RetentionPolicy{MaxAge: time.Hour, MaxEvents: 1}
+	if err := store.ApplyRetention(ctx, policy, clock.Now()); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if events, _ := store.Load(id); len(events) != 3 {
+		t.Error("the events should be retained without a snapshot:", events)
+	}
+
+	t.Log("by age and size with a snapshot")
+	snapshots := memory.NewSnapshotStore()
+	store.SetSnapshotStore(snapshots)
+	snapshots.SaveSnapshot(&eventhorizon.Snapshot{AggregateID: id, Version: 3})
+	if err := store.ApplyRetention(ctx, policy, clock.Now()); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	events, err := store.Load(id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(events, []eventhorizon.Event{event3}) {
+		t.Error("the events should be removed:", events)
+	}
+
+	t.Log("remove aggregate")
+	clock.Advance(2 * time.Hour)
+	if err := store.ApplyRetention(ctx, policy, clock.Now()); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, err := store.Load(id); err != eventhorizon.ErrNoEventsFound {
+		t.Error("there should be a ErrNoEventsFound error:", err)
+	}
+}
+
+func TestEventStoreWithoutStandaloneLocking(t *testing.T) {
+	store, err := NewEventStore(nil, mongoURL(), "test")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer closeTestEventStore(t, store)
+	if err = store.RegisterEventType(&testutil.TestEvent{}, func() eventhorizon.Event {
+		return &testutil.TestEvent{}
+	}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	supported, err := store.supportsTransactions(context.Background())
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if supported {
+		t.Skip("the server has transactions")
+	}
+
+	t.Log("save to a standalone server")
+	err = store.Save([]eventhorizon.Event{&testutil.TestEvent{eventhorizon.NewUUID(), "event1"}})
+	if !errors.Is(err, ErrNoTransactions) {
+		t.Error("there should be a ErrNoTransactions error:", err)
+	}
+}
+
+// mongoURL returns the MongoDB URL, with support for Wercker testing.
+func mongoURL() string {
+	host := os.Getenv("MONGO_PORT_27017_TCP_ADDR")
+	port := os.Getenv("MONGO_PORT_27017_TCP_PORT")
+
+	url := "localhost"
+	if host != "" && port != "" {
+		url = host + ":" + port
+	}
+	return url
+}
+
+// newTestEventStore creates a store with a mock bus, a registered test event
+// type and options.
+func newTestEventStore(t *testing.T, opts ...Option) (*EventStore, *testutil.MockEventBus) {
+	bus := &testutil.MockEventBus{
+		Events: make([]eventhorizon.Event, 0),
+	}
+	opts = append([]Option{WithStandaloneLocking()}, opts...)
+	store, err := NewEventStore(bus, mongoURL(), "test", opts...)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err = store.RegisterEventType(&testutil.TestEvent{}, func() eventhorizon.Event {
+		return &testutil.TestEvent{}
+	}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	return store, bus
+}
+
+// closeTestEventStore clears and closes a store.
+func closeTestEventStore(t *testing.T, store *EventStore) {
+	t.Log("clearing collection")
+	if err := store.Clear(); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	store.Close()
 }
@@ -0,0 +1,101 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodb
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/looplab/eventhorizon"
+)
+
+// PositionStore implements a PositionStore for MongoDB, with a document per
+// named position.
+type PositionStore struct {
+	client *mongo.Client
+	db     string
+}
+
+// NewPositionStore creates a new PositionStore. Client options, such as the
+// size of the connection pool, can be passed to override the ones of the URL.
+func NewPositionStore(url, database string, opts ...*options.ClientOptions) (*PositionStore, error) {
+	client, err := connect(url, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewPositionStoreWithClient(client, database)
+}
+
+// NewPositionStoreWithClient creates a new PositionStore with a client.
+func NewPositionStoreWithClient(client *mongo.Client, database string) (*PositionStore, error) {
+	if client == nil {
+		return nil, ErrNoDBClient
+	}
+
+	s := &PositionStore{
+		client: client,
+		db:     database,
+	}
+
+	return s, nil
+}
+
+// c returns the collection of the positions.
+func (s *PositionStore) c() *mongo.Collection {
+	return s.client.Database(s.db).Collection("positions")
+}
+
+// LoadPosition implements the LoadPosition method of the PositionStore
+// interface.
+func (s *PositionStore) LoadPosition(ctx context.Context, name string) (eventhorizon.Position, error) {
+	var doc struct {
+		Position string `bson:"position"`
+	}
+	err := s.c().FindOne(ctx, bson.M{"_id": name}).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	return eventhorizon.Position(doc.Position), nil
+}
+
+// SavePosition implements the SavePosition method of the PositionStore
+// interface.
+func (s *PositionStore) SavePosition(ctx context.Context, name string, position eventhorizon.Position) error {
+	_, err := s.c().UpdateOne(ctx,
+		bson.M{"_id": name},
+		bson.M{"$set": bson.M{"position": string(position)}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// Clear clears the position storage.
+func (s *PositionStore) Clear() error {
+	if err := s.c().Drop(context.Background()); err != nil {
+		return ErrCouldNotClearDB
+	}
+	return nil
+}
+
+// Close closes the database client.
+func (s *PositionStore) Close() {
+	s.client.Disconnect(context.Background())
+}
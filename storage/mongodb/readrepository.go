@@ -15,9 +15,13 @@
 package mongodb
 
 import (
+	"context"
 	"errors"
+	"strings"
 
-	"gopkg.in/mgo.v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 
 	"github.com/looplab/eventhorizon"
 )
@@ -25,35 +29,46 @@ import (
 // ErrModelNotSet is when an model is not set on a read repository.
 var ErrModelNotSet = errors.New("model not set")
 
+// ErrInvalidQuery is when a query has an unknown operator.
+var ErrInvalidQuery = errors.New("invalid query")
+
+// DeletedField is the field that is set to true on soft deleted read models.
+const DeletedField = "_deleted"
+
+// notDeleted is the filter of read models that are not soft deleted.
+var notDeleted = bson.E{Key: DeletedField, Value: bson.M{"$exists": false}}
+
 // ReadRepository implements an MongoDB repository of read models.
+//
+// Models can be soft deleted, see eventhorizon.SoftDeleteReadRepository, which
+// sets the DeletedField on them. Soft deleted models are skipped by all finds,
+// also by FindCustom when the custom query matches them.
 type ReadRepository struct {
-	session    *mgo.Session
+	client     *mongo.Client
 	db         string
 	collection string
 	factory    func() interface{}
 }
 
-// NewReadRepository creates a new ReadRepository.
-func NewReadRepository(url, database, collection string) (*ReadRepository, error) {
-	session, err := mgo.Dial(url)
+// NewReadRepository creates a new ReadRepository. Client options, such as the
+// size of the connection pool, can be passed to override the ones of the URL.
+func NewReadRepository(url, database, collection string, opts ...*options.ClientOptions) (*ReadRepository, error) {
+	client, err := connect(url, opts...)
 	if err != nil {
-		return nil, ErrCouldNotDialDB
+		return nil, err
 	}
 
-	session.SetMode(mgo.Strong, true)
-	session.SetSafe(&mgo.Safe{W: 1})
-
-	return NewReadRepositoryWithSession(session, database, collection)
+	return NewReadRepositoryWithClient(client, database, collection)
 }
 
-// NewReadRepositoryWithSession creates a new ReadRepository with a session.
-func NewReadRepositoryWithSession(session *mgo.Session, database, collection string) (*ReadRepository, error) {
-	if session == nil {
-		return nil, ErrNoDBSession
+// NewReadRepositoryWithClient creates a new ReadRepository with a client.
+func NewReadRepositoryWithClient(client *mongo.Client, database, collection string) (*ReadRepository, error) {
+	if client == nil {
+		return nil, ErrNoDBClient
 	}
 
 	r := &ReadRepository{
-		session:    session,
+		client:     client,
 		db:         database,
 		collection: collection,
 	}
@@ -61,29 +76,51 @@ func NewReadRepositoryWithSession(session *mgo.Session, database, collection str
 	return r, nil
 }
 
-// Save saves a read model with id to the repository.
-func (r *ReadRepository) Save(id eventhorizon.UUID, model interface{}) error {
-	sess := r.session.Copy()
-	defer sess.Close()
+// c returns the collection of the read models.
+func (r *ReadRepository) c() *mongo.Collection {
+	return r.client.Database(r.db).Collection(r.collection)
+}
 
-	if _, err := sess.DB(r.db).C(r.collection).UpsertId(id, model); err != nil {
+// Save saves a read model with id to the repository. A soft deleted model is
+// kept deleted.
+func (r *ReadRepository) Save(id eventhorizon.UUID, model interface{}) error {
+	ctx := context.Background()
+	_, err := r.c().ReplaceOne(ctx, bson.D{{Key: "_id", Value: id}, notDeleted}, model,
+		options.Replace().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		// The upsert collides with a soft deleted model.
+		err = r.saveDeleted(ctx, id, model)
+	}
+	if err != nil {
 		return eventhorizon.ErrCouldNotSaveModel
 	}
 	return nil
 }
 
+// saveDeleted replaces a soft deleted model, keeping the deleted field.
+func (r *ReadRepository) saveDeleted(ctx context.Context, id eventhorizon.UUID, model interface{}) error {
+	data, err := bson.Marshal(model)
+	if err != nil {
+		return err
+	}
+	var doc bson.D
+	if err := bson.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	doc = append(doc, bson.E{Key: DeletedField, Value: true})
+	_, err = r.c().ReplaceOne(ctx, bson.M{"_id": id}, doc)
+	return err
+}
+
 // Find returns one read model with using an id. Returns
 // ErrModelNotFound if no model could be found.
 func (r *ReadRepository) Find(id eventhorizon.UUID) (interface{}, error) {
-	sess := r.session.Copy()
-	defer sess.Close()
-
 	if r.factory == nil {
 		return nil, ErrModelNotSet
 	}
 
 	model := r.factory()
-	err := sess.DB(r.db).C(r.collection).FindId(id).One(model)
+	err := r.c().FindOne(context.Background(), bson.D{{Key: "_id", Value: id}, notDeleted}).Decode(model)
 	if err != nil {
 		return nil, eventhorizon.ErrModelNotFound
 	}
@@ -91,88 +128,227 @@ func (r *ReadRepository) Find(id eventhorizon.UUID) (interface{}, error) {
 	return model, nil
 }
 
-// FindCustom uses a callback to specify a custom query.
-func (r *ReadRepository) FindCustom(callback func(*mgo.Collection) *mgo.Query) ([]interface{}, error) {
-	sess := r.session.Copy()
-	defer sess.Close()
+// FindCustom uses a callback to specify a custom query, which returns a cursor
+// over the read models. Soft deleted models are skipped.
+//
+// An example would be:
+//     repo.FindCustom(ctx, func(ctx context.Context, c *mongo.Collection) (*mongo.Cursor, error) {
+//         return c.Find(ctx, bson.M{"name": "Athena"})
+//     })
+func (r *ReadRepository) FindCustom(ctx context.Context, callback func(context.Context, *mongo.Collection) (*mongo.Cursor, error)) ([]interface{}, error) {
+	if r.factory == nil {
+		return nil, ErrModelNotSet
+	}
+
+	cursor, err := callback(ctx, r.c())
+	if err != nil {
+		return nil, err
+	}
+	return r.decodeAll(ctx, cursor, false)
+}
 
+// FindQuery returns the read models matching a query.
+func (r *ReadRepository) FindQuery(ctx context.Context, query *eventhorizon.ModelQuery) ([]interface{}, error) {
 	if r.factory == nil {
 		return nil, ErrModelNotSet
 	}
 
-	collection := sess.DB(r.db).C(r.collection)
-	query := callback(collection)
+	filter := bson.D{notDeleted}
+	for _, c := range query.Conditions {
+		if c.Operator == eventhorizon.Eq {
+			filter = append(filter, bson.E{Key: c.Field, Value: c.Value})
+			continue
+		}
+		op, ok := queryOperators[c.Operator]
+		if !ok {
+			return nil, ErrInvalidQuery
+		}
+		filter = append(filter, bson.E{Key: c.Field, Value: bson.D{{Key: op, Value: c.Value}}})
+	}
 
-	iter := query.Iter()
-	result := []interface{}{}
-	model := r.factory()
-	for iter.Next(model) {
-		result = append(result, model)
-		model = r.factory()
+	opts := options.Find()
+	if len(query.Sort) > 0 {
+		sort := bson.D{}
+		for _, o := range query.Sort {
+			order := 1
+			if o.Descending {
+				order = -1
+			}
+			sort = append(sort, bson.E{Key: o.Field, Value: order})
+		}
+		opts.SetSort(sort)
 	}
-	if err := iter.Close(); err != nil {
+	if query.Max > 0 {
+		opts.SetLimit(int64(query.Max))
+	}
+
+	cursor, err := r.c().Find(ctx, filter, opts)
+	if err != nil {
 		return nil, err
 	}
+	return r.decodeAll(ctx, cursor, false)
+}
 
-	return result, nil
+var queryOperators = map[eventhorizon.Operator]string{
+	eventhorizon.Ne:  "$ne",
+	eventhorizon.Lt:  "$lt",
+	eventhorizon.Lte: "$lte",
+	eventhorizon.Gt:  "$gt",
+	eventhorizon.Gte: "$gte",
+	eventhorizon.In:  "$in",
+}
+
+// FindByField returns the read models with a field equal to a value. The field
+// is named as stored, and an index on it should be created for large
+// collections.
+func (r *ReadRepository) FindByField(ctx context.Context, field string, value interface{}) ([]interface{}, error) {
+	if r.factory == nil {
+		return nil, ErrModelNotSet
+	}
+
+	cursor, err := r.c().Find(ctx, bson.D{{Key: field, Value: value}, notDeleted})
+	if err != nil {
+		return nil, err
+	}
+	return r.decodeAll(ctx, cursor, false)
+}
+
+// UpdateFields updates fields of a read model in place, without loading it.
+// The fields are set to the values, unless the keys are update operators, which
+// are then used as the update. This lets projectors update counters atomically
+// instead of racing with read-modify-write. Returns ErrModelNotFound if no
+// model could be found.
+//
+// An example would be:
+//     repo.UpdateFields(ctx, id, map[string]interface{}{
+//         "$inc": bson.M{"num_accepted": 1},
+//     })
+func (r *ReadRepository) UpdateFields(ctx context.Context, id eventhorizon.UUID, fields map[string]interface{}) error {
+	update := bson.M{"$set": fields}
+	for key := range fields {
+		if strings.HasPrefix(key, "$") {
+			update = bson.M(fields)
+			break
+		}
+	}
+
+	result, err := r.c().UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		return eventhorizon.ErrCouldNotSaveModel
+	} else if result.MatchedCount == 0 {
+		return eventhorizon.ErrModelNotFound
+	}
+	return nil
 }
 
 // FindAll returns all read models in the repository.
 func (r *ReadRepository) FindAll() ([]interface{}, error) {
-	sess := r.session.Copy()
-	defer sess.Close()
-
 	if r.factory == nil {
 		return nil, ErrModelNotSet
 	}
 
-	iter := sess.DB(r.db).C(r.collection).Find(nil).Iter()
+	ctx := context.Background()
+	cursor, err := r.c().Find(ctx, bson.D{notDeleted})
+	if err != nil {
+		return nil, err
+	}
+	return r.decodeAll(ctx, cursor, false)
+}
+
+// decodeAll decodes the read models of a cursor that are soft deleted, or that
+// are not, and closes it. Models are checked also when the query filters them,
+// as the queries of FindCustom may not.
+func (r *ReadRepository) decodeAll(ctx context.Context, cursor *mongo.Cursor, deleted bool) ([]interface{}, error) {
+	defer cursor.Close(ctx)
+
 	result := []interface{}{}
-	model := r.factory()
-	for iter.Next(model) {
+	for cursor.Next(ctx) {
+		if _, err := cursor.Current.LookupErr(DeletedField); (err == nil) != deleted {
+			continue
+		}
+		model := r.factory()
+		if err := cursor.Decode(model); err != nil {
+			return nil, err
+		}
 		result = append(result, model)
-		model = r.factory()
 	}
-	if err := iter.Close(); err != nil {
+	if err := cursor.Err(); err != nil {
 		return nil, err
 	}
 
 	return result, nil
 }
 
-// Remove removes a read model with id from the repository. Returns
-// ErrModelNotFound if no model could be found.
+// Remove removes a read model with id from the repository, also if it is soft
+// deleted. Returns ErrModelNotFound if no model could be found.
 func (r *ReadRepository) Remove(id eventhorizon.UUID) error {
-	sess := r.session.Copy()
-	defer sess.Close()
+	result, err := r.c().DeleteOne(context.Background(), bson.M{"_id": id})
+	if err != nil || result.DeletedCount == 0 {
+		return eventhorizon.ErrModelNotFound
+	}
+
+	return nil
+}
 
-	err := sess.DB(r.db).C(r.collection).RemoveId(id)
+// SoftDelete implements the SoftDelete method of the
+// eventhorizon.SoftDeleteReadRepository interface.
+func (r *ReadRepository) SoftDelete(ctx context.Context, id eventhorizon.UUID) error {
+	result, err := r.c().UpdateOne(ctx, bson.D{{Key: "_id", Value: id}, notDeleted},
+		bson.M{"$set": bson.M{DeletedField: true}})
 	if err != nil {
+		return eventhorizon.ErrCouldNotSaveModel
+	} else if result.MatchedCount == 0 {
 		return eventhorizon.ErrModelNotFound
 	}
+	return nil
+}
 
+// Restore implements the Restore method of the
+// eventhorizon.SoftDeleteReadRepository interface.
+func (r *ReadRepository) Restore(ctx context.Context, id eventhorizon.UUID) error {
+	result, err := r.c().UpdateOne(ctx, bson.M{"_id": id, DeletedField: true},
+		bson.M{"$unset": bson.M{DeletedField: ""}})
+	if err != nil {
+		return eventhorizon.ErrCouldNotSaveModel
+	} else if result.MatchedCount == 0 {
+		return eventhorizon.ErrModelNotFound
+	}
 	return nil
 }
 
+// FindDeleted implements the FindDeleted method of the
+// eventhorizon.SoftDeleteReadRepository interface.
+func (r *ReadRepository) FindDeleted(ctx context.Context) ([]interface{}, error) {
+	if r.factory == nil {
+		return nil, ErrModelNotSet
+	}
+
+	cursor, err := r.c().Find(ctx, bson.M{DeletedField: true})
+	if err != nil {
+		return nil, err
+	}
+	return r.decodeAll(ctx, cursor, true)
+}
+
 // SetModel sets a factory function that creates concrete model types.
 func (r *ReadRepository) SetModel(factory func() interface{}) {
 	r.factory = factory
 }
 
-// SetDB sets the database session and database.
+// SetDB sets the database.
 func (r *ReadRepository) SetDB(db string) {
 	r.db = db
 }
 
 // Clear clears the read model database.
 func (r *ReadRepository) Clear() error {
-	if err := r.session.DB(r.db).C(r.collection).DropCollection(); err != nil {
+	if err := r.c().Drop(context.Background()); err != nil {
 		return ErrCouldNotClearDB
 	}
 	return nil
 }
 
-// Close closes a database session.
+// Close disconnects the database client.
 func (r *ReadRepository) Close() {
-	r.session.Close()
+	r.client.Disconnect(context.Background())
 }
@@ -15,13 +15,14 @@
 package mongodb
 
 import (
+	"context"
 	"os"
 	"reflect"
 	"testing"
 	"time"
 
-	"gopkg.in/mgo.v2"
-	"gopkg.in/mgo.v2/bson"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 
 	"github.com/looplab/eventhorizon"
 	"github.com/looplab/eventhorizon/testutil"
@@ -133,8 +134,8 @@ func TestReadRepository(t *testing.T) {
 	}
 
 	t.Log("FindCustom by content")
-	result, err = repo.FindCustom(func(c *mgo.Collection) *mgo.Query {
-		return c.Find(bson.M{"content": "model1Alt"})
+	result, err = repo.FindCustom(context.Background(), func(ctx context.Context, c *mongo.Collection) (*mongo.Cursor, error) {
+		return c.Find(ctx, bson.M{"content": "model1Alt"})
 	})
 	if len(result) != 1 {
 		t.Error("there should be one item:", len(result))
@@ -143,6 +144,100 @@ func TestReadRepository(t *testing.T) {
 		t.Error("the item should be correct:", model)
 	}
 
+	t.Log("FindQuery by content")
+	result, err = repo.FindQuery(context.Background(),
+		eventhorizon.Where("content", eventhorizon.In, []string{"model1Alt", "model2"}).OrderByDesc("content").Limit(1))
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(result) != 1 {
+		t.Error("there should be one item:", len(result))
+	}
+	if !reflect.DeepEqual(result[0], model2) {
+		t.Error("the item should be correct:", result[0])
+	}
+
+	t.Log("FindByField")
+	result, err = repo.FindByField(context.Background(), "content", "model2")
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(result) != 1 || !reflect.DeepEqual(result[0], model2) {
+		t.Error("the items should be correct:", result)
+	}
+
+	t.Log("UpdateFields")
+	if err := repo.UpdateFields(context.Background(), model2.ID, map[string]interface{}{
+		"content": "model2Alt",
+	}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	model, err = repo.Find(model2.ID)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if model.(*testutil.TestModel).Content != "model2Alt" {
+		t.Error("the item should be updated:", model)
+	}
+	if err := repo.UpdateFields(context.Background(), model2.ID, map[string]interface{}{
+		"$set": bson.M{"content": "model2"},
+	}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	model, err = repo.Find(model2.ID)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(model, model2) {
+		t.Error("the item should be updated:", model)
+	}
+	if err := repo.UpdateFields(context.Background(), eventhorizon.NewUUID(), map[string]interface{}{
+		"content": "missing",
+	}); err != eventhorizon.ErrModelNotFound {
+		t.Error("there should be a ErrModelNotFound error:", err)
+	}
+
+	t.Log("Soft delete and restore one item")
+	ctx := context.Background()
+	if err := repo.SoftDelete(ctx, model2.ID); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, err := repo.Find(model2.ID); err != eventhorizon.ErrModelNotFound {
+		t.Error("there should be a ErrModelNotFound error:", err)
+	}
+	result, err = repo.FindCustom(ctx, func(ctx context.Context, c *mongo.Collection) (*mongo.Cursor, error) {
+		return c.Find(ctx, bson.M{"_id": model2.ID})
+	})
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(result) != 0 {
+		t.Error("FindCustom should skip the deleted item:", result)
+	}
+	if err := repo.Save(model2.ID, model2); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	result, err = repo.FindDeleted(ctx)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(result, []interface{}{model2}) {
+		t.Error("the deleted item should be kept deleted:", result)
+	}
+	if err := repo.Restore(ctx, model2.ID); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := repo.Restore(ctx, model2.ID); err != eventhorizon.ErrModelNotFound {
+		t.Error("there should be a ErrModelNotFound error:", err)
+	}
+	model, err = repo.Find(model2.ID)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(model, model2) {
+		t.Error("the item should be restored:", model)
+	}
+
 	t.Log("Remove one item")
 	err = repo.Remove(model1Alt.ID)
 	if err != nil {
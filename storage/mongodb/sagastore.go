@@ -0,0 +1,167 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodb
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/looplab/eventhorizon"
+)
+
+// ErrCouldNotSaveSagaState is when a saga state could not be saved.
+var ErrCouldNotSaveSagaState = errors.New("could not save saga state")
+
+// ErrCouldNotLoadSagaState is when a saga state could not be loaded.
+var ErrCouldNotLoadSagaState = errors.New("could not load saga state")
+
+// SagaStateStore implements a SagaStateStore for MongoDB.
+type SagaStateStore struct {
+	client  *mongo.Client
+	db      string
+	factory func() interface{}
+}
+
+// NewSagaStateStore creates a new SagaStateStore. Client options, such as the
+// size of the connection pool, can be passed to override the ones of the URL.
+func NewSagaStateStore(url, database string, opts ...*options.ClientOptions) (*SagaStateStore, error) {
+	client, err := connect(url, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewSagaStateStoreWithClient(client, database)
+}
+
+// NewSagaStateStoreWithClient creates a new SagaStateStore with a client.
+func NewSagaStateStoreWithClient(client *mongo.Client, database string) (*SagaStateStore, error) {
+	if client == nil {
+		return nil, ErrNoDBClient
+	}
+
+	s := &SagaStateStore{
+		client: client,
+		db:     database,
+	}
+
+	return s, nil
+}
+
+type mongoSagaState struct {
+	CorrelationID string   `bson:"_id"`
+	Version       int      `bson:"version"`
+	State         bson.Raw `bson:"state"`
+}
+
+// c returns the collection of the saga states.
+func (s *SagaStateStore) c() *mongo.Collection {
+	return s.client.Database(s.db).Collection("sagas")
+}
+
+// LoadSagaState loads the state of a saga. Returns ErrSagaStateNotFound if
+// there is none. The state is decoded with the factory set by SetStateFactory,
+// or as a bson.M.
+func (s *SagaStateStore) LoadSagaState(correlationID string) (*eventhorizon.SagaState, error) {
+	var stored mongoSagaState
+	err := s.c().FindOne(context.Background(), bson.M{"_id": correlationID}).Decode(&stored)
+	if err == mongo.ErrNoDocuments {
+		return nil, eventhorizon.ErrSagaStateNotFound
+	} else if err != nil {
+		return nil, ErrCouldNotLoadSagaState
+	}
+
+	var state interface{} = &bson.M{}
+	if s.factory != nil {
+		state = s.factory()
+	}
+	if err := bson.Unmarshal(stored.State, state); err != nil {
+		return nil, ErrCouldNotLoadSagaState
+	}
+	if m, ok := state.(*bson.M); ok {
+		state = *m
+	}
+
+	return &eventhorizon.SagaState{
+		CorrelationID: correlationID,
+		Version:       stored.Version,
+		State:         state,
+	}, nil
+}
+
+// SaveSagaState saves the state of a saga if it has not been saved since it
+// was loaded, and increments its version.
+func (s *SagaStateStore) SaveSagaState(state *eventhorizon.SagaState) error {
+	ctx := context.Background()
+	if state.Version == 0 {
+		_, err := s.c().InsertOne(ctx, bson.M{
+			"_id":     state.CorrelationID,
+			"version": 1,
+			"state":   state.State,
+		})
+		if mongo.IsDuplicateKeyError(err) {
+			return eventhorizon.ErrSagaVersionConflict
+		} else if err != nil {
+			return ErrCouldNotSaveSagaState
+		}
+	} else {
+		result, err := s.c().UpdateOne(ctx,
+			bson.M{"_id": state.CorrelationID, "version": state.Version},
+			bson.M{"$set": bson.M{"state": state.State}, "$inc": bson.M{"version": 1}},
+		)
+		if err != nil {
+			return ErrCouldNotSaveSagaState
+		} else if result.MatchedCount == 0 {
+			return eventhorizon.ErrSagaVersionConflict
+		}
+	}
+
+	state.Version++
+	return nil
+}
+
+// RemoveSagaState removes the state of a saga. Returns ErrSagaStateNotFound if
+// there is none.
+func (s *SagaStateStore) RemoveSagaState(correlationID string) error {
+	result, err := s.c().DeleteOne(context.Background(), bson.M{"_id": correlationID})
+	if err != nil {
+		return ErrCouldNotSaveSagaState
+	} else if result.DeletedCount == 0 {
+		return eventhorizon.ErrSagaStateNotFound
+	}
+	return nil
+}
+
+// SetStateFactory sets a factory function that creates concrete saga state
+// types when loading.
+func (s *SagaStateStore) SetStateFactory(factory func() interface{}) {
+	s.factory = factory
+}
+
+// Clear clears the saga state storage.
+func (s *SagaStateStore) Clear() error {
+	if err := s.c().Drop(context.Background()); err != nil {
+		return ErrCouldNotClearDB
+	}
+	return nil
+}
+
+// Close disconnects the database client.
+func (s *SagaStateStore) Close() {
+	s.client.Disconnect(context.Background())
+}
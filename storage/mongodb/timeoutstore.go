@@ -0,0 +1,125 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/looplab/eventhorizon"
+)
+
+// ErrCouldNotSaveTimeout is when a timeout could not be saved.
+var ErrCouldNotSaveTimeout = errors.New("could not save timeout")
+
+// ErrCouldNotLoadTimeouts is when timeouts could not be loaded.
+var ErrCouldNotLoadTimeouts = errors.New("could not load timeouts")
+
+// TimeoutStore implements a TimeoutStore for MongoDB.
+type TimeoutStore struct {
+	client *mongo.Client
+	db     string
+}
+
+// NewTimeoutStore creates a new TimeoutStore. Client options, such as the size
+// of the connection pool, can be passed to override the ones of the URL.
+func NewTimeoutStore(url, database string, opts ...*options.ClientOptions) (*TimeoutStore, error) {
+	client, err := connect(url, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewTimeoutStoreWithClient(client, database)
+}
+
+// NewTimeoutStoreWithClient creates a new TimeoutStore with a client.
+func NewTimeoutStoreWithClient(client *mongo.Client, database string) (*TimeoutStore, error) {
+	if client == nil {
+		return nil, ErrNoDBClient
+	}
+
+	s := &TimeoutStore{
+		client: client,
+		db:     database,
+	}
+
+	if _, err := s.c().Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys: bson.D{{Key: "deadline", Value: 1}},
+	}); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// c returns the collection of the timeouts.
+func (s *TimeoutStore) c() *mongo.Collection {
+	return s.client.Database(s.db).Collection("timeouts")
+}
+
+// SaveTimeout saves a timeout.
+func (s *TimeoutStore) SaveTimeout(timeout *eventhorizon.Timeout) error {
+	if _, err := s.c().ReplaceOne(context.Background(), bson.M{"_id": timeout.ID}, timeout,
+		options.Replace().SetUpsert(true)); err != nil {
+		return ErrCouldNotSaveTimeout
+	}
+	return nil
+}
+
+// RemoveTimeout removes a timeout. Returns ErrTimeoutNotFound if there is none.
+func (s *TimeoutStore) RemoveTimeout(id eventhorizon.UUID) error {
+	result, err := s.c().DeleteOne(context.Background(), bson.M{"_id": id})
+	if err != nil {
+		return ErrCouldNotSaveTimeout
+	} else if result.DeletedCount == 0 {
+		return eventhorizon.ErrTimeoutNotFound
+	}
+	return nil
+}
+
+// DueTimeouts returns the timeouts with deadlines at or before a time, in the
+// order of their deadlines.
+func (s *TimeoutStore) DueTimeouts(now time.Time) ([]*eventhorizon.Timeout, error) {
+	ctx := context.Background()
+	cursor, err := s.c().Find(ctx, bson.M{"deadline": bson.M{"$lte": now}},
+		options.Find().SetSort(bson.M{"deadline": 1}))
+	if err != nil {
+		return nil, ErrCouldNotLoadTimeouts
+	}
+
+	timeouts := []*eventhorizon.Timeout{}
+	if err := cursor.All(ctx, &timeouts); err != nil {
+		return nil, ErrCouldNotLoadTimeouts
+	}
+	return timeouts, nil
+}
+
+// Clear clears the timeout storage.
+func (s *TimeoutStore) Clear() error {
+	if err := s.c().Drop(context.Background()); err != nil {
+		return ErrCouldNotClearDB
+	}
+	return nil
+}
+
+// Close disconnects the database client.
+func (s *TimeoutStore) Close() {
+	s.client.Disconnect(context.Background())
+}
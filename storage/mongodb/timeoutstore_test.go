@@ -0,0 +1,57 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/looplab/eventhorizon"
+)
+
+func TestTimeoutStore(t *testing.T) {
+	store, err := NewTimeoutStore(mongoURL(), "test")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer store.Close()
+	defer store.Clear()
+
+	now := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	timeout1 := &eventhorizon.Timeout{ID: eventhorizon.NewUUID(), Name: "1", Deadline: now.Add(time.Hour)}
+	timeout2 := &eventhorizon.Timeout{ID: eventhorizon.NewUUID(), Name: "2", Deadline: now}
+	for _, timeout := range []*eventhorizon.Timeout{timeout1, timeout2} {
+		if err := store.SaveTimeout(timeout); err != nil {
+			t.Error("there should be no error:", err)
+		}
+	}
+
+	t.Log("due timeouts in order")
+	timeouts, err := store.DueTimeouts(now.Add(time.Hour))
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(timeouts) != 2 || timeouts[0].Name != "2" || timeouts[1].Name != "1" {
+		t.Error("the timeouts should be correct:", timeouts)
+	}
+
+	t.Log("remove timeout")
+	if err := store.RemoveTimeout(timeout2.ID); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := store.RemoveTimeout(timeout2.ID); err != eventhorizon.ErrTimeoutNotFound {
+		t.Error("there should be a ErrTimeoutNotFound error:", err)
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/looplab/eventhorizon"
+)
+
+// DedupStore implements a DedupStore for PostgreSQL. Expired IDs are
+// overwritten when remembered again.
+type DedupStore struct {
+	db    *sql.DB
+	table string
+	clock eventhorizon.Clock
+}
+
+// NewDedupStore creates a new DedupStore with a database opened with a
+// PostgreSQL driver. The clock is used for expiring the IDs.
+func NewDedupStore(db *sql.DB, clock eventhorizon.Clock) (*DedupStore, error) {
+	if db == nil {
+		return nil, ErrNoDB
+	}
+
+	s := &DedupStore{
+		db:    db,
+		table: "dedup",
+		clock: clock,
+	}
+
+	return s, nil
+}
+
+// CreateTables creates the table of the IDs if it does not exist.
+func (s *DedupStore) CreateTables(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+s.table+` (
+		id      TEXT PRIMARY KEY,
+		expires TIMESTAMPTZ NOT NULL
+	)`)
+	return err
+}
+
+// Remember implements the Remember method of the DedupStore interface.
+func (s *DedupStore) Remember(ctx context.Context, id string, ttl time.Duration) (bool, error) {
+	now := s.clock.Now()
+	result, err := s.db.ExecContext(ctx, `INSERT INTO `+s.table+` (id, expires) VALUES ($1, $2)
+		ON CONFLICT (id) DO UPDATE SET expires = EXCLUDED.expires
+		WHERE `+s.table+`.expires <= $3`,
+		id, now.Add(ttl), now)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// Forget implements the Forget method of the DedupStore interface.
+func (s *DedupStore) Forget(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM `+s.table+` WHERE id = $1`, id)
+	return err
+}
+
+// RemoveExpired removes the expired IDs, for running periodically.
+func (s *DedupStore) RemoveExpired(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM `+s.table+` WHERE expires <= $1`, s.clock.Now())
+	return err
+}
+
+// SetTable sets the table of the IDs, the default is "dedup".
+func (s *DedupStore) SetTable(table string) {
+	s.table = table
+}
@@ -0,0 +1,478 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package postgres contains event, dedup and position stores and a read
+// repository for PostgreSQL. It uses database/sql, so any PostgreSQL driver
+// can be used.
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/looplab/eventhorizon"
+	jsoncodec "github.com/looplab/eventhorizon/codec/json"
+)
+
+// ErrNoDB is when no database is used.
+var ErrNoDB = errors.New("no database")
+
+// ErrEventNotRegistered is when an event is not registered.
+var ErrEventNotRegistered = errors.New("event not registered")
+
+// ErrCouldNotMarshalEvent is when an event could not be marshaled into JSON.
+var ErrCouldNotMarshalEvent = errors.New("could not marshal event")
+
+// ErrCouldNotUnmarshalEvent is when an event could not be unmarshaled into a concrete type.
+var ErrCouldNotUnmarshalEvent = errors.New("could not unmarshal event")
+
+// ErrCouldNotLoadAggregate is when an aggregate could not be loaded.
+var ErrCouldNotLoadAggregate = errors.New("could not load aggregate")
+
+// ErrCouldNotSaveAggregate is when an aggregate could not be saved.
+var ErrCouldNotSaveAggregate = errors.New("could not save aggregate")
+
+// DefaultChannel is the channel notified of appended events.
+const DefaultChannel = "eventhorizon_events"
+
+// EventStore implements an EventStore for PostgreSQL. Events are stored as
+// JSON in one table, with a global position for LoadAll.
+//
+// Appending events notifies the channel of the store, with the position of the
+// last event as payload, so that a Listener can wake up without polling the
+// table. The notification is sent in the transaction of the append and is only
+// delivered if it commits.
+type EventStore struct {
+	eventBus  eventhorizon.EventBus
+	db        *sql.DB
+	table     string
+	channel   string
+	factories map[string]func() eventhorizon.Event
+	clock     eventhorizon.Clock
+	stats     *eventhorizon.StatsCounter
+}
+
+// NewEventStore creates a new EventStore with a database opened with a
+// PostgreSQL driver. The clock is used for the timestamps of the events.
+func NewEventStore(eventBus eventhorizon.EventBus, db *sql.DB, clock eventhorizon.Clock) (*EventStore, error) {
+	if db == nil {
+		return nil, ErrNoDB
+	}
+
+	s := &EventStore{
+		eventBus:  eventBus,
+		db:        db,
+		table:     "events",
+		channel:   DefaultChannel,
+		factories: make(map[string]func() eventhorizon.Event),
+		clock:     clock,
+		stats:     eventhorizon.NewStatsCounter(clock),
+	}
+
+	return s, nil
+}
+
+// CreateTables creates the event table if it does not exist.
+func (s *EventStore) CreateTables(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+s.table+` (
+		position       BIGSERIAL PRIMARY KEY,
+		aggregate_id   UUID NOT NULL,
+		aggregate_type TEXT NOT NULL,
+		version        INT NOT NULL,
+		event_type     TEXT NOT NULL,
+		data           JSONB NOT NULL,
+		headers        JSONB,
+		timestamp      TIMESTAMPTZ NOT NULL,
+		UNIQUE (aggregate_id, version)
+	)`)
+	return err
+}
+
+// Save appends all events in the event stream to the database.
+func (s *EventStore) Save(events []eventhorizon.Event) error {
+	return s.SaveWithContext(context.Background(), events)
+}
+
+// SaveWithContext appends all events as Save, with the headers of the context
+// stored with the events. All events are appended in one transaction.
+func (s *EventStore) SaveWithContext(ctx context.Context, events []eventhorizon.Event) error {
+	if len(events) == 0 {
+		return eventhorizon.ErrNoEventsToAppend
+	}
+	if err := s.save(ctx, events); err != nil {
+		s.stats.AddError()
+		return err
+	}
+	s.stats.AddEvents(len(events))
+
+	// Publish events on the bus.
+	if s.eventBus != nil {
+		eventhorizon.PublishEvents(s.eventBus, events)
+	}
+
+	return nil
+}
+
+// save appends the events in a transaction and notifies the channel.
+func (s *EventStore) save(ctx context.Context, events []eventhorizon.Event) error {
+	var headers []byte
+	if h := eventhorizon.HeadersFromContext(ctx); h != nil {
+		var err error
+		if headers, err = json.Marshal(h); err != nil {
+			return err
+		}
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return &eventhorizon.EventError{Err: ErrCouldNotSaveAggregate, Cause: err}
+	}
+	defer tx.Rollback()
+	if err := s.lockAppends(ctx, tx); err != nil {
+		return err
+	}
+
+	// The next version of each aggregate, counted from the stored version.
+	versions := make(map[eventhorizon.UUID]int)
+	var position int64
+	for _, event := range events {
+		id := event.AggregateID()
+		version, ok := versions[id]
+		if !ok {
+			if version, err = s.version(ctx, tx, id); err != nil {
+				return err
+			}
+		}
+		versions[id] = version + 1
+
+		data, err := jsoncodec.EventCodec{}.MarshalEvent(event)
+		if err != nil {
+			return &eventhorizon.EventError{Err: ErrCouldNotMarshalEvent, Cause: err,
+				EventType: event.EventType(), AggregateID: id}
+		}
+
+		err = tx.QueryRowContext(ctx, `INSERT INTO `+s.table+`
+			(aggregate_id, aggregate_type, version, event_type, data, headers, timestamp)
+			VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING position`,
+			id.String(), event.AggregateType(), version+1, event.EventType(),
+			data, headers, s.clock.Now(),
+		).Scan(&position)
+		if err != nil {
+			// Events appended concurrently take the versions.
+			tx.Rollback()
+			return s.versionConflict(ctx, id, version, err)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_notify($1, $2)`,
+		s.channel, strconv.FormatInt(position, 10)); err != nil {
+		return &eventhorizon.EventError{Err: ErrCouldNotSaveAggregate, Cause: err}
+	}
+	if err := tx.Commit(); err != nil {
+		return &eventhorizon.EventError{Err: ErrCouldNotSaveAggregate, Cause: err}
+	}
+	return nil
+}
+
+// Import appends events with the versions, timestamps and headers of their
+// envelopes in one transaction, without publishing them on the bus.
+func (s *EventStore) Import(ctx context.Context, envelopes []eventhorizon.EventEnvelope) error {
+	if len(envelopes) == 0 {
+		return eventhorizon.ErrNoEventsToAppend
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return &eventhorizon.EventError{Err: ErrCouldNotSaveAggregate, Cause: err}
+	}
+	defer tx.Rollback()
+	if err := s.lockAppends(ctx, tx); err != nil {
+		return err
+	}
+
+	// Check that the first event of each aggregate follows the stored ones.
+	checked := make(map[eventhorizon.UUID]bool)
+	var position int64
+	for _, envelope := range envelopes {
+		event := envelope.Event
+		id := event.AggregateID()
+		if !checked[id] {
+			version, err := s.version(ctx, tx, id)
+			if err != nil {
+				return err
+			}
+			if envelope.Version != version+1 {
+				return eventhorizon.ErrVersionConflict{
+					AggregateID:     id,
+					ExpectedVersion: envelope.Version,
+					ActualVersion:   version,
+				}
+			}
+			checked[id] = true
+		}
+
+		data, err := jsoncodec.EventCodec{}.MarshalEvent(event)
+		if err != nil {
+			return &eventhorizon.EventError{Err: ErrCouldNotMarshalEvent, Cause: err,
+				EventType: event.EventType(), AggregateID: id}
+		}
+		var headers []byte
+		if envelope.Headers != nil {
+			if headers, err = json.Marshal(envelope.Headers); err != nil {
+				return err
+			}
+		}
+
+		err = tx.QueryRowContext(ctx, `INSERT INTO `+s.table+`
+			(aggregate_id, aggregate_type, version, event_type, data, headers, timestamp)
+			VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING position`,
+			id.String(), event.AggregateType(), envelope.Version, event.EventType(),
+			data, headers, envelope.Timestamp,
+		).Scan(&position)
+		if err != nil {
+			tx.Rollback()
+			return s.versionConflict(ctx, id, envelope.Version-1, err)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_notify($1, $2)`,
+		s.channel, strconv.FormatInt(position, 10)); err != nil {
+		return &eventhorizon.EventError{Err: ErrCouldNotSaveAggregate, Cause: err}
+	}
+	if err := tx.Commit(); err != nil {
+		return &eventhorizon.EventError{Err: ErrCouldNotSaveAggregate, Cause: err}
+	}
+	return nil
+}
+
+// lockAppends takes the append lock of the table for the rest of a
+// transaction. Sequence values are taken when inserting, not when committing,
+// so without the lock a transaction could commit events with lower positions
+// than ones already read by LoadAll. With it, appends commit one at a time in
+// the order of their positions.
+func (s *EventStore) lockAppends(ctx context.Context, tx *sql.Tx) error {
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, s.table); err != nil {
+		return &eventhorizon.EventError{Err: ErrCouldNotSaveAggregate, Cause: err}
+	}
+	return nil
+}
+
+func (s *EventStore) version(ctx context.Context, tx *sql.Tx, id eventhorizon.UUID) (int, error) {
+	var version int
+	err := tx.QueryRowContext(ctx,
+		`SELECT COALESCE(MAX(version), 0) FROM `+s.table+` WHERE aggregate_id = $1`,
+		id.String(),
+	).Scan(&version)
+	if err != nil {
+		return 0, &eventhorizon.EventError{Err: ErrCouldNotLoadAggregate, Cause: err, AggregateID: id}
+	}
+	return version, nil
+}
+
+// versionConflict creates an ErrVersionConflict with the events saved after
+// the expected version, or wraps the insert error if there are none.
+func (s *EventStore) versionConflict(ctx context.Context, id eventhorizon.UUID, version int, cause error) error {
+	envelopes, err := s.query(ctx, `WHERE aggregate_id = $1 AND version > $2 ORDER BY version`,
+		id.String(), version)
+	if err != nil {
+		return err
+	}
+	if len(envelopes) == 0 {
+		return &eventhorizon.EventError{Err: ErrCouldNotSaveAggregate, Cause: cause, AggregateID: id}
+	}
+
+	conflict := eventhorizon.ErrVersionConflict{
+		AggregateID:     id,
+		ExpectedVersion: version,
+		ActualVersion:   envelopes[len(envelopes)-1].Version,
+	}
+	for _, envelope := range envelopes {
+		conflict.ConflictingEvents = append(conflict.ConflictingEvents, envelope.Event)
+	}
+	return conflict
+}
+
+// Load loads all events for the aggregate id from the database.
+// Returns ErrNoEventsFound if no events can be found.
+func (s *EventStore) Load(id eventhorizon.UUID) ([]eventhorizon.Event, error) {
+	return s.LoadWithContext(context.Background(), id)
+}
+
+// LoadWithContext loads all events for the aggregate id as Load, with a
+// context for the database calls.
+func (s *EventStore) LoadWithContext(ctx context.Context, id eventhorizon.UUID) ([]eventhorizon.Event, error) {
+	envelopes, err := s.query(ctx, `WHERE aggregate_id = $1 ORDER BY version`, id.String())
+	if err != nil {
+		return nil, err
+	}
+	if len(envelopes) == 0 {
+		return nil, eventhorizon.ErrNoEventsFound
+	}
+
+	events := make([]eventhorizon.Event, len(envelopes))
+	for i, envelope := range envelopes {
+		events[i] = envelope.Event
+	}
+	return events, nil
+}
+
+// LoadAll loads up to limit events of all aggregates after a position, in the
+// order of their positions. Appends are serialized by a lock, so events become
+// visible in the order of their positions and a position can be used to
+// resume.
+func (s *EventStore) LoadAll(ctx context.Context, from eventhorizon.Position, limit int) ([]eventhorizon.EventEnvelope, eventhorizon.Position, error) {
+	var start int64
+	if from != "" {
+		var err error
+		if start, err = strconv.ParseInt(string(from), 10, 64); err != nil || start < 0 {
+			return nil, from, eventhorizon.ErrInvalidPosition
+		}
+	}
+
+	where := `WHERE position > $1 ORDER BY position`
+	args := []interface{}{start}
+	if limit > 0 {
+		where += ` LIMIT $2`
+		args = append(args, limit)
+	}
+	envelopes, err := s.query(ctx, where, args...)
+	if err != nil {
+		return nil, from, err
+	}
+	if len(envelopes) == 0 {
+		return envelopes, from, nil
+	}
+	return envelopes, envelopes[len(envelopes)-1].Position, nil
+}
+
+// LastPosition returns the position of the last appended event, or the empty
+// position if there are no events.
+func (s *EventStore) LastPosition(ctx context.Context) (eventhorizon.Position, error) {
+	var position sql.NullInt64
+	if err := s.db.QueryRowContext(ctx,
+		`SELECT MAX(position) FROM `+s.table).Scan(&position); err != nil {
+		return "", err
+	}
+	if !position.Valid {
+		return "", nil
+	}
+	return eventhorizon.Position(strconv.FormatInt(position.Int64, 10)), nil
+}
+
+// query loads the envelopes of the events matching a where clause.
+func (s *EventStore) query(ctx context.Context, where string, args ...interface{}) ([]eventhorizon.EventEnvelope, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT position, aggregate_id, version, event_type,
+		data, headers, timestamp FROM `+s.table+` `+where, args...)
+	if err != nil {
+		return nil, &eventhorizon.EventError{Err: ErrCouldNotLoadAggregate, Cause: err}
+	}
+	defer rows.Close()
+
+	envelopes := []eventhorizon.EventEnvelope{}
+	for rows.Next() {
+		var (
+			position  int64
+			id        string
+			version   int
+			eventType string
+			data      []byte
+			headers   []byte
+			timestamp time.Time
+		)
+		if err := rows.Scan(&position, &id, &version, &eventType,
+			&data, &headers, &timestamp); err != nil {
+			return nil, &eventhorizon.EventError{Err: ErrCouldNotLoadAggregate, Cause: err}
+		}
+
+		event, err := s.decodeEvent(eventType, data, eventhorizon.UUID(id))
+		if err != nil {
+			return nil, err
+		}
+		envelope := eventhorizon.EventEnvelope{
+			Event:     event,
+			Version:   version,
+			Timestamp: timestamp,
+			Position:  eventhorizon.Position(strconv.FormatInt(position, 10)),
+		}
+		if headers != nil {
+			if err := json.Unmarshal(headers, &envelope.Headers); err != nil {
+				return nil, &eventhorizon.EventError{Err: ErrCouldNotUnmarshalEvent, Cause: err,
+					EventType: eventType, AggregateID: event.AggregateID()}
+			}
+		}
+		envelopes = append(envelopes, envelope)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, &eventhorizon.EventError{Err: ErrCouldNotLoadAggregate, Cause: err}
+	}
+	return envelopes, nil
+}
+
+// decodeEvent decodes the JSON data of an event using the registered
+// factories.
+func (s *EventStore) decodeEvent(eventType string, data []byte, id eventhorizon.UUID) (eventhorizon.Event, error) {
+	f, ok := s.factories[eventType]
+	if !ok {
+		return nil, &eventhorizon.EventError{Err: ErrEventNotRegistered,
+			EventType: eventType, AggregateID: id}
+	}
+
+	event := f()
+	if err := (jsoncodec.EventCodec{}).UnmarshalEvent(data, event); err != nil {
+		return nil, &eventhorizon.EventError{Err: ErrCouldNotUnmarshalEvent, Cause: err,
+			EventType: eventType, AggregateID: id}
+	}
+	return event, nil
+}
+
+// RegisterEventType registers an event factory for a event type. The factory is
+// used to create concrete event types when loading from the database.
+//
+// An example would be:
+//     eventStore.RegisterEventType(&MyEvent{}, func() Event { return &MyEvent{} })
+func (s *EventStore) RegisterEventType(event eventhorizon.Event, factory func() eventhorizon.Event) error {
+	if _, ok := s.factories[event.EventType()]; ok {
+		return eventhorizon.ErrHandlerAlreadySet
+	}
+
+	s.factories[event.EventType()] = factory
+
+	return nil
+}
+
+// SetTable sets the table of the events, the default is "events".
+func (s *EventStore) SetTable(table string) {
+	s.table = table
+}
+
+// SetChannel sets the channel notified of appended events, the default is
+// DefaultChannel.
+func (s *EventStore) SetChannel(channel string) {
+	s.channel = channel
+}
+
+// Channel returns the channel notified of appended events.
+func (s *EventStore) Channel() string {
+	return s.channel
+}
+
+// Stats implements the Stats method of the eventhorizon.StatsProvider
+// interface, with the saved events and the saves that failed.
+func (s *EventStore) Stats() eventhorizon.ComponentStats {
+	return s.stats.Stats()
+}
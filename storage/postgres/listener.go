@@ -0,0 +1,233 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgres
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/looplab/eventhorizon"
+)
+
+// NotificationConn is a dedicated database connection that receives the
+// notifications of the channels it listens to. It is implemented by adapting
+// the listener of a PostgreSQL driver, such as pq.Listener or pgx.Conn.
+type NotificationConn interface {
+	// Listen starts listening to a channel, with LISTEN.
+	Listen(ctx context.Context, channel string) error
+
+	// WaitForNotification blocks until a notification is received on a
+	// listened channel or the context is done, returning its payload.
+	WaitForNotification(ctx context.Context) (string, error)
+}
+
+// Listener loads the events appended to an event store when its channel is
+// notified and passes them on to its subscribers, so that projections and
+// relays get low-latency wakeups without polling the events table. The store
+// is also read at an interval, as notifications are lost while the connection
+// is down.
+//
+// Hooks can be added with OnStart and OnStop, which are called when the
+// listener is started and stopped by an eventhorizon.App.
+type Listener struct {
+	eventhorizon.Lifecycle
+
+	store       eventhorizon.GlobalEventStore
+	channel     string
+	conn        NotificationConn
+	interval    time.Duration
+	position    eventhorizon.Position
+	positions   eventhorizon.PositionStore
+	name        string
+	stats       *eventhorizon.StatsCounter
+	subscribers map[*subscription]bool
+	mu          sync.RWMutex
+}
+
+type subscription struct {
+	ctx    context.Context
+	ch     chan eventhorizon.EventEnvelope
+	closed bool
+	mu     sync.Mutex
+}
+
+// NewListener creates a new Listener of the events of a store that are
+// notified on a channel, see EventStore.Channel. The clock is used for the
+// stats.
+func NewListener(store eventhorizon.GlobalEventStore, channel string, conn NotificationConn, clock eventhorizon.Clock) *Listener {
+	return &Listener{
+		store:       store,
+		channel:     channel,
+		conn:        conn,
+		interval:    10 * time.Second,
+		stats:       eventhorizon.NewStatsCounter(clock),
+		subscribers: make(map[*subscription]bool),
+	}
+}
+
+// SetInterval sets the interval of reading the store without notifications,
+// the default is 10 seconds.
+func (l *Listener) SetInterval(interval time.Duration) {
+	l.interval = interval
+}
+
+// SetPosition sets the position to listen from. By default the listener starts
+// from the last position of stores with a LastPosition method, like
+// EventStore, and from the start of other stores.
+func (l *Listener) SetPosition(position eventhorizon.Position) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.position = position
+}
+
+// SetPositionStore sets a store that the position is saved in with a name after
+// passing on events, and loaded from when started, so that a restarted
+// listener resumes where it stopped. A saved position takes precedence over
+// the default, but not over one set with SetPosition.
+func (l *Listener) SetPositionStore(positions eventhorizon.PositionStore, name string) {
+	l.positions = positions
+	l.name = name
+}
+
+// Stats implements the Stats method of the eventhorizon.StatsProvider
+// interface, with the events passed on to the subscribers and the errors that
+// stopped the listener.
+func (l *Listener) Stats() eventhorizon.ComponentStats {
+	return l.stats.Stats()
+}
+
+// Position returns the position of the last event passed on.
+func (l *Listener) Position() eventhorizon.Position {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.position
+}
+
+// Subscribe returns a channel that receives the events loaded by the listener,
+// with their positions. The channel is closed when the context is done. Slow
+// subscribers hold up the listener.
+func (l *Listener) Subscribe(ctx context.Context) <-chan eventhorizon.EventEnvelope {
+	sub := &subscription{
+		ctx: ctx,
+		ch:  make(chan eventhorizon.EventEnvelope, 100),
+	}
+	l.mu.Lock()
+	l.subscribers[sub] = true
+	l.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		l.mu.Lock()
+		delete(l.subscribers, sub)
+		l.mu.Unlock()
+
+		sub.mu.Lock()
+		sub.closed = true
+		close(sub.ch)
+		sub.mu.Unlock()
+	}()
+	return sub.ch
+}
+
+// Run listens to the channel and passes on the appended events until the
+// context is done.
+func (l *Listener) Run(ctx context.Context) error {
+	if err := l.conn.Listen(ctx, l.channel); err != nil {
+		return err
+	}
+
+	// Resume from the saved position if none is set.
+	if l.positions != nil && l.Position() == "" {
+		position, err := l.positions.LoadPosition(ctx, l.name)
+		if err != nil {
+			return err
+		}
+		l.SetPosition(position)
+	}
+
+	// Start from the last position if none is set.
+	if p, ok := l.store.(interface {
+		LastPosition(context.Context) (eventhorizon.Position, error)
+	}); ok && l.Position() == "" {
+		position, err := p.LastPosition(ctx)
+		if err != nil {
+			return err
+		}
+		l.SetPosition(position)
+	}
+
+	for {
+		if err := l.load(ctx); err != nil && ctx.Err() == nil {
+			l.stats.AddError()
+			return err
+		}
+
+		waitCtx, cancel := context.WithTimeout(ctx, l.interval)
+		_, err := l.conn.WaitForNotification(waitCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return nil
+		} else if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+			return err
+		}
+	}
+}
+
+// load passes on the events after the position.
+func (l *Listener) load(ctx context.Context) error {
+	envelopes, position, err := l.store.LoadAll(ctx, l.Position(), 0)
+	if err != nil {
+		return err
+	}
+
+	l.mu.RLock()
+	subscribers := make([]*subscription, 0, len(l.subscribers))
+	for sub := range l.subscribers {
+		subscribers = append(subscribers, sub)
+	}
+	l.mu.RUnlock()
+
+	for _, envelope := range envelopes {
+		for _, sub := range subscribers {
+			sub.send(ctx, envelope)
+		}
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	l.stats.AddEvents(len(envelopes))
+	if l.positions != nil && len(envelopes) > 0 {
+		if err := l.positions.SavePosition(ctx, l.name, position); err != nil {
+			return err
+		}
+	}
+	l.SetPosition(position)
+	return nil
+}
+
+func (s *subscription) send(ctx context.Context, envelope eventhorizon.EventEnvelope) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.ch <- envelope:
+	case <-s.ctx.Done():
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgres
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/storage/memory"
+	"github.com/looplab/eventhorizon/testutil"
+)
+
+func TestListener(t *testing.T) {
+	store := &lockedEventStore{EventStore: memory.NewEventStore(nil)}
+	conn := &fakeNotificationConn{notifications: make(chan string, 10)}
+	listener := NewListener(store, DefaultChannel, conn, eventhorizon.SystemClock{})
+	listener.SetInterval(10 * time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := listener.Subscribe(ctx)
+	done := make(chan error, 1)
+	go func() { done <- listener.Run(ctx) }()
+
+	t.Log("wake up on a notification")
+	event1 := &testutil.TestEvent{TestID: eventhorizon.NewUUID(), Content: "event1"}
+	if err := store.Save([]eventhorizon.Event{event1}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	conn.notifications <- "1"
+	select {
+	case envelope := <-events:
+		if !reflect.DeepEqual(envelope.Event, event1) {
+			t.Error("the event should be correct:", envelope.Event)
+		}
+		if envelope.Position == "" {
+			t.Error("the position should be set")
+		}
+	case <-time.After(time.Second):
+		t.Error("the event should be received")
+	}
+
+	t.Log("read the store without notifications")
+	event2 := &testutil.TestEvent{TestID: eventhorizon.NewUUID(), Content: "event2"}
+	if err := store.Save([]eventhorizon.Event{event2}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	select {
+	case envelope := <-events:
+		if !reflect.DeepEqual(envelope.Event, event2) {
+			t.Error("the event should be correct:", envelope.Event)
+		}
+	case <-time.After(time.Second):
+		t.Error("the event should be received")
+	}
+
+	t.Log("stop when the context is done")
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error("there should be no error:", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("the listener should stop")
+	}
+	if conn.channel != DefaultChannel {
+		t.Error("the channel should be listened to:", conn.channel)
+	}
+	if _, ok := <-events; ok {
+		t.Error("the subscription should be closed")
+	}
+}
+
+func TestListenerPositionStore(t *testing.T) {
+	store := &lockedEventStore{EventStore: memory.NewEventStore(nil)}
+	event1 := &testutil.TestEvent{TestID: eventhorizon.NewUUID(), Content: "event1"}
+	event2 := &testutil.TestEvent{TestID: eventhorizon.NewUUID(), Content: "event2"}
+	if err := store.Save([]eventhorizon.Event{event1, event2}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	_, saved, err := store.LoadAll(context.Background(), "", 1)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	positions := memory.NewPositionStore()
+	positions.SavePosition(context.Background(), "projector", saved)
+
+	conn := &fakeNotificationConn{notifications: make(chan string, 10)}
+	listener := NewListener(store, DefaultChannel, conn, eventhorizon.SystemClock{})
+	listener.SetInterval(10 * time.Millisecond)
+	listener.SetPositionStore(positions, "projector")
+	ctx, cancel := context.WithCancel(context.Background())
+	events := listener.Subscribe(ctx)
+	done := make(chan error, 1)
+	go func() { done <- listener.Run(ctx) }()
+
+	t.Log("resume from the saved position")
+	select {
+	case envelope := <-events:
+		if !reflect.DeepEqual(envelope.Event, event2) {
+			t.Error("the event should be correct:", envelope.Event)
+		}
+	case <-time.After(time.Second):
+		t.Error("the event should be received")
+	}
+	for deadline := time.Now().Add(time.Second); listener.Position() == saved && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	t.Log("save the position")
+	position, _ := positions.LoadPosition(context.Background(), "projector")
+	if position != listener.Position() || position == saved {
+		t.Error("the position should be saved:", position)
+	}
+}
+
+type fakeNotificationConn struct {
+	channel       string
+	notifications chan string
+}
+
+func (c *fakeNotificationConn) Listen(ctx context.Context, channel string) error {
+	c.channel = channel
+	return nil
+}
+
+func (c *fakeNotificationConn) WaitForNotification(ctx context.Context) (string, error) {
+	select {
+	case payload := <-c.notifications:
+		return payload, nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// lockedEventStore is a memory event store that can be saved to while loading.
+type lockedEventStore struct {
+	*memory.EventStore
+	mu sync.Mutex
+}
+
+func (s *lockedEventStore) Save(events []eventhorizon.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.EventStore.Save(events)
+}
+
+func (s *lockedEventStore) LoadAll(ctx context.Context, from eventhorizon.Position, limit int) ([]eventhorizon.EventEnvelope, eventhorizon.Position, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.EventStore.LoadAll(ctx, from, limit)
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/looplab/eventhorizon"
+)
+
+// PositionStore implements a PositionStore for PostgreSQL, with a row per
+// named position.
+type PositionStore struct {
+	db    *sql.DB
+	table string
+}
+
+// NewPositionStore creates a new PositionStore with a database opened with a
+// PostgreSQL driver.
+func NewPositionStore(db *sql.DB) (*PositionStore, error) {
+	if db == nil {
+		return nil, ErrNoDB
+	}
+
+	s := &PositionStore{
+		db:    db,
+		table: "positions",
+	}
+
+	return s, nil
+}
+
+// CreateTables creates the table of the positions if it does not exist.
+func (s *PositionStore) CreateTables(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+s.table+` (
+		name     TEXT PRIMARY KEY,
+		position TEXT NOT NULL
+	)`)
+	return err
+}
+
+// LoadPosition implements the LoadPosition method of the PositionStore
+// interface.
+func (s *PositionStore) LoadPosition(ctx context.Context, name string) (eventhorizon.Position, error) {
+	var position string
+	err := s.db.QueryRowContext(ctx, `SELECT position FROM `+s.table+` WHERE name = $1`,
+		name).Scan(&position)
+	if err == sql.ErrNoRows {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	return eventhorizon.Position(position), nil
+}
+
+// SavePosition implements the SavePosition method of the PositionStore
+// interface.
+func (s *PositionStore) SavePosition(ctx context.Context, name string, position eventhorizon.Position) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO `+s.table+` (name, position) VALUES ($1, $2)
+		ON CONFLICT (name) DO UPDATE SET position = EXCLUDED.position`,
+		name, string(position))
+	return err
+}
+
+// SetTable sets the table of the positions, the default is "positions".
+func (s *PositionStore) SetTable(table string) {
+	s.table = table
+}
@@ -0,0 +1,294 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/looplab/eventhorizon"
+)
+
+// ErrNoRowMapper is when no row mapper is used.
+var ErrNoRowMapper = errors.New("no row mapper")
+
+// ErrInvalidColumnType is when the type of a column contains more than a type
+// and its constraints, such as another statement or a comment.
+var ErrInvalidColumnType = errors.New("invalid column type")
+
+// Column is a column of a read model table, with its SQL type, for example
+// "TEXT NOT NULL". The name is quoted in queries, so it is case sensitive.
+type Column struct {
+	Name string
+	Type string
+}
+
+// RowMapper maps read models to the rows of a table with a column per field,
+// instead of storing them as JSON, so that the table can be queried and joined
+// with SQL.
+type RowMapper interface {
+	// Columns returns the columns of the table, without the id column.
+	Columns() []Column
+
+	// Values returns the values of a model for the columns, in order.
+	Values(model interface{}) ([]interface{}, error)
+
+	// Scan returns a model from a row, using scan to scan the columns, in
+	// order, as with sql.Rows.Scan.
+	Scan(scan func(dest ...interface{}) error) (interface{}, error)
+}
+
+// ReadRepository implements a ReadRepository for PostgreSQL, with a row per
+// read model mapped by a RowMapper and the id of the model as primary key.
+//
+// Materialized views over the table, for example of aggregated data, can be
+// added to be created with the table and refreshed with RefreshViews.
+type ReadRepository struct {
+	db     *sql.DB
+	table  string
+	mapper RowMapper
+	views  []materializedView
+}
+
+// materializedView is a materialized view created with the table.
+type materializedView struct {
+	name  string
+	query string
+}
+
+// NewReadRepository creates a new ReadRepository for a table, with a database
+// opened with a PostgreSQL driver. The table name is quoted in queries, with
+// each part of a name qualified by a schema quoted separately.
+func NewReadRepository(db *sql.DB, table string, mapper RowMapper) (*ReadRepository, error) {
+	if db == nil {
+		return nil, ErrNoDB
+	}
+	if mapper == nil {
+		return nil, ErrNoRowMapper
+	}
+	for _, c := range mapper.Columns() {
+		if strings.Contains(c.Type, ";") || strings.Contains(c.Type, "--") ||
+			strings.Contains(c.Type, "/*") {
+			return nil, ErrInvalidColumnType
+		}
+	}
+
+	r := &ReadRepository{
+		db:     db,
+		table:  quoteQualifiedIdentifier(table),
+		mapper: mapper,
+	}
+
+	return r, nil
+}
+
+// AddMaterializedView adds a materialized view of a query, which is created by
+// CreateTables and refreshed by RefreshViews. The name is quoted as the table
+// name, while the query is used as is.
+func (r *ReadRepository) AddMaterializedView(name, query string) {
+	r.views = append(r.views, materializedView{quoteQualifiedIdentifier(name), query})
+}
+
+// CreateTables creates the table and the materialized views if they don't
+// exist, and migrates an existing table by adding the columns of the mapper
+// that it is missing. Columns that are added to a table with rows must allow
+// NULL or have a default.
+func (r *ReadRepository) CreateTables(ctx context.Context) error {
+	for _, query := range r.schemaQueries() {
+		if _, err := r.db.ExecContext(ctx, query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// schemaQueries returns the queries that create and migrate the table and
+// create the views.
+func (r *ReadRepository) schemaQueries() []string {
+	columns := r.mapper.Columns()
+	definitions := []string{"id UUID PRIMARY KEY"}
+	for _, c := range columns {
+		definitions = append(definitions, quoteIdentifier(c.Name)+" "+c.Type)
+	}
+	queries := []string{`CREATE TABLE IF NOT EXISTS ` + r.table + ` (` +
+		strings.Join(definitions, ", ") + `)`}
+	for _, c := range columns {
+		queries = append(queries, `ALTER TABLE `+r.table+
+			` ADD COLUMN IF NOT EXISTS `+quoteIdentifier(c.Name)+` `+c.Type)
+	}
+	for _, v := range r.views {
+		queries = append(queries, `CREATE MATERIALIZED VIEW IF NOT EXISTS `+
+			v.name+` AS `+v.query)
+	}
+	return queries
+}
+
+// RefreshViews refreshes the materialized views, for example after a batch of
+// events has been projected or after a rebuild.
+func (r *ReadRepository) RefreshViews(ctx context.Context) error {
+	for _, v := range r.views {
+		if _, err := r.db.ExecContext(ctx, `REFRESH MATERIALIZED VIEW `+v.name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Save saves a read model with id to the repository, inserting or updating
+// its row.
+func (r *ReadRepository) Save(id eventhorizon.UUID, model interface{}) error {
+	values, err := r.mapper.Values(model)
+	if err != nil {
+		return eventhorizon.ErrCouldNotSaveModel
+	}
+	args := append([]interface{}{id.String()}, values...)
+	if _, err := r.db.ExecContext(context.Background(), r.upsertQuery(), args...); err != nil {
+		return eventhorizon.ErrCouldNotSaveModel
+	}
+	return nil
+}
+
+// upsertQuery returns the query that inserts a row or updates all its columns
+// if the id exists.
+func (r *ReadRepository) upsertQuery() string {
+	columns := r.mapper.Columns()
+	names := []string{"id"}
+	params := []string{"$1"}
+	updates := []string{}
+	for i, c := range columns {
+		name := quoteIdentifier(c.Name)
+		names = append(names, name)
+		params = append(params, "$"+strconv.Itoa(i+2))
+		updates = append(updates, name+" = EXCLUDED."+name)
+	}
+	query := `INSERT INTO ` + r.table + ` (` + strings.Join(names, ", ") +
+		`) VALUES (` + strings.Join(params, ", ") + `) ON CONFLICT (id) `
+	if len(updates) == 0 {
+		return query + `DO NOTHING`
+	}
+	return query + `DO UPDATE SET ` + strings.Join(updates, ", ")
+}
+
+// selectQuery returns the query that selects the columns of the mapper.
+func (r *ReadRepository) selectQuery() string {
+	columns := r.mapper.Columns()
+	names := make([]string, len(columns))
+	for i, c := range columns {
+		names[i] = quoteIdentifier(c.Name)
+	}
+	return `SELECT ` + strings.Join(names, ", ") + ` FROM ` + r.table
+}
+
+// Find returns one read model with using an id. Returns
+// ErrModelNotFound if no model could be found.
+func (r *ReadRepository) Find(id eventhorizon.UUID) (interface{}, error) {
+	rows, err := r.db.QueryContext(context.Background(),
+		r.selectQuery()+` WHERE id = $1`, id.String())
+	if err != nil {
+		return nil, err
+	}
+	models, err := r.scanAll(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(models) == 0 {
+		return nil, eventhorizon.ErrModelNotFound
+	}
+	return models[0], nil
+}
+
+// FindAll returns all read models in the repository.
+func (r *ReadRepository) FindAll() ([]interface{}, error) {
+	rows, err := r.db.QueryContext(context.Background(), r.selectQuery())
+	if err != nil {
+		return nil, err
+	}
+	return r.scanAll(rows)
+}
+
+// FindWhere returns the read models of the rows matching an SQL condition,
+// with arguments for its parameters.
+//
+// An example would be:
+//     repo.FindWhere(ctx, "name = $1", "Athena")
+func (r *ReadRepository) FindWhere(ctx context.Context, condition string, args ...interface{}) ([]interface{}, error) {
+	rows, err := r.db.QueryContext(ctx, r.selectQuery()+` WHERE `+condition, args...)
+	if err != nil {
+		return nil, err
+	}
+	return r.scanAll(rows)
+}
+
+// scanAll maps the rows to read models and closes them.
+func (r *ReadRepository) scanAll(rows *sql.Rows) ([]interface{}, error) {
+	defer rows.Close()
+
+	models := []interface{}{}
+	for rows.Next() {
+		model, err := r.mapper.Scan(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		models = append(models, model)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return models, nil
+}
+
+// Remove removes a read model with id from the repository. Returns
+// ErrModelNotFound if no model could be found.
+func (r *ReadRepository) Remove(id eventhorizon.UUID) error {
+	result, err := r.db.ExecContext(context.Background(),
+		`DELETE FROM `+r.table+` WHERE id = $1`, id.String())
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return eventhorizon.ErrModelNotFound
+	}
+	return nil
+}
+
+// Clear removes all read models from the repository.
+func (r *ReadRepository) Clear() error {
+	_, err := r.db.ExecContext(context.Background(), `DELETE FROM `+r.table)
+	return err
+}
+
+// quoteIdentifier quotes an identifier, such as a column name, for use in
+// queries, as pq.QuoteIdentifier.
+func quoteIdentifier(name string) string {
+	if i := strings.IndexRune(name, 0); i >= 0 {
+		name = name[:i]
+	}
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+// quoteQualifiedIdentifier quotes each part of a name that may be qualified by
+// a schema, such as "public.guests".
+func quoteQualifiedIdentifier(name string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = quoteIdentifier(part)
+	}
+	return strings.Join(parts, ".")
+}
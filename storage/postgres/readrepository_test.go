@@ -0,0 +1,103 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgres
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+func TestReadRepositoryQueries(t *testing.T) {
+	if _, err := NewReadRepository(&sql.DB{}, "guests", nil); err != ErrNoRowMapper {
+		t.Error("there should be a ErrNoRowMapper error:", err)
+	}
+	repo, err := NewReadRepository(&sql.DB{}, "guests", guestMapper{})
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	repo.AddMaterializedView("guest_counts", "SELECT status, COUNT(*) FROM guests GROUP BY status")
+
+	t.Log("create and migrate the table and views")
+	expected := []string{
+		`CREATE TABLE IF NOT EXISTS "guests" (id UUID PRIMARY KEY, "name" TEXT NOT NULL, "status" TEXT)`,
+		`ALTER TABLE "guests" ADD COLUMN IF NOT EXISTS "name" TEXT NOT NULL`,
+		`ALTER TABLE "guests" ADD COLUMN IF NOT EXISTS "status" TEXT`,
+		`CREATE MATERIALIZED VIEW IF NOT EXISTS "guest_counts" AS SELECT status, COUNT(*) FROM guests GROUP BY status`,
+	}
+	if queries := repo.schemaQueries(); !reflect.DeepEqual(queries, expected) {
+		t.Error("the schema queries should be correct:", queries)
+	}
+
+	t.Log("upsert and select the columns")
+	if query := repo.upsertQuery(); query != `INSERT INTO "guests" (id, "name", "status") VALUES ($1, $2, $3) `+
+		`ON CONFLICT (id) DO UPDATE SET "name" = EXCLUDED."name", "status" = EXCLUDED."status"` {
+		t.Error("the upsert query should be correct:", query)
+	}
+	if query := repo.selectQuery(); query != `SELECT "name", "status" FROM "guests"` {
+		t.Error("the select query should be correct:", query)
+	}
+
+	t.Log("quote identifiers")
+	if name := quoteQualifiedIdentifier(`public.gu"ests`); name != `"public"."gu""ests"` {
+		t.Error("the name should be quoted:", name)
+	}
+}
+
+func TestReadRepositoryInvalidColumnType(t *testing.T) {
+	mapper := columnsMapper{{Name: "name", Type: "TEXT); DROP TABLE guests; --"}}
+	if _, err := NewReadRepository(&sql.DB{}, "guests", mapper); err != ErrInvalidColumnType {
+		t.Error("there should be a ErrInvalidColumnType error:", err)
+	}
+}
+
+type guest struct {
+	Name   string
+	Status sql.NullString
+}
+
+type guestMapper struct{}
+
+func (guestMapper) Columns() []Column {
+	return []Column{{"name", "TEXT NOT NULL"}, {"status", "TEXT"}}
+}
+
+func (guestMapper) Values(model interface{}) ([]interface{}, error) {
+	g := model.(*guest)
+	return []interface{}{g.Name, g.Status}, nil
+}
+
+func (guestMapper) Scan(scan func(dest ...interface{}) error) (interface{}, error) {
+	g := &guest{}
+	if err := scan(&g.Name, &g.Status); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// columnsMapper is a mapper of columns only, for testing the schema.
+type columnsMapper []Column
+
+func (m columnsMapper) Columns() []Column {
+	return m
+}
+
+func (columnsMapper) Values(model interface{}) ([]interface{}, error) {
+	return nil, nil
+}
+
+func (columnsMapper) Scan(scan func(dest ...interface{}) error) (interface{}, error) {
+	return nil, nil
+}
@@ -0,0 +1,48 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// DedupStore is a DedupStore that remembers IDs with SET NX and expires them
+// with the TTL of the keys, shared by the instances using the same server.
+type DedupStore struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewDedupStore creates a DedupStore. The keys of the IDs are prefixed with
+// the prefix.
+func NewDedupStore(prefix string, client redis.UniversalClient) *DedupStore {
+	return &DedupStore{
+		client: client,
+		prefix: prefix,
+	}
+}
+
+// Remember implements the Remember method of the DedupStore interface.
+func (s *DedupStore) Remember(ctx context.Context, id string, ttl time.Duration) (bool, error) {
+	return s.client.SetNX(ctx, s.prefix+id, 1, ttl).Result()
+}
+
+// Forget implements the Forget method of the DedupStore interface.
+func (s *DedupStore) Forget(ctx context.Context, id string) error {
+	return s.client.Del(ctx, s.prefix+id).Err()
+}
@@ -0,0 +1,55 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/looplab/eventhorizon"
+)
+
+func TestDedupStore(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: redisURL()})
+	defer client.Close()
+	store := NewDedupStore("test:dedup:", client)
+	ctx := context.Background()
+	id := eventhorizon.NewUUID().String()
+
+	t.Log("remember an ID once")
+	if ok, err := store.Remember(ctx, id, time.Second); err != nil || !ok {
+		t.Error("the ID should be remembered:", ok, err)
+	}
+	if ok, err := store.Remember(ctx, id, time.Second); err != nil || ok {
+		t.Error("the ID should already be remembered:", ok, err)
+	}
+
+	t.Log("forget an ID")
+	if err := store.Forget(ctx, id); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if ok, _ := store.Remember(ctx, id, 50*time.Millisecond); !ok {
+		t.Error("the forgotten ID should be remembered again")
+	}
+
+	t.Log("expire an ID")
+	time.Sleep(100 * time.Millisecond)
+	if ok, _ := store.Remember(ctx, id, time.Second); !ok {
+		t.Error("the expired ID should be remembered again")
+	}
+}
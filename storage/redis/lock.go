@@ -0,0 +1,112 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package redis contains a distributed lock, a dedup store and a position store
+// using Redis.
+package redis
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/looplab/eventhorizon"
+)
+
+var unlockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+var refreshScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+
+// Lock is a Lock using the Redlock algorithm: a lock is held when it has been
+// set in a majority of independent Redis servers, within its TTL. With one
+// server it is a simple lock with the availability of that server.
+type Lock struct {
+	clients []redis.UniversalClient
+	prefix  string
+	clock   eventhorizon.Clock
+}
+
+// NewLock creates a Lock using one client per Redis server. The keys of the
+// locks are prefixed with the prefix. The clock is used to check that a lock
+// was acquired within its TTL.
+func NewLock(prefix string, clock eventhorizon.Clock, clients ...redis.UniversalClient) *Lock {
+	return &Lock{
+		clients: clients,
+		prefix:  prefix,
+		clock:   clock,
+	}
+}
+
+// TryLock acquires the lock of a key for a TTL if it is free.
+func (l *Lock) TryLock(key string, ttl time.Duration) (string, error) {
+	token := eventhorizon.NewUUID().String()
+	start := l.clock.Now()
+	n := l.each(func(ctx context.Context, client redis.UniversalClient) (bool, error) {
+		return client.SetNX(ctx, l.prefix+key, token, ttl).Result()
+	})
+
+	// Allow for clock drift between the servers.
+	drift := ttl/100 + 2*time.Millisecond
+	if n >= len(l.clients)/2+1 && l.clock.Now().Sub(start) < ttl-drift {
+		return token, nil
+	}
+	l.Unlock(key, token)
+	return "", eventhorizon.ErrLockHeld
+}
+
+// Unlock releases the lock of a key held with a token.
+func (l *Lock) Unlock(key, token string) error {
+	n := l.each(func(ctx context.Context, client redis.UniversalClient) (bool, error) {
+		deleted, err := unlockScript.Run(ctx, client, []string{l.prefix + key}, token).Int()
+		return deleted == 1, err
+	})
+	if n == 0 {
+		return eventhorizon.ErrLockNotHeld
+	}
+	return nil
+}
+
+// Refresh extends the lock of a key held with a token to a new TTL.
+func (l *Lock) Refresh(key, token string, ttl time.Duration) error {
+	n := l.each(func(ctx context.Context, client redis.UniversalClient) (bool, error) {
+		refreshed, err := refreshScript.Run(ctx, client, []string{l.prefix + key}, token, ttl.Milliseconds()).Int()
+		return refreshed == 1, err
+	})
+	if n < len(l.clients)/2+1 {
+		return eventhorizon.ErrLockNotHeld
+	}
+	return nil
+}
+
+// each calls a function with the client of every server, and returns the
+// number of servers where it succeeded. Unavailable servers count as failed.
+func (l *Lock) each(f func(context.Context, redis.UniversalClient) (bool, error)) int {
+	ctx := context.Background()
+	n := 0
+	for _, client := range l.clients {
+		if ok, err := f(ctx, client); ok && err == nil {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/looplab/eventhorizon"
+)
+
+func TestLock(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: redisURL()})
+	defer client.Close()
+	lock := NewLock("test:lock:", eventhorizon.SystemClock{}, client)
+	key := eventhorizon.NewUUID().String()
+
+	t.Log("lock and unlock")
+	token, err := lock.TryLock(key, time.Second)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, err := lock.TryLock(key, time.Second); err != eventhorizon.ErrLockHeld {
+		t.Error("there should be a ErrLockHeld error:", err)
+	}
+	if err := lock.Refresh(key, token, time.Second); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := lock.Unlock(key, "wrong"); err != eventhorizon.ErrLockNotHeld {
+		t.Error("there should be a ErrLockNotHeld error:", err)
+	}
+	if err := lock.Unlock(key, token); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("expire")
+	token, _ = lock.TryLock(key, 50*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	if err := lock.Refresh(key, token, time.Second); err != eventhorizon.ErrLockNotHeld {
+		t.Error("there should be a ErrLockNotHeld error:", err)
+	}
+	if _, err := lock.TryLock(key, time.Second); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("no majority")
+	down := redis.NewClient(&redis.Options{Addr: "localhost:1"})
+	defer down.Close()
+	lock = NewLock("test:lock:", eventhorizon.SystemClock{}, client, down, down)
+	if _, err := lock.TryLock(eventhorizon.NewUUID().String(), time.Second); err != eventhorizon.ErrLockHeld {
+		t.Error("there should be a ErrLockHeld error:", err)
+	}
+}
+
+// redisURL returns the Redis URL, with support for Wercker testing.
+func redisURL() string {
+	host := os.Getenv("REDIS_PORT_6379_TCP_ADDR")
+	port := os.Getenv("REDIS_PORT_6379_TCP_PORT")
+
+	url := ":6379"
+	if host != "" && port != "" {
+		url = host + ":" + port
+	}
+	return url
+}
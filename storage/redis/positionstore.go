@@ -0,0 +1,57 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"context"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/looplab/eventhorizon"
+)
+
+// PositionStore is a PositionStore that keeps the positions in a Redis hash,
+// shared by the instances using the same server.
+type PositionStore struct {
+	client redis.UniversalClient
+	key    string
+}
+
+// NewPositionStore creates a PositionStore that keeps the positions in the
+// hash at a key.
+func NewPositionStore(key string, client redis.UniversalClient) *PositionStore {
+	return &PositionStore{
+		client: client,
+		key:    key,
+	}
+}
+
+// LoadPosition implements the LoadPosition method of the PositionStore
+// interface.
+func (s *PositionStore) LoadPosition(ctx context.Context, name string) (eventhorizon.Position, error) {
+	position, err := s.client.HGet(ctx, s.key, name).Result()
+	if err == redis.Nil {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	return eventhorizon.Position(position), nil
+}
+
+// SavePosition implements the SavePosition method of the PositionStore
+// interface.
+func (s *PositionStore) SavePosition(ctx context.Context, name string, position eventhorizon.Position) error {
+	return s.client.HSet(ctx, s.key, name, string(position)).Err()
+}
@@ -0,0 +1,44 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"context"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/looplab/eventhorizon"
+)
+
+func TestPositionStore(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: redisURL()})
+	defer client.Close()
+	store := NewPositionStore("test:positions:"+eventhorizon.NewUUID().String(), client)
+	ctx := context.Background()
+
+	t.Log("load a position that is not saved")
+	if position, err := store.LoadPosition(ctx, "projector"); err != nil || position != "" {
+		t.Error("the position should be empty:", position, err)
+	}
+
+	t.Log("save and load a position")
+	if err := store.SavePosition(ctx, "projector", "42"); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if position, err := store.LoadPosition(ctx, "projector"); err != nil || position != "42" {
+		t.Error("the position should be loaded:", position, err)
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"sync"
+)
+
+// Subscribe adds a global handler to a bus that delivers the events of type T
+// on the returned channel, with a buffer of a number of events, until the
+// context is done. The channel is then closed.
+//
+// Handling an event blocks the bus while the buffer is full. When the context
+// is done the handler is removed from buses that implement HandlerRemover, on
+// other buses it stays added but ignores events.
+//
+// An example of a background worker:
+//   for event := range eventhorizon.Subscribe[*InviteCreated](ctx, bus, 100) {
+//       ...
+//   }
+func Subscribe[T Event](ctx context.Context, bus EventBus, buffer int) <-chan T {
+	h := &subscriptionHandler[T]{
+		ctx: ctx,
+		ch:  make(chan T, buffer),
+	}
+	bus.AddGlobalHandler(h)
+
+	go func() {
+		<-ctx.Done()
+		h.mu.Lock()
+		h.closed = true
+		close(h.ch)
+		h.mu.Unlock()
+
+		if r, ok := bus.(HandlerRemover); ok {
+			r.RemoveGlobalHandler(h)
+		}
+	}()
+
+	return h.ch
+}
+
+type subscriptionHandler[T Event] struct {
+	ctx    context.Context
+	ch     chan T
+	closed bool
+	mu     sync.Mutex
+}
+
+// HandleEvent implements the HandleEvent method of the EventHandler interface.
+func (h *subscriptionHandler[T]) HandleEvent(event Event) {
+	e, ok := event.(T)
+	if !ok {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return
+	}
+	select {
+	case h.ch <- e:
+	case <-h.ctx.Done():
+	}
+}
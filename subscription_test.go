@@ -0,0 +1,96 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSubscribe(t *testing.T) {
+	bus := &handlerEventBus{}
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := Subscribe[*TestEvent](ctx, bus, 1)
+
+	t.Log("deliver events of the type")
+	id := NewUUID()
+	bus.PublishEvent(&TestEvent{id, "event1"})
+	bus.PublishEvent(&TestEvent2{id, "event2"})
+	select {
+	case event := <-ch:
+		if event.Content != "event1" {
+			t.Error("the event should be correct:", event)
+		}
+	case <-time.After(time.Second):
+		t.Error("there should be an event")
+	}
+
+	t.Log("block while the buffer is full")
+	bus.PublishEvent(&TestEvent{id, "event3"})
+	done := make(chan struct{})
+	go func() {
+		bus.PublishEvent(&TestEvent{id, "event4"})
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Error("the handler should block")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	t.Log("close on cancel")
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("the handler should stop blocking")
+	}
+	for range ch {
+	}
+	bus.PublishEvent(&TestEvent{id, "event5"})
+}
+
+func TestSubscribeRemoveHandler(t *testing.T) {
+	bus := &subscriptionEventBus{removed: make(chan EventHandler, 1)}
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := Subscribe[*TestEvent](ctx, bus, 1)
+
+	t.Log("remove the handler on cancel")
+	cancel()
+	for range ch {
+	}
+	select {
+	case h := <-bus.removed:
+		if h != bus.handlers[0] {
+			t.Error("the subscription handler should be removed:", h)
+		}
+	case <-time.After(time.Second):
+		t.Error("the handler should be removed")
+	}
+}
+
+type subscriptionEventBus struct {
+	handlerEventBus
+	removed chan EventHandler
+}
+
+func (b *subscriptionEventBus) RemoveHandler(handler EventHandler, event Event) {}
+
+func (b *subscriptionEventBus) RemoveLocalHandler(handler EventHandler) {}
+
+func (b *subscriptionEventBus) RemoveGlobalHandler(handler EventHandler) {
+	b.removed <- handler
+}
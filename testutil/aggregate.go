@@ -0,0 +1,131 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutil
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/looplab/eventhorizon"
+)
+
+// AggregateTest is a Given/When/Then helper for testing aggregates.
+//
+// A typical test:
+//   testutil.NewAggregateTest(t, aggregate).
+//       Given(&InviteCreated{id, "Athena", 42}).
+//       When(&AcceptInvite{id}).
+//       Then(&InviteAccepted{id})
+type AggregateTest struct {
+	t         *testing.T
+	aggregate eventhorizon.Aggregate
+	events    []eventhorizon.Event
+	err       error
+	handled   bool
+}
+
+// NewAggregateTest creates a test for an aggregate. The aggregate should be
+// newly created without any applied events.
+func NewAggregateTest(t *testing.T, aggregate eventhorizon.Aggregate) *AggregateTest {
+	return &AggregateTest{
+		t:         t,
+		aggregate: aggregate,
+	}
+}
+
+// Given applies previous events to the aggregate, as when it is loaded by a
+// repository.
+func (a *AggregateTest) Given(events ...eventhorizon.Event) *AggregateTest {
+	for _, event := range events {
+		a.aggregate.ApplyEvent(event)
+		a.aggregate.IncrementVersion()
+	}
+	return a
+}
+
+// When lets the aggregate handle a command and records the resulting events
+// or error.
+func (a *AggregateTest) When(command eventhorizon.Command) *AggregateTest {
+	a.aggregate.ClearUncommittedEvents()
+	a.err = a.aggregate.HandleCommand(command)
+	a.events = a.aggregate.GetUncommittedEvents()
+	a.handled = true
+	return a
+}
+
+// Then checks that the command was handled without error and that exactly the
+// expected events were stored, in order.
+func (a *AggregateTest) Then(expected ...eventhorizon.Event) {
+	a.t.Helper()
+	if !a.handled {
+		a.t.Fatal("there should be a command handled with When")
+	}
+	if a.err != nil {
+		a.t.Error("there should be no error:", a.err)
+		return
+	}
+	if diff := diffEvents(a.events, expected); diff != "" {
+		a.t.Error("the stored events should be correct:\n" + diff)
+	}
+}
+
+// ThenError checks that the command failed with the expected error, compared
+// either by value or by message, or with any error if the expected error is
+// nil. No events should be stored on errors.
+func (a *AggregateTest) ThenError(expected error) {
+	a.t.Helper()
+	if !a.handled {
+		a.t.Fatal("there should be a command handled with When")
+	}
+	if a.err == nil {
+		a.t.Error("there should be an error:", expected)
+		return
+	}
+	if expected != nil && a.err != expected && a.err.Error() != expected.Error() {
+		a.t.Errorf("the error should be correct:\nhave: %v\nwant: %v", a.err, expected)
+	}
+	if len(a.events) != 0 {
+		a.t.Error("there should be no stored events:\n" + diffEvents(a.events, nil))
+	}
+}
+
+// Aggregate returns the aggregate under test, for checking its state.
+func (a *AggregateTest) Aggregate() eventhorizon.Aggregate {
+	return a.aggregate
+}
+
+// diffEvents returns a readable line by line diff of two event lists, or an
+// empty string if they are equal.
+func diffEvents(have, want []eventhorizon.Event) string {
+	if len(have) == len(want) && (len(have) == 0 || reflect.DeepEqual(have, want)) {
+		return ""
+	}
+
+	lines := []string{}
+	for i := 0; i < len(have) || i < len(want); i++ {
+		switch {
+		case i >= len(want):
+			lines = append(lines, fmt.Sprintf("  %d: unexpected %s %+v", i, have[i].EventType(), have[i]))
+		case i >= len(have):
+			lines = append(lines, fmt.Sprintf("  %d: missing %s %+v", i, want[i].EventType(), want[i]))
+		case !reflect.DeepEqual(have[i], want[i]):
+			lines = append(lines, fmt.Sprintf("  %d: have %s %+v", i, have[i].EventType(), have[i]))
+			lines = append(lines, fmt.Sprintf("  %d: want %s %+v", i, want[i].EventType(), want[i]))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutil
+
+import (
+	"sync"
+	"time"
+)
+
+// MockClock is a Clock that only moves when told to, for deterministic tests
+// of time dependent code.
+type MockClock struct {
+	now     time.Time
+	waiters []clockWaiter
+	mu      sync.Mutex
+}
+
+type clockWaiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+// NewMockClock creates a MockClock frozen at a time.
+func NewMockClock(now time.Time) *MockClock {
+	return &MockClock{
+		now: now,
+	}
+}
+
+// Now returns the current time of the clock.
+func (c *MockClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// After returns a channel that receives the time when the clock has been
+// advanced past the duration.
+func (c *MockClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, clockWaiter{c.now.Add(d), ch})
+	return ch
+}
+
+// Advance moves the clock forward and fires any waiters that are due.
+func (c *MockClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.set(c.now.Add(d))
+}
+
+// Set sets the time of the clock and fires any waiters that are due.
+func (c *MockClock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.set(now)
+}
+
+func (c *MockClock) set(now time.Time) {
+	c.now = now
+	waiters := c.waiters[:0]
+	for _, w := range c.waiters {
+		if !w.at.After(now) {
+			w.ch <- now
+			continue
+		}
+		waiters = append(waiters, w)
+	}
+	c.waiters = waiters
+}
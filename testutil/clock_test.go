@@ -0,0 +1,58 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutil
+
+import (
+	"testing"
+	"time"
+
+	"github.com/looplab/eventhorizon"
+)
+
+func TestMockClock(t *testing.T) {
+	start := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	var clock eventhorizon.Clock = NewMockClock(start)
+	mock := clock.(*MockClock)
+
+	if !clock.Now().Equal(start) {
+		t.Error("the time should be frozen:", clock.Now())
+	}
+
+	t.Log("advance before due")
+	ch := clock.After(time.Minute)
+	mock.Advance(30 * time.Second)
+	select {
+	case <-ch:
+		t.Error("the waiter should not fire")
+	default:
+	}
+
+	t.Log("advance past due")
+	mock.Advance(30 * time.Second)
+	select {
+	case now := <-ch:
+		if !now.Equal(start.Add(time.Minute)) {
+			t.Error("the fired time should be correct:", now)
+		}
+	default:
+		t.Error("the waiter should fire")
+	}
+
+	t.Log("set")
+	mock.Set(start)
+	if !clock.Now().Equal(start) {
+		t.Error("the time should be set:", clock.Now())
+	}
+}
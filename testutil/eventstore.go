@@ -0,0 +1,149 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutil
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/looplab/eventhorizon"
+)
+
+// ErrInjectedFault is the default error returned by a FaultEventStore.
+var ErrInjectedFault = errors.New("injected fault")
+
+// FaultEventStore wraps an EventStore and can be programmed to fail or delay
+// calls, for testing retry and conflict handling deterministically.
+//
+// Calls are counted from 1 and separately for Save and Load.
+type FaultEventStore struct {
+	eventStore eventhorizon.EventStore
+
+	saveFaults map[int]error
+	loadFaults map[int]error
+	stale      int
+	latency    time.Duration
+	clock      eventhorizon.Clock
+
+	saves int
+	loads int
+	mu    sync.Mutex
+}
+
+// NewFaultEventStore creates a new FaultEventStore. The clock is used for the
+// latency.
+func NewFaultEventStore(eventStore eventhorizon.EventStore, clock eventhorizon.Clock) *FaultEventStore {
+	s := &FaultEventStore{
+		eventStore: eventStore,
+		saveFaults: make(map[int]error),
+		loadFaults: make(map[int]error),
+		clock:      clock,
+	}
+	return s
+}
+
+// Save saves the events in the base store, unless a fault is set for the call.
+func (s *FaultEventStore) Save(events []eventhorizon.Event) error {
+	s.mu.Lock()
+	s.saves++
+	err := s.saveFaults[s.saves]
+	latency := s.latency
+	s.mu.Unlock()
+
+	if latency > 0 {
+		<-s.clock.After(latency)
+	}
+	if err != nil {
+		return err
+	}
+	return s.eventStore.Save(events)
+}
+
+// Load loads the events from the base store, unless a fault is set for the
+// call. If stale loads are set the newest events are left out of the result.
+func (s *FaultEventStore) Load(id eventhorizon.UUID) ([]eventhorizon.Event, error) {
+	s.mu.Lock()
+	s.loads++
+	err := s.loadFaults[s.loads]
+	stale := s.stale
+	latency := s.latency
+	s.mu.Unlock()
+
+	if latency > 0 {
+		<-s.clock.After(latency)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := s.eventStore.Load(id)
+	if err != nil {
+		return nil, err
+	}
+	if stale > len(events) {
+		stale = len(events)
+	}
+	return events[:len(events)-stale], nil
+}
+
+// FailSaveOn makes the nth call to Save return err, or ErrInjectedFault if
+// err is nil.
+func (s *FaultEventStore) FailSaveOn(n int, err error) {
+	if err == nil {
+		err = ErrInjectedFault
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saveFaults[n] = err
+}
+
+// FailLoadOn makes the nth call to Load return err, or ErrInjectedFault if
+// err is nil.
+func (s *FaultEventStore) FailLoadOn(n int, err error) {
+	if err == nil {
+		err = ErrInjectedFault
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loadFaults[n] = err
+}
+
+// SetStaleLoads makes Load leave out the n newest events, simulating a read
+// from a lagging replica. Use 0 to disable.
+func (s *FaultEventStore) SetStaleLoads(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stale = n
+}
+
+// SetLatency adds a delay to every call.
+func (s *FaultEventStore) SetLatency(latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = latency
+}
+
+// Reset clears all faults and call counts.
+func (s *FaultEventStore) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saveFaults = make(map[int]error)
+	s.loadFaults = make(map[int]error)
+	s.stale = 0
+	s.latency = 0
+	s.saves = 0
+	s.loads = 0
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutil
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/looplab/eventhorizon"
+)
+
+func TestFaultEventStore(t *testing.T) {
+	baseStore := &MockEventStore{}
+	clock := &afterClock{}
+	store := NewFaultEventStore(baseStore, clock)
+	if store == nil {
+		t.Fatal("there should be a store")
+	}
+
+	id := eventhorizon.NewUUID()
+	event1 := &TestEvent{id, "event1"}
+	event2 := &TestEvent{id, "event2"}
+
+	t.Log("fail the second save")
+	store.FailSaveOn(2, nil)
+	if err := store.Save([]eventhorizon.Event{event1}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := store.Save([]eventhorizon.Event{event2}); err != ErrInjectedFault {
+		t.Error("there should be a ErrInjectedFault error:", err)
+	}
+	if err := store.Save([]eventhorizon.Event{event2}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("fail the first load with a custom error")
+	loadErr := errors.New("load error")
+	store.FailLoadOn(1, loadErr)
+	if _, err := store.Load(id); err != loadErr {
+		t.Error("there should be a load error:", err)
+	}
+	events, err := store.Load(id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(events, []eventhorizon.Event{event1, event2}) {
+		t.Error("the loaded events should be correct:", events)
+	}
+
+	t.Log("stale loads")
+	store.SetStaleLoads(1)
+	events, err = store.Load(id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(events, []eventhorizon.Event{event1}) {
+		t.Error("the loaded events should be stale:", events)
+	}
+
+	t.Log("latency")
+	store.Reset()
+	store.SetLatency(20 * time.Millisecond)
+	if _, err := store.Load(id); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(clock.waited, []time.Duration{20 * time.Millisecond}) {
+		t.Error("the load should be delayed:", clock.waited)
+	}
+}
+
+// afterClock is a clock that records the durations waited for, without
+// waiting.
+type afterClock struct {
+	eventhorizon.SystemClock
+	waited []time.Duration
+}
+
+func (c *afterClock) After(d time.Duration) <-chan time.Time {
+	c.waited = append(c.waited, d)
+	ch := make(chan time.Time, 1)
+	ch <- c.Now()
+	return ch
+}
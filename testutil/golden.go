@@ -0,0 +1,130 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutil
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/looplab/eventhorizon"
+)
+
+// UpdateGoldenEnv is the environment variable that, when set, makes
+// CheckGoldenEvents rewrite the golden files instead of comparing them.
+const UpdateGoldenEnv = "EH_UPDATE_GOLDEN"
+
+// CheckGoldenEvents round-trips every event type registered by register
+// through a codec and compares the result with golden files in dir, one file
+// per event type named "<EventType>.golden". Register is typically the
+// generated RegisterEventTypes of a domain, and a sample event must be passed
+// for each registered event type. It fails if the marshaled bytes differ from
+// the golden payload or if the golden payload no longer decodes into the
+// sample event, which catches struct changes that silently break wire
+// compatibility.
+//
+// It also fails for missing golden files, unless the EH_UPDATE_GOLDEN
+// environment variable is set, which makes it write all of them. The golden
+// files should be checked in together with the tests.
+func CheckGoldenEvents(t *testing.T, dir string, codec eventhorizon.EventCodec,
+	register func(eventhorizon.EventTypeRegisterer) error, events ...eventhorizon.Event) {
+	t.Helper()
+	update := os.Getenv(UpdateGoldenEnv) != ""
+
+	registry := goldenRegistry{}
+	if err := register(registry); err != nil {
+		t.Fatal("could not register event types:", err)
+	}
+	samples := make(map[string]bool)
+	for _, event := range events {
+		samples[event.EventType()] = true
+	}
+	eventTypes := make([]string, 0, len(registry))
+	for eventType := range registry {
+		eventTypes = append(eventTypes, eventType)
+	}
+	sort.Strings(eventTypes)
+	for _, eventType := range eventTypes {
+		if !samples[eventType] {
+			t.Errorf("%s: there should be a sample event", eventType)
+		}
+	}
+
+	for _, event := range events {
+		path := filepath.Join(dir, event.EventType()+".golden")
+
+		factory, ok := registry[event.EventType()]
+		if !ok {
+			t.Errorf("%s: the event type should be registered", event.EventType())
+			continue
+		}
+
+		data, err := codec.MarshalEvent(event)
+		if err != nil {
+			t.Errorf("%s: could not marshal event: %v", event.EventType(), err)
+			continue
+		}
+
+		if update {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				t.Fatal("could not create golden dir:", err)
+			}
+			if err := ioutil.WriteFile(path, data, 0644); err != nil {
+				t.Fatal("could not write golden file:", err)
+			}
+			t.Log("wrote golden file:", path)
+			continue
+		}
+
+		golden, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			t.Errorf("%s: there should be a golden file %s, set %s to write it", event.EventType(), path, UpdateGoldenEnv)
+			continue
+		} else if err != nil {
+			t.Fatal("could not read golden file:", err)
+		}
+
+		if !bytes.Equal(data, golden) {
+			t.Errorf("%s: the marshaled event should match the golden file %s", event.EventType(), path)
+		}
+
+		// Decode the golden payload into a new event of the same type.
+		decoded := factory()
+		if err := codec.UnmarshalEvent(golden, decoded); err != nil {
+			t.Errorf("%s: could not unmarshal golden file: %v", event.EventType(), err)
+			continue
+		}
+		if !reflect.DeepEqual(decoded, event) {
+			t.Errorf("%s: the golden event should decode correctly:\nhave: %+v\nwant: %+v", event.EventType(), decoded, event)
+		}
+	}
+}
+
+// goldenRegistry records the registered event types for CheckGoldenEvents.
+type goldenRegistry map[string]func() eventhorizon.Event
+
+// RegisterEventType implements the RegisterEventType method of the
+// eventhorizon.EventTypeRegisterer interface.
+func (r goldenRegistry) RegisterEventType(event eventhorizon.Event, factory func() eventhorizon.Event) error {
+	if _, ok := r[event.EventType()]; ok {
+		return eventhorizon.ErrHandlerAlreadySet
+	}
+	r[event.EventType()] = factory
+	return nil
+}
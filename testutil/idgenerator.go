@@ -0,0 +1,90 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutil
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+
+	"github.com/looplab/eventhorizon"
+)
+
+// SequenceIDGenerator is an IDGenerator that creates IDs from a counter, for
+// stable assertions and golden files. The IDs are valid v4 UUIDs, the first
+// one is 00000000-0000-4000-8000-000000000001.
+//
+// Use it in tests with eventhorizon.SetIDGenerator, and reset the default with
+// eventhorizon.SetIDGenerator(eventhorizon.UUIDv4Generator{}) afterwards.
+type SequenceIDGenerator struct {
+	next uint64
+	mu   sync.Mutex
+}
+
+// NewSequenceIDGenerator creates a new SequenceIDGenerator.
+func NewSequenceIDGenerator() *SequenceIDGenerator {
+	return &SequenceIDGenerator{
+		next: 1,
+	}
+}
+
+// NewID implements the NewID method of the IDGenerator interface.
+func (g *SequenceIDGenerator) NewID() eventhorizon.UUID {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	id := g.next
+	g.next++
+	return eventhorizon.UUID(fmt.Sprintf("00000000-0000-4000-8000-%012x", id))
+}
+
+// ParseID implements the ParseID method of the IDGenerator interface.
+func (g *SequenceIDGenerator) ParseID(s string) (eventhorizon.UUID, error) {
+	return eventhorizon.ParseUUID(s)
+}
+
+// SeededIDGenerator is an IDGenerator that creates random v4 UUIDs from a
+// seed, which gives the same IDs in every run of a test.
+type SeededIDGenerator struct {
+	rand *rand.Rand
+	mu   sync.Mutex
+}
+
+// NewSeededIDGenerator creates a new SeededIDGenerator with a seed.
+func NewSeededIDGenerator(seed int64) *SeededIDGenerator {
+	return &SeededIDGenerator{
+		rand: rand.New(rand.NewSource(seed)),
+	}
+}
+
+// NewID implements the NewID method of the IDGenerator interface.
+func (g *SeededIDGenerator) NewID() eventhorizon.UUID {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var u [16]byte
+	g.rand.Read(u[:])
+
+	// Set the RFC4122 flag.
+	u[8] = (u[8] & 0xBF) | 0x80
+
+	// Set the version to 4.
+	u[6] = (u[6] & 0xF) | 0x40
+
+	return eventhorizon.UUID(fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:]))
+}
+
+// ParseID implements the ParseID method of the IDGenerator interface.
+func (g *SeededIDGenerator) ParseID(s string) (eventhorizon.UUID, error) {
+	return eventhorizon.ParseUUID(s)
+}
@@ -0,0 +1,54 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutil
+
+import (
+	"testing"
+
+	"github.com/looplab/eventhorizon"
+)
+
+func TestSequenceIDGenerator(t *testing.T) {
+	eventhorizon.SetIDGenerator(NewSequenceIDGenerator())
+	defer eventhorizon.SetIDGenerator(eventhorizon.UUIDv4Generator{})
+
+	if id := eventhorizon.NewUUID(); id != "00000000-0000-4000-8000-000000000001" {
+		t.Error("the ID should be correct:", id)
+	}
+	id := eventhorizon.NewUUID()
+	if id != "00000000-0000-4000-8000-000000000002" {
+		t.Error("the ID should be correct:", id)
+	}
+	if _, err := eventhorizon.ParseUUID(id.String()); err != nil {
+		t.Error("there should be no error:", err)
+	}
+}
+
+func TestSeededIDGenerator(t *testing.T) {
+	g1, g2 := NewSeededIDGenerator(42), NewSeededIDGenerator(42)
+	id1, id2 := g1.NewID(), g2.NewID()
+	if id1 != id2 {
+		t.Error("the IDs should be the same for the same seed:", id1, id2)
+	}
+	if g1.NewID() == id1 {
+		t.Error("the IDs should be unique")
+	}
+	if _, err := g1.ParseID(id1.String()); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if id := NewSeededIDGenerator(43).NewID(); id == id1 {
+		t.Error("the IDs should differ for other seeds:", id)
+	}
+}
@@ -0,0 +1,236 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package integration contains a harness for integration tests that need
+// Redis and MongoDB. The services are started as Docker containers with
+// testcontainers-go the first time they are needed and shared by all tests in
+// the package, unless they are provided by the environment (as on Wercker).
+// Tests are skipped if the services have to be started and Docker is not
+// available.
+//
+// MongoDB is started as a single node replica set, as the event store needs
+// transactions, and Redis 7 as the event bus needs streams.
+package integration
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/go-connections/nat"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+
+	"github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/messaging/redis"
+	"github.com/looplab/eventhorizon/storage/mongodb"
+)
+
+var (
+	mongoOnce sync.Once
+	mongoURL  string
+	mongoErr  error
+
+	redisOnce sync.Once
+	redisAddr string
+	redisErr  error
+
+	containersMu sync.Mutex
+	containers   []testcontainers.Container
+)
+
+// MongoURL returns the URL of a running MongoDB, starting a container if the
+// MONGO_PORT_27017_TCP_ADDR and MONGO_PORT_27017_TCP_PORT env vars are not set.
+func MongoURL(t *testing.T) string {
+	t.Helper()
+	skipWithoutDocker(t, "MONGO_PORT_27017_TCP")
+	mongoOnce.Do(func() {
+		req := testcontainers.ContainerRequest{
+			Image: "mongo:6",
+			Cmd:   []string{"--replSet", "rs0", "--bind_ip_all"},
+		}
+		mongoURL, mongoErr = service("MONGO_PORT_27017_TCP", req, "27017/tcp", initiateReplicaSet)
+		if mongoErr == nil && os.Getenv("MONGO_PORT_27017_TCP_ADDR") == "" {
+			// The member is known by its address in the container.
+			mongoURL += "/?directConnection=true"
+		}
+	})
+	if mongoErr != nil {
+		t.Fatal("could not start MongoDB:", mongoErr)
+	}
+	return mongoURL
+}
+
+// RedisAddr returns the address of a running Redis, starting a container if the
+// REDIS_PORT_6379_TCP_ADDR and REDIS_PORT_6379_TCP_PORT env vars are not set.
+func RedisAddr(t *testing.T) string {
+	t.Helper()
+	skipWithoutDocker(t, "REDIS_PORT_6379_TCP")
+	redisOnce.Do(func() {
+		req := testcontainers.ContainerRequest{Image: "redis:7"}
+		redisAddr, redisErr = service("REDIS_PORT_6379_TCP", req, "6379/tcp", nil)
+	})
+	if redisErr != nil {
+		t.Fatal("could not start Redis:", redisErr)
+	}
+	return redisAddr
+}
+
+// NewMongoEventStore creates a MongoDB event store using a unique database. The
+// database is dropped and the store closed when the test finishes.
+func NewMongoEventStore(t *testing.T, eventBus eventhorizon.EventBus) *mongodb.EventStore {
+	t.Helper()
+	store, err := mongodb.NewEventStore(eventBus, MongoURL(t), uniqueName("test"))
+	if err != nil {
+		t.Fatal("could not create event store:", err)
+	}
+	t.Cleanup(func() {
+		if err := store.Clear(); err != nil {
+			t.Log("could not clear event store:", err)
+		}
+		store.Close()
+	})
+	return store
+}
+
+// NewMongoReadRepository creates a MongoDB read repository using a unique
+// database. The collection is dropped and the repository closed when the test
+// finishes.
+func NewMongoReadRepository(t *testing.T, collection string) *mongodb.ReadRepository {
+	t.Helper()
+	repo, err := mongodb.NewReadRepository(MongoURL(t), uniqueName("test"), collection)
+	if err != nil {
+		t.Fatal("could not create read repository:", err)
+	}
+	t.Cleanup(func() {
+		if err := repo.Clear(); err != nil {
+			t.Log("could not clear read repository:", err)
+		}
+		repo.Close()
+	})
+	return repo
+}
+
+// NewRedisEventBus creates a Redis event bus for an app ID. Use the same app
+// ID for several buses to test remote events. The bus is closed when the test
+// finishes.
+func NewRedisEventBus(t *testing.T, appID string) *redis.EventBus {
+	t.Helper()
+	bus, err := redis.NewEventBus(appID, RedisAddr(t), "")
+	if err != nil {
+		t.Fatal("could not create event bus:", err)
+	}
+	t.Cleanup(bus.Close)
+	return bus
+}
+
+// Terminate stops all started containers. It is optional to call, as the
+// containers are also reaped when the test process exits, but can be used from
+// TestMain to stop them promptly.
+func Terminate() {
+	containersMu.Lock()
+	defer containersMu.Unlock()
+	for _, c := range containers {
+		c.Terminate(context.Background())
+	}
+	containers = nil
+}
+
+// skipWithoutDocker skips a test if a service is not provided by the
+// environment and Docker is not available to start it.
+func skipWithoutDocker(t *testing.T, env string) {
+	t.Helper()
+	if os.Getenv(env+"_ADDR") == "" || os.Getenv(env+"_PORT") == "" {
+		testcontainers.SkipIfProviderIsNotHealthy(t)
+	}
+}
+
+// service returns the address of a service from Wercker style env vars, or
+// starts a container for it and sets it up if setup is not nil.
+func service(env string, req testcontainers.ContainerRequest, port nat.Port, setup func(context.Context, testcontainers.Container) error) (string, error) {
+	host := os.Getenv(env + "_ADDR")
+	p := os.Getenv(env + "_PORT")
+	if host != "" && p != "" {
+		return host + ":" + p, nil
+	}
+
+	ctx := context.Background()
+	req.ExposedPorts = []string{string(port)}
+	req.WaitingFor = wait.ForListeningPort(port)
+	c, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: req,
+		Started:          true,
+	})
+	if err != nil {
+		return "", err
+	}
+	containersMu.Lock()
+	containers = append(containers, c)
+	containersMu.Unlock()
+
+	if setup != nil {
+		if err := setup(ctx, c); err != nil {
+			return "", err
+		}
+	}
+
+	host, err = c.Host(ctx)
+	if err != nil {
+		return "", err
+	}
+	mapped, err := c.MappedPort(ctx, port)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s:%s", host, mapped.Port()), nil
+}
+
+// initiateReplicaSet initiates the replica set of a MongoDB container and
+// waits for its node to become primary.
+func initiateReplicaSet(ctx context.Context, c testcontainers.Container) error {
+	if code, _, err := c.Exec(ctx, []string{"mongosh", "--quiet", "--eval", "rs.initiate()"}); err != nil {
+		return err
+	} else if code != 0 {
+		return fmt.Errorf("could not initiate replica set: exit code %d", code)
+	}
+
+	deadline := time.Now().Add(30 * time.Second)
+	for time.Now().Before(deadline) {
+		code, _, err := c.Exec(ctx, []string{"mongosh", "--quiet", "--eval",
+			"if (!db.hello().isWritablePrimary) quit(1)"})
+		if err != nil {
+			return err
+		} else if code == 0 {
+			return nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return fmt.Errorf("replica set has no primary")
+}
+
+var nameCounter struct {
+	sync.Mutex
+	n int
+}
+
+// uniqueName returns a name that is unique for the test process.
+func uniqueName(prefix string) string {
+	nameCounter.Lock()
+	defer nameCounter.Unlock()
+	nameCounter.n++
+	return fmt.Sprintf("%s_%d_%d", prefix, os.Getpid(), nameCounter.n)
+}
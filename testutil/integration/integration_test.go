@@ -0,0 +1,62 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package integration
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/messaging/testbus"
+	"github.com/looplab/eventhorizon/testutil"
+)
+
+func TestHarness(t *testing.T) {
+	bus := NewRedisEventBus(t, "integration")
+	if err := bus.RegisterEventType(&testutil.TestEvent{}, func() eventhorizon.Event {
+		return &testutil.TestEvent{}
+	}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	recorder := testbus.NewEventBus()
+	bus.AddGlobalHandler(recorder)
+
+	store := NewMongoEventStore(t, bus)
+	if err := store.RegisterEventType(&testutil.TestEvent{}, func() eventhorizon.Event {
+		return &testutil.TestEvent{}
+	}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	t.Log("save and publish event")
+	event1 := &testutil.TestEvent{eventhorizon.NewUUID(), "event1"}
+	if err := store.Save([]eventhorizon.Event{event1}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	event := recorder.WaitForEvent(t, "TestEvent", time.Second)
+	if !reflect.DeepEqual(event, event1) {
+		t.Error("the received event should be correct:", event)
+	}
+
+	t.Log("load event")
+	events, err := store.Load(event1.TestID)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(events, []eventhorizon.Event{event1}) {
+		t.Error("the loaded events should be correct:", events)
+	}
+}
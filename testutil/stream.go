@@ -0,0 +1,90 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutil
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/looplab/eventhorizon"
+)
+
+// StreamBuilder is a fluent builder of event streams for an aggregate, for use
+// as test fixtures.
+//
+// An example would be:
+//     events := testutil.NewStream(id, 0).Add(&InviteCreated{...}).Add(&InviteAccepted{id}).Versioned()
+type StreamBuilder struct {
+	id       eventhorizon.UUID
+	events   []eventhorizon.Event
+	version  int
+	start    time.Time
+	interval time.Duration
+}
+
+// NewStream creates a StreamBuilder for an aggregate, with the version of the
+// first event in the stream. Stores number the events of an aggregate from
+// different versions, the memory store from 0 and the MongoDB and DynamoDB
+// stores from 1, so the version must be that of the store for a new aggregate
+// when the stream is imported. The events are one second apart, starting at
+// 2016-01-01 UTC, so that fixtures are stable between runs.
+func NewStream(id eventhorizon.UUID, version int) *StreamBuilder {
+	return &StreamBuilder{
+		id:       id,
+		version:  version,
+		start:    time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC),
+		interval: time.Second,
+	}
+}
+
+// Add adds events to the stream. It panics if an event belongs to another
+// aggregate, as that is always a mistake in the test.
+func (s *StreamBuilder) Add(events ...eventhorizon.Event) *StreamBuilder {
+	for _, event := range events {
+		if event.AggregateID() != s.id {
+			panic(fmt.Sprintf("testutil: event %s is for aggregate %s, not %s",
+				event.EventType(), event.AggregateID(), s.id))
+		}
+		s.events = append(s.events, event)
+	}
+	return s
+}
+
+// At sets the timestamp of the first event and the interval between events.
+func (s *StreamBuilder) At(start time.Time, interval time.Duration) *StreamBuilder {
+	s.start = start
+	s.interval = interval
+	return s
+}
+
+// Events returns the events of the stream, as accepted by EventStore.Save and
+// EventBus.PublishEvent.
+func (s *StreamBuilder) Events() []eventhorizon.Event {
+	return append([]eventhorizon.Event{}, s.events...)
+}
+
+// Versioned returns the events of the stream in envelopes with versions and
+// timestamps.
+func (s *StreamBuilder) Versioned() []eventhorizon.EventEnvelope {
+	envelopes := make([]eventhorizon.EventEnvelope, len(s.events))
+	for i, event := range s.events {
+		envelopes[i] = eventhorizon.EventEnvelope{
+			Event:     event,
+			Version:   s.version + i,
+			Timestamp: s.start.Add(time.Duration(i) * s.interval),
+		}
+	}
+	return envelopes
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutil
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/messaging/local"
+	"github.com/looplab/eventhorizon/storage/memory"
+)
+
+func TestStreamBuilder(t *testing.T) {
+	id := eventhorizon.NewUUID()
+	event1 := &TestEvent{id, "event1"}
+	event2 := &TestEventOther{id, "event2"}
+
+	stream := NewStream(id, 1).Add(event1).Add(event2)
+	if events := stream.Events(); !reflect.DeepEqual(events, []eventhorizon.Event{event1, event2}) {
+		t.Error("the events should be correct:", events)
+	}
+
+	start := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	expected := []eventhorizon.EventEnvelope{
+		{Event: event1, Version: 1, Timestamp: start},
+		{Event: event2, Version: 2, Timestamp: start.Add(time.Second)},
+	}
+	if envelopes := stream.Versioned(); !reflect.DeepEqual(envelopes, expected) {
+		t.Error("the envelopes should be correct:", envelopes)
+	}
+
+	t.Log("from version and time")
+	envelopes := NewStream(id, 5).Add(event1, event2).At(start, time.Minute).Versioned()
+	if envelopes[1].Version != 6 || !envelopes[1].Timestamp.Equal(start.Add(time.Minute)) {
+		t.Error("the envelope should be correct:", envelopes[1])
+	}
+
+	t.Log("event for other aggregate")
+	defer func() {
+		if recover() == nil {
+			t.Error("there should be a panic")
+		}
+	}()
+	stream.Add(&TestEvent{eventhorizon.NewUUID(), "other"})
+}
+
+func TestStreamBuilderStoreAndBus(t *testing.T) {
+	id := eventhorizon.NewUUID()
+	event1 := &TestEvent{id, "event1"}
+	event2 := &TestEventOther{id, "event2"}
+	stream := NewStream(id, 0).Add(event1, event2)
+
+	t.Log("import the stream into the memory store")
+	store := memory.NewEventStore(nil)
+	if err := store.Import(context.Background(), stream.Versioned()); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	envelopes, err := store.LoadEnvelopes(id)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(envelopes) != 2 || envelopes[0].Event != event1 || envelopes[1].Event != event2 ||
+		envelopes[1].Version != 1 || !envelopes[1].Timestamp.Equal(stream.Versioned()[1].Timestamp) {
+		t.Error("the envelopes should be imported:", envelopes)
+	}
+
+	t.Log("publish the stream on a bus")
+	bus := local.NewEventBus()
+	handler := NewMockEventHandler()
+	bus.AddLocalHandler(handler)
+	eventhorizon.PublishEvents(bus, stream.Events())
+	if !reflect.DeepEqual(handler.Events, []eventhorizon.Event{event1, event2}) {
+		t.Error("the events should be published:", handler.Events)
+	}
+}
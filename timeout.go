@@ -0,0 +1,167 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrTimeoutNotFound is when a timeout can not be found.
+var ErrTimeoutNotFound = errors.New("could not find timeout")
+
+// Timeout is a request by a saga to get a TimeoutReached event at a deadline.
+type Timeout struct {
+	ID       UUID      `bson:"_id"`
+	SagaID   UUID      `bson:"saga_id"`
+	SagaType string    `bson:"saga_type"`
+	Name     string    `bson:"name"`
+	Deadline time.Time `bson:"deadline"`
+}
+
+// TimeoutReached is the event published when the deadline of a timeout has
+// been reached. It is an event of the saga that requested the timeout.
+type TimeoutReached struct {
+	TimeoutID UUID      `bson:"timeout_id"`
+	SagaID    UUID      `bson:"saga_id"`
+	SagaType  string    `bson:"saga_type"`
+	Name      string    `bson:"name"`
+	Deadline  time.Time `bson:"deadline"`
+}
+
+// AggregateID implements the AggregateID method of the Event interface.
+func (e *TimeoutReached) AggregateID() UUID { return e.SagaID }
+
+// AggregateType implements the AggregateType method of the Event interface.
+func (e *TimeoutReached) AggregateType() string { return e.SagaType }
+
+// EventType implements the EventType method of the Event interface.
+func (e *TimeoutReached) EventType() string { return "TimeoutReached" }
+
+// TimeoutStore is a durable storage of timeouts.
+type TimeoutStore interface {
+	// SaveTimeout saves a timeout.
+	SaveTimeout(*Timeout) error
+
+	// RemoveTimeout removes a timeout. Returns ErrTimeoutNotFound if there is
+	// none.
+	RemoveTimeout(UUID) error
+
+	// DueTimeouts returns the timeouts with deadlines at or before a time, in
+	// the order of their deadlines.
+	DueTimeouts(time.Time) ([]*Timeout, error)
+}
+
+// TimeoutManager lets sagas schedule timeouts, and publishes TimeoutReached
+// events on an event bus when the deadlines have been reached. Timeouts are
+// kept in a TimeoutStore so that they survive restarts.
+//
+// An example would be:
+//     manager.Schedule(order.ID, "Order", "payment", time.Now().Add(30*time.Minute))
+type TimeoutManager struct {
+	Lifecycle
+
+	store    TimeoutStore
+	bus      EventBus
+	interval time.Duration
+	clock    Clock
+	lock     Lock
+}
+
+// NewTimeoutManager creates a TimeoutManager that checks for due timeouts at
+// an interval. The clock is used for deadlines and the interval.
+func NewTimeoutManager(store TimeoutStore, bus EventBus, interval time.Duration, clock Clock) *TimeoutManager {
+	return &TimeoutManager{
+		store:    store,
+		bus:      bus,
+		interval: interval,
+		clock:    clock,
+	}
+}
+
+// Schedule schedules a named timeout for a saga at a deadline, and returns the
+// ID of the timeout.
+func (m *TimeoutManager) Schedule(sagaID UUID, sagaType, name string, deadline time.Time) (UUID, error) {
+	timeout := &Timeout{
+		ID:       NewUUID(),
+		SagaID:   sagaID,
+		SagaType: sagaType,
+		Name:     name,
+		Deadline: deadline,
+	}
+	if err := m.store.SaveTimeout(timeout); err != nil {
+		return "", err
+	}
+	return timeout.ID, nil
+}
+
+// Cancel cancels a scheduled timeout. Returns ErrTimeoutNotFound if it has
+// already been reached or cancelled.
+func (m *TimeoutManager) Cancel(id UUID) error {
+	return m.store.RemoveTimeout(id)
+}
+
+// PublishDue publishes TimeoutReached events for the timeouts that are due and
+// removes them. A timeout that is published but not removed because of an
+// error is published again, so handlers should be idempotent.
+func (m *TimeoutManager) PublishDue() error {
+	timeouts, err := m.store.DueTimeouts(m.clock.Now())
+	if err != nil {
+		return err
+	}
+	for _, timeout := range timeouts {
+		m.bus.PublishEvent(&TimeoutReached{
+			TimeoutID: timeout.ID,
+			SagaID:    timeout.SagaID,
+			SagaType:  timeout.SagaType,
+			Name:      timeout.Name,
+			Deadline:  timeout.Deadline,
+		})
+		if err := m.store.RemoveTimeout(timeout.ID); err != nil && err != ErrTimeoutNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetLock sets a lock that is held while publishing due timeouts, so that only
+// one of several managers using the same store publishes them.
+func (m *TimeoutManager) SetLock(lock Lock) {
+	m.lock = lock
+}
+
+// Run publishes due timeouts now and then at every interval, until the context
+// is done or the timeouts could not be published. If a lock is set, the
+// timeouts are only published when it could be acquired.
+func (m *TimeoutManager) Run(ctx context.Context) error {
+	for {
+		var err error
+		if m.lock != nil {
+			err = WithLock(m.lock, "timeouts", m.interval, m.PublishDue)
+		} else {
+			err = m.PublishDue()
+		}
+		if err != nil && err != ErrLockHeld {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-m.clock.After(m.interval):
+		}
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTimeoutManager(t *testing.T) {
+	store := &timeoutStore{timeouts: map[UUID]*Timeout{}}
+	bus := &MockEventBus{}
+	now := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := &tickClock{now: now, ticks: make(chan time.Time)}
+	manager := NewTimeoutManager(store, bus, time.Minute, clock)
+	sagaID := NewUUID()
+
+	t.Log("schedule and cancel")
+	id1, err := manager.Schedule(sagaID, "Order", "payment", now.Add(30*time.Minute))
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	id2, _ := manager.Schedule(sagaID, "Order", "shipping", now.Add(time.Hour))
+	if err := manager.Cancel(id2); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := manager.Cancel(id2); err != ErrTimeoutNotFound {
+		t.Error("there should be a ErrTimeoutNotFound error:", err)
+	}
+
+	t.Log("not due")
+	if err := manager.PublishDue(); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(bus.Events) != 0 {
+		t.Error("there should be no events:", bus.Events)
+	}
+
+	t.Log("due")
+	clock.now = now.Add(time.Hour)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- manager.Run(ctx) }()
+	clock.ticks <- clock.now
+	cancel()
+	if err := <-done; err != nil {
+		t.Error("there should be no error:", err)
+	}
+	expected := []Event{&TimeoutReached{
+		TimeoutID: id1,
+		SagaID:    sagaID,
+		SagaType:  "Order",
+		Name:      "payment",
+		Deadline:  now.Add(30 * time.Minute),
+	}}
+	if !reflect.DeepEqual(bus.Events, expected) {
+		t.Error("the timeout should be reached once:", bus.Events)
+	}
+	if len(store.timeouts) != 0 {
+		t.Error("the timeout should be removed:", store.timeouts)
+	}
+
+	t.Log("held lock")
+	manager.Schedule(sagaID, "Order", "payment", now)
+	manager.SetLock(&mockLock{held: true})
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() { done <- manager.Run(ctx) }()
+	clock.ticks <- clock.now
+	cancel()
+	if err := <-done; err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(bus.Events) != 1 {
+		t.Error("the timeout should not be published without the lock:", bus.Events)
+	}
+}
+
+type timeoutStore struct {
+	timeouts map[UUID]*Timeout
+}
+
+func (s *timeoutStore) SaveTimeout(timeout *Timeout) error {
+	s.timeouts[timeout.ID] = timeout
+	return nil
+}
+
+func (s *timeoutStore) RemoveTimeout(id UUID) error {
+	if _, ok := s.timeouts[id]; !ok {
+		return ErrTimeoutNotFound
+	}
+	delete(s.timeouts, id)
+	return nil
+}
+
+func (s *timeoutStore) DueTimeouts(now time.Time) ([]*Timeout, error) {
+	timeouts := []*Timeout{}
+	for _, timeout := range s.timeouts {
+		if !timeout.Deadline.After(now) {
+			timeouts = append(timeouts, timeout)
+		}
+	}
+	return timeouts, nil
+}
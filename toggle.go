@@ -0,0 +1,296 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"sync"
+)
+
+// ErrToggleNotFound is when no toggled handler has a name.
+var ErrToggleNotFound = errors.New("could not find toggled handler")
+
+// PausePolicy is what a paused handler does with the events it gets.
+type PausePolicy int
+
+const (
+	// PauseBuffer buffers the events and handles them in order on resume.
+	PauseBuffer PausePolicy = iota
+	// PauseSkip skips the events.
+	PauseSkip
+)
+
+// FlagProvider provides feature flags, for example from a flag service.
+type FlagProvider interface {
+	// Enabled returns true if a flag is enabled.
+	Enabled(flag string) bool
+}
+
+// FlagProviderFunc is a function that can be used as a flag provider.
+type FlagProviderFunc func(flag string) bool
+
+// Enabled implements the Enabled method of the FlagProvider interface.
+func (f FlagProviderFunc) Enabled(flag string) bool {
+	return f(flag)
+}
+
+// ToggleHandler is an event handler that can be paused and resumed at
+// runtime, for example to disable a misbehaving projector without a deploy.
+// Paused handlers buffer or skip the events per their policy.
+type ToggleHandler struct {
+	handler    EventHandler
+	policy     PausePolicy
+	bufferSize int
+	flags      FlagProvider
+	flag       string
+	flagOn     bool
+	paused     bool
+	flushing   bool
+	buffer     []toggledEvent
+	skipped    uint64
+	mu         sync.Mutex
+}
+
+type toggledEvent struct {
+	ctx   context.Context
+	event Event
+}
+
+// NewToggleHandler creates a new ToggleHandler, which is not paused.
+func NewToggleHandler(handler EventHandler, policy PausePolicy) *ToggleHandler {
+	return &ToggleHandler{
+		handler:    handler,
+		policy:     policy,
+		bufferSize: 10000,
+		flagOn:     true,
+	}
+}
+
+// SetBufferSize sets the max number of buffered events, the default is 10000.
+// Events are skipped when the buffer is full.
+func (h *ToggleHandler) SetBufferSize(size int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.bufferSize = size
+}
+
+// SetFlag drives the handler by a flag of a flag provider, which is checked
+// for each event. The handler is paused when the flag is disabled and resumed
+// when it is enabled again.
+func (h *ToggleHandler) SetFlag(flags FlagProvider, flag string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.flags = flags
+	h.flag = flag
+}
+
+// Pause pauses the handler.
+func (h *ToggleHandler) Pause() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.paused = true
+}
+
+// Resume resumes the handler, after handling the buffered events.
+func (h *ToggleHandler) Resume() {
+	h.mu.Lock()
+	if !h.paused {
+		h.mu.Unlock()
+		return
+	}
+	h.paused = false
+	if h.flushing {
+		h.mu.Unlock()
+		return
+	}
+
+	// Events that are received while flushing are buffered after the others.
+	h.flushing = true
+	for len(h.buffer) > 0 && !h.paused {
+		buffered := h.buffer
+		h.buffer = nil
+		h.mu.Unlock()
+		for i, e := range buffered {
+			h.mu.Lock()
+			paused := h.paused
+			h.mu.Unlock()
+			if paused {
+				h.mu.Lock()
+				h.buffer = append(buffered[i:], h.buffer...)
+				h.mu.Unlock()
+				break
+			}
+			HandleEventWithContext(e.ctx, h.handler, e.event)
+		}
+		h.mu.Lock()
+	}
+	h.flushing = false
+	h.mu.Unlock()
+}
+
+// Paused returns true if the handler is paused.
+func (h *ToggleHandler) Paused() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.paused
+}
+
+// Buffered returns the number of buffered events.
+func (h *ToggleHandler) Buffered() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.buffer)
+}
+
+// Skipped returns the number of skipped events.
+func (h *ToggleHandler) Skipped() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.skipped
+}
+
+// HandlerName implements the HandlerName method of the NamedEventHandler
+// interface, with the name of the toggled handler.
+func (h *ToggleHandler) HandlerName() string {
+	return HandlerName(h.handler)
+}
+
+// HandleEvent implements the HandleEvent method of the EventHandler interface.
+func (h *ToggleHandler) HandleEvent(event Event) {
+	h.HandleEventWithContext(context.Background(), event)
+}
+
+// HandleEventWithContext implements the HandleEventWithContext method of the
+// ContextEventHandler interface.
+func (h *ToggleHandler) HandleEventWithContext(ctx context.Context, event Event) {
+	h.checkFlag()
+
+	h.mu.Lock()
+	if h.paused || h.flushing {
+		if h.policy == PauseBuffer && len(h.buffer) < h.bufferSize {
+			h.buffer = append(h.buffer, toggledEvent{ctx, event})
+		} else {
+			h.skipped++
+			if h.policy == PauseBuffer {
+				log.Printf("error: toggle handler: buffer full, skipping %s\n", event.EventType())
+			}
+		}
+		h.mu.Unlock()
+		return
+	}
+	h.mu.Unlock()
+
+	HandleEventWithContext(ctx, h.handler, event)
+}
+
+// checkFlag pauses or resumes the handler when its flag has changed.
+func (h *ToggleHandler) checkFlag() {
+	h.mu.Lock()
+	flags, flag, on := h.flags, h.flag, h.flagOn
+	h.mu.Unlock()
+	if flags == nil {
+		return
+	}
+
+	enabled := flags.Enabled(flag)
+	if enabled == on {
+		return
+	}
+	h.mu.Lock()
+	h.flagOn = enabled
+	h.mu.Unlock()
+	if enabled {
+		h.Resume()
+	} else {
+		h.Pause()
+	}
+}
+
+// Toggles keeps toggled handlers by name, so that they can be paused and
+// resumed by name, for example from an admin API.
+type Toggles struct {
+	handlers map[string]*ToggleHandler
+	mu       sync.RWMutex
+}
+
+// NewToggles creates a new Toggles.
+func NewToggles() *Toggles {
+	return &Toggles{
+		handlers: make(map[string]*ToggleHandler),
+	}
+}
+
+// Toggle wraps a handler in a ToggleHandler that is kept by the name of the
+// handler, see HandlerName, and returns it to be added to a bus.
+func (t *Toggles) Toggle(handler EventHandler, policy PausePolicy) *ToggleHandler {
+	h := NewToggleHandler(handler, policy)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.handlers[h.HandlerName()] = h
+	return h
+}
+
+// Middleware returns a handler middleware that toggles all handlers it wraps.
+func (t *Toggles) Middleware(policy PausePolicy) EventHandlerMiddleware {
+	return func(handler EventHandler) EventHandler {
+		return t.Toggle(handler, policy)
+	}
+}
+
+// Handler returns the toggled handler with a name.
+func (t *Toggles) Handler(name string) (*ToggleHandler, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	h, ok := t.handlers[name]
+	if !ok {
+		return nil, ErrToggleNotFound
+	}
+	return h, nil
+}
+
+// Pause pauses the handler with a name.
+func (t *Toggles) Pause(name string) error {
+	h, err := t.Handler(name)
+	if err != nil {
+		return err
+	}
+	h.Pause()
+	return nil
+}
+
+// Resume resumes the handler with a name.
+func (t *Toggles) Resume(name string) error {
+	h, err := t.Handler(name)
+	if err != nil {
+		return err
+	}
+	h.Resume()
+	return nil
+}
+
+// Names returns the names of the toggled handlers, sorted.
+func (t *Toggles) Names() []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	names := make([]string, 0, len(t.handlers))
+	for name := range t.handlers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestToggleHandler(t *testing.T) {
+	var handled []Event
+	handler := NewToggleHandler(EventHandlerFunc(func(event Event) {
+		handled = append(handled, event)
+	}), PauseBuffer)
+	handler.SetBufferSize(2)
+
+	event1 := &TestEvent{NewUUID(), "event1"}
+	event2 := &TestEvent{NewUUID(), "event2"}
+	event3 := &TestEvent{NewUUID(), "event3"}
+
+	t.Log("handle events")
+	handler.HandleEvent(event1)
+	if !reflect.DeepEqual(handled, []Event{event1}) {
+		t.Error("the event should be handled:", handled)
+	}
+
+	t.Log("buffer events while paused")
+	handler.Pause()
+	if !handler.Paused() {
+		t.Error("the handler should be paused")
+	}
+	handler.HandleEvent(event2)
+	handler.HandleEvent(event3)
+	handler.HandleEvent(event1)
+	if len(handled) != 1 {
+		t.Error("the events should not be handled:", handled)
+	}
+	if handler.Buffered() != 2 || handler.Skipped() != 1 {
+		t.Error("the events should be buffered up to the buffer size:", handler.Buffered(), handler.Skipped())
+	}
+
+	t.Log("handle the buffered events on resume")
+	handler.Resume()
+	if !reflect.DeepEqual(handled, []Event{event1, event2, event3}) {
+		t.Error("the buffered events should be handled in order:", handled)
+	}
+	if handler.Paused() || handler.Buffered() != 0 {
+		t.Error("the handler should be resumed")
+	}
+
+	t.Log("skip events while paused")
+	handled = nil
+	handler = NewToggleHandler(EventHandlerFunc(func(event Event) {
+		handled = append(handled, event)
+	}), PauseSkip)
+	handler.Pause()
+	handler.HandleEvent(event1)
+	handler.Resume()
+	if len(handled) != 0 || handler.Skipped() != 1 {
+		t.Error("the event should be skipped:", handled)
+	}
+}
+
+func TestToggleHandlerFlag(t *testing.T) {
+	var handled []Event
+	handler := NewToggleHandler(EventHandlerFunc(func(event Event) {
+		handled = append(handled, event)
+	}), PauseBuffer)
+	enabled := false
+	handler.SetFlag(FlagProviderFunc(func(flag string) bool {
+		if flag != "projector" {
+			t.Error("the flag should be correct:", flag)
+		}
+		return enabled
+	}), "projector")
+
+	t.Log("pause when the flag is disabled")
+	event1 := &TestEvent{NewUUID(), "event1"}
+	handler.HandleEvent(event1)
+	if len(handled) != 0 || !handler.Paused() {
+		t.Error("the handler should be paused:", handled)
+	}
+
+	t.Log("resume when the flag is enabled")
+	enabled = true
+	event2 := &TestEvent{NewUUID(), "event2"}
+	handler.HandleEvent(event2)
+	if !reflect.DeepEqual(handled, []Event{event1, event2}) {
+		t.Error("the events should be handled in order:", handled)
+	}
+}
+
+func TestToggles(t *testing.T) {
+	toggles := NewToggles()
+	inner := &labelsHandler{}
+	handler := UseEventHandlerMiddleware(inner, toggles.Middleware(PauseSkip))
+	name := HandlerName(inner)
+	if !reflect.DeepEqual(toggles.Names(), []string{name}) {
+		t.Error("the handler should be toggled:", toggles.Names())
+	}
+
+	t.Log("pause and resume by name")
+	if err := toggles.Pause(name); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !handler.(*ToggleHandler).Paused() {
+		t.Error("the handler should be paused")
+	}
+	if err := toggles.Resume(name); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if handler.(*ToggleHandler).Paused() {
+		t.Error("the handler should be resumed")
+	}
+	if err := toggles.Pause("unknown"); err != ErrToggleNotFound {
+		t.Error("there should be a ErrToggleNotFound error:", err)
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// ErrNotInspectable is when a bus can't list its handlers.
+var ErrNotInspectable = errors.New("bus is not inspectable")
+
+// HandlerRegistration is a handler added to an event bus. The event type is
+// empty for handlers of all events, which are local or global.
+type HandlerRegistration struct {
+	EventType string
+	Handler   EventHandler
+	Global    bool
+}
+
+// InspectableEventBus is an event bus that can list its handlers, for example
+// for drawing the topology of an app.
+type InspectableEventBus interface {
+	EventBus
+
+	// Handlers returns the handlers added to the bus.
+	Handlers() []HandlerRegistration
+}
+
+// InspectableCommandBus is a command bus that can list its handlers.
+type InspectableCommandBus interface {
+	CommandBus
+
+	// CommandHandlers returns the handlers of the bus by command type.
+	CommandHandlers() map[string]CommandHandler
+}
+
+// TopologyEdge is a flow of events or commands of a type to a component.
+type TopologyEdge struct {
+	// From is the event or command type.
+	From string
+	// To is the name of the handling component.
+	To string
+	// Command is true if From is a command type.
+	Command bool
+}
+
+// Topology is a graph of the event and command types that flow to the
+// handlers of an app, for keeping architecture docs in sync with the code.
+// It is collected at runtime from the buses, and can be written as Graphviz
+// or Mermaid, for example:
+//   topology := eventhorizon.NewTopology()
+//   topology.AddEventBus(eventBus)
+//   topology.AddCommandBus(commandBus)
+//   topology.WriteMermaid(os.Stdout)
+// Handlers are named with HandlerName.
+type Topology struct {
+	edges map[TopologyEdge]bool
+}
+
+// NewTopology creates an empty Topology.
+func NewTopology() *Topology {
+	return &Topology{
+		edges: make(map[TopologyEdge]bool),
+	}
+}
+
+// AddEventBus adds the handlers of an event bus. Handlers of all events get an
+// edge from "*", or from "* (global)" for global handlers. Returns
+// ErrNotInspectable if the bus is not an InspectableEventBus.
+func (t *Topology) AddEventBus(bus EventBus) error {
+	b, ok := bus.(InspectableEventBus)
+	if !ok {
+		return ErrNotInspectable
+	}
+	for _, r := range b.Handlers() {
+		from := r.EventType
+		if from == "" && r.Global {
+			from = "* (global)"
+		} else if from == "" {
+			from = "*"
+		}
+		t.AddEdge(TopologyEdge{From: from, To: HandlerName(r.Handler)})
+	}
+	return nil
+}
+
+// AddCommandBus adds the handlers of a command bus. Returns ErrNotInspectable
+// if the bus is not an InspectableCommandBus.
+func (t *Topology) AddCommandBus(bus CommandBus) error {
+	b, ok := bus.(InspectableCommandBus)
+	if !ok {
+		return ErrNotInspectable
+	}
+	for commandType, handler := range b.CommandHandlers() {
+		t.AddEdge(TopologyEdge{From: commandType, To: fmt.Sprintf("%T", handler), Command: true})
+	}
+	return nil
+}
+
+// AddEdge adds an edge, for flows that can't be inspected, such as the events
+// of aggregates or the commands of sagas.
+func (t *Topology) AddEdge(edge TopologyEdge) {
+	t.edges[edge] = true
+}
+
+// Edges returns the edges, sorted by type and component.
+func (t *Topology) Edges() []TopologyEdge {
+	edges := make([]TopologyEdge, 0, len(t.edges))
+	for edge := range t.edges {
+		edges = append(edges, edge)
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].From != edges[j].From {
+			return edges[i].From < edges[j].From
+		}
+		return edges[i].To < edges[j].To
+	})
+	return edges
+}
+
+// WriteDOT writes the topology as a Graphviz digraph, with event types as
+// ellipses, command types as diamonds and components as boxes.
+func (t *Topology) WriteDOT(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("digraph topology {\n\trankdir=LR;\n")
+	nodes := map[string]bool{}
+	for _, edge := range t.Edges() {
+		if !nodes[edge.From] {
+			shape := "ellipse"
+			if edge.Command {
+				shape = "diamond"
+			}
+			fmt.Fprintf(&b, "\t%q [shape=%s];\n", edge.From, shape)
+			nodes[edge.From] = true
+		}
+		if !nodes[edge.To] {
+			fmt.Fprintf(&b, "\t%q [shape=box];\n", edge.To)
+			nodes[edge.To] = true
+		}
+		fmt.Fprintf(&b, "\t%q -> %q;\n", edge.From, edge.To)
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteMermaid writes the topology as a Mermaid flowchart, with event types as
+// rounded nodes, command types as rhombuses and components as rectangles.
+func (t *Topology) WriteMermaid(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+	ids := map[string]string{}
+	id := func(name, open, close string) string {
+		if id, ok := ids[name]; ok {
+			return id
+		}
+		ids[name] = fmt.Sprintf("n%d", len(ids))
+		return fmt.Sprintf("%s%s\"%s\"%s", ids[name], open, strings.ReplaceAll(name, `"`, "#quot;"), close)
+	}
+	for _, edge := range t.Edges() {
+		open, close := "(", ")"
+		if edge.Command {
+			open, close = "{", "}"
+		}
+		from := id(edge.From, open, close)
+		fmt.Fprintf(&b, "\t%s --> %s\n", from, id(edge.To, "[", "]"))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
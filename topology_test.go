@@ -0,0 +1,110 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"bytes"
+	"testing"
+)
+
+type inspectableEventBus struct {
+	MockEventBus
+	handlers []HandlerRegistration
+}
+
+func (b *inspectableEventBus) Handlers() []HandlerRegistration {
+	return b.handlers
+}
+
+type inspectableCommandBus struct {
+	handlers map[string]CommandHandler
+}
+
+func (b *inspectableCommandBus) HandleCommand(command Command) error { return nil }
+func (b *inspectableCommandBus) SetHandler(handler CommandHandler, command Command) error {
+	return nil
+}
+func (b *inspectableCommandBus) CommandHandlers() map[string]CommandHandler {
+	return b.handlers
+}
+
+func TestTopology(t *testing.T) {
+	projector := NewTypedEventHandler("projector")
+	topology := NewTopology()
+
+	t.Log("add a bus that is not inspectable")
+	if err := topology.AddEventBus(&MockEventBus{}); err != ErrNotInspectable {
+		t.Error("there should be a ErrNotInspectable error:", err)
+	}
+
+	t.Log("add buses")
+	err := topology.AddEventBus(&inspectableEventBus{handlers: []HandlerRegistration{
+		{EventType: "TestEvent", Handler: projector},
+		{EventType: "TestEvent2", Handler: projector},
+		{Handler: NewTypedEventHandler("logger"), Global: true},
+	}})
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	err = topology.AddCommandBus(&inspectableCommandBus{handlers: map[string]CommandHandler{
+		"TestCommand": CommandHandlerFunc(func(Command) error { return nil }),
+	}})
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	topology.AddEdge(TopologyEdge{From: "TestEvent", To: "projector"})
+	if edges := topology.Edges(); len(edges) != 4 {
+		t.Error("there should be 4 edges:", edges)
+	}
+
+	t.Log("write Graphviz")
+	var b bytes.Buffer
+	if err := topology.WriteDOT(&b); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	expected := `digraph topology {
+	rankdir=LR;
+	"* (global)" [shape=ellipse];
+	"logger" [shape=box];
+	"* (global)" -> "logger";
+	"TestCommand" [shape=diamond];
+	"eventhorizon.CommandHandlerFunc" [shape=box];
+	"TestCommand" -> "eventhorizon.CommandHandlerFunc";
+	"TestEvent" [shape=ellipse];
+	"projector" [shape=box];
+	"TestEvent" -> "projector";
+	"TestEvent2" [shape=ellipse];
+	"TestEvent2" -> "projector";
+}
+`
+	if b.String() != expected {
+		t.Error("the graph should be correct:", b.String())
+	}
+
+	t.Log("write Mermaid")
+	b.Reset()
+	if err := topology.WriteMermaid(&b); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	expected = `flowchart LR
+	n0("* (global)") --> n1["logger"]
+	n2{"TestCommand"} --> n3["eventhorizon.CommandHandlerFunc"]
+	n4("TestEvent") --> n5["projector"]
+	n6("TestEvent2") --> n5
+`
+	if b.String() != expected {
+		t.Error("the flowchart should be correct:", b.String())
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"errors"
+)
+
+// ErrMismatchedAggregateType is when a loaded aggregate does not have the type
+// of a TypedRepository.
+var ErrMismatchedAggregateType = errors.New("mismatched aggregate type")
+
+// TypedAggregateBase is an aggregate base with a typed ID and state, to embed
+// in domain specific aggregates instead of *AggregateBase. The ID type can be
+// any string type, such as a domain specific UUID type.
+//
+// A typical aggregate example:
+//   type UserState struct {
+//       Name string
+//   }
+//
+//   type UserAggregate struct {
+//       *eventhorizon.TypedAggregateBase[UserID, UserState]
+//   }
+//
+//   func (a *UserAggregate) ApplyEvent(event eventhorizon.Event) {
+//       a.State().Name = event.(*UserCreated).Name
+//   }
+type TypedAggregateBase[TID ~string, TState any] struct {
+	*AggregateBase
+
+	id    TID
+	state TState
+}
+
+// NewTypedAggregateBase creates an aggregate with a typed ID and a zero state.
+func NewTypedAggregateBase[TID ~string, TState any](id TID) *TypedAggregateBase[TID, TState] {
+	return &TypedAggregateBase[TID, TState]{
+		AggregateBase: NewAggregateBase(UUID(id)),
+		id:            id,
+	}
+}
+
+// ID returns the typed ID of the aggregate.
+func (a *TypedAggregateBase[TID, TState]) ID() TID {
+	return a.id
+}
+
+// State returns the state of the aggregate, for changing it in ApplyEvent.
+func (a *TypedAggregateBase[TID, TState]) State() *TState {
+	return &a.state
+}
+
+// TypedRepository loads and saves aggregates of one concrete type with a
+// Repository, so that callers don't have to cast the loaded aggregates.
+type TypedRepository[T Aggregate] struct {
+	repository    Repository
+	aggregateType string
+}
+
+// NewTypedRepository creates a TypedRepository for the aggregates of a type,
+// which must have been registered in the repository with the concrete type T.
+func NewTypedRepository[T Aggregate](repository Repository, aggregateType string) *TypedRepository[T] {
+	return &TypedRepository[T]{
+		repository:    repository,
+		aggregateType: aggregateType,
+	}
+}
+
+// Load loads an aggregate. Returns ErrMismatchedAggregateType if the loaded
+// aggregate is not a T.
+func (r *TypedRepository[T]) Load(id UUID) (T, error) {
+	var zero T
+	aggregate, err := r.repository.Load(r.aggregateType, id)
+	if err != nil {
+		return zero, err
+	}
+	a, ok := aggregate.(T)
+	if !ok {
+		return zero, ErrMismatchedAggregateType
+	}
+	return a, nil
+}
+
+// Save saves the uncommitted events of an aggregate.
+func (r *TypedRepository[T]) Save(aggregate T) error {
+	return r.repository.Save(aggregate)
+}
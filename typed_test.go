@@ -0,0 +1,73 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"testing"
+)
+
+type typedTestID string
+
+type typedTestState struct {
+	Contents []string
+}
+
+type typedTestAggregate struct {
+	*TypedAggregateBase[typedTestID, typedTestState]
+}
+
+func (a *typedTestAggregate) AggregateType() string               { return "TestAggregate" }
+func (a *typedTestAggregate) HandleCommand(command Command) error { return nil }
+func (a *typedTestAggregate) ApplyEvent(event Event) {
+	a.State().Contents = append(a.State().Contents, event.(*TestEvent).Content)
+}
+
+func TestTypedRepository(t *testing.T) {
+	repo, store := createRepoAndStore(t)
+	repo.RegisterAggregate(&typedTestAggregate{},
+		func(id UUID) Aggregate {
+			return &typedTestAggregate{
+				TypedAggregateBase: NewTypedAggregateBase[typedTestID, typedTestState](typedTestID(id)),
+			}
+		},
+	)
+	typed := NewTypedRepository[*typedTestAggregate](repo, "TestAggregate")
+
+	t.Log("load a typed aggregate")
+	id := NewUUID()
+	store.Save([]Event{&TestEvent{id, "event1"}, &TestEvent{id, "event2"}})
+	aggregate, err := typed.Load(id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if aggregate.ID() != typedTestID(id) || aggregate.AggregateID() != id {
+		t.Error("the ID should be correct:", aggregate.ID())
+	}
+	if contents := aggregate.State().Contents; len(contents) != 2 || contents[1] != "event2" {
+		t.Error("the state should be correct:", contents)
+	}
+
+	t.Log("save a typed aggregate")
+	aggregate.StoreEvent(&TestEvent{id, "event3"})
+	if err := typed.Save(aggregate); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("load an aggregate of another type")
+	other := NewTypedRepository[*TestAggregate](repo, "TestAggregate")
+	if _, err := other.Load(id); err != ErrMismatchedAggregateType {
+		t.Error("there should be a ErrMismatchedAggregateType error:", err)
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"log"
+)
+
+// HandlerFunc is a typed function that handles events of a concrete type, and
+// ignores other events. It can be used as an event handler directly, but as
+// functions can't be compared buses that keep their handlers in maps need it
+// wrapped, for example in a TypedEventHandler.
+type HandlerFunc[T Event] func(context.Context, T) error
+
+// HandleEvent implements the HandleEvent method of the EventHandler interface.
+func (f HandlerFunc[T]) HandleEvent(event Event) {
+	f.HandleEventWithContext(context.Background(), event)
+}
+
+// HandleEventWithContext implements the HandleEventWithContext method of the
+// ContextEventHandler interface, logging the error if the event could not be
+// handled.
+func (f HandlerFunc[T]) HandleEventWithContext(ctx context.Context, event Event) {
+	if err := f.TryHandleEvent(ctx, event); err != nil {
+		log.Printf("error: handler func: could not handle %s: %v\n", event.EventType(), err)
+	}
+}
+
+// TryHandleEvent implements the TryHandleEvent method of the
+// FallibleEventHandler interface.
+func (f HandlerFunc[T]) TryHandleEvent(ctx context.Context, event Event) error {
+	if e, ok := event.(T); ok {
+		return f(ctx, e)
+	}
+	return nil
+}
+
+// TypedEventHandler is a named event handler made up of typed functions, one
+// per event type, for example for a projector that would otherwise switch on
+// the types of events in HandleEvent:
+//   h := eventhorizon.NewTypedEventHandler("InvitationProjector")
+//   eventhorizon.AddHandlerFunc(h, func(ctx context.Context, e *InviteCreated) error {
+//       ...
+//   })
+// Each event is handled by all functions of its type, in the order they were
+// added.
+type TypedEventHandler struct {
+	name  string
+	funcs []FallibleEventHandler
+}
+
+// NewTypedEventHandler creates a TypedEventHandler with a name.
+func NewTypedEventHandler(name string) *TypedEventHandler {
+	return &TypedEventHandler{
+		name: name,
+	}
+}
+
+// AddHandlerFunc adds a typed function to a TypedEventHandler, which handles
+// the events of the type T.
+func AddHandlerFunc[T Event](h *TypedEventHandler, f func(context.Context, T) error) {
+	h.funcs = append(h.funcs, HandlerFunc[T](f))
+}
+
+// HandlerName implements the HandlerName method of the NamedEventHandler
+// interface.
+func (h *TypedEventHandler) HandlerName() string {
+	return h.name
+}
+
+// HandleEvent implements the HandleEvent method of the EventHandler interface.
+func (h *TypedEventHandler) HandleEvent(event Event) {
+	h.HandleEventWithContext(context.Background(), event)
+}
+
+// HandleEventWithContext implements the HandleEventWithContext method of the
+// ContextEventHandler interface, logging the error if the event could not be
+// handled.
+func (h *TypedEventHandler) HandleEventWithContext(ctx context.Context, event Event) {
+	if err := h.TryHandleEvent(ctx, event); err != nil {
+		log.Printf("error: %s: could not handle %s: %v\n", h.name, event.EventType(), err)
+	}
+}
+
+// TryHandleEvent implements the TryHandleEvent method of the
+// FallibleEventHandler interface. It stops at the first function that fails.
+func (h *TypedEventHandler) TryHandleEvent(ctx context.Context, event Event) error {
+	for _, f := range h.funcs {
+		if err := f.TryHandleEvent(ctx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
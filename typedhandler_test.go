@@ -0,0 +1,75 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestHandlerFunc(t *testing.T) {
+	var handled []string
+	f := HandlerFunc[*TestEvent](func(ctx context.Context, event *TestEvent) error {
+		handled = append(handled, event.Content)
+		return nil
+	})
+
+	t.Log("handle an event of the type")
+	id := NewUUID()
+	f.HandleEvent(&TestEvent{id, "event1"})
+	if !reflect.DeepEqual(handled, []string{"event1"}) {
+		t.Error("the event should be handled:", handled)
+	}
+
+	t.Log("ignore an event of another type")
+	if err := f.TryHandleEvent(context.Background(), &TestEvent2{id, "event2"}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(handled) != 1 {
+		t.Error("the event should not be handled:", handled)
+	}
+}
+
+func TestTypedEventHandler(t *testing.T) {
+	h := NewTypedEventHandler("projector")
+	var handled []string
+	AddHandlerFunc(h, func(ctx context.Context, event *TestEvent) error {
+		handled = append(handled, "TestEvent:"+event.Content)
+		return nil
+	})
+	handleErr := errors.New("error")
+	AddHandlerFunc(h, func(ctx context.Context, event *TestEvent2) error {
+		handled = append(handled, "TestEvent2:"+event.Content)
+		return handleErr
+	})
+	if HandlerName(h) != "projector" {
+		t.Error("the handler name should be correct:", HandlerName(h))
+	}
+
+	t.Log("handle events by type")
+	id := NewUUID()
+	if err := TryHandleEvent(context.Background(), h, &TestEvent{id, "event1"}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := TryHandleEvent(context.Background(), h, &TestEvent2{id, "event2"}); err != handleErr {
+		t.Error("the error should be returned:", err)
+	}
+	expected := []string{"TestEvent:event1", "TestEvent2:event2"}
+	if !reflect.DeepEqual(handled, expected) {
+		t.Error("the events should be handled by type:", handled)
+	}
+}
@@ -26,16 +26,22 @@ import (
 // current one allows to parse string with only one opening
 // or closing bracket.
 const hexPattern = "^(urn\\:uuid\\:)?\\{?([a-f0-9]{8})-([a-f0-9]{4})-" +
-	"([1-5][a-f0-9]{3})-([a-f0-9]{4})-([a-f0-9]{12})\\}?$"
+	"([1-8][a-f0-9]{3})-([a-f0-9]{4})-([a-f0-9]{12})\\}?$"
 
 var re = regexp.MustCompile(hexPattern)
 
-// UUID is a unique identifier, based on the UUID spec. It must be exactly 16
-// bytes long.
+// UUID is a unique identifier, based on the UUID spec by default. Other kinds
+// of IDs can be used with SetIDGenerator.
 type UUID string
 
-// NewUUID creates a new UUID of type v4.
+// NewUUID creates a new ID with the ID generator, which creates UUIDs of type
+// v4 unless another one is set with SetIDGenerator.
 func NewUUID() UUID {
+	return currentIDGenerator().NewID()
+}
+
+// newUUIDv4 creates a new UUID of type v4.
+func newUUIDv4() UUID {
 	var u [16]byte
 
 	// Set all bits to randomly (or pseudo-randomly) chosen values.
@@ -89,7 +95,7 @@ func (id *UUID) UnmarshalJSON(data []byte) error {
 
 	// Grab string value without the surrounding " characters
 	value := string(data[1 : len(data)-1])
-	parsed, err := ParseUUID(value)
+	parsed, err := ParseID(value)
 	if err != nil {
 		return fmt.Errorf("invalid UUID in JSON, %v: %v", value, err)
 	}
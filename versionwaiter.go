@@ -0,0 +1,67 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"time"
+)
+
+// VersionWaiter waits for read models to reflect a version, so that API
+// handlers can read their own writes. The version is typically the one
+// returned by AggregateCommandHandler.HandleCommandWithVersion, and the
+// projector should save the read model with SaveVersion and the version of the
+// events it handles.
+type VersionWaiter struct {
+	repo     VersionedReadRepository
+	clock    Clock
+	interval time.Duration
+}
+
+// NewVersionWaiter creates a new VersionWaiter that polls a repository every
+// 10 ms. The clock is used for polling.
+func NewVersionWaiter(repo VersionedReadRepository, clock Clock) *VersionWaiter {
+	return &VersionWaiter{
+		repo:     repo,
+		clock:    clock,
+		interval: 10 * time.Millisecond,
+	}
+}
+
+// SetInterval sets the interval between polls.
+func (w *VersionWaiter) SetInterval(interval time.Duration) {
+	w.interval = interval
+}
+
+// Wait blocks until the read model with an ID has a revision with at least a
+// version and returns the latest read model. It returns the error of the
+// context if it is done first, so a timeout should be set on it.
+func (w *VersionWaiter) Wait(ctx context.Context, id UUID, version int) (interface{}, error) {
+	for {
+		revisions, err := w.repo.FindRevisions(id)
+		if err != nil && err != ErrModelNotFound {
+			return nil, err
+		}
+		if n := len(revisions); n > 0 && revisions[n-1].Version >= version {
+			return w.repo.Find(id)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-w.clock.After(w.interval):
+		}
+	}
+}
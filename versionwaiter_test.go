@@ -0,0 +1,83 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestVersionWaiter(t *testing.T) {
+	repo := &mockVersionedReadRepository{}
+	clock := &tickClock{now: time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC), ticks: make(chan time.Time)}
+	waiter := NewVersionWaiter(repo, clock)
+	id := NewUUID()
+
+	t.Log("wait until the version is reached")
+	repo.SaveVersion(id, "model1", 1)
+	var model interface{}
+	var err error
+	done := make(chan struct{})
+	go func() {
+		model, err = waiter.Wait(context.Background(), id, 2)
+		close(done)
+	}()
+	clock.ticks <- clock.now
+	repo.SaveVersion(id, "model2", 2)
+	tickUntil(clock, done)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if model != "model2" {
+		t.Error("the model should be correct:", model)
+	}
+
+	t.Log("time out")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := waiter.Wait(ctx, id, 3); err != context.Canceled {
+		t.Error("there should be a context error:", err)
+	}
+}
+
+type mockVersionedReadRepository struct {
+	VersionedReadRepository
+	revisions []ModelRevision
+	mu        sync.Mutex
+}
+
+func (r *mockVersionedReadRepository) SaveVersion(id UUID, model interface{}, version int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.revisions = append(r.revisions, ModelRevision{Version: version, Model: model})
+	return nil
+}
+
+func (r *mockVersionedReadRepository) Find(id UUID) (interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.revisions[len(r.revisions)-1].Model, nil
+}
+
+func (r *mockVersionedReadRepository) FindRevisions(id UUID) ([]ModelRevision, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.revisions) == 0 {
+		return nil, ErrModelNotFound
+	}
+	return append([]ModelRevision{}, r.revisions...), nil
+}